@@ -7,17 +7,26 @@ import (
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/config"
 	"github.com/obra/packnplay/pkg/container"
 	"github.com/obra/packnplay/pkg/devcontainer"
 	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/hooks"
+	"github.com/obra/packnplay/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
 var (
-	attachPath     string
-	attachWorktree string
+	attachPath      string
+	attachWorktree  string
+	attachNewShell  bool
+	attachName      string
+	attachLatest    bool
+	attachEnvConfig string
 )
 
 // getTTYFlags returns appropriate TTY flags for docker commands
@@ -32,7 +41,12 @@ func getTTYFlags() []string {
 var attachCmd = &cobra.Command{
 	Use:   "attach [flags]",
 	Short: "Attach to running container",
-	Long:  `Attach to an existing running container with an interactive shell.`,
+	Long: `Attach to an existing running container with an interactive shell.
+
+Without --worktree or --name, attach looks for running containers launched from
+the project directory. If several match, a picker shows each one's worktree,
+status, and when it was last used; --latest picks the most recently used one
+without asking.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Determine working directory
 		workDir := attachPath
@@ -49,34 +63,86 @@ var attachCmd = &cobra.Command{
 			return fmt.Errorf("failed to resolve path: %w", err)
 		}
 
-		// Determine worktree name
-		worktreeName := attachWorktree
-		if worktreeName == "" {
-			return fmt.Errorf("--worktree flag is required for attach")
+		// Resolve --env-config before touching the container so a typo fails fast
+		var envArgs []string
+		if attachEnvConfig != "" {
+			cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if err := applyConfigProfile(cfg, ""); err != nil {
+				return err
+			}
+			env, err := resolveEnvConfig(cfg, attachEnvConfig)
+			if err != nil {
+				return err
+			}
+			for _, kv := range env {
+				envArgs = append(envArgs, "-e", kv)
+			}
 		}
 
-		// Generate container name
-		containerName := container.GenerateContainerName(workDir, worktreeName)
-
 		// Initialize Docker client
 		dockerClient, err := docker.NewClient(false)
 		if err != nil {
 			return fmt.Errorf("failed to initialize docker: %w", err)
 		}
 
-		// Check if container is running
-		output, err := dockerClient.Run("ps", "--filter", fmt.Sprintf("name=%s", containerName), "--format", "{{.Names}}")
-		if err != nil {
-			return fmt.Errorf("failed to check container status: %w", err)
+		containerName := attachName
+		if containerName == "" && attachWorktree != "" {
+			containerName = container.GenerateContainerName(workDir, attachWorktree)
+		}
+
+		if containerName != "" {
+			// Check if container is running
+			output, err := dockerClient.Run("ps", "--filter", fmt.Sprintf("name=%s", containerName), "--format", "{{.Names}}")
+			if err != nil {
+				return fmt.Errorf("failed to check container status: %w", err)
+			}
+
+			if !containsLine(output, containerName) {
+				if attachName != "" {
+					return fmt.Errorf("no running container named '%s'", attachName)
+				}
+				return fmt.Errorf("no running container found for worktree '%s'", attachWorktree)
+			}
+		} else {
+			candidates, err := findAttachCandidates(dockerClient, workDir)
+			if err != nil {
+				return err
+			}
+			chosen, err := chooseAttachCandidate(candidates, attachLatest)
+			if err != nil {
+				return fmt.Errorf("%w; use --worktree or --name to pick a container", err)
+			}
+			if chosen == nil {
+				if !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+					return ambiguousAttachError(candidates)
+				}
+				if chosen, err = pickAttachCandidate(candidates); err != nil {
+					return err
+				}
+				if chosen == nil {
+					return fmt.Errorf("attach cancelled")
+				}
+			}
+			containerName = chosen.Name
 		}
+		container.RecordLastUsed(container.LastUsedPath(), containerName, time.Now())
 
-		if strings.TrimSpace(output) != containerName {
-			return fmt.Errorf("no running container found for worktree '%s'", worktreeName)
+		// remoteEnv applies to each process exec'd into the container, resolved
+		// against this shell's environment
+		devConfig, err := devcontainer.LoadConfig(workDir)
+		if err != nil {
+			devConfig = nil
+		}
+		var remoteEnvArgs []string
+		for _, kv := range runner.RemoteEnv(dockerClient, containerName, devConfig, workDir) {
+			remoteEnvArgs = append(remoteEnvArgs, "-e", kv)
 		}
 
 		// Run postAttachCommand if configured
-		devConfig, err := devcontainer.LoadConfig(workDir)
-		if err == nil && devConfig != nil && devConfig.PostAttachCommand != nil {
+		if devConfig != nil && devConfig.PostAttachCommand != nil {
 			fmt.Fprintf(os.Stderr, "Running postAttachCommand...\n")
 
 			// Get the remote user from devcontainer config (matching LifecycleExecutor behavior)
@@ -92,13 +158,21 @@ var attachCmd = &cobra.Command{
 				if cmdStr == "" {
 					continue
 				}
-				_, err := dockerClient.Run("exec", "-u", remoteUser, containerName, "/bin/sh", "-c", cmdStr)
+				args := append([]string{"exec", "-u", remoteUser}, remoteEnvArgs...)
+				_, err := dockerClient.Run(append(args, containerName, "/bin/sh", "-c", cmdStr)...)
+				event := audit.Event{Type: audit.TypeLifecycle, Container: containerName, Command: "postAttach", Argv: []string{cmdStr}}
 				if err != nil {
+					event.Error = err.Error()
 					fmt.Fprintf(os.Stderr, "Warning: postAttachCommand failed: %v\n", err)
 				}
+				runner.RecordAudit(event)
 			}
 		}
 
+		if err := runner.RunContainerHook(dockerClient, containerName, hooks.PreAttach, false); err != nil {
+			return err
+		}
+
 		// Execute docker exec with interactive shell
 		cmdPath, err := exec.LookPath(dockerClient.Command())
 		if err != nil {
@@ -107,8 +181,25 @@ var attachCmd = &cobra.Command{
 
 		argv := []string{filepath.Base(cmdPath), "exec"}
 		argv = append(argv, getTTYFlags()...)
-		argv = append(argv, containerName, "/bin/bash")
+		argv = append(argv, remoteEnvArgs...)
+		argv = append(argv, envArgs...)
+
+		// Re-enter a persistent session left by `run --persist-session` instead of a fresh shell
+		sessionUser := ""
+		if devConfig != nil {
+			sessionUser = devConfig.RemoteUser
+		}
+		command := []string{"/bin/bash"}
+		if !attachNewShell && runner.HasPersistentSession(dockerClient, containerName, sessionUser) {
+			if sessionUser != "" {
+				argv = append(argv, "-u", sessionUser)
+			}
+			command = []string{"tmux", "attach-session", "-t", runner.SessionName}
+		}
+		argv = append(argv, containerName)
+		argv = append(argv, command...)
 
+		runner.RecordAudit(audit.Event{Type: audit.TypeAttach, Container: containerName, Argv: command})
 		return syscall.Exec(cmdPath, argv, os.Environ())
 	},
 }
@@ -118,4 +209,18 @@ func init() {
 
 	attachCmd.Flags().StringVar(&attachPath, "path", "", "Project path (default: pwd)")
 	attachCmd.Flags().StringVar(&attachWorktree, "worktree", "", "Worktree name")
+	attachCmd.Flags().StringVar(&attachName, "name", "", "Container name to attach to")
+	attachCmd.Flags().BoolVar(&attachLatest, "latest", false, "If several containers match the project, attach to the most recently used one")
+	attachCmd.Flags().BoolVar(&attachNewShell, "new-shell", false, "Start a fresh shell even if a persistent session is running")
+	attachCmd.Flags().StringVar(&attachEnvConfig, "env-config", "", "Named env config to set in the shell (see: packnplay env-config list)")
+}
+
+// containsLine reports whether output has a line exactly equal to want
+func containsLine(output, want string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == want {
+			return true
+		}
+	}
+	return false
 }
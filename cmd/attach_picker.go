@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker"
+)
+
+// attachCandidate is a running packnplay container that attach could connect to
+type attachCandidate struct {
+	Name     string
+	Status   string
+	Worktree string
+	LastUsed time.Time
+}
+
+// findAttachCandidates returns the running packnplay containers for the project at
+// workDir, most recently used first
+func findAttachCandidates(dockerClient *docker.Client, workDir string) ([]attachCandidate, error) {
+	output, err := dockerClient.Run("ps", "--filter", "label=managed-by=packnplay", "--format", "{{json .}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return parseAttachCandidates(output, inspectListedLabels(dockerClient, output), workDir, container.LoadLastUsed(container.LastUsedPath())), nil
+}
+
+// parseAttachCandidates picks containers launched from workDir out of `ps --format {{json .}}`
+// output, using their inspected labels where available
+func parseAttachCandidates(output string, inspected map[string]map[string]string, workDir string, lastUsed map[string]time.Time) []attachCandidate {
+	var candidates []attachCandidate
+	for _, line := range splitLines(output) {
+		if line == "" {
+			continue
+		}
+		var info ContainerInfo
+		if err := json.Unmarshal([]byte(line), &info); err != nil {
+			continue
+		}
+
+		metadata := container.ReadMetadata(listedLabels(inspected, info))
+		if metadata.HostPath != workDir {
+			continue
+		}
+		candidates = append(candidates, attachCandidate{
+			Name:     info.Names,
+			Status:   info.Status,
+			Worktree: metadata.Worktree,
+			LastUsed: lastUsed[info.Names],
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].LastUsed.Equal(candidates[j].LastUsed) {
+			return candidates[i].LastUsed.After(candidates[j].LastUsed)
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates
+}
+
+// chooseAttachCandidate applies --latest, or returns nil when the user needs to pick
+func chooseAttachCandidate(candidates []attachCandidate, latest bool) (*attachCandidate, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no running packnplay containers found for this project")
+	}
+	if latest || len(candidates) == 1 {
+		return &candidates[0], nil
+	}
+	return nil, nil
+}
+
+// ambiguousAttachError explains how to choose a container without the interactive picker
+func ambiguousAttachError(candidates []attachCandidate) error {
+	var b strings.Builder
+	b.WriteString("multiple running containers match this project:\n")
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "  %s (worktree %s, last used %s)\n", c.Name, c.Worktree, formatLastUsed(c.LastUsed, time.Now()))
+	}
+	b.WriteString("Choose one with --name <container>, --worktree <name>, or --latest")
+	return fmt.Errorf("%s", b.String())
+}
+
+// formatLastUsed renders a last-used time relative to now
+func formatLastUsed(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// containerPicker is a bubbletea list for choosing which container to attach to
+type containerPicker struct {
+	candidates []attachCandidate
+	cursor     int
+	chosen     int // -1 until the user picks
+	now        time.Time
+}
+
+func newContainerPicker(candidates []attachCandidate) *containerPicker {
+	return &containerPicker{candidates: candidates, chosen: -1, now: time.Now()}
+}
+
+// Init implements tea.Model
+func (m *containerPicker) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m *containerPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.candidates)-1 {
+				m.cursor++
+			}
+		case "enter":
+			m.chosen = m.cursor
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// View implements tea.Model
+func (m *containerPicker) View() string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("39"))
+	selected := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	nameWidth, worktreeWidth := len("CONTAINER"), len("WORKTREE")
+	for _, c := range m.candidates {
+		nameWidth = max(nameWidth, len(c.Name))
+		worktreeWidth = max(worktreeWidth, len(c.Worktree))
+	}
+	row := func(name, worktree, status, lastUsed string) string {
+		return fmt.Sprintf("%-*s  %-*s  %-24s  %s", nameWidth, name, worktreeWidth, worktree, status, lastUsed)
+	}
+
+	var b strings.Builder
+	b.WriteString(title.Render("Multiple containers match this project. Attach to:") + "\n\n")
+	b.WriteString(dim.Render("  "+row("CONTAINER", "WORKTREE", "STATUS", "LAST USED")) + "\n")
+	for i, c := range m.candidates {
+		line := row(c.Name, c.Worktree, c.Status, formatLastUsed(c.LastUsed, m.now))
+		if i == m.cursor {
+			b.WriteString(selected.Render("> "+line) + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	b.WriteString("\n" + dim.Render("↑/↓ to move, enter to attach, q to cancel") + "\n")
+	return b.String()
+}
+
+// pickAttachCandidate shows the picker and returns the chosen container, or nil if cancelled
+func pickAttachCandidate(candidates []attachCandidate) (*attachCandidate, error) {
+	finalModel, err := tea.NewProgram(newContainerPicker(candidates)).Run()
+	if err != nil {
+		return nil, fmt.Errorf("container picker failed: %w", err)
+	}
+	picker, ok := finalModel.(*containerPicker)
+	if !ok || picker.chosen < 0 {
+		return nil, nil
+	}
+	return &candidates[picker.chosen], nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const attachPsOutput = `{"Names":"packnplay-app-main","Status":"Up 2 hours","Labels":"managed-by=packnplay,packnplay-worktree=main,packnplay-host-path=/src/app"}
+{"Names":"packnplay-app-feature","Status":"Up 5 minutes","Labels":"managed-by=packnplay,packnplay-worktree=feature,packnplay-host-path=/src/app"}
+{"Names":"packnplay-other-main","Status":"Up 1 hour","Labels":"managed-by=packnplay,packnplay-worktree=main,packnplay-host-path=/src/other"}
+`
+
+func TestParseAttachCandidates(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	lastUsed := map[string]time.Time{
+		"packnplay-app-feature": now.Add(-time.Hour),
+		"packnplay-app-main":    now.Add(-10 * time.Minute),
+	}
+
+	candidates := parseAttachCandidates(attachPsOutput, nil, "/src/app", lastUsed)
+	if len(candidates) != 2 {
+		t.Fatalf("got %d candidates, want 2: %+v", len(candidates), candidates)
+	}
+	if candidates[0].Name != "packnplay-app-main" || candidates[1].Name != "packnplay-app-feature" {
+		t.Errorf("candidates = %+v, want most recently used first", candidates)
+	}
+	if candidates[1].Worktree != "feature" || candidates[1].Status != "Up 5 minutes" {
+		t.Errorf("candidate = %+v, want worktree and status from ps", candidates[1])
+	}
+}
+
+func TestChooseAttachCandidate(t *testing.T) {
+	candidates := parseAttachCandidates(attachPsOutput, nil, "/src/app", nil)
+
+	if _, err := chooseAttachCandidate(nil, false); err == nil {
+		t.Error("expected an error with no candidates")
+	}
+	if chosen, err := chooseAttachCandidate(candidates[:1], false); err != nil || chosen.Name != candidates[0].Name {
+		t.Errorf("single candidate: chosen = %+v, err = %v", chosen, err)
+	}
+	if chosen, err := chooseAttachCandidate(candidates, false); err != nil || chosen != nil {
+		t.Errorf("several candidates: chosen = %+v, err = %v, want nil so the user picks", chosen, err)
+	}
+	if chosen, err := chooseAttachCandidate(candidates, true); err != nil || chosen.Name != candidates[0].Name {
+		t.Errorf("--latest: chosen = %+v, err = %v", chosen, err)
+	}
+}
+
+func TestAmbiguousAttachError(t *testing.T) {
+	err := ambiguousAttachError(parseAttachCandidates(attachPsOutput, nil, "/src/app", nil))
+	for _, want := range []string{"packnplay-app-main", "packnplay-app-feature", "--latest", "--name"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestFormatLastUsed(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Time{}, "never"},
+		{now.Add(-10 * time.Second), "just now"},
+		{now.Add(-5 * time.Minute), "5m ago"},
+		{now.Add(-3 * time.Hour), "3h ago"},
+		{now.Add(-50 * time.Hour), "2d ago"},
+	}
+	for _, tt := range tests {
+		if got := formatLastUsed(tt.t, now); got != tt.want {
+			t.Errorf("formatLastUsed(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestContainerPickerNavigation(t *testing.T) {
+	picker := newContainerPicker(parseAttachCandidates(attachPsOutput, nil, "/src/app", nil))
+
+	picker.Update(tea.KeyMsg{Type: tea.KeyDown})
+	picker.Update(tea.KeyMsg{Type: tea.KeyDown}) // stays on the last row
+	if picker.cursor != 1 {
+		t.Errorf("cursor = %d, want 1", picker.cursor)
+	}
+	if !strings.Contains(picker.View(), "> packnplay-app-main") {
+		t.Errorf("View() should highlight the selected row:\n%s", picker.View())
+	}
+
+	_, cmd := picker.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if picker.chosen != 1 || cmd == nil {
+		t.Errorf("chosen = %d, want 1 and a quit command", picker.chosen)
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditProject string
+	auditSince   string
+	auditType    string
+	auditJSON    bool
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the log of container activity",
+	Long: `packnplay records container creations (with the credential types given to
+them), attaches, commands run, lifecycle commands, and stops and removals in
+$XDG_STATE_HOME/packnplay/audit.jsonl. The log is rotated at 10 MB, keeping
+five older files (audit.jsonl.1 to audit.jsonl.5).`,
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show recorded container events",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var since time.Time
+		if auditSince != "" {
+			window, err := parseDayDuration("since", auditSince)
+			if err != nil {
+				return err
+			}
+			since = time.Now().Add(-window)
+		}
+
+		events, err := audit.Load(audit.DefaultPath())
+		if err != nil {
+			return err
+		}
+		events = audit.Filter(events, auditProjectFilter(auditProject), since)
+		if auditType != "" {
+			var filtered []audit.Event
+			for _, event := range events {
+				if event.Type == auditType {
+					filtered = append(filtered, event)
+				}
+			}
+			events = filtered
+		}
+
+		if auditJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			for _, event := range events {
+				if err := encoder.Encode(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		if len(events) == 0 {
+			fmt.Println("No events recorded")
+			return nil
+		}
+		printAuditEvents(os.Stdout, events)
+		return nil
+	},
+}
+
+// auditProjectFilter resolves --project: an existing directory matches the
+// project directory recorded in events, anything else the project's name
+func auditProjectFilter(project string) string {
+	if project == "" {
+		return ""
+	}
+	if info, err := os.Stat(project); err != nil || !info.IsDir() {
+		return project
+	}
+	if abs, err := filepath.Abs(project); err == nil {
+		project = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(project); err == nil {
+		project = resolved
+	}
+	return project
+}
+
+// printAuditEvents renders events as a table, oldest first
+func printAuditEvents(out io.Writer, events []audit.Event) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TIME\tTYPE\tCONTAINER\tUSER\tDETAILS")
+	for _, event := range events {
+		name := event.Container
+		if name == "" {
+			name = shortContainerID(event.ContainerID)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			event.Time.Local().Format("2006-01-02 15:04:05"),
+			event.Type,
+			name,
+			event.User,
+			auditDetails(event),
+		)
+	}
+	_ = w.Flush()
+}
+
+// auditDetails summarizes what an event records beyond its container
+func auditDetails(event audit.Event) string {
+	var details []string
+	switch event.Type {
+	case audit.TypeCreate:
+		if event.Image != "" {
+			details = append(details, "image "+event.Image)
+		}
+		credentials := "none"
+		if len(event.Credentials) > 0 {
+			credentials = strings.Join(event.Credentials, ", ")
+		}
+		details = append(details, "credentials: "+credentials)
+	case audit.TypeLifecycle:
+		details = append(details, event.Command+"Command: "+strings.Join(event.Argv, "; "))
+	default:
+		if len(event.Argv) > 0 {
+			details = append(details, formatArgv(event.Argv))
+		}
+	}
+	if event.Error != "" {
+		details = append(details, "failed: "+strings.SplitN(event.Error, "\n", 2)[0])
+	}
+	return strings.Join(details, "; ")
+}
+
+// formatArgv renders a command, quoting arguments that need it
+func formatArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`;&|<>*?") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shortContainerID abbreviates a container ID as docker ps does
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditShowCmd)
+
+	auditShowCmd.Flags().StringVar(&auditProject, "project", "", "Only show events of this project (directory or name)")
+	auditShowCmd.Flags().StringVar(&auditSince, "since", "", "Only show events within this window (e.g. 24h, 7d)")
+	auditShowCmd.Flags().StringVar(&auditType, "type", "", "Only show events of this type (create, attach, exec, lifecycle, stop, remove)")
+	auditShowCmd.Flags().BoolVar(&auditJSON, "json", false, "Output events as JSON lines")
+}
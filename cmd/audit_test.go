@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/audit"
+)
+
+func TestPrintAuditEvents(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []audit.Event{
+		{Time: now, Type: audit.TypeCreate, User: "jesse", Container: "packnplay-app-main", Image: "node:20", Credentials: []string{"git", "gh:acme/app"}},
+		{Time: now, Type: audit.TypeLifecycle, User: "jesse", Container: "packnplay-app-main", Command: "postCreate", Argv: []string{"npm ci"}, Error: "exit status 1\nnpm ERR!"},
+		{Time: now, Type: audit.TypeExec, User: "jesse", Container: "packnplay-app-main", Argv: []string{"claude", "-p", "fix the tests"}},
+		{Time: now, Type: audit.TypeStop, User: "jesse", ContainerID: "3f2a9c81d7e6b5a4"},
+	}
+
+	var out bytes.Buffer
+	printAuditEvents(&out, events)
+	got := out.String()
+	for _, want := range []string{
+		"image node:20; credentials: git, gh:acme/app",
+		"postCreateCommand: npm ci; failed: exit status 1\n",
+		`claude -p "fix the tests"`,
+		"stop       3f2a9c81d7e6",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+}
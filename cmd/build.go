@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	buildPrintDockerfile bool
+	buildOutput          string
+	buildLast            bool
+	buildTags            []string
+	buildPush            bool
+	buildRuntime         string
+	buildRebuild         bool
+	buildVerbose         bool
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build [path]",
+	Short: "Build a project's image without starting a container",
+	Long: `Pull or build the image of the project (default: the current directory),
+with its features, exactly as run would, but without creating a container or
+running lifecycle commands. The image's reference is printed on stdout, one
+line per name: the local image, then each --tag. With --push, the --tag
+references are pushed, so CI can check that the devcontainer builds and
+publish it:
+
+  packnplay build --tag ghcr.io/acme/api-dev:$SHA --push
+
+--print-dockerfile renders the Dockerfile instead of building, and lists the
+files of its build context. With features, this is the Dockerfile packnplay
+generates to install them, which otherwise only exists while the image builds.
+The context files follow the Dockerfile as comments, so the output is still a
+Dockerfile. Each feature build also keeps the Dockerfile it generated in
+$XDG_STATE_HOME/packnplay/dockerfiles/; --last shows that one, as used by the
+last build (including a failed one).`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		render := buildPrintDockerfile || buildOutput != ""
+		if buildLast && !render {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--last needs --print-dockerfile or --output")
+		}
+		if render && (buildPush || len(buildTags) > 0) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--print-dockerfile and --output don't build; they can't be combined with --tag or --push")
+		}
+		if buildPush && len(buildTags) == 0 {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--push needs a --tag naming the registry reference to push")
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigProfile(cfg, ""); err != nil {
+			return err
+		}
+		runtime := buildRuntime
+		if runtime == "" {
+			runtime = cfg.ContainerRuntime
+		}
+		runConfig := &runner.RunConfig{
+			Runtime:            runtime,
+			Verbose:            buildVerbose,
+			DefaultImage:       cfg.GetDefaultImage(),
+			NoRegistryLogin:    cfg.NoRegistryLogin,
+			BuildContextWarnMB: cfg.BuildContextWarnMB,
+			NoBuildCache:       buildRebuild,
+			Proxy:              cfg.Proxy,
+			Registry:           cfg.Registry,
+			BuildSecrets:       cfg.BuildSecrets,
+		}
+		if len(args) > 0 {
+			runConfig.Path = args[0]
+		}
+
+		if !render {
+			references, err := runner.BuildProjectImage(runConfig, buildTags, buildPush)
+			if err != nil {
+				return err
+			}
+			for _, reference := range references {
+				fmt.Println(reference)
+			}
+			return nil
+		}
+
+		var rendered string
+		if buildLast {
+			rendered, err = runner.LastRenderedBuild(runConfig)
+			if err != nil {
+				return err
+			}
+		} else {
+			build, err := runner.RenderProjectBuild(runConfig)
+			if err != nil {
+				return err
+			}
+			rendered = build.Format()
+		}
+
+		if buildOutput != "" {
+			if err := os.WriteFile(buildOutput, []byte(rendered), 0644); err != nil {
+				return fmt.Errorf("failed to write Dockerfile: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %s\n", buildOutput)
+			return nil
+		}
+		fmt.Print(rendered)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(buildCmd)
+	buildCmd.Flags().BoolVar(&buildPrintDockerfile, "print-dockerfile", false, "Print the rendered Dockerfile and build context files")
+	buildCmd.Flags().StringVarP(&buildOutput, "output", "o", "", "Write the rendered Dockerfile to this file instead of printing it")
+	buildCmd.Flags().BoolVar(&buildLast, "last", false, "Show the Dockerfile the last feature build generated instead of rendering it")
+	buildCmd.Flags().StringArrayVarP(&buildTags, "tag", "t", nil, "Also tag the image with this reference (repeatable)")
+	buildCmd.Flags().BoolVar(&buildPush, "push", false, "Push the --tag references after building")
+	buildCmd.Flags().StringVar(&buildRuntime, "runtime", "", "Container runtime to use (docker/podman/nerdctl/lima/container)")
+	buildCmd.Flags().BoolVar(&buildRebuild, "rebuild", false, "Build without the layer cache, reinstalling features")
+	buildCmd.Flags().BoolVarP(&buildVerbose, "verbose", "v", false, "Show detailed output")
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	codePath       string
+	codeWorktree   string
+	codeNoWorktree bool
+	codeRuntime    string
+	codeEditor     string
+	codePrint      bool
+)
+
+// codeEditors maps the supported editor commands to their user data directory name
+var codeEditors = map[string]string{
+	"code":          "Code",
+	"code-insiders": "Code - Insiders",
+	"cursor":        "Cursor",
+}
+
+var codeCmd = &cobra.Command{
+	Use:   "code [flags]",
+	Short: "Open VS Code or Cursor attached to the project's container",
+	Long: `Bring the project's container up (like run --detach --reconnect) and open
+VS Code, or Cursor with --editor cursor, attached to it with the Dev Containers
+extension, in the container's workspace folder.
+
+Before launching the editor, packnplay writes the extension's attached-container
+settings for the container: the workspace folder, the remote user, and the
+extensions and settings from customizations.vscode in devcontainer.json. With
+--print, the folder URI is printed instead of launching the editor.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appDir, ok := codeEditors[codeEditor]
+		if !ok {
+			return errdefs.Errorf(errdefs.CategoryUsage, "unsupported editor %q (supported: code, code-insiders, cursor)", codeEditor)
+		}
+		if codeRuntime == "container" {
+			return errdefs.Errorf(errdefs.CategoryUsage, "VS Code can't attach to containers of the Apple container runtime")
+		}
+		editorPath := ""
+		if !codePrint {
+			var err error
+			if editorPath, err = exec.LookPath(codeEditor); err != nil {
+				return errdefs.Errorf(errdefs.CategoryUsage, "%s not found in PATH; install its shell command or use --print to get the folder URI", codeEditor)
+			}
+		}
+
+		workDir := codePath
+		if workDir == "" {
+			var err error
+			workDir, err = os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+		}
+		workDir, err := filepath.Abs(workDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		runArgs := []string{"run", "--detach", "--json", "--reconnect", "--path", workDir}
+		if codeWorktree != "" {
+			runArgs = append(runArgs, "--worktree", codeWorktree)
+		}
+		if codeNoWorktree {
+			runArgs = append(runArgs, "--no-worktree")
+		}
+		if codeRuntime != "" {
+			runArgs = append(runArgs, "--runtime", codeRuntime)
+		}
+		info, err := runDetached(runArgs)
+		if err != nil {
+			return err
+		}
+
+		if err := writeAttachedContainerConfig(appDir, info, loadVSCodeCustomizations(workDir)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+
+		uri := attachedContainerURI(info.Name, info.WorkingDir)
+		if codePrint {
+			fmt.Println(uri)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "Opening %s in %s\n", info.Name, codeEditor)
+		editor := exec.Command(editorPath, "--folder-uri", uri)
+		editor.Stdout = os.Stderr
+		editor.Stderr = os.Stderr
+		if err := editor.Run(); err != nil {
+			return fmt.Errorf("failed to launch %s: %w", codeEditor, err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(codeCmd)
+
+	codeCmd.Flags().StringVar(&codePath, "path", "", "Project path (default: pwd)")
+	codeCmd.Flags().StringVar(&codeWorktree, "worktree", "", "Worktree name (creates if needed)")
+	codeCmd.Flags().BoolVar(&codeNoWorktree, "no-worktree", false, "Skip worktree, use directory directly")
+	codeCmd.Flags().StringVar(&codeRuntime, "runtime", "", "Container runtime to use (docker/podman)")
+	codeCmd.Flags().StringVar(&codeEditor, "editor", "code", "Editor to open: code, code-insiders or cursor")
+	codeCmd.Flags().BoolVar(&codePrint, "print", false, "Print the folder URI instead of launching the editor")
+}
+
+// runDetached brings the container up with `packnplay run --detach --json`,
+// so it gets exactly the flags, config and lifecycle of a regular run
+var runDetached = func(runArgs []string) (*runner.DetachedContainer, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find packnplay executable: %w", err)
+	}
+	var stdout bytes.Buffer
+	run := exec.Command(self, runArgs...)
+	run.Stdin = os.Stdin
+	run.Stdout = &stdout
+	run.Stderr = os.Stderr
+	if err := run.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// run has already reported why
+			return nil, errdefs.Errorf(errdefs.CategoryForExitCode(exitErr.ExitCode()), "failed to bring up the container")
+		}
+		return nil, fmt.Errorf("failed to run packnplay: %w", err)
+	}
+
+	var info runner.DetachedContainer
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse container details: %w", err)
+	}
+	return &info, nil
+}
+
+// attachedContainerURI returns the Dev Containers folder URI for a running container
+func attachedContainerURI(containerName, folder string) string {
+	target, _ := json.Marshal(map[string]string{"containerName": "/" + containerName})
+	if folder == "" {
+		folder = "/"
+	}
+	return "vscode-remote://attached-container+" + hex.EncodeToString(target) + folder
+}
+
+// loadVSCodeCustomizations reads customizations.vscode, ignoring a missing or invalid devcontainer.json
+func loadVSCodeCustomizations(workDir string) *devcontainer.VSCodeCustomizations {
+	devConfig, err := devcontainer.LoadConfig(workDir)
+	if err != nil || devConfig == nil {
+		return &devcontainer.VSCodeCustomizations{}
+	}
+	custom, err := devConfig.VSCodeCustomizations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return &devcontainer.VSCodeCustomizations{}
+	}
+	return custom
+}
+
+// attachedContainerConfigDir is where the Dev Containers extension looks up
+// settings for containers attached to by name
+func attachedContainerConfigDir(appDir string) (string, error) {
+	var base string
+	switch runtime.GOOS {
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		base = filepath.Join(home, "Library", "Application Support")
+	default:
+		base = os.Getenv("XDG_CONFIG_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get home directory: %w", err)
+			}
+			base = filepath.Join(home, ".config")
+		}
+	}
+	return filepath.Join(base, appDir, "User", "globalStorage", "ms-vscode-remote.remote-containers", "nameConfigs"), nil
+}
+
+// writeAttachedContainerConfig records the workspace folder, remote user and
+// customizations.vscode for the container, keeping any other settings the
+// user added to the file
+func writeAttachedContainerConfig(appDir string, info *runner.DetachedContainer, custom *devcontainer.VSCodeCustomizations) error {
+	dir, err := attachedContainerConfigDir(appDir)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, strings.TrimPrefix(info.Name, "/")+".json")
+
+	settings := map[string]interface{}{}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	settings["workspaceFolder"] = info.WorkingDir
+	if info.RemoteUser != "" {
+		settings["remoteUser"] = info.RemoteUser
+	}
+	if len(custom.Extensions) > 0 {
+		settings["extensions"] = custom.Extensions
+	}
+	if len(custom.Settings) > 0 {
+		settings["settings"] = custom.Settings
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode editor settings: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create editor settings directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write editor settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/runner"
+)
+
+func TestAttachedContainerURI(t *testing.T) {
+	uri := attachedContainerURI("packnplay-app-main", "/src/app")
+	prefix := "vscode-remote://attached-container+"
+	if !strings.HasPrefix(uri, prefix) || !strings.HasSuffix(uri, "/src/app") {
+		t.Fatalf("attachedContainerURI() = %s", uri)
+	}
+	target, err := hex.DecodeString(strings.TrimSuffix(strings.TrimPrefix(uri, prefix), "/src/app"))
+	if err != nil || string(target) != `{"containerName":"/packnplay-app-main"}` {
+		t.Errorf("container target = %s, %v", target, err)
+	}
+}
+
+func TestWriteAttachedContainerConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	dir, err := attachedContainerConfigDir("Cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "packnplay-app-main.json")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"forwardPorts": [3000], "workspaceFolder": "/old"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info := &runner.DetachedContainer{Name: "packnplay-app-main", WorkingDir: "/src/app", RemoteUser: "vscode"}
+	custom := &devcontainer.VSCodeCustomizations{Extensions: []string{"golang.go"}, Settings: map[string]interface{}{"go.useLanguageServer": true}}
+	if err := writeAttachedContainerConfig("Cursor", info, custom); err != nil {
+		t.Fatalf("writeAttachedContainerConfig() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"forwardPorts":    []interface{}{float64(3000)},
+		"workspaceFolder": "/src/app",
+		"remoteUser":      "vscode",
+		"extensions":      []interface{}{"golang.go"},
+		"settings":        map[string]interface{}{"go.useLanguageServer": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("name config = %v, want %v", got, want)
+	}
+}
+
+func TestCodePrintsFolderURI(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	project := t.TempDir()
+
+	orig := runDetached
+	t.Cleanup(func() { runDetached = orig })
+	var gotArgs []string
+	runDetached = func(runArgs []string) (*runner.DetachedContainer, error) {
+		gotArgs = runArgs
+		return &runner.DetachedContainer{Name: "packnplay-app-feature", WorkingDir: "/work/feature"}, nil
+	}
+
+	codePath, codeWorktree, codeEditor, codePrint = project, "feature", "code", true
+	t.Cleanup(func() { codePath, codeWorktree, codeEditor, codePrint = "", "", "code", false })
+	if err := codeCmd.RunE(codeCmd, nil); err != nil {
+		t.Fatalf("code error = %v", err)
+	}
+
+	want := []string{"run", "--detach", "--json", "--reconnect", "--path", project, "--worktree", "feature"}
+	if !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("run args = %v, want %v", gotArgs, want)
+	}
+	dir, _ := attachedContainerConfigDir("Code")
+	if _, err := os.Stat(filepath.Join(dir, "packnplay-app-feature.json")); err != nil {
+		t.Errorf("name config should be written: %v", err)
+	}
+}
@@ -0,0 +1,444 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and manage packnplay configuration",
+}
+
+const configKeyHelp = `Keys are the dotted JSON names of settings in config.json, e.g.
+default_credentials.ssh, default_container.image, or
+env_configs.work.env_vars.API_URL.`
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a configuration setting",
+	Long: `Print a configuration setting. Text, numbers, and booleans are printed as
+is; lists and objects as JSON.
+
+` + configKeyHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		value, err := cfg.GetValue(args[0])
+		if err != nil {
+			return errdefs.New(errdefs.CategoryUsage, err)
+		}
+		return printConfigValue(os.Stdout, value)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a configuration setting",
+	Long: `Change a configuration setting without the interactive editor. The value
+is parsed for the setting's type: true/false for booleans, a whole number,
+a JSON array or comma-separated items for lists, and JSON for objects.
+Settings with a fixed set of values are checked.
+
+` + configKeyHelp + `
+
+Examples:
+  packnplay config set default_credentials.gh true
+  packnplay config set default_env_vars ANTHROPIC_API_KEY,GH_TOKEN
+  packnplay config set env_configs.work.env_vars.API_URL https://api.example.com`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editConfig(func(cfg *config.Config) error {
+			return cfg.SetValue(args[0], args[1])
+		})
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Reset a configuration setting to its default",
+	Long: `Reset a configuration setting to its default, or remove a map entry such as
+env_configs.work.
+
+` + configKeyHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return editConfig(func(cfg *config.Config) error {
+			return cfg.UnsetValue(args[0])
+		})
+	},
+}
+
+// editConfig applies edit to config.json, leaving the file alone if it fails
+func editConfig(edit func(*config.Config) error) error {
+	configPath := config.GetConfigPath()
+	cfg, err := config.LoadExistingOrEmpty(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := edit(cfg); err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+	if err := config.SaveConfig(cfg, configPath); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// printConfigValue prints a setting for `config get`
+func printConfigValue(w io.Writer, value interface{}) error {
+	switch v := value.(type) {
+	case string, bool, int, int64:
+		_, err := fmt.Fprintln(w, v)
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode setting: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+var (
+	configExportBundle      string
+	configExportDescription string
+	configImportOverwrite   bool
+	configImportKeep        bool
+	configImportDryRun      bool
+)
+
+var configExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export settings as a bundle to share with a team",
+	Long: `Write the settings that differ from the defaults as a bundle other machines
+can merge with 'packnplay config import', e.g. to give new teammates a
+baseline runtime, credentials, default image, and env configs.
+
+Secrets stay behind: literal values of env vars named like credentials
+(*_TOKEN, *_API_KEY, ...) are replaced with a ${VAR} reference, read from
+the importer's environment, and proxy URLs with a password are left out.
+Machine-specific settings (docker_config) and the active profile aren't
+exported. Review the bundle before sharing it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		bundle, err := cfg.ExportBundle(configExportDescription)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode bundle: %w", err)
+		}
+		data = append(data, '\n')
+
+		if configExportBundle == "" || configExportBundle == "-" {
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(configExportBundle, data, 0644); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", configExportBundle)
+		for _, key := range bundle.Placeholders {
+			fmt.Fprintf(os.Stderr, "  %s: secret replaced with a reference to the importer's environment\n", key)
+		}
+		for _, key := range bundle.Omitted {
+			fmt.Fprintf(os.Stderr, "  %s: left out (contains a password)\n", key)
+		}
+		return nil
+	},
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Merge a settings bundle into your config",
+	Long: `Merge a bundle written by 'packnplay config export' into config.json.
+Settings you haven't changed from the defaults are taken from the bundle.
+For each setting you've set to something else, you're asked which value to
+keep; without a terminal your value is kept. --overwrite takes the bundle's
+value and --keep your own without asking.
+
+Settings that share credentials, secrets or env vars with containers, or
+loosen their confinement, are always confirmed, even where you haven't set
+them: default_credentials, build_secrets, default_env_vars, env_configs,
+default_env_config, docker_socket, registry, host_bridge, security and
+github. Hooks in a bundle are ignored.
+
+Env vars in the bundle written as ${VAR} are read from your environment
+when containers start, so set them in your shell profile.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configImportOverwrite && configImportKeep {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--overwrite and --keep can't be used together")
+		}
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return errdefs.Errorf(errdefs.CategoryUsage, "failed to read bundle: %w", err)
+		}
+		var bundle config.Bundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return errdefs.Errorf(errdefs.CategoryConfig, "invalid bundle %s: %w", args[0], err)
+		}
+		if bundle.Description != "" {
+			fmt.Printf("Importing %s: %s\n", args[0], bundle.Description)
+		}
+
+		configPath := config.GetConfigPath()
+		cfg, err := config.LoadExistingOrEmpty(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		result, err := cfg.ImportBundle(&bundle, resolveBundleConflict)
+		if err != nil {
+			return errdefs.New(errdefs.CategoryConfig, err)
+		}
+		printBundleImport(result, configImportDryRun)
+		if configImportDryRun || len(result.Added)+len(result.Replaced) == 0 {
+			return nil
+		}
+		if err := config.SaveConfig(cfg, configPath); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		return nil
+	},
+}
+
+// resolveBundleConflict decides whether a bundle's value replaces one already
+// set, or sets a sensitive one, asking on the terminal unless --overwrite or
+// --keep was given
+func resolveBundleConflict(conflict config.BundleConflict) bool {
+	switch {
+	case configImportOverwrite:
+		return true
+	case configImportKeep, !isatty.IsTerminal(os.Stdin.Fd()):
+		if conflict.Sensitive && !configImportKeep {
+			fmt.Fprintf(os.Stderr, "Skipping %s: sensitive settings are only imported with --overwrite or when confirmed\n", conflict.Key)
+		}
+		return false
+	}
+	if conflict.Sensitive {
+		fmt.Fprintf(os.Stderr, "%s shares host credentials, secrets or env vars, or changes how containers are confined\n", conflict.Key)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n  yours:  %s\n  bundle: %s\nUse the bundle's value? [y/N] ", conflict.Key, formatBundleValue(conflict.Current), formatBundleValue(conflict.Incoming))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// formatBundleValue renders a setting for a conflict prompt
+func formatBundleValue(value interface{}) string {
+	if value == nil {
+		return "(unset)"
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// printBundleImport describes what `config import` changed
+func printBundleImport(result *config.BundleImport, dryRun bool) {
+	if len(result.Added)+len(result.Replaced)+len(result.Kept) == 0 {
+		fmt.Println("Your config already matches the bundle")
+		return
+	}
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d setting(s)\n", verb, len(result.Added)+len(result.Replaced))
+	for _, key := range result.Added {
+		fmt.Printf("  + %s\n", key)
+	}
+	for _, key := range result.Replaced {
+		fmt.Printf("  ~ %s (replaced your value)\n", key)
+	}
+	for _, key := range result.Kept {
+		fmt.Printf("  = %s (kept your value)\n", key)
+	}
+}
+
+var configProfileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage configuration profiles",
+	Long: `Profiles override the container runtime, credentials, default image, env
+configs, and registry logins (docker_config) for a context such as work,
+personal, or a client. Define them under "profiles" in config.json or as
+~/.config/packnplay/profiles/<name>.json.
+
+The profile in effect is chosen by --profile, then $PACKNPLAY_PROFILE,
+then the active profile set with 'packnplay config profile use'.`,
+}
+
+var configProfileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List available profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		profiles := cfg.ListProfiles()
+		if len(profiles) == 0 {
+			fmt.Println("No profiles configured")
+			return nil
+		}
+
+		selected := cfg.SelectedProfile("")
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  NAME\tDESCRIPTION\tSOURCE")
+		for _, p := range profiles {
+			marker := " "
+			if p.Name == selected {
+				marker = "*"
+			}
+			_, _ = fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, p.Name, p.Description, p.Source)
+		}
+		return w.Flush()
+	},
+}
+
+var configProfileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Set the active profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath := config.GetConfigPath()
+		cfg, err := config.LoadExistingOrEmpty(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		name := args[0]
+		if _, ok := cfg.Profile(name); !ok {
+			return cfg.ApplyProfile(name) // reports the available profiles
+		}
+
+		if err := config.UpdateConfigSafely(configPath, config.ConfigUpdates{ActiveProfile: &name}); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Printf("Active profile: %s\n", name)
+		if env := os.Getenv(config.ProfileEnvVar); env != "" && env != name {
+			fmt.Fprintf(os.Stderr, "Note: $%s=%s overrides the active profile in this shell\n", config.ProfileEnvVar, env)
+		}
+		return nil
+	},
+}
+
+var configProfileClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Stop using an active profile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		none := ""
+		if err := config.UpdateConfigSafely(config.GetConfigPath(), config.ConfigUpdates{ActiveProfile: &none}); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Println("No active profile")
+		return nil
+	},
+}
+
+var configMigrateDryRun bool
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade config.json to the current schema",
+	Long: `Upgrade config.json to the current schema version, moving deprecated
+fields to their replacements. The original file is kept as
+config.json.v<version>.bak.
+
+packnplay does this automatically whenever it loads an older config; use
+--dry-run to see what would change first.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		configPath := config.GetConfigPath()
+		result, err := config.MigrateFile(configPath, configMigrateDryRun)
+		if err != nil {
+			return errdefs.New(errdefs.CategoryConfig, err)
+		}
+		printMigrationResult(configPath, result, configMigrateDryRun)
+		return nil
+	},
+}
+
+// printMigrationResult describes a config migration for `config migrate`
+func printMigrationResult(configPath string, result *config.MigrationResult, dryRun bool) {
+	if !result.NeedsMigration() {
+		fmt.Printf("%s is already at schema version %d\n", configPath, result.ToVersion)
+		return
+	}
+
+	verb := "Upgraded"
+	if dryRun {
+		verb = "Would upgrade"
+	}
+	fmt.Printf("%s %s from schema version %d to %d\n", verb, configPath, result.FromVersion, result.ToVersion)
+	for _, change := range result.Changes {
+		fmt.Printf("  - %s\n", change)
+	}
+	if len(result.Changes) == 0 {
+		fmt.Println("  - set schema_version (no other changes)")
+	}
+	if result.BackupPath != "" {
+		fmt.Printf("Backup: %s\n", result.BackupPath)
+	}
+}
+
+// applyConfigProfile applies the selected profile and exports its registry logins to the docker CLI
+func applyConfigProfile(cfg *config.Config, flag string) error {
+	if err := cfg.ApplyProfile(cfg.SelectedProfile(flag)); err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+	if dockerConfig := cfg.ResolvedDockerConfig(); dockerConfig != "" {
+		if err := os.Setenv("DOCKER_CONFIG", dockerConfig); err != nil {
+			return fmt.Errorf("failed to set DOCKER_CONFIG: %w", err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configProfileCmd)
+	configProfileCmd.AddCommand(configProfileListCmd)
+	configProfileCmd.AddCommand(configProfileUseCmd)
+	configProfileCmd.AddCommand(configProfileClearCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
+
+	configMigrateCmd.Flags().BoolVar(&configMigrateDryRun, "dry-run", false, "Show what would change without writing anything")
+
+	configExportCmd.Flags().StringVar(&configExportBundle, "bundle", "", "File to write the bundle to (default: stdout)")
+	configExportCmd.Flags().StringVar(&configExportDescription, "description", "", "Description shown when the bundle is imported")
+	configImportCmd.Flags().BoolVar(&configImportOverwrite, "overwrite", false, "Take the bundle's value for every conflicting setting")
+	configImportCmd.Flags().BoolVar(&configImportKeep, "keep", false, "Keep your value for every conflicting setting")
+	configImportCmd.Flags().BoolVar(&configImportDryRun, "dry-run", false, "Show what would change without writing anything")
+}
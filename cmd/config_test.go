@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+)
+
+func TestConfigSetGetUnset(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	for _, args := range [][]string{
+		{"container_runtime", "podman"},
+		{"default_credentials.gh", "true"},
+		{"env_configs.work.env_vars.API_URL", "https://api.example.com"},
+	} {
+		if err := configSetCmd.RunE(configSetCmd, args); err != nil {
+			t.Fatalf("config set %v error = %v", args, err)
+		}
+	}
+	if err := configSetCmd.RunE(configSetCmd, []string{"container_runtime", "lxc"}); err == nil {
+		t.Error("config set should reject an unknown runtime")
+	}
+	if err := configUnsetCmd.RunE(configUnsetCmd, []string{"default_credentials.gh"}); err != nil {
+		t.Fatalf("config unset error = %v", err)
+	}
+
+	cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ContainerRuntime != "podman" || cfg.DefaultCredentials.GH || cfg.EnvConfigs["work"].EnvVars["API_URL"] != "https://api.example.com" {
+		t.Errorf("saved config = %+v", cfg)
+	}
+
+	var out bytes.Buffer
+	value, _ := cfg.GetValue("container_runtime")
+	if err := printConfigValue(&out, value); err != nil || out.String() != "podman\n" {
+		t.Errorf("printed %q, %v; want the plain value", out.String(), err)
+	}
+	out.Reset()
+	value, _ = cfg.GetValue("env_configs.work.env_vars")
+	if err := printConfigValue(&out, value); err != nil || !strings.Contains(out.String(), `"API_URL": "https://api.example.com"`) {
+		t.Errorf("printed %q, %v; want objects as JSON", out.String(), err)
+	}
+}
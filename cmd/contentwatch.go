@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/obra/packnplay/pkg/contentwatch"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	contentWatchContainer string
+	contentWatchPath      string
+	contentWatchFiles     []string
+)
+
+var contentWatchCmd = &cobra.Command{
+	Use:    "content-watch",
+	Short:  "Record dependency manifest changes in a container's workspace",
+	Long:   `Background daemon that watches a workspace for changes to lockfiles and package manifests and records them, so the next attach reruns or suggests updateContentCommand.`,
+	Hidden: true, // Started by packnplay run for customizations.packnplay.watchContent
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if contentWatchContainer == "" || contentWatchPath == "" {
+			return fmt.Errorf("--container and --path are required")
+		}
+
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+
+		removePID, err := contentwatch.WritePID(contentWatchContainer)
+		if err != nil {
+			return err
+		}
+		defer removePID()
+
+		watcher, err := contentwatch.NewWatcher(contentWatchPath, contentWatchFiles)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = watcher.Close() }()
+
+		log.Printf("Watching %s for dependency changes in %s", contentWatchPath, contentWatchContainer)
+		record := func(path string) {
+			log.Printf("%s changed", path)
+			if err := contentwatch.Record(contentWatchContainer, path); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		return watcher.Run(record, containerAliveCheck(dockerClient, contentWatchContainer, 2*time.Minute), 30*time.Second)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(contentWatchCmd)
+
+	contentWatchCmd.Flags().StringVar(&contentWatchContainer, "container", "", "Container whose workspace is watched")
+	contentWatchCmd.Flags().StringVar(&contentWatchPath, "path", "", "Host path of the workspace")
+	contentWatchCmd.Flags().StringArrayVar(&contentWatchFiles, "file", nil, "Extra file name pattern that counts as a dependency change (repeatable)")
+}
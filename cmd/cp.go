@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/git"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpPath     string
+	cpWorktree string
+	cpName     string
+	cpLatest   bool
+	cpUser     string
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [flags] SRC DEST",
+	Short: "Copy files between the host and a container",
+	Long: `Copy a file or directory between the host and the project's container.
+Prefix the container side with container:, e.g.
+
+  packnplay cp ./fixtures container:/tmp/fixtures
+  packnplay cp container:coverage.html .
+
+Relative container paths are relative to the workspace folder. The container
+is the current worktree's, or the project's only running container; pick
+another with --worktree or --name. Files copied into the container belong to
+its remote user (--user to choose another). With Apple Container, which has no
+cp command, files are streamed through tar in the container.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		src, dst := runner.ParseCopyPath(args[0]), runner.ParseCopyPath(args[1])
+		if src.Container == dst.Container {
+			return errdefs.Errorf(errdefs.CategoryUsage, "exactly one of SRC and DEST must be a container: path")
+		}
+
+		workDir := cpPath
+		if workDir == "" {
+			var err error
+			workDir, err = os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+		}
+		workDir, err := filepath.Abs(workDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to initialize docker: %w", err)
+		}
+		containerName, err := resolveCpContainer(dockerClient, workDir)
+		if err != nil {
+			return err
+		}
+
+		if dst.Container {
+			user := cpUser
+			if user == "" {
+				user = runner.ContainerUser(dockerClient, containerName)
+			}
+			if user == "" {
+				if devConfig, err := devcontainer.LoadConfig(workDir); err == nil && devConfig != nil {
+					user = devConfig.RemoteUser
+				}
+			}
+			if err := runner.CopyToContainer(dockerClient, containerName, src.Path, dst.Path, user); err != nil {
+				return errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+			}
+			return nil
+		}
+		if err := runner.CopyFromContainer(dockerClient, containerName, src.Path, dst.Path); err != nil {
+			return errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+		}
+		return nil
+	},
+}
+
+// resolveCpContainer picks the running container to copy to or from: the one
+// named by --name or --worktree, else the current worktree's, else the
+// project's only running container
+func resolveCpContainer(dockerClient *docker.Client, workDir string) (string, error) {
+	if cpName != "" {
+		return cpName, nil
+	}
+	worktree := cpWorktree
+	if worktree == "" {
+		worktree = "no-worktree"
+		if git.IsGitRepo(workDir) {
+			if branch, err := git.GetCurrentBranch(workDir); err == nil {
+				worktree = branch
+			}
+		}
+	}
+	containerName := container.GenerateContainerName(workDir, worktree)
+	output, err := dockerClient.Run("ps", "--filter", fmt.Sprintf("name=%s", containerName), "--format", "{{.Names}}")
+	if err != nil {
+		return "", errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to check container status: %w", err)
+	}
+	if containsLine(output, containerName) {
+		return containerName, nil
+	}
+	if cpWorktree != "" {
+		return "", errdefs.Errorf(errdefs.CategoryContainer, "no running container found for worktree '%s'", cpWorktree)
+	}
+
+	candidates, err := findAttachCandidates(dockerClient, workDir)
+	if err != nil {
+		return "", err
+	}
+	chosen, err := chooseAttachCandidate(candidates, cpLatest)
+	if err != nil {
+		return "", errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+	}
+	if chosen == nil {
+		return "", errdefs.Errorf(errdefs.CategoryUsage, "%w", ambiguousAttachError(candidates))
+	}
+	return chosen.Name, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	cpCmd.Flags().StringVar(&cpPath, "path", "", "Project path (default: pwd)")
+	cpCmd.Flags().StringVar(&cpWorktree, "worktree", "", "Worktree whose container to use")
+	cpCmd.Flags().StringVar(&cpName, "name", "", "Container name to copy to or from")
+	cpCmd.Flags().BoolVar(&cpLatest, "latest", false, "If several containers match the project, use the most recently used one")
+	cpCmd.Flags().StringVar(&cpUser, "user", "", "User to own files copied into the container (default: the container's remote user)")
+}
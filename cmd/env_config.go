@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envConfigDisplayName string
+	envConfigDescription string
+	envConfigUnset       []string
+)
+
+var envConfigCmd = &cobra.Command{
+	Use:   "env-config",
+	Short: "Manage named environment configs",
+	Long: `Environment configs are named sets of env vars, such as API endpoints and
+keys for different providers, selected with 'packnplay run --env-config <name>'.
+
+Values may reference host variables as ${VAR} or ${localEnv:VAR:default};
+they are resolved each time the config is used, so secrets can stay in the
+host environment instead of config.json. Quote values containing $ in your
+shell.`,
+}
+
+var envConfigListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List environment configs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		names := cfg.EnvConfigNames()
+		if len(names) == 0 {
+			fmt.Println("No env configs configured (add one with: packnplay env-config add <name> KEY=VALUE...)")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  NAME\tDESCRIPTION\tVARIABLES")
+		for _, name := range names {
+			envConfig := cfg.EnvConfigs[name]
+			marker := " "
+			if name == cfg.DefaultEnvConfig {
+				marker = "*"
+			}
+			description := envConfig.Description
+			if description == "" {
+				description = envConfig.Name
+			}
+			// Values may hold secrets; only show which variables are set
+			_, _ = fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, name, description, strings.Join(envVarKeys(envConfig.EnvVars), ", "))
+		}
+		return w.Flush()
+	},
+}
+
+var envConfigAddCmd = &cobra.Command{
+	Use:   "add <name> KEY=VALUE...",
+	Short: "Add an environment config",
+	Example: `  packnplay env-config add z.ai --description "Z.AI endpoints" \
+    'ANTHROPIC_AUTH_TOKEN=${localEnv:Z_AI_API_KEY}' \
+    ANTHROPIC_BASE_URL=https://api.z.ai/api/anthropic`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		envVars, err := parseEnvAssignments(args[1:])
+		if err != nil {
+			return err
+		}
+
+		return updateEnvConfigs(func(envConfigs map[string]config.EnvConfig) error {
+			if _, exists := envConfigs[name]; exists {
+				return errdefs.Errorf(errdefs.CategoryUsage, "env config '%s' already exists; change it with: packnplay env-config edit %s", name, name)
+			}
+			envConfigs[name] = config.EnvConfig{
+				Name:        envConfigDisplayName,
+				Description: envConfigDescription,
+				EnvVars:     envVars,
+			}
+			fmt.Printf("Added env config %s\n", name)
+			return nil
+		})
+	},
+}
+
+var envConfigEditCmd = &cobra.Command{
+	Use:   "edit <name> [KEY=VALUE...]",
+	Short: "Change an environment config",
+	Long: `Set or replace variables in an existing env config, remove variables with
+--unset, or change its name and description.`,
+	Example: `  packnplay env-config edit z.ai API_TIMEOUT_MS=3000000 --unset ANTHROPIC_MODEL`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		envVars, err := parseEnvAssignments(args[1:])
+		if err != nil {
+			return err
+		}
+		if len(envVars) == 0 && len(envConfigUnset) == 0 &&
+			!cmd.Flags().Changed("name") && !cmd.Flags().Changed("description") {
+			return errdefs.Errorf(errdefs.CategoryUsage, "nothing to change: pass KEY=VALUE, --unset, --name, or --description")
+		}
+
+		return updateEnvConfigs(func(envConfigs map[string]config.EnvConfig) error {
+			envConfig, exists := envConfigs[name]
+			if !exists {
+				return errdefs.Errorf(errdefs.CategoryUsage, "env config '%s' not found; add it with: packnplay env-config add %s KEY=VALUE...", name, name)
+			}
+			if envConfig.EnvVars == nil {
+				envConfig.EnvVars = make(map[string]string)
+			}
+			for key, value := range envVars {
+				envConfig.EnvVars[key] = value
+			}
+			for _, key := range envConfigUnset {
+				delete(envConfig.EnvVars, key)
+			}
+			if cmd.Flags().Changed("name") {
+				envConfig.Name = envConfigDisplayName
+			}
+			if cmd.Flags().Changed("description") {
+				envConfig.Description = envConfigDescription
+			}
+			envConfigs[name] = envConfig
+			fmt.Printf("Updated env config %s\n", name)
+			return nil
+		})
+	},
+}
+
+var envConfigRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove an environment config",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		configPath := config.GetConfigPath()
+		cfg, err := config.LoadExistingOrEmpty(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if _, err := cfg.LookupEnvConfig(name); err != nil {
+			return errdefs.New(errdefs.CategoryUsage, err)
+		}
+
+		delete(cfg.EnvConfigs, name)
+		updates := config.ConfigUpdates{EnvConfigs: &cfg.EnvConfigs}
+		if cfg.DefaultEnvConfig == name {
+			none := ""
+			updates.DefaultEnvConfig = &none
+		}
+		if err := config.UpdateConfigSafely(configPath, updates); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Printf("Removed env config %s\n", name)
+		return nil
+	},
+}
+
+// updateEnvConfigs applies change to the env configs in config.json and saves them
+func updateEnvConfigs(change func(map[string]config.EnvConfig) error) error {
+	configPath := config.GetConfigPath()
+	cfg, err := config.LoadExistingOrEmpty(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.EnvConfigs == nil {
+		cfg.EnvConfigs = make(map[string]config.EnvConfig)
+	}
+	if err := change(cfg.EnvConfigs); err != nil {
+		return err
+	}
+	if err := config.UpdateConfigSafely(configPath, config.ConfigUpdates{EnvConfigs: &cfg.EnvConfigs}); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// parseEnvAssignments parses KEY=VALUE arguments
+func parseEnvAssignments(args []string) (map[string]string, error) {
+	envVars := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, err := config.ParseEnvAssignment(arg)
+		if err != nil {
+			return nil, errdefs.New(errdefs.CategoryUsage, err)
+		}
+		envVars[key] = value
+	}
+	return envVars, nil
+}
+
+// envVarKeys returns the sorted variable names of an env config
+func envVarKeys(envVars map[string]string) []string {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolveEnvConfig returns the KEY=VALUE env of the named env config, or of the
+// default env config when name is empty
+func resolveEnvConfig(cfg *config.Config, name string) ([]string, error) {
+	if name == "" {
+		name = cfg.DefaultEnvConfig
+		if name == "" {
+			return nil, nil
+		}
+	}
+	envConfig, err := cfg.LookupEnvConfig(name)
+	if err != nil {
+		return nil, errdefs.New(errdefs.CategoryConfig, err)
+	}
+	return applyEnvConfig(envConfig), nil
+}
+
+func init() {
+	rootCmd.AddCommand(envConfigCmd)
+	envConfigCmd.AddCommand(envConfigListCmd)
+	envConfigCmd.AddCommand(envConfigAddCmd)
+	envConfigCmd.AddCommand(envConfigEditCmd)
+	envConfigCmd.AddCommand(envConfigRemoveCmd)
+
+	for _, c := range []*cobra.Command{envConfigAddCmd, envConfigEditCmd} {
+		c.Flags().StringVar(&envConfigDisplayName, "name", "", "Display name")
+		c.Flags().StringVar(&envConfigDescription, "description", "", "Description shown by env-config list")
+	}
+	envConfigEditCmd.Flags().StringArrayVar(&envConfigUnset, "unset", nil, "Remove a variable (repeatable)")
+}
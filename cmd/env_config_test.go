@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+)
+
+func TestEnvConfigAddEditRemove(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("Z_AI_API_KEY", "zai-123")
+
+	envConfigDescription = "Z.AI endpoints"
+	defer func() { envConfigDescription = "" }()
+	if err := envConfigAddCmd.RunE(envConfigAddCmd, []string{"z.ai", "ANTHROPIC_AUTH_TOKEN=${localEnv:Z_AI_API_KEY}", "API_TIMEOUT_MS=3000"}); err != nil {
+		t.Fatalf("add error = %v", err)
+	}
+	if err := envConfigAddCmd.RunE(envConfigAddCmd, []string{"z.ai", "A=b"}); err == nil {
+		t.Error("add should refuse to overwrite an existing env config")
+	}
+
+	envConfigUnset = []string{"API_TIMEOUT_MS"}
+	defer func() { envConfigUnset = nil }()
+	if err := envConfigEditCmd.RunE(envConfigEditCmd, []string{"z.ai", "ANTHROPIC_BASE_URL=https://api.z.ai/api/anthropic"}); err != nil {
+		t.Fatalf("edit error = %v", err)
+	}
+	if err := envConfigEditCmd.RunE(envConfigEditCmd, []string{"missing", "A=b"}); err == nil {
+		t.Error("edit should fail for an unknown env config")
+	}
+
+	cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := cfg.EnvConfigs["z.ai"]
+	if got.Description != "Z.AI endpoints" {
+		t.Errorf("Description = %q", got.Description)
+	}
+	if _, ok := got.EnvVars["API_TIMEOUT_MS"]; ok {
+		t.Error("--unset should remove API_TIMEOUT_MS")
+	}
+
+	env, err := resolveEnvConfig(cfg, "z.ai")
+	if err != nil {
+		t.Fatalf("resolveEnvConfig() error = %v", err)
+	}
+	joined := strings.Join(env, " ")
+	if !strings.Contains(joined, "ANTHROPIC_AUTH_TOKEN=zai-123") || !strings.Contains(joined, "ANTHROPIC_BASE_URL=https://api.z.ai/api/anthropic") {
+		t.Errorf("resolveEnvConfig() = %v", env)
+	}
+
+	if err := envConfigRemoveCmd.RunE(envConfigRemoveCmd, []string{"z.ai"}); err != nil {
+		t.Fatalf("remove error = %v", err)
+	}
+	cfg, err = config.LoadExistingOrEmpty(config.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.EnvConfigs) != 0 {
+		t.Errorf("EnvConfigs = %v, want none", cfg.EnvConfigs)
+	}
+}
+
+func TestResolveEnvConfig(t *testing.T) {
+	cfg := &config.Config{EnvConfigs: map[string]config.EnvConfig{
+		"work": {EnvVars: map[string]string{"API_URL": "https://work.example.com"}},
+	}}
+
+	env, err := resolveEnvConfig(cfg, "")
+	if err != nil || env != nil {
+		t.Errorf("resolveEnvConfig() without name or default = %v, %v", env, err)
+	}
+
+	cfg.DefaultEnvConfig = "work"
+	env, err = resolveEnvConfig(cfg, "")
+	if err != nil || len(env) != 1 || env[0] != "API_URL=https://work.example.com" {
+		t.Errorf("resolveEnvConfig() with default = %v, %v", env, err)
+	}
+
+	_, err = resolveEnvConfig(cfg, "personal")
+	if err == nil || !strings.Contains(err.Error(), "available: work") {
+		t.Errorf("resolveEnvConfig() unknown name error = %v", err)
+	}
+}
+
+func TestRunEnvConfigFlags(t *testing.T) {
+	if runCmd.Flags().Lookup("env-config") == nil {
+		t.Fatal("run should have --env-config")
+	}
+	legacy := runCmd.Flags().Lookup("config")
+	if legacy == nil || !legacy.Hidden {
+		t.Error("--config should remain as a hidden alias")
+	}
+	if attachCmd.Flags().Lookup("env-config") == nil {
+		t.Error("attach should have --env-config")
+	}
+}
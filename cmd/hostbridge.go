@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/hostbridge"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hostBridgeContainer string
+	hostBridgeActions   string
+	hostBridgeWorkspace string
+)
+
+var hostBridgeCmd = &cobra.Command{
+	Use:    "host-bridge",
+	Short:  "Serve open/editor requests from a container",
+	Long:   `Background daemon that executes allowlisted host actions (open URL, launch editor, copy to clipboard) requested from inside a container.`,
+	Hidden: true, // Started by packnplay run --host-bridge
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if hostBridgeContainer == "" {
+			return fmt.Errorf("--container is required")
+		}
+
+		dir, err := hostbridge.SocketDir(hostBridgeContainer)
+		if err != nil {
+			return err
+		}
+		socketPath := filepath.Join(dir, hostbridge.SocketName)
+
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+
+		log.Printf("Host bridge for %s listening on %s", hostBridgeContainer, socketPath)
+		server := hostbridge.NewServer(strings.Split(hostBridgeActions, ","))
+		server.SetWorkspace(hostBridgeWorkspace)
+		if cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath()); err == nil {
+			server.SetClipboardLimit(cfg.HostBridge.ClipboardMaxBytes)
+		}
+		return hostbridge.Serve(socketPath, server, containerAliveCheck(dockerClient, hostBridgeContainer, 2*time.Minute), 30*time.Second)
+	},
+}
+
+// containerAliveCheck reports whether the container is running, allowing a
+// grace period for containers that are still being created
+func containerAliveCheck(dockerClient *docker.Client, name string, grace time.Duration) func() bool {
+	deadline := time.Now().Add(grace)
+	seen := false
+	return func() bool {
+		output, err := dockerClient.Run("inspect", "--format", "{{.State.Running}}", name)
+		if err == nil && strings.TrimSpace(output) == "true" {
+			seen = true
+			return true
+		}
+		return !seen && time.Now().Before(deadline)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(hostBridgeCmd)
+
+	hostBridgeCmd.Flags().StringVar(&hostBridgeContainer, "container", "", "Container the bridge serves")
+	hostBridgeCmd.Flags().StringVar(&hostBridgeActions, "actions", hostbridge.ActionOpen, "Comma-separated allowed actions (open, code, clipboard)")
+	hostBridgeCmd.Flags().StringVar(&hostBridgeWorkspace, "workspace", "", "Host path of the container's workspace, where code may open paths")
+}
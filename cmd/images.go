@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	imagesPruneOlderThan string
+	imagesPruneMaxSizeMB int
+	imagesPruneDryRun    bool
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List images built for projects",
+	Long: `List the images packnplay built for projects, from a Dockerfile or with
+features, with their size and when a run last used them. Rebuilding a project
+keeps the previous image, tagged with its config hash, until it is pruned.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+		images, err := runner.ListProjectImages(dockerClient)
+		if err != nil {
+			return err
+		}
+		return printProjectImages(os.Stdout, images, time.Now())
+	},
+}
+
+var imagesPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove project images no container uses",
+	Long: `Remove project images unused for longer than images.prune_after_days (30 by
+default), then the least recently used of the rest until they fit in
+images.max_total_mb. Images a container uses, running or stopped, are kept.
+'packnplay prune' applies the same policy.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		policy := runner.NewImagePrunePolicy(cfg.Images)
+		if imagesPruneOlderThan != "" {
+			if policy.MaxAge, err = parseDayDuration("older-than", imagesPruneOlderThan); err != nil {
+				return err
+			}
+		}
+		if cmd.Flags().Changed("max-size-mb") {
+			policy.MaxTotalSize = int64(imagesPruneMaxSizeMB) << 20
+		}
+
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+		pruned, err := runner.PruneProjectImages(dockerClient, policy, imagesPruneDryRun)
+		printPrunedImages(os.Stdout, pruned, imagesPruneDryRun)
+		if err != nil {
+			return err
+		}
+		if len(pruned) == 0 {
+			fmt.Println("Nothing to prune")
+		}
+		return nil
+	},
+}
+
+// printProjectImages writes project images as a table
+func printProjectImages(w io.Writer, images []runner.ProjectImage, now time.Time) error {
+	if len(images) == 0 {
+		_, err := fmt.Fprintln(w, "No project images")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "IMAGE\tPROJECT\tSIZE\tCREATED\tLAST USED\tIN USE")
+	var total int64
+	for _, img := range images {
+		inUse := "no"
+		if img.InUse {
+			inUse = "yes"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", strings.Join(img.Tags, ", "), img.Project, formatImageSize(img.Size), formatLastUsed(img.Created, now), formatLastUsed(img.LastUsed, now), inUse)
+		total += img.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%d images, %s\n", len(images), formatImageSize(total))
+	return err
+}
+
+// printPrunedImages reports the images prune removed, or would remove
+func printPrunedImages(w io.Writer, pruned []runner.ProjectImage, dryRun bool) {
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	var total int64
+	for _, img := range pruned {
+		_, _ = fmt.Fprintf(w, "%s image %s (%s)\n", verb, strings.Join(img.Tags, ", "), formatImageSize(img.Size))
+		total += img.Size
+	}
+	if len(pruned) > 1 {
+		_, _ = fmt.Fprintf(w, "%s %d images, %s\n", verb, len(pruned), formatImageSize(total))
+	}
+}
+
+// formatImageSize renders a size in bytes as docker does, in decimal units
+func formatImageSize(size int64) string {
+	switch {
+	case size >= 1e9:
+		return fmt.Sprintf("%.2fGB", float64(size)/1e9)
+	case size >= 1e6:
+		return fmt.Sprintf("%.0fMB", float64(size)/1e6)
+	case size >= 1e3:
+		return fmt.Sprintf("%.0fkB", float64(size)/1e3)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(imagesCmd)
+	imagesCmd.AddCommand(imagesPruneCmd)
+	imagesPruneCmd.Flags().StringVar(&imagesPruneOlderThan, "older-than", "", "Remove images unused for longer than this, e.g. 14d or 72h (default: images.prune_after_days)")
+	imagesPruneCmd.Flags().IntVar(&imagesPruneMaxSizeMB, "max-size-mb", 0, "Then remove the least recently used images until the rest fit in this many MB (default: images.max_total_mb)")
+	imagesPruneCmd.Flags().BoolVar(&imagesPruneDryRun, "dry-run", false, "Show the images that would be removed without removing them")
+}
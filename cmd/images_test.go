@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/runner"
+)
+
+func TestPrintProjectImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printProjectImages(&buf, nil, time.Now()); err != nil || !strings.Contains(buf.String(), "No project images") {
+		t.Errorf("printProjectImages(nil) = %q, %v", buf.String(), err)
+	}
+
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	images := []runner.ProjectImage{
+		{Tags: []string{"packnplay-app-devcontainer:latest", "packnplay-app-devcontainer:0123456789ab"}, Project: "app", Size: 1_250_000_000, Created: now.Add(-72 * time.Hour), LastUsed: now.Add(-2 * time.Hour), InUse: true},
+		{Tags: []string{"packnplay-old-devcontainer:latest"}, Project: "old", Size: 340_000_000, Created: now.Add(-40 * 24 * time.Hour)},
+	}
+	buf.Reset()
+	if err := printProjectImages(&buf, images, now); err != nil {
+		t.Fatalf("printProjectImages() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"packnplay-app-devcontainer:latest, packnplay-app-devcontainer:0123456789ab", "1.25GB", "2h ago", "340MB", "never", "2 images, 1.59GB"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printProjectImages() missing %q:\n%s", want, out)
+		}
+	}
+}
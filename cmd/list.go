@@ -3,20 +3,28 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/obra/packnplay/pkg/container"
 	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
-var listVerbose bool
+var (
+	listVerbose   bool
+	listSSHConfig bool
+	listStats     bool
+)
 
 type ContainerInfo struct {
 	Names  string `json:"Names"`
 	Status string `json:"Status"`
 	Labels string `json:"Labels"`
+	Ports  string `json:"Ports"`
 }
 
 var listCmd = &cobra.Command{
@@ -47,6 +55,23 @@ var listCmd = &cobra.Command{
 
 		// Docker outputs one JSON object per line
 		lines := splitLines(output)
+		inspected := inspectListedLabels(dockerClient, output)
+
+		if listSSHConfig {
+			return printSSHConfigs(os.Stdout, lines, inspected)
+		}
+
+		var usage map[string]docker.ContainerStats
+		if listStats {
+			usage = listedStats(dockerClient, lines)
+		}
+
+		services := make(map[string][]runner.Sidecar)
+		if sidecars, err := runner.ListSidecars(dockerClient, ""); err == nil {
+			for _, sidecar := range sidecars {
+				services[sidecar.Owner] = append(services[sidecar.Owner], sidecar)
+			}
+		}
 
 		if listVerbose {
 			// Verbose mode: use block format for better readability
@@ -61,12 +86,12 @@ var listCmd = &cobra.Command{
 					continue
 				}
 
-				// Parse labels with launch info support
-				labels := container.ParseLabels(info.Labels)
-				project := container.GetProjectFromLabels(labels)
-				worktree := container.GetWorktreeFromLabels(labels)
-				hostPath := container.GetHostPathFromLabels(labels)
-				launchCommand := container.GetLaunchCommandFromLabels(labels)
+				// Read metadata, including launch info
+				metadata := container.ReadMetadata(listedLabels(inspected, info))
+				project := metadata.Project
+				worktree := metadata.Worktree
+				hostPath := metadata.HostPath
+				launchCommand := metadata.LaunchCommand
 
 				// Handle backward compatibility
 				if hostPath == "" {
@@ -86,12 +111,22 @@ var listCmd = &cobra.Command{
 				if launchCommand != "" {
 					fmt.Printf("  Commandline: %s\n", launchCommand)
 				}
+				if user, host, port, ok := listedSSH(listedLabels(inspected, info), info.Ports); ok {
+					fmt.Printf("  SSH: ssh -p %s %s@%s\n", port, user, host)
+				}
+				for _, sidecar := range services[info.Names] {
+					fmt.Printf("  Service %s: %s (%s)\n", sidecar.Service, sidecar.Image, sidecar.Status)
+				}
+				if s, ok := usage[info.Names]; ok {
+					fmt.Printf("  CPU: %s\n", s.CPUPerc)
+					fmt.Printf("  Memory: %s\n", s.MemUsage)
+					fmt.Printf("  Block I/O: %s\n", s.BlockIO)
+				}
 			}
 		} else {
-			// Normal mode: use tabular format
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-			_, _ = fmt.Fprintln(w, "CONTAINER\tSTATUS\tPROJECT\tWORKTREE\tHOST PATH")
-
+			// Normal mode: use tabular format, with SSH and SERVICES columns when any container has them
+			var rows [][]string
+			hasSSH, hasServices := false, false
 			for _, line := range lines {
 				if line == "" {
 					continue
@@ -103,24 +138,48 @@ var listCmd = &cobra.Command{
 					continue
 				}
 
-				// Parse labels with launch info support
-				labels := container.ParseLabels(info.Labels)
-				project := container.GetProjectFromLabels(labels)
-				worktree := container.GetWorktreeFromLabels(labels)
-				hostPath := container.GetHostPathFromLabels(labels)
+				labels := listedLabels(inspected, info)
+				metadata := container.ReadMetadata(labels)
+				hostPath := metadata.HostPath
 
 				// Handle backward compatibility
 				if hostPath == "" {
 					hostPath = "N/A"
 				}
 
-				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-					info.Names,
-					info.Status,
-					project,
-					worktree,
-					hostPath,
-				)
+				ssh := "-"
+				if _, host, port, ok := listedSSH(labels, info.Ports); ok {
+					ssh = host + ":" + port
+					hasSSH = true
+				}
+				serviceList := listedServices(services[info.Names])
+				if serviceList != "-" {
+					hasServices = true
+				}
+				cpu, mem, blockIO := "-", "-", "-"
+				if s, ok := usage[info.Names]; ok {
+					cpu, mem, blockIO = s.CPUPerc, s.MemUsage, s.BlockIO
+				}
+				rows = append(rows, []string{info.Names, info.Status, metadata.Project, metadata.Worktree, hostPath, ssh, serviceList, cpu, mem, blockIO})
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			columns := []int{0, 1, 2, 3, 4}
+			if hasSSH {
+				columns = append(columns, 5)
+			}
+			if hasServices {
+				columns = append(columns, 6)
+			}
+			if usage != nil {
+				columns = append(columns, 7, 8, 9)
+			}
+			for _, row := range append([][]string{{"CONTAINER", "STATUS", "PROJECT", "WORKTREE", "HOST PATH", "SSH", "SERVICES", "CPU %", "MEM USAGE / LIMIT", "BLOCK I/O"}}, rows...) {
+				cells := make([]string, len(columns))
+				for i, column := range columns {
+					cells[i] = row[column]
+				}
+				_, _ = fmt.Fprintln(w, strings.Join(cells, "\t"))
 			}
 
 			return w.Flush()
@@ -130,6 +189,113 @@ var listCmd = &cobra.Command{
 	},
 }
 
+// listedStats returns the resource usage of the containers in `ps --format
+// {{json .}}` output by name, or nil (after a warning) when the runtime can't
+// report it
+func listedStats(r docker.Runner, lines []string) map[string]docker.ContainerStats {
+	var names []string
+	for _, line := range lines {
+		var info ContainerInfo
+		if err := json.Unmarshal([]byte(line), &info); err == nil && info.Names != "" {
+			names = append(names, info.Names)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	stats, err := docker.BackendFor(r).Stats(r, names...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	usage := make(map[string]docker.ContainerStats, len(stats))
+	for _, s := range stats {
+		usage[s.Name] = s
+	}
+	return usage
+}
+
+// inspectListedLabels reads the labels of the containers in `ps --format {{json .}}`
+// output with inspect, which keeps values containing commas intact
+func inspectListedLabels(runner container.CommandRunner, output string) map[string]map[string]string {
+	var names []string
+	for _, line := range splitLines(output) {
+		var info ContainerInfo
+		if line != "" && json.Unmarshal([]byte(line), &info) == nil {
+			names = append(names, info.Names)
+		}
+	}
+	return container.InspectLabels(runner, names...)
+}
+
+// listedLabels returns a listed container's inspected labels, falling back to
+// the labels ps printed for runtimes that can't be inspected
+func listedLabels(inspected map[string]map[string]string, info ContainerInfo) map[string]string {
+	if labels, ok := inspected[info.Names]; ok {
+		return labels
+	}
+	return container.ParseLabels(info.Labels)
+}
+
+// listedSSH returns the user and host address of a container's sshd (run --ssh)
+// from its labels and `ps` ports, e.g. "127.0.0.1:49153->2222/tcp"
+func listedSSH(labels map[string]string, ports string) (user, host, port string, ok bool) {
+	user, enabled := labels[runner.SSHLabel]
+	if !enabled {
+		return "", "", "", false
+	}
+	for _, mapping := range strings.Split(ports, ",") {
+		hostAddr, containerPort, found := strings.Cut(strings.TrimSpace(mapping), "->")
+		if !found || containerPort != runner.SSHContainerPort+"/tcp" {
+			continue
+		}
+		idx := strings.LastIndex(hostAddr, ":")
+		if idx == -1 {
+			continue
+		}
+		return user, strings.Trim(hostAddr[:idx], "[]"), hostAddr[idx+1:], true
+	}
+	return "", "", "", false
+}
+
+// listedServices summarizes a container's sidecar services, marking stopped ones
+func listedServices(sidecars []runner.Sidecar) string {
+	if len(sidecars) == 0 {
+		return "-"
+	}
+	names := make([]string, 0, len(sidecars))
+	for _, sidecar := range sidecars {
+		if sidecar.Running {
+			names = append(names, sidecar.Service)
+		} else {
+			names = append(names, sidecar.Service+" (stopped)")
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// printSSHConfigs writes an ~/.ssh/config entry for each listed container with an sshd
+func printSSHConfigs(w io.Writer, lines []string, inspected map[string]map[string]string) error {
+	found := false
+	for _, line := range lines {
+		var info ContainerInfo
+		if line == "" || json.Unmarshal([]byte(line), &info) != nil {
+			continue
+		}
+		if user, host, port, ok := listedSSH(listedLabels(inspected, info), info.Ports); ok {
+			if found {
+				_, _ = fmt.Fprintln(w)
+			}
+			_, _ = fmt.Fprint(w, runner.SSHConfigStanza(info.Names, host, port, user))
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintln(os.Stderr, "No running containers with an SSH server (start one with: packnplay run --ssh)")
+	}
+	return nil
+}
+
 func splitLines(s string) []string {
 	var lines []string
 	start := 0
@@ -148,4 +314,6 @@ func splitLines(s string) []string {
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVarP(&listVerbose, "verbose", "v", false, "Show detailed launch information")
+	listCmd.Flags().BoolVar(&listSSHConfig, "ssh-config", false, "Print ~/.ssh/config entries for containers started with --ssh")
+	listCmd.Flags().BoolVar(&listStats, "stats", false, "Show each container's CPU, memory, and block I/O usage")
 }
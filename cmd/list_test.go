@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
 )
 
 func TestParseLabels(t *testing.T) {
@@ -96,3 +98,37 @@ func TestParseLabelsWithLaunchInfoBackwardCompatibility(t *testing.T) {
 		t.Errorf("parseLabelsWithLaunchInfo() launchCommand = %v, want empty string", launchCommand)
 	}
 }
+
+func TestListedSSH(t *testing.T) {
+	labels := map[string]string{"packnplay-ssh": "vscode"}
+	user, host, port, ok := listedSSH(labels, "0.0.0.0:8080->80/tcp, 127.0.0.1:49153->2222/tcp")
+	if !ok || user != "vscode" || host != "127.0.0.1" || port != "49153" {
+		t.Errorf("listedSSH() = %q, %q, %q, %v", user, host, port, ok)
+	}
+	if _, _, _, ok := listedSSH(map[string]string{}, "127.0.0.1:49153->2222/tcp"); ok {
+		t.Error("containers without --ssh should have no SSH endpoint")
+	}
+	if _, _, _, ok := listedSSH(labels, ""); ok {
+		t.Error("a stopped container has no SSH endpoint")
+	}
+}
+
+func TestListedStats(t *testing.T) {
+	lines := []string{`{"Names":"packnplay-app-main","Status":"Up 2 hours"}`, `{"Names":"packnplay-api-main","Status":"Up 5 minutes"}`}
+
+	fake := fakeUsage()
+	usage := listedStats(fake, lines)
+	if s, ok := usage["packnplay-app-main"]; !ok || s.CPUPerc != "97.10%" || s.BlockIO != "1.2MB / 0B" {
+		t.Errorf("listedStats() = %+v, want packnplay-app-main's usage", usage)
+	}
+	calls := fake.CallsTo("stats")
+	if len(calls) != 1 || !strings.HasSuffix(strings.Join(calls[0], " "), "packnplay-app-main packnplay-api-main") {
+		t.Errorf("stats calls = %v, want one for all listed containers", calls)
+	}
+
+	apple := dockertest.New()
+	apple.Cmd = "container"
+	if usage := listedStats(apple, lines); usage != nil || len(apple.Calls()) != 0 {
+		t.Errorf("listedStats() = %v, want nothing from a runtime without stats", usage)
+	}
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove resources left behind by removed containers",
+	Long: `Remove sidecar services (customizations.packnplay.services) and their networks
+whose container no longer exists, and project networks no container uses any
+more, e.g. because containers were removed with docker rm instead of
+packnplay stop, the lifecycle state of removed containers (only those of the
+runtime in use), and project images no container uses that the images policy
+(images.prune_after_days, images.max_total_mb) selects; see 'packnplay images
+prune'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+
+		pruned, err := runner.PruneSidecars(dockerClient)
+		for _, name := range pruned {
+			fmt.Printf("Removed services of %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+
+		networks, err := runner.PruneProjectNetworks(dockerClient)
+		for _, name := range networks {
+			fmt.Printf("Removed network %s\n", name)
+		}
+		if err != nil {
+			return err
+		}
+		metadata, err := runner.PruneStaleMetadata(dockerClient)
+		for _, id := range metadata {
+			fmt.Printf("Removed lifecycle state of %s\n", id)
+		}
+		if err != nil {
+			return err
+		}
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		images, err := runner.PruneProjectImages(dockerClient, runner.NewImagePrunePolicy(cfg.Images), false)
+		printPrunedImages(os.Stdout, images, false)
+		if err != nil && !errors.Is(err, docker.ErrUnsupported) {
+			return err
+		}
+		if len(pruned) == 0 && len(networks) == 0 && len(metadata) == 0 && len(images) == 0 {
+			fmt.Println("Nothing to prune")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+}
@@ -2,24 +2,54 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
 	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/redact"
 	"github.com/spf13/cobra"
 )
 
-var refreshVerbose bool
+var (
+	refreshVerbose  bool
+	refreshPath     string
+	refreshWorktree string
+	refreshName     string
+	refreshRebuild  bool
+	refreshPullOnly bool
+)
 
 var refreshCmd = &cobra.Command{
 	Use:   "refresh-container",
-	Short: "Pull latest version of default container image",
-	Long:  `Force pull the latest version of the configured default container image to get updated tools and dependencies.`,
+	Short: "Update images and recreate this project's container",
+	Long: `Pull the latest version of the configured default container image, then
+recreate the current project's container on fresh images.
+
+The container is removed (named volumes are kept) and started again in the
+background from the command it was launched with, pulling its base image and
+rebuilding any Dockerfile or feature image. Because the container is new, its
+lifecycle commands run again from onCreateCommand. Attach afterwards with
+packnplay resume or packnplay attach.
+
+With --rebuild, the image is built without the layer cache so features are
+reinstalled. With --pull-only, or when the project has no recorded container,
+only the default image is pulled.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Load config to get the configured default image
 		cfg, err := config.Load()
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
+		if err := applyConfigProfile(cfg, ""); err != nil {
+			return err
+		}
 
 		defaultImage := cfg.GetDefaultImage()
 
@@ -43,11 +73,97 @@ var refreshCmd = &cobra.Command{
 			fmt.Printf("Default container updated to latest version\n")
 		}
 
-		return nil
+		if refreshPullOnly {
+			return nil
+		}
+
+		workDir := refreshPath
+		if workDir == "" {
+			workDir, err = os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+		}
+		workDir, err = filepath.Abs(workDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		name := refreshName
+		if name == "" && refreshWorktree != "" {
+			name = container.GenerateContainerName(workDir, refreshWorktree)
+		}
+
+		info, containerName, err := findLaunch(recordedLaunches(), container.LoadLastUsed(container.LastUsedPath()), workDir, name)
+		if err != nil {
+			if name != "" {
+				return err
+			}
+			fmt.Printf("No recorded container for %s; nothing to recreate\n", workDir)
+			return nil
+		}
+
+		runArgs, err := recordedRunArgs(info.Args)
+		if err != nil {
+			return errdefs.Errorf(errdefs.CategoryUsage, "cannot recreate %s: %w", containerName, err)
+		}
+
+		if _, err := dockerClient.Run("inspect", "--format", "{{.Id}}", containerName); err == nil {
+			if err := stopContainer(dockerClient, containerName); err != nil {
+				return err
+			}
+		}
+
+		return recreateFromLaunch(info, runArgs, refreshRebuild)
 	},
 }
 
+// recordedRunArgs returns the flags of a recorded `run` invocation, without any
+// global flags before it
+func recordedRunArgs(args []string) ([]string, error) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue // global flags such as --quiet come before the subcommand
+		}
+		if arg != "run" {
+			return nil, fmt.Errorf("recorded command is not a run command: %s", strings.Join(args, " "))
+		}
+		return args[i+1:], nil
+	}
+	return nil, fmt.Errorf("recorded command is empty")
+}
+
+// recreateFromLaunch starts the container again from its recorded run flags,
+// detached and on refreshed images. The recorded arguments are kept so resume
+// still re-runs the original command.
+func recreateFromLaunch(info *container.LaunchInfo, runArgs []string, rebuild bool) error {
+	if err := runCmd.ParseFlags(runArgs); err != nil {
+		return errdefs.Errorf(errdefs.CategoryUsage, "failed to parse recorded run flags: %w", err)
+	}
+	runDetach = true
+	runJSON = false
+	runReconnect = false
+	runPersistSession = false
+	runRefreshImage = true
+	runNoBuildCache = rebuild
+	runLaunchArgs = info.Args
+
+	if info.Dir != "" {
+		if err := os.Chdir(info.Dir); err != nil {
+			return fmt.Errorf("failed to change to launch directory %s: %w", info.Dir, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Recreating container: packnplay %s\n", strings.Join(redact.Args(info.Args), " "))
+	return runCmd.RunE(runCmd, nil)
+}
+
 func init() {
 	rootCmd.AddCommand(refreshCmd)
 	refreshCmd.Flags().BoolVarP(&refreshVerbose, "verbose", "v", false, "Show detailed output")
+	refreshCmd.Flags().StringVar(&refreshPath, "path", "", "Project path (default: pwd)")
+	refreshCmd.Flags().StringVar(&refreshWorktree, "worktree", "", "Worktree name")
+	refreshCmd.Flags().StringVar(&refreshName, "name", "", "Container name to recreate")
+	refreshCmd.Flags().BoolVar(&refreshRebuild, "rebuild", false, "Rebuild the image without the layer cache, reinstalling features")
+	refreshCmd.Flags().BoolVar(&refreshPullOnly, "pull-only", false, "Only pull the default image; don't recreate the container")
 }
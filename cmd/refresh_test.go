@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -28,3 +29,37 @@ func TestRefreshCommandFlags(t *testing.T) {
 		t.Error("refresh command should have --verbose flag")
 	}
 }
+
+func TestRecordedRunArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "run with flags and command", args: []string{"run", "--worktree=feat", "--", "claude"}, want: []string{"--worktree=feat", "--", "claude"}},
+		{name: "global flags first", args: []string{"--quiet", "run", "bash"}, want: []string{"bash"}},
+		{name: "not a run command", args: []string{"attach"}, wantErr: true},
+		{name: "empty", args: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := recordedRunArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("recordedRunArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("recordedRunArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshCommandRecreateFlags(t *testing.T) {
+	for _, name := range []string{"path", "worktree", "name", "rebuild", "pull-only"} {
+		if refreshCmd.Flags().Lookup(name) == nil {
+			t.Errorf("refresh command should have --%s flag", name)
+		}
+	}
+}
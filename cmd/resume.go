@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/redact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resumePath     string
+	resumeWorktree string
+	resumeName     string
+	resumePrint    bool
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume [flags]",
+	Short: "Re-run the last command for this project",
+	Long: `Recreate or restart the container for the current project and re-run the exact
+command it was launched with, including its flags and environment, e.g. after a
+reboot.
+
+The command is read from the container's labels, or from
+~/.local/state/packnplay/launches.json if the container has been removed. When
+several containers were launched from the project, the most recently used one is
+resumed unless --worktree or --name picks another.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workDir := resumePath
+		if workDir == "" {
+			var err error
+			workDir, err = os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+		}
+		workDir, err := filepath.Abs(workDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve path: %w", err)
+		}
+
+		name := resumeName
+		if name == "" && resumeWorktree != "" {
+			name = container.GenerateContainerName(workDir, resumeWorktree)
+		}
+
+		info, containerName, err := findLaunch(recordedLaunches(), container.LoadLastUsed(container.LastUsedPath()), workDir, name)
+		if err != nil {
+			return err
+		}
+
+		resumeArgs, err := reconnectArgs(info.Args)
+		if err != nil {
+			return errdefs.Errorf(errdefs.CategoryUsage, "cannot resume %s: %w", containerName, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "Resuming %s: packnplay %s\n", containerName, strings.Join(redact.Args(resumeArgs), " "))
+		if resumePrint {
+			return nil
+		}
+
+		if info.Dir != "" {
+			if err := os.Chdir(info.Dir); err != nil {
+				return fmt.Errorf("failed to change to launch directory %s: %w", info.Dir, err)
+			}
+		}
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find packnplay executable: %w", err)
+		}
+		return syscall.Exec(self, append([]string{os.Args[0]}, resumeArgs...), os.Environ())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+
+	resumeCmd.Flags().StringVar(&resumePath, "path", "", "Project path (default: pwd)")
+	resumeCmd.Flags().StringVar(&resumeWorktree, "worktree", "", "Worktree name")
+	resumeCmd.Flags().StringVar(&resumeName, "name", "", "Container name to resume")
+	resumeCmd.Flags().BoolVar(&resumePrint, "print", false, "Print the command that would be run without running it")
+}
+
+// recordedLaunches returns every recorded launch, keyed by container name. Containers
+// that still exist (even stopped) carry their launch command in a label, which
+// takes precedence over the state file.
+func recordedLaunches() map[string]container.LaunchInfo {
+	var labelled map[string]container.LaunchInfo
+	if dockerClient, err := docker.NewClient(false); err == nil {
+		if output, err := dockerClient.Run("ps", "-a", "--filter", "label=managed-by=packnplay", "--format", "{{json .}}"); err == nil {
+			labelled = parseLaunchLabels(output, inspectListedLabels(dockerClient, output))
+		}
+	}
+
+	launches := container.LoadLaunches(container.LaunchesPath())
+	for containerName, info := range labelled {
+		launches[containerName] = info
+	}
+	return launches
+}
+
+// parseLaunchLabels reads launch info from the labels of the containers in
+// `ps -a --format {{json .}}` output, keyed by container name
+func parseLaunchLabels(output string, inspected map[string]map[string]string) map[string]container.LaunchInfo {
+	launches := make(map[string]container.LaunchInfo)
+	for _, line := range splitLines(output) {
+		if line == "" {
+			continue
+		}
+		var info ContainerInfo
+		if err := json.Unmarshal([]byte(line), &info); err != nil {
+			continue
+		}
+		if launch := container.ReadMetadata(listedLabels(inspected, info)).Launch; launch != nil {
+			launches[info.Names] = *launch
+		}
+	}
+	return launches
+}
+
+// findLaunch picks the launch to resume: the named container's, or the most
+// recently used one launched from workDir
+func findLaunch(launches map[string]container.LaunchInfo, lastUsed map[string]time.Time, workDir, name string) (*container.LaunchInfo, string, error) {
+	if name != "" {
+		info, ok := launches[name]
+		if !ok {
+			return nil, "", errdefs.Errorf(errdefs.CategoryUsage, "no recorded launch command for container %s (it may have been started by an older packnplay)", name)
+		}
+		return &info, name, nil
+	}
+
+	var chosen string
+	var chosenTime time.Time
+	for containerName, info := range launches {
+		if info.HostPath != workDir {
+			continue
+		}
+		used := info.Time
+		if t := lastUsed[containerName]; t.After(used) {
+			used = t
+		}
+		if chosen == "" || used.After(chosenTime) || (used.Equal(chosenTime) && containerName < chosen) {
+			chosen, chosenTime = containerName, used
+		}
+	}
+	if chosen == "" {
+		return nil, "", errdefs.Errorf(errdefs.CategoryUsage, "no recorded launch command for %s; start it with `packnplay run` first", workDir)
+	}
+	info := launches[chosen]
+	return &info, chosen, nil
+}
+
+// reconnectArgs returns the recorded arguments with --reconnect added to the run
+// command, so an existing container is restarted or reused instead of refused
+func reconnectArgs(args []string) ([]string, error) {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue // global flags such as --quiet come before the subcommand
+		}
+		if arg != "run" {
+			return nil, fmt.Errorf("recorded command is not a run command: %s", strings.Join(args, " "))
+		}
+		if i+1 < len(args) && args[i+1] == "--reconnect" {
+			return args, nil // already resumed once
+		}
+		resumed := make([]string, 0, len(args)+1)
+		resumed = append(resumed, args[:i+1]...)
+		resumed = append(resumed, "--reconnect")
+		return append(resumed, args[i+1:]...), nil
+	}
+	return nil, fmt.Errorf("recorded command is empty")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+)
+
+func TestParseLaunchLabels(t *testing.T) {
+	value, err := container.EncodeLaunchInfo(container.LaunchInfo{
+		Args:     []string{"run", "--env", "A=1,B=2", "claude", "--resume"},
+		HostPath: "/src/app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := fmt.Sprintf(`{"Names":"packnplay-app-main","Status":"Exited (0) 1 hour ago","Labels":"managed-by=packnplay,%s=%s,packnplay-host-path=/src/app"}
+{"Names":"packnplay-app-old","Status":"Up 1 hour","Labels":"managed-by=packnplay,packnplay-host-path=/src/app"}
+`, container.LabelLaunchArgs, value)
+
+	launches := parseLaunchLabels(output, nil)
+	if len(launches) != 1 {
+		t.Fatalf("launches = %+v, want only the labelled container", launches)
+	}
+	if got := launches["packnplay-app-main"].Args; !reflect.DeepEqual(got, []string{"run", "--env", "A=1,B=2", "claude", "--resume"}) {
+		t.Errorf("args = %v", got)
+	}
+}
+
+func TestFindLaunch(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	launches := map[string]container.LaunchInfo{
+		"packnplay-app-main":    {Args: []string{"run", "bash"}, HostPath: "/src/app", Time: base},
+		"packnplay-app-feature": {Args: []string{"run", "claude"}, HostPath: "/src/app", Time: base.Add(time.Hour)},
+		"packnplay-other-main":  {Args: []string{"run", "codex"}, HostPath: "/src/other", Time: base.Add(2 * time.Hour)},
+	}
+
+	_, name, err := findLaunch(launches, nil, "/src/app", "")
+	if err != nil || name != "packnplay-app-feature" {
+		t.Errorf("findLaunch() = %s, %v, want the most recent launch for the project", name, err)
+	}
+
+	// Attaching later counts as use
+	lastUsed := map[string]time.Time{"packnplay-app-main": base.Add(3 * time.Hour)}
+	if _, name, _ := findLaunch(launches, lastUsed, "/src/app", ""); name != "packnplay-app-main" {
+		t.Errorf("findLaunch() = %s, want the most recently used container", name)
+	}
+
+	if info, _, err := findLaunch(launches, nil, "/src/app", "packnplay-other-main"); err != nil || info.Args[1] != "codex" {
+		t.Errorf("findLaunch() by name = %+v, %v", info, err)
+	}
+	if _, _, err := findLaunch(launches, nil, "/src/none", ""); err == nil {
+		t.Error("expected an error for a project with no launches")
+	}
+	if _, _, err := findLaunch(launches, nil, "/src/app", "packnplay-missing"); err == nil {
+		t.Error("expected an error for an unknown container")
+	}
+}
+
+func TestReconnectArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{[]string{"run", "--env", "A=b", "claude", "--resume"}, []string{"run", "--reconnect", "--env", "A=b", "claude", "--resume"}, false},
+		{[]string{"--quiet", "run", "claude"}, []string{"--quiet", "run", "--reconnect", "claude"}, false},
+		{[]string{"run", "--reconnect", "claude"}, []string{"run", "--reconnect", "claude"}, false},
+		{[]string{"attach"}, nil, true},
+		{nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := reconnectArgs(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("reconnectArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("reconnectArgs(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/redact"
 	"github.com/spf13/cobra"
 )
 
+// quietMode replaces human-readable error output with a single JSON object
+var quietMode bool
+
+// noRedact shows credentials in verbose, dry-run and error output
+var noRedact bool
+
 var rootCmd = &cobra.Command{
 	Use:   "packnplay",
 	Short: "Launch commands in isolated Docker containers",
@@ -22,12 +32,87 @@ Default container: ghcr.io/obra/packnplay/devcontainer:latest
   Includes: Node.js, Claude Code, OpenAI Codex, Google Gemini, GitHub CLI,
             GitHub Copilot, Qwen Code, Cursor CLI, Sourcegraph Amp
 
-Supported AI agents: claude, codex, gemini, copilot, qwen, cursor, amp, deepseek`,
+Supported AI agents: claude, codex, gemini, copilot, qwen, cursor, amp, deepseek
+
+Exit codes:
+  1  general error          6  image build failed
+  2  invalid usage          7  rejected by image policy
+  3  invalid configuration  8  container create/start failed
+  4  runtime unavailable    9  lifecycle command failed
+  5  image pull failed      10 worktree error`,
+	// Execute prints errors itself so they are reported exactly once
+	SilenceErrors: true,
+}
+
+// errorReport is the JSON object emitted on failure in --quiet mode
+type errorReport struct {
+	Error    string           `json:"error"`
+	Category errdefs.Category `json:"category"`
+	ExitCode int              `json:"exit_code"`
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	tagArgErrors(rootCmd)
+	err := rootCmd.Execute()
+	if err == nil {
+		return
+	}
+
+	err = classifyUsageError(err)
+	code := errdefs.ExitCode(err)
+	message := redact.String(err.Error())
+
+	if quietMode {
+		data, _ := json.Marshal(errorReport{
+			Error:    message,
+			Category: errdefs.CategoryOf(err),
+			ExitCode: code,
+		})
+		fmt.Println(string(data))
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	os.Exit(code)
+}
+
+// classifyUsageError tags cobra's own command-line errors as usage errors
+func classifyUsageError(err error) error {
+	msg := err.Error()
+	for _, prefix := range []string{"unknown command", "unknown flag", "unknown shorthand flag", "invalid argument", "flag needs an argument", "required flag"} {
+		if strings.HasPrefix(msg, prefix) {
+			return errdefs.New(errdefs.CategoryUsage, err)
+		}
+	}
+	return err
+}
+
+// tagArgErrors wraps every command's positional-argument validator so its
+// failures are reported as usage errors
+func tagArgErrors(c *cobra.Command) {
+	if validate := c.Args; validate != nil {
+		c.Args = func(cmd *cobra.Command, args []string) error {
+			return errdefs.New(errdefs.CategoryUsage, validate(cmd, args))
+		}
 	}
+	for _, sub := range c.Commands() {
+		tagArgErrors(sub)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&quietMode, "quiet", "q", false, "On failure, print a single JSON error object to stdout instead of a message")
+	rootCmd.PersistentFlags().BoolVar(&noRedact, "no-redact", false, "Show credentials (API keys, tokens, passwords) in verbose, dry-run and error output instead of redacting them")
+
+	cobra.OnInitialize(func() {
+		redact.SetEnabled(!noRedact)
+		if quietMode {
+			rootCmd.SilenceUsage = true
+		}
+	})
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		if quietMode {
+			cmd.SilenceUsage = true
+		}
+		return errdefs.New(errdefs.CategoryUsage, err)
+	})
 }
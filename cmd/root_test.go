@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/spf13/cobra"
+)
+
+func TestClassifyUsageError(t *testing.T) {
+	if got := errdefs.CategoryOf(classifyUsageError(errors.New(`unknown command "bogus" for "packnplay"`))); got != errdefs.CategoryUsage {
+		t.Errorf("unknown command category = %s, want usage", got)
+	}
+	if got := errdefs.CategoryOf(classifyUsageError(errors.New("failed to pull image"))); got != errdefs.CategoryGeneral {
+		t.Errorf("other error category = %s, want general", got)
+	}
+}
+
+func TestTagArgErrors(t *testing.T) {
+	parent := &cobra.Command{Use: "parent"}
+	child := &cobra.Command{Use: "child", Args: cobra.ExactArgs(1), Run: func(*cobra.Command, []string) {}}
+	parent.AddCommand(child)
+
+	tagArgErrors(parent)
+
+	if err := child.Args(child, nil); errdefs.CategoryOf(err) != errdefs.CategoryUsage {
+		t.Errorf("Args() error = %v, want usage category", err)
+	}
+	if err := child.Args(child, []string{"x"}); err != nil {
+		t.Errorf("Args() with valid args = %v, want nil", err)
+	}
+}
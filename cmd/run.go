@@ -10,43 +10,137 @@ import (
 	"time"
 
 	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
 	"github.com/obra/packnplay/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
 var (
-	runPath         string
-	runWorktree     string
-	runNoWorktree   bool
-	runEnv          []string
-	runVerbose      bool
-	runRuntime      string
-	runConfig       string
-	runReconnect    bool
-	runPublishPorts []string
-	runVolumes      []string
+	runPath                  string
+	runWorktree              string
+	runFrom                  string
+	runNoWorktree            bool
+	runEnv                   []string
+	runVerbose               bool
+	runRuntime               string
+	runConfig                string
+	runReconnect             bool
+	runPublishPorts          []string
+	runVolumes               []string
+	runPlatform              string
+	runSkipFeatureValidation bool
+	runNoEnvFiles            bool
+	runHostBridge            bool
+	runDockerSocket          bool
+	runProfile               string
+	runPersistSession        bool
+	runDetach                bool
+	runEphemeral             bool
+	runJSON                  bool
+	runDryRun                bool
+	runCloneInVolume         string
+	runRepo                  string
+	runBranch                string
+	runPolicyOverride        string
+	runTrustHooks            bool
+	runSSH                   bool
+	runEvents                bool
+	runPullTimeout           time.Duration
+	runOffline               bool
+	runTimeout               time.Duration
+	runTimeoutStop           bool
+	runReattach              bool
+	// Set by refresh-container when it re-runs a recorded launch, not flags
+	runRefreshImage bool
+	runNoBuildCache bool
+	runLaunchArgs   []string // recorded arguments to keep for resume instead of os.Args
 	// Credential flags
-	runGitCreds *bool
-	runSSHCreds *bool
-	runSSHAgent *bool
-	runGHCreds  *bool
-	runGPGCreds *bool
-	runNPMCreds *bool
-	runAWSCreds *bool
-	runAllCreds bool
+	runGitCreds    *bool
+	runSSHCreds    *bool
+	runSSHAgent    *bool
+	runGHCreds     *bool
+	runGPGCreds    *bool
+	runNPMCreds    *bool
+	runAWSCreds    *bool
+	runAllCreds    bool
+	runClaudeCreds string
 )
 
 var runCmd = &cobra.Command{
-	Use:           "run [flags] [command...]",
-	Short:         "Run command in container",
-	Long:          `Start a container and execute the specified command inside it.`,
-	Args:          cobra.MinimumNArgs(1),
+	Use:   "run [flags] [command...]",
+	Short: "Run command in container",
+	Long: `Start a container and execute the specified command inside it.
+
+With --detach, the container is created and its lifecycle commands run, then
+packnplay prints the container name and ID and exits without attaching, so CI
+pipelines and scripts can bring environments up without a TTY. A command given
+with --detach is started in the background.
+
+With --ephemeral, the command runs in a throwaway container that is removed
+when it exits. No worktree is created and no metadata or credentials are kept,
+and the worktree's regular container is left untouched.
+
+With --dry-run, packnplay resolves the worktree, devcontainer.json, features,
+mounts and environment and prints the exact docker run and exec commands and the
+effective devcontainer configuration, without contacting the container runtime.
+Add --json for the full run spec.
+
+With --clone-in-volume, nothing is mounted from the host: the origin remote is
+cloned into a named volume inside the container, using the SSH or gh
+credentials mounted for it. This avoids slow bind mounts for large repositories
+on macOS. The current branch is cloned unless a ref is given with
+--clone-in-volume=<ref>. Later runs reuse the volume and its clone; list and
+remove volumes with 'packnplay volume'.
+
+With --timeout, packnplay runs the command as a child process instead of
+handing over to it. When the time is up the command gets SIGTERM (SIGKILL ten
+seconds later) and packnplay exits with code 124; --timeout-stop also stops the
+container. Otherwise the command's own exit code is kept.
+
+With --reattach, packnplay also runs the command as a child process, and checks
+on the container runtime's daemon while it runs. If the daemon restarts (Docker
+Desktop updating, say) and cuts the command off, packnplay waits for it to come
+back, finds the container again, starts it if the restart stopped it, and runs
+the command in it again.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if runDetach || runDryRun {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Ensure credential watcher is running (auto-managed daemon)
-		if err := ensureCredentialWatcher(); err != nil {
-			return fmt.Errorf("failed to start credential watcher: %w", err)
+		if runDetach && runPersistSession {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--detach and --persist-session cannot be used together")
+		}
+		if runJSON && !runDetach && !runDryRun {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--json requires --detach or --dry-run")
+		}
+		if runDryRun && (runDetach || runReconnect) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--dry-run cannot be used with --detach or --reconnect")
+		}
+		if runTimeout > 0 && (runDetach || runPersistSession) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--timeout cannot be used with --detach or --persist-session")
+		}
+		if runReattach && (runDetach || runDryRun || runEphemeral) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--reattach cannot be used with --detach, --dry-run or --ephemeral")
+		}
+		if runTimeoutStop && runTimeout <= 0 {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--timeout-stop requires --timeout")
+		}
+		if runFrom != "" && runNoWorktree {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--from cannot be used with --no-worktree")
+		}
+		if err := validateEphemeralFlags(cmd); err != nil {
+			return err
+		}
+		if err := validateCloneInVolumeFlags(cmd); err != nil {
+			return err
+		}
+		if err := validateRepoFlags(cmd); err != nil {
+			return err
 		}
 
 		// If --runtime specified, we can skip config loading for runtime selection
@@ -61,7 +155,6 @@ var runCmd = &cobra.Command{
 				// Config doesn't exist - use defaults
 				cfg = &config.Config{
 					ContainerRuntime: runRuntime,
-					DefaultImage:     "ghcr.io/obra/packnplay/devcontainer:latest",
 					DefaultCredentials: config.Credentials{
 						Git: true,  // Always copy .gitconfig
 						SSH: false, // SSH keys are credentials - user choice
@@ -73,10 +166,15 @@ var runCmd = &cobra.Command{
 			// No runtime flag - load config (will prompt if runtime not set)
 			cfg, err = config.Load()
 			if err != nil {
-				return fmt.Errorf("failed to load config: %w", err)
+				return errdefs.Errorf(errdefs.CategoryConfig, "failed to load config: %w", err)
 			}
 		}
 
+		// Overlay the selected profile before reading any settings
+		if err := applyConfigProfile(cfg, runProfile); err != nil {
+			return err
+		}
+
 		// Determine which credentials to use (flags override config)
 		creds := cfg.DefaultCredentials
 
@@ -102,6 +200,9 @@ var runCmd = &cobra.Command{
 		if cmd.Flags().Changed("aws-creds") {
 			creds.AWS = *runAWSCreds
 		}
+		if cmd.Flags().Changed("claude-creds") {
+			creds.Claude = runClaudeCreds
+		}
 		if runAllCreds {
 			creds.Git = true
 			creds.SSH = true
@@ -117,20 +218,35 @@ var runCmd = &cobra.Command{
 			creds.SSH = false
 		}
 
+		// Ensure credential watcher is running (auto-managed daemon)
+		if !runDryRun && needsCredentialWatcher(creds) {
+			if err := ensureCredentialWatcher(); err != nil {
+				return fmt.Errorf("failed to start credential watcher: %w", err)
+			}
+		}
+
 		// Determine which runtime to use (flag > config > detect)
 		runtime := runRuntime
 		if runtime == "" {
 			runtime = cfg.ContainerRuntime
 		}
 
-		// Apply environment configuration if specified
-		var configEnv []string
-		if runConfig != "" {
-			if envConfig, exists := cfg.EnvConfigs[runConfig]; exists {
-				configEnv = applyEnvConfig(envConfig)
-			} else {
-				return fmt.Errorf("environment config '%s' not found in config file", runConfig)
-			}
+		// Apply the --env-config environment, or the configured default
+		configEnv, err := resolveEnvConfig(cfg, runConfig)
+		if err != nil {
+			return err
+		}
+
+		// --from replaces the configured base of new branches
+		worktreeSettings := cfg.Worktree
+		if runFrom != "" {
+			worktreeSettings.From = runFrom
+		}
+
+		// --offline uses only images and features already local
+		registrySettings := cfg.Registry
+		if runOffline {
+			registrySettings.Offline = true
 		}
 
 		// Determine host path for labels
@@ -148,35 +264,97 @@ var runCmd = &cobra.Command{
 			return fmt.Errorf("failed to resolve path: %w", err)
 		}
 
-		// Capture original command line for debugging
+		// Capture original command line for debugging and `packnplay resume`
 		launchCommand := strings.Join(os.Args, " ")
+		launchArgs := os.Args[1:]
+		if runLaunchArgs != nil {
+			launchCommand = strings.Join(append([]string{os.Args[0]}, runLaunchArgs...), " ")
+			launchArgs = runLaunchArgs
+		}
+		launchDir, _ := os.Getwd()
 
 		runConfig := &runner.RunConfig{
-			Path:           runPath,
-			Worktree:       runWorktree,
-			NoWorktree:     runNoWorktree,
-			Env:            append(runEnv, configEnv...), // Merge user env vars with config env vars
-			Verbose:        runVerbose,
-			Runtime:        runtime,
-			Reconnect:      runReconnect,
-			DefaultImage:   cfg.DefaultImage,
-			Command:        args,
-			Credentials:    creds,
-			DefaultEnvVars: cfg.DefaultEnvVars,
-			PublishPorts:   runPublishPorts,
-			Volumes:        runVolumes,
-			HostPath:       hostPath,
-			LaunchCommand:  launchCommand,
-		}
-
-		if err := runner.Run(runConfig); err != nil {
-			// Print error without extra formatting since our error messages are already well-formatted
-			fmt.Fprintln(os.Stderr, err.Error())
-			// Return non-nil error to set exit code, but silence Cobra error handling
-			os.Exit(1)
+			Path:                  runPath,
+			Worktree:              runWorktree,
+			NoWorktree:            runNoWorktree,
+			Env:                   append(runEnv, configEnv...), // Merge user env vars with config env vars
+			ExecEnv:               configEnv,
+			Verbose:               runVerbose,
+			Runtime:               runtime,
+			Reconnect:             runReconnect,
+			DefaultImage:          cfg.GetDefaultImage(),
+			Command:               args,
+			Credentials:           creds,
+			DefaultEnvVars:        cfg.DefaultEnvVars,
+			PublishPorts:          runPublishPorts,
+			Volumes:               runVolumes,
+			HostPath:              hostPath,
+			LaunchCommand:         launchCommand,
+			LaunchArgs:            launchArgs,
+			LaunchDir:             launchDir,
+			Platform:              runPlatform,
+			SkipFeatureValidation: runSkipFeatureValidation,
+			LoadEnvFiles:          cfg.EnvFiles.Enabled && !runNoEnvFiles,
+			LoadProjectDotEnv:     cfg.EnvFiles.ProjectDotEnv,
+			MountRelabel:          cfg.Security.MountRelabel,
+			DisableLabels:         cfg.Security.DisableLabels,
+			AppArmorProfile:       cfg.Security.AppArmorProfile,
+			HostBridge:            cfg.HostBridge.Enabled || runHostBridge || cfg.HostBridge.Clipboard,
+			HostBridgeActions:     cfg.HostBridge.BridgeActions(cfg.HostBridge.Enabled || runHostBridge),
+			DockerSocket:          cfg.DockerSocket || runDockerSocket,
+			PersistSession:        runPersistSession,
+			Detach:                runDetach,
+			Ephemeral:             runEphemeral,
+			DetachJSON:            runJSON && runDetach,
+			DryRun:                runDryRun,
+			DryRunJSON:            runJSON && runDryRun,
+			CloneInVolume:         runCloneInVolume,
+			Repo:                  runRepo,
+			Branch:                runBranch,
+			MountExcludes:         cfg.MountExcludes,
+			AgentState:            cfg.AgentState,
+			ForeignBinaries:       cfg.ForeignBinaries,
+			RestartPolicy:         cfg.RestartPolicy,
+			NoRegistryLogin:       cfg.NoRegistryLogin,
+			NoProjectNetwork:      cfg.NoProjectNetwork,
+			BuildContextWarnMB:    cfg.BuildContextWarnMB,
+			VulnScan:              cfg.VulnScan,
+			PullTimeout:           runPullTimeout,
+			RefreshImage:          runRefreshImage,
+			NoBuildCache:          runNoBuildCache,
+			Hooks:                 cfg.Hooks,
+			CredentialStore:       cfg.CredentialStore,
+			BuildSecrets:          cfg.BuildSecrets,
+			PolicyOverride:        runPolicyOverride,
+			TrustHooks:            runTrustHooks,
+			SSH:                   runSSH,
+			Shell:                 cfg.Shell,
+			Proxy:                 cfg.Proxy,
+			Timeout:               runTimeout,
+			TimeoutStop:           runTimeoutStop,
+			Reattach:              runReattach,
+			ConfigDrift:           cfg.ConfigDrift,
+			WorkspaceOwnership:    cfg.WorkspaceOwnership,
+			DevcontainerSearch:    cfg.DevcontainerSearch,
+			WorktreeSettings:      worktreeSettings,
+			Registry:              registrySettings,
+			GitHub:                cfg.GitHub,
 		}
 
-		return nil
+		// Progress events for orchestrators: on stderr with --events, or on an
+		// inherited descriptor named by PACKNPLAY_EVENTS_FD
+		if runEvents {
+			runConfig.Events = events.New(os.Stderr)
+		} else if runConfig.Events, err = events.FromEnv(); err != nil {
+			return err
+		}
+
+		if !runDryRun {
+			notifySelfUpdate(cfg)
+		}
+
+		// Errors are printed by Execute, which also maps them to exit codes
+		return runner.Run(runConfig)
 	},
 }
 
@@ -189,14 +367,42 @@ func init() {
 
 	runCmd.Flags().StringVar(&runPath, "path", "", "Project path (default: pwd)")
 	runCmd.Flags().StringVar(&runWorktree, "worktree", "", "Worktree name (creates if needed)")
+	runCmd.Flags().StringVar(&runFrom, "from", "", "Ref a new worktree's branch starts from, e.g. origin/main (default: worktree.from, or HEAD)")
 	runCmd.Flags().BoolVar(&runNoWorktree, "no-worktree", false, "Skip worktree, use directory directly")
 	runCmd.Flags().StringSliceVar(&runEnv, "env", []string{}, "Additional env vars (KEY=value)")
 	runCmd.Flags().StringArrayVarP(&runPublishPorts, "publish", "p", []string{}, "Publish container port(s) to host (format: [hostIP:]hostPort:containerPort[/protocol])")
 	runCmd.Flags().StringArrayVarP(&runVolumes, "volume", "v", []string{}, "Bind mount a volume (format: hostPath:containerPath[:options])")
-	runCmd.Flags().StringVar(&runRuntime, "runtime", "", "Container runtime to use (docker/podman/container)")
-	runCmd.Flags().StringVar(&runConfig, "config", "", "API config profile (anthropic, z.ai, anthropic-work, claude-personal)")
+	runCmd.Flags().StringVar(&runRuntime, "runtime", "", "Container runtime to use (docker/podman/nerdctl/lima/container)")
+	runCmd.Flags().StringVar(&runConfig, "env-config", "", "Named env config to apply, e.g. z.ai (see: packnplay env-config list)")
+	// --config is the original name of --env-config, kept for existing scripts
+	runCmd.Flags().StringVar(&runConfig, "config", "", "Alias for --env-config")
+	_ = runCmd.Flags().MarkHidden("config")
 	runCmd.Flags().BoolVarP(&runReconnect, "reconnect", "r", false, "Reconnect to existing container instead of failing")
 	runCmd.Flags().BoolVar(&runVerbose, "verbose", false, "Show all docker/git commands")
+	runCmd.Flags().StringVar(&runProfile, "profile", "", "Configuration profile to use (default: $PACKNPLAY_PROFILE or the active profile)")
+	runCmd.Flags().BoolVar(&runDockerSocket, "docker-socket", false, "Mount the host's Docker/Podman socket so the container can run containers (grants host root-equivalent access)")
+	runCmd.Flags().BoolVar(&runHostBridge, "host-bridge", false, "Let the container open URLs (and editors or the clipboard, if allowed in config) on the host")
+	runCmd.Flags().BoolVar(&runPersistSession, "persist-session", false, "Run the command in a tmux session that survives disconnects; running again re-enters it")
+	runCmd.Flags().BoolVar(&runEphemeral, "ephemeral", false, "Run in a throwaway container removed on exit, without a worktree or persisted state")
+	runCmd.Flags().BoolVarP(&runDetach, "detach", "d", false, "Create the container and run lifecycle commands, then print its name and ID and exit")
+	runCmd.Flags().BoolVar(&runJSON, "json", false, "With --detach, print the container name, ID, and published ports as JSON; with --dry-run, print the run spec as JSON")
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Print the container that would be created without pulling, building or starting anything")
+	runCmd.Flags().StringVar(&runCloneInVolume, "clone-in-volume", "", "Clone the repository into a volume inside the container instead of mounting it (current branch, or --clone-in-volume=<ref>)")
+	runCmd.Flags().Lookup("clone-in-volume").NoOptDefVal = runner.CloneCurrentBranch
+	runCmd.Flags().StringVar(&runRepo, "repo", "", "Clone this repository URL into a volume inside the container, without a local checkout")
+	runCmd.Flags().StringVar(&runBranch, "branch", "", "With --repo, the branch or tag to clone (default: the repository's default branch)")
+	runCmd.Flags().BoolVar(&runEvents, "events", false, "Write newline-delimited JSON progress events to stderr (or set "+events.EnvFD+" to a file descriptor)")
+	runCmd.Flags().BoolVar(&runSSH, "ssh", false, "Run an SSH server in the container on a random localhost port and print an ssh config entry (for JetBrains Gateway, ssh, ...)")
+	runCmd.Flags().BoolVar(&runTrustHooks, "trust-hooks", false, "Trust the project's customizations.packnplay.hooks, which run on the host, until they change")
+	runCmd.Flags().StringVar(&runPolicyOverride, "policy-override", "", "Run despite devcontainer policy violations, giving a reason (policy admins only)")
+	runCmd.Flags().BoolVar(&runNoEnvFiles, "no-env-files", false, "Don't load .devcontainer/devcontainer.env or .env even if enabled in config")
+	runCmd.Flags().BoolVar(&runSkipFeatureValidation, "skip-feature-validation", false, "Don't validate feature options against the feature's option spec")
+	runCmd.Flags().StringVar(&runPlatform, "platform", "", "Target platform for image pull/build and run (e.g. linux/amd64)")
+	runCmd.Flags().DurationVar(&runTimeout, "timeout", 0, "Stop the command after this long (e.g. 45m) and exit with code 124")
+	runCmd.Flags().BoolVar(&runTimeoutStop, "timeout-stop", false, "With --timeout, also stop the container when the time is up")
+	runCmd.Flags().BoolVar(&runReattach, "reattach", false, "Run the command again in the container if a daemon restart cuts it off")
+	runCmd.Flags().DurationVar(&runPullTimeout, "pull-timeout", 0, "Give up on a single image pull attempt after this long (e.g. 10m); interrupted pulls are retried")
+	runCmd.Flags().BoolVar(&runOffline, "offline", false, "Pull nothing: use only images and features already available locally (default: registry.offline)")
 
 	// Credential flags (use pointers so we can detect if they were explicitly set)
 	runGitCreds = runCmd.Flags().Bool("git-creds", false, "Mount git config (~/.gitconfig)")
@@ -207,6 +413,18 @@ func init() {
 	runNPMCreds = runCmd.Flags().Bool("npm-creds", false, "Mount npm credentials")
 	runAWSCreds = runCmd.Flags().Bool("aws-creds", false, "Mount AWS credentials")
 	runCmd.Flags().BoolVar(&runAllCreds, "all-creds", false, "Mount all available credentials")
+	runCmd.Flags().StringVar(&runClaudeCreds, "claude-creds", "", "Where Claude credentials come from: auto, host, managed, or none (default: default_credentials.claude or auto)")
+}
+
+// needsCredentialWatcher reports whether a run may use credentials the
+// watcher keeps in sync: container-managed Claude credentials, or gh tokens
+// bridged from the host
+func needsCredentialWatcher(creds config.Credentials) bool {
+	switch creds.ClaudeMode() {
+	case config.ClaudeCredsHost, config.ClaudeCredsNone:
+		return creds.GH
+	}
+	return true
 }
 
 // ensureCredentialWatcher starts the credential sync daemon if not already running
@@ -256,33 +474,86 @@ func applyEnvConfig(envConfig config.EnvConfig) []string {
 	return envVars
 }
 
-// expandEnvVars substitutes ${VAR_NAME} with environment variable values
+// expandEnvVars substitutes ${VAR_NAME} and ${localEnv:VAR_NAME[:default]} with
+// host environment variable values
 func expandEnvVars(value string) string {
-	// Simple variable substitution for ${VAR_NAME} pattern
-	result := value
+	var result strings.Builder
+	rest := value
 
-	// Find all ${VAR_NAME} patterns
+	// Find all ${...} patterns; substituted values are not expanded again
 	for {
-		start := strings.Index(result, "${")
+		start := strings.Index(rest, "${")
 		if start == -1 {
 			break
 		}
 
-		end := strings.Index(result[start:], "}")
+		end := strings.Index(rest[start:], "}")
 		if end == -1 {
 			break
 		}
 		end += start
 
-		// Extract variable name
-		varName := result[start+2 : end]
+		result.WriteString(rest[:start])
+		result.WriteString(lookupEnvReference(rest[start+2 : end]))
+		rest = rest[end+1:]
+	}
 
-		// Get environment variable value
-		envValue := os.Getenv(varName)
+	result.WriteString(rest)
+	return result.String()
+}
 
-		// Replace ${VAR_NAME} with value
-		result = result[:start] + envValue + result[end+1:]
+// lookupEnvReference resolves the inside of a ${...} reference: VAR_NAME or
+// localEnv:VAR_NAME with an optional :default used when VAR_NAME is unset
+func lookupEnvReference(ref string) string {
+	name, ok := strings.CutPrefix(ref, "localEnv:")
+	if !ok {
+		return os.Getenv(ref)
+	}
+	name, defaultValue, _ := strings.Cut(name, ":")
+	if envValue, set := os.LookupEnv(name); set {
+		return envValue
 	}
+	return defaultValue
+}
 
-	return result
+// validateEphemeralFlags rejects flags that need state an ephemeral container doesn't keep
+func validateEphemeralFlags(cmd *cobra.Command) error {
+	if !runEphemeral {
+		return nil
+	}
+	for _, name := range []string{"worktree", "from", "reconnect", "persist-session", "detach", "clone-in-volume"} {
+		if cmd.Flags().Changed(name) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--ephemeral cannot be used with --%s", name)
+		}
+	}
+	return nil
+}
+
+// validateCloneInVolumeFlags rejects flags that choose a host directory to mount
+func validateCloneInVolumeFlags(cmd *cobra.Command) error {
+	if runCloneInVolume == "" {
+		return nil
+	}
+	for _, name := range []string{"worktree", "no-worktree", "from"} {
+		if cmd.Flags().Changed(name) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--clone-in-volume cannot be used with --%s", name)
+		}
+	}
+	return nil
+}
+
+// validateRepoFlags rejects flags that choose a host directory to run in
+func validateRepoFlags(cmd *cobra.Command) error {
+	if runRepo == "" {
+		if runBranch != "" {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--branch requires --repo")
+		}
+		return nil
+	}
+	for _, name := range []string{"path", "worktree", "no-worktree", "from", "clone-in-volume", "ephemeral"} {
+		if cmd.Flags().Changed(name) {
+			return errdefs.Errorf(errdefs.CategoryUsage, "--repo cannot be used with --%s", name)
+		}
+	}
+	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
 )
 
 func TestExpandEnvVars(t *testing.T) {
@@ -56,6 +58,21 @@ func TestExpandEnvVars(t *testing.T) {
 			input:    "${TEST_API_KEY",
 			expected: "${TEST_API_KEY",
 		},
+		{
+			name:     "localEnv variable",
+			input:    "Bearer ${localEnv:TEST_API_KEY}",
+			expected: "Bearer sk-test-123",
+		},
+		{
+			name:     "localEnv default for unset variable",
+			input:    "${localEnv:UNDEFINED_VAR:https://fallback.example.com}",
+			expected: "https://fallback.example.com",
+		},
+		{
+			name:     "localEnv default ignored when set",
+			input:    "${localEnv:TEST_URL:unused}",
+			expected: "https://api.example.com",
+		},
 	}
 
 	for _, tt := range tests {
@@ -147,3 +164,127 @@ func TestApplyEnvConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestRunArgsDetach(t *testing.T) {
+	defer func() { runDetach = false }()
+
+	runDetach = false
+	if err := runCmd.Args(runCmd, nil); err == nil {
+		t.Error("run without a command should fail unless --detach is set")
+	}
+
+	runDetach = true
+	if err := runCmd.Args(runCmd, nil); err != nil {
+		t.Errorf("run --detach without a command: %v", err)
+	}
+	if err := runCmd.Args(runCmd, []string{"npm", "run", "dev"}); err != nil {
+		t.Errorf("run --detach with a command: %v", err)
+	}
+}
+
+func TestRunDryRunFlags(t *testing.T) {
+	defer func() { runDryRun, runJSON, runDetach = false, false, false }()
+
+	runDryRun = true
+	if err := runCmd.Args(runCmd, nil); err != nil {
+		t.Errorf("run --dry-run without a command: %v", err)
+	}
+
+	runDetach = true
+	err := runCmd.RunE(runCmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "--dry-run cannot be used with --detach") {
+		t.Errorf("run --dry-run --detach error = %v", err)
+	}
+
+	runDryRun, runDetach, runJSON = false, false, true
+	err = runCmd.RunE(runCmd, []string{"bash"})
+	if err == nil || !strings.Contains(err.Error(), "--json requires --detach or --dry-run") {
+		t.Errorf("run --json error = %v", err)
+	}
+}
+
+func TestValidateEphemeralFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "not ephemeral", args: []string{"--worktree=feature"}},
+		{name: "ephemeral alone", args: []string{"--ephemeral"}},
+		{name: "ephemeral with env", args: []string{"--ephemeral", "--env=FOO=bar"}},
+		{name: "ephemeral with worktree", args: []string{"--ephemeral", "--worktree=feature"}, wantErr: "--worktree"},
+		{name: "ephemeral with reconnect", args: []string{"--ephemeral", "--reconnect"}, wantErr: "--reconnect"},
+		{name: "ephemeral with detach", args: []string{"--ephemeral", "--detach"}, wantErr: "--detach"},
+		{name: "ephemeral with persist-session", args: []string{"--ephemeral", "--persist-session"}, wantErr: "--persist-session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "run"}
+			var worktree string
+			var env []string
+			var reconnect, detach, persist bool
+			cmd.Flags().BoolVar(&runEphemeral, "ephemeral", false, "")
+			cmd.Flags().StringVar(&worktree, "worktree", "", "")
+			cmd.Flags().StringSliceVar(&env, "env", nil, "")
+			cmd.Flags().BoolVar(&reconnect, "reconnect", false, "")
+			cmd.Flags().BoolVar(&detach, "detach", false, "")
+			cmd.Flags().BoolVar(&persist, "persist-session", false, "")
+			defer func() { runEphemeral = false }()
+
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			err := validateEphemeralFlags(cmd)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateEphemeralFlags() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateEphemeralFlags() error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloneInVolumeFlag(t *testing.T) {
+	flag := runCmd.Flags().Lookup("clone-in-volume")
+	if flag == nil || flag.NoOptDefVal != runner.CloneCurrentBranch {
+		t.Fatalf("--clone-in-volume without a ref should clone the current branch: %+v", flag)
+	}
+
+	tests := []struct {
+		args    []string
+		wantErr string
+	}{
+		{args: []string{"--clone-in-volume"}},
+		{args: []string{"--clone-in-volume=main"}},
+		{args: []string{"--worktree=feature"}},
+		{args: []string{"--clone-in-volume", "--worktree=feature"}, wantErr: "--worktree"},
+		{args: []string{"--clone-in-volume=main", "--no-worktree"}, wantErr: "--no-worktree"},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{Use: "run"}
+		var worktree string
+		var noWorktree bool
+		cmd.Flags().StringVar(&runCloneInVolume, "clone-in-volume", "", "")
+		cmd.Flags().Lookup("clone-in-volume").NoOptDefVal = runner.CloneCurrentBranch
+		cmd.Flags().StringVar(&worktree, "worktree", "", "")
+		cmd.Flags().BoolVar(&noWorktree, "no-worktree", false, "")
+		if err := cmd.Flags().Parse(tt.args); err != nil {
+			t.Fatalf("Parse(%v) error = %v", tt.args, err)
+		}
+
+		err := validateCloneInVolumeFlags(cmd)
+		runCloneInVolume = ""
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("validateCloneInVolumeFlags(%v) error = %v, want nil", tt.args, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateCloneInVolumeFlags(%v) error = %v, want mention of %s", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/spf13/cobra"
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage secrets for image builds",
+	Long: `Store secrets that Dockerfile builds mount with RUN --mount=type=secret,
+such as a private package index token. Secrets are kept in the credential
+store (credential_store in config.json) and referenced from devcontainer.json:
+
+  "customizations": {"packnplay": {"build": {"secrets": {
+    "pip_token": {"store": "pip-token"}
+  }}}}
+
+Builds only get the secrets listed under build_secrets.store in config.json:
+
+  "build_secrets": {"store": ["pip-token"]}`,
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Store a build secret, read from stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSecretStore()
+		if err != nil {
+			return err
+		}
+		value, err := readSecretValue(args[0])
+		if err != nil {
+			return err
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("refusing to store an empty secret")
+		}
+		if err := store.Set(credstore.BuildSecretKey(args[0]), value); err != nil {
+			return fmt.Errorf("failed to store secret %s: %w", args[0], err)
+		}
+		fmt.Printf("Stored secret %s in the %s credential store\n", args[0], store.Name())
+		if cfg, err := config.LoadWithoutRuntimeCheck(); err == nil && !slices.Contains(cfg.BuildSecrets.Store, args[0]) {
+			fmt.Printf("Add it to build_secrets.store in config.json to let builds read it\n")
+		}
+		return nil
+	},
+}
+
+var secretRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "Remove build secrets",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openSecretStore()
+		if err != nil {
+			return err
+		}
+		for _, name := range args {
+			if err := store.Delete(credstore.BuildSecretKey(name)); err != nil {
+				return fmt.Errorf("failed to remove secret %s: %w", name, err)
+			}
+			fmt.Printf("Removed secret %s\n", name)
+		}
+		return nil
+	},
+}
+
+func init() {
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretRmCmd)
+	rootCmd.AddCommand(secretCmd)
+}
+
+// openSecretStore opens the configured credential store
+func openSecretStore() (credstore.Store, error) {
+	backend := ""
+	if cfg, err := config.LoadWithoutRuntimeCheck(); err == nil {
+		backend = cfg.CredentialStore
+	}
+	return credstore.Open(backend, credstore.DefaultDir())
+}
+
+// readSecretValue prompts for a secret without echoing it on a terminal, or
+// reads it from piped stdin without the trailing newline
+func readSecretValue(name string) ([]byte, error) {
+	if isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintf(os.Stderr, "Value for %s: ", name)
+		value, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret: %w", err)
+		}
+		return value, nil
+	}
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	return bytes.TrimRight(value, "\r\n"), nil
+}
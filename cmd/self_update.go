@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/selfupdate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	selfUpdateChannel string
+	selfUpdateCheck   bool
+	selfUpdateForce   bool
+)
+
+// selfUpdateNoticeTimeout bounds the release check made while starting a container
+const selfUpdateNoticeTimeout = 2 * time.Second
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update packnplay to the latest release",
+	Long: `Download the latest packnplay release from GitHub, verify it against the
+release's checksums, and replace the running binary.
+
+The stable channel follows published releases; beta also includes
+prereleases. The default channel is set by self_update.channel in config.json.`,
+	Example: `  packnplay self-update
+  packnplay self-update --check
+  packnplay self-update --channel beta`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		channel := selfUpdateChannel
+		if channel == "" {
+			channel = cfg.SelfUpdate.Channel
+		}
+		if channel == "" {
+			channel = selfupdate.ChannelStable
+		}
+		if err := selfupdate.ValidChannel(channel); err != nil {
+			return errdefs.New(errdefs.CategoryUsage, err)
+		}
+
+		client := selfupdate.NewClient(5 * time.Minute)
+		release, err := client.Latest(channel)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case selfupdate.IsNewer(version, release.Tag):
+			// An update is available
+		case version == "dev" && selfUpdateForce && !selfUpdateCheck:
+			// A development build has no version to compare; --force installs the release
+		case version == "dev":
+			fmt.Printf("This is a development build; the latest %s release is %s (pass --force to install it)\n", channel, release.Tag)
+			return nil
+		default:
+			fmt.Printf("packnplay %s is up to date (%s channel)\n", version, channel)
+			return nil
+		}
+		if selfUpdateCheck {
+			fmt.Printf("packnplay %s is available (you have %s); run: packnplay self-update\n", release.Tag, version)
+			return nil
+		}
+
+		exePath, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the packnplay binary: %w", err)
+		}
+
+		fmt.Printf("Updating packnplay %s -> %s...\n", version, release.Tag)
+		binary, err := client.Download(release, runtime.GOOS, runtime.GOARCH)
+		if err != nil {
+			return err
+		}
+		if err := selfupdate.Install(exePath, binary); err != nil {
+			return err
+		}
+		fmt.Printf("Updated packnplay to %s\n", release.Tag)
+		return nil
+	},
+}
+
+// notifySelfUpdate prints a one-line notice when a newer release is out on the
+// configured channel. It checks at most once per check_frequency_hours and is
+// off when update checks are disabled, so a slow or offline network costs at
+// most selfUpdateNoticeTimeout once a day.
+func notifySelfUpdate(cfg *config.Config) {
+	if version == "dev" || quietMode || cfg.SelfUpdate.DisableNotice || selfupdate.ValidChannel(cfg.SelfUpdate.Channel) != nil {
+		return
+	}
+
+	trackingPath := config.GetVersionTrackingPath()
+	tracking, err := config.LoadVersionTracking(trackingPath)
+	if err != nil || !config.ShouldCheckForUpdates(cfg.DefaultContainer, tracking.SelfUpdateCheck) {
+		return
+	}
+
+	release, err := selfupdate.NewClient(selfUpdateNoticeTimeout).Latest(cfg.SelfUpdate.Channel)
+	tracking.SelfUpdateCheck = time.Now()
+	_ = config.SaveVersionTracking(tracking, trackingPath)
+	if err != nil {
+		return
+	}
+
+	if selfupdate.IsNewer(version, release.Tag) {
+		fmt.Fprintf(os.Stderr, "packnplay %s is available (you have %s); run: packnplay self-update\n", release.Tag, version)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.Flags().StringVar(&selfUpdateChannel, "channel", "", "Release channel: stable or beta (default from config, else stable)")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateCheck, "check", false, "Only report whether an update is available")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateForce, "force", false, "Install the latest release over a development build")
+}
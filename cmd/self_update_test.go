@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+)
+
+func TestNotifySelfUpdateRespectsUpdateChecks(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	origVersion := version
+	version = "v1.2.3"
+	defer func() { version = origVersion }()
+
+	// Neither disabled update checks nor a disabled notice may reach the network
+	// or record a check
+	for _, cfg := range []*config.Config{
+		{DefaultContainer: config.DefaultContainerConfig{CheckForUpdates: false}},
+		{DefaultContainer: config.GetDefaultContainerConfig(), SelfUpdate: config.SelfUpdateConfig{DisableNotice: true}},
+		{DefaultContainer: config.GetDefaultContainerConfig(), SelfUpdate: config.SelfUpdateConfig{Channel: "nightly"}},
+	} {
+		notifySelfUpdate(cfg)
+		if _, err := os.Stat(config.GetVersionTrackingPath()); !os.IsNotExist(err) {
+			t.Fatalf("notifySelfUpdate(%+v) recorded a release check", cfg.SelfUpdate)
+		}
+	}
+}
+
+func TestSelfUpdateRejectsUnknownChannel(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	selfUpdateChannel = "nightly"
+	defer func() { selfUpdateChannel = "" }()
+
+	if err := selfUpdateCmd.RunE(selfUpdateCmd, nil); err == nil {
+		t.Error("self-update should reject an unknown channel")
+	}
+}
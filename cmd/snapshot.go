@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/obra/packnplay/pkg/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotContainer string
+	snapshotPath      string
+	snapshotWorktree  string
+	snapshotWorkspace bool
+	snapshotReplace   bool
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Checkpoint and restore containers",
+	Long: `Commit a container's filesystem to a local image before letting an agent loose,
+and restore it into a new container later to get back to a known state or to
+reproduce agent-induced breakage.`,
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Snapshot a running container",
+	Long: `Commit the container's filesystem (and its lifecycle metadata) to a local image.
+With --workspace, modified and untracked files in the host workspace are archived too.
+The name defaults to a timestamp.
+
+Credentials packnplay copied into the container (gh's hosts.yml and files
+injected with default_credentials.inject copy) are set aside while committing,
+so they stay out of the image. Mounted credentials are never part of it.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerClient, err := snapshotDockerClient()
+		if err != nil {
+			return err
+		}
+		containerName, err := resolveContainerName(snapshotContainer, snapshotPath, snapshotWorktree)
+		if err != nil {
+			return err
+		}
+
+		name := snapshot.DefaultName(time.Now())
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		// Credentials copied into the container would be baked into the image
+		credentials, err := runner.InjectedCredentialFiles(dockerClient, containerName)
+		if err != nil {
+			return err
+		}
+
+		store := snapshot.NewStore(snapshot.DefaultDir(), dockerClient)
+		snap, err := store.Create(containerName, name, snapshot.CreateOptions{
+			Workspace: snapshotWorkspace,
+			Metadata:  containerMetadata(dockerClient, containerName),
+			Exclude:   credentials,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created snapshot %s of %s (%s)\n", snap.Name, containerName, snap.Image)
+		if snapshotWorkspace {
+			fmt.Printf("Archived %d workspace file(s)\n", len(snap.Workspace))
+		}
+		return nil
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		containerName := snapshotContainer
+		if containerName == "" && snapshotWorktree != "" {
+			var err error
+			if containerName, err = resolveContainerName("", snapshotPath, snapshotWorktree); err != nil {
+				return err
+			}
+		}
+
+		snapshots, err := snapshot.NewStore(snapshot.DefaultDir(), nil).List(containerName)
+		if err != nil {
+			return fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tCONTAINER\tCREATED\tWORKSPACE FILES")
+		for _, snap := range snapshots {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", snap.Name, snap.Container, snap.Created.Format("2006-01-02 15:04:05"), len(snap.Workspace))
+		}
+		return w.Flush()
+	},
+}
+
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <name>",
+	Short: "Restore a snapshot into a new container",
+	Long: `Start a new container from a snapshot image with the original mounts.
+By default the container is named <container>-<name>; with --replace the original
+container is stopped and removed and the restored one takes its name, so
+'packnplay run --reconnect' picks it up. With --workspace, archived workspace files
+are written back to the host workspace, overwriting local changes.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerClient, err := snapshotDockerClient()
+		if err != nil {
+			return err
+		}
+		store := snapshot.NewStore(snapshot.DefaultDir(), dockerClient)
+		snap, err := findSnapshot(store, args[0])
+		if err != nil {
+			return err
+		}
+
+		containerName := fmt.Sprintf("%s-%s", snap.Container, snap.Name)
+		if snapshotReplace {
+			if exists, _ := dockerClient.Run("ps", "-aq", "--filter", fmt.Sprintf("name=^%s$", snap.Container)); strings.TrimSpace(exists) != "" {
+				if err := stopContainer(dockerClient, snap.Container); err != nil {
+					return err
+				}
+			}
+			containerName = snap.Container
+		}
+
+		containerID, err := store.Restore(snap, snapshot.RestoreOptions{
+			ContainerName: containerName,
+			Workspace:     snapshotWorkspace,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Carry lifecycle state over so onCreate/postCreate don't run again
+		if data, err := store.Metadata(snap); err == nil && len(data) > 0 {
+			var metadata runner.ContainerMetadata
+			if err := json.Unmarshal(data, &metadata); err == nil {
+				metadata.ContainerID = containerID
+				if err := runner.SaveMetadata(&metadata); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to restore lifecycle metadata: %v\n", err)
+				}
+			}
+		}
+
+		fmt.Printf("Restored snapshot %s into container %s\n", snap.Name, containerName)
+		if snapshotWorkspace && len(snap.Workspace) > 0 {
+			fmt.Printf("Restored %d workspace file(s) into %s\n", len(snap.Workspace), snap.HostPath)
+		}
+		fmt.Printf("Connect with: %s exec -it %s /bin/bash\n", dockerClient.Command(), containerName)
+		return nil
+	},
+}
+
+var snapshotRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Delete a snapshot and its image",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dockerClient, err := snapshotDockerClient()
+		if err != nil {
+			return err
+		}
+		store := snapshot.NewStore(snapshot.DefaultDir(), dockerClient)
+		snap, err := findSnapshot(store, args[0])
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(snap); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted snapshot %s of %s\n", snap.Name, snap.Container)
+		return nil
+	},
+}
+
+func snapshotDockerClient() (*docker.Client, error) {
+	dockerClient, err := docker.NewClient(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize docker: %w", err)
+	}
+	if dockerClient.Command() == "container" {
+		return nil, fmt.Errorf("snapshots are not supported with Apple Container")
+	}
+	return dockerClient, nil
+}
+
+// resolveContainerName returns name if set, otherwise the container for path and worktree
+func resolveContainerName(name, path, worktree string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	if worktree == "" {
+		return "", fmt.Errorf("--container or --worktree flag is required")
+	}
+
+	if path == "" {
+		var err error
+		if path, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	return container.GenerateContainerName(path, worktree), nil
+}
+
+// findSnapshot looks a snapshot up, scoped to --container/--worktree when given
+func findSnapshot(store *snapshot.Store, name string) (*snapshot.Snapshot, error) {
+	if snapshotContainer == "" && snapshotWorktree == "" {
+		return store.Find(name)
+	}
+	containerName, err := resolveContainerName(snapshotContainer, snapshotPath, snapshotWorktree)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(containerName, name)
+}
+
+// containerMetadata returns the raw lifecycle metadata recorded for a container, if any
+func containerMetadata(dockerClient *docker.Client, containerName string) []byte {
+	id, err := dockerClient.Run("inspect", "--type", "container", "--format", "{{.Id}}", containerName)
+	if err != nil {
+		return nil
+	}
+	path, err := runner.GetMetadataPath(strings.TrimSpace(id))
+	if err != nil {
+		return nil
+	}
+	data, _ := os.ReadFile(path)
+	return data
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+	snapshotCmd.AddCommand(snapshotRmCmd)
+
+	snapshotCmd.PersistentFlags().StringVar(&snapshotContainer, "container", "", "Container name")
+	snapshotCmd.PersistentFlags().StringVar(&snapshotPath, "path", "", "Project path (default: pwd)")
+	snapshotCmd.PersistentFlags().StringVar(&snapshotWorktree, "worktree", "", "Worktree name")
+
+	snapshotCreateCmd.Flags().BoolVar(&snapshotWorkspace, "workspace", false, "Also archive modified and untracked workspace files")
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotWorkspace, "workspace", false, "Write archived workspace files back to the host workspace")
+	snapshotRestoreCmd.Flags().BoolVar(&snapshotReplace, "replace", false, "Replace the original container instead of creating a new one")
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/obra/packnplay/pkg/stats"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsProject string
+	statsSince   string
+	statsJSON    bool
+	statsClear   bool
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize local container startup timings",
+	Long: `Summarize image pull, build, feature install, and lifecycle timings recorded
+by previous runs. Statistics are stored locally in $XDG_STATE_HOME/packnplay/stats.jsonl
+and are never sent anywhere.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := stats.DefaultPath()
+
+		if statsClear {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to clear stats: %w", err)
+			}
+			fmt.Println("Cleared usage statistics")
+			return nil
+		}
+
+		var since time.Time
+		if statsSince != "" {
+			window, err := parseDayDuration("since", statsSince)
+			if err != nil {
+				return err
+			}
+			since = time.Now().Add(-window)
+		}
+
+		events, err := stats.Load(path)
+		if err != nil {
+			return err
+		}
+
+		if statsProject != "" {
+			project, err := filepath.Abs(statsProject)
+			if err != nil {
+				return fmt.Errorf("failed to resolve project path: %w", err)
+			}
+			if resolved, err := filepath.EvalSymlinks(project); err == nil {
+				project = resolved
+			}
+			var filtered []stats.Event
+			for _, event := range events {
+				if event.Project == project {
+					filtered = append(filtered, event)
+				}
+			}
+			events = filtered
+		}
+
+		summaries := stats.Summarize(events, since)
+
+		if statsJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(summaries)
+		}
+
+		if len(summaries) == 0 {
+			fmt.Println("No statistics recorded yet")
+			return nil
+		}
+		printStats(os.Stdout, summaries)
+		return nil
+	},
+}
+
+// parseDayDuration parses the value of flag, a Go duration with an additional
+// "d" (days) unit
+func parseDayDuration(flag, value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid --%s value %q", flag, value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s value %q: %w", flag, value, err)
+	}
+	return d, nil
+}
+
+// printStats renders one table per project
+func printStats(out io.Writer, summaries []stats.ProjectSummary) {
+	for i, summary := range summaries {
+		if i > 0 {
+			_, _ = fmt.Fprintln(out)
+		}
+		_, _ = fmt.Fprintf(out, "%s (%d runs)\n", summary.Project, summary.Runs)
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "  PHASE\tCOUNT\tCACHE HITS\tAVG\tMEDIAN\tMAX\tLAST")
+		for _, phase := range summary.Phases {
+			hits := "-"
+			if phase.CacheHits > 0 {
+				hits = fmt.Sprintf("%d (%.0f%%)", phase.CacheHits, phase.HitRate()*100)
+			}
+			_, _ = fmt.Fprintf(w, "  %s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				phase.Phase,
+				phase.Count,
+				hits,
+				formatStatDuration(phase.Average),
+				formatStatDuration(phase.Median),
+				formatStatDuration(phase.Max),
+				phase.Last.Local().Format("2006-01-02 15:04"),
+			)
+		}
+		_ = w.Flush()
+	}
+}
+
+// formatStatDuration renders durations compactly, "-" when nothing was measured
+func formatStatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVar(&statsProject, "project", "", "Only show statistics for this project directory")
+	statsCmd.Flags().StringVar(&statsSince, "since", "", "Only include runs within this window (e.g. 24h, 7d)")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Output summaries as JSON")
+	statsCmd.Flags().BoolVar(&statsClear, "clear", false, "Delete all recorded statistics")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/stats"
+)
+
+func TestParseDayDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"24h": 24 * time.Hour,
+		"90m": 90 * time.Minute,
+	}
+	for input, want := range tests {
+		got, err := parseDayDuration("since", input)
+		if err != nil || got != want {
+			t.Errorf("parseDayDuration(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"xd", "-1d", "soon"} {
+		if _, err := parseDayDuration("since", input); err == nil {
+			t.Errorf("parseDayDuration(%q) expected error", input)
+		}
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	summaries := []stats.ProjectSummary{{
+		Project: "/src/app",
+		Runs:    3,
+		Phases: []stats.PhaseSummary{
+			{Phase: stats.PhaseImagePull, Count: 4, CacheHits: 3, Average: 12 * time.Second, Median: 12 * time.Second, Max: 12 * time.Second},
+			{Phase: stats.LifecyclePhase("postCreate"), Count: 1, Average: 450 * time.Millisecond, Median: 450 * time.Millisecond, Max: 450 * time.Millisecond},
+		},
+	}}
+
+	var buf bytes.Buffer
+	printStats(&buf, summaries)
+	out := buf.String()
+
+	for _, want := range []string{"/src/app (3 runs)", "image_pull", "3 (75%)", "12s", "lifecycle:postCreate", "450ms"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printStats() output missing %q:\n%s", want, out)
+		}
+	}
+}
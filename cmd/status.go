@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statusPath       string
+	statusWorktree   string
+	statusNoWorktree bool
+	statusRuntime    string
+	statusJSON       bool
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Show the state of the current worktree's container",
+	Long: `Show whether the container of the current worktree (or --worktree) exists
+and is running, the image it was created from, when each lifecycle command last
+ran, its published ports, the settings changed since it was created, and how to
+attach to it. Nothing is created, pulled, or built.
+
+Changed settings are those a 'packnplay run' without flags would report; a
+remoteUser detected from the built image isn't compared.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadExistingOrEmpty(config.GetConfigPath())
+		if err != nil {
+			return errdefs.Errorf(errdefs.CategoryConfig, "failed to load config: %w", err)
+		}
+		if err := applyConfigProfile(cfg, ""); err != nil {
+			return err
+		}
+		runConfig := statusRunConfig(cfg)
+		if statusRuntime != "" {
+			runConfig.Runtime = statusRuntime
+		}
+
+		status, err := runner.Status(runConfig)
+		if err != nil {
+			return err
+		}
+		if statusJSON {
+			data, err := json.MarshalIndent(status, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode status: %w", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		printStatus(os.Stdout, status, time.Now())
+		return nil
+	},
+}
+
+// statusRunConfig is the run configuration status compares a container with:
+// a run without flags
+func statusRunConfig(cfg *config.Config) *runner.RunConfig {
+	creds := cfg.DefaultCredentials
+	// SSH agent takes precedence over SSH key mounting, as in run
+	if creds.SSH && creds.SSHAgent {
+		creds.SSH = false
+	}
+	return &runner.RunConfig{
+		Path:               statusPath,
+		Worktree:           statusWorktree,
+		NoWorktree:         statusNoWorktree,
+		Runtime:            cfg.ContainerRuntime,
+		DefaultImage:       cfg.GetDefaultImage(),
+		Credentials:        creds,
+		DefaultEnvVars:     cfg.DefaultEnvVars,
+		MountRelabel:       cfg.Security.MountRelabel,
+		DisableLabels:      cfg.Security.DisableLabels,
+		AppArmorProfile:    cfg.Security.AppArmorProfile,
+		MountExcludes:      cfg.MountExcludes,
+		Shell:              cfg.Shell,
+		Proxy:              cfg.Proxy,
+		DevcontainerSearch: cfg.DevcontainerSearch,
+		WorktreeSettings:   cfg.Worktree,
+		Registry:           cfg.Registry,
+	}
+}
+
+// printStatus writes a container status for people
+func printStatus(w io.Writer, status *runner.ProjectStatus, now time.Time) {
+	ws := status.Workspace
+	fmt.Fprintf(w, "Project:    %s (worktree %s)\n", ws.WorkDir, ws.WorktreeName)
+	if status.ConfigFile == "" {
+		fmt.Fprintf(w, "Config:     none; using the default image\n")
+	} else {
+		fmt.Fprintf(w, "Config:     %s\n", projectRelative(status.ConfigFile, ws.MountPath, ws.WorkDir))
+	}
+	if !status.Exists {
+		fmt.Fprintf(w, "Container:  none; packnplay run creates %s\n", status.ContainerName)
+		return
+	}
+
+	state := status.State
+	if status.Running() {
+		state += " since " + formatLastUsed(status.StartedAt, now)
+	}
+	fmt.Fprintf(w, "Container:  %s, %s (created %s)\n", status.ContainerName, state, formatLastUsed(status.Created, now))
+	image := status.Image
+	if !status.ImageCreated.IsZero() {
+		image += fmt.Sprintf(" (built %s)", formatLastUsed(status.ImageCreated, now))
+	}
+	fmt.Fprintf(w, "Image:      %s\n", image)
+
+	if status.Incomplete {
+		fmt.Fprintf(w, "Setup:      interrupted; packnplay run finishes it\n")
+	}
+	if len(status.Lifecycle) == 0 {
+		fmt.Fprintf(w, "Lifecycle:  no commands ran\n")
+	} else {
+		fmt.Fprintf(w, "Lifecycle:\n")
+		for _, phase := range status.Lifecycle {
+			if !phase.Failed.IsZero() {
+				fmt.Fprintf(w, "  %-14s failed %s: %s\n", phase.Phase, formatLastUsed(phase.Failed, now), phase.Error)
+				continue
+			}
+			fmt.Fprintf(w, "  %-14s ran %s\n", phase.Phase, formatLastUsed(phase.Ran, now))
+		}
+	}
+
+	if len(status.Ports) > 0 {
+		fmt.Fprintf(w, "Ports:\n")
+		for _, port := range status.Ports {
+			fmt.Fprintf(w, "  %s -> %s:%s\n", port.ContainerPort, port.HostIP, port.HostPort)
+		}
+	}
+
+	switch {
+	case !status.DriftChecked:
+		fmt.Fprintf(w, "Drift:      unknown (the container recorded no settings)\n")
+	case len(status.Drift) == 0:
+		fmt.Fprintf(w, "Drift:      none\n")
+	default:
+		fmt.Fprintf(w, "Drift:      %s changed; to recreate: packnplay stop %s\n", strings.Join(status.Drift, ", "), status.ContainerName)
+	}
+
+	if status.AttachCommand != "" {
+		fmt.Fprintf(w, "Attach:     %s\n", status.AttachCommand)
+	} else {
+		fmt.Fprintf(w, "Attach:     not running; packnplay run starts it again\n")
+	}
+}
+
+// projectRelative returns path relative to the first of dirs it is in, or
+// path itself when it is in none of them
+func projectRelative(path string, dirs ...string) string {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel
+		}
+	}
+	return path
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVar(&statusPath, "path", "", "Project path (default: pwd)")
+	statusCmd.Flags().StringVar(&statusWorktree, "worktree", "", "Worktree name (default: the current branch)")
+	statusCmd.Flags().BoolVar(&statusNoWorktree, "no-worktree", false, "Show the container of the directory itself, not a worktree")
+	statusCmd.Flags().StringVar(&statusRuntime, "runtime", "", "Container runtime to use (docker/podman/nerdctl/lima/container)")
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the status as JSON")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/runner"
+)
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	ws := runner.Workspace{WorkDir: "/home/me/app", WorktreeName: "main"}
+
+	var buf bytes.Buffer
+	printStatus(&buf, &runner.ProjectStatus{Workspace: ws, ContainerName: "packnplay-app-main"}, now)
+	if !strings.Contains(buf.String(), "none; packnplay run creates packnplay-app-main") || !strings.Contains(buf.String(), "Config:     none; using the default image") {
+		t.Errorf("printStatus() without a container:\n%s", buf.String())
+	}
+
+	status := &runner.ProjectStatus{
+		Workspace:     ws,
+		ConfigFile:    "/home/me/app/.devcontainer/python/devcontainer.json",
+		ContainerName: "packnplay-app-main",
+		Exists:        true,
+		State:         "running",
+		Created:       now.Add(-72 * time.Hour),
+		StartedAt:     now.Add(-2 * time.Hour),
+		Image:         "packnplay-app-devcontainer:latest",
+		ImageCreated:  now.Add(-96 * time.Hour),
+		Incomplete:    true,
+		Lifecycle: []runner.PhaseStatus{
+			{Phase: "onCreate", Ran: now.Add(-72 * time.Hour)},
+			{Phase: "postCreate", Failed: now.Add(-72 * time.Hour), Error: "exit status 1"},
+		},
+		Ports:         []runner.PortBinding{{ContainerPort: "3000/tcp", HostIP: "127.0.0.1", HostPort: "3000"}},
+		DriftChecked:  true,
+		Drift:         []string{"containerEnv", "image"},
+		AttachCommand: "packnplay attach --name=packnplay-app-main",
+	}
+	buf.Reset()
+	printStatus(&buf, status, now)
+	out := buf.String()
+	for _, want := range []string{
+		"Config:     .devcontainer/python/devcontainer.json",
+		"packnplay-app-main, running since 2h ago (created 3d ago)",
+		"packnplay-app-devcontainer:latest (built 4d ago)",
+		"Setup:      interrupted; packnplay run finishes it",
+		"onCreate       ran 3d ago",
+		"postCreate     failed 3d ago: exit status 1",
+		"3000/tcp -> 127.0.0.1:3000",
+		"containerEnv, image changed; to recreate: packnplay stop packnplay-app-main",
+		"Attach:     packnplay attach --name=packnplay-app-main",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printStatus() missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestStatusRunConfigPrefersSSHAgent(t *testing.T) {
+	cfg := &config.Config{DefaultCredentials: config.Credentials{SSH: true, SSHAgent: true}}
+	if creds := statusRunConfig(cfg).Credentials; creds.SSH || !creds.SSHAgent {
+		t.Errorf("credentials = %+v, want the SSH agent as run uses it", creds)
+	}
+}
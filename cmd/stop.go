@@ -7,8 +7,11 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/obra/packnplay/pkg/audit"
 	"github.com/obra/packnplay/pkg/container"
 	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/hooks"
+	"github.com/obra/packnplay/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
@@ -72,17 +75,51 @@ var stopCmd = &cobra.Command{
 
 func stopContainer(dockerClient *docker.Client, containerName string) error {
 	fmt.Printf("Stopping container %s...\n", containerName)
+
+	// Give the project a chance to clean up (customizations.packnplay.preStopCommand)
+	if err := runner.RunPreStop(dockerClient, containerName, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	// Remove copy-injected credentials before the container goes away
+	if err := runner.ScrubInjectedCredentials(dockerClient, containerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	// Read hooks off the container before it's removed
+	containerHooks, hookPayload, hookErr := runner.LoadContainerHooks(dockerClient, containerName)
+	projectNetwork := runner.ContainerProjectNetwork(dockerClient, containerName)
+
 	_, err := dockerClient.Run("stop", containerName)
 	if err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
+	runner.RecordAudit(audit.Event{Type: audit.TypeStop, Container: containerName})
 
 	_, err = dockerClient.Run("rm", containerName)
 	if err != nil {
 		return fmt.Errorf("failed to remove container: %w", err)
 	}
+	runner.RecordAudit(audit.Event{Type: audit.TypeRemove, Container: containerName})
+
+	// Sidecar services live and die with their container
+	if err := runner.RemoveSidecars(dockerClient, containerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	// The project network goes with the project's last container
+	if err := runner.ReleaseProjectNetwork(dockerClient, projectNetwork); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
 
 	fmt.Printf("Container %s stopped and removed\n", containerName)
+
+	if hookErr == nil {
+		hookErr = containerHooks.Run(hooks.PostStop, hookPayload, false)
+	}
+	if hookErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", hookErr)
+	}
 	return nil
 }
 
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	templatePath     string
+	templateOptions  []string
+	templateOmitPath []string
+	templateForce    bool
+)
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Work with devcontainer Templates",
+}
+
+var templateApplyCmd = &cobra.Command{
+	Use:   "apply <template-ref>",
+	Short: "Materialize a devcontainer Template into a project",
+	Long: `Download a devcontainer Template (e.g. ghcr.io/devcontainers/templates/go:4)
+or use a local template directory, substitute its options, and write its files
+into the project. Existing files are never overwritten unless --force is given.`,
+	Example: `  packnplay template apply ghcr.io/devcontainers/templates/go:4
+  packnplay template apply ghcr.io/devcontainers/templates/python:4 --option imageVariant=3.12-bookworm
+  packnplay template apply ./my-template --path ../new-repo`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projectDir := templatePath
+		if projectDir == "" {
+			var err error
+			projectDir, err = os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get working directory: %w", err)
+			}
+		}
+
+		userOptions, err := parseTemplateOptions(templateOptions)
+		if err != nil {
+			return err
+		}
+
+		tempDir, err := os.MkdirTemp("", "packnplay-template-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temp dir: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		templateDir, err := devcontainer.FetchTemplate(args[0], filepath.Join(tempDir, "template"))
+		if err != nil {
+			return err
+		}
+
+		metadata, err := devcontainer.LoadTemplateMetadata(templateDir)
+		if err != nil {
+			return err
+		}
+
+		resolved, err := metadata.ResolveOptions(userOptions)
+		if err != nil {
+			return err
+		}
+
+		if err := checkOptionalPaths(templateOmitPath, metadata.OptionalPaths); err != nil {
+			return err
+		}
+
+		written, err := devcontainer.ApplyTemplate(templateDir, projectDir, devcontainer.ApplyTemplateOptions{
+			Options:   resolved,
+			OmitPaths: templateOmitPath,
+			Force:     templateForce,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Applied template %s (%s) to %s\n", metadata.Name, metadata.Version, projectDir)
+		for _, path := range written {
+			fmt.Printf("  %s\n", path)
+		}
+		return nil
+	},
+}
+
+// parseTemplateOptions parses repeated --option key=value flags
+func parseTemplateOptions(values []string) (map[string]string, error) {
+	options := make(map[string]string)
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --option %q (expected key=value)", value)
+		}
+		options[key] = val
+	}
+	return options, nil
+}
+
+// checkOptionalPaths rejects --omit-path values the template doesn't mark optional
+func checkOptionalPaths(omit, optional []string) error {
+	allowed := make(map[string]bool)
+	for _, p := range optional {
+		allowed[p] = true
+	}
+	for _, p := range omit {
+		if !allowed[p] {
+			return fmt.Errorf("%q is not an optional path of this template (optional: %s)", p, strings.Join(optional, ", "))
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateApplyCmd)
+
+	templateApplyCmd.Flags().StringVar(&templatePath, "path", "", "Project directory to apply the template to (default: current directory)")
+	templateApplyCmd.Flags().StringArrayVar(&templateOptions, "option", nil, "Template option as key=value (repeatable)")
+	templateApplyCmd.Flags().StringArrayVar(&templateOmitPath, "omit-path", nil, "Leave out one of the template's optionalPaths (repeatable)")
+	templateApplyCmd.Flags().BoolVar(&templateForce, "force", false, "Overwrite existing files")
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import "testing"
+
+func TestParseTemplateOptions(t *testing.T) {
+	options, err := parseTemplateOptions([]string{"imageVariant=3.12", "extra=a=b"})
+	if err != nil {
+		t.Fatalf("parseTemplateOptions() error = %v", err)
+	}
+	if options["imageVariant"] != "3.12" || options["extra"] != "a=b" {
+		t.Errorf("parseTemplateOptions() = %v", options)
+	}
+
+	for _, bad := range []string{"novalue", "=x"} {
+		if _, err := parseTemplateOptions([]string{bad}); err == nil {
+			t.Errorf("parseTemplateOptions(%q) expected error", bad)
+		}
+	}
+}
+
+func TestCheckOptionalPaths(t *testing.T) {
+	optional := []string{".github/*"}
+	if err := checkOptionalPaths([]string{".github/*"}, optional); err != nil {
+		t.Errorf("checkOptionalPaths() error = %v", err)
+	}
+	if err := checkOptionalPaths([]string{".devcontainer"}, optional); err == nil {
+		t.Error("checkOptionalPaths() allowed a non-optional path")
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	topInterval time.Duration
+	topNoStream bool
+)
+
+var topCmd = &cobra.Command{
+	Use:   "top <container_name>",
+	Short: "Show a container's processes and resource usage",
+	Long: `Show the processes running in a container along with its CPU, memory, and
+block I/O usage, refreshed every --interval until interrupted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if topInterval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+		if topNoStream {
+			return printTop(os.Stdout, dockerClient, args[0])
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return streamTop(ctx, os.Stdout, dockerClient, args[0], topInterval, isatty.IsTerminal(os.Stdout.Fd()))
+	},
+}
+
+// printTop writes a container's resource usage, when the runtime reports it,
+// followed by its process table
+func printTop(w io.Writer, r docker.Runner, name string) error {
+	backend := docker.BackendFor(r)
+	processes, err := backend.Top(r, name)
+	if err != nil {
+		return err
+	}
+	if stats, err := backend.Stats(r, name); err == nil && len(stats) == 1 {
+		s := stats[0]
+		fmt.Fprintf(w, "%s   CPU %s   MEM %s (%s)   BLOCK I/O %s   PIDS %s\n\n", name, s.CPUPerc, s.MemUsage, s.MemPerc, s.BlockIO, s.PIDs)
+	}
+	_, err = io.WriteString(w, processes)
+	return err
+}
+
+// streamTop prints a container's processes every interval until ctx is done
+// or the container stops, redrawing the terminal, or separating the snapshots
+// with a blank line when w isn't one
+func streamTop(ctx context.Context, w io.Writer, r docker.Runner, name string, interval time.Duration, redraw bool) error {
+	for first := true; ; first = false {
+		// Taken before clearing the screen, so it never flickers empty
+		var frame bytes.Buffer
+		if err := printTop(&frame, r, name); err != nil {
+			return err
+		}
+		if redraw {
+			fmt.Fprint(w, "\033[H\033[2J")
+		} else if !first {
+			fmt.Fprintln(w)
+		}
+		if _, err := w.Write(frame.Bytes()); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+	topCmd.Flags().DurationVar(&topInterval, "interval", 2*time.Second, "How often to refresh")
+	topCmd.Flags().BoolVar(&topNoStream, "no-stream", false, "Print the processes once and exit")
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+// fakeUsage answers top and stats for packnplay-app-main
+func fakeUsage() *dockertest.FakeClient {
+	fake := dockertest.New()
+	fake.On(func([]string) (string, error) {
+		return "UID   PID   PPID   CMD\nroot  4242  4221   claude --dangerously-skip-permissions\n", nil
+	}, "top", "packnplay-app-main")
+	fake.On(func([]string) (string, error) {
+		return `{"BlockIO":"1.2MB / 0B","CPUPerc":"97.10%","ID":"abc123","MemPerc":"6.58%","MemUsage":"512MiB / 7.6GiB","Name":"packnplay-app-main","NetIO":"1kB / 2kB","PIDs":"7"}` + "\n", nil
+	}, "stats")
+	return fake
+}
+
+func TestPrintTop(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printTop(&buf, fakeUsage(), "packnplay-app-main"); err != nil {
+		t.Fatalf("printTop() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"packnplay-app-main   CPU 97.10%   MEM 512MiB / 7.6GiB (6.58%)   BLOCK I/O 1.2MB / 0B   PIDS 7",
+		"root  4242  4221   claude --dangerously-skip-permissions",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printTop() missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestStreamTopRefreshesUntilDone(t *testing.T) {
+	fake := fakeUsage()
+	ctx, cancel := context.WithCancel(context.Background())
+	frames := 0
+	fake.On(func([]string) (string, error) {
+		if frames++; frames == 3 {
+			cancel()
+		}
+		return "UID   PID   CMD\n", nil
+	}, "top", "packnplay-app-main")
+
+	var buf bytes.Buffer
+	if err := streamTop(ctx, &buf, fake, "packnplay-app-main", time.Millisecond, true); err != nil {
+		t.Fatalf("streamTop() error = %v", err)
+	}
+	if n := strings.Count(buf.String(), "\033[H\033[2J"); n != 3 {
+		t.Errorf("streamTop() drew %d frames, want 3", n)
+	}
+}
+
+func TestStreamTopStopsWithContainer(t *testing.T) {
+	fake := fakeUsage()
+	fake.Fail(errors.New("exit status 1"), "Error response from daemon: container abc123 is not running", "top")
+
+	err := streamTop(context.Background(), &bytes.Buffer{}, fake, "packnplay-app-main", time.Millisecond, false)
+	if err == nil || !strings.Contains(err.Error(), "is not running") {
+		t.Errorf("streamTop() error = %v, want the runtime's complaint", err)
+	}
+}
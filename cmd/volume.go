@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var volumeRmAll bool
+
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage workspace volumes created by run --clone-in-volume",
+	Long: `List and remove the named volumes that 'packnplay run --clone-in-volume'
+clones repositories into. A volume outlives its container, so running again
+reuses the clone; remove it once the work in it is pushed.`,
+}
+
+var volumeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List workspace volumes",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printVolumes(os.Stdout, container.LoadVolumes(container.VolumesPath()))
+	},
+}
+
+var volumeRmCmd = &cobra.Command{
+	Use:   "rm <volume|container>...",
+	Short: "Remove workspace volumes and the clones in them",
+	Long: `Remove workspace volumes, discarding anything in them that wasn't pushed.
+A volume can be named by itself or by its container. Stop the container first
+with 'packnplay stop'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if volumeRmAll == (len(args) > 0) {
+			return fmt.Errorf("specify volumes to remove or --all")
+		}
+
+		dockerClient, err := docker.NewClient(false)
+		if err != nil {
+			return fmt.Errorf("failed to initialize docker: %w", err)
+		}
+		if backend := docker.BackendFor(dockerClient); !backend.Capabilities().NamedVolumes {
+			return fmt.Errorf("workspace volumes are not supported with %s: it has no named volumes", backend.Name())
+		}
+
+		volumes := container.LoadVolumes(container.VolumesPath())
+		var names []string
+		if volumeRmAll {
+			for name := range volumes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		} else {
+			for _, arg := range args {
+				name, ok := findVolume(volumes, arg)
+				if !ok {
+					return fmt.Errorf("no workspace volume named %s (see: packnplay volume list)", arg)
+				}
+				names = append(names, name)
+			}
+		}
+
+		for _, name := range names {
+			if err := removeVolume(dockerClient, name); err != nil {
+				return err
+			}
+			fmt.Printf("Removed volume %s\n", name)
+		}
+		return nil
+	},
+}
+
+// printVolumes writes the tracked workspace volumes as a table
+func printVolumes(w io.Writer, volumes map[string]container.WorkspaceVolume) error {
+	if len(volumes) == 0 {
+		_, err := fmt.Fprintln(w, "No workspace volumes")
+		return err
+	}
+
+	names := make([]string, 0, len(volumes))
+	for name := range volumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "VOLUME\tCONTAINER\tREF\tCLONED FROM\tLAST USED")
+	for _, name := range names {
+		volume := volumes[name]
+		ref := volume.Ref
+		if ref == "" {
+			ref = "(default)"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", name, volume.Container, ref, volume.CloneURL, volume.LastUsed.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+// findVolume returns the tracked volume named arg, or mounted in container arg
+func findVolume(volumes map[string]container.WorkspaceVolume, arg string) (string, bool) {
+	if _, ok := volumes[arg]; ok {
+		return arg, true
+	}
+	for name, volume := range volumes {
+		if volume.Container == arg {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// removeVolume removes a workspace volume from the runtime and stops tracking it.
+// A volume already gone from the runtime is only forgotten.
+func removeVolume(dockerClient *docker.Client, name string) error {
+	if users, err := dockerClient.Run("ps", "-aq", "--filter", "volume="+name); err == nil && strings.TrimSpace(users) != "" {
+		return fmt.Errorf("volume %s is still used by a container; stop it first with: packnplay stop %s", name, container.LoadVolumes(container.VolumesPath())[name].Container)
+	}
+	if output, err := dockerClient.Run("volume", "rm", name); err != nil && !strings.Contains(strings.ToLower(output), "no such volume") {
+		return fmt.Errorf("failed to remove volume %s: %w\n%s", name, err, output)
+	}
+	return container.ForgetVolume(container.VolumesPath(), name)
+}
+
+func init() {
+	rootCmd.AddCommand(volumeCmd)
+	volumeCmd.AddCommand(volumeListCmd)
+	volumeCmd.AddCommand(volumeRmCmd)
+	volumeRmCmd.Flags().BoolVar(&volumeRmAll, "all", false, "Remove all workspace volumes")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+)
+
+func TestPrintVolumes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printVolumes(&buf, nil); err != nil || !strings.Contains(buf.String(), "No workspace volumes") {
+		t.Errorf("printVolumes(nil) = %q, %v", buf.String(), err)
+	}
+
+	used := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	volumes := map[string]container.WorkspaceVolume{
+		"packnplay-app-volume-workspace":      {Name: "packnplay-app-volume-workspace", Container: "packnplay-app-volume", CloneURL: "git@github.com:me/app.git", LastUsed: used},
+		"packnplay-app-volume-main-workspace": {Name: "packnplay-app-volume-main-workspace", Container: "packnplay-app-volume-main", Ref: "main", CloneURL: "git@github.com:me/app.git", LastUsed: used},
+	}
+	buf.Reset()
+	if err := printVolumes(&buf, volumes); err != nil {
+		t.Fatalf("printVolumes() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "packnplay-app-volume-main-workspace") || !strings.Contains(lines[1], " main ") || !strings.Contains(lines[2], "(default)") {
+		t.Errorf("printVolumes() =\n%s", buf.String())
+	}
+
+	if name, ok := findVolume(volumes, "packnplay-app-volume-main"); !ok || name != "packnplay-app-volume-main-workspace" {
+		t.Errorf("findVolume(container) = %q, %v", name, ok)
+	}
+	if _, ok := findVolume(volumes, "other"); ok {
+		t.Error("findVolume() should not find an untracked volume")
+	}
+}
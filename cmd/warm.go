@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/runner"
+	"github.com/spf13/cobra"
+)
+
+var (
+	warmJobs    int
+	warmRuntime string
+	warmMissing bool
+	warmRebuild bool
+	warmVerbose bool
+)
+
+var warmCmd = &cobra.Command{
+	Use:   "warm [path...]",
+	Short: "Pull and build projects' images ahead of time",
+	Long: `Resolve the devcontainer configuration of each project (default: the current
+directory) and pull or build everything its container needs: the base image,
+the Dockerfile or feature image, sidecar service images, or the images of a
+compose project's services. Projects are prepared in parallel, and each one's
+result is printed as it finishes.
+
+By default images are refreshed, pulling newer base images and rebuilding with
+the layer cache, so a nightly cron job keeps the next morning's runs fast:
+
+  0 5 * * * packnplay warm ~/src/api ~/src/web
+
+With --missing, only images that aren't available locally are pulled or built.
+initializeCommand is not run. The command fails if any project does.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if err := applyConfigProfile(cfg, ""); err != nil {
+			return err
+		}
+
+		paths := args
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		runtime := warmRuntime
+		if runtime == "" {
+			runtime = cfg.ContainerRuntime
+		}
+
+		runConfig := &runner.RunConfig{
+			Runtime:            runtime,
+			Verbose:            warmVerbose,
+			DefaultImage:       cfg.GetDefaultImage(),
+			NoRegistryLogin:    cfg.NoRegistryLogin,
+			BuildContextWarnMB: cfg.BuildContextWarnMB,
+			RefreshImage:       !warmMissing,
+			NoBuildCache:       warmRebuild,
+			Proxy:              cfg.Proxy,
+			Registry:           cfg.Registry,
+			BuildSecrets:       cfg.BuildSecrets,
+		}
+
+		start := time.Now()
+		finished := 0
+		results, err := runner.Warm(runConfig, paths, warmJobs, func(result runner.WarmResult) {
+			finished++
+			printWarmResult(os.Stdout, result, finished, len(paths))
+		})
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		var firstErr error
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+				if firstErr == nil {
+					firstErr = result.Err
+				}
+			}
+		}
+		fmt.Printf("Warmed %d of %d projects in %s\n", len(results)-failed, len(results), time.Since(start).Round(time.Second))
+		if failed > 0 {
+			// Exit with the first failure's category
+			return errdefs.Errorf(errdefs.CategoryOf(firstErr), "%d of %d projects failed to warm", failed, len(results))
+		}
+		return nil
+	},
+}
+
+// printWarmResult reports one finished project
+func printWarmResult(w io.Writer, result runner.WarmResult, finished, total int) {
+	elapsed := result.Duration.Round(100 * time.Millisecond)
+	if result.Err != nil {
+		fmt.Fprintf(w, "[%d/%d] ✗ %s (%s): %v\n", finished, total, result.Path, elapsed, result.Err)
+		return
+	}
+	images := "compose services"
+	if len(result.Images) > 0 {
+		images = strings.Join(result.Images, ", ")
+	}
+	fmt.Fprintf(w, "[%d/%d] ✓ %s: %s (%s)\n", finished, total, result.Path, images, elapsed)
+}
+
+func init() {
+	rootCmd.AddCommand(warmCmd)
+	warmCmd.Flags().IntVarP(&warmJobs, "jobs", "j", 4, "Number of projects to prepare at once")
+	warmCmd.Flags().StringVar(&warmRuntime, "runtime", "", "Container runtime to use (docker/podman/nerdctl/lima/container)")
+	warmCmd.Flags().BoolVar(&warmMissing, "missing", false, "Only pull or build images that aren't available locally")
+	warmCmd.Flags().BoolVar(&warmRebuild, "rebuild", false, "Rebuild images without the layer cache, reinstalling features")
+	warmCmd.Flags().BoolVarP(&warmVerbose, "verbose", "v", false, "Show detailed output")
+}
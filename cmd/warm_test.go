@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/runner"
+)
+
+func TestPrintWarmResult(t *testing.T) {
+	var buf bytes.Buffer
+	printWarmResult(&buf, runner.WarmResult{Path: "/src/api", Images: []string{"packnplay-api-devcontainer:latest", "redis:7"}, Duration: 1234 * time.Millisecond}, 1, 2)
+	printWarmResult(&buf, runner.WarmResult{Path: "/src/web", Err: errors.New("failed to load devcontainer config")}, 2, 2)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q", buf.String())
+	}
+	if lines[0] != "[1/2] ✓ /src/api: packnplay-api-devcontainer:latest, redis:7 (1.2s)" {
+		t.Errorf("success line = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "[2/2] ✗ /src/web") || !strings.Contains(lines[1], "failed to load devcontainer config") {
+		t.Errorf("failure line = %q", lines[1])
+	}
+}
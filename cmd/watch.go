@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -10,13 +12,17 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/runner"
 	"github.com/spf13/cobra"
 )
 
 var watchCmd = &cobra.Command{
 	Use:    "watch-credentials",
-	Short:  "Watch container credential files and sync to keychain",
-	Long:   `Background daemon that watches container credential files and syncs them to keychain and other containers.`,
+	Short:  "Watch container credential files and sync to the credential store",
+	Long:   `Background daemon that encrypts credentials containers change back into the credential store and removes the decrypted copy once no containers are running.`,
 	Hidden: true, // Hide from help - internal command
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runCredentialWatcher()
@@ -28,21 +34,35 @@ func init() {
 }
 
 type credentialWatcher struct {
-	credentialsDir string
-	keychainKey    string
-	lastUpdate     time.Time
-	watcher        *fsnotify.Watcher
+	runtimeDir string
+	store      credstore.Store
+	stored     []byte // credentials last written to the store
+	watcher    *fsnotify.Watcher
+	ghToken    string // last gh token bridged into containers
+	github     config.GitHubConfig
 }
 
 func runCredentialWatcher() error {
+	backend := ""
+	var github config.GitHubConfig
+	if cfg, err := config.LoadWithoutRuntimeCheck(); err == nil {
+		backend = cfg.CredentialStore
+		github = cfg.GitHub
+	}
+	store, err := credstore.Open(backend, credstore.DefaultDir())
+	if err != nil {
+		return err
+	}
+
 	w := &credentialWatcher{
-		credentialsDir: getCredentialsDir(),
-		keychainKey:    "packnplay-containers-credentials",
+		runtimeDir: credstore.RuntimeDir(),
+		store:      store,
+		github:     github,
 	}
 
-	// Ensure credentials directory exists
-	if err := os.MkdirAll(w.credentialsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create credentials dir: %w", err)
+	// Ensure the runtime directory exists
+	if _, err := credstore.EnsureRuntimeDir(); err != nil {
+		return fmt.Errorf("failed to create runtime dir: %w", err)
 	}
 
 	// Create filesystem watcher
@@ -53,12 +73,12 @@ func runCredentialWatcher() error {
 	defer func() { _ = watcher.Close() }()
 	w.watcher = watcher
 
-	// Watch the credentials directory
-	if err := watcher.Add(w.credentialsDir); err != nil {
-		return fmt.Errorf("failed to watch credentials dir: %w", err)
+	// Watch the runtime directory holding the decrypted credential file
+	if err := watcher.Add(w.runtimeDir); err != nil {
+		return fmt.Errorf("failed to watch runtime dir: %w", err)
 	}
 
-	log.Printf("Watching credential files in %s", w.credentialsDir)
+	log.Printf("Watching credential files in %s (store: %s)", w.runtimeDir, store.Name())
 
 	// Event loop
 	for {
@@ -68,11 +88,9 @@ func runCredentialWatcher() error {
 				return fmt.Errorf("watcher closed")
 			}
 
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				if strings.Contains(event.Name, "packnplay-claude-credentials") {
-					if err := w.handleCredentialUpdate(event.Name); err != nil {
-						log.Printf("Error handling credential update: %v", err)
-					}
+			if event.Op&(fsnotify.Write|fsnotify.Create) != 0 && filepath.Base(event.Name) == runner.ContainerCredentialFile {
+				if err := w.handleCredentialUpdate(event.Name); err != nil {
+					log.Printf("Error handling credential update: %v", err)
 				}
 			}
 
@@ -86,83 +104,107 @@ func runCredentialWatcher() error {
 			// Periodic check if we should exit (no containers running)
 			if !hasRunningContainers() {
 				log.Printf("No containers running, exiting credential watcher")
+				w.removeRuntimeCredentials()
 				return nil
 			}
+
+			if err := w.syncGHToken(); err != nil {
+				log.Printf("Error refreshing gh credentials: %v", err)
+			}
+			if err := w.refreshRepoGHTokens(); err != nil {
+				log.Printf("Error refreshing repository GitHub tokens: %v", err)
+			}
 		}
 	}
 }
 
+// handleCredentialUpdate encrypts the decrypted credential file containers
+// share back into the store after a container logs in or refreshes its token
 func (w *credentialWatcher) handleCredentialUpdate(filePath string) error {
-	// Check if this update is newer than our last keychain write (avoid recursion)
-	stat, err := os.Stat(filePath)
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read credential file: %w", err)
 	}
-
-	if stat.ModTime().Before(w.lastUpdate) {
-		// This is our own writeback, ignore
+	// Skip partial writes and content the store already holds
+	if !json.Valid(content) || bytes.Equal(content, w.stored) {
 		return nil
 	}
 
 	log.Printf("Credential file updated: %s", filePath)
-
-	// Read the updated credentials
-	content, err := os.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read credential file: %w", err)
+	if err := w.store.Set(credstore.ClaudeCredentials, content); err != nil {
+		return fmt.Errorf("failed to update %s credential store: %w", w.store.Name(), err)
 	}
+	w.stored = content
+	return nil
+}
 
-	// macOS: Update keychain
-	if isDarwin() {
-		if err := w.updateKeychain(string(content)); err != nil {
-			return fmt.Errorf("failed to update keychain: %w", err)
-		}
+// removeRuntimeCredentials saves and removes the decrypted credential file so
+// no plaintext remains once containers are gone. A file touched in the last
+// minute is left for the run that is about to mount it.
+func (w *credentialWatcher) removeRuntimeCredentials() {
+	path := filepath.Join(w.runtimeDir, runner.ContainerCredentialFile)
+	if info, err := os.Stat(path); err != nil || time.Since(info.ModTime()) < time.Minute {
+		return
 	}
-
-	// Update other container credential files
-	if err := w.syncToOtherContainers(filePath, content); err != nil {
-		return fmt.Errorf("failed to sync to other containers: %w", err)
+	if err := w.handleCredentialUpdate(path); err != nil {
+		log.Printf("Keeping %s: %v", path, err)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("Warning: failed to remove %s: %v", path, err)
 	}
-
-	w.lastUpdate = time.Now()
-	return nil
 }
 
-func (w *credentialWatcher) updateKeychain(credentials string) error {
-	cmd := exec.Command("security", "add-generic-password",
-		"-s", w.keychainKey,
-		"-a", "packnplay",
-		"-w", credentials,
-		"-U") // -U updates if exists
-	return cmd.Run()
-}
+// syncGHToken rewrites bridged gh credentials when the host token rotates
+func (w *credentialWatcher) syncGHToken() error {
+	token, err := runner.GetHostGHToken()
+	if err != nil || token == w.ghToken {
+		return nil
+	}
+	first := w.ghToken == ""
+	w.ghToken = token
+	if first {
+		// Containers were seeded with this token at creation
+		return nil
+	}
 
-func (w *credentialWatcher) syncToOtherContainers(changedFile string, content []byte) error {
-	// Find all credential files except the one that changed
-	files, err := filepath.Glob(filepath.Join(w.credentialsDir, "container-*.credentials.json"))
+	dockerClient, err := docker.NewClient(false)
 	if err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		if file == changedFile {
-			continue // Skip the file that triggered this update
-		}
+	output, err := dockerClient.Run("ps", "--filter", "label="+runner.GHBridgeLabel, "--format", fmt.Sprintf("{{.ID}} {{.Label %q}} {{.Label %q}}", runner.GHBridgeLabel, runner.GHRepoLabel))
+	if err != nil {
+		return fmt.Errorf("failed to list gh bridged containers: %w", err)
+	}
 
-		if err := os.WriteFile(file, content, 0600); err != nil {
-			log.Printf("Warning: failed to update %s: %v", file, err)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		// Containers with a repository's token (a third field) never get the host's
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
 			continue
 		}
-
-		// Set mtime to our update time to prevent recursive updates
-		if err := os.Chtimes(file, w.lastUpdate, w.lastUpdate); err != nil {
-			log.Printf("Warning: failed to set timestamp on %s: %v", file, err)
+		log.Printf("Refreshing gh credentials in container %s", fields[0])
+		if err := runner.WriteGHCredentials(dockerClient, fields[0], fields[1], token, false); err != nil {
+			log.Printf("Warning: %v", err)
 		}
 	}
 
 	return nil
 }
 
+// refreshRepoGHTokens replaces repository-scoped tokens about to expire
+func (w *credentialWatcher) refreshRepoGHTokens() error {
+	if w.github.TokenScope != config.GHTokenRepo {
+		return nil
+	}
+	dockerClient, err := docker.NewClient(false)
+	if err != nil {
+		return err
+	}
+	return runner.RefreshRepoGHTokens(dockerClient, w.github, time.Now())
+}
+
 func hasRunningContainers() bool {
 	// Quick check if any packnplay containers are running
 	cmd := exec.Command("docker", "ps", "--filter", "label=managed-by=packnplay", "-q")
@@ -172,16 +214,3 @@ func hasRunningContainers() bool {
 	}
 	return len(strings.TrimSpace(string(output))) > 0
 }
-
-func isDarwin() bool {
-	return false // We're on Linux, would be runtime.GOOS == "darwin"
-}
-
-func getCredentialsDir() string {
-	home, _ := os.UserHomeDir()
-	xdgDataHome := os.Getenv("XDG_DATA_HOME")
-	if xdgDataHome == "" {
-		xdgDataHome = filepath.Join(home, ".local", "share")
-	}
-	return filepath.Join(xdgDataHome, "packnplay", "credentials")
-}
@@ -3,23 +3,138 @@ package dockerfile
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/obra/packnplay/pkg/devcontainer"
 )
 
+// InstallWrapperFile is the name of InstallWrapper in the build context
+const InstallWrapperFile = "packnplay-install.sh"
+
+// InstallWrapper runs a feature's install.sh from the current directory. When
+// it fails, it prints a line naming the feature, the exit status and, for bash
+// scripts (traced through BASH_ENV, so the script's interpreter is kept), the
+// last line that ran. FeatureFailurePrefix starts that line.
+const InstallWrapper = `#!/bin/sh
+feature="$1"
+rm -f .packnplay-trace
+cat > .packnplay-trace-env <<'TRACE'
+unset BASH_ENV
+PS4='+ line ${LINENO}: '
+exec 9>.packnplay-trace
+BASH_XTRACEFD=9
+set -x
+TRACE
+BASH_ENV="$PWD/.packnplay-trace-env" ./install.sh && { rm -f .packnplay-trace-env .packnplay-trace; exit 0; }
+status=$?
+at=$(grep '^+* line [0-9]*: ' .packnplay-trace 2>/dev/null | tail -n 1 | sed 's/^+* line / at install.sh line /')
+echo "packnplay: feature $feature failed (exit $status)$at"
+exit $status
+`
+
+// FeatureFailurePrefix starts the line InstallWrapper prints for a failed install
+const FeatureFailurePrefix = "packnplay: feature "
+
 // DockerfileGenerator generates Dockerfiles with devcontainer features
-type DockerfileGenerator struct{}
+type DockerfileGenerator struct {
+	runtimeEnv     func(name string) bool // feature containerEnv applied at run time instead of as ENV
+	containerUser  string                 // devcontainer.json containerUser, if set
+	installWrapper bool                   // run install scripts through InstallWrapper
+}
 
 // NewDockerfileGenerator creates a new DockerfileGenerator
 func NewDockerfileGenerator() *DockerfileGenerator {
 	return &DockerfileGenerator{}
 }
 
+// SetRuntimeEnv sets which feature containerEnv variables are left out of the image
+// because they are applied when the container starts.
+func (g *DockerfileGenerator) SetRuntimeEnv(isRuntime func(name string) bool) {
+	g.runtimeEnv = isRuntime
+}
+
+// SetContainerUser sets the containerUser exposed to feature install scripts as _CONTAINER_USER.
+// When unset, the remote user is used.
+func (g *DockerfileGenerator) SetContainerUser(user string) {
+	g.containerUser = user
+}
+
+// SetInstallWrapper runs each feature's install.sh through InstallWrapper,
+// which the caller writes to InstallWrapperFile in the build context, so a
+// failed install names its feature and line in the build output.
+func (g *DockerfileGenerator) SetInstallWrapper(enabled bool) {
+	g.installWrapper = enabled
+}
+
+// installUsers returns the remote and container users feature install scripts
+// see, falling back to each other and finally root as the spec does
+func (g *DockerfileGenerator) installUsers(remoteUser string) (remote, container string) {
+	container = g.containerUser
+	if container == "" {
+		container = remoteUser
+	}
+	if container == "" {
+		container = "root"
+	}
+	remote = remoteUser
+	if remote == "" {
+		remote = container
+	}
+	return remote, container
+}
+
+// userHome returns the conventional home directory for a user
+func userHome(user string) string {
+	if user == "root" {
+		return "/root"
+	}
+	return "/home/" + user
+}
+
+// writeInstallUserEnv writes the _REMOTE_USER/_CONTAINER_USER variables install.sh relies on
+func (g *DockerfileGenerator) writeInstallUserEnv(sb *strings.Builder, remoteUser string) {
+	remote, container := g.installUsers(remoteUser)
+	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER=%s\n", remote))
+	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER_HOME=%s\n", userHome(remote)))
+	sb.WriteString(fmt.Sprintf("ENV _CONTAINER_USER=%s\n", container))
+	sb.WriteString(fmt.Sprintf("ENV _CONTAINER_USER_HOME=%s\n\n", userHome(container)))
+}
+
+// installWrapperPath is where InstallWrapper is copied in the image
+const installWrapperPath = "/tmp/devcontainer-features/" + InstallWrapperFile
+
+// writeInstallWrapper copies InstallWrapper into the image, when it is used
+func (g *DockerfileGenerator) writeInstallWrapper(sb *strings.Builder) {
+	if g.installWrapper {
+		sb.WriteString(fmt.Sprintf("COPY %s %s\n\n", InstallWrapperFile, installWrapperPath))
+	}
+}
+
+// writeOwnershipFixup hands files that root-run install scripts left in the
+// remote user's home back to that user, so tools installed per-user stay writable
+func (g *DockerfileGenerator) writeOwnershipFixup(sb *strings.Builder, remoteUser string) {
+	remote, _ := g.installUsers(remoteUser)
+	if remote == "root" {
+		return
+	}
+	sb.WriteString("# Give feature-created files in the remote user's home back to that user\n")
+	sb.WriteString(`RUN if [ -d "$_REMOTE_USER_HOME" ] && id -u "$_REMOTE_USER" >/dev/null 2>&1; then ` +
+		`find "$_REMOTE_USER_HOME" -xdev -user root -exec chown -h "$_REMOTE_USER:" {} +; fi` + "\n\n")
+}
+
+// isRuntimeEnv reports whether a feature containerEnv variable is left to run time
+func (g *DockerfileGenerator) isRuntimeEnv(name string) bool {
+	return g.runtimeEnv != nil && g.runtimeEnv(name)
+}
+
 // Generate creates a Dockerfile with the specified base image, remote user, and features
 // The buildContextPath is the directory used as the Docker build context (typically .devcontainer)
 func (g *DockerfileGenerator) Generate(baseImage string, remoteUser string, features []*devcontainer.ResolvedFeature, buildContextPath string) (string, error) {
 	if len(features) == 0 {
+		if remoteUser == "" {
+			return fmt.Sprintf("FROM %s\nWORKDIR /workspace", baseImage), nil
+		}
 		return fmt.Sprintf("FROM %s\nUSER %s\nWORKDIR /workspace", baseImage, remoteUser), nil
 	}
 
@@ -71,40 +186,38 @@ func (g *DockerfileGenerator) generateMultiStage(baseImage string, features []*d
 	sb.WriteString("USER root\n")
 
 	// Add user context environment variables
-	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER=%s\n", remoteUser))
-	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER_HOME=/home/%s\n", remoteUser))
-	sb.WriteString(fmt.Sprintf("ENV _CONTAINER_USER=%s\n\n", remoteUser))
+	g.writeInstallUserEnv(&sb, remoteUser)
 
 	// Copy features from prep stage
 	sb.WriteString("# Copy features from prep stage\n")
 	sb.WriteString("COPY --from=feature-prep /tmp/features /tmp/devcontainer-features\n\n")
+	g.writeInstallWrapper(&sb)
 
 	// Install features with options processing
 	processor := devcontainer.NewFeatureOptionsProcessor()
 	for i, feature := range features {
 		sb.WriteString(fmt.Sprintf("# Install feature: %s\n", feature.ID))
 
-		// Add environment variables from options
-		if feature.Metadata != nil && feature.Metadata.Options != nil {
-			envVars, err := processor.ValidateAndProcessOptions(feature.Options, feature.Metadata.Options)
-			if err != nil {
-				return "", fmt.Errorf("invalid options for feature %s: %w", feature.ID, err)
-			}
-			for envName, envValue := range envVars {
-				sb.WriteString(fmt.Sprintf("ENV %s=%s\n", envName, envValue))
-			}
+		// Option values are scoped to this feature's install step
+		optionEnv, err := featureOptionEnv(processor, feature)
+		if err != nil {
+			return "", fmt.Errorf("invalid options for feature %s: %w", feature.ID, err)
 		}
 
 		// Add feature-contributed container environment variables
 		if feature.Metadata != nil && feature.Metadata.ContainerEnv != nil {
 			for envName, envValue := range feature.Metadata.ContainerEnv {
+				if g.isRuntimeEnv(envName) {
+					continue
+				}
 				sb.WriteString(fmt.Sprintf("ENV %s=%s\n", envName, envValue))
 			}
 		}
 
 		featureDestPath := fmt.Sprintf("/tmp/devcontainer-features/%d-%s", i, feature.ID)
-		sb.WriteString(fmt.Sprintf("RUN cd %s && chmod +x install.sh && ./install.sh\n\n", featureDestPath))
+		sb.WriteString(g.installCommand(feature.ID, featureDestPath, optionEnv))
 	}
+	g.writeOwnershipFixup(&sb, remoteUser)
 
 	// Switch to user
 	if remoteUser != "" {
@@ -126,29 +239,26 @@ func (g *DockerfileGenerator) generateSingleStage(baseImage string, features []*
 	sb.WriteString("USER root\n")
 
 	// Add user context environment variables
-	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER=%s\n", remoteUser))
-	sb.WriteString(fmt.Sprintf("ENV _REMOTE_USER_HOME=/home/%s\n", remoteUser))
-	sb.WriteString(fmt.Sprintf("ENV _CONTAINER_USER=%s\n\n", remoteUser))
+	g.writeInstallUserEnv(&sb, remoteUser)
+	g.writeInstallWrapper(&sb)
 
 	// Install features
 	processor := devcontainer.NewFeatureOptionsProcessor()
 	for i, feature := range features {
 		sb.WriteString(fmt.Sprintf("# Install feature: %s\n", feature.ID))
 
-		// Process feature options to environment variables
-		if feature.Metadata != nil && feature.Metadata.Options != nil {
-			envVars, err := processor.ValidateAndProcessOptions(feature.Options, feature.Metadata.Options)
-			if err != nil {
-				return "", fmt.Errorf("invalid options for feature %s: %w", feature.ID, err)
-			}
-			for envName, envValue := range envVars {
-				sb.WriteString(fmt.Sprintf("ENV %s=%s\n", envName, envValue))
-			}
+		// Option values are scoped to this feature's install step
+		optionEnv, err := featureOptionEnv(processor, feature)
+		if err != nil {
+			return "", fmt.Errorf("invalid options for feature %s: %w", feature.ID, err)
 		}
 
 		// Add feature-contributed container environment variables
 		if feature.Metadata != nil && feature.Metadata.ContainerEnv != nil {
 			for envName, envValue := range feature.Metadata.ContainerEnv {
+				if g.isRuntimeEnv(envName) {
+					continue
+				}
 				sb.WriteString(fmt.Sprintf("ENV %s=%s\n", envName, envValue))
 			}
 		}
@@ -169,8 +279,9 @@ func (g *DockerfileGenerator) generateSingleStage(baseImage string, features []*
 		sb.WriteString(fmt.Sprintf("COPY %s %s\n", relPath, featureDestPath))
 
 		// Run the install script from its directory so relative paths work
-		sb.WriteString(fmt.Sprintf("RUN cd %s && chmod +x install.sh && ./install.sh\n\n", featureDestPath))
+		sb.WriteString(g.installCommand(feature.ID, featureDestPath, optionEnv))
 	}
+	g.writeOwnershipFixup(&sb, remoteUser)
 
 	// Switch back to remote user if specified
 	if remoteUser != "" {
@@ -180,3 +291,42 @@ func (g *DockerfileGenerator) generateSingleStage(baseImage string, features []*
 
 	return sb.String(), nil
 }
+
+// featureOptionEnv converts a feature's options to install environment variables,
+// validating them unless validation was explicitly skipped at resolve time
+func featureOptionEnv(processor *devcontainer.FeatureOptionsProcessor, feature *devcontainer.ResolvedFeature) (map[string]string, error) {
+	var specs map[string]devcontainer.OptionSpec
+	if feature.Metadata != nil {
+		specs = feature.Metadata.Options
+	}
+	if feature.SkipOptionValidation {
+		return processor.ProcessOptions(feature.Options, specs), nil
+	}
+	return processor.ValidateAndProcessOptions(feature.Options, specs)
+}
+
+// installCommand runs a feature's install.sh from its directory (so relative
+// paths work) with its option values set for that step only, in a stable order
+// so unchanged features keep their layer cache. Each feature installs in a
+// layer of its own, so a retried build picks up at the feature that failed.
+func (g *DockerfileGenerator) installCommand(featureID, featureDestPath string, optionEnv map[string]string) string {
+	names := make([]string, 0, len(optionEnv))
+	for name := range optionEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var assignments strings.Builder
+	for _, name := range names {
+		assignments.WriteString(fmt.Sprintf("%s=%s ", name, shellQuote(optionEnv[name])))
+	}
+	if g.installWrapper {
+		return fmt.Sprintf("RUN cd %s && chmod +x install.sh && %ssh %s %s\n\n", featureDestPath, assignments.String(), installWrapperPath, shellQuote(featureID))
+	}
+	return fmt.Sprintf("RUN cd %s && chmod +x install.sh && %s./install.sh\n\n", featureDestPath, assignments.String())
+}
+
+// shellQuote single-quotes a value for /bin/sh
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
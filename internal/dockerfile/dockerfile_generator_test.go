@@ -1,7 +1,9 @@
 package dockerfile
 
 import (
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -286,3 +288,277 @@ func TestFeatureUserContextVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateOmitsRuntimeEnv(t *testing.T) {
+	tempDir := t.TempDir()
+	featureDir := filepath.Join(tempDir, "go")
+	if err := os.MkdirAll(featureDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	feature := &devcontainer.ResolvedFeature{
+		ID:          "go",
+		InstallPath: featureDir,
+		Metadata: &devcontainer.FeatureMetadata{
+			ContainerEnv: map[string]string{
+				"GOPATH":    "/go",
+				"API_TOKEN": "semi-secret",
+			},
+		},
+	}
+
+	generator := NewDockerfileGenerator()
+	generator.SetRuntimeEnv(func(name string) bool { return name == "API_TOKEN" })
+	dockerfile, err := generator.Generate("ubuntu:22.04", "vscode", []*devcontainer.ResolvedFeature{feature}, tempDir)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if !strings.Contains(dockerfile, "ENV GOPATH=/go") {
+		t.Errorf("build env should be baked into the image:\n%s", dockerfile)
+	}
+	if strings.Contains(dockerfile, "API_TOKEN") {
+		t.Errorf("runtime env should not appear in the Dockerfile:\n%s", dockerfile)
+	}
+}
+
+func TestGenerateInstallUsers(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteUser    string
+		containerUser string
+		wantEnv       []string
+		wantChown     bool
+	}{
+		{
+			name:          "container user differs from remote user",
+			remoteUser:    "vscode",
+			containerUser: "app",
+			wantEnv: []string{
+				"ENV _REMOTE_USER=vscode",
+				"ENV _REMOTE_USER_HOME=/home/vscode",
+				"ENV _CONTAINER_USER=app",
+				"ENV _CONTAINER_USER_HOME=/home/app",
+			},
+			wantChown: true,
+		},
+		{
+			name:          "remote user defaults to container user",
+			containerUser: "node",
+			wantEnv: []string{
+				"ENV _REMOTE_USER=node",
+				"ENV _CONTAINER_USER=node",
+			},
+			wantChown: true,
+		},
+		{
+			name: "no users means root",
+			wantEnv: []string{
+				"ENV _REMOTE_USER=root",
+				"ENV _REMOTE_USER_HOME=/root",
+				"ENV _CONTAINER_USER=root",
+			},
+			wantChown: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			featureDir := filepath.Join(tempDir, "tool")
+			if err := os.MkdirAll(featureDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			feature := &devcontainer.ResolvedFeature{ID: "tool", InstallPath: featureDir}
+
+			generator := NewDockerfileGenerator()
+			generator.SetContainerUser(tt.containerUser)
+			dockerfile, err := generator.Generate("ubuntu:22.04", tt.remoteUser, []*devcontainer.ResolvedFeature{feature}, tempDir)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			for _, env := range tt.wantEnv {
+				if !strings.Contains(dockerfile, env) {
+					t.Errorf("Dockerfile missing %q:\n%s", env, dockerfile)
+				}
+			}
+
+			chownIdx := strings.Index(dockerfile, "chown -h")
+			if (chownIdx >= 0) != tt.wantChown {
+				t.Fatalf("chown present = %v, want %v:\n%s", chownIdx >= 0, tt.wantChown, dockerfile)
+			}
+			if tt.wantChown && chownIdx < strings.Index(dockerfile, "./install.sh") {
+				t.Errorf("ownership fixup should run after feature installation:\n%s", dockerfile)
+			}
+			if tt.remoteUser == "" && strings.Contains(dockerfile, "USER \n") {
+				t.Errorf("Dockerfile has an empty USER instruction:\n%s", dockerfile)
+			}
+		})
+	}
+}
+
+func TestGenerateWithoutFeaturesOrUser(t *testing.T) {
+	dockerfile, err := NewDockerfileGenerator().Generate("ubuntu:22.04", "", nil, t.TempDir())
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if strings.Contains(dockerfile, "USER") {
+		t.Errorf("Dockerfile should not set an empty USER:\n%s", dockerfile)
+	}
+}
+
+// TestGenerateOfficialFeatureContract checks the install environment community
+// features depend on, using option declarations from the official features
+func TestGenerateOfficialFeatureContract(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		specs      map[string]devcontainer.OptionSpec
+		options    map[string]interface{}
+		wantInline []string
+	}{
+		{
+			name: "sshd",
+			id:   "sshd",
+			specs: map[string]devcontainer.OptionSpec{
+				"version":      {Type: "string", Default: "latest"},
+				"gatewayPorts": {Type: "string", Default: "no", Enum: []string{"no", "yes", "clientspecified"}},
+			},
+			wantInline: []string{"GATEWAYPORTS='no'", "VERSION='latest'"},
+		},
+		{
+			name: "desktop-lite",
+			id:   "desktop-lite",
+			specs: map[string]devcontainer.OptionSpec{
+				"version":      {Type: "string", Default: "latest"},
+				"noVncVersion": {Type: "string", Default: "1.2.0"},
+				"password":     {Type: "string", Default: "vscode", Proposals: []string{"vscode", "codespaces", "password"}},
+				"webPort":      {Type: "string", Default: "6080"},
+				"vncPort":      {Type: "string", Default: "5901"},
+			},
+			options:    map[string]interface{}{"password": "vscode"},
+			wantInline: []string{"NOVNCVERSION='1.2.0'", "PASSWORD='vscode'", "VERSION='latest'", "VNCPORT='5901'", "WEBPORT='6080'"},
+		},
+		{
+			name: "common-utils",
+			id:   "common-utils",
+			specs: map[string]devcontainer.OptionSpec{
+				"installZsh": {Type: "boolean", Default: true},
+				"username":   {Type: "string", Default: "automatic", Proposals: []string{"devcontainer", "vscode", "codespace", "none", "automatic"}},
+				"userUid":    {Type: "string", Default: "automatic", Proposals: []string{"1001", "automatic"}},
+			},
+			options:    map[string]interface{}{"installZsh": false, "username": "vscode"},
+			wantInline: []string{"INSTALLZSH='false'", "USERNAME='vscode'", "USERUID='automatic'"},
+		},
+		{
+			name: "values with spaces and quotes stay intact",
+			id:   "custom",
+			specs: map[string]devcontainer.OptionSpec{
+				"greeting": {Type: "string"},
+			},
+			options:    map[string]interface{}{"greeting": "it's $HOME"},
+			wantInline: []string{`GREETING='it'\''s $HOME'`},
+		},
+		{
+			name:       "undeclared options are passed through",
+			id:         "custom",
+			specs:      map[string]devcontainer.OptionSpec{},
+			options:    map[string]interface{}{"extra-flag": "on"},
+			wantInline: []string{"EXTRA_FLAG='on'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			featureDir := filepath.Join(tempDir, tt.id)
+			if err := os.MkdirAll(featureDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			feature := &devcontainer.ResolvedFeature{
+				ID:          tt.id,
+				InstallPath: featureDir,
+				Options:     tt.options,
+				Metadata:    &devcontainer.FeatureMetadata{ID: tt.id, Options: tt.specs},
+			}
+
+			generator := NewDockerfileGenerator()
+			generator.SetContainerUser("root")
+			dockerfile, err := generator.Generate("ubuntu:22.04", "vscode", []*devcontainer.ResolvedFeature{feature}, tempDir)
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			for _, env := range []string{
+				"ENV _REMOTE_USER=vscode",
+				"ENV _REMOTE_USER_HOME=/home/vscode",
+				"ENV _CONTAINER_USER=root",
+				"ENV _CONTAINER_USER_HOME=/root",
+			} {
+				if !strings.Contains(dockerfile, env) {
+					t.Errorf("Dockerfile missing %q:\n%s", env, dockerfile)
+				}
+			}
+
+			var runLine string
+			for _, line := range strings.Split(dockerfile, "\n") {
+				if strings.Contains(line, "./install.sh") {
+					runLine = line
+				}
+			}
+			if !strings.HasSuffix(runLine, " "+strings.Join(tt.wantInline, " ")+" ./install.sh") {
+				t.Errorf("install step = %q, want sorted inline options %v", runLine, tt.wantInline)
+			}
+			if strings.Contains(dockerfile, "ENV "+strings.SplitN(tt.wantInline[0], "=", 2)[0]+"=") {
+				t.Errorf("option values should not be baked into the image as ENV:\n%s", dockerfile)
+			}
+		})
+	}
+}
+
+func TestGenerateWithInstallWrapper(t *testing.T) {
+	tempDir := t.TempDir()
+	feature := &devcontainer.ResolvedFeature{ID: "node", InstallPath: filepath.Join(tempDir, "node"), Options: map[string]interface{}{"version": "20"}}
+
+	generator := NewDockerfileGenerator()
+	generator.SetInstallWrapper(true)
+	dockerfile, err := generator.Generate("ubuntu:22.04", "", []*devcontainer.ResolvedFeature{feature}, tempDir)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(dockerfile, "COPY packnplay-install.sh /tmp/devcontainer-features/packnplay-install.sh\n") {
+		t.Errorf("Dockerfile should copy the install wrapper:\n%s", dockerfile)
+	}
+	if !strings.Contains(dockerfile, "VERSION='20' sh /tmp/devcontainer-features/packnplay-install.sh 'node'\n") {
+		t.Errorf("install step should run through the wrapper with its options:\n%s", dockerfile)
+	}
+}
+
+func TestInstallWrapperReportsFailedLine(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, InstallWrapperFile), []byte(InstallWrapper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	install := "#!/usr/bin/env bash\nset -e\necho fetching\nif true; then\n  sh -c 'exit 7'\nfi\necho never\n"
+	if err := os.WriteFile(filepath.Join(dir, "install.sh"), []byte(install), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", InstallWrapperFile, "flaky")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+		t.Fatalf("wrapper error = %v, want install.sh's exit status\n%s", err, output)
+	}
+	if want := "packnplay: feature flaky failed (exit 7) at install.sh line 5: sh -c 'exit 7'\n"; !strings.HasSuffix(string(output), want) {
+		t.Errorf("output = %q, want it to end with %q", output, want)
+	}
+	if !strings.Contains(string(output), "fetching\n") {
+		t.Errorf("output = %q, want install.sh's own output kept", output)
+	}
+}
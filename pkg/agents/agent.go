@@ -10,7 +10,9 @@ type Agent interface {
 	ConfigDir() string             // e.g., ".claude", ".codex", ".gemini"
 	DefaultAPIKeyEnv() string      // e.g., "ANTHROPIC_API_KEY", "OPENAI_API_KEY"
 	RequiresSpecialHandling() bool // Claude needs credential overlay, others don't
-	GetMounts(hostHomeDir string, containerUser string) []Mount
+	// GetMounts maps the agent's config in hostHomeDir into containerHomeDir,
+	// the container user's home directory
+	GetMounts(hostHomeDir, containerHomeDir string) []Mount
 }
 
 // Mount represents a directory or file mount
@@ -43,12 +45,7 @@ func (c *ClaudeAgent) ConfigDir() string             { return ".claude" }
 func (c *ClaudeAgent) DefaultAPIKeyEnv() string      { return "ANTHROPIC_API_KEY" }
 func (c *ClaudeAgent) RequiresSpecialHandling() bool { return true } // Needs credential overlay
 
-func (c *ClaudeAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (c *ClaudeAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".claude"),
@@ -66,12 +63,7 @@ func (c *CodexAgent) ConfigDir() string             { return ".codex" }
 func (c *CodexAgent) DefaultAPIKeyEnv() string      { return "OPENAI_API_KEY" }
 func (c *CodexAgent) RequiresSpecialHandling() bool { return false } // Simple config mount
 
-func (c *CodexAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (c *CodexAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".codex"),
@@ -89,12 +81,7 @@ func (g *GeminiAgent) ConfigDir() string             { return ".gemini" }
 func (g *GeminiAgent) DefaultAPIKeyEnv() string      { return "GEMINI_API_KEY" }
 func (g *GeminiAgent) RequiresSpecialHandling() bool { return false } // Simple config mount
 
-func (g *GeminiAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (g *GeminiAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".gemini"),
@@ -112,12 +99,7 @@ func (c *CopilotAgent) ConfigDir() string             { return ".copilot" }
 func (c *CopilotAgent) DefaultAPIKeyEnv() string      { return "GH_TOKEN" } // Uses GitHub auth
 func (c *CopilotAgent) RequiresSpecialHandling() bool { return false }
 
-func (c *CopilotAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (c *CopilotAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".copilot"),
@@ -135,12 +117,7 @@ func (q *QwenAgent) ConfigDir() string             { return ".qwen" }
 func (q *QwenAgent) DefaultAPIKeyEnv() string      { return "QWEN_API_KEY" }
 func (q *QwenAgent) RequiresSpecialHandling() bool { return false }
 
-func (q *QwenAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (q *QwenAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".qwen"),
@@ -158,12 +135,7 @@ func (c *CursorAgent) ConfigDir() string             { return ".cursor" }
 func (c *CursorAgent) DefaultAPIKeyEnv() string      { return "CURSOR_API_KEY" } // Assuming based on pattern
 func (c *CursorAgent) RequiresSpecialHandling() bool { return false }
 
-func (c *CursorAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (c *CursorAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".cursor"),
@@ -181,12 +153,7 @@ func (a *AmpAgent) ConfigDir() string             { return ".config/amp" } // Us
 func (a *AmpAgent) DefaultAPIKeyEnv() string      { return "AMP_API_KEY" }
 func (a *AmpAgent) RequiresSpecialHandling() bool { return false }
 
-func (a *AmpAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (a *AmpAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".config", "amp"),
@@ -204,12 +171,7 @@ func (d *DeepSeekAgent) ConfigDir() string             { return ".deepseek" }
 func (d *DeepSeekAgent) DefaultAPIKeyEnv() string      { return "DEEPSEEK_API_KEY" }
 func (d *DeepSeekAgent) RequiresSpecialHandling() bool { return false }
 
-func (d *DeepSeekAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (d *DeepSeekAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".deepseek"),
@@ -227,12 +189,7 @@ func (o *OpenCodeAgent) ConfigDir() string             { return ".config/opencod
 func (o *OpenCodeAgent) DefaultAPIKeyEnv() string      { return "OPENCODE_API_KEY" }
 func (o *OpenCodeAgent) RequiresSpecialHandling() bool { return false } // Standard config mount
 
-func (o *OpenCodeAgent) GetMounts(hostHomeDir string, containerUser string) []Mount {
-	containerHomeDir := "/root"
-	if containerUser != "root" {
-		containerHomeDir = "/home/" + containerUser
-	}
-
+func (o *OpenCodeAgent) GetMounts(hostHomeDir, containerHomeDir string) []Mount {
 	return []Mount{
 		{
 			HostPath:      filepath.Join(hostHomeDir, ".config", "opencode"),
@@ -45,7 +45,7 @@ func TestClaudeAgent(t *testing.T) {
 	}
 
 	// Test mounts with vscode user
-	mounts := agent.GetMounts("/home/test", "vscode")
+	mounts := agent.GetMounts("/home/test", "/home/vscode")
 	if len(mounts) != 1 {
 		t.Errorf("GetMounts() returned %d mounts, want 1", len(mounts))
 	}
@@ -59,7 +59,7 @@ func TestClaudeAgent(t *testing.T) {
 	}
 
 	// Test mounts with root user
-	rootMounts := agent.GetMounts("/home/test", "root")
+	rootMounts := agent.GetMounts("/home/test", "/root")
 	if rootMounts[0].ContainerPath != "/root/.claude" {
 		t.Errorf("Mount ContainerPath for root = %v, want /root/.claude", rootMounts[0].ContainerPath)
 	}
@@ -85,7 +85,7 @@ func TestCodexAgent(t *testing.T) {
 	}
 
 	// Test mounts with vscode user
-	mounts := agent.GetMounts("/home/test", "vscode")
+	mounts := agent.GetMounts("/home/test", "/home/vscode")
 	if len(mounts) != 1 {
 		t.Errorf("GetMounts() returned %d mounts, want 1", len(mounts))
 	}
@@ -101,7 +101,7 @@ func TestCodexAgent(t *testing.T) {
 	}
 
 	// Test with different user
-	nodeMounts := agent.GetMounts("/home/test", "node")
+	nodeMounts := agent.GetMounts("/home/test", "/home/node")
 	expectedNode := Mount{
 		HostPath:      "/home/test/.codex",
 		ContainerPath: "/home/node/.codex",
@@ -183,7 +183,7 @@ func TestOpenCodeAgent(t *testing.T) {
 	}
 
 	// Test mounts with vscode user
-	mounts := agent.GetMounts("/home/test", "vscode")
+	mounts := agent.GetMounts("/home/test", "/home/vscode")
 	if len(mounts) != 1 {
 		t.Errorf("GetMounts() returned %d mounts, want 1", len(mounts))
 	}
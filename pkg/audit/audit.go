@@ -0,0 +1,197 @@
+// Package audit keeps a local record of what packnplay did with containers:
+// which were created and with what credentials, the commands run in them,
+// attaches, and when they were stopped and removed. Events are appended as
+// JSON lines to a file in the XDG state directory, rotated when it grows too
+// large, and shown by `packnplay audit show`.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/obra/packnplay/pkg/logrotate"
+)
+
+// Event types
+const (
+	TypeCreate    = "create"    // ContainerID, Image, Credentials
+	TypeAttach    = "attach"    // Argv
+	TypeExec      = "exec"      // Argv
+	TypeLifecycle = "lifecycle" // Command, Argv, Error
+	TypeStop      = "stop"
+	TypeRemove    = "remove"
+)
+
+// Event is one line of the audit log. Fields that don't apply to a type are omitted.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	User        string    `json:"user,omitempty"`    // host user who ran packnplay
+	Project     string    `json:"project,omitempty"` // project directory on the host
+	Container   string    `json:"container,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Command     string    `json:"command,omitempty"` // lifecycle command type, e.g. postCreate
+	Argv        []string  `json:"argv,omitempty"`
+	Credentials []string  `json:"credentials,omitempty"` // credential types given to the container
+	Error       string    `json:"error,omitempty"`
+}
+
+// Rotation defaults: the log is rotated once it would exceed DefaultMaxSize,
+// keeping DefaultKeep older files (audit.jsonl.1 being the newest)
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultKeep    = 5
+)
+
+// DefaultPath returns the audit log location in the XDG state directory
+func DefaultPath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, _ := os.UserHomeDir()
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "packnplay", "audit.jsonl")
+}
+
+// Log appends events to an audit log file. A nil Log records nothing.
+type Log struct {
+	path    string
+	maxSize int64
+	keep    int
+	now     func() time.Time
+}
+
+// NewLog creates a Log writing to path with the default rotation
+func NewLog(path string) *Log {
+	return &Log{path: path, maxSize: DefaultMaxSize, keep: DefaultKeep, now: time.Now}
+}
+
+// Record appends an event, filling in its time and the host user
+func (l *Log) Record(event Event) error {
+	if l == nil {
+		return nil
+	}
+	if event.Time.IsZero() {
+		event.Time = l.now().UTC()
+	}
+	if event.User == "" {
+		event.User = hostUser()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	if err := logrotate.BeforeAppend(l.path, int64(len(data)), l.maxSize, l.keep); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// hostUser names the user running packnplay
+func hostUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Load reads the events of the log at path and its rotated files, oldest
+// first. Missing files yield no events; malformed lines (e.g. from an
+// interrupted write) are skipped.
+func Load(path string) ([]Event, error) {
+	var events []Event
+	for _, file := range logrotate.Files(path) {
+		loaded, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, loaded...)
+	}
+	return events, nil
+}
+
+func loadFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20) // exec argv can be long
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	return events, nil
+}
+
+// Filter returns the events of project (a directory, or its base name) from
+// since on. Events recorded without a project, such as stopping a container
+// by name, are included when the container (by name or ID) belongs to the
+// project.
+func Filter(events []Event, project string, since time.Time) []Event {
+	containers := make(map[string]bool)
+	if project != "" {
+		for _, event := range events {
+			if matchesProject(event.Project, project) {
+				containers[event.Container] = true
+				containers[event.ContainerID] = true
+			}
+		}
+		delete(containers, "")
+	}
+	belongs := func(event Event) bool {
+		if project == "" {
+			return true
+		}
+		if event.Project != "" {
+			return matchesProject(event.Project, project)
+		}
+		return containers[event.Container] || containers[event.ContainerID]
+	}
+
+	var filtered []Event
+	for _, event := range events {
+		if event.Time.Before(since) || !belongs(event) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
+
+// matchesProject reports whether an event's project directory is project,
+// given as a directory or its base name
+func matchesProject(recorded, project string) bool {
+	return recorded != "" && (recorded == project || filepath.Base(recorded) == project)
+}
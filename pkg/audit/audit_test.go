@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog_RecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+
+	log := NewLog(path)
+	if err := log.Record(Event{Type: TypeCreate, Project: "/src/app", Container: "packnplay-app-main", Credentials: []string{"git", "gh"}}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := log.Record(Event{Type: TypeExec, Project: "/src/app", Container: "packnplay-app-main", Argv: []string{"claude", "--resume"}}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	// A nil log is a no-op
+	var nilLog *Log
+	if err := nilLog.Record(Event{Type: TypeStop}); err != nil {
+		t.Errorf("nil Record() error = %v", err)
+	}
+
+	// Corrupt line from an interrupted write is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"2024-`)
+	_ = f.Close()
+
+	events, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Load() = %d events, want 2", len(events))
+	}
+	if events[1].Type != TypeExec || strings.Join(events[1].Argv, " ") != "claude --resume" {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+	if events[0].Time.IsZero() || events[0].User == "" {
+		t.Errorf("Record() should fill in the time and user: %+v", events[0])
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+}
+
+func TestLog_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := &Log{path: path, maxSize: 200, keep: 2, now: time.Now}
+
+	for i := 0; i < 12; i++ {
+		if err := log.Record(Event{Type: TypeExec, Container: "c", Argv: []string{strings.Repeat("x", 40)}}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	for _, file := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(file), err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, want it rotated at 200", filepath.Base(file), info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("only the newest 2 rotated files should be kept")
+	}
+
+	events, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Fatalf("Load() should return events oldest first")
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: now.Add(-48 * time.Hour), Type: TypeCreate, Project: "/src/app", Container: "packnplay-app-old"},
+		{Time: now.Add(-time.Hour), Type: TypeCreate, Project: "/src/app", Container: "packnplay-app-main"},
+		{Time: now.Add(-time.Hour), Type: TypeCreate, Project: "/src/web", Container: "packnplay-web-main"},
+		{Time: now, Type: TypeStop, Container: "packnplay-app-main"},
+		{Time: now, Type: TypeStop, Container: "packnplay-web-main"},
+	}
+
+	got := Filter(events, "app", now.Add(-24*time.Hour))
+	if len(got) != 2 || got[0].Container != "packnplay-app-main" || got[1].Type != TypeStop {
+		t.Errorf("Filter(app) = %+v", got)
+	}
+	if got := Filter(events, "/src/web", time.Time{}); len(got) != 2 {
+		t.Errorf("Filter(/src/web) = %+v, want the container's stop included", got)
+	}
+	if got := Filter(events, "", time.Time{}); len(got) != len(events) {
+		t.Errorf("Filter() = %d events, want all", len(got))
+	}
+}
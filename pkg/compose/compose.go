@@ -1,27 +1,33 @@
 package compose
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/redact"
 )
 
+// Client is the container runtime whose CLI runs compose commands
+type Client interface {
+	Command() string
+}
+
 // Runner handles Docker Compose orchestration
 type Runner struct {
 	workDir      string
 	composeFiles []string
 	service      string
 	runServices  []string
-	dockerClient *docker.Client
+	dockerClient Client
 	verbose      bool
 }
 
 // NewRunner creates a new Docker Compose runner
-func NewRunner(workDir string, composeFiles []string, service string, runServices []string, dockerClient *docker.Client, verbose bool) *Runner {
+func NewRunner(workDir string, composeFiles []string, service string, runServices []string, dockerClient Client, verbose bool) *Runner {
 	return &Runner{
 		workDir:      workDir,
 		composeFiles: composeFiles,
@@ -58,7 +64,7 @@ func (r *Runner) Up() (string, error) {
 	cmd.Stderr = os.Stderr
 
 	if r.verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), args)
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), redact.Args(args))
 	}
 
 	if err := cmd.Run(); err != nil {
@@ -82,7 +88,7 @@ func (r *Runner) GetServiceContainerID() (string, error) {
 	cmd.Dir = r.workDir
 
 	if r.verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), args)
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), redact.Args(args))
 		cmd.Stderr = os.Stderr
 	}
 
@@ -107,6 +113,28 @@ func (r *Runner) GetServiceContainerID() (string, error) {
 	return containerID, nil
 }
 
+// Pull pulls the images of the compose services without starting them. Output
+// is returned rather than streamed, so several pulls can run side by side.
+func (r *Runner) Pull() error {
+	args := []string{"compose"}
+	for _, f := range r.composeFiles {
+		args = append(args, "-f", f)
+	}
+	args = append(args, "pull", "--quiet")
+
+	cmd := exec.Command(r.dockerClient.Command(), args...)
+	cmd.Dir = r.workDir
+
+	if r.verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), redact.Args(args))
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker compose pull failed: %w\nOutput:\n%s", err, output)
+	}
+	return nil
+}
+
 // Down stops and removes the Docker Compose services
 func (r *Runner) Down() error {
 	args := []string{"compose"}
@@ -121,7 +149,7 @@ func (r *Runner) Down() error {
 	cmd.Stderr = os.Stderr
 
 	if r.verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), args)
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", r.dockerClient.Command(), redact.Args(args))
 	}
 
 	if err := cmd.Run(); err != nil {
@@ -144,3 +172,27 @@ func ValidateComposeFiles(workDir string, composeFiles []string) error {
 	}
 	return nil
 }
+
+// WritePortsOverride writes a compose file publishing extra ports on the given
+// services, to pass after the project's own files. Compose reads JSON as YAML.
+// The caller removes the file once the services are up.
+func WritePortsOverride(ports map[string][]string) (string, error) {
+	services := make(map[string]interface{}, len(ports))
+	for service, published := range ports {
+		services[service] = map[string][]string{"ports": published}
+	}
+	data, err := json.Marshal(map[string]interface{}{"services": services})
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "packnplay-compose-ports-*.yml")
+	if err != nil {
+		return "", fmt.Errorf("failed to write compose ports override: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write compose ports override: %w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BundleVersion is the format version of configuration bundles
+const BundleVersion = 1
+
+// Bundle is a shareable baseline of packnplay settings, written by
+// `packnplay config export --bundle` and merged by `packnplay config import`
+type Bundle struct {
+	Version      int                    `json:"packnplay_bundle"`
+	Description  string                 `json:"description,omitempty"`
+	Settings     map[string]interface{} `json:"settings"`               // config.json settings that differ from the defaults
+	Placeholders []string               `json:"placeholders,omitempty"` // env vars whose secret values were replaced with a ${VAR} reference
+	Omitted      []string               `json:"omitted,omitempty"`      // settings left out because they hold secrets
+}
+
+// bundleExcluded are settings that only make sense on the machine they were
+// set on, are a personal choice, or run host commands, and never go into a
+// bundle ("*" matches any map key; a pattern covers the settings below it)
+var bundleExcluded = []string{
+	"schema_version",
+	"default_image", // deprecated, migrated to default_container.image
+	"active_profile",
+	"docker_config",
+	"profiles.*.docker_config",
+	"hooks", // importing a bundle must not make packnplay run its commands on the host
+}
+
+// bundleSensitive are settings that hand host credentials, secrets or env
+// vars to containers and builds, loosen their confinement, or change where
+// images and tokens come from. Importing them always asks, even where unset.
+var bundleSensitive = []string{
+	"default_credentials",
+	"profiles.*.default_credentials",
+	"build_secrets",
+	"default_env_vars",
+	"profiles.*.default_env_vars",
+	"env_configs",
+	"profiles.*.env_configs",
+	"default_env_config",
+	"docker_socket", // root on the host
+	"registry",
+	"host_bridge",
+	"security",
+	"github",
+}
+
+// secretEnvName matches env var names whose values are likely credentials
+var secretEnvName = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSW(OR)?D|API_?KEY|PRIVATE_KEY|CREDENTIAL|AUTH)`)
+
+// ExportBundle returns c's settings that differ from the defaults as a
+// bundle, without secrets: literal values of env vars named like credentials
+// (ANTHROPIC_AUTH_TOKEN) become a ${VAR} reference to the importer's own
+// environment, and proxy URLs with a password are left out. Machine-specific
+// settings such as docker_config and the active profile aren't exported.
+func (c *Config) ExportBundle(description string) (*Bundle, error) {
+	current, err := flattenConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := flattenConfig(emptyConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{Version: BundleVersion, Description: description, Settings: map[string]interface{}{}}
+	for _, key := range sortedLeafKeys(current) {
+		l := current[key]
+		if excludedFromBundle(l.path) {
+			continue
+		}
+		if d, ok := defaults[key]; (ok && reflect.DeepEqual(d.value, l.value)) || (!ok && isZeroJSON(l.value)) {
+			continue
+		}
+		value, placeholder, omit := redactSetting(l.path, l.value)
+		if omit {
+			bundle.Omitted = append(bundle.Omitted, key)
+			continue
+		}
+		if placeholder {
+			bundle.Placeholders = append(bundle.Placeholders, key)
+		}
+		setLeaf(bundle.Settings, l.path, value)
+	}
+	return bundle, nil
+}
+
+// redactSetting returns the value a setting is exported with, whether it was
+// replaced with a placeholder, and whether it must be left out
+func redactSetting(path []string, value interface{}) (interface{}, bool, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return value, false, false
+	}
+	if n := len(path); n >= 2 && path[n-2] == "env_vars" {
+		name := path[n-1]
+		if secretEnvName.MatchString(name) && !strings.HasPrefix(strings.TrimSpace(s), "${") {
+			return "${" + name + "}", true, false
+		}
+		return s, false, false
+	}
+	if len(path) == 2 && path[0] == "proxy" {
+		if u, err := url.Parse(s); err == nil && u.User != nil {
+			return nil, false, true
+		}
+	}
+	return s, false, false
+}
+
+// BundleConflict is a bundle setting whose value differs from one already
+// set, or a sensitive one (see bundleSensitive) the bundle would set
+type BundleConflict struct {
+	Key       string
+	Current   interface{} // nil if unset
+	Incoming  interface{}
+	Sensitive bool
+}
+
+// BundleImport reports what importing a bundle changed, by dotted key
+type BundleImport struct {
+	Added    []string // settings that weren't set
+	Replaced []string // conflicts resolved in favor of the bundle
+	Kept     []string // conflicts resolved in favor of the existing value
+}
+
+// ImportBundle merges a bundle's settings into c. Settings c doesn't set (or
+// leaves at their default) are added; for those set to a different value, and
+// for credential and build secret settings whatever their value, resolve
+// decides whether the bundle's value is taken. Hooks in the bundle are
+// ignored. Nothing changes if the merged configuration is invalid.
+func (c *Config) ImportBundle(bundle *Bundle, resolve func(BundleConflict) bool) (*BundleImport, error) {
+	if bundle.Version == 0 || bundle.Settings == nil {
+		return nil, fmt.Errorf("not a packnplay configuration bundle (missing packnplay_bundle or settings)")
+	}
+	if bundle.Version > BundleVersion {
+		return nil, fmt.Errorf("bundle format version %d is newer than this packnplay supports (%d); upgrade packnplay", bundle.Version, BundleVersion)
+	}
+
+	merged, err := configJSON(c)
+	if err != nil {
+		return nil, err
+	}
+	current := flatten(merged)
+	defaults, err := flattenConfig(emptyConfig())
+	if err != nil {
+		return nil, err
+	}
+	incoming := flatten(bundle.Settings)
+
+	result := &BundleImport{}
+	for _, key := range sortedLeafKeys(incoming) {
+		l := incoming[key]
+		if excludedFromBundle(l.path) {
+			continue
+		}
+		existing, ok := current[key]
+		unset := !ok || isZeroJSON(existing.value) || reflect.DeepEqual(existing.value, defaults[key].value)
+		sensitive := matchesAnyKey(bundleSensitive, l.path)
+		switch {
+		case ok && reflect.DeepEqual(existing.value, l.value):
+			continue
+		case unset && !sensitive:
+			result.Added = append(result.Added, key)
+		case resolve(BundleConflict{Key: key, Current: existing.value, Incoming: l.value, Sensitive: sensitive}):
+			if unset {
+				result.Added = append(result.Added, key)
+			} else {
+				result.Replaced = append(result.Replaced, key)
+			}
+		default:
+			result.Kept = append(result.Kept, key)
+			continue
+		}
+		setLeaf(merged, l.path, l.value)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode merged config: %w", err)
+	}
+	var updated Config
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return nil, fmt.Errorf("bundle settings don't fit config.json: %w", err)
+	}
+	updated.fileProfiles = c.fileProfiles
+	for _, key := range append(append([]string{}, result.Added...), result.Replaced...) {
+		value, ok := incoming[key].value.(string)
+		if !ok {
+			data, _ := json.Marshal(incoming[key].value)
+			value = string(data)
+		}
+		if err := validateChoice(incoming[key].path, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := updated.validateReferences(); err != nil {
+		return nil, err
+	}
+	*c = updated
+	return result, nil
+}
+
+// emptyConfig is the configuration of a fresh install
+func emptyConfig() *Config {
+	return &Config{
+		DefaultContainer: GetDefaultContainerConfig(),
+		DefaultEnvVars:   []string{},
+		EnvConfigs:       make(map[string]EnvConfig),
+	}
+}
+
+// leaf is one setting of a flattened configuration: a value that isn't a JSON
+// object, at its path of JSON names and map keys
+type leaf struct {
+	path  []string
+	value interface{}
+}
+
+// configJSON returns c as the generic JSON document config.json holds
+func configJSON(c *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return doc, nil
+}
+
+func flattenConfig(c *Config) (map[string]leaf, error) {
+	doc, err := configJSON(c)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(doc), nil
+}
+
+// flatten returns the leaves of a JSON document by dotted key. Lists are
+// single settings, as they are for `config set`.
+func flatten(doc map[string]interface{}) map[string]leaf {
+	leaves := make(map[string]leaf)
+	var walk func(path []string, value interface{})
+	walk = func(path []string, value interface{}) {
+		if object, ok := value.(map[string]interface{}); ok {
+			for name, v := range object {
+				walk(append(path[:len(path):len(path)], name), v)
+			}
+			return
+		}
+		leaves[strings.Join(path, ".")] = leaf{path: path, value: value}
+	}
+	walk(nil, doc)
+	return leaves
+}
+
+// setLeaf sets the value at path in a JSON document, creating objects along the way
+func setLeaf(doc map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := doc[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[name] = next
+		}
+		doc = next
+	}
+	doc[path[len(path)-1]] = value
+}
+
+func sortedLeafKeys(leaves map[string]leaf) []string {
+	keys := make([]string, 0, len(leaves))
+	for key := range leaves {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// excludedFromBundle reports whether a setting never goes into a bundle
+func excludedFromBundle(path []string) bool {
+	return matchesAnyKey(bundleExcluded, path)
+}
+
+// matchesAnyKey reports whether path is one of the dotted patterns or a
+// setting below one
+func matchesAnyKey(patterns []string, path []string) bool {
+	for _, pattern := range patterns {
+		p := strings.Split(pattern, ".")
+		if len(path) >= len(p) && matchKey(p, path[:len(p)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isZeroJSON reports whether a decoded JSON value is empty: null, false, 0,
+// "", or an empty list
+func isZeroJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
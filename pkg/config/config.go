@@ -6,30 +6,185 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/obra/packnplay/pkg/hooks"
 )
 
 // Config represents packnplay's configuration
 type Config struct {
-	ContainerRuntime   string                 `json:"container_runtime"` // docker, podman, or container
-	DefaultImage       string                 `json:"default_image"`     // deprecated: use DefaultContainer.Image
+	SchemaVersion      int                    `json:"schema_version"`          // see CurrentSchemaVersion
+	ContainerRuntime   string                 `json:"container_runtime"`       // docker, podman, nerdctl, lima, container, or orbstack
+	DefaultImage       string                 `json:"default_image,omitempty"` // deprecated: use DefaultContainer.Image; migrated away on load
 	DefaultCredentials Credentials            `json:"default_credentials"`
 	DefaultEnvVars     []string               `json:"default_env_vars"` // API keys to always proxy
 	EnvConfigs         map[string]EnvConfig   `json:"env_configs"`
+	DefaultEnvConfig   string                 `json:"default_env_config,omitempty"` // env config applied when --env-config isn't given
 	DefaultContainer   DefaultContainerConfig `json:"default_container"`
+	EnvFiles           EnvFilesConfig         `json:"env_files"`
+	Security           SecurityConfig         `json:"security"`
+	HostBridge         HostBridgeConfig       `json:"host_bridge"`
+	Shell              ShellConfig            `json:"shell"`
+	Proxy              ProxyConfig            `json:"proxy"`
+	DockerSocket       bool                   `json:"docker_socket,omitempty"`         // mount the host's container runtime socket into containers
+	MountExcludes      []string               `json:"mount_excludes,omitempty"`        // host paths inside mounted dirs to hide, e.g. ~/.claude/session-env
+	AgentState         AgentStateConfig       `json:"agent_state,omitempty"`           // per agent (claude, codex, ...) or "default": shared (default) or isolated
+	ForeignBinaries    string                 `json:"foreign_binaries,omitempty"`      // native binaries for another platform in mounted config dirs: warn (default), shadow, rebuild, or off
+	RestartPolicy      string                 `json:"restart_policy,omitempty"`        // containers' restart policy: no (default), on-failure, or unless-stopped
+	NoRegistryLogin    bool                   `json:"no_registry_login,omitempty"`     // don't refresh ECR/GCR/ACR logins before pulls
+	NoProjectNetwork   bool                   `json:"no_project_network,omitempty"`    // don't put a project's containers on a shared network
+	BuildContextWarnMB int                    `json:"build_context_warn_mb,omitempty"` // warn when a Dockerfile build context is larger (0: default, negative: never)
+	VulnScan           VulnScanConfig         `json:"vuln_scan"`
+	Images             ImagesConfig           `json:"images"`
+	Worktree           WorktreeConfig         `json:"worktree"`
+	Registry           RegistryConfig         `json:"registry"`
+	GitHub             GitHubConfig           `json:"github"`
+	ConfigDrift        string                 `json:"config_drift,omitempty"`        // when a reused container's configuration changed: warn (default), prompt, recreate, or ignore
+	WorkspaceOwnership string                 `json:"workspace_ownership,omitempty"` // when the container user doesn't own the workspace: auto (default), remap, or off
+	DevcontainerSearch string                 `json:"devcontainer_search,omitempty"` // where to look for devcontainer.json above the current directory: git (default), parents, or off
+	DockerConfig       string                 `json:"docker_config,omitempty"`       // DOCKER_CONFIG directory (registry logins)
+	CredentialStore    string                 `json:"credential_store,omitempty"`    // where container-managed credentials are encrypted: auto (default), keychain, secret-service, or file
+	Hooks              hooks.Hooks            `json:"hooks,omitempty"`               // host commands run around container lifecycle events
+	BuildSecrets       BuildSecretsConfig     `json:"build_secrets"`
+	SelfUpdate         SelfUpdateConfig       `json:"self_update"`
+	Profiles           map[string]Profile     `json:"profiles,omitempty"`
+	ActiveProfile      string                 `json:"active_profile,omitempty"`
+
+	fileProfiles map[string]profileFile // loaded from the profiles directory, never saved into config.json
+}
+
+// HostBridgeConfig controls the host<->container bridge for opening URLs and editors
+type HostBridgeConfig struct {
+	Enabled           bool     `json:"enabled"`
+	Actions           []string `json:"actions,omitempty"`             // allowed actions: open (default), code, clipboard
+	Clipboard         bool     `json:"clipboard,omitempty"`           // let the container copy to the host clipboard (starts the bridge even if not enabled)
+	ClipboardMaxBytes int64    `json:"clipboard_max_bytes,omitempty"` // largest clipboard copy accepted, 0 for 1 MiB
+}
+
+// BridgeActions returns the actions to allow when the bridge runs: the
+// configured actions (or, with only the clipboard enabled, none) plus clipboard
+// when it is enabled. An empty result means the bridge defaults.
+func (h HostBridgeConfig) BridgeActions(enabled bool) []string {
+	if !h.Clipboard {
+		return h.Actions
+	}
+	actions := append([]string{}, h.Actions...)
+	if len(actions) == 0 && enabled {
+		actions = []string{"open"}
+	}
+	for _, action := range actions {
+		if action == "clipboard" {
+			return actions
+		}
+	}
+	return append(actions, "clipboard")
+}
+
+// ShellConfig controls the shell bootstrap injected for the remote user: a
+// prompt showing the project and worktree, history kept in a named volume,
+// and aliases
+type ShellConfig struct {
+	Disabled  bool              `json:"disabled,omitempty"`   // don't inject the bootstrap
+	Prompt    string            `json:"prompt,omitempty"`     // prompt for bash and zsh, with {project} and {worktree} replaced; empty for the default
+	NoHistory bool              `json:"no_history,omitempty"` // don't keep shell history in the packnplay-shell-history volume
+	Aliases   map[string]string `json:"aliases,omitempty"`    // aliases added to the defaults; an empty value removes one
+}
+
+// ProxyConfig controls the HTTP proxy forwarded into image builds and
+// containers, detected from the host's proxy variables or macOS system proxy
+type ProxyConfig struct {
+	Disabled bool     `json:"disabled,omitempty"` // don't forward a proxy
+	HTTP     string   `json:"http,omitempty"`     // replaces the detected HTTP proxy
+	HTTPS    string   `json:"https,omitempty"`    // replaces the detected HTTPS proxy
+	NoProxy  []string `json:"no_proxy,omitempty"` // hosts that bypass the proxy, added to the detected ones
+}
+
+// BuildSecretsConfig lists the host sources a project's
+// customizations.packnplay.build may hand to its image build. The repository
+// controls the Dockerfile, which could copy a secret into an image layer, so
+// environment variables, files, stored secrets and SSH agent access are only
+// passed when listed here.
+type BuildSecretsConfig struct {
+	Env   []string `json:"env,omitempty"`   // environment variables builds may read
+	Files []string `json:"files,omitempty"` // host files builds may read, ~ for the home directory
+	Store []string `json:"store,omitempty"` // names of secrets set with packnplay secret set that builds may read
+	SSH   []string `json:"ssh,omitempty"`   // --ssh values builds may use, such as default
+}
+
+// SecurityConfig controls how bind mounts interact with host LSMs (SELinux/AppArmor)
+type SecurityConfig struct {
+	MountRelabel    string `json:"mount_relabel,omitempty"`    // auto (default), z, Z, or off
+	DisableLabels   bool   `json:"disable_labels,omitempty"`   // run containers with --security-opt label=disable
+	AppArmorProfile string `json:"apparmor_profile,omitempty"` // passed as --security-opt apparmor=<profile> when AppArmor is enabled
+}
+
+// SelfUpdateConfig controls packnplay's own updates
+type SelfUpdateConfig struct {
+	Channel       string `json:"channel,omitempty"`        // stable (default) or beta, which includes prereleases
+	DisableNotice bool   `json:"disable_notice,omitempty"` // don't mention new releases when running containers
+}
+
+// VulnScanConfig controls the image vulnerability scan run before a container is created
+type VulnScanConfig struct {
+	Mode     string   `json:"mode,omitempty"`     // off (default), warn, prompt, or block
+	Scanner  string   `json:"scanner,omitempty"`  // trivy, grype, or auto (default: whichever is installed)
+	Severity string   `json:"severity,omitempty"` // lowest severity the policy applies to (default: critical)
+	Ignore   []string `json:"ignore,omitempty"`   // vulnerability IDs to accept, e.g. CVE-2024-1234
+}
+
+// ImagesConfig controls which images built for projects prune removes
+type ImagesConfig struct {
+	PruneAfterDays int `json:"prune_after_days,omitempty"` // remove images unused for longer (0: 30 days, negative: never)
+	MaxTotalMB     int `json:"max_total_mb,omitempty"`     // then remove the least recently used until the rest fit (0: no limit)
+}
+
+// WorktreeConfig controls how worktrees are created for branches
+type WorktreeConfig struct {
+	From  string `json:"from,omitempty"`  // ref new branches start from, e.g. origin/main (default: the current HEAD)
+	Track string `json:"track,omitempty"` // auto (default): a branch a remote has is checked out tracking it; off: new branches start from HEAD or from
+	Path  string `json:"path,omitempty"`  // where worktrees go, with {project} and {branch}, relative to the project (default: $XDG_DATA_HOME/packnplay/worktrees/{project}/{branch})
+}
+
+// RegistryConfig routes image and feature pulls through pull-through mirrors
+type RegistryConfig struct {
+	Mirrors  map[string]string `json:"mirrors,omitempty"`  // registry host -> mirror, e.g. "ghcr.io": "harbor.corp/ghcr"
+	Fallback string            `json:"fallback,omitempty"` // when a mirror fails: origin (default) pulls from the registry itself, none fails the pull
+	Offline  bool              `json:"offline,omitempty"`  // pull nothing: use local images and cached features only
+}
+
+// GitHubConfig controls the GitHub token containers get with gh credentials
+type GitHubConfig struct {
+	TokenScope    string            `json:"token_scope,omitempty"`     // host (default) passes the host's gh token; repo mints a short-lived token for the workspace's repository
+	AppID         int64             `json:"app_id,omitempty"`          // GitHub App that mints repo tokens, installed on the repositories
+	AppPrivateKey string            `json:"app_private_key,omitempty"` // path to the App's PEM private key
+	Permissions   map[string]string `json:"permissions,omitempty"`     // repo token permissions, e.g. "contents": "write" (default: contents and pull_requests write)
+	APIURL        string            `json:"api_url,omitempty"`         // GitHub Enterprise Server API, e.g. https://github.example.com/api/v3
+}
+
+// GitHub token scopes
+const (
+	GHTokenHost = "host" // the host's gh token as it is
+	GHTokenRepo = "repo" // a token minted for the workspace's repository
+)
+
+// EnvFilesConfig controls loading workspace environment files into containerEnv
+type EnvFilesConfig struct {
+	Enabled       bool `json:"enabled"`        // load .devcontainer/devcontainer.env (opt-in, disable for untrusted repos)
+	ProjectDotEnv bool `json:"project_dotenv"` // also load the project root .env
 }
 
 // DefaultContainerConfig configures the default container and update behavior
 type DefaultContainerConfig struct {
-	Image               string `json:"image"`                 // default container image to use
-	CheckForUpdates     bool   `json:"check_for_updates"`     // whether to check for new versions
-	AutoPullUpdates     bool   `json:"auto_pull_updates"`     // whether to auto-pull new versions
-	CheckFrequencyHours int    `json:"check_frequency_hours"` // how often to check for updates
+	Image               string `json:"image"`                           // default container image to use
+	CheckForUpdates     bool   `json:"check_for_updates"`               // whether to check for new versions
+	AutoPullUpdates     bool   `json:"auto_pull_updates"`               // whether to auto-pull new versions
+	CheckFrequencyHours int    `json:"check_frequency_hours"`           // how often to check for updates
+	AutoPullBaseImages  bool   `json:"auto_pull_base_images,omitempty"` // also auto-pull devcontainer.json "image" values
 }
 
 // EnvConfig defines environment variables for different setups (API configs, etc.)
@@ -48,6 +203,90 @@ type Credentials struct {
 	GPG      bool `json:"gpg"`      // GPG keys for commit signing
 	NPM      bool `json:"npm"`      // npm credentials
 	AWS      bool `json:"aws"`      // AWS credentials
+
+	// Claude selects where ~/.claude/.credentials.json in the container comes
+	// from: auto (default), host, managed, or none
+	Claude string `json:"claude,omitempty"`
+
+	// Inject selects how each credential type reaches the container, keyed by
+	// credential type ("git", "npm", "aws"). Defaults to InjectMount.
+	Inject map[string]string `json:"inject,omitempty"`
+}
+
+// Credential injection modes
+const (
+	InjectMount = "mount" // bind mount host files (default)
+	InjectCopy  = "copy"  // copy sanitized files in at start, scrub on stop
+)
+
+// Claude credential sources
+const (
+	ClaudeCredsAuto    = "auto"    // the host's file if it holds credentials, otherwise managed
+	ClaudeCredsHost    = "host"    // always the host's ~/.claude/.credentials.json
+	ClaudeCredsManaged = "managed" // a container-managed file shared by containers, kept in the credential store
+	ClaudeCredsNone    = "none"    // packnplay doesn't provide credentials; ~/.claude is mounted as is
+)
+
+// ClaudeMode returns the configured Claude credential source, auto if unset
+func (c Credentials) ClaudeMode() string {
+	if c.Claude == "" {
+		return ClaudeCredsAuto
+	}
+	return c.Claude
+}
+
+// InjectableCredentials are the credential types that can be copied in
+var InjectableCredentials = []string{"git", "npm", "aws"}
+
+// validateInjection rejects unknown credential types and injection modes,
+// which would otherwise silently fall back to mounting the host files
+func (c Credentials) validateInjection() error {
+	for credType, mode := range c.Inject {
+		if !slices.Contains(InjectableCredentials, credType) {
+			return fmt.Errorf("default_credentials.inject.%s: unknown credential type (use %s)", credType, strings.Join(InjectableCredentials, ", "))
+		}
+		if mode != InjectMount && mode != InjectCopy {
+			return fmt.Errorf("default_credentials.inject.%s: unknown mode %q (use %s or %s)", credType, mode, InjectMount, InjectCopy)
+		}
+	}
+	return nil
+}
+
+// InjectionMode returns the injection mode configured for a credential type
+func (c Credentials) InjectionMode(credType string) string {
+	if mode, ok := c.Inject[credType]; ok && mode == InjectCopy {
+		return InjectCopy
+	}
+	return InjectMount
+}
+
+// AgentStateConfig selects, per agent name or "default", whether containers
+// share the host's agent config dir (~/.claude, ~/.codex, ...) or each
+// project and worktree keeps its own
+type AgentStateConfig map[string]string
+
+// Agent state modes
+const (
+	AgentStateShared   = "shared"   // mount the host's config dir into every container (default)
+	AgentStateIsolated = "isolated" // a volume per container, seeded from the agent's template
+)
+
+// Mode returns the state mode configured for an agent
+func (a AgentStateConfig) Mode(agent string) string {
+	mode, ok := a[agent]
+	if !ok {
+		mode = a["default"]
+	}
+	if mode == AgentStateIsolated {
+		return AgentStateIsolated
+	}
+	return AgentStateShared
+}
+
+// AgentTemplateDir returns the directory an isolated agent's new state
+// volume is seeded from
+func AgentTemplateDir(agent string) string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), "agent-templates", agent)
 }
 
 // GetDefaultImage returns the configured default image or fallback
@@ -75,8 +314,19 @@ func GetDefaultContainerConfig() DefaultContainerConfig {
 
 // VersionTrackingData persists notification history to avoid spam
 type VersionTrackingData struct {
-	LastCheck     time.Time                      `json:"last_check"`
-	Notifications map[string]VersionNotification `json:"notifications"`
+	LastCheck       time.Time                      `json:"last_check"`
+	Notifications   map[string]VersionNotification `json:"notifications"`
+	BaseImageChecks map[string]time.Time           `json:"base_image_checks,omitempty"` // last check per project base image
+	AutoPulls       map[string]AutoPull            `json:"auto_pulls,omitempty"`        // background pulls not yet reported
+	SelfUpdateCheck time.Time                      `json:"self_update_check,omitempty"` // last check for a new packnplay release
+}
+
+// AutoPull records a background pull started for a newer image version
+type AutoPull struct {
+	FromDigest  string    `json:"from_digest"`
+	FromCreated time.Time `json:"from_created"`
+	ToDigest    string    `json:"to_digest"`
+	StartedAt   time.Time `json:"started_at"`
 }
 
 // VersionNotification tracks when we notified about a specific image version
@@ -119,7 +369,9 @@ func LoadVersionTracking(filePath string) (*VersionTrackingData, error) {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		// Return empty tracking data
 		return &VersionTrackingData{
-			Notifications: make(map[string]VersionNotification),
+			Notifications:   make(map[string]VersionNotification),
+			BaseImageChecks: make(map[string]time.Time),
+			AutoPulls:       make(map[string]AutoPull),
 		}, nil
 	}
 
@@ -133,10 +385,16 @@ func LoadVersionTracking(filePath string) (*VersionTrackingData, error) {
 		return nil, fmt.Errorf("failed to parse tracking data: %w", err)
 	}
 
-	// Initialize map if nil
+	// Initialize maps if nil
 	if tracking.Notifications == nil {
 		tracking.Notifications = make(map[string]VersionNotification)
 	}
+	if tracking.BaseImageChecks == nil {
+		tracking.BaseImageChecks = make(map[string]time.Time)
+	}
+	if tracking.AutoPulls == nil {
+		tracking.AutoPulls = make(map[string]AutoPull)
+	}
 
 	return &tracking, nil
 }
@@ -173,17 +431,16 @@ type ConfigUpdates struct {
 	ContainerRuntime   *string                 `json:"container_runtime,omitempty"`
 	DefaultCredentials *Credentials            `json:"default_credentials,omitempty"`
 	DefaultContainer   *DefaultContainerConfig `json:"default_container,omitempty"`
+	ActiveProfile      *string                 `json:"active_profile,omitempty"`
+	EnvConfigs         *map[string]EnvConfig   `json:"env_configs,omitempty"`
+	DefaultEnvConfig   *string                 `json:"default_env_config,omitempty"`
 }
 
 // LoadExistingOrEmpty loads config from file or returns empty config if file doesn't exist
 func LoadExistingOrEmpty(configPath string) (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		// Return empty config with defaults
-		return &Config{
-			DefaultContainer: GetDefaultContainerConfig(),
-			DefaultEnvVars:   []string{},
-			EnvConfigs:       make(map[string]EnvConfig),
-		}, nil
+		return emptyConfig(), nil
 	}
 
 	return LoadConfigFromFile(configPath)
@@ -191,17 +448,16 @@ func LoadExistingOrEmpty(configPath string) (*Config, error) {
 
 // LoadConfigFromFile loads config from specified file
 func LoadConfigFromFile(configPath string) (*Config, error) {
-	data, err := os.ReadFile(configPath)
+	cfg, err := readConfigFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if err := cfg.loadProfileFiles(filepath.Join(filepath.Dir(configPath), "profiles")); err != nil {
+		return nil, err
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
 // UpdateConfigSafely updates only specified fields, preserving others
@@ -218,11 +474,35 @@ func UpdateConfigSafely(configPath string, updates ConfigUpdates) error {
 	}
 
 	if updates.DefaultCredentials != nil {
+		inject, claude := cfg.DefaultCredentials.Inject, cfg.DefaultCredentials.Claude
 		cfg.DefaultCredentials = *updates.DefaultCredentials
+		// Injection modes and the Claude credential source aren't editable in
+		// the UI, keep hand-edited values
+		if cfg.DefaultCredentials.Inject == nil {
+			cfg.DefaultCredentials.Inject = inject
+		}
+		if cfg.DefaultCredentials.Claude == "" {
+			cfg.DefaultCredentials.Claude = claude
+		}
 	}
 
 	if updates.DefaultContainer != nil {
+		baseImages := cfg.DefaultContainer.AutoPullBaseImages
 		cfg.DefaultContainer = *updates.DefaultContainer
+		// Base image auto-pull isn't editable in the UI, keep the hand-edited value
+		cfg.DefaultContainer.AutoPullBaseImages = baseImages
+	}
+
+	if updates.ActiveProfile != nil {
+		cfg.ActiveProfile = *updates.ActiveProfile
+	}
+
+	if updates.EnvConfigs != nil {
+		cfg.EnvConfigs = *updates.EnvConfigs
+	}
+
+	if updates.DefaultEnvConfig != nil {
+		cfg.DefaultEnvConfig = *updates.DefaultEnvConfig
 	}
 
 	// Save updated config
@@ -246,6 +526,7 @@ func SaveConfig(cfg *Config, configPath string) error {
 	}
 
 	// Marshal and save
+	cfg.SchemaVersion = CurrentSchemaVersion
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
@@ -559,7 +840,10 @@ type SettingsModal struct {
 	quitting       bool
 	width          int
 	height         int
-	scrollOffset   int // Current scroll position in lines
+	scrollOffset   int             // Current scroll position in lines
+	loaded         []byte          // config file contents the settings were loaded from
+	edited         map[string]bool // fields the user changed, kept when the file is reloaded
+	notice         string          // shown under the header, e.g. after a reload
 }
 
 // SettingsSection represents a configuration section
@@ -685,6 +969,7 @@ func createSettingsModal(existing *Config) *SettingsModal {
 				},
 			},
 		},
+		envConfigsSection(existing),
 	}
 
 	// Initialize text input component
@@ -775,7 +1060,7 @@ func navigateToNextSection(modal *SettingsModal) *SettingsModal {
 // runSettingsModal runs the settings modal interface
 func runSettingsModal(existing *Config, configPath string, verbose bool) error {
 	modal := createSettingsModal(existing)
-	modal.configPath = configPath
+	modal.watchConfigFile(configPath)
 
 	program := tea.NewProgram(modal, tea.WithAltScreen())
 	finalModel, err := program.Run()
@@ -784,6 +1069,8 @@ func runSettingsModal(existing *Config, configPath string, verbose bool) error {
 	}
 
 	if finalModel, ok := finalModel.(*SettingsModal); ok && finalModel.saved {
+		// Pick up changes made since the last check rather than overwriting them
+		finalModel.reloadIfChanged()
 		return applyModalConfigUpdates(finalModel, configPath)
 	}
 
@@ -793,7 +1080,12 @@ func runSettingsModal(existing *Config, configPath string, verbose bool) error {
 // applyModalConfigUpdates applies settings modal changes safely
 func applyModalConfigUpdates(modal *SettingsModal, configPath string) error {
 	runtime := ""
-	creds := Credentials{Git: true}
+	// Start from the loaded credentials so settings the modal doesn't show
+	// (git) keep their value; new configs always copy .gitconfig
+	creds := modal.config.DefaultCredentials
+	if modal.loaded == nil {
+		creds.Git = true
+	}
 	var containerConfig *DefaultContainerConfig
 
 	// Extract values from modal sections
@@ -838,10 +1130,17 @@ func applyModalConfigUpdates(modal *SettingsModal, configPath string) error {
 		}
 	}
 
+	envConfigs, defaultEnvConfig, err := envConfigUpdates(modal.config, modal)
+	if err != nil {
+		return err
+	}
+
 	updates := ConfigUpdates{
 		ContainerRuntime:   &runtime,
 		DefaultCredentials: &creds,
 		DefaultContainer:   containerConfig,
+		EnvConfigs:         envConfigs,
+		DefaultEnvConfig:   defaultEnvConfig,
 	}
 
 	return UpdateConfigSafely(configPath, updates)
@@ -930,6 +1229,9 @@ func getDefaultImageValue(cfg *Config) string {
 
 // Init implements tea.Model for SettingsModal
 func (m *SettingsModal) Init() tea.Cmd {
+	if m.configPath != "" {
+		return checkConfigFile()
+	}
 	return nil
 }
 
@@ -940,6 +1242,10 @@ func (m *SettingsModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 
+	case configCheckMsg:
+		m.reloadIfChanged()
+		return m, checkConfigFile()
+
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "q", "esc":
@@ -986,6 +1292,7 @@ func (m *SettingsModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				currentField := m.getCurrentField()
 				if currentField != nil {
 					currentField.value = m.textInput.Value()
+					m.markEdited(currentField)
 				}
 				m.textEditing = false
 			} else {
@@ -993,6 +1300,10 @@ func (m *SettingsModal) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				currentField := m.getCurrentField()
 				if currentField != nil && currentField.fieldType == "text" {
 					// Enter text editing mode
+					m.textInput.Placeholder = "Enter container image..."
+					if strings.HasPrefix(currentField.name, envConfigFieldPrefix) {
+						m.textInput.Placeholder = "KEY=VALUE; KEY2=${localEnv:VAR}"
+					}
 					m.textInput.SetValue(currentField.value.(string))
 					m.textInput.Focus()
 					m.textEditing = true
@@ -1103,6 +1414,9 @@ func (m *SettingsModal) activateCurrentField() *SettingsModal {
 	}
 
 	field := &section.fields[m.currentField]
+	if field.fieldType == "toggle" || field.fieldType == "select" {
+		m.markEdited(field)
+	}
 	switch field.fieldType {
 	case "toggle":
 		if val, ok := field.value.(bool); ok {
@@ -1140,6 +1454,9 @@ func (m *SettingsModal) renderModal() string {
 		Width(m.width)
 
 	allLines = append(allLines, headerStyle.Render("packnplay Configuration"))
+	if m.notice != "" {
+		allLines = append(allLines, lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render(m.notice))
+	}
 	allLines = append(allLines, "")
 
 	// Track line numbers for current focused field for auto-scrolling
@@ -1471,15 +1788,14 @@ func Load() (*Config, error) {
 		return interactiveSetup(configPath)
 	}
 
-	// Load existing config
-	data, err := os.ReadFile(configPath)
+	// Load existing config, upgrading it to the current schema
+	cfg, err := readConfigFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if err := cfg.loadProfileFiles(filepath.Join(filepath.Dir(configPath), "profiles")); err != nil {
+		return nil, err
 	}
 
 	// If container_runtime is not set, prompt for it
@@ -1487,12 +1803,7 @@ func Load() (*Config, error) {
 		return interactiveSetup(configPath)
 	}
 
-	// Set default image if not configured (backward compatibility)
-	if cfg.DefaultImage == "" {
-		cfg.DefaultImage = "ghcr.io/obra/packnplay/devcontainer:latest"
-	}
-
-	return &cfg, nil
+	return cfg, nil
 }
 
 // LoadWithoutRuntimeCheck loads config without prompting for runtime
@@ -1504,23 +1815,17 @@ func LoadWithoutRuntimeCheck() (*Config, error) {
 		return nil, fmt.Errorf("config not found")
 	}
 
-	// Load existing config
-	data, err := os.ReadFile(configPath)
+	// Load existing config, upgrading it to the current schema
+	cfg, err := readConfigFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return nil, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	if err := cfg.loadProfileFiles(filepath.Join(filepath.Dir(configPath), "profiles")); err != nil {
+		return nil, err
 	}
 
-	// Set default image if not configured (backward compatibility)
-	if cfg.DefaultImage == "" {
-		cfg.DefaultImage = "ghcr.io/obra/packnplay/devcontainer:latest"
-	}
-
-	return &cfg, nil
+	return cfg, nil
 }
 
 // Save saves the config to disk
@@ -1532,6 +1837,7 @@ func Save(cfg *Config) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	cfg.SchemaVersion = CurrentSchemaVersion
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
@@ -1577,7 +1883,7 @@ func interactiveSetup(configPath string) (*Config, error) {
 // runScrollableSections runs a scrollable section-based configuration using SettingsModal
 func runScrollableSections(existing *Config, configPath string, verbose bool) error {
 	modal := createSettingsModal(existing)
-	modal.configPath = configPath
+	modal.watchConfigFile(configPath)
 
 	program := tea.NewProgram(modal, tea.WithAltScreen())
 	finalModel, err := program.Run()
@@ -1586,6 +1892,8 @@ func runScrollableSections(existing *Config, configPath string, verbose bool) er
 	}
 
 	if finalModel, ok := finalModel.(*SettingsModal); ok && finalModel.saved {
+		// Pick up changes made since the last check rather than overwriting them
+		finalModel.reloadIfChanged()
 		return applyModalConfigUpdates(finalModel, configPath)
 	}
 
@@ -1596,7 +1904,7 @@ func runScrollableSections(existing *Config, configPath string, verbose bool) er
 func detectAvailableRuntimes() []string {
 	// Note: Apple Container support disabled due to incompatibilities
 	// See: https://github.com/obra/packnplay/issues/1
-	runtimes := []string{"docker", "podman"}
+	runtimes := []string{"docker", "podman", "nerdctl"}
 	var available []string
 
 	for _, runtime := range runtimes {
@@ -1605,6 +1913,11 @@ func detectAvailableRuntimes() []string {
 		}
 	}
 
+	// Lima runs nerdctl in its VM through a wrapper
+	if _, err := exec.LookPath("nerdctl.lima"); err == nil {
+		available = append(available, "lima")
+	}
+
 	// Check for OrbStack as an additional option
 	// OrbStack provides Docker-compatible CLI but can be explicitly selected
 	if isOrbStackAvailable() {
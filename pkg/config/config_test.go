@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -203,7 +204,81 @@ func TestConfig_AWSCredentials(t *testing.T) {
 	}
 }
 
+func TestCredentials_InjectionMode(t *testing.T) {
+	creds := Credentials{
+		Git:    true,
+		NPM:    true,
+		Inject: map[string]string{"git": InjectCopy, "npm": "bogus"},
+	}
+
+	if got := creds.InjectionMode("git"); got != InjectCopy {
+		t.Errorf("InjectionMode(git) = %q, want %q", got, InjectCopy)
+	}
+	if got := creds.InjectionMode("npm"); got != InjectMount {
+		t.Errorf("InjectionMode(npm) = %q, want %q for unknown mode", got, InjectMount)
+	}
+	if got := creds.InjectionMode("aws"); got != InjectMount {
+		t.Errorf("InjectionMode(aws) = %q, want %q by default", got, InjectMount)
+	}
+}
+
+func TestLoadConfigFromFileRejectsUnknownInjection(t *testing.T) {
+	tests := map[string]string{
+		"mode":         `{"default_credentials": {"inject": {"npm": "cpy"}}}`,
+		"type":         `{"default_credentials": {"inject": {"ssh": "copy"}}}`,
+		"profile mode": `{"profiles": {"work": {"default_credentials": {"inject": {"git": "Copy"}}}}}`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadConfigFromFile(configPath); err == nil || !strings.Contains(err.Error(), "default_credentials.inject") {
+				t.Errorf("LoadConfigFromFile() error = %v, want the inject setting rejected", err)
+			}
+		})
+	}
+}
+
+func TestAgentStateConfig_Mode(t *testing.T) {
+	var unset AgentStateConfig
+	if got := unset.Mode("claude"); got != AgentStateShared {
+		t.Errorf("Mode(claude) = %q, want %q by default", got, AgentStateShared)
+	}
+
+	settings := AgentStateConfig{"default": AgentStateIsolated, "codex": AgentStateShared}
+	if got := settings.Mode("claude"); got != AgentStateIsolated {
+		t.Errorf("Mode(claude) = %q, want the default %q", got, AgentStateIsolated)
+	}
+	if got := settings.Mode("codex"); got != AgentStateShared {
+		t.Errorf("Mode(codex) = %q, want %q", got, AgentStateShared)
+	}
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
+
+func TestHostBridgeConfigBridgeActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HostBridgeConfig
+		enabled bool
+		want    []string
+	}{
+		{"clipboard off", HostBridgeConfig{Actions: []string{"code"}}, true, []string{"code"}},
+		{"clipboard only", HostBridgeConfig{Clipboard: true}, false, []string{"clipboard"}},
+		{"clipboard with default actions", HostBridgeConfig{Enabled: true, Clipboard: true}, true, []string{"open", "clipboard"}},
+		{"clipboard with configured actions", HostBridgeConfig{Actions: []string{"open", "code"}, Clipboard: true}, true, []string{"open", "code", "clipboard"}},
+		{"clipboard already listed", HostBridgeConfig{Actions: []string{"clipboard"}, Clipboard: true}, true, []string{"clipboard"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.BridgeActions(tt.enabled); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("BridgeActions(%v) = %v, want %v", tt.enabled, got, tt.want)
+			}
+		})
+	}
+}
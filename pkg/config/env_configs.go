@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// noEnvConfig is the settings modal option for running without a default env config
+const noEnvConfig = "none"
+
+// envVarSeparator separates KEY=VALUE pairs when env vars are edited as one line
+const envVarSeparator = "; "
+
+// EnvConfigNames returns the names of the configured env configs, sorted
+func (c *Config) EnvConfigNames() []string {
+	names := make([]string, 0, len(c.EnvConfigs))
+	for name := range c.EnvConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupEnvConfig returns the named env config, listing the available ones if it doesn't exist
+func (c *Config) LookupEnvConfig(name string) (EnvConfig, error) {
+	if envConfig, ok := c.EnvConfigs[name]; ok {
+		return envConfig, nil
+	}
+	names := c.EnvConfigNames()
+	if len(names) == 0 {
+		return EnvConfig{}, fmt.Errorf("environment config '%s' not found: no env configs are defined (add one with: packnplay env-config add)", name)
+	}
+	return EnvConfig{}, fmt.Errorf("environment config '%s' not found (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ParseEnvAssignment splits a KEY=VALUE argument
+func ParseEnvAssignment(assignment string) (string, string, error) {
+	key, value, ok := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", fmt.Errorf("invalid env var %q: expected KEY=VALUE", assignment)
+	}
+	return key, value, nil
+}
+
+// FormatEnvVars renders env vars as one line of sorted KEY=VALUE pairs
+func FormatEnvVars(envVars map[string]string) string {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + envVars[key]
+	}
+	return strings.Join(pairs, envVarSeparator)
+}
+
+// ParseEnvVars parses a line written by FormatEnvVars
+func ParseEnvVars(line string) (map[string]string, error) {
+	envVars := make(map[string]string)
+	for _, pair := range strings.Split(line, strings.TrimSpace(envVarSeparator)) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, err := ParseEnvAssignment(strings.TrimSpace(pair))
+		if err != nil {
+			return nil, err
+		}
+		envVars[key] = value
+	}
+	return envVars, nil
+}
+
+// envConfigsSection builds the settings modal section for env configs: the
+// default used by `packnplay run` and each config's variables
+func envConfigsSection(existing *Config) SettingsSection {
+	defaultName := existing.DefaultEnvConfig
+	if defaultName == "" {
+		defaultName = noEnvConfig
+	}
+	fields := []SettingsField{
+		{
+			name:        "default-env-config",
+			fieldType:   "select",
+			title:       "Default env config",
+			description: "Applied by packnplay run when --env-config isn't given",
+			value:       defaultName,
+			options:     append([]string{noEnvConfig}, existing.EnvConfigNames()...),
+		},
+	}
+	for _, name := range existing.EnvConfigNames() {
+		envConfig := existing.EnvConfigs[name]
+		description := envConfig.Description
+		if description == "" {
+			description = envConfig.Name
+		}
+		fields = append(fields, SettingsField{
+			name:        envConfigFieldPrefix + name,
+			fieldType:   "text",
+			title:       name,
+			description: description,
+			value:       FormatEnvVars(envConfig.EnvVars),
+		})
+	}
+
+	return SettingsSection{
+		name:        "env-configs",
+		title:       "Environment Configs",
+		description: "Named sets of env vars selected with --env-config (KEY=VALUE pairs separated by ;)",
+		fields:      fields,
+	}
+}
+
+// envConfigFieldPrefix prefixes settings field names holding an env config's variables
+const envConfigFieldPrefix = "env-config:"
+
+// envConfigUpdates collects env config edits from the settings modal. Edited
+// variables replace a config's env_vars; its name and description are kept.
+func envConfigUpdates(existing *Config, modal *SettingsModal) (*map[string]EnvConfig, *string, error) {
+	if existing == nil {
+		return nil, nil, nil
+	}
+	var defaultName *string
+	updated := make(map[string]EnvConfig, len(existing.EnvConfigs))
+	for name, envConfig := range existing.EnvConfigs {
+		updated[name] = envConfig
+	}
+
+	for _, section := range modal.sections {
+		for _, field := range section.fields {
+			switch {
+			case field.name == "default-env-config":
+				value := field.value.(string)
+				if value == noEnvConfig {
+					value = ""
+				}
+				defaultName = &value
+			case strings.HasPrefix(field.name, envConfigFieldPrefix):
+				name := strings.TrimPrefix(field.name, envConfigFieldPrefix)
+				envVars, err := ParseEnvVars(field.value.(string))
+				if err != nil {
+					return nil, nil, fmt.Errorf("env config %s: %w", name, err)
+				}
+				envConfig := updated[name]
+				envConfig.EnvVars = envVars
+				updated[name] = envConfig
+			}
+		}
+	}
+
+	if defaultName == nil {
+		return nil, nil, nil
+	}
+	return &updated, defaultName, nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatAndParseEnvVars(t *testing.T) {
+	envVars := map[string]string{
+		"ANTHROPIC_BASE_URL":   "https://api.z.ai/api/anthropic",
+		"ANTHROPIC_AUTH_TOKEN": "${localEnv:Z_AI_API_KEY}",
+		"EXTRA":                "a=b",
+	}
+	line := FormatEnvVars(envVars)
+	if line != "ANTHROPIC_AUTH_TOKEN=${localEnv:Z_AI_API_KEY}; ANTHROPIC_BASE_URL=https://api.z.ai/api/anthropic; EXTRA=a=b" {
+		t.Errorf("FormatEnvVars() = %q", line)
+	}
+
+	parsed, err := ParseEnvVars(line)
+	if err != nil {
+		t.Fatalf("ParseEnvVars() error = %v", err)
+	}
+	if len(parsed) != len(envVars) || parsed["EXTRA"] != "a=b" {
+		t.Errorf("ParseEnvVars() = %v", parsed)
+	}
+
+	if _, err := ParseEnvVars("GOOD=1; not a pair"); err == nil {
+		t.Error("ParseEnvVars() should reject entries without =")
+	}
+	if parsed, err := ParseEnvVars(""); err != nil || len(parsed) != 0 {
+		t.Errorf("ParseEnvVars(\"\") = %v, %v", parsed, err)
+	}
+}
+
+func TestLookupEnvConfig(t *testing.T) {
+	cfg := &Config{EnvConfigs: map[string]EnvConfig{"z.ai": {}, "anthropic-work": {}}}
+	if _, err := cfg.LookupEnvConfig("z.ai"); err != nil {
+		t.Errorf("LookupEnvConfig() error = %v", err)
+	}
+	_, err := cfg.LookupEnvConfig("zai")
+	if err == nil || !strings.Contains(err.Error(), "available: anthropic-work, z.ai") {
+		t.Errorf("LookupEnvConfig() error = %v, want the available names", err)
+	}
+}
+
+func TestSettingsModalEnvConfigs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	existing := &Config{
+		ContainerRuntime: "docker",
+		DefaultContainer: GetDefaultContainerConfig(),
+		EnvConfigs: map[string]EnvConfig{
+			"z.ai": {Name: "Z.AI", Description: "Z.AI endpoints", EnvVars: map[string]string{"ANTHROPIC_BASE_URL": "https://api.z.ai"}},
+		},
+	}
+	if err := SaveConfig(existing, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	modal := createSettingsModal(existing)
+	var section *SettingsSection
+	for i := range modal.sections {
+		if modal.sections[i].name == "env-configs" {
+			section = &modal.sections[i]
+		}
+	}
+	if section == nil || len(section.fields) != 2 {
+		t.Fatalf("env configs section = %+v", section)
+	}
+	if section.fields[0].value != noEnvConfig {
+		t.Errorf("default env config = %v, want %s", section.fields[0].value, noEnvConfig)
+	}
+
+	// Pick z.ai as the default and edit its variables
+	section.fields[0].value = "z.ai"
+	section.fields[1].value = "ANTHROPIC_BASE_URL=https://proxy.example.com; API_TIMEOUT_MS=3000"
+	if err := applyModalConfigUpdates(modal, configPath); err != nil {
+		t.Fatalf("applyModalConfigUpdates() error = %v", err)
+	}
+
+	saved, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.DefaultEnvConfig != "z.ai" {
+		t.Errorf("DefaultEnvConfig = %q, want z.ai", saved.DefaultEnvConfig)
+	}
+	got := saved.EnvConfigs["z.ai"]
+	if got.EnvVars["ANTHROPIC_BASE_URL"] != "https://proxy.example.com" || got.EnvVars["API_TIMEOUT_MS"] != "3000" {
+		t.Errorf("EnvVars = %v", got.EnvVars)
+	}
+	if got.Description != "Z.AI endpoints" {
+		t.Errorf("Description = %q, should be kept", got.Description)
+	}
+}
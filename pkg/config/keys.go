@@ -0,0 +1,344 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyChoices lists the accepted values of settings that take one of a fixed
+// set, keyed by dotted key ("*" matches any map key)
+var keyChoices = map[string][]string{
+	"container_runtime":            {"docker", "podman", "nerdctl", "lima", "container", "orbstack"},
+	"credential_store":             {"auto", "keychain", "secret-service", "file"},
+	"security.mount_relabel":       {"auto", "z", "Z", "off"},
+	"self_update.channel":          {"stable", "beta"},
+	"config_drift":                 {"warn", "prompt", "recreate", "ignore"},
+	"vuln_scan.mode":               {"off", "warn", "prompt", "block"},
+	"workspace_ownership":          {"auto", "remap", "off"},
+	"foreign_binaries":             {"warn", "shadow", "rebuild", "off"},
+	"restart_policy":               {"no", "on-failure", "unless-stopped"},
+	"github.token_scope":           {GHTokenHost, GHTokenRepo},
+	"devcontainer_search":          {"git", "parents", "off"},
+	"worktree.track":               {"auto", "off"},
+	"registry.fallback":            {"origin", "none"},
+	"vuln_scan.scanner":            {"auto", "trivy", "grype"},
+	"vuln_scan.severity":           {"unknown", "negligible", "low", "medium", "high", "critical"},
+	"default_credentials.inject.*": {InjectMount, InjectCopy},
+	"default_credentials.claude":   {ClaudeCredsAuto, ClaudeCredsHost, ClaudeCredsManaged, ClaudeCredsNone},
+	"host_bridge.actions":          {"open", "code", "clipboard"},
+	"agent_state.*":                {AgentStateShared, AgentStateIsolated},
+}
+
+// GetValue returns the setting at a dotted key, such as
+// default_credentials.ssh or env_configs.work.env_vars. Keys are the JSON
+// field names in config.json; map entries are addressed by their key.
+func (c *Config) GetValue(key string) (interface{}, error) {
+	path, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(c).Elem()
+	for i, name := range path {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, fmt.Errorf("%s is not set", strings.Join(path[:i], "."))
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByJSONName(v, name)
+			if !ok {
+				return nil, unknownKeyError(path[:i+1], v)
+			}
+			v = field
+		case reflect.Map:
+			elem := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+			if !elem.IsValid() {
+				return nil, fmt.Errorf("%s is not set", strings.Join(path[:i+1], "."))
+			}
+			v = elem
+		default:
+			return nil, fmt.Errorf("%s is a %s, not a group of settings", strings.Join(path[:i], "."), typeName(v.Type()))
+		}
+	}
+	return v.Interface(), nil
+}
+
+// SetValue parses value for the type of the setting at key and sets it.
+// Booleans accept true/false, lists a JSON array or comma-separated items, and
+// objects JSON.
+func (c *Config) SetValue(key, value string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	if err := validateChoice(path, value); err != nil {
+		return err
+	}
+
+	updated := *c
+	if err := setPath(reflect.ValueOf(&updated).Elem(), path, 0, func(v reflect.Value) error {
+		parsed, err := parseValue(v.Type(), value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		v.Set(parsed)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := updated.validateReferences(); err != nil {
+		return err
+	}
+	*c = updated
+	return nil
+}
+
+// UnsetValue resets the setting at key to its default, or removes a map entry
+func (c *Config) UnsetValue(key string) error {
+	path, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	updated := *c
+	if err := setPath(reflect.ValueOf(&updated).Elem(), path, 0, nil); err != nil {
+		return err
+	}
+	if err := updated.validateReferences(); err != nil {
+		return err
+	}
+	*c = updated
+	return nil
+}
+
+// validateReferences checks settings that name other settings
+func (c *Config) validateReferences() error {
+	if c.DefaultEnvConfig != "" {
+		if _, ok := c.EnvConfigs[c.DefaultEnvConfig]; !ok {
+			return fmt.Errorf("default_env_config: no env config named %q (available: %s)", c.DefaultEnvConfig, strings.Join(c.EnvConfigNames(), ", "))
+		}
+	}
+	if c.ActiveProfile != "" {
+		if _, ok := c.Profile(c.ActiveProfile); !ok {
+			return c.ApplyProfile(c.ActiveProfile) // reports the available profiles
+		}
+	}
+	return nil
+}
+
+// setPath walks path from v and calls set on the setting it names, creating
+// maps, map entries, and pointers along the way. A nil set unsets it.
+func setPath(v reflect.Value, path []string, i int, set func(reflect.Value) error) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if set == nil {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), path, i, set)
+	}
+	if i == len(path) {
+		if set == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return set(v)
+	}
+
+	name := path[i]
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := fieldByJSONName(v, name)
+		if !ok {
+			return unknownKeyError(path[:i+1], v)
+		}
+		return setPath(field, path, i+1, set)
+
+	case reflect.Map:
+		mapKey := reflect.ValueOf(name).Convert(v.Type().Key())
+		existing := v.MapIndex(mapKey)
+		if set == nil && !existing.IsValid() {
+			return nil
+		}
+
+		// Maps are copied rather than modified, since the caller's config
+		// shares them until the update is validated
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len()+1)
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), iter.Value())
+		}
+		if set == nil && i == len(path)-1 {
+			copied.SetMapIndex(mapKey, reflect.Value{})
+			v.Set(copied)
+			return nil
+		}
+
+		// Map entries can't be modified in place: copy, update, store back
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := setPath(elem, path, i+1, set); err != nil {
+			return err
+		}
+		copied.SetMapIndex(mapKey, elem)
+		v.Set(copied)
+		return nil
+	}
+	return fmt.Errorf("%s is a %s, not a group of settings", strings.Join(path[:i], "."), typeName(v.Type()))
+}
+
+// parseValue parses a command-line value as type t
+func parseValue(t reflect.Type, value string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return v, fmt.Errorf("expected true or false, got %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("expected a whole number, got %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			items := []string{}
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items).Convert(t))
+			return v, nil
+		}
+		fallthrough
+	default:
+		if err := json.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+			return v, fmt.Errorf("expected JSON for a %s: %w", typeName(t), err)
+		}
+	}
+	return v, nil
+}
+
+// validateChoice checks value against keyChoices. List items are checked one by one.
+func validateChoice(path []string, value string) error {
+	for pattern, choices := range keyChoices {
+		if !matchKey(strings.Split(pattern, "."), path) {
+			continue
+		}
+		values := []string{value}
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			if err := json.Unmarshal([]byte(value), &values); err != nil {
+				return nil // reported as a type error when parsed
+			}
+		} else if strings.Contains(value, ",") {
+			values = strings.Split(value, ",")
+		}
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if v != "" && !containsString(choices, v) {
+				return fmt.Errorf("invalid value %q for %s (use %s)", v, strings.Join(path, "."), strings.Join(choices, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func matchKey(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func splitKey(key string) ([]string, error) {
+	path := strings.Split(key, ".")
+	for _, part := range path {
+		if part == "" {
+			return nil, fmt.Errorf("invalid key %q: expected dotted names such as default_credentials.ssh", key)
+		}
+	}
+	return path, nil
+}
+
+// fieldByJSONName returns the exported field of struct v saved as name in JSON
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if jsonName(v.Type().Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// jsonName returns the JSON name of a struct field, or "" if it isn't saved
+func jsonName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func unknownKeyError(path []string, v reflect.Value) error {
+	var names []string
+	for i := 0; i < v.NumField(); i++ {
+		if name := jsonName(v.Type().Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	parent := "config.json"
+	if len(path) > 1 {
+		parent = strings.Join(path[:len(path)-1], ".")
+	}
+	return fmt.Errorf("unknown key %s (%s has: %s)", strings.Join(path, "."), parent, strings.Join(names, ", "))
+}
+
+// typeName describes a setting's type for error messages
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice:
+		return "list"
+	case reflect.Int, reflect.Int64:
+		return "number"
+	}
+	return t.Kind().String()
+}
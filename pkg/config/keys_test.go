@@ -0,0 +1,96 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetValueParsesByType(t *testing.T) {
+	cfg := &Config{}
+	tests := []struct {
+		key, value string
+		want       interface{}
+	}{
+		{"container_runtime", "podman", "podman"},
+		{"default_credentials.ssh", "true", true},
+		{"default_container.check_frequency_hours", "12", 12},
+		{"default_env_vars", "ANTHROPIC_API_KEY, GH_TOKEN", []string{"ANTHROPIC_API_KEY", "GH_TOKEN"}},
+		{"mount_excludes", `["~/.claude/a,b"]`, []string{"~/.claude/a,b"}},
+		{"env_configs.work.env_vars.API_URL", "https://api.example.com", "https://api.example.com"},
+		{"default_credentials.inject.git", "copy", "copy"},
+		{"profiles.client.default_credentials.gh", "true", true},
+		{"vuln_scan.ignore", "CVE-2024-1", []string{"CVE-2024-1"}},
+	}
+	for _, tt := range tests {
+		if err := cfg.SetValue(tt.key, tt.value); err != nil {
+			t.Fatalf("SetValue(%s, %s) error = %v", tt.key, tt.value, err)
+		}
+		got, err := cfg.GetValue(tt.key)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetValue(%s) = %#v, %v; want %#v", tt.key, got, err, tt.want)
+		}
+	}
+	if cfg.EnvConfigs["work"].EnvVars["API_URL"] != "https://api.example.com" || cfg.Profiles["client"].DefaultCredentials == nil {
+		t.Errorf("config = %+v, want map entries created along the key", cfg)
+	}
+}
+
+func TestSetValueRejectsInvalidValues(t *testing.T) {
+	cfg := &Config{ContainerRuntime: "docker", EnvConfigs: map[string]EnvConfig{"work": {Name: "work"}}}
+	tests := []struct {
+		key, value, wantErr string
+	}{
+		{"container_runtime", "lxc", "use docker, podman"},
+		{"default_credentials.ssh", "maybe", "expected true or false"},
+		{"default_container.check_frequency_hours", "daily", "expected a whole number"},
+		{"default_credentials.inject.npm", "symlink", "use mount, copy"},
+		{"restart_policy", "always", "use no, on-failure"},
+		{"host_bridge.actions", "open,ssh", `invalid value "ssh"`},
+		{"default_env_config", "home", `no env config named "home"`},
+		{"default_credential.ssh", "true", "unknown key default_credential"},
+		{"default_credentials.ssh.x", "true", "not a group of settings"},
+		{"default_credentials..ssh", "true", "invalid key"},
+	}
+	for _, tt := range tests {
+		err := cfg.SetValue(tt.key, tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("SetValue(%s, %s) error = %v, want %q", tt.key, tt.value, err, tt.wantErr)
+		}
+	}
+	if cfg.ContainerRuntime != "docker" || cfg.DefaultEnvConfig != "" {
+		t.Errorf("config = %+v, a rejected value must leave it unchanged", cfg)
+	}
+}
+
+func TestUnsetValue(t *testing.T) {
+	cfg := &Config{
+		CredentialStore:  "file",
+		EnvConfigs:       map[string]EnvConfig{"work": {Name: "work"}, "home": {Name: "home"}},
+		DefaultEnvConfig: "work",
+	}
+	original := cfg.EnvConfigs
+
+	if err := cfg.UnsetValue("env_configs.work"); err == nil {
+		t.Error("UnsetValue() of the default env config should fail")
+	}
+	if _, ok := cfg.EnvConfigs["work"]; !ok {
+		t.Error("a rejected unset must leave the config unchanged")
+	}
+
+	if err := cfg.UnsetValue("credential_store"); err != nil || cfg.CredentialStore != "" {
+		t.Errorf("UnsetValue(credential_store) = %v, value %q", err, cfg.CredentialStore)
+	}
+	if err := cfg.UnsetValue("env_configs.home"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.EnvConfigs["home"]; ok || len(original) != 2 {
+		t.Errorf("env configs = %v (original %v), want home removed from a copy", cfg.EnvConfigs, original)
+	}
+	if err := cfg.UnsetValue("env_configs.missing.env_vars"); err != nil {
+		t.Errorf("UnsetValue() of a missing entry error = %v", err)
+	}
+	if _, err := cfg.GetValue("env_configs.home"); err == nil || !strings.Contains(err.Error(), "not set") {
+		t.Errorf("GetValue() of a removed entry error = %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CurrentSchemaVersion is the config.json schema this version of packnplay writes.
+// Bump it and append to migrations when a field is renamed, moved, or removed.
+const CurrentSchemaVersion = 1
+
+// migration upgrades a raw config from schema version From to From+1, returning
+// a description of each change it made
+type migration struct {
+	From        int
+	Description string
+	Apply       func(raw map[string]interface{}) []string
+}
+
+// migrations are applied in order to configs older than CurrentSchemaVersion
+var migrations = []migration{
+	{From: 0, Description: "move default_image into default_container.image", Apply: migrateDefaultImage},
+}
+
+// MigrationResult describes an upgrade of a config file
+type MigrationResult struct {
+	FromVersion int
+	ToVersion   int
+	Changes     []string
+	BackupPath  string // empty for dry runs and configs that were already current
+}
+
+// NeedsMigration reports whether the config was written with an older schema
+func (r *MigrationResult) NeedsMigration() bool {
+	return r.FromVersion < r.ToVersion
+}
+
+// migrateDefaultImage replaces the deprecated top-level default_image with
+// default_container.image, which takes precedence when both are set
+func migrateDefaultImage(raw map[string]interface{}) []string {
+	image, _ := raw["default_image"].(string)
+	if _, ok := raw["default_image"]; !ok {
+		return nil
+	}
+	delete(raw, "default_image")
+	if image == "" {
+		return []string{"removed empty default_image"}
+	}
+
+	container, _ := raw["default_container"].(map[string]interface{})
+	if container == nil {
+		container = map[string]interface{}{}
+		raw["default_container"] = container
+	}
+	if existing, _ := container["image"].(string); existing != "" {
+		if existing == image {
+			return []string{"removed default_image (same as default_container.image)"}
+		}
+		return []string{fmt.Sprintf("removed default_image %q; default_container.image %q takes precedence", image, existing)}
+	}
+	container["image"] = image
+	return []string{fmt.Sprintf("moved default_image %q to default_container.image", image)}
+}
+
+// MigrateData upgrades raw config.json contents to CurrentSchemaVersion. The
+// returned data is unchanged when the config is already current.
+func MigrateData(data []byte) ([]byte, *MigrationResult, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	version := 0
+	if v, ok := raw["schema_version"].(float64); ok {
+		version = int(v)
+	}
+	result := &MigrationResult{FromVersion: version, ToVersion: CurrentSchemaVersion}
+	if version > CurrentSchemaVersion {
+		return nil, nil, fmt.Errorf("config schema_version %d is newer than this packnplay supports (%d); upgrade packnplay", version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return data, result, nil
+	}
+
+	for _, m := range migrations {
+		if m.From < version {
+			continue
+		}
+		result.Changes = append(result.Changes, m.Apply(raw)...)
+	}
+	raw["schema_version"] = CurrentSchemaVersion
+
+	// Round-trip through Config so the file keeps the usual field order
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode migrated config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(migrated, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse migrated config: %w", err)
+	}
+	out, err := json.MarshalIndent(&cfg, "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode migrated config: %w", err)
+	}
+	return out, result, nil
+}
+
+// MigrateFile upgrades the config file at configPath in place, keeping the
+// original next to it as config.json.v<old version>.bak. With dryRun the file
+// is left alone and the result only describes what would change.
+func MigrateFile(configPath string, dryRun bool) (*MigrationResult, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	_, result, err := migrateFileData(configPath, data, dryRun)
+	return result, err
+}
+
+// migrateFileData upgrades data read from configPath, writing the backup and
+// the migrated file unless dryRun is set
+func migrateFileData(configPath string, data []byte, dryRun bool) ([]byte, *MigrationResult, error) {
+	migrated, result, err := MigrateData(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !result.NeedsMigration() || dryRun {
+		return migrated, result, nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", configPath, result.FromVersion)
+	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to back up config before migrating: %w", err)
+	}
+	if err := os.WriteFile(configPath, migrated, 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write migrated config: %w", err)
+	}
+	result.BackupPath = backupPath
+	return migrated, result, nil
+}
+
+// readConfigFile loads a config file, upgrading it to the current schema first.
+// A config that can't be rewritten is still used, migrated in memory.
+func readConfigFile(configPath string) (*Config, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	migrated, result, err := migrateFileData(configPath, data, false)
+	if err != nil {
+		var inMemory *MigrationResult
+		migrated, inMemory, err = MigrateData(data)
+		if err != nil {
+			return nil, err
+		}
+		if inMemory.NeedsMigration() {
+			fmt.Fprintf(os.Stderr, "Warning: could not save upgraded config %s; run 'packnplay config migrate' to see the changes\n", configPath)
+		}
+	} else if result.BackupPath != "" {
+		fmt.Fprintf(os.Stderr, "Upgraded %s to schema version %d (backup: %s)\n", configPath, result.ToVersion, result.BackupPath)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(migrated, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.DefaultCredentials.validateInjection(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+	for name, profile := range cfg.Profiles {
+		if profile.DefaultCredentials != nil {
+			if err := profile.DefaultCredentials.validateInjection(); err != nil {
+				return nil, fmt.Errorf("invalid config %s: profile %s: %w", configPath, name, err)
+			}
+		}
+	}
+	return &cfg, nil
+}
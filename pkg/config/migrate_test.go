@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateData(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantImage  string
+		wantChange string
+	}{
+		{
+			name:       "moves default_image",
+			input:      `{"container_runtime": "docker", "default_image": "my/image:1"}`,
+			wantImage:  "my/image:1",
+			wantChange: `moved default_image "my/image:1" to default_container.image`,
+		},
+		{
+			name:       "default_container.image wins",
+			input:      `{"default_image": "old/image", "default_container": {"image": "new/image", "check_frequency_hours": 12}}`,
+			wantImage:  "new/image",
+			wantChange: `default_container.image "new/image" takes precedence`,
+		},
+		{
+			name:       "same image",
+			input:      `{"default_image": "same/image", "default_container": {"image": "same/image"}}`,
+			wantImage:  "same/image",
+			wantChange: "same as default_container.image",
+		},
+		{
+			name:  "nothing deprecated",
+			input: `{"container_runtime": "podman"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, result, err := MigrateData([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("MigrateData() error = %v", err)
+			}
+			if result.FromVersion != 0 || result.ToVersion != CurrentSchemaVersion || !result.NeedsMigration() {
+				t.Errorf("result = %+v", result)
+			}
+
+			var raw map[string]interface{}
+			if err := json.Unmarshal(out, &raw); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := raw["default_image"]; ok {
+				t.Errorf("migrated config still has default_image:\n%s", out)
+			}
+			if raw["schema_version"] != float64(CurrentSchemaVersion) {
+				t.Errorf("schema_version = %v, want %d", raw["schema_version"], CurrentSchemaVersion)
+			}
+
+			var cfg Config
+			if err := json.Unmarshal(out, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.DefaultContainer.Image != tt.wantImage {
+				t.Errorf("default_container.image = %q, want %q", cfg.DefaultContainer.Image, tt.wantImage)
+			}
+			if tt.wantChange != "" && !strings.Contains(strings.Join(result.Changes, "\n"), tt.wantChange) {
+				t.Errorf("Changes = %v, want one containing %q", result.Changes, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestMigrateDataPreservesSettings(t *testing.T) {
+	input := `{"default_image": "x", "default_container": {"check_frequency_hours": 6}, "env_configs": {"z": {"name": "Z", "env_vars": {"A": "b"}}}, "mount_excludes": ["~/.claude/session-env"]}`
+	out, _, err := MigrateData([]byte(input))
+	if err != nil {
+		t.Fatalf("MigrateData() error = %v", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultContainer.CheckFrequencyHours != 6 || cfg.EnvConfigs["z"].EnvVars["A"] != "b" || len(cfg.MountExcludes) != 1 {
+		t.Errorf("settings lost in migration: %+v", cfg)
+	}
+}
+
+func TestMigrateDataVersions(t *testing.T) {
+	current := []byte(`{"schema_version": 1, "container_runtime": "docker"}`)
+	out, result, err := MigrateData(current)
+	if err != nil || result.NeedsMigration() || string(out) != string(current) {
+		t.Errorf("current config: out = %s, result = %+v, err = %v; want unchanged", out, result, err)
+	}
+
+	if _, _, err := MigrateData([]byte(`{"schema_version": 99}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("MigrateData() error = %v, want newer-schema error", err)
+	}
+	if _, _, err := MigrateData([]byte(`{not json`)); err == nil {
+		t.Error("MigrateData() should reject invalid JSON")
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	original := `{"container_runtime": "docker", "default_image": "my/image:1"}`
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := MigrateFile(configPath, true)
+	if err != nil {
+		t.Fatalf("MigrateFile(dry run) error = %v", err)
+	}
+	if !result.NeedsMigration() || result.BackupPath != "" {
+		t.Errorf("dry run result = %+v", result)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != original {
+		t.Errorf("dry run modified config:\n%s", data)
+	}
+
+	result, err = MigrateFile(configPath, false)
+	if err != nil {
+		t.Fatalf("MigrateFile() error = %v", err)
+	}
+	if result.BackupPath != configPath+".v0.bak" {
+		t.Errorf("BackupPath = %q", result.BackupPath)
+	}
+	if backup, _ := os.ReadFile(result.BackupPath); string(backup) != original {
+		t.Errorf("backup = %s, want the original config", backup)
+	}
+
+	cfg, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile() error = %v", err)
+	}
+	if cfg.SchemaVersion != CurrentSchemaVersion || cfg.GetDefaultImage() != "my/image:1" || cfg.DefaultImage != "" {
+		t.Errorf("loaded config = %+v", cfg)
+	}
+
+	// Already current: nothing to do
+	if result, err := MigrateFile(configPath, false); err != nil || result.NeedsMigration() {
+		t.Errorf("second MigrateFile() = %+v, %v", result, err)
+	}
+}
+
+func TestLoadConfigFromFileMigrates(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"container_runtime": "podman", "default_image": "legacy/image"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile() error = %v", err)
+	}
+	if cfg.GetDefaultImage() != "legacy/image" {
+		t.Errorf("GetDefaultImage() = %q, want the migrated image", cfg.GetDefaultImage())
+	}
+	if _, err := os.Stat(configPath + ".v0.bak"); err != nil {
+		t.Errorf("expected a backup of the old config: %v", err)
+	}
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), `"schema_version": 1`) {
+		t.Errorf("config not rewritten:\n%s", data)
+	}
+}
+
+func TestSaveConfigStampsSchemaVersion(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := SaveConfig(&Config{ContainerRuntime: "docker"}, configPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), `"schema_version": 1`) {
+		t.Errorf("saved config has no schema_version:\n%s", data)
+	}
+}
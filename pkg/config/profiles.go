@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProfileEnvVar selects a profile when --profile isn't given
+const ProfileEnvVar = "PACKNPLAY_PROFILE"
+
+// Profile overrides top-level settings for one context (work, personal, a client).
+// Empty fields inherit from the base config.
+type Profile struct {
+	Description        string               `json:"description,omitempty"`
+	ContainerRuntime   string               `json:"container_runtime,omitempty"`
+	DefaultImage       string               `json:"default_image,omitempty"`
+	DefaultCredentials *Credentials         `json:"default_credentials,omitempty"`
+	DefaultEnvVars     []string             `json:"default_env_vars,omitempty"`
+	EnvConfigs         map[string]EnvConfig `json:"env_configs,omitempty"` // merged over the base env configs
+	DockerConfig       string               `json:"docker_config,omitempty"`
+}
+
+// ProfileInfo describes an available profile for listing
+type ProfileInfo struct {
+	Name        string
+	Description string
+	Source      string // "config.json" or the profile file path
+}
+
+// GetProfilesDir returns the directory holding per-profile JSON files
+func GetProfilesDir() string {
+	return filepath.Join(filepath.Dir(GetConfigPath()), "profiles")
+}
+
+// loadProfileFiles reads profiles/<name>.json next to the config file.
+// Profiles defined inline in config.json take precedence.
+func (c *Config) loadProfileFiles(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read profile %s: %w", file, err)
+		}
+		var profile Profile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			return fmt.Errorf("failed to parse profile %s: %w", file, err)
+		}
+		if profile.DefaultCredentials != nil {
+			if err := profile.DefaultCredentials.validateInjection(); err != nil {
+				return fmt.Errorf("invalid profile %s: %w", file, err)
+			}
+		}
+		if c.fileProfiles == nil {
+			c.fileProfiles = make(map[string]profileFile)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		c.fileProfiles[name] = profileFile{path: file, profile: profile}
+	}
+	return nil
+}
+
+// profileFile is a profile loaded from the profiles directory
+type profileFile struct {
+	path    string
+	profile Profile
+}
+
+// Profile returns the named profile from config.json or the profiles directory
+func (c *Config) Profile(name string) (Profile, bool) {
+	if profile, ok := c.Profiles[name]; ok {
+		return profile, true
+	}
+	if file, ok := c.fileProfiles[name]; ok {
+		return file.profile, true
+	}
+	return Profile{}, false
+}
+
+// ListProfiles returns all available profiles sorted by name
+func (c *Config) ListProfiles() []ProfileInfo {
+	var infos []ProfileInfo
+	for name, profile := range c.Profiles {
+		infos = append(infos, ProfileInfo{Name: name, Description: profile.Description, Source: "config.json"})
+	}
+	for name, file := range c.fileProfiles {
+		if _, shadowed := c.Profiles[name]; shadowed {
+			continue
+		}
+		infos = append(infos, ProfileInfo{Name: name, Description: file.profile.Description, Source: file.path})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// SelectedProfile resolves which profile applies: flag, then PACKNPLAY_PROFILE, then active_profile
+func (c *Config) SelectedProfile(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if env := os.Getenv(ProfileEnvVar); env != "" {
+		return env
+	}
+	return c.ActiveProfile
+}
+
+// ApplyProfile overlays the named profile onto the config
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	profile, ok := c.Profile(name)
+	if !ok {
+		var names []string
+		for _, info := range c.ListProfiles() {
+			names = append(names, info.Name)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("profile '%s' not found (no profiles configured)", name)
+		}
+		return fmt.Errorf("profile '%s' not found (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	if profile.ContainerRuntime != "" {
+		c.ContainerRuntime = profile.ContainerRuntime
+	}
+	if profile.DefaultImage != "" {
+		c.DefaultContainer.Image = profile.DefaultImage
+	}
+	if profile.DefaultCredentials != nil {
+		c.DefaultCredentials = *profile.DefaultCredentials
+	}
+	if profile.DefaultEnvVars != nil {
+		c.DefaultEnvVars = profile.DefaultEnvVars
+	}
+	if len(profile.EnvConfigs) > 0 {
+		merged := make(map[string]EnvConfig, len(c.EnvConfigs)+len(profile.EnvConfigs))
+		for k, v := range c.EnvConfigs {
+			merged[k] = v
+		}
+		for k, v := range profile.EnvConfigs {
+			merged[k] = v
+		}
+		c.EnvConfigs = merged
+	}
+	if profile.DockerConfig != "" {
+		c.DockerConfig = profile.DockerConfig
+	}
+	return nil
+}
+
+// ResolvedDockerConfig returns the DOCKER_CONFIG directory with ~ expanded, or ""
+func (c *Config) ResolvedDockerConfig() string {
+	if c.DockerConfig == "" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(c.DockerConfig, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return c.DockerConfig
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	cfg := &Config{
+		ContainerRuntime:   "docker",
+		DefaultImage:       "base-image",
+		DefaultCredentials: Credentials{Git: true, SSH: true},
+		DefaultEnvVars:     []string{"ANTHROPIC_API_KEY"},
+		EnvConfigs: map[string]EnvConfig{
+			"personal": {Name: "Personal"},
+			"shared":   {Name: "Base shared"},
+		},
+		Profiles: map[string]Profile{
+			"client-x": {
+				ContainerRuntime:   "podman",
+				DefaultImage:       "registry.client-x.com/dev:latest",
+				DefaultCredentials: &Credentials{Git: true},
+				EnvConfigs:         map[string]EnvConfig{"shared": {Name: "Client shared"}},
+				DockerConfig:       "~/.docker-client-x",
+			},
+		},
+	}
+
+	if err := cfg.ApplyProfile("client-x"); err != nil {
+		t.Fatalf("ApplyProfile() error = %v", err)
+	}
+
+	if cfg.ContainerRuntime != "podman" {
+		t.Errorf("ContainerRuntime = %q, want podman", cfg.ContainerRuntime)
+	}
+	if cfg.GetDefaultImage() != "registry.client-x.com/dev:latest" {
+		t.Errorf("GetDefaultImage() = %q", cfg.GetDefaultImage())
+	}
+	if cfg.DefaultCredentials.SSH {
+		t.Error("profile credentials should replace the base credentials")
+	}
+	if len(cfg.DefaultEnvVars) != 1 {
+		t.Errorf("unset profile fields should inherit, DefaultEnvVars = %v", cfg.DefaultEnvVars)
+	}
+	if cfg.EnvConfigs["shared"].Name != "Client shared" || cfg.EnvConfigs["personal"].Name != "Personal" {
+		t.Errorf("EnvConfigs not merged: %v", cfg.EnvConfigs)
+	}
+	home, _ := os.UserHomeDir()
+	if got := cfg.ResolvedDockerConfig(); got != filepath.Join(home, ".docker-client-x") {
+		t.Errorf("ResolvedDockerConfig() = %q", got)
+	}
+
+	err := cfg.ApplyProfile("missing")
+	if err == nil || !strings.Contains(err.Error(), "client-x") {
+		t.Errorf("ApplyProfile(missing) error = %v, want list of available profiles", err)
+	}
+}
+
+func TestConfig_SelectedProfile(t *testing.T) {
+	cfg := &Config{ActiveProfile: "work"}
+
+	t.Setenv(ProfileEnvVar, "")
+	if got := cfg.SelectedProfile(""); got != "work" {
+		t.Errorf("SelectedProfile() = %q, want active profile", got)
+	}
+
+	t.Setenv(ProfileEnvVar, "personal")
+	if got := cfg.SelectedProfile(""); got != "personal" {
+		t.Errorf("SelectedProfile() = %q, want env profile", got)
+	}
+	if got := cfg.SelectedProfile("client-x"); got != "client-x" {
+		t.Errorf("SelectedProfile(flag) = %q, want flag profile", got)
+	}
+}
+
+func TestLoadConfigFromFile_ProfileFiles(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"container_runtime": "docker", "profiles": {"work": {"description": "inline"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "profiles"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"work.json":     `{"description": "shadowed"}`,
+		"client-y.json": `{"description": "from file", "container_runtime": "podman"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "profiles", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigFromFile() error = %v", err)
+	}
+
+	profiles := cfg.ListProfiles()
+	if len(profiles) != 2 || profiles[0].Name != "client-y" || profiles[1].Description != "inline" {
+		t.Errorf("ListProfiles() = %+v", profiles)
+	}
+
+	// Saving must not copy file-based profiles into config.json
+	if err := SaveConfig(cfg, configPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "client-y") {
+		t.Errorf("file profile leaked into config.json:\n%s", data)
+	}
+
+	if err := cfg.ApplyProfile("client-y"); err != nil || cfg.ContainerRuntime != "podman" {
+		t.Errorf("ApplyProfile(client-y) = %v, runtime %q", err, cfg.ContainerRuntime)
+	}
+}
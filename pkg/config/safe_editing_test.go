@@ -37,6 +37,7 @@ func TestConfigPreservationDuringEditing(t *testing.T) {
 			CheckForUpdates:     true,
 			AutoPullUpdates:     false,
 			CheckFrequencyHours: 12, // Custom frequency
+			AutoPullBaseImages:  true,
 		},
 	}
 
@@ -58,9 +59,17 @@ func TestConfigPreservationDuringEditing(t *testing.T) {
 		GH:  false, // Changed from true
 		GPG: true,  // New setting
 	}
+	// The settings modal sends back only the default container fields it shows
+	containerConfig := DefaultContainerConfig{
+		Image:               "my-custom/image:latest",
+		CheckForUpdates:     true,
+		AutoPullUpdates:     true,
+		CheckFrequencyHours: 12,
+	}
 	updates := ConfigUpdates{
 		ContainerRuntime:   &runtime,
 		DefaultCredentials: &creds,
+		DefaultContainer:   &containerConfig,
 	}
 
 	err = UpdateConfigSafely(configFile, updates)
@@ -121,6 +130,14 @@ func TestConfigPreservationDuringEditing(t *testing.T) {
 	if updated.DefaultContainer.CheckFrequencyHours != 12 {
 		t.Errorf("Custom check frequency not preserved: %v", updated.DefaultContainer.CheckFrequencyHours)
 	}
+
+	if !updated.DefaultContainer.AutoPullUpdates {
+		t.Error("AutoPullUpdates should be updated to true")
+	}
+
+	if !updated.DefaultContainer.AutoPullBaseImages {
+		t.Error("AutoPullBaseImages should be preserved")
+	}
 }
 
 func TestLoadExistingOrEmpty(t *testing.T) {
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// configCheckInterval is how often the settings modal looks for changes made
+// to config.json while it is open, e.g. by `packnplay config set`
+const configCheckInterval = time.Second
+
+// configCheckMsg asks the settings modal to check config.json for changes
+type configCheckMsg time.Time
+
+// checkConfigFile schedules the next configCheckMsg
+func checkConfigFile() tea.Cmd {
+	return tea.Tick(configCheckInterval, func(t time.Time) tea.Msg { return configCheckMsg(t) })
+}
+
+// watchConfigFile records the config file the modal edits and its current
+// contents, so later changes to it are noticed
+func (m *SettingsModal) watchConfigFile(configPath string) {
+	m.configPath = configPath
+	m.loaded, _ = os.ReadFile(configPath)
+}
+
+// markEdited records that the user changed a field, so reloads keep its value
+func (m *SettingsModal) markEdited(field *SettingsField) {
+	if m.edited == nil {
+		m.edited = make(map[string]bool)
+	}
+	m.edited[field.name] = true
+}
+
+// reloadIfChanged reloads the settings from config.json if it changed since
+// the modal loaded it, keeping the values of fields the user has edited.
+// Saving then only writes those edits over the file's current settings.
+func (m *SettingsModal) reloadIfChanged() bool {
+	if m.configPath == "" {
+		return false
+	}
+	data, err := os.ReadFile(m.configPath)
+	if err != nil && !os.IsNotExist(err) || bytes.Equal(data, m.loaded) {
+		return false
+	}
+	cfg, err := LoadExistingOrEmpty(m.configPath)
+	if err != nil {
+		// Probably caught mid-write; try again on the next check
+		return false
+	}
+
+	edits := make(map[string]interface{})
+	for _, section := range m.sections {
+		for _, field := range section.fields {
+			if m.edited[field.name] {
+				edits[field.name] = field.value
+			}
+		}
+	}
+
+	fresh := createSettingsModal(cfg)
+	for i := range fresh.sections {
+		for j := range fresh.sections[i].fields {
+			field := &fresh.sections[i].fields[j]
+			if value, ok := edits[field.name]; ok {
+				field.value = value
+			}
+		}
+	}
+
+	m.config = cfg
+	m.sections = fresh.sections
+	m.loaded = data
+	if m.currentSection >= len(m.sections) {
+		m.currentSection = len(m.sections) - 1
+	}
+	if m.currentField >= len(m.sections[m.currentSection].fields) {
+		m.currentField = len(m.sections[m.currentSection].fields) - 1
+	}
+	m.notice = "config.json changed on disk and was reloaded; your unsaved changes are kept"
+	return true
+}
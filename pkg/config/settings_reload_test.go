@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettingsModalReloadsChangedConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	cfg := &Config{ContainerRuntime: "docker", DefaultCredentials: Credentials{Git: true}}
+	if err := SaveConfig(cfg, configPath); err != nil {
+		t.Fatal(err)
+	}
+	existing, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modal := createSettingsModal(existing)
+	modal.watchConfigFile(configPath)
+	if modal.reloadIfChanged() {
+		t.Error("reloadIfChanged() should do nothing while the file is unchanged")
+	}
+
+	// The user turns on SSH in the modal...
+	modal.currentSection, modal.currentField = 1, 0
+	modal.activateCurrentField()
+
+	// ...while `packnplay config set` changes other settings
+	onDisk, _ := LoadConfigFromFile(configPath)
+	if err := onDisk.SetValue("default_credentials.gh", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if err := onDisk.SetValue("default_credentials.git", "false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := onDisk.SetValue("credential_store", "file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(onDisk, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if !modal.reloadIfChanged() || modal.notice == "" {
+		t.Fatal("reloadIfChanged() should reload a changed file and say so")
+	}
+	if err := applyModalConfigUpdates(modal, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadConfigFromFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := saved.DefaultCredentials
+	if !creds.SSH || !creds.GH || creds.Git || saved.CredentialStore != "file" {
+		t.Errorf("saved config = %+v, want the modal's edit and the concurrent ones", saved)
+	}
+
+	// A file caught mid-write is retried later
+	if err := os.WriteFile(configPath, []byte(`{"container_runtime": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if modal.reloadIfChanged() {
+		t.Error("reloadIfChanged() should skip a file that doesn't parse")
+	}
+}
@@ -0,0 +1,56 @@
+package container
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// LabelConfigHash records the hash of the devcontainer config an image was
+// built from
+const LabelConfigHash = "packnplay-config-hash"
+
+// ProjectImageReference matches the repositories of images built for projects
+// (GenerateImageName), for image ls --filter reference=
+const ProjectImageReference = "packnplay-*-devcontainer"
+
+// ImageLabels returns the labels of an image built for a project from the
+// devcontainer config with the given hash
+func ImageLabels(projectPath, configHash string) map[string]string {
+	labels := map[string]string{
+		LabelManagedBy: "packnplay",
+		LabelProject:   filepath.Base(projectPath),
+		LabelHostPath:  projectPath,
+	}
+	if configHash != "" {
+		labels[LabelConfigHash] = configHash
+	}
+	return labels
+}
+
+// GenerateConfigImageName returns the tag identifying the build of a
+// project's image from one devcontainer config: GenerateImageName's
+// repository tagged with the start of the config hash. It keeps an image
+// replaced by a rebuild tagged (rather than dangling), so it can be listed
+// and pruned.
+func GenerateConfigImageName(projectPath, configHash string) string {
+	repository, _, _ := strings.Cut(GenerateImageName(projectPath), ":")
+	if len(configHash) > 12 {
+		configHash = configHash[:12]
+	}
+	return repository + ":" + configHash
+}
+
+// ImagesLastUsedPath returns where the last use of each project image is
+// recorded (see RecordLastUsed), keyed by image name
+func ImagesLastUsedPath() string {
+	return filepath.Join(filepath.Dir(LastUsedPath()), "images-last-used.json")
+}
+
+// ForgetLastUsed removes names from a last-used record
+func ForgetLastUsed(path string, names ...string) {
+	lastUsed := LoadLastUsed(path)
+	for _, name := range names {
+		delete(lastUsed, name)
+	}
+	writeLastUsed(path, lastUsed)
+}
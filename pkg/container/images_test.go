@@ -0,0 +1,30 @@
+package container
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateConfigImageName(t *testing.T) {
+	got := GenerateConfigImageName("/home/me/MyApp", "0123456789abcdef0123")
+	if got != "packnplay-myapp-devcontainer:0123456789ab" {
+		t.Errorf("GenerateConfigImageName() = %q", got)
+	}
+	if labels := ImageLabels("/home/me/MyApp", ""); labels[LabelManagedBy] != "packnplay" || labels[LabelHostPath] != "/home/me/MyApp" || labels[LabelConfigHash] != "" {
+		t.Errorf("ImageLabels() = %v", labels)
+	}
+}
+
+func TestForgetLastUsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "images-last-used.json")
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	RecordLastUsed(path, "packnplay-app-devcontainer:latest", now)
+	RecordLastUsed(path, "packnplay-web-devcontainer:latest", now)
+
+	ForgetLastUsed(path, "packnplay-app-devcontainer:latest")
+	got := LoadLastUsed(path)
+	if _, ok := got["packnplay-app-devcontainer:latest"]; ok || !got["packnplay-web-devcontainer:latest"].Equal(now) {
+		t.Errorf("LoadLastUsed() after ForgetLastUsed = %v", got)
+	}
+}
@@ -1,6 +1,8 @@
 package container
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 )
 
@@ -11,8 +13,100 @@ const (
 	LabelHostPath      = "packnplay-host-path"
 	LabelLaunchCommand = "packnplay-launch-command"
 	LabelManagedBy     = "managed-by"
+	LabelMetadata      = "packnplay.metadata"
 )
 
+// MetadataVersion is the label schema written in LabelMetadata. Version 1 is
+// the separate packnplay-* labels, which containers still carry for filtering.
+const MetadataVersion = 2
+
+// Metadata is what packnplay records about a container, kept as JSON in the
+// LabelMetadata label so values containing commas survive
+type Metadata struct {
+	Version       int         `json:"version"`
+	Project       string      `json:"project"`
+	Worktree      string      `json:"worktree"`
+	HostPath      string      `json:"host_path,omitempty"`
+	ConfigHash    string      `json:"config_hash,omitempty"`    // hash of the resolved devcontainer config
+	LaunchCommand string      `json:"launch_command,omitempty"` // command line as typed, for display
+	Launch        *LaunchInfo `json:"launch,omitempty"`         // structured launch, for resume
+
+	// Settings fingerprints each effective setting at creation, so reusing
+	// the container can report which ones changed since
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// Labels returns the labels recording m: the v2 metadata label along with the
+// v1 labels that `ps --filter label=` queries use
+func (m Metadata) Labels() (map[string]string, error) {
+	m.Version = MetadataVersion
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode container metadata: %w", err)
+	}
+	labels := GenerateLabels(m.Project, m.Worktree)
+	if m.HostPath != "" {
+		labels[LabelHostPath] = m.HostPath
+	}
+	labels[LabelMetadata] = string(data)
+	return labels, nil
+}
+
+// ReadMetadata returns the metadata recorded in a container's labels, reading
+// the v1 labels of containers created before the metadata label
+func ReadMetadata(labels map[string]string) Metadata {
+	var m Metadata
+	if value := labels[LabelMetadata]; value != "" && json.Unmarshal([]byte(value), &m) == nil && m.Version >= MetadataVersion {
+		return m
+	}
+
+	m = Metadata{
+		Version:       1,
+		Project:       labels[LabelProject],
+		Worktree:      labels[LabelWorktree],
+		HostPath:      labels[LabelHostPath],
+		LaunchCommand: labels[LabelLaunchCommand],
+	}
+	if value := labels[LabelLaunchArgs]; value != "" {
+		if launch, err := DecodeLaunchInfo(value); err == nil {
+			m.Launch = launch
+		}
+	}
+	return m
+}
+
+// CommandRunner runs container runtime commands, returning their output
+type CommandRunner interface {
+	Run(args ...string) (string, error)
+}
+
+// InspectLabels returns the labels of the named containers, keyed by name.
+// Unlike `ps --format {{.Labels}}`, inspect keeps label values intact.
+// Containers that couldn't be inspected (gone, or a runtime without
+// inspect --format) are left out.
+func InspectLabels(runner CommandRunner, names ...string) map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	if len(names) == 0 {
+		return result
+	}
+
+	args := append([]string{"inspect", "--type", "container", "--format", "{{.Name}}\t{{json .Config.Labels}}"}, names...)
+	// A missing container fails the command but the others are still printed
+	output, _ := runner.Run(args...)
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		labels := make(map[string]string)
+		if err := json.Unmarshal([]byte(value), &labels); err != nil {
+			continue
+		}
+		result[strings.TrimPrefix(name, "/")] = labels
+	}
+	return result
+}
+
 // ParseLabels parses a comma-separated label string into a map.
 // This consolidates 3 duplicate implementations across the codebase:
 // - runner.go:762-782 parseLabelsFromString
@@ -21,6 +115,9 @@ const (
 //
 // Format: "key1=value1,key2=value2,key3=value3"
 // Returns: map[string]string with parsed key-value pairs
+//
+// Values containing commas are cut short, so it is only a fallback for
+// runtimes InspectLabels can't read.
 func ParseLabels(labelString string) map[string]string {
 	labels := make(map[string]string)
 
@@ -41,20 +138,20 @@ func ParseLabels(labelString string) map[string]string {
 
 // GetProjectFromLabels extracts the project name from label map
 func GetProjectFromLabels(labels map[string]string) string {
-	return labels[LabelProject]
+	return ReadMetadata(labels).Project
 }
 
 // GetWorktreeFromLabels extracts the worktree name from label map
 func GetWorktreeFromLabels(labels map[string]string) string {
-	return labels[LabelWorktree]
+	return ReadMetadata(labels).Worktree
 }
 
 // GetHostPathFromLabels extracts the host path from label map
 func GetHostPathFromLabels(labels map[string]string) string {
-	return labels[LabelHostPath]
+	return ReadMetadata(labels).HostPath
 }
 
 // GetLaunchCommandFromLabels extracts the launch command from label map
 func GetLaunchCommandFromLabels(labels map[string]string) string {
-	return labels[LabelLaunchCommand]
+	return ReadMetadata(labels).LaunchCommand
 }
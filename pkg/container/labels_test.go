@@ -1,6 +1,8 @@
 package container
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -128,3 +130,101 @@ func TestGetLaunchCommandFromLabels(t *testing.T) {
 		t.Errorf("Expected bash -c 'echo hello', got %s", launchCommand)
 	}
 }
+
+func TestMetadataLabelsRoundTrip(t *testing.T) {
+	meta := Metadata{
+		Project:       "app",
+		Worktree:      "feature",
+		HostPath:      "/src/app",
+		ConfigHash:    "abc123",
+		LaunchCommand: "packnplay run --env A=1,2 bash -c 'a, b'",
+		Launch:        &LaunchInfo{Args: []string{"run", "--env", "A=1,2", "bash", "-c", "a, b"}, Dir: "/src/app"},
+	}
+	labels, err := meta.Labels()
+	if err != nil {
+		t.Fatalf("Labels() error = %v", err)
+	}
+	if labels[LabelManagedBy] != "packnplay" || labels[LabelProject] != "app" || labels[LabelHostPath] != "/src/app" {
+		t.Errorf("labels = %v, want the v1 labels used by filters kept", labels)
+	}
+	if _, ok := labels[LabelLaunchCommand]; ok {
+		t.Errorf("labels = %v, the launch command should only be in the metadata", labels)
+	}
+
+	got := ReadMetadata(labels)
+	if got.Version != MetadataVersion || got.LaunchCommand != meta.LaunchCommand || got.ConfigHash != "abc123" {
+		t.Errorf("ReadMetadata() = %+v, want %+v", got, meta)
+	}
+	if got.Launch == nil || strings.Join(got.Launch.Args, " ") != "run --env A=1,2 bash -c a, b" {
+		t.Errorf("ReadMetadata().Launch = %+v, want the launch args intact", got.Launch)
+	}
+	if GetLaunchCommandFromLabels(labels) != meta.LaunchCommand {
+		t.Errorf("GetLaunchCommandFromLabels() = %q, want it read from the metadata", GetLaunchCommandFromLabels(labels))
+	}
+}
+
+func TestReadMetadataV1(t *testing.T) {
+	value, err := EncodeLaunchInfo(LaunchInfo{Args: []string{"run", "claude"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]string{
+		LabelProject:       "app",
+		LabelWorktree:      "main",
+		LabelHostPath:      "/src/app",
+		LabelLaunchCommand: "packnplay run claude",
+		LabelLaunchArgs:    value,
+		LabelMetadata:      "{not json",
+	}
+
+	got := ReadMetadata(labels)
+	if got.Version != 1 || got.Project != "app" || got.Worktree != "main" || got.HostPath != "/src/app" || got.LaunchCommand != "packnplay run claude" {
+		t.Errorf("ReadMetadata() = %+v, want the v1 labels read", got)
+	}
+	if got.Launch == nil || got.Launch.Args[1] != "claude" {
+		t.Errorf("ReadMetadata().Launch = %+v, want the v1 launch args decoded", got.Launch)
+	}
+}
+
+// fakeInspect answers inspect like docker: found containers are printed even
+// when another one is missing
+type fakeInspect struct {
+	labels map[string]map[string]string
+	args   []string
+}
+
+func (f *fakeInspect) Run(args ...string) (string, error) {
+	f.args = args
+	var out strings.Builder
+	var err error
+	for _, name := range args[5:] {
+		labels, ok := f.labels[name]
+		if !ok {
+			err = fmt.Errorf("exit status 1")
+			continue
+		}
+		var pairs []string
+		for k, v := range labels {
+			pairs = append(pairs, fmt.Sprintf("%q:%q", k, v))
+		}
+		fmt.Fprintf(&out, "/%s\t{%s}\n", name, strings.Join(pairs, ","))
+	}
+	return out.String(), err
+}
+
+func TestInspectLabels(t *testing.T) {
+	fake := &fakeInspect{labels: map[string]map[string]string{
+		"packnplay-app-main": {LabelLaunchCommand: "bash -c 'a,b=c'"},
+	}}
+
+	got := InspectLabels(fake, "packnplay-app-main", "packnplay-gone")
+	if fake.args[0] != "inspect" || fake.args[4] != "{{.Name}}\t{{json .Config.Labels}}" {
+		t.Errorf("ran %v, want one inspect of the labels", fake.args)
+	}
+	if len(got) != 1 || got["packnplay-app-main"][LabelLaunchCommand] != "bash -c 'a,b=c'" {
+		t.Errorf("InspectLabels() = %v, want the found container's labels intact", got)
+	}
+	if len(InspectLabels(fake)) != 0 {
+		t.Error("InspectLabels() with no names should be empty")
+	}
+}
@@ -0,0 +1,47 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LastUsedPath returns where container last-used times are kept
+func LastUsedPath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, _ := os.UserHomeDir()
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "packnplay", "last-used.json")
+}
+
+// LoadLastUsed returns the last time each container was run or attached to, keyed by name
+func LoadLastUsed(path string) map[string]time.Time {
+	lastUsed := make(map[string]time.Time)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &lastUsed)
+	}
+	return lastUsed
+}
+
+// RecordLastUsed marks a container as used now. It is best effort: a failure only
+// makes the attach picker's ordering less useful.
+func RecordLastUsed(path, containerName string, now time.Time) {
+	lastUsed := LoadLastUsed(path)
+	lastUsed[containerName] = now
+	writeLastUsed(path, lastUsed)
+}
+
+// writeLastUsed saves a last-used record, best effort
+func writeLastUsed(path string, lastUsed map[string]time.Time) {
+	data, err := json.MarshalIndent(lastUsed, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, data, 0644)
+}
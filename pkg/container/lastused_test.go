@@ -0,0 +1,28 @@
+package container
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordLastUsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "last-used.json")
+	if got := LoadLastUsed(path); len(got) != 0 {
+		t.Errorf("LoadLastUsed() on missing file = %v, want empty", got)
+	}
+
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	RecordLastUsed(path, "packnplay-app-main", first)
+	RecordLastUsed(path, "packnplay-app-feature", first)
+	RecordLastUsed(path, "packnplay-app-main", second)
+
+	got := LoadLastUsed(path)
+	if !got["packnplay-app-main"].Equal(second) {
+		t.Errorf("main last used = %v, want %v", got["packnplay-app-main"], second)
+	}
+	if !got["packnplay-app-feature"].Equal(first) {
+		t.Errorf("feature last used = %v, want %v", got["packnplay-app-feature"], first)
+	}
+}
@@ -0,0 +1,83 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LabelLaunchArgs held the structured launch command (see LaunchInfo) before
+// it moved into LabelMetadata; still read from older containers
+const LabelLaunchArgs = "packnplay-launch-args"
+
+// LaunchInfo is the exact invocation that created a container, kept so
+// `packnplay resume` can re-run it
+type LaunchInfo struct {
+	Args     []string  `json:"args"`               // arguments after the program name, e.g. ["run", "--env", "A=b", "claude"]
+	Dir      string    `json:"dir"`                // working directory the command was run from
+	HostPath string    `json:"host_path"`          // project path the container was launched for
+	Worktree string    `json:"worktree,omitempty"` // worktree name
+	Time     time.Time `json:"time"`
+}
+
+// EncodeLaunchInfo serializes launch info for a label value. It is base64 encoded
+// because `ps --format {{.Labels}}` joins labels with commas.
+func EncodeLaunchInfo(info LaunchInfo) (string, error) {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecodeLaunchInfo parses a value produced by EncodeLaunchInfo
+func DecodeLaunchInfo(value string) (*LaunchInfo, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid launch info: %w", err)
+	}
+	var info LaunchInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid launch info: %w", err)
+	}
+	if len(info.Args) == 0 {
+		return nil, fmt.Errorf("invalid launch info: no arguments recorded")
+	}
+	return &info, nil
+}
+
+// LaunchesPath returns where launch commands are kept, so they survive the
+// container being removed
+func LaunchesPath() string {
+	return filepath.Join(filepath.Dir(LastUsedPath()), "launches.json")
+}
+
+// LoadLaunches returns the recorded launch info keyed by container name
+func LoadLaunches(path string) map[string]LaunchInfo {
+	launches := make(map[string]LaunchInfo)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &launches)
+	}
+	return launches
+}
+
+// RecordLaunch saves the command that created a container
+func RecordLaunch(path, containerName string, info LaunchInfo) error {
+	launches := LoadLaunches(path)
+	launches[containerName] = info
+
+	data, err := json.MarshalIndent(launches, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode launches: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write launches: %w", err)
+	}
+	return nil
+}
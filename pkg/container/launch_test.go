@@ -0,0 +1,60 @@
+package container
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLaunchInfoRoundTrip(t *testing.T) {
+	info := LaunchInfo{
+		Args:     []string{"run", "--env", "A=1,B=2", "--worktree", "feature", "claude", "--resume"},
+		Dir:      "/home/me/app",
+		HostPath: "/home/me/app",
+		Worktree: "feature",
+		Time:     time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	value, err := EncodeLaunchInfo(info)
+	if err != nil {
+		t.Fatalf("EncodeLaunchInfo() error = %v", err)
+	}
+	if strings.Contains(value, ",") {
+		t.Errorf("label value %q contains a comma", value)
+	}
+
+	got, err := DecodeLaunchInfo(value)
+	if err != nil {
+		t.Fatalf("DecodeLaunchInfo() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, info) {
+		t.Errorf("DecodeLaunchInfo() = %+v, want %+v", *got, info)
+	}
+
+	for _, bad := range []string{"", "not base64!", "e30="} {
+		if _, err := DecodeLaunchInfo(bad); err == nil {
+			t.Errorf("DecodeLaunchInfo(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRecordLaunch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "launches.json")
+	if got := LoadLaunches(path); len(got) != 0 {
+		t.Errorf("LoadLaunches() on missing file = %v, want empty", got)
+	}
+
+	if err := RecordLaunch(path, "packnplay-app-main", LaunchInfo{Args: []string{"run", "bash"}}); err != nil {
+		t.Fatalf("RecordLaunch() error = %v", err)
+	}
+	if err := RecordLaunch(path, "packnplay-app-main", LaunchInfo{Args: []string{"run", "claude"}}); err != nil {
+		t.Fatalf("RecordLaunch() error = %v", err)
+	}
+
+	got := LoadLaunches(path)
+	if args := got["packnplay-app-main"].Args; !reflect.DeepEqual(args, []string{"run", "claude"}) {
+		t.Errorf("recorded args = %v, want the latest launch", args)
+	}
+}
@@ -13,6 +13,37 @@ func GenerateContainerName(projectPath, worktreeName string) string {
 	return fmt.Sprintf("packnplay-%s-%s", projectName, worktree)
 }
 
+// GenerateNetworkName returns the network a project's containers share
+func GenerateNetworkName(projectPath string) string {
+	return fmt.Sprintf("packnplay-%s", sanitizeName(filepath.Base(projectPath)))
+}
+
+// GenerateHostname returns a container's hostname on its project network: the
+// worktree name, or the project name for the no-worktree container
+func GenerateHostname(projectPath, worktreeName string) string {
+	name := worktreeName
+	if name == "" || name == "no-worktree" {
+		name = filepath.Base(projectPath)
+	}
+	// Hostnames are lowercase letters, digits and dashes
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else if b.Len() > 0 && !strings.HasSuffix(b.String(), "-") {
+			b.WriteByte('-')
+		}
+	}
+	hostname := strings.TrimSuffix(b.String(), "-")
+	if len(hostname) > 63 {
+		hostname = strings.TrimSuffix(hostname[:63], "-")
+	}
+	if hostname == "" {
+		hostname = "workspace"
+	}
+	return hostname
+}
+
 // GenerateImageName creates an image name for a built devcontainer
 // Docker image names must be lowercase
 func GenerateImageName(projectPath string) string {
@@ -45,6 +76,9 @@ func GenerateLabels(projectName, worktreeName string) map[string]string {
 }
 
 // GenerateLabelsWithLaunchInfo creates Docker labels including host path and launch command
+//
+// Deprecated: these are the v1 labels, which can't hold values with commas.
+// Use Metadata.Labels.
 func GenerateLabelsWithLaunchInfo(projectName, worktreeName, hostPath, launchCommand string) map[string]string {
 	return map[string]string{
 		"managed-by":               "packnplay",
@@ -1,6 +1,7 @@
 package container
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -47,6 +48,29 @@ func TestGenerateContainerName(t *testing.T) {
 	}
 }
 
+func TestGenerateHostname(t *testing.T) {
+	tests := []struct {
+		worktreeName string
+		want         string
+	}{
+		{"main", "main"},
+		{"feature/Auth_Flow", "feature-auth-flow"},
+		{"no-worktree", "myproject"},
+		{"", "myproject"},
+		{"--", "workspace"},
+		{strings.Repeat("a", 70), strings.Repeat("a", 63)},
+	}
+
+	for _, tt := range tests {
+		if got := GenerateHostname("/home/user/myproject", tt.worktreeName); got != tt.want {
+			t.Errorf("GenerateHostname(%q) = %v, want %v", tt.worktreeName, got, tt.want)
+		}
+	}
+	if got := GenerateNetworkName("/home/user/my@project"); got != "packnplay-my-project" {
+		t.Errorf("GenerateNetworkName() = %v, want packnplay-my-project", got)
+	}
+}
+
 func TestGenerateLabels(t *testing.T) {
 	labels := GenerateLabels("myproject", "feature-auth")
 
@@ -0,0 +1,79 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LabelWorkspaceVolume names the volume a container's workspace was cloned into
+const LabelWorkspaceVolume = "packnplay-workspace-volume"
+
+// WorkspaceVolume is a named volume a repository was cloned into with
+// `packnplay run --clone-in-volume`. It outlives the container, so later runs
+// reuse the clone and `packnplay volume rm` can clean it up.
+type WorkspaceVolume struct {
+	Name      string    `json:"name"`
+	Container string    `json:"container"`     // container the volume is mounted in
+	HostPath  string    `json:"host_path"`     // repository the clone was made from
+	CloneURL  string    `json:"clone_url"`     // remote the repository was cloned from
+	Ref       string    `json:"ref,omitempty"` // branch or tag cloned, empty for the remote's default branch
+	Target    string    `json:"target"`        // where the volume is mounted in the container
+	Created   time.Time `json:"created"`       // first run that used the volume
+	LastUsed  time.Time `json:"last_used"`     // latest run that used the volume
+}
+
+// WorkspaceVolumeName returns the volume a container's workspace is cloned into
+func WorkspaceVolumeName(containerName string) string {
+	return containerName + "-workspace"
+}
+
+// VolumesPath returns where workspace volumes are tracked
+func VolumesPath() string {
+	return filepath.Join(filepath.Dir(LastUsedPath()), "volumes.json")
+}
+
+// LoadVolumes returns the tracked workspace volumes keyed by volume name
+func LoadVolumes(path string) map[string]WorkspaceVolume {
+	volumes := make(map[string]WorkspaceVolume)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &volumes)
+	}
+	return volumes
+}
+
+// RecordVolume tracks a workspace volume, keeping its original creation time
+func RecordVolume(path string, volume WorkspaceVolume) error {
+	volumes := LoadVolumes(path)
+	if existing, ok := volumes[volume.Name]; ok && !existing.Created.IsZero() {
+		volume.Created = existing.Created
+	}
+	volumes[volume.Name] = volume
+	return saveVolumes(path, volumes)
+}
+
+// ForgetVolume stops tracking a workspace volume
+func ForgetVolume(path, name string) error {
+	volumes := LoadVolumes(path)
+	if _, ok := volumes[name]; !ok {
+		return nil
+	}
+	delete(volumes, name)
+	return saveVolumes(path, volumes)
+}
+
+func saveVolumes(path string, volumes map[string]WorkspaceVolume) error {
+	data, err := json.MarshalIndent(volumes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode volumes: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write volumes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package container
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordVolume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "volumes.json")
+	first := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	later := first.Add(24 * time.Hour)
+
+	volume := WorkspaceVolume{
+		Name:      WorkspaceVolumeName("packnplay-app-volume-main"),
+		Container: "packnplay-app-volume-main",
+		CloneURL:  "git@github.com:me/app.git",
+		Ref:       "main",
+		Target:    "/workspaces/app",
+		Created:   first,
+		LastUsed:  first,
+	}
+	if err := RecordVolume(path, volume); err != nil {
+		t.Fatalf("RecordVolume() error = %v", err)
+	}
+	volume.Created, volume.LastUsed = later, later
+	if err := RecordVolume(path, volume); err != nil {
+		t.Fatalf("RecordVolume() error = %v", err)
+	}
+
+	got, ok := LoadVolumes(path)["packnplay-app-volume-main-workspace"]
+	if !ok {
+		t.Fatalf("LoadVolumes() = %v, want the recorded volume", LoadVolumes(path))
+	}
+	if !got.Created.Equal(first) || !got.LastUsed.Equal(later) {
+		t.Errorf("recorded times = %v/%v, want creation kept and last use updated", got.Created, got.LastUsed)
+	}
+
+	if err := ForgetVolume(path, volume.Name); err != nil {
+		t.Fatalf("ForgetVolume() error = %v", err)
+	}
+	if got := LoadVolumes(path); len(got) != 0 {
+		t.Errorf("LoadVolumes() after ForgetVolume = %v, want empty", got)
+	}
+	if err := ForgetVolume(path, "unknown"); err != nil {
+		t.Errorf("ForgetVolume() of an untracked volume error = %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package contentwatch watches a container's workspace on the host for changes
+// to dependency manifests and lockfiles, and records them so the next attach
+// can rerun updateContentCommand (or suggest it).
+package contentwatch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SignificantFiles are the base-name patterns of files whose changes mean
+// updateContentCommand should run again
+var SignificantFiles = []string{
+	"package.json", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb", "bun.lock",
+	"go.mod", "go.sum",
+	"Cargo.toml", "Cargo.lock",
+	"requirements*.txt", "Pipfile", "Pipfile.lock", "poetry.lock", "pyproject.toml", "uv.lock",
+	"Gemfile", "Gemfile.lock",
+	"composer.json", "composer.lock",
+	"mix.exs", "mix.lock",
+	"pom.xml", "build.gradle", "build.gradle.kts",
+}
+
+// skippedDirs are never watched: VCS data and dependency or build output,
+// which change constantly and hold manifests of their own
+var skippedDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "target": true,
+	".venv": true, "venv": true, "__pycache__": true, ".tox": true, "_build": true, "deps": true,
+}
+
+// IsSignificant reports whether a file name matches SignificantFiles or one
+// of the extra patterns
+func IsSignificant(name string, extra []string) bool {
+	base := filepath.Base(name)
+	for _, patterns := range [][]string{SignificantFiles, extra} {
+		for _, pattern := range patterns {
+			if ok, _ := filepath.Match(pattern, base); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stateDir returns where change markers and daemon pid files are kept
+func stateDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "packnplay", "content-watch"), nil
+}
+
+func statePath(containerName, ext string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, containerName+ext), nil
+}
+
+// Record adds workspace-relative paths to the container's pending changes
+func Record(containerName string, paths ...string) error {
+	path, err := statePath(containerName, ".changes")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create content watch directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to record content change: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	for _, p := range paths {
+		if _, err := fmt.Fprintln(f, p); err != nil {
+			return fmt.Errorf("failed to record content change: %w", err)
+		}
+	}
+	return nil
+}
+
+// Pending returns the changed paths recorded for the container since the last
+// Clear, sorted and without duplicates
+func Pending(containerName string) ([]string, error) {
+	path, err := statePath(containerName, ".changes")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content changes: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	seen := make(map[string]bool)
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p := strings.TrimSpace(scanner.Text()); p != "" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths, scanner.Err()
+}
+
+// Clear forgets the container's pending changes
+func Clear(containerName string) error {
+	path, err := statePath(containerName, ".changes")
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear content changes: %w", err)
+	}
+	return nil
+}
+
+// Watcher reports changes to significant files under a workspace
+type Watcher struct {
+	root    string
+	extra   []string
+	watcher *fsnotify.Watcher
+}
+
+// NewWatcher watches every directory under root except skippedDirs
+func NewWatcher(root string, extra []string) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	w := &Watcher{root: root, extra: extra, watcher: watcher}
+	if err := w.addTree(root); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addTree watches dir and the directories below it
+func (w *Watcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return fmt.Errorf("failed to watch %s: %w", dir, err)
+			}
+			return nil // vanished or unreadable; skip it
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != w.root && skippedDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil && path == dir {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+// Run calls onChange with the workspace-relative path of each significant file
+// written, created, renamed or removed, until alive reports false (checked
+// every checkInterval) or the watcher fails
+func (w *Watcher) Run(onChange func(path string), alive func() bool, checkInterval time.Duration) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && !skippedDirs[info.Name()] {
+					_ = w.addTree(event.Name)
+					continue
+				}
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 || !IsSignificant(event.Name, w.extra) {
+				continue
+			}
+			rel, err := filepath.Rel(w.root, event.Name)
+			if err != nil {
+				rel = event.Name
+			}
+			onChange(rel)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-ticker.C:
+			if !alive() {
+				return nil
+			}
+		}
+	}
+}
+
+// Running reports whether a watcher daemon is running for the container
+func Running(containerName string) bool {
+	path, err := statePath(containerName, ".pid")
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return syscall.Kill(pid, 0) == nil
+}
+
+// WritePID records the current process as the container's watcher daemon
+func WritePID(containerName string) (func(), error) {
+	path, err := statePath(containerName, ".pid")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create content watch directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write pid file: %w", err)
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// StartDaemon launches a detached `packnplay content-watch` process for the
+// container unless one is already running
+func StartDaemon(containerName, root string, extra []string) error {
+	if Running(containerName) {
+		return nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create content watch directory: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate packnplay executable: %w", err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, containerName+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open content watch log: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	args := []string{"content-watch", "--container", containerName, "--path", root}
+	for _, pattern := range extra {
+		args = append(args, "--file", pattern)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start content watcher: %w", err)
+	}
+	return cmd.Process.Release()
+}
@@ -0,0 +1,128 @@
+package contentwatch
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsSignificant(t *testing.T) {
+	tests := map[string]bool{
+		"/src/app/package.json":      true,
+		"web/pnpm-lock.yaml":         true,
+		"go.sum":                     true,
+		"requirements-dev.txt":       true,
+		"main.go":                    false,
+		"README.md":                  false,
+		"/src/app/App.csproj":        false,
+		"/src/app/package.json.orig": false,
+	}
+	for name, want := range tests {
+		if got := IsSignificant(name, nil); got != want {
+			t.Errorf("IsSignificant(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if !IsSignificant("/src/app/App.csproj", []string{"*.csproj"}) {
+		t.Error("extra patterns should count as significant")
+	}
+}
+
+func TestRecordPendingClear(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	if pending, err := Pending("c1"); err != nil || pending != nil {
+		t.Fatalf("Pending() with nothing recorded = %v, %v", pending, err)
+	}
+	if err := Record("c1", "go.sum", "web/package.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Record("c1", "go.sum"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := Pending("c1"); err != nil || !reflect.DeepEqual(pending, []string{"go.sum", "web/package.json"}) {
+		t.Errorf("Pending() = %v, %v, want sorted unique paths", pending, err)
+	}
+	if pending, _ := Pending("c2"); pending != nil {
+		t.Errorf("Pending(c2) = %v, changes are per container", pending)
+	}
+	if err := Clear("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := Pending("c1"); pending != nil {
+		t.Errorf("Pending() after Clear = %v", pending)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"web", "node_modules/left-pad"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := NewWatcher(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = w.Close() }()
+
+	changes := make(chan string, 10)
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	alive := func() bool {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+	go func() { done <- w.Run(func(path string) { changes <- path }, alive, 10*time.Millisecond) }()
+
+	write := func(rel string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, rel), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("node_modules/left-pad/package.json") // dependency output isn't watched
+	write("web/main.js")                        // not a manifest
+	write("web/package.json")
+
+	select {
+	case path := <-changes:
+		if path != filepath.Join("web", "package.json") {
+			t.Errorf("first change = %q, want web/package.json", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported for web/package.json")
+	}
+
+	// Directories created later are watched too
+	if err := os.MkdirAll(filepath.Join(root, "svc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(5 * time.Second)
+	for found := false; !found; {
+		write("svc/go.mod")
+		select {
+		case path := <-changes:
+			found = path == filepath.Join("svc", "go.mod")
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no change reported in a new directory")
+		}
+	}
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not stop when the container went away")
+	}
+}
@@ -0,0 +1,252 @@
+// Package credstore keeps the credentials packnplay hands to containers
+// encrypted at rest: in the macOS keychain, in the Secret Service (libsecret)
+// on Linux, or in files encrypted to a local X25519 key when neither is
+// available. Plaintext only exists in RAM-backed runtime files while
+// containers use it.
+package credstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// ErrNotFound is returned by Get for a key the store doesn't hold
+var ErrNotFound = errors.New("credential not found")
+
+// Backends, selected with credential_store in config.json
+const (
+	BackendAuto          = "auto"           // keychain on macOS, Secret Service on Linux, else file
+	BackendKeychain      = "keychain"       // macOS keychain via security(1)
+	BackendSecretService = "secret-service" // libsecret via secret-tool(1)
+	BackendFile          = "file"           // files encrypted to a local X25519 key
+)
+
+// ClaudeCredentials is the key of the Claude credentials shared by containers
+// whose host has none of its own. In the keychain it is the
+// packnplay-containers-credentials item earlier versions wrote.
+const ClaudeCredentials = "containers-credentials"
+
+// BuildSecretKey is the key of a secret set with `packnplay secret set`, which
+// Dockerfile builds can mount (customizations.packnplay.build.secrets)
+func BuildSecretKey(name string) string {
+	return "build-secret-" + name
+}
+
+// Store holds secrets by key
+type Store interface {
+	// Name returns the backend name
+	Name() string
+	// Get returns the secret stored under key, or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Set stores value under key, replacing any previous value
+	Set(key string, value []byte) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(key string) error
+}
+
+// runFunc runs a command with input on stdin and returns its stdout
+type runFunc func(input []byte, name string, args ...string) ([]byte, error)
+
+// runCommand passes input through an anonymous pipe so secrets never appear in
+// argv or on disk
+func runCommand(input []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return output, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return output, fmt.Errorf("%s: %w", name, err)
+	}
+	return output, nil
+}
+
+// Open returns the store for backend, with file-backed secrets kept in dir.
+// BackendAuto (or empty) picks the OS store when it is usable and falls back
+// to files.
+func Open(backend, dir string) (Store, error) {
+	switch backend {
+	case "", BackendAuto:
+		if runtime.GOOS == "darwin" && available("security") {
+			return newKeychainStore(runCommand), nil
+		}
+		if runtime.GOOS == "linux" && available("secret-tool") && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+			return newSecretServiceStore(runCommand), nil
+		}
+		return NewFileStore(dir), nil
+	case BackendKeychain:
+		if !available("security") {
+			return nil, fmt.Errorf("credential store %q needs the macOS security command", backend)
+		}
+		return newKeychainStore(runCommand), nil
+	case BackendSecretService:
+		if !available("secret-tool") {
+			return nil, fmt.Errorf("credential store %q needs secret-tool (libsecret-tools)", backend)
+		}
+		return newSecretServiceStore(runCommand), nil
+	case BackendFile:
+		return NewFileStore(dir), nil
+	}
+	return nil, fmt.Errorf("unknown credential store %q (use %s, %s, %s or %s)", backend, BackendAuto, BackendKeychain, BackendSecretService, BackendFile)
+}
+
+// available reports whether a command is on PATH
+var available = func(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// DefaultDir returns where the file backend keeps its key and encrypted secrets
+func DefaultDir() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "packnplay", "credentials")
+}
+
+// RuntimeDir returns where decrypted credentials are written for containers to
+// mount. $XDG_RUNTIME_DIR and /dev/shm are RAM-backed; hosts with neither
+// (macOS) get a directory in the per-user temp dir.
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "packnplay")
+	}
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		return filepath.Join("/dev/shm", fmt.Sprintf("packnplay-%d", os.Getuid()))
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("packnplay-%d", os.Getuid()))
+}
+
+// EnsureRuntimeDir creates RuntimeDir, or checks the one that exists is the
+// user's own: its name is predictable, so another local user could create it
+// first, or plant a symlink in its place, to read the credentials written there
+func EnsureRuntimeDir() (string, error) {
+	dir := RuntimeDir()
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", fmt.Errorf("failed to create runtime directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to check runtime directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("runtime directory %s is not a directory (a symlink?); remove it", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return "", fmt.Errorf("runtime directory %s belongs to uid %d, not you; remove it", dir, stat.Uid)
+	}
+	if info.Mode().Perm() != 0700 {
+		if err := os.Chmod(dir, 0700); err != nil {
+			return "", fmt.Errorf("failed to restrict runtime directory: %w", err)
+		}
+	}
+	return dir, nil
+}
+
+// CreateRuntimeTemp creates a new file, readable only by the user, in
+// RuntimeDir (see os.CreateTemp for pattern)
+func CreateRuntimeTemp(pattern string) (*os.File, error) {
+	dir, err := EnsureRuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file in runtime directory: %w", err)
+	}
+	return f, nil
+}
+
+// WriteRuntimeFile writes decrypted content to name in RuntimeDir, readable
+// only by the user, and returns its path. A new file is renamed into place;
+// an existing one is rewritten in place, since running containers bind mount
+// it by inode, once it's checked to be the user's own regular file.
+func WriteRuntimeFile(name string, content []byte) (string, error) {
+	dir, err := EnsureRuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NOFOLLOW, 0)
+	if os.IsNotExist(err) {
+		if err := writeFileAtomic(path, content); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); !info.Mode().IsRegular() || (ok && int(stat.Uid) != os.Getuid()) {
+		return "", fmt.Errorf("%s is not your regular file; remove it", path)
+	}
+	if err := f.Chmod(0600); err != nil {
+		return "", fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := f.Write(content); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// WriteRuntimeFileAtomic replaces name in RuntimeDir with content, readable
+// only by the user, for files nothing mounts
+func WriteRuntimeFileAtomic(name string, content []byte) (string, error) {
+	dir, err := EnsureRuntimeDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return path, writeFileAtomic(path, content)
+}
+
+// writeFileAtomic replaces path with content by renaming a temporary file
+// (created mode 0600) into place
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package credstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "credentials")
+	store := NewFileStore(dir)
+
+	if _, err := store.Get(ClaudeCredentials); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() on an empty store error = %v, want ErrNotFound", err)
+	}
+
+	secret := []byte(`{"claudeAiOauth":{"accessToken":"sk-ant-oat01-secret"}}`)
+	if err := store.Set(ClaudeCredentials, secret); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	got, err := store.Get(ClaudeCredentials)
+	if err != nil || string(got) != string(secret) {
+		t.Fatalf("Get() = %q, %v; want the stored secret", got, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ClaudeCredentials+".enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-ant") {
+		t.Error("the secret file holds the plaintext")
+	}
+	for _, name := range []string{identityFile, ClaudeCredentials + ".enc"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, %v; want 0600", name, info.Mode(), err)
+		}
+	}
+
+	if err := store.Delete(ClaudeCredentials); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ClaudeCredentials); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ClaudeCredentials); err != nil {
+		t.Errorf("Delete() of a missing key error = %v", err)
+	}
+}
+
+func TestFileStoreRejectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	if err := store.Set("a", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "a.enc")
+	data, _ := os.ReadFile(path)
+
+	// Moved to another key: the key name is authenticated
+	if err := os.WriteFile(filepath.Join(dir, "b.enc"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("b"); err == nil {
+		t.Error("Get() of a secret renamed to another key should fail")
+	}
+
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("a"); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("Get() of a modified file error = %v, want a decryption failure", err)
+	}
+
+	// Another store's key can't decrypt it
+	other := NewFileStore(t.TempDir())
+	if err := other.Set("a", []byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, identityFile), filepath.Join(dir, "saved")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("b"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Get() without the key error = %v, want the missing key reported", err)
+	}
+
+	if err := store.Set("../escape", []byte("x")); err == nil {
+		t.Error("Set() should reject keys that aren't file names")
+	}
+}
+
+func TestFileStoreRejectsExposedIdentity(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	if err := store.Set("a", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, identityFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("a"); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("Get() error = %v, want an exposed key refused", err)
+	}
+}
+
+func TestHKDFSHA256(t *testing.T) {
+	// RFC 5869 test case 1, first 32 bytes of the output
+	ikm, _ := hex.DecodeString(strings.Repeat("0b", 22))
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	want := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if got := hex.EncodeToString(hkdfSHA256(ikm, salt, info)); got != want {
+		t.Errorf("hkdfSHA256() = %s, want %s", got, want)
+	}
+}
+
+// fakeRun records commands and answers them from responses keyed by command line
+type fakeRun struct {
+	calls     []string
+	inputs    []string
+	responses map[string]string
+	errors    map[string]error
+}
+
+func (f *fakeRun) run(input []byte, name string, args ...string) ([]byte, error) {
+	line := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, line)
+	f.inputs = append(f.inputs, string(input))
+	return []byte(f.responses[line]), f.errors[line]
+}
+
+func TestKeychainStore(t *testing.T) {
+	fake := &fakeRun{
+		responses: map[string]string{"security find-generic-password -s packnplay-containers-credentials -a packnplay -w": "{\"token\":\"x\"}\n"},
+		errors:    map[string]error{"security find-generic-password -s packnplay-missing -a packnplay -w": fmt.Errorf("security: exit status 44: The specified item could not be found in the keychain.")},
+	}
+	store := newKeychainStore(fake.run)
+
+	if got, err := store.Get(ClaudeCredentials); err != nil || string(got) != `{"token":"x"}` {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing item error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Set(ClaudeCredentials, []byte("s3cret")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	last := len(fake.calls) - 1
+	if fake.calls[last] != "security -i" || strings.Contains(fake.calls[last], "s3cret") {
+		t.Errorf("Set() ran %q; the secret must not be in argv", fake.calls[last])
+	}
+	if want := "add-generic-password -U -s packnplay-containers-credentials -a packnplay -X " + hex.EncodeToString([]byte("s3cret")) + "\n"; fake.inputs[last] != want {
+		t.Errorf("Set() input = %q, want %q", fake.inputs[last], want)
+	}
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	fake := &fakeRun{
+		responses: map[string]string{"secret-tool lookup application packnplay key containers-credentials": `{"token":"x"}`},
+		errors:    map[string]error{"secret-tool lookup application packnplay key missing": fmt.Errorf("secret-tool: exit status 1")},
+	}
+	store := newSecretServiceStore(fake.run)
+
+	if got, err := store.Get(ClaudeCredentials); err != nil || string(got) != `{"token":"x"}` {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	if _, err := store.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a missing secret error = %v, want ErrNotFound", err)
+	}
+	if err := store.Set(ClaudeCredentials, []byte("s3cret")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	last := len(fake.calls) - 1
+	if fake.calls[last] != "secret-tool store --label packnplay containers-credentials application packnplay key containers-credentials" || fake.inputs[last] != "s3cret" {
+		t.Errorf("Set() ran %q with input %q", fake.calls[last], fake.inputs[last])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	orig := available
+	defer func() { available = orig }()
+	available = func(string) bool { return false }
+
+	dir := t.TempDir()
+	if store, err := Open(BackendAuto, dir); err != nil || store.Name() != BackendFile {
+		t.Errorf("Open(auto) without an OS store = %v, %v; want the file store", store, err)
+	}
+	if _, err := Open(BackendSecretService, dir); err == nil {
+		t.Error("Open(secret-service) without secret-tool should fail")
+	}
+	if _, err := Open("vault", dir); err == nil {
+		t.Error("Open() of an unknown backend should fail")
+	}
+}
+
+func TestWriteRuntimeFile(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+	path, err := WriteRuntimeFile("creds.json", []byte("first"))
+	if err != nil {
+		t.Fatalf("WriteRuntimeFile() error = %v", err)
+	}
+	before, _ := os.Stat(path)
+	if _, err := WriteRuntimeFile("creds.json", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if data, _ := os.ReadFile(path); string(data) != "second" || !os.SameFile(before, after) {
+		t.Errorf("rewrite = %q, same file %v; want the file rewritten in place", data, os.SameFile(before, after))
+	}
+	if after.Mode().Perm() != 0600 || filepath.Dir(path) != filepath.Join(runtimeDir, "packnplay") {
+		t.Errorf("runtime file %s mode %v", path, after.Mode())
+	}
+}
+
+func TestWriteRuntimeFileRefusesPlantedPaths(t *testing.T) {
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	elsewhere := t.TempDir()
+
+	// A symlink in place of the directory
+	if err := os.Symlink(elsewhere, filepath.Join(runtimeDir, "packnplay")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteRuntimeFile("creds.json", []byte("secret")); err == nil {
+		t.Error("WriteRuntimeFile() through a symlinked runtime directory succeeded")
+	}
+	if err := os.Remove(filepath.Join(runtimeDir, "packnplay")); err != nil {
+		t.Fatal(err)
+	}
+
+	// An open directory is made private
+	if err := os.Mkdir(filepath.Join(runtimeDir, "packnplay"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := EnsureRuntimeDir()
+	if err != nil {
+		t.Fatalf("EnsureRuntimeDir() error = %v", err)
+	}
+	if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+		t.Errorf("runtime directory mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	// A symlink in place of the file
+	target := filepath.Join(elsewhere, "stolen")
+	if err := os.Symlink(target, filepath.Join(dir, "creds.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteRuntimeFile("creds.json", []byte("secret")); err == nil {
+		t.Error("WriteRuntimeFile() through a symlink succeeded")
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("symlink target was written: %v", err)
+	}
+}
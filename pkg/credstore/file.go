@@ -0,0 +1,225 @@
+package credstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// fileMagic starts every encrypted secret file
+	fileMagic = "packnplay-credstore-v1\n"
+	// identityFile holds the store's X25519 private key
+	identityFile = "identity.key"
+	// hkdfInfo binds derived keys to this file format
+	hkdfInfo = "packnplay-credstore-v1 X25519"
+)
+
+// validKey keeps keys usable as file names
+var validKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// FileStore keeps each secret in its own file, encrypted the way age encrypts
+// to an X25519 recipient: a fresh ephemeral key pair per write, agreed with
+// the store's identity key, and HKDF-SHA256 deriving the AES-256-GCM key. The
+// identity is readable only by the user, so copies of the secret files (in
+// backups or synced folders) are useless without it.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore keeping its identity and secrets in dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) Name() string { return BackendFile }
+
+func (s *FileStore) path(key string) (string, error) {
+	if !validKey.MatchString(key) {
+		return "", fmt.Errorf("invalid credential key %q", key)
+	}
+	return filepath.Join(s.dir, key+".enc"), nil
+}
+
+// identity loads the store's private key, generating it if create is set
+func (s *FileStore) identity(create bool) (*ecdh.PrivateKey, error) {
+	path := filepath.Join(s.dir, identityFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate credential store key: %w", err)
+		}
+		if err := os.MkdirAll(s.dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create credential store: %w", err)
+		}
+		if err := writeFileAtomic(path, []byte(hex.EncodeToString(key.Bytes())+"\n")); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential store key: %w", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("credential store key %s is accessible to other users; run: chmod 600 %s", path, path)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential store key %s: %w", path, err)
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential store key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	identity, err := s.identity(false)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("cannot decrypt %s: credential store key %s is missing", path, filepath.Join(s.dir, identityFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(identity, data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return plaintext, nil
+}
+
+func (s *FileStore) Set(key string, value []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	identity, err := s.identity(true)
+	if err != nil {
+		return err
+	}
+	data, err := encrypt(identity.PublicKey(), value, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (s *FileStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", path, err)
+	}
+	return nil
+}
+
+// encrypt seals plaintext to recipient. The key name is authenticated along
+// with it, so a secret file renamed to another key fails to decrypt.
+//
+// Format: fileMagic, ephemeral public key (32 bytes), nonce, ciphertext.
+func encrypt(recipient *ecdh.PublicKey, plaintext []byte, name string) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(fileMagic), ephemeral.PublicKey().Bytes()...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, []byte(name)), nil
+}
+
+// decrypt opens data sealed by encrypt to identity's public key
+func decrypt(identity *ecdh.PrivateKey, data []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(fileMagic)) {
+		return nil, errors.New("not a packnplay credential file")
+	}
+	data = data[len(fileMagic):]
+	if len(data) < 32 {
+		return nil, errors.New("truncated credential file")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(data[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(shared, data[:32], identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	data = data[32:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("truncated credential file")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+// newAEAD derives the AES-256-GCM key for a shared secret, salted with both
+// public keys as age does
+func newAEAD(shared, ephemeralPublic, recipientPublic []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte{}, ephemeralPublic...), recipientPublic...)
+	block, err := aes.NewCipher(hkdfSHA256(shared, salt, []byte(hkdfInfo)))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// hkdfSHA256 derives a 32-byte key (RFC 5869 with a single output block)
+func hkdfSHA256(secret, salt, info []byte) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
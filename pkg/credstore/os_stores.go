@@ -0,0 +1,94 @@
+package credstore
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// keychainAccount is the account of packnplay's keychain items
+const keychainAccount = "packnplay"
+
+// keychainStore keeps secrets as generic passwords in the macOS login keychain
+type keychainStore struct {
+	run runFunc
+}
+
+func newKeychainStore(run runFunc) *keychainStore {
+	return &keychainStore{run: run}
+}
+
+func (s *keychainStore) Name() string { return BackendKeychain }
+
+func keychainService(key string) string { return "packnplay-" + key }
+
+func (s *keychainStore) Get(key string) ([]byte, error) {
+	output, err := s.run(nil, "security", "find-generic-password", "-s", keychainService(key), "-a", keychainAccount, "-w")
+	if err != nil {
+		if strings.Contains(err.Error(), "could not be found") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read %s from the keychain: %w", key, err)
+	}
+	return []byte(strings.TrimSuffix(string(output), "\n")), nil
+}
+
+func (s *keychainStore) Set(key string, value []byte) error {
+	// security -i reads the command from the pipe, keeping the secret out of argv
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", keychainService(key), keychainAccount, hex.EncodeToString(value))
+	if _, err := s.run([]byte(command), "security", "-i"); err != nil {
+		return fmt.Errorf("failed to write %s to the keychain: %w", key, err)
+	}
+	return nil
+}
+
+func (s *keychainStore) Delete(key string) error {
+	if _, err := s.run(nil, "security", "delete-generic-password", "-s", keychainService(key), "-a", keychainAccount); err != nil && !strings.Contains(err.Error(), "could not be found") {
+		return fmt.Errorf("failed to delete %s from the keychain: %w", key, err)
+	}
+	return nil
+}
+
+// secretServiceStore keeps secrets in the Secret Service (GNOME Keyring,
+// KWallet) through libsecret's secret-tool
+type secretServiceStore struct {
+	run runFunc
+}
+
+func newSecretServiceStore(run runFunc) *secretServiceStore {
+	return &secretServiceStore{run: run}
+}
+
+func (s *secretServiceStore) Name() string { return BackendSecretService }
+
+// secretAttributes identify a secret; secret-tool matches on them
+func secretAttributes(key string) []string {
+	return []string{"application", "packnplay", "key", key}
+}
+
+func (s *secretServiceStore) Get(key string) ([]byte, error) {
+	output, err := s.run(nil, "secret-tool", append([]string{"lookup"}, secretAttributes(key)...)...)
+	if err != nil {
+		// secret-tool exits 1 without any output when nothing matches
+		if len(output) == 0 && strings.HasSuffix(err.Error(), "exit status 1") {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read %s from the secret service: %w", key, err)
+	}
+	return output, nil
+}
+
+func (s *secretServiceStore) Set(key string, value []byte) error {
+	args := append([]string{"store", "--label", "packnplay " + key}, secretAttributes(key)...)
+	if _, err := s.run(value, "secret-tool", args...); err != nil {
+		return fmt.Errorf("failed to write %s to the secret service: %w", key, err)
+	}
+	return nil
+}
+
+func (s *secretServiceStore) Delete(key string) error {
+	if _, err := s.run(nil, "secret-tool", append([]string{"clear"}, secretAttributes(key)...)...); err != nil {
+		return fmt.Errorf("failed to delete %s from the secret service: %w", key, err)
+	}
+	return nil
+}
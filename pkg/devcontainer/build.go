@@ -3,15 +3,17 @@ package devcontainer
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 )
 
 // BuildConfig represents build configuration for devcontainer.
 // Corresponds to the "build" property in devcontainer.json.
 type BuildConfig struct {
-	// Dockerfile path relative to .devcontainer directory
+	// Dockerfile path relative to the devcontainer.json
 	Dockerfile string `json:"dockerfile"`
 
-	// Context is the build context path (defaults to .devcontainer if empty)
+	// Context is the build context path relative to the devcontainer.json
+	// (defaults to the directory holding it)
 	Context string `json:"context,omitempty"`
 
 	// Args are build-time variables passed to docker build
@@ -25,6 +27,9 @@ type BuildConfig struct {
 
 	// Options are additional docker build flags
 	Options []string `json:"options,omitempty"`
+
+	// Platform is the target platform (e.g. linux/amd64); builds go through buildx when set
+	Platform string `json:"platform,omitempty"`
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling to handle cacheFrom as string or array
@@ -73,6 +78,11 @@ func (b *BuildConfig) UnmarshalJSON(data []byte) error {
 func (b *BuildConfig) ToDockerArgs(tag string) []string {
 	args := []string{"build"}
 
+	// Platform-specific builds go through buildx and load the result locally
+	if b.Platform != "" {
+		args = []string{"buildx", "build", "--platform", b.Platform, "--load"}
+	}
+
 	// Tag
 	args = append(args, "-t", tag)
 
@@ -106,3 +116,24 @@ func (b *BuildConfig) ToDockerArgs(tag string) []string {
 
 	return args
 }
+
+// BuildPaths returns the absolute Dockerfile and build context of a Dockerfile
+// build. As the spec has it, both are relative to the devcontainer.json
+// (.devcontainer.json at the project root, .devcontainer/devcontainer.json, or
+// .devcontainer/<name>/devcontainer.json), and the context defaults to the
+// directory holding it. A context may leave that directory (".." for the
+// project root).
+func (c *Config) BuildPaths(projectPath string) (dockerfile, context string) {
+	dir := c.Dir(projectPath)
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) {
+			return filepath.Clean(path)
+		}
+		return filepath.Join(dir, path)
+	}
+	context = dir
+	if c.Build != nil && c.Build.Context != "" {
+		context = resolve(c.Build.Context)
+	}
+	return resolve(c.GetDockerfile()), context
+}
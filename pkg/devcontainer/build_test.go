@@ -2,6 +2,8 @@ package devcontainer
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -419,3 +421,130 @@ func TestBuildConfig_InvalidJSON(t *testing.T) {
 		t.Error("Expected error for invalid JSON")
 	}
 }
+
+// TestBuildConfig_ToDockerArgs_Platform tests that platform builds use buildx
+func TestBuildConfig_ToDockerArgs_Platform(t *testing.T) {
+	build := BuildConfig{
+		Dockerfile: "Dockerfile",
+		Platform:   "linux/amd64",
+	}
+
+	args := build.ToDockerArgs("myapp:latest")
+
+	expectedPrefix := []string{"buildx", "build", "--platform", "linux/amd64", "--load"}
+	for i, want := range expectedPrefix {
+		if args[i] != want {
+			t.Errorf("args[%d] = %q, want %q (args: %v)", i, args[i], want, args)
+		}
+	}
+}
+
+// TestConfig_BuildPaths tests that the Dockerfile and context resolve against
+// the devcontainer.json in each layout the spec allows
+func TestConfig_BuildPaths(t *testing.T) {
+	project := "/src/app"
+	tests := []struct {
+		name           string
+		configPath     string // "" for a config not loaded from a file
+		build          *BuildConfig
+		dockerFile     string
+		wantDockerfile string
+		wantContext    string
+	}{
+		{
+			name:           "root .devcontainer.json",
+			configPath:     "/src/app/.devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "Dockerfile"},
+			wantDockerfile: "/src/app/Dockerfile",
+			wantContext:    "/src/app",
+		},
+		{
+			name:           ".devcontainer/devcontainer.json",
+			configPath:     "/src/app/.devcontainer/devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "Dockerfile", Context: ".."},
+			wantDockerfile: "/src/app/.devcontainer/Dockerfile",
+			wantContext:    "/src/app",
+		},
+		{
+			name:           "nested .devcontainer/<name>/devcontainer.json",
+			configPath:     "/src/app/.devcontainer/python/devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "../Dockerfile.base"},
+			wantDockerfile: "/src/app/.devcontainer/Dockerfile.base",
+			wantContext:    "/src/app/.devcontainer/python",
+		},
+		{
+			name:           "nested context escaping to the project root",
+			configPath:     "/src/app/.devcontainer/python/devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "Dockerfile", Context: "../.."},
+			wantDockerfile: "/src/app/.devcontainer/python/Dockerfile",
+			wantContext:    "/src/app",
+		},
+		{
+			name:           "context outside the project",
+			configPath:     "/src/app/.devcontainer/devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "Dockerfile", Context: "../../shared"},
+			wantDockerfile: "/src/app/.devcontainer/Dockerfile",
+			wantContext:    "/src/shared",
+		},
+		{
+			name:           "absolute paths",
+			configPath:     "/src/app/.devcontainer/devcontainer.json",
+			build:          &BuildConfig{Dockerfile: "/opt/images/Dockerfile", Context: "/opt/images/"},
+			wantDockerfile: "/opt/images/Dockerfile",
+			wantContext:    "/opt/images",
+		},
+		{
+			name:           "legacy dockerFile property",
+			configPath:     "/src/app/.devcontainer.json",
+			dockerFile:     ".devcontainer/Dockerfile",
+			wantDockerfile: "/src/app/.devcontainer/Dockerfile",
+			wantContext:    "/src/app",
+		},
+		{
+			name:           "config not loaded from a file",
+			build:          &BuildConfig{Dockerfile: "Dockerfile"},
+			wantDockerfile: "/src/app/.devcontainer/Dockerfile",
+			wantContext:    "/src/app/.devcontainer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Build: tt.build, DockerFile: tt.dockerFile}
+			config.SetPath(tt.configPath)
+			dockerfile, context := config.BuildPaths(project)
+			if dockerfile != filepath.FromSlash(tt.wantDockerfile) {
+				t.Errorf("dockerfile = %q, want %q", dockerfile, tt.wantDockerfile)
+			}
+			if context != filepath.FromSlash(tt.wantContext) {
+				t.Errorf("context = %q, want %q", context, tt.wantContext)
+			}
+		})
+	}
+}
+
+// TestLoadConfig_RecordsPath tests that a loaded config resolves its build
+// paths against the file it came from
+func TestLoadConfig_RecordsPath(t *testing.T) {
+	project := t.TempDir()
+	configDir := filepath.Join(project, ".devcontainer")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configJSON := `{"build": {"dockerfile": "Dockerfile", "context": ".."}, "remoteUser": "dev"}`
+	if err := os.WriteFile(filepath.Join(configDir, "devcontainer.json"), []byte(configJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(project)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.Path() != filepath.Join(configDir, "devcontainer.json") {
+		t.Errorf("Path() = %q", config.Path())
+	}
+	dockerfile, context := config.BuildPaths("/elsewhere")
+	if dockerfile != filepath.Join(configDir, "Dockerfile") || context != project {
+		t.Errorf("BuildPaths() = %q, %q; want them relative to %s", dockerfile, context, configDir)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 
+	"github.com/obra/packnplay/pkg/errdefs"
 	"github.com/obra/packnplay/pkg/userdetect"
 )
 
@@ -89,48 +91,56 @@ type Config struct {
 
 	// Host requirements (advisory validation only)
 	HostRequirements *HostRequirements `json:"hostRequirements,omitempty"`
+
+	// Tool-specific settings, keyed by tool (e.g. "packnplay", "vscode")
+	Customizations map[string]json.RawMessage `json:"customizations,omitempty"`
+
+	// path is the devcontainer.json the config was loaded from, which relative
+	// paths in it are resolved against; empty for the default config
+	path string
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling to handle entrypoint which can be string or array
 func (c *Config) UnmarshalJSON(data []byte) error {
 	// Create a temporary struct with Entrypoint removed to avoid infinite recursion
 	type Alias struct {
-		Image                       string                    `json:"image"`
-		DockerFile                  string                    `json:"dockerFile"`
-		Build                       *BuildConfig              `json:"build,omitempty"`
-		Name                        string                    `json:"name,omitempty"`
-		ContainerUser               string                    `json:"containerUser,omitempty"`
-		RemoteUser                  string                    `json:"remoteUser"`
-		UpdateRemoteUserUID         bool                      `json:"updateRemoteUserUID,omitempty"`
-		UserEnvProbe                string                    `json:"userEnvProbe,omitempty"`
-		ContainerEnv                map[string]string         `json:"containerEnv,omitempty"`
-		RemoteEnv                   map[string]string         `json:"remoteEnv,omitempty"`
-		ForwardPorts                []interface{}             `json:"forwardPorts,omitempty"`
-		PortsAttributes             map[string]PortAttributes `json:"portsAttributes,omitempty"`
-		OtherPortsAttributes        PortAttributes            `json:"otherPortsAttributes,omitempty"`
-		Mounts                      []string                  `json:"mounts,omitempty"`
-		RunArgs                     []string                  `json:"runArgs,omitempty"`
-		Features                    map[string]interface{}    `json:"features,omitempty"`
-		OverrideFeatureInstallOrder []string                  `json:"overrideFeatureInstallOrder,omitempty"`
-		Privileged                  *bool                     `json:"privileged,omitempty"`
-		Init                        *bool                     `json:"init,omitempty"`
-		CapAdd                      []string                  `json:"capAdd,omitempty"`
-		SecurityOpt                 []string                  `json:"securityOpt,omitempty"`
-		DockerComposeFile           interface{}               `json:"dockerComposeFile,omitempty"`
-		Service                     string                    `json:"service,omitempty"`
-		RunServices                 []string                  `json:"runServices,omitempty"`
-		WorkspaceFolder             string                    `json:"workspaceFolder,omitempty"`
-		WorkspaceMount              string                    `json:"workspaceMount,omitempty"`
-		InitializeCommand           *LifecycleCommand         `json:"initializeCommand,omitempty"`
-		OnCreateCommand             *LifecycleCommand         `json:"onCreateCommand,omitempty"`
-		UpdateContentCommand        *LifecycleCommand         `json:"updateContentCommand,omitempty"`
-		PostCreateCommand           *LifecycleCommand         `json:"postCreateCommand,omitempty"`
-		PostStartCommand            *LifecycleCommand         `json:"postStartCommand,omitempty"`
-		PostAttachCommand           *LifecycleCommand         `json:"postAttachCommand,omitempty"`
-		WaitFor                     string                    `json:"waitFor,omitempty"`
-		OverrideCommand             *bool                     `json:"overrideCommand,omitempty"`
-		ShutdownAction              string                    `json:"shutdownAction,omitempty"`
-		HostRequirements            *HostRequirements         `json:"hostRequirements,omitempty"`
+		Image                       string                     `json:"image"`
+		DockerFile                  string                     `json:"dockerFile"`
+		Build                       *BuildConfig               `json:"build,omitempty"`
+		Name                        string                     `json:"name,omitempty"`
+		ContainerUser               string                     `json:"containerUser,omitempty"`
+		RemoteUser                  string                     `json:"remoteUser"`
+		UpdateRemoteUserUID         bool                       `json:"updateRemoteUserUID,omitempty"`
+		UserEnvProbe                string                     `json:"userEnvProbe,omitempty"`
+		ContainerEnv                map[string]string          `json:"containerEnv,omitempty"`
+		RemoteEnv                   map[string]string          `json:"remoteEnv,omitempty"`
+		ForwardPorts                []interface{}              `json:"forwardPorts,omitempty"`
+		PortsAttributes             map[string]PortAttributes  `json:"portsAttributes,omitempty"`
+		OtherPortsAttributes        PortAttributes             `json:"otherPortsAttributes,omitempty"`
+		Mounts                      []string                   `json:"mounts,omitempty"`
+		RunArgs                     []string                   `json:"runArgs,omitempty"`
+		Features                    map[string]interface{}     `json:"features,omitempty"`
+		OverrideFeatureInstallOrder []string                   `json:"overrideFeatureInstallOrder,omitempty"`
+		Privileged                  *bool                      `json:"privileged,omitempty"`
+		Init                        *bool                      `json:"init,omitempty"`
+		CapAdd                      []string                   `json:"capAdd,omitempty"`
+		SecurityOpt                 []string                   `json:"securityOpt,omitempty"`
+		DockerComposeFile           interface{}                `json:"dockerComposeFile,omitempty"`
+		Service                     string                     `json:"service,omitempty"`
+		RunServices                 []string                   `json:"runServices,omitempty"`
+		WorkspaceFolder             string                     `json:"workspaceFolder,omitempty"`
+		WorkspaceMount              string                     `json:"workspaceMount,omitempty"`
+		InitializeCommand           *LifecycleCommand          `json:"initializeCommand,omitempty"`
+		OnCreateCommand             *LifecycleCommand          `json:"onCreateCommand,omitempty"`
+		UpdateContentCommand        *LifecycleCommand          `json:"updateContentCommand,omitempty"`
+		PostCreateCommand           *LifecycleCommand          `json:"postCreateCommand,omitempty"`
+		PostStartCommand            *LifecycleCommand          `json:"postStartCommand,omitempty"`
+		PostAttachCommand           *LifecycleCommand          `json:"postAttachCommand,omitempty"`
+		WaitFor                     string                     `json:"waitFor,omitempty"`
+		OverrideCommand             *bool                      `json:"overrideCommand,omitempty"`
+		ShutdownAction              string                     `json:"shutdownAction,omitempty"`
+		HostRequirements            *HostRequirements          `json:"hostRequirements,omitempty"`
+		Customizations              map[string]json.RawMessage `json:"customizations,omitempty"`
 	}
 
 	var aux Alias
@@ -175,6 +185,7 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	c.OverrideCommand = aux.OverrideCommand
 	c.ShutdownAction = aux.ShutdownAction
 	c.HostRequirements = aux.HostRequirements
+	c.Customizations = aux.Customizations
 
 	// Handle entrypoint field specially - it can be string or array
 	var raw map[string]json.RawMessage
@@ -201,9 +212,42 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// LoadConfig loads and parses .devcontainer/devcontainer.json if it exists
+// ConfigFiles returns projectPath's devcontainer.json files in the spec's
+// order of priority: .devcontainer/devcontainer.json, .devcontainer.json at the
+// project root, then .devcontainer/<name>/devcontainer.json by name
+func ConfigFiles(projectPath string) []string {
+	var files []string
+	for _, path := range []string{
+		filepath.Join(projectPath, ".devcontainer", "devcontainer.json"),
+		filepath.Join(projectPath, ".devcontainer.json"),
+	} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	// Glob sorts its matches
+	named, _ := filepath.Glob(filepath.Join(projectPath, ".devcontainer", "*", "devcontainer.json"))
+	for _, path := range named {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// ConfigFilePath returns the path of projectPath's devcontainer.json: the
+// first of ConfigFiles, or .devcontainer/devcontainer.json when there is none
+func ConfigFilePath(projectPath string) string {
+	if files := ConfigFiles(projectPath); len(files) > 0 {
+		return files[0]
+	}
+	return filepath.Join(projectPath, ".devcontainer", "devcontainer.json")
+}
+
+// LoadConfig loads and parses projectPath's devcontainer.json (see
+// ConfigFilePath) if it has one
 func LoadConfig(projectPath string) (*Config, error) {
-	configPath := filepath.Join(projectPath, ".devcontainer", "devcontainer.json")
+	configPath := ConfigFilePath(projectPath)
 
 	// Check if file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -212,13 +256,14 @@ func LoadConfig(projectPath string) (*Config, error) {
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, err
+		return nil, errdefs.New(errdefs.CategoryConfig, err)
 	}
 
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "invalid %s: %w", configPath, err)
 	}
+	config.path = configPath
 
 	// If RemoteUser is not specified, detect the best user for the image
 	if config.RemoteUser == "" && config.Image != "" {
@@ -237,6 +282,27 @@ func LoadConfig(projectPath string) (*Config, error) {
 	return &config, nil
 }
 
+// Path returns the devcontainer.json the config was loaded from, or "" for a
+// config that wasn't loaded from a file
+func (c *Config) Path() string {
+	return c.path
+}
+
+// SetPath records the devcontainer.json the config was loaded from
+func (c *Config) SetPath(path string) {
+	c.path = path
+}
+
+// Dir returns the directory paths in the config are relative to: the one
+// holding its devcontainer.json, or projectPath's .devcontainer for a config
+// that wasn't loaded from a file
+func (c *Config) Dir(projectPath string) string {
+	if c.path != "" {
+		return filepath.Dir(c.path)
+	}
+	return filepath.Join(projectPath, ".devcontainer")
+}
+
 // GetDefaultConfig returns the default devcontainer config
 // If defaultImage is empty, uses "ghcr.io/obra/packnplay/devcontainer:latest"
 func GetDefaultConfig(defaultImage string) *Config {
@@ -304,6 +370,92 @@ func (c *Config) ShouldOverrideCommand() bool {
 	return *c.OverrideCommand
 }
 
+// LifecycleUser returns the user lifecycle commands run as: remoteUser, falling
+// back to containerUser. Empty means the image's default user.
+func (c *Config) LifecycleUser() string {
+	if c.RemoteUser != "" {
+		return c.RemoteUser
+	}
+	return c.ContainerUser
+}
+
+// WithFeatures returns a copy of the config with the properties and lifecycle
+// commands contributed by features (in installation order) merged in, as the
+// container will actually be created. Values set in the config itself win over
+// feature containerEnv; feature mounts, capabilities and security options are
+// added; privileged and init are enabled if any feature asks for them.
+func (c *Config) WithFeatures(features []*ResolvedFeature) *Config {
+	merged := *c
+	if len(features) == 0 {
+		return &merged
+	}
+
+	env := make(map[string]string)
+	var mounts []string
+	for _, feature := range features {
+		if feature.Metadata == nil {
+			continue
+		}
+		md := feature.Metadata
+		for k, v := range md.ContainerEnv {
+			env[k] = v
+		}
+		for _, m := range md.Mounts {
+			mounts = append(mounts, fmt.Sprintf("type=%s,source=%s,target=%s", m.Type, m.Source, m.Target))
+		}
+		merged.CapAdd = appendUnique(merged.CapAdd, md.CapAdd...)
+		merged.SecurityOpt = appendUnique(merged.SecurityOpt, md.SecurityOpt...)
+		if md.Privileged != nil && *md.Privileged {
+			merged.Privileged = md.Privileged
+		}
+		if md.Init != nil && *md.Init {
+			merged.Init = md.Init
+		}
+	}
+	for k, v := range c.ContainerEnv {
+		env[k] = v
+	}
+	if len(env) > 0 {
+		merged.ContainerEnv = env
+	}
+	if len(mounts) > 0 {
+		merged.Mounts = append(mounts, c.Mounts...)
+	}
+
+	commands := NewLifecycleMerger().MergeCommands(features, map[string]*LifecycleCommand{
+		"onCreateCommand":      c.OnCreateCommand,
+		"updateContentCommand": c.UpdateContentCommand,
+		"postCreateCommand":    c.PostCreateCommand,
+		"postStartCommand":     c.PostStartCommand,
+		"postAttachCommand":    c.PostAttachCommand,
+	})
+	merged.OnCreateCommand = commands["onCreateCommand"]
+	merged.UpdateContentCommand = commands["updateContentCommand"]
+	merged.PostCreateCommand = commands["postCreateCommand"]
+	merged.PostStartCommand = commands["postStartCommand"]
+	merged.PostAttachCommand = commands["postAttachCommand"]
+
+	return &merged
+}
+
+// appendUnique appends the values not already in list, without modifying list
+func appendUnique(list []string, values ...string) []string {
+	result := append([]string(nil), list...)
+	for _, v := range values {
+		found := false
+		for _, existing := range result {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // GetResolvedEnvironment applies variable substitution and returns resolved environment variables
 // First applies containerEnv, then remoteEnv (which can reference containerEnv)
 func (c *Config) GetResolvedEnvironment(ctx *SubstituteContext) map[string]string {
@@ -330,10 +482,34 @@ func (c *Config) GetResolvedEnvironment(ctx *SubstituteContext) map[string]strin
 	return result
 }
 
-// LoadLockFile loads and parses .devcontainer/devcontainer-lock.json if it exists
+// ResolveRemoteEnv applies variable substitution to remoteEnv alone, e.g. to refresh
+// it for an existing container. ctx.ContainerEnv should hold the container's
+// environment so ${containerEnv:...} references resolve. Empty values are omitted.
+func (c *Config) ResolveRemoteEnv(ctx *SubstituteContext) map[string]string {
+	result := make(map[string]string)
+	for k, v := range c.RemoteEnv {
+		if v != "" {
+			result[k] = substituteString(ctx, v)
+		}
+	}
+	return result
+}
+
+// LockFilePath returns the path of projectPath's lockfile, next to its
+// devcontainer.json: .devcontainer-lock.json for a .devcontainer.json, and
+// devcontainer-lock.json otherwise
+func LockFilePath(projectPath string) string {
+	configPath := ConfigFilePath(projectPath)
+	if filepath.Base(configPath) == ".devcontainer.json" {
+		return filepath.Join(filepath.Dir(configPath), ".devcontainer-lock.json")
+	}
+	return filepath.Join(filepath.Dir(configPath), "devcontainer-lock.json")
+}
+
+// LoadLockFile loads and parses projectPath's lockfile (see LockFilePath) if it exists
 // Returns nil if the lockfile doesn't exist (not an error)
 func LoadLockFile(projectPath string) (*LockFile, error) {
-	lockPath := filepath.Join(projectPath, ".devcontainer", "devcontainer-lock.json")
+	lockPath := LockFilePath(projectPath)
 
 	// Check if file exists
 	if _, err := os.Stat(lockPath); os.IsNotExist(err) {
@@ -354,7 +530,8 @@ func LoadLockFile(projectPath string) (*LockFile, error) {
 }
 
 // GetPortAttributes returns the port attributes for a given port
-// If the port is explicitly defined in portsAttributes, returns those attributes
+// If the port is explicitly defined in portsAttributes (directly or via a
+// "start-end" range key), returns those attributes
 // Otherwise, returns otherPortsAttributes (which may be empty)
 func (c *Config) GetPortAttributes(port string) PortAttributes {
 	// Check if this port has explicit attributes
@@ -362,6 +539,15 @@ func (c *Config) GetPortAttributes(port string) PortAttributes {
 		return attrs
 	}
 
+	// Check range keys such as "40000-55000"
+	if portNum, err := strconv.Atoi(port); err == nil {
+		for key, attrs := range c.PortsAttributes {
+			if start, end, err := parsePortRange(key); err == nil && portNum >= start && portNum <= end {
+				return attrs
+			}
+		}
+	}
+
 	// Return otherPortsAttributes as default
 	return c.OtherPortsAttributes
 }
@@ -88,6 +88,58 @@ func TestLoadConfig_NotFound(t *testing.T) {
 	}
 }
 
+func TestConfigFiles_Priority(t *testing.T) {
+	project := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(project, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	loaded := func() string {
+		t.Helper()
+		config, err := LoadConfig(project)
+		if err != nil || config == nil {
+			t.Fatalf("LoadConfig() = %v, %v", config, err)
+		}
+		return config.Image
+	}
+
+	write(".devcontainer/python/devcontainer.json", `{"image": "python:3", "remoteUser": "root"}`)
+	write(".devcontainer/node/devcontainer.json", `{"image": "node:22", "remoteUser": "root"}`)
+	if image := loaded(); image != "node:22" {
+		t.Errorf("with named configs only, loaded %s, want the first by name", image)
+	}
+	if lock := LockFilePath(project); lock != filepath.Join(project, ".devcontainer", "node", "devcontainer-lock.json") {
+		t.Errorf("LockFilePath() = %s, want it next to the config", lock)
+	}
+
+	write(".devcontainer.json", `{"image": "alpine:3.20", "remoteUser": "root"}`)
+	if image := loaded(); image != "alpine:3.20" {
+		t.Errorf("with .devcontainer.json, loaded %s, want it over the named configs", image)
+	}
+	if lock := LockFilePath(project); lock != filepath.Join(project, ".devcontainer-lock.json") {
+		t.Errorf("LockFilePath() = %s, want .devcontainer-lock.json", lock)
+	}
+
+	write(".devcontainer/devcontainer.json", `{"image": "ubuntu:24.04", "remoteUser": "root"}`)
+	if image := loaded(); image != "ubuntu:24.04" {
+		t.Errorf("with .devcontainer/devcontainer.json, loaded %s, want it first", image)
+	}
+
+	want := []string{
+		filepath.Join(project, ".devcontainer", "devcontainer.json"),
+		filepath.Join(project, ".devcontainer.json"),
+		filepath.Join(project, ".devcontainer", "node", "devcontainer.json"),
+		filepath.Join(project, ".devcontainer", "python", "devcontainer.json"),
+	}
+	assert.Equal(t, want, ConfigFiles(project))
+}
+
 func TestGetDefaultConfig(t *testing.T) {
 	// Test with empty string - should use default image and detect user
 	config := GetDefaultConfig("")
@@ -702,3 +754,266 @@ func TestConfig_WorkspaceMount_Integration(t *testing.T) {
 	assert.Equal(t, "/workspace", config.WorkspaceFolder)
 	assert.Equal(t, "vscode", config.RemoteUser)
 }
+
+func TestConfig_PacknplayCustomizations(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"image": "ubuntu", "customizations": {"packnplay": {"preStopCommand": "make checkpoint", "preStopTimeout": 10}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	if err != nil {
+		t.Fatalf("PacknplayCustomizations() error = %v", err)
+	}
+	if cmd, ok := custom.PreStopCommand.AsString(); !ok || cmd != "make checkpoint" || custom.PreStopTimeout != 10 {
+		t.Errorf("PacknplayCustomizations() = %+v", custom)
+	}
+
+	// Absent customizations yield an empty value
+	empty, err := (&Config{}).PacknplayCustomizations()
+	if err != nil || empty.PreStopCommand != nil {
+		t.Errorf("PacknplayCustomizations() on empty config = %+v, %v", empty, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"preStopTimeout": "soon"}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.PacknplayCustomizations(); err == nil {
+		t.Error("PacknplayCustomizations() expected error for invalid timeout")
+	}
+}
+
+func TestPacknplayCustomizations_EnvMode(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"runtimeEnv": ["API_BASE"], "buildEnv": ["PATH"]}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.True(t, custom.IsRuntimeEnv("API_BASE"))
+	assert.False(t, custom.IsRuntimeEnv("PATH"))
+	assert.False(t, custom.IsRuntimeEnv("GOPATH"), "default mode is build")
+
+	custom.EnvMode = "runtime"
+	assert.True(t, custom.IsRuntimeEnv("GOPATH"))
+	assert.False(t, custom.IsRuntimeEnv("PATH"), "buildEnv overrides envMode")
+
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"envMode": "later"}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.PacknplayCustomizations()
+	assert.Error(t, err, "unknown envMode should be rejected")
+}
+
+func TestPacknplayCustomizations_BuildSecrets(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"build": {"secrets": {"pip_token": {"env": "PIP_TOKEN"}}, "ssh": ["default", "github=~/.ssh/id_ed25519"]}}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.Equal(t, "PIP_TOKEN", custom.Build.Secrets["pip_token"].Env)
+	assert.Equal(t, []string{"default", "github=~/.ssh/id_ed25519"}, custom.Build.SSH)
+
+	for _, invalid := range []string{
+		`{"secrets": {"pip": {}}}`,
+		`{"secrets": {"pip": {"env": "PIP_TOKEN", "file": "token.txt"}}}`,
+		`{"secrets": {"pip,src=/etc/shadow": {"env": "PIP_TOKEN"}}}`,
+		`{"ssh": ["=/tmp/agent.sock"]}`,
+	} {
+		if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"build": `+invalid+`}}}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		_, err := cfg.PacknplayCustomizations()
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPacknplayCustomizations_LifecyclePolicy(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"lifecycleParallelism": 2, "lifecycleFailurePolicy": "fail-fast"}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.Equal(t, 2, custom.LifecycleParallelism)
+	assert.Equal(t, LifecycleFailFast, custom.LifecycleFailurePolicy)
+
+	for _, bad := range []string{
+		`{"customizations": {"packnplay": {"lifecycleFailurePolicy": "abort"}}}`,
+		`{"customizations": {"packnplay": {"lifecycleParallelism": -1}}}`,
+	} {
+		cfg = Config{}
+		if err := json.Unmarshal([]byte(bad), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		_, err = cfg.PacknplayCustomizations()
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPacknplayCustomizations_Features(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"features": {"installAttempts": 5, "optional": ["ghcr.io/devcontainers/features/node:1"]}}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.Equal(t, 5, custom.Features.InstallAttempts)
+	assert.True(t, custom.Features.IsOptional("ghcr.io/devcontainers/features/node:1", "node"))
+	assert.False(t, custom.Features.IsOptional("./local-tool", "local-tool"))
+	assert.False(t, (*FeatureCustomization)(nil).IsOptional("./local-tool", "local-tool"))
+
+	cfg = Config{}
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"features": {"retryDelay": -1}}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.PacknplayCustomizations()
+	assert.Error(t, err)
+}
+
+func TestPacknplayCustomizations_InlineFeatures(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"inlineFeatures": {"jq": {"installScript": "apk add jq", "containerEnv": {"JQ_COLORS": "1;30"}, "capAdd": ["SYS_PTRACE"]}}}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.Equal(t, InlineFeature{InstallScript: "apk add jq", ContainerEnv: map[string]string{"JQ_COLORS": "1;30"}, CapAdd: []string{"SYS_PTRACE"}}, custom.InlineFeatures["jq"])
+
+	for _, invalid := range []string{
+		`{"Tools": {"installScript": "apk add jq"}}`,
+		`{"../jq": {"installScript": "apk add jq"}}`,
+		`{"jq": {"containerEnv": {"A": "b"}}}`,
+	} {
+		cfg = Config{}
+		if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"inlineFeatures": `+invalid+`}}}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		_, err = cfg.PacknplayCustomizations()
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPacknplayCustomizations_RestartPolicy(t *testing.T) {
+	for _, policy := range []string{RestartNo, RestartOnFailure, RestartUnlessStopped} {
+		var cfg Config
+		if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"restartPolicy": "`+policy+`"}}}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		custom, err := cfg.PacknplayCustomizations()
+		require.NoError(t, err)
+		assert.Equal(t, policy, custom.RestartPolicy)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"restartPolicy": "always"}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, err := cfg.PacknplayCustomizations()
+	assert.Error(t, err)
+}
+
+func TestPacknplayCustomizations_LifecycleShell(t *testing.T) {
+	for _, tt := range []struct {
+		json string
+		want []string
+	}{
+		{`{}`, nil},
+		{`{"lifecycleStrict": true}`, StrictLifecycleShell},
+		{`{"lifecycleStrict": true, "lifecycleShell": ["bash", "-eo", "pipefail", "-c"]}`, []string{"bash", "-eo", "pipefail", "-c"}},
+	} {
+		var cfg Config
+		if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": `+tt.json+`}}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		custom, err := cfg.PacknplayCustomizations()
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, custom.LifecycleShellArgs(), tt.json)
+	}
+
+	cfg := Config{}
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"lifecycleShell": []}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, err := cfg.PacknplayCustomizations()
+	assert.Error(t, err, "an empty lifecycleShell should be rejected")
+}
+
+func TestPacknplayCustomizations_Services(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"customizations": {"packnplay": {"services": {"db": {"image": "postgres:16", "env": {"POSTGRES_DB": "app"}}}}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := cfg.PacknplayCustomizations()
+	require.NoError(t, err)
+	assert.Equal(t, "postgres:16", custom.Services["db"].Image)
+	assert.Equal(t, "app", custom.Services["db"].Env["POSTGRES_DB"])
+
+	for _, bad := range []string{
+		`{"customizations": {"packnplay": {"services": {"db": {}}}}}`,
+		`{"customizations": {"packnplay": {"services": {"My_DB": {"image": "postgres:16"}}}}}`,
+	} {
+		cfg = Config{}
+		if err := json.Unmarshal([]byte(bad), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		_, err = cfg.PacknplayCustomizations()
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLifecycleUser(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{name: "remote user", cfg: Config{RemoteUser: "vscode", ContainerUser: "root"}, want: "vscode"},
+		{name: "container user fallback", cfg: Config{ContainerUser: "node"}, want: "node"},
+		{name: "image default", cfg: Config{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.LifecycleUser(); got != tt.want {
+				t.Errorf("LifecycleUser() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_WithFeatures(t *testing.T) {
+	privileged := true
+	cfg := &Config{
+		Image:             "ubuntu:22.04",
+		ContainerEnv:      map[string]string{"EDITOR": "vim"},
+		Mounts:            []string{"type=bind,source=/data,target=/data"},
+		CapAdd:            []string{"SYS_PTRACE"},
+		PostCreateCommand: &LifecycleCommand{raw: "make deps"},
+	}
+	features := []*ResolvedFeature{{
+		ID: "docker-in-docker",
+		Metadata: &FeatureMetadata{
+			ContainerEnv:      map[string]string{"DOCKER_BUILDKIT": "1", "EDITOR": "nano"},
+			Privileged:        &privileged,
+			CapAdd:            []string{"SYS_PTRACE", "NET_ADMIN"},
+			Mounts:            []Mount{{Source: "dind-var-lib-docker", Target: "/var/lib/docker", Type: "volume"}},
+			PostCreateCommand: &LifecycleCommand{raw: "dockerd-check"},
+		},
+	}}
+
+	merged := cfg.WithFeatures(features)
+
+	assert.Equal(t, map[string]string{"DOCKER_BUILDKIT": "1", "EDITOR": "vim"}, merged.ContainerEnv, "config containerEnv should win")
+	assert.Equal(t, []string{"type=volume,source=dind-var-lib-docker,target=/var/lib/docker", "type=bind,source=/data,target=/data"}, merged.Mounts)
+	assert.Equal(t, []string{"SYS_PTRACE", "NET_ADMIN"}, merged.CapAdd)
+	require.NotNil(t, merged.Privileged)
+	assert.True(t, *merged.Privileged)
+	commands, ok := merged.PostCreateCommand.AsMerged()
+	require.True(t, ok)
+	assert.Equal(t, []string{"dockerd-check", "make deps"}, commands)
+
+	// The original config is left alone
+	assert.Equal(t, []string{"SYS_PTRACE"}, cfg.CapAdd)
+	assert.Nil(t, cfg.Privileged)
+	assert.Len(t, cfg.Mounts, 1)
+}
@@ -0,0 +1,302 @@
+package devcontainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/hooks"
+)
+
+// PacknplayCustomizations holds packnplay-specific settings from customizations.packnplay
+type PacknplayCustomizations struct {
+	// PreStopCommand runs inside the container before packnplay stops it
+	PreStopCommand *LifecycleCommand `json:"preStopCommand,omitempty"`
+	// PreStopTimeout bounds PreStopCommand in seconds (0 uses the default)
+	PreStopTimeout int `json:"preStopTimeout,omitempty"`
+	// EnvMode is where feature containerEnv goes by default: "build" (ENV in the
+	// image, the default) or "runtime" (-e on the container)
+	EnvMode string `json:"envMode,omitempty"`
+	// BuildEnv and RuntimeEnv override EnvMode for individual variables
+	BuildEnv   []string `json:"buildEnv,omitempty"`
+	RuntimeEnv []string `json:"runtimeEnv,omitempty"`
+	// Hooks are host commands run around the container's lifecycle, after the
+	// hooks from the user's config
+	Hooks hooks.Hooks `json:"hooks,omitempty"`
+	// LifecycleParallelism bounds how many tasks of an object-format lifecycle
+	// command run at once (0 uses the default)
+	LifecycleParallelism int `json:"lifecycleParallelism,omitempty"`
+	// LifecycleFailurePolicy is what happens to the remaining tasks of an
+	// object-format lifecycle command when one fails: "continue-on-error" (the
+	// default) lets them finish, "fail-fast" starts no more
+	LifecycleFailurePolicy string `json:"lifecycleFailurePolicy,omitempty"`
+	// LifecycleShell is the shell and flags string-format lifecycle commands
+	// run with, the command following as its last argument (default
+	// ["/bin/sh", "-c"])
+	LifecycleShell []string `json:"lifecycleShell,omitempty"`
+	// LifecycleStrict runs string-format lifecycle commands with
+	// StrictLifecycleShell, so a failed step or pipeline stage fails the command
+	LifecycleStrict bool `json:"lifecycleStrict,omitempty"`
+	// WatchContent starts a host-side watcher that notices changes to
+	// dependency manifests and lockfiles in the workspace, so the next attach
+	// can point out that updateContentCommand should run again
+	WatchContent bool `json:"watchContent,omitempty"`
+	// AutoUpdateContent reruns updateContentCommand on the next attach after
+	// such a change instead of only pointing it out (implies WatchContent)
+	AutoUpdateContent bool `json:"autoUpdateContent,omitempty"`
+	// ContentFiles are extra file name patterns (e.g. "*.csproj") that count as
+	// such changes
+	ContentFiles []string `json:"contentFiles,omitempty"`
+	// Services are sidecar containers (e.g. postgres:16) started on a network
+	// shared with the container and removed with it, keyed by the hostname
+	// they're reachable at
+	Services map[string]SidecarService `json:"services,omitempty"`
+	// Proxy adjusts the HTTP proxy forwarded from the host into image builds
+	// and the container
+	Proxy *ProxyCustomization `json:"proxy,omitempty"`
+	// Build passes BuildKit secrets and SSH agent access to Dockerfile builds
+	Build *BuildCustomization `json:"build,omitempty"`
+	// Features controls how failed feature installs are retried when the
+	// image is built
+	Features *FeatureCustomization `json:"features,omitempty"`
+	// RestartPolicy is the runtime's restart policy for the container: "no"
+	// (the default), "on-failure", or "unless-stopped", so a container survives
+	// a host reboot; it overrides the restart_policy setting
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+	// InlineFeatures are one-off features defined in devcontainer.json instead
+	// of a feature directory, keyed by their id
+	InlineFeatures map[string]InlineFeature `json:"inlineFeatures,omitempty"`
+}
+
+// InlineFeature is a feature written out in devcontainer.json: an install
+// script and the container properties a devcontainer-feature.json would give
+type InlineFeature struct {
+	InstallScript string            `json:"installScript"`
+	ContainerEnv  map[string]string `json:"containerEnv,omitempty"`
+	CapAdd        []string          `json:"capAdd,omitempty"`
+}
+
+// inlineFeatureNamePattern matches ids usable as a feature id and directory name
+var inlineFeatureNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// FeatureCustomization controls retries of feature installs. Each feature
+// installs in a layer of its own, so a retry reuses the features before it.
+type FeatureCustomization struct {
+	// InstallAttempts is how many times a failing feature install is tried,
+	// including the first (0 uses the default)
+	InstallAttempts int `json:"installAttempts,omitempty"`
+	// RetryDelay is the wait in seconds before the first retry, doubling
+	// after each one (0 uses the default)
+	RetryDelay int `json:"retryDelay,omitempty"`
+	// Optional features, by their reference in "features" or their id, are
+	// left out of the image when every attempt fails, instead of failing the
+	// build
+	Optional []string `json:"optional,omitempty"`
+}
+
+// IsOptional reports whether the feature with reference ref and id may be
+// left out of the image
+func (f *FeatureCustomization) IsOptional(ref, id string) bool {
+	if f == nil {
+		return false
+	}
+	for _, name := range f.Optional {
+		if name == ref || name == id {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildCustomization gives Dockerfile builds secrets (RUN
+// --mount=type=secret,id=<id>) and SSH access (RUN --mount=type=ssh) that,
+// unlike build args, aren't kept in the image or its history
+type BuildCustomization struct {
+	// Secrets are keyed by the id the Dockerfile mounts them with
+	Secrets map[string]BuildSecret `json:"secrets,omitempty"`
+	// SSH are docker build --ssh values: "default" forwards the host's SSH
+	// agent, "<id>=<path>" a socket or key file
+	SSH []string `json:"ssh,omitempty"`
+}
+
+// BuildSecret is where a build secret's value comes from: exactly one of a
+// host environment variable, a host file, or packnplay's credential store
+// (set with `packnplay secret set`)
+type BuildSecret struct {
+	Env   string `json:"env,omitempty"`
+	File  string `json:"file,omitempty"`
+	Store string `json:"store,omitempty"`
+}
+
+// buildSecretIDPattern matches ids usable in docker build --secret and --ssh
+var buildSecretIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ProxyCustomization overrides the host's proxy for a project
+type ProxyCustomization struct {
+	Disabled bool     `json:"disabled,omitempty"` // don't forward a proxy
+	HTTP     string   `json:"http,omitempty"`     // replaces the host's HTTP proxy
+	HTTPS    string   `json:"https,omitempty"`    // replaces the host's HTTPS proxy
+	NoProxy  []string `json:"noProxy,omitempty"`  // hosts that bypass the proxy, e.g. an internal registry
+}
+
+// SidecarService is a container started next to the dev container
+type SidecarService struct {
+	Image   string            `json:"image"`
+	Env     map[string]string `json:"env,omitempty"`     // environment of the sidecar
+	Command []string          `json:"command,omitempty"` // replaces the image's command
+	// ContainerEnv is set in the dev container in addition to the connection
+	// variables packnplay derives for well-known images (DATABASE_URL, REDIS_URL, ...)
+	ContainerEnv map[string]string `json:"containerEnv,omitempty"`
+}
+
+// serviceNamePattern matches names usable as a hostname and in container names
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Restart policies of customizations.packnplay.restartPolicy
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// StrictLifecycleShell runs lifecycle commands with errexit, nounset and pipefail
+var StrictLifecycleShell = []string{"/bin/sh", "-euo", "pipefail", "-c"}
+
+// LifecycleShellArgs returns the shell string-format lifecycle commands run
+// with: LifecycleShell, else StrictLifecycleShell with LifecycleStrict, else
+// nil for the default
+func (p *PacknplayCustomizations) LifecycleShellArgs() []string {
+	if len(p.LifecycleShell) > 0 {
+		return p.LifecycleShell
+	}
+	if p.LifecycleStrict {
+		return StrictLifecycleShell
+	}
+	return nil
+}
+
+// Failure policies for the tasks of object-format lifecycle commands
+const (
+	LifecycleContinueOnError = "continue-on-error"
+	LifecycleFailFast        = "fail-fast"
+)
+
+// IsRuntimeEnv reports whether a feature containerEnv variable is applied when the
+// container starts instead of being baked into the image
+func (p *PacknplayCustomizations) IsRuntimeEnv(name string) bool {
+	for _, n := range p.RuntimeEnv {
+		if n == name {
+			return true
+		}
+	}
+	for _, n := range p.BuildEnv {
+		if n == name {
+			return false
+		}
+	}
+	return p.EnvMode == "runtime"
+}
+
+// PacknplayCustomizations parses customizations.packnplay, returning an empty value when absent
+func (c *Config) PacknplayCustomizations() (*PacknplayCustomizations, error) {
+	custom := &PacknplayCustomizations{}
+	raw, ok := c.Customizations["packnplay"]
+	if !ok {
+		return custom, nil
+	}
+	if err := json.Unmarshal(raw, custom); err != nil {
+		return nil, fmt.Errorf("invalid customizations.packnplay: %w", err)
+	}
+	if custom.PreStopTimeout < 0 {
+		return nil, fmt.Errorf("invalid customizations.packnplay: preStopTimeout must not be negative")
+	}
+	if custom.EnvMode != "" && custom.EnvMode != "build" && custom.EnvMode != "runtime" {
+		return nil, fmt.Errorf("invalid customizations.packnplay: envMode must be \"build\" or \"runtime\", got %q", custom.EnvMode)
+	}
+	if custom.LifecycleParallelism < 0 {
+		return nil, fmt.Errorf("invalid customizations.packnplay: lifecycleParallelism must not be negative")
+	}
+	if custom.LifecycleFailurePolicy != "" && custom.LifecycleFailurePolicy != LifecycleContinueOnError && custom.LifecycleFailurePolicy != LifecycleFailFast {
+		return nil, fmt.Errorf("invalid customizations.packnplay: lifecycleFailurePolicy must be %q or %q, got %q", LifecycleContinueOnError, LifecycleFailFast, custom.LifecycleFailurePolicy)
+	}
+	if custom.LifecycleShell != nil && len(custom.LifecycleShell) == 0 {
+		return nil, fmt.Errorf("invalid customizations.packnplay: lifecycleShell must name a shell")
+	}
+	for _, pattern := range custom.ContentFiles {
+		if _, err := filepath.Match(pattern, ""); err != nil || strings.Contains(pattern, "/") {
+			return nil, fmt.Errorf("invalid customizations.packnplay: contentFiles pattern %q must be a file name pattern", pattern)
+		}
+	}
+	for name, service := range custom.Services {
+		if !serviceNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid customizations.packnplay: service name %q must be lowercase letters, digits and dashes", name)
+		}
+		if service.Image == "" {
+			return nil, fmt.Errorf("invalid customizations.packnplay: service %q needs an image", name)
+		}
+	}
+	if build := custom.Build; build != nil {
+		for id, secret := range build.Secrets {
+			if !buildSecretIDPattern.MatchString(id) {
+				return nil, fmt.Errorf("invalid customizations.packnplay: build secret id %q must be letters, digits, dots, dashes and underscores", id)
+			}
+			sources := 0
+			for _, source := range []string{secret.Env, secret.File, secret.Store} {
+				if source != "" {
+					sources++
+				}
+			}
+			if sources != 1 {
+				return nil, fmt.Errorf("invalid customizations.packnplay: build secret %q needs exactly one of env, file, or store", id)
+			}
+		}
+		for _, ssh := range build.SSH {
+			id, _, _ := strings.Cut(ssh, "=")
+			if !buildSecretIDPattern.MatchString(id) {
+				return nil, fmt.Errorf("invalid customizations.packnplay: build ssh %q must be \"default\" or <id>=<path>", ssh)
+			}
+		}
+	}
+	if features := custom.Features; features != nil && (features.InstallAttempts < 0 || features.RetryDelay < 0) {
+		return nil, fmt.Errorf("invalid customizations.packnplay: features installAttempts and retryDelay must not be negative")
+	}
+	switch custom.RestartPolicy {
+	case "", RestartNo, RestartOnFailure, RestartUnlessStopped:
+	default:
+		return nil, fmt.Errorf("invalid customizations.packnplay: restartPolicy must be %q, %q or %q, got %q", RestartNo, RestartOnFailure, RestartUnlessStopped, custom.RestartPolicy)
+	}
+	for name, feature := range custom.InlineFeatures {
+		if !inlineFeatureNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid customizations.packnplay: inline feature name %q must be lowercase letters, digits, dashes and underscores", name)
+		}
+		if strings.TrimSpace(feature.InstallScript) == "" {
+			return nil, fmt.Errorf("invalid customizations.packnplay: inline feature %q needs an installScript", name)
+		}
+	}
+	if err := custom.Hooks.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid customizations.packnplay: %w", err)
+	}
+	return custom, nil
+}
+
+// VSCodeCustomizations holds the customizations.vscode settings that apply when
+// VS Code (or Cursor) attaches to the container
+type VSCodeCustomizations struct {
+	Extensions []string               `json:"extensions,omitempty"`
+	Settings   map[string]interface{} `json:"settings,omitempty"`
+}
+
+// VSCodeCustomizations parses customizations.vscode, returning an empty value when absent
+func (c *Config) VSCodeCustomizations() (*VSCodeCustomizations, error) {
+	custom := &VSCodeCustomizations{}
+	raw, ok := c.Customizations["vscode"]
+	if !ok {
+		return custom, nil
+	}
+	if err := json.Unmarshal(raw, custom); err != nil {
+		return nil, fmt.Errorf("invalid customizations.vscode: %w", err)
+	}
+	return custom, nil
+}
@@ -0,0 +1,78 @@
+package devcontainer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Feature and template downloads are retried with exponential backoff so a
+// network blip doesn't fail the whole build
+var (
+	downloadAttempts   = 3
+	downloadRetryDelay = 2 * time.Second
+)
+
+// permanentError marks a download failure that retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// retryDownload runs fetch until it succeeds, fails permanently, or runs out of attempts
+func retryDownload(what string, fetch func() error) error {
+	delay := downloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := fetch()
+		if err == nil {
+			return nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if attempt >= downloadAttempts {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: downloading %s failed: %v\nRetrying in %s (attempt %d/%d)...\n", what, err, delay, attempt+1, downloadAttempts)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// orasPermanentMarkers are oras output fragments for failures a retry won't fix
+var orasPermanentMarkers = []string{"unauthorized", "denied", "not found", "manifest unknown", "invalid reference"}
+
+// orasPull pulls an OCI artifact into destDir, retrying transient failures.
+// oras reads HTTPS_PROXY and friends from the environment it inherits.
+func orasPull(ref, destDir string) ([]byte, error) {
+	var output []byte
+	err := retryDownload(ref, func() error {
+		var err error
+		output, err = exec.Command("oras", "pull", "--output", destDir, ref).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, exec.ErrNotFound) {
+			return &permanentError{err}
+		}
+		lower := strings.ToLower(string(output))
+		for _, marker := range orasPermanentMarkers {
+			if strings.Contains(lower, marker) {
+				return &permanentError{err}
+			}
+		}
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	})
+	return output, err
+}
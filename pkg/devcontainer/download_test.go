@@ -0,0 +1,130 @@
+package devcontainer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func withFastRetries(t *testing.T) {
+	t.Helper()
+	delay := downloadRetryDelay
+	downloadRetryDelay = 0
+	t.Cleanup(func() { downloadRetryDelay = delay })
+}
+
+func TestRetryDownload(t *testing.T) {
+	withFastRetries(t)
+
+	calls := 0
+	err := retryDownload("feature", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("retryDownload() = %v after %d calls, want success on the third", err, calls)
+	}
+
+	calls = 0
+	permanent := errors.New("HTTP 404")
+	err = retryDownload("feature", func() error {
+		calls++
+		return &permanentError{permanent}
+	})
+	if err != permanent || calls != 1 {
+		t.Errorf("retryDownload() = %v after %d calls, want the permanent error without retrying", err, calls)
+	}
+
+	calls = 0
+	err = retryDownload("feature", func() error {
+		calls++
+		return errors.New("timeout")
+	})
+	if err == nil || calls != downloadAttempts {
+		t.Errorf("retryDownload() = %v after %d calls, want failure after %d", err, calls, downloadAttempts)
+	}
+}
+
+func TestDownloadHTTPSFeatureRetriesServerErrors(t *testing.T) {
+	withFastRetries(t)
+
+	tarball := createFeatureTarball(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		_, _ = w.Write(tarball)
+	}))
+	defer server.Close()
+
+	resolver := NewFeatureResolver(t.TempDir(), nil)
+	dir, err := resolver.downloadHTTPSFeature(server.URL + "/feature.tgz")
+	if err != nil {
+		t.Fatalf("downloadHTTPSFeature() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want a retry after the 503", requests)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "install.sh")); err != nil {
+		t.Errorf("install.sh missing after retry: %v", err)
+	}
+}
+
+func TestDownloadHTTPSFeatureDoesNotRetryNotFound(t *testing.T) {
+	withFastRetries(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resolver := NewFeatureResolver(t.TempDir(), nil)
+	if _, err := resolver.downloadHTTPSFeature(server.URL + "/missing.tgz"); err == nil {
+		t.Fatal("downloadHTTPSFeature() should fail on 404")
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want no retries for a 404", requests)
+	}
+}
+
+// createFeatureTarball returns a gzipped tarball holding a minimal feature
+func createFeatureTarball(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		"devcontainer-feature.json": `{"id": "retry-feature", "version": "1.0.0", "name": "Retry Feature"}`,
+		"install.sh":                "#!/bin/sh\necho installed\n",
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
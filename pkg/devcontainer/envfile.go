@@ -0,0 +1,96 @@
+package devcontainer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseEnvFile reads a dotenv-style file (KEY=value lines, optional "export"
+// prefix, # comments, single or double quoted values).
+func ParseEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, lineNum)
+		}
+		env[key] = parseEnvValue(strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return env, nil
+}
+
+// parseEnvValue strips quotes and trailing comments from a dotenv value
+func parseEnvValue(value string) string {
+	if len(value) >= 2 {
+		switch value[0] {
+		case '"':
+			if end := strings.LastIndex(value, `"`); end > 0 {
+				inner := value[1:end]
+				inner = strings.ReplaceAll(inner, `\n`, "\n")
+				return strings.ReplaceAll(inner, `\"`, `"`)
+			}
+		case '\'':
+			if end := strings.LastIndex(value, "'"); end > 0 {
+				return value[1:end]
+			}
+		}
+	}
+
+	// Unquoted values may carry an inline comment
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value
+}
+
+// LoadEnvFiles loads workspace environment files with substitution applied.
+// .devcontainer/devcontainer.env is always considered; the project root .env
+// only when includeProjectEnv is set. devcontainer.env wins over .env.
+func LoadEnvFiles(projectPath string, includeProjectEnv bool, ctx *SubstituteContext) (map[string]string, []string, error) {
+	candidates := []string{}
+	if includeProjectEnv {
+		candidates = append(candidates, filepath.Join(projectPath, ".env"))
+	}
+	candidates = append(candidates, filepath.Join(projectPath, ".devcontainer", "devcontainer.env"))
+
+	env := make(map[string]string)
+	var loaded []string
+	for _, path := range candidates {
+		fileEnv, err := ParseEnvFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range fileEnv {
+			env[k] = substituteString(ctx, v)
+		}
+		loaded = append(loaded, path)
+	}
+
+	return env, loaded, nil
+}
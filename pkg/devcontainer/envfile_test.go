@@ -0,0 +1,101 @@
+package devcontainer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devcontainer.env")
+	content := `# comment
+PLAIN=value
+export EXPORTED=yes
+DOUBLE="hello world"
+SINGLE='${not-substituted}'
+INLINE=abc # trailing comment
+EMPTY=
+
+ESCAPED="line1\nline2"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := ParseEnvFile(path)
+	if err != nil {
+		t.Fatalf("ParseEnvFile() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "yes",
+		"DOUBLE":   "hello world",
+		"SINGLE":   "${not-substituted}",
+		"INLINE":   "abc",
+		"EMPTY":    "",
+		"ESCAPED":  "line1\nline2",
+	}
+	for k, want := range expected {
+		if got, ok := env[k]; !ok || got != want {
+			t.Errorf("env[%s] = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestParseEnvFile_InvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("VALID=1\nnot a pair\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseEnvFile(path); err == nil {
+		t.Error("Expected error for malformed line")
+	}
+}
+
+func TestLoadEnvFiles_Precedence(t *testing.T) {
+	projectDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(projectDir, ".devcontainer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".env"), []byte("SHARED=from-dotenv\nONLY_DOTENV=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".devcontainer", "devcontainer.env"), []byte("SHARED=from-devcontainer\nTOKEN=${localEnv:HOST_TOKEN}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &SubstituteContext{
+		LocalWorkspaceFolder: projectDir,
+		LocalEnv:             map[string]string{"HOST_TOKEN": "secret"},
+		ContainerEnv:         map[string]string{},
+	}
+
+	// Project .env is excluded unless requested
+	env, loaded, err := LoadEnvFiles(projectDir, false, ctx)
+	if err != nil {
+		t.Fatalf("LoadEnvFiles() error = %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Errorf("loaded %v, want only devcontainer.env", loaded)
+	}
+	if _, ok := env["ONLY_DOTENV"]; ok {
+		t.Error("project .env should not be loaded when not requested")
+	}
+	if env["TOKEN"] != "secret" {
+		t.Errorf("TOKEN = %q, want substituted localEnv value", env["TOKEN"])
+	}
+
+	// devcontainer.env wins over the project .env
+	env, _, err = LoadEnvFiles(projectDir, true, ctx)
+	if err != nil {
+		t.Fatalf("LoadEnvFiles() error = %v", err)
+	}
+	if env["SHARED"] != "from-devcontainer" {
+		t.Errorf("SHARED = %q, want from-devcontainer", env["SHARED"])
+	}
+	if env["ONLY_DOTENV"] != "1" {
+		t.Errorf("ONLY_DOTENV = %q, want 1", env["ONLY_DOTENV"])
+	}
+}
@@ -4,15 +4,22 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/obra/packnplay/pkg/registry"
 )
 
 // OptionSpec represents a feature option specification
@@ -21,6 +28,7 @@ type OptionSpec struct {
 	Default     interface{} `json:"default,omitempty"`
 	Description string      `json:"description,omitempty"`
 	Proposals   []string    `json:"proposals,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
 }
 
 // Mount represents a mount specification from feature metadata
@@ -148,12 +156,22 @@ type ResolvedFeature struct {
 	Metadata      *FeatureMetadata
 	DependsOn     map[string]interface{} // Feature IDs to options mapping
 	InstallsAfter []string
+
+	// CanonicalID identifies the feature whichever reference named it: the
+	// registry namespace and metadata ID of an OCI feature (such as
+	// ghcr.io/devcontainers/features/node), else the metadata ID
+	CanonicalID string
+
+	// SkipOptionValidation disables option checks when generating install steps
+	SkipOptionValidation bool
 }
 
 // FeatureResolver handles resolving features from various sources
 type FeatureResolver struct {
-	cacheDir string
-	lockfile *LockFile // Optional lockfile for version pinning
+	cacheDir       string
+	lockfile       *LockFile        // Optional lockfile for version pinning
+	skipValidation bool             // Skip validating options against OptionSpec
+	mirrors        registry.Mirrors // Mirrors OCI features are pulled through
 }
 
 // NewFeatureResolver creates a new FeatureResolver with the specified cache directory and optional lockfile
@@ -164,12 +182,150 @@ func NewFeatureResolver(cacheDir string, lockfile *LockFile) *FeatureResolver {
 	}
 }
 
+// SetSkipOptionValidation disables validation of user options against feature OptionSpecs
+func (r *FeatureResolver) SetSkipOptionValidation(skip bool) {
+	r.skipValidation = skip
+}
+
+// SetMirrors pulls OCI features through registry mirrors, or not at all when offline
+func (r *FeatureResolver) SetMirrors(mirrors registry.Mirrors) {
+	r.mirrors = mirrors
+}
+
 // isOCIReference checks if a feature reference is an OCI registry reference
 func isOCIReference(ref string) bool {
 	// OCI references contain : (for version) or start with registry domains
 	return strings.Contains(ref, "ghcr.io/") || strings.Contains(ref, "mcr.microsoft.com/")
 }
 
+// CanonicalFeatureID returns the feature an OCI reference names without the
+// version it asks for, so ghcr.io/devcontainers/features/node:1, ...node:1.6.0
+// and ...node@sha256:<digest> are all ghcr.io/devcontainers/features/node.
+// Other references are returned unchanged.
+func CanonicalFeatureID(ref string) string {
+	if !isOCIReference(ref) {
+		return ref
+	}
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	// A colon before the last slash is a registry port, not a tag
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return strings.ToLower(ref)
+}
+
+// canonicalID returns the CanonicalID of a feature referenced as ref whose
+// metadata has the ID id
+func canonicalID(ref, id string) string {
+	if !isOCIReference(ref) {
+		return id
+	}
+	canonical := CanonicalFeatureID(ref)
+	if id == "" {
+		return canonical
+	}
+	return path.Dir(canonical) + "/" + strings.ToLower(id)
+}
+
+// featureIndex finds the features being resolved, by their keys, by any
+// reference to the same canonical ID, or by their bare metadata IDs
+type featureIndex map[string]string
+
+func newFeatureIndex(features map[string]*ResolvedFeature) featureIndex {
+	index := featureIndex{}
+	for key, feature := range features {
+		if feature.Metadata != nil && feature.Metadata.ID != "" {
+			index[feature.Metadata.ID] = key
+		}
+	}
+	// Canonical IDs and keys win over metadata IDs shared between namespaces
+	for key, feature := range features {
+		if feature.CanonicalID != "" {
+			index[feature.CanonicalID] = key
+		}
+	}
+	for key := range features {
+		index[key] = key
+	}
+	return index
+}
+
+// find returns the key of the feature ref refers to, if it is being resolved
+func (index featureIndex) find(ref string) (string, bool) {
+	if key, ok := index[ref]; ok {
+		return key, true
+	}
+	key, ok := index[CanonicalFeatureID(ref)]
+	return key, ok
+}
+
+// blockingDependency is a dependency a feature can't be installed before
+type blockingDependency struct {
+	Kind string // "dependsOn" or "installsAfter"
+	Ref  string // the reference in the feature's metadata
+	Key  string // the feature Ref refers to, "" if it isn't being installed
+}
+
+// blocking returns the dependencies of feature, stored under key, that aren't
+// installed yet, in a stable order. dependsOn features missing from the set
+// block it; installsAfter features missing from it don't.
+func (index featureIndex) blocking(key string, feature *ResolvedFeature, installed map[string]bool) []blockingDependency {
+	var deps []blockingDependency
+	refs := make([]string, 0, len(feature.DependsOn))
+	for ref := range feature.DependsOn {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		dep, exists := index.find(ref)
+		if !exists {
+			deps = append(deps, blockingDependency{Kind: "dependsOn", Ref: ref})
+		} else if !installed[dep] {
+			deps = append(deps, blockingDependency{Kind: "dependsOn", Ref: ref, Key: dep})
+		}
+	}
+	for _, ref := range feature.InstallsAfter {
+		if after, exists := index.find(ref); exists && after != key && !installed[after] {
+			deps = append(deps, blockingDependency{Kind: "installsAfter", Ref: ref, Key: after})
+		}
+	}
+	return deps
+}
+
+// unresolvableError explains why none of the remaining features can be
+// installed: a dependsOn feature that isn't configured, or else the cycle
+// found by following the features' dependencies from the first remaining one
+func (index featureIndex) unresolvableError(remaining map[string]*ResolvedFeature, installed map[string]bool) error {
+	keys := make([]string, 0, len(remaining))
+	for key := range remaining {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, dep := range index.blocking(key, remaining[key], installed) {
+			if dep.Key == "" {
+				return fmt.Errorf("cannot resolve dependencies: feature %s depends on %s, which is not in the configured features", key, dep.Ref)
+			}
+		}
+	}
+
+	// Every remaining feature waits on another remaining one, so following
+	// them must come back to a feature already seen
+	var steps []string
+	seen := make(map[string]int)
+	for key := keys[0]; ; {
+		if start, ok := seen[key]; ok {
+			return fmt.Errorf("cannot resolve dependencies: feature dependency cycle: %s", strings.Join(steps[start:], ", "))
+		}
+		seen[key] = len(steps)
+		dep := index.blocking(key, remaining[key], installed)[0]
+		steps = append(steps, fmt.Sprintf("%s %s %s", key, dep.Kind, dep.Key))
+		key = dep.Key
+	}
+}
+
 // pullOCIFeature pulls an OCI feature to the cache directory
 //
 // Authentication: This function automatically inherits Docker credentials from ~/.docker/config.json.
@@ -208,9 +364,15 @@ func (r *FeatureResolver) pullOCIFeature(ociRef string) (string, error) {
 	}
 
 	// Use oras to pull the OCI artifact
-	cmd := exec.Command("oras", "pull", "--output", featureCacheDir, ociRef)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
+	var output []byte
+	if _, err := r.mirrors.Pull(ociRef, func(source string) error {
+		var err error
+		output, err = orasPull(source, featureCacheDir)
+		return err
+	}); err != nil {
+		if errors.Is(err, registry.ErrOffline) {
+			return "", fmt.Errorf("OCI feature %w", err)
+		}
 		return "", fmt.Errorf("failed to pull OCI feature %s (is 'oras' installed?): %w\nOutput: %s", ociRef, err, string(output))
 	}
 
@@ -234,7 +396,7 @@ func (r *FeatureResolver) pullOCIFeature(ociRef string) (string, error) {
 	}
 
 	// Extract tarball to the cache directory
-	cmd = exec.Command("tar", "-xf", tarballPath, "-C", featureCacheDir)
+	cmd := exec.Command("tar", "-xf", tarballPath, "-C", featureCacheDir)
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("failed to extract tarball: %w", err)
 	}
@@ -267,23 +429,67 @@ func (r *FeatureResolver) downloadHTTPSFeature(url string) (string, error) {
 		return featureCacheDir, nil
 	}
 
+	if r.mirrors.Offline {
+		return "", fmt.Errorf("feature %s is %w", url, registry.ErrOffline)
+	}
+
 	// Create cache directory
 	if err := os.MkdirAll(featureCacheDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create feature cache directory: %w", err)
 	}
 
-	// Download tarball with timeout
+	// Create temporary file for tarball
+	tmpFile, err := os.CreateTemp("", "feature-*.tgz")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	// Download tarball with timeout; the default transport honors HTTP(S)_PROXY
 	client := &http.Client{
 		Timeout: 30 * time.Second,
 	}
+	if err := retryDownload(url, func() error { return fetchFeatureTarball(client, url, tmpFile) }); err != nil {
+		return "", err
+	}
+
+	// Close file before extraction
+	tmpFile.Close()
+
+	// Extract tarball to cache directory
+	// Note: tar automatically strips leading / and prevents absolute paths by default
+	// unless -P flag is used. We intentionally omit -P for security.
+	cmd := exec.Command("tar", "-xf", tmpFile.Name(), "-C", featureCacheDir)
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to extract tarball: %w", err)
+	}
+
+	return featureCacheDir, nil
+}
+
+// fetchFeatureTarball downloads url into dst, replacing anything a previous attempt wrote.
+// Failures a retry can't fix are returned as permanentError.
+func fetchFeatureTarball(client *http.Client, url string, dst *os.File) error {
+	if err := dst.Truncate(0); err != nil {
+		return &permanentError{fmt.Errorf("failed to reset temp file: %w", err)}
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return &permanentError{fmt.Errorf("failed to reset temp file: %w", err)}
+	}
+
 	resp, err := client.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("failed to download feature from %s: %w", url, err)
+		return fmt.Errorf("failed to download feature from %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("failed to download feature: HTTP %d", resp.StatusCode)
+		err := fmt.Errorf("failed to download feature: HTTP %d", resp.StatusCode)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return err
+		}
+		return &permanentError{err}
 	}
 
 	// Validate Content-Type to ensure it's a tarball
@@ -303,44 +509,26 @@ func (r *FeatureResolver) downloadHTTPSFeature(url string) (string, error) {
 		}
 	}
 	if !isValidType && contentType != "" {
-		return "", fmt.Errorf("invalid content type for feature tarball: %s (expected gzip/tar archive)", contentType)
-	}
-
-	// Create temporary file for tarball
-	tmpFile, err := os.CreateTemp("", "feature-*.tgz")
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return &permanentError{fmt.Errorf("invalid content type for feature tarball: %s (expected gzip/tar archive)", contentType)}
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
 	// Write response to temp file with size limit
 	const maxFeatureSize = 100 * 1024 * 1024 // 100MB
 	limitedReader := io.LimitReader(resp.Body, maxFeatureSize)
-	n, err := io.Copy(tmpFile, limitedReader)
+	n, err := io.Copy(dst, limitedReader)
 	if err != nil {
-		return "", fmt.Errorf("failed to write tarball: %w", err)
+		return fmt.Errorf("failed to write tarball: %w", err)
 	}
 	if n == maxFeatureSize {
-		return "", fmt.Errorf("feature tarball exceeds maximum size of 100MB")
-	}
-
-	// Close file before extraction
-	tmpFile.Close()
-
-	// Extract tarball to cache directory
-	// Note: tar automatically strips leading / and prevents absolute paths by default
-	// unless -P flag is used. We intentionally omit -P for security.
-	cmd := exec.Command("tar", "-xf", tmpFile.Name(), "-C", featureCacheDir)
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("failed to extract tarball: %w", err)
+		return &permanentError{fmt.Errorf("feature tarball exceeds maximum size of 100MB")}
 	}
-
-	return featureCacheDir, nil
+	return nil
 }
 
 // ResolveFeature resolves a local feature from the given path with the specified options
 func (r *FeatureResolver) ResolveFeature(featurePath string, options map[string]interface{}) (*ResolvedFeature, error) {
+	originalRef := featurePath
+
 	// Check if lockfile has a pinned version for this feature
 	if r.lockfile != nil {
 		if locked, exists := r.lockfile.Features[featurePath]; exists {
@@ -388,15 +576,24 @@ func (r *FeatureResolver) ResolveFeature(featurePath string, options map[string]
 		return nil, fmt.Errorf("failed to read feature metadata: %w", err)
 	}
 
+	// Validate user options against the feature's OptionSpec before anything is built
+	if !r.skipValidation && metadata.Options != nil {
+		if err := NewFeatureOptionsProcessor().ValidateOptions(options, metadata.Options); err != nil {
+			return nil, fmt.Errorf("invalid options for feature %s: %w (use --skip-feature-validation to bypass)", originalRef, err)
+		}
+	}
+
 	// Create resolved feature
 	resolved := &ResolvedFeature{
-		ID:            metadata.ID,
-		Version:       metadata.Version,
-		InstallPath:   featurePath,
-		Options:       options,
-		Metadata:      &metadata,
-		DependsOn:     metadata.DependsOn,
-		InstallsAfter: metadata.InstallsAfter,
+		ID:                   metadata.ID,
+		Version:              metadata.Version,
+		InstallPath:          featurePath,
+		Options:              options,
+		Metadata:             &metadata,
+		DependsOn:            metadata.DependsOn,
+		InstallsAfter:        metadata.InstallsAfter,
+		CanonicalID:          canonicalID(originalRef, metadata.ID),
+		SkipOptionValidation: r.skipValidation,
 	}
 
 	return resolved, nil
@@ -440,10 +637,11 @@ func (r *FeatureResolver) ResolveFeaturesWithOverride(features map[string]*Resol
 	used := make(map[string]bool)
 
 	// First, add features in override order
+	index := newFeatureIndex(features)
 	for _, featureID := range overrideOrder {
-		if feature, exists := features[featureID]; exists {
-			result = append(result, feature)
-			used[featureID] = true
+		if key, exists := index.find(featureID); exists && !used[key] {
+			result = append(result, features[key])
+			used[key] = true
 		}
 	}
 
@@ -454,6 +652,7 @@ func (r *FeatureResolver) ResolveFeaturesWithOverride(features map[string]*Resol
 			missing = append(missing, id)
 		}
 	}
+	sort.Strings(missing)
 
 	// Warn if override order doesn't include all features
 	if len(missing) > 0 {
@@ -461,11 +660,9 @@ func (r *FeatureResolver) ResolveFeaturesWithOverride(features map[string]*Resol
 		fmt.Fprintf(os.Stderr, "         These features will be installed after the specified order.\n")
 	}
 
-	// Then add any remaining features (in map iteration order)
-	for id, feature := range features {
-		if !used[id] {
-			result = append(result, feature)
-		}
+	// Then add any remaining features, in lexicographic order by ID
+	for _, id := range missing {
+		result = append(result, features[id])
 	}
 
 	return result, nil
@@ -500,9 +697,15 @@ func (r *FeatureResolver) ResolveFeatures(features map[string]*ResolvedFeature)
 		// Update the feature with dependency info
 		feature.DependsOn = metadata.DependsOn
 		feature.InstallsAfter = metadata.InstallsAfter
+		if feature.Metadata == nil {
+			feature.Metadata = &metadata
+		}
 	}
 
-	// Round-based resolution algorithm
+	// Round-based resolution algorithm. Dependencies are matched by canonical
+	// ID, so a reference with another version or a lockfile digest still
+	// names the same feature.
+	index := newFeatureIndex(features)
 	var result []*ResolvedFeature
 	installed := make(map[string]bool)
 	remaining := make(map[string]*ResolvedFeature)
@@ -511,50 +714,26 @@ func (r *FeatureResolver) ResolveFeatures(features map[string]*ResolvedFeature)
 	}
 
 	for len(remaining) > 0 {
-		var roundInstalls []*ResolvedFeature
-
-		// Try to find features that can be installed in this round
-		for _, feature := range remaining {
-			// Check if all hard dependencies (dependsOn) are satisfied
-			canInstall := true
-			for depID := range feature.DependsOn {
-				if !installed[depID] {
-					canInstall = false
-					break
-				}
-			}
-
-			// Check if all soft dependencies (installsAfter) are satisfied or not in the set
-			if canInstall {
-				for _, afterID := range feature.InstallsAfter {
-					// Only block if the feature exists in our set and isn't installed yet
-					if _, exists := features[afterID]; exists && !installed[afterID] {
-						canInstall = false
-						break
-					}
-				}
-			}
+		var roundInstalls []string
 
-			if canInstall {
-				roundInstalls = append(roundInstalls, feature)
+		// Find the features whose dependencies are all installed
+		for key, feature := range remaining {
+			if len(index.blocking(key, feature, installed)) == 0 {
+				roundInstalls = append(roundInstalls, key)
 			}
 		}
 
-		// If no features can be installed, we have an error
+		// If no features can be installed, a dependency is missing or cyclic
 		if len(roundInstalls) == 0 {
-			// Build list of remaining features for error message
-			var remainingIDs []string
-			for id := range remaining {
-				remainingIDs = append(remainingIDs, id)
-			}
-			return nil, fmt.Errorf("cannot resolve dependencies: features %v have unsatisfied dependencies", remainingIDs)
+			return nil, index.unresolvableError(remaining, installed)
 		}
 
-		// Install this round's features
-		for _, feature := range roundInstalls {
-			result = append(result, feature)
-			installed[feature.ID] = true
-			delete(remaining, feature.ID)
+		// Install this round's features in lexicographic order by ID
+		sort.Strings(roundInstalls)
+		for _, key := range roundInstalls {
+			result = append(result, remaining[key])
+			installed[key] = true
+			delete(remaining, key)
 		}
 	}
 
@@ -572,20 +751,36 @@ func NewFeatureOptionsProcessor() *FeatureOptionsProcessor {
 // ValidateAndProcessOptions validates feature options and converts to environment variables
 func (p *FeatureOptionsProcessor) ValidateAndProcessOptions(userOptions map[string]interface{}, optionSpecs map[string]OptionSpec) (map[string]string, error) {
 	// First validate all user-provided options
-	for optionName, userValue := range userOptions {
+	if err := p.ValidateOptions(userOptions, optionSpecs); err != nil {
+		return nil, err
+	}
+
+	// Then process options (apply defaults, convert to env vars)
+	return p.ProcessOptions(userOptions, optionSpecs), nil
+}
+
+// ValidateOptions checks user-provided options against their specs.
+// Options are checked in name order so the reported error is deterministic.
+func (p *FeatureOptionsProcessor) ValidateOptions(userOptions map[string]interface{}, optionSpecs map[string]OptionSpec) error {
+	names := make([]string, 0, len(userOptions))
+	for optionName := range userOptions {
+		names = append(names, optionName)
+	}
+	sort.Strings(names)
+
+	for _, optionName := range names {
 		spec, exists := optionSpecs[optionName]
 		if !exists {
 			// Option not in spec - skip validation
 			continue
 		}
 
-		if err := p.validateOptionValue(optionName, userValue, spec); err != nil {
-			return nil, err
+		if err := p.validateOptionValue(optionName, userOptions[optionName], spec); err != nil {
+			return err
 		}
 	}
 
-	// Then process options (apply defaults, convert to env vars)
-	return p.ProcessOptions(userOptions, optionSpecs), nil
+	return nil
 }
 
 // validateOptionValue validates a single option value against its spec
@@ -594,25 +789,18 @@ func (p *FeatureOptionsProcessor) validateOptionValue(optionName string, value i
 	switch spec.Type {
 	case "string":
 		if _, ok := value.(string); !ok {
-			return fmt.Errorf("option '%s' must be of type string", optionName)
+			return fmt.Errorf("option '%s' must be of type string (got %T %v)", optionName, value, value)
 		}
-		// Validate enum (proposals)
-		if len(spec.Proposals) > 0 {
+		// Validate enum; proposals are only suggestions, so other values are allowed
+		if len(spec.Enum) > 0 {
 			strValue := value.(string)
-			valid := false
-			for _, proposal := range spec.Proposals {
-				if strValue == proposal {
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				return fmt.Errorf("option '%s' value '%s' must be one of: %v", optionName, strValue, spec.Proposals)
+			if !slices.Contains(spec.Enum, strValue) {
+				return fmt.Errorf("option '%s' value '%s' must be one of: %v", optionName, strValue, spec.Enum)
 			}
 		}
 	case "boolean":
 		if _, ok := value.(bool); !ok {
-			return fmt.Errorf("option '%s' must be of type boolean", optionName)
+			return fmt.Errorf("option '%s' must be of type boolean (got %T %v)", optionName, value, value)
 		}
 	case "number":
 		// Accept int, int64, float64
@@ -620,14 +808,19 @@ func (p *FeatureOptionsProcessor) validateOptionValue(optionName string, value i
 		case int, int64, float64:
 			// Valid number types
 		default:
-			return fmt.Errorf("option '%s' must be of type number", optionName)
+			return fmt.Errorf("option '%s' must be of type number (got %T %v)", optionName, value, value)
 		}
 	}
 
 	return nil
 }
 
-// ProcessOptions converts feature options to environment variables per specification
+// ProcessOptions converts feature options to environment variables per specification.
+// Names are normalized with normalizeOptionName, options the user didn't set take
+// the spec's default (and are left out if it has none), and values are rendered
+// for their declared type by optionEnvValue. Options the user set that the
+// feature doesn't declare are passed through too, as the reference
+// implementation does.
 func (p *FeatureOptionsProcessor) ProcessOptions(userOptions map[string]interface{}, optionSpecs map[string]OptionSpec) map[string]string {
 	result := make(map[string]string)
 
@@ -639,19 +832,70 @@ func (p *FeatureOptionsProcessor) ProcessOptions(userOptions map[string]interfac
 		value := spec.Default
 
 		// Override with user value if provided
-		if userValue, exists := userOptions[optionName]; exists {
+		if userValue, exists := userOptions[optionName]; exists && userValue != nil {
 			value = userValue
 		}
 
 		// Convert to string
 		if value != nil {
-			result[envName] = fmt.Sprintf("%v", value)
+			result[envName] = optionEnvValue(value, spec.Type)
 		}
 	}
 
+	for optionName, value := range userOptions {
+		if _, declared := optionSpecs[optionName]; declared || value == nil {
+			continue
+		}
+		result[normalizeOptionName(optionName)] = optionEnvValue(value, "")
+	}
+
 	return result
 }
 
+// optionEnvValue renders an option value the way install scripts expect it,
+// coercing it to the option's declared type where it converts cleanly:
+// booleans are exactly true or false (so "True" or a "false" default written
+// as a string behave like the boolean), numbers have no exponent notation or
+// trailing ".0", and lists or objects are JSON. Values that don't convert are
+// rendered as given.
+func optionEnvValue(value interface{}, optionType string) string {
+	switch optionType {
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v)
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return strconv.FormatBool(b)
+			}
+		}
+	case "number":
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return strconv.FormatFloat(f, 'f', -1, 64)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case json.Number:
+		return v.String()
+	case []interface{}, map[string]interface{}:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
 // normalizeOptionName converts option name to environment variable per specification
 func normalizeOptionName(name string) string {
 	// Per Microsoft spec: replace non-word chars with underscore, then replace leading digits and underscores with single underscore, uppercase
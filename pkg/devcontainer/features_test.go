@@ -4,13 +4,17 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/obra/packnplay/pkg/registry"
 )
 
 // skipIfNoDocker skips the test if Docker daemon is not available
@@ -173,6 +177,176 @@ func TestResolveDependencies(t *testing.T) {
 	}
 }
 
+func TestCanonicalFeatureID(t *testing.T) {
+	tests := map[string]string{
+		"ghcr.io/devcontainers/features/node:1":             "ghcr.io/devcontainers/features/node",
+		"ghcr.io/devcontainers/features/node:1.6.0":         "ghcr.io/devcontainers/features/node",
+		"ghcr.io/devcontainers/features/node@sha256:abc123": "ghcr.io/devcontainers/features/node",
+		"ghcr.io/devcontainers/features/node":               "ghcr.io/devcontainers/features/node",
+		"ghcr.io/Devcontainers/Features/Node:1":             "ghcr.io/devcontainers/features/node",
+		"mcr.microsoft.com/devcontainers/features/python:1": "mcr.microsoft.com/devcontainers/features/python",
+		"./local-feature":                       "./local-feature",
+		"https://example.com/features/tool.tgz": "https://example.com/features/tool.tgz",
+	}
+	for ref, want := range tests {
+		if got := CanonicalFeatureID(ref); got != want {
+			t.Errorf("CanonicalFeatureID(%q) = %q, want %q", ref, got, want)
+		}
+	}
+
+	// The metadata ID names the feature within the reference's namespace
+	if got := canonicalID("ghcr.io/devcontainers/features/node-alias:1", "node"); got != "ghcr.io/devcontainers/features/node" {
+		t.Errorf("canonicalID() = %q, want the metadata ID in the registry namespace", got)
+	}
+	if got := canonicalID("./tools", "tools"); got != "tools" {
+		t.Errorf("canonicalID() = %q, want a local feature's metadata ID", got)
+	}
+}
+
+// writeTestFeature writes a feature with the given metadata to dir/id
+func writeTestFeature(t *testing.T, dir, id string, metadata map[string]interface{}) string {
+	t.Helper()
+	featureDir := filepath.Join(dir, id)
+	if err := os.MkdirAll(featureDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	metadata["id"], metadata["version"] = id, "1.0.0"
+	data, _ := json.Marshal(metadata)
+	if err := os.WriteFile(filepath.Join(featureDir, "devcontainer-feature.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return featureDir
+}
+
+// TestResolveDependencies_CanonicalIDs tests that dependsOn and installsAfter
+// match features referenced with another version or a digest
+func TestResolveDependencies_CanonicalIDs(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFeature := func(id string, metadata map[string]interface{}) string {
+		return writeTestFeature(t, tmpDir, id, metadata)
+	}
+
+	const namespace = "ghcr.io/devcontainers/features/"
+	features := map[string]*ResolvedFeature{
+		"common-utils": {ID: "common-utils", CanonicalID: namespace + "common-utils", InstallPath: writeFeature("common-utils", map[string]interface{}{})},
+		"node": {ID: "node", CanonicalID: namespace + "node", InstallPath: writeFeature("node", map[string]interface{}{
+			"installsAfter": []string{namespace + "common-utils"},
+		})},
+		"python": {ID: "python", CanonicalID: namespace + "python", InstallPath: writeFeature("python", map[string]interface{}{
+			"dependsOn":     map[string]interface{}{namespace + "common-utils:2": map[string]interface{}{}},
+			"installsAfter": []string{namespace + "node@sha256:abc123"},
+		})},
+	}
+
+	ordered, err := NewFeatureResolver(t.TempDir(), nil).ResolveFeatures(features)
+	if err != nil {
+		t.Fatalf("ResolveFeatures() error = %v", err)
+	}
+	var got []string
+	for _, feature := range ordered {
+		got = append(got, feature.ID)
+	}
+	if strings.Join(got, ",") != "common-utils,node,python" {
+		t.Errorf("install order = %v, want common-utils, node, python", got)
+	}
+
+	ordered, err = NewFeatureResolver(t.TempDir(), nil).ResolveFeaturesWithOverride(features, []string{namespace + "python", namespace + "node:1", "common-utils"})
+	if err != nil {
+		t.Fatalf("ResolveFeaturesWithOverride() error = %v", err)
+	}
+	got = nil
+	for _, feature := range ordered {
+		got = append(got, feature.ID)
+	}
+	if strings.Join(got, ",") != "python,node,common-utils" {
+		t.Errorf("override order = %v, want the references matched to python, node, common-utils", got)
+	}
+}
+
+func TestResolveDependencies_Unresolvable(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]map[string]interface{}
+		want     string
+	}{
+		{
+			name: "dependsOn cycle",
+			metadata: map[string]map[string]interface{}{
+				"a": {"dependsOn": map[string]interface{}{"b": map[string]interface{}{}}},
+				"b": {"dependsOn": map[string]interface{}{"a": map[string]interface{}{}}},
+			},
+			want: "feature dependency cycle: a dependsOn b, b dependsOn a",
+		},
+		{
+			name: "installsAfter cycle",
+			metadata: map[string]map[string]interface{}{
+				"a": {"installsAfter": []string{"c"}},
+				"b": {"installsAfter": []string{"a"}},
+				"c": {"installsAfter": []string{"b"}},
+			},
+			want: "feature dependency cycle: a installsAfter c, c installsAfter b, b installsAfter a",
+		},
+		{
+			name: "cycle behind another feature",
+			metadata: map[string]map[string]interface{}{
+				"a": {"dependsOn": map[string]interface{}{"b": map[string]interface{}{}}},
+				"b": {"installsAfter": []string{"c"}},
+				"c": {"dependsOn": map[string]interface{}{"b": map[string]interface{}{}}},
+			},
+			want: "feature dependency cycle: b installsAfter c, c dependsOn b",
+		},
+		{
+			name: "missing dependsOn",
+			metadata: map[string]map[string]interface{}{
+				"a": {"dependsOn": map[string]interface{}{"b": map[string]interface{}{}}},
+				"b": {"dependsOn": map[string]interface{}{"ghcr.io/devcontainers/features/missing:1": map[string]interface{}{}}},
+			},
+			want: "feature b depends on ghcr.io/devcontainers/features/missing:1, which is not in the configured features",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			features := make(map[string]*ResolvedFeature)
+			for id, metadata := range tt.metadata {
+				features[id] = &ResolvedFeature{ID: id, InstallPath: writeTestFeature(t, tmpDir, id, metadata)}
+			}
+
+			_, err := NewFeatureResolver(t.TempDir(), nil).ResolveFeatures(features)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ResolveFeatures() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDependencies_OrderWithinRound(t *testing.T) {
+	tmpDir := t.TempDir()
+	features := make(map[string]*ResolvedFeature)
+	for _, id := range []string{"zsh", "git", "node", "docker", "python"} {
+		metadata := map[string]interface{}{}
+		if id == "python" {
+			metadata["installsAfter"] = []string{"zsh"}
+		}
+		features[id] = &ResolvedFeature{ID: id, InstallPath: writeTestFeature(t, tmpDir, id, metadata)}
+	}
+
+	// Map iteration order varies, so resolve a few times
+	for i := 0; i < 10; i++ {
+		ordered, err := NewFeatureResolver(t.TempDir(), nil).ResolveFeatures(features)
+		if err != nil {
+			t.Fatalf("ResolveFeatures() error = %v", err)
+		}
+		var got []string
+		for _, feature := range ordered {
+			got = append(got, feature.ID)
+		}
+		if strings.Join(got, ",") != "docker,git,node,zsh,python" {
+			t.Fatalf("install order = %v, want each round in lexicographic order", got)
+		}
+	}
+}
+
 func TestResolveOCIFeature(t *testing.T) {
 	skipIfNoDocker(t)
 
@@ -245,6 +419,32 @@ func TestResolveOCIFeature(t *testing.T) {
 	}
 }
 
+func TestResolveFeatureOffline(t *testing.T) {
+	cacheDir := t.TempDir()
+	resolver := NewFeatureResolver(cacheDir, nil)
+	resolver.SetMirrors(registry.Mirrors{Offline: true})
+
+	for _, ref := range []string{"ghcr.io/devcontainers/features/node:1", "https://example.com/feature.tgz"} {
+		if _, err := resolver.ResolveFeature(ref, nil); !errors.Is(err, registry.ErrOffline) {
+			t.Errorf("ResolveFeature(%s) error = %v, want ErrOffline", ref, err)
+		}
+	}
+
+	// Features already in the cache are used
+	cached := filepath.Join(cacheDir, "oci-cache", "node-1")
+	if err := os.MkdirAll(cached, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"install.sh": "#!/bin/sh\n", "devcontainer-feature.json": `{"id": "node", "version": "1.0.0"}`} {
+		if err := os.WriteFile(filepath.Join(cached, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := resolver.ResolveFeature("ghcr.io/devcontainers/features/node:1", nil); err != nil {
+		t.Errorf("ResolveFeature() of a cached feature error = %v", err)
+	}
+}
+
 func TestProcessFeatureOptions(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -497,11 +697,21 @@ func TestValidateFeatureOptions(t *testing.T) {
 				"installType": "invalid",
 			},
 			optionSpecs: map[string]OptionSpec{
-				"installType": {Type: "string", Proposals: []string{"apt", "nvm", "source"}},
+				"installType": {Type: "string", Enum: []string{"apt", "nvm", "source"}},
 			},
 			expectError: true,
 			errorMsg:    "option 'installType' value 'invalid' must be one of: [apt nvm source]",
 		},
+		{
+			name: "value outside proposals",
+			options: map[string]interface{}{
+				"installType": "custom",
+			},
+			optionSpecs: map[string]OptionSpec{
+				"installType": {Type: "string", Proposals: []string{"apt", "nvm", "source"}},
+			},
+			expectError: false,
+		},
 		{
 			name: "valid number option - int",
 			options: map[string]interface{}{
@@ -555,6 +765,51 @@ func TestValidateFeatureOptions(t *testing.T) {
 	}
 }
 
+func TestResolveFeature_ValidatesOptions(t *testing.T) {
+	tmpDir := t.TempDir()
+	featurePath := filepath.Join(tmpDir, "node")
+	if err := os.MkdirAll(featurePath, 0755); err != nil {
+		t.Fatalf("Failed to create feature directory: %v", err)
+	}
+	metadata := `{
+		"id": "node",
+		"version": "1.0.0",
+		"options": {
+			"version": {"type": "string", "enum": ["lts", "latest", "20"], "default": "lts"}
+		}
+	}`
+	if err := os.WriteFile(filepath.Join(featurePath, "devcontainer-feature.json"), []byte(metadata), 0644); err != nil {
+		t.Fatalf("Failed to write metadata file: %v", err)
+	}
+
+	resolver := NewFeatureResolver(tmpDir, nil)
+
+	_, err := resolver.ResolveFeature(featurePath, map[string]interface{}{"version": "banana"})
+	if err == nil {
+		t.Fatal("Expected validation error for invalid option value")
+	}
+	for _, want := range []string{featurePath, "'version'", "'banana'", "lts latest 20"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got: %v", want, err)
+		}
+	}
+
+	// Valid values resolve normally
+	if _, err := resolver.ResolveFeature(featurePath, map[string]interface{}{"version": "20"}); err != nil {
+		t.Errorf("Expected valid option to resolve, got: %v", err)
+	}
+
+	// Escape hatch skips validation and marks the feature for the Dockerfile generator
+	resolver.SetSkipOptionValidation(true)
+	feature, err := resolver.ResolveFeature(featurePath, map[string]interface{}{"version": "banana"})
+	if err != nil {
+		t.Fatalf("Expected skipped validation to resolve, got: %v", err)
+	}
+	if !feature.SkipOptionValidation {
+		t.Error("Expected resolved feature to carry SkipOptionValidation")
+	}
+}
+
 func TestResolveHTTPSFeature(t *testing.T) {
 	// Create a test feature tarball in memory
 	tmpFeatureDir := t.TempDir()
@@ -932,3 +1187,78 @@ func TestOverrideFeatureInstallOrder(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessOptionsValueRendering(t *testing.T) {
+	processor := NewFeatureOptionsProcessor()
+	envs := processor.ProcessOptions(
+		map[string]interface{}{"port": float64(1000000), "ratio": 0.5, "enabled": false, "undeclared": "x"},
+		map[string]OptionSpec{
+			"port":    {Type: "number"},
+			"ratio":   {Type: "number"},
+			"enabled": {Type: "boolean", Default: true},
+		},
+	)
+
+	want := map[string]string{"PORT": "1000000", "RATIO": "0.5", "ENABLED": "false", "UNDECLARED": "x"}
+	for key, value := range want {
+		if envs[key] != value {
+			t.Errorf("%s = %q, want %q", key, envs[key], value)
+		}
+	}
+}
+
+func TestOptionEnvValueConversion(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      interface{}
+		optionType string
+		want       string
+	}{
+		{"boolean true", true, "boolean", "true"},
+		{"boolean false", false, "boolean", "false"},
+		{"boolean from string", "false", "boolean", "false"},
+		{"boolean from capitalized string", "True", "boolean", "true"},
+		{"boolean from padded string", " true ", "boolean", "true"},
+		{"boolean from unparseable string", "yes", "boolean", "yes"},
+		{"number from float", float64(8080), "number", "8080"},
+		{"number from large float", float64(1e21), "number", "1000000000000000000000"},
+		{"number from fraction", 0.25, "number", "0.25"},
+		{"number from int", 3000, "number", "3000"},
+		{"number from string", "8080.0", "number", "8080"},
+		{"number from json.Number", json.Number("42"), "number", "42"},
+		{"number from unparseable string", "lots", "number", "lots"},
+		{"string", "1.2.3", "string", "1.2.3"},
+		{"string from bool", true, "string", "true"},
+		{"string from number", float64(18), "string", "18"},
+		{"undeclared bool", false, "", "false"},
+		{"undeclared number", float64(1.5), "", "1.5"},
+		{"list", []interface{}{"a", float64(1)}, "", `["a",1]`},
+		{"object", map[string]interface{}{"k": true}, "string", `{"k":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := optionEnvValue(tt.value, tt.optionType); got != tt.want {
+				t.Errorf("optionEnvValue(%#v, %q) = %q, want %q", tt.value, tt.optionType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessOptionsDefaults(t *testing.T) {
+	processor := NewFeatureOptionsProcessor()
+	envs := processor.ProcessOptions(
+		map[string]interface{}{"installZsh": nil, "version": "20"},
+		map[string]OptionSpec{
+			"installZsh":          {Type: "boolean", Default: "true"}, // some features quote boolean defaults
+			"upgradePackages":     {Type: "boolean", Default: false},
+			"version":             {Type: "string", Default: "lts"},
+			"nodeGypDependencies": {Type: "boolean"},
+			"port":                {Type: "number", Default: float64(3000)},
+		},
+	)
+
+	want := map[string]string{"INSTALLZSH": "true", "UPGRADEPACKAGES": "false", "VERSION": "20", "PORT": "3000"}
+	if !reflect.DeepEqual(envs, want) {
+		t.Errorf("ProcessOptions() = %v, want %v (options without a default and unset are left out)", envs, want)
+	}
+}
@@ -3,6 +3,7 @@ package devcontainer
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // LifecycleCommand represents a lifecycle command that can be a string, array, or object.
@@ -44,6 +45,14 @@ func (lc *LifecycleCommand) UnmarshalJSON(data []byte) error {
 	return fmt.Errorf("lifecycle command must be string, array, or object")
 }
 
+// MarshalJSON writes the command back in its original string, array, or object form
+func (lc *LifecycleCommand) MarshalJSON() ([]byte, error) {
+	if merged, ok := lc.raw.(*MergedCommands); ok {
+		return json.Marshal(strings.Join(merged.commands, " && "))
+	}
+	return json.Marshal(lc.raw)
+}
+
 // AsString returns the command as a string if it is one
 func (lc *LifecycleCommand) AsString() (string, bool) {
 	if s, ok := lc.raw.(string); ok {
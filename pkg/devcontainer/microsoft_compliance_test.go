@@ -175,6 +175,21 @@ func TestMicrosoftComplianceOptionValidationTypes(t *testing.T) {
 			options: map[string]interface{}{
 				"shell": "fish",
 			},
+			specs: map[string]OptionSpec{
+				"shell": {
+					Type:    "string",
+					Default: "bash",
+					Enum:    []string{"bash", "zsh"},
+				},
+			},
+			shouldError: true,
+			description: "Values not in enum should be invalid",
+		},
+		{
+			name: "value outside proposals",
+			options: map[string]interface{}{
+				"shell": "fish",
+			},
 			specs: map[string]OptionSpec{
 				"shell": {
 					Type:      "string",
@@ -182,8 +197,8 @@ func TestMicrosoftComplianceOptionValidationTypes(t *testing.T) {
 					Proposals: []string{"bash", "zsh"},
 				},
 			},
-			shouldError: true,
-			description: "Values not in enum proposals should be invalid",
+			shouldError: false,
+			description: "Proposals are suggestions, so other values should be valid",
 		},
 		{
 			name: "valid number option - int",
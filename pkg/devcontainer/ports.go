@@ -1,10 +1,67 @@
 package devcontainer
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServicePort is a forwardPorts entry for a port of another service, such as
+// "db:5432" for port 5432 of the db sidecar or compose service
+type ServicePort struct {
+	Service string
+	Port    int
+}
+
+// PublishArg returns the -p value publishing the port on the host's loopback,
+// as numeric forwardPorts entries are
+func (p ServicePort) PublishArg() string {
+	return fmt.Sprintf("127.0.0.1:%d:%d", p.Port, p.Port)
+}
+
+// parseServicePort parses a "service:port" forwardPorts entry, reporting
+// whether spec is one: "8080:80" and "127.0.0.1:9000" are host bindings
+func parseServicePort(spec string) (ServicePort, bool, error) {
+	host, portStr, ok := strings.Cut(spec, ":")
+	if !ok || strings.Contains(portStr, ":") || host == "" {
+		return ServicePort{}, false, nil
+	}
+	if _, err := strconv.Atoi(host); err == nil || net.ParseIP(host) != nil {
+		return ServicePort{}, false, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return ServicePort{}, true, fmt.Errorf("invalid forwardPorts entry %q: port must be 1-65535", spec)
+	}
+	return ServicePort{Service: host, Port: port}, true, nil
+}
+
+// ServiceForwardPorts returns the forwardPorts entries naming another
+// service's port, which ParseForwardPorts leaves out
+func ServiceForwardPorts(ports []interface{}) ([]ServicePort, error) {
+	var result []ServicePort
+	for _, port := range ports {
+		spec, ok := port.(string)
+		if !ok {
+			continue
+		}
+		servicePort, isService, err := parseServicePort(spec)
+		if err != nil {
+			return nil, err
+		}
+		if isService {
+			result = append(result, servicePort)
+		}
+	}
+	return result, nil
+}
 
 // ParseForwardPorts converts forwardPorts array to Docker -p format
-// Input: [3000, "8080:8080", "127.0.0.1:9000:9000"]
-// Output: ["3000:3000", "8080:8080", "127.0.0.1:9000:9000"]
+// Input: [3000, "8080:8080", "127.0.0.1:9000:9000", "8000-8010"]
+// Output: ["127.0.0.1:3000:3000", "8080:8080", "127.0.0.1:9000:9000", "127.0.0.1:8000-8010:8000-8010"]
+// Entries for other services' ports ("db:5432") are left to ServiceForwardPorts.
 func ParseForwardPorts(ports []interface{}) ([]string, error) {
 	if ports == nil {
 		return []string{}, nil
@@ -27,6 +84,19 @@ func ParseForwardPorts(ports []interface{}) ([]string, error) {
 			result = append(result, portStr)
 
 		case string:
+			if _, isService, err := parseServicePort(v); err != nil {
+				return nil, err
+			} else if isService {
+				continue
+			}
+			// Port range: "8000-8010" → "127.0.0.1:8000-8010:8000-8010"
+			if !strings.Contains(v, ":") && strings.Contains(v, "-") {
+				if _, _, err := parsePortRange(v); err != nil {
+					return nil, err
+				}
+				result = append(result, fmt.Sprintf("127.0.0.1:%s:%s", v, v))
+				continue
+			}
 			// Already formatted: "8080:8080" or "127.0.0.1:8080:8080"
 			result = append(result, v)
 
@@ -37,3 +107,154 @@ func ParseForwardPorts(ports []interface{}) ([]string, error) {
 
 	return result, nil
 }
+
+// parsePortRange parses "start-end" into its bounds
+func parsePortRange(spec string) (int, int, error) {
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port range: %s", spec)
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", spec)
+	}
+	end, err := strconv.Atoi(strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", spec)
+	}
+	if start < 1 || end > 65535 || start > end {
+		return 0, 0, fmt.Errorf("invalid port range: %s (must be ascending within 1-65535)", spec)
+	}
+	return start, end, nil
+}
+
+// portRange is an inclusive range of ports; a single port is a range of one
+type portRange struct{ start, end int }
+
+// key returns the range as a portsAttributes key: "3000" or "8000-8010"
+func (r portRange) key() string {
+	if r.start == r.end {
+		return strconv.Itoa(r.start)
+	}
+	return fmt.Sprintf("%d-%d", r.start, r.end)
+}
+
+// parsePortKey parses a port ("3000") or port range ("8000-8010") key
+func parsePortKey(key string) (portRange, bool) {
+	if port, err := strconv.Atoi(key); err == nil {
+		return portRange{port, port}, true
+	}
+	if start, end, err := parsePortRange(key); err == nil {
+		return portRange{start, end}, true
+	}
+	return portRange{}, false
+}
+
+// forwardedPortRanges returns the container-side port (or range) of each
+// forwardPorts entry, leaving out other services' ports
+func forwardedPortRanges(ports []interface{}) []portRange {
+	var ranges []portRange
+	for _, port := range ports {
+		switch v := port.(type) {
+		case float64:
+			ranges = append(ranges, portRange{int(v), int(v)})
+		case string:
+			if _, isService, _ := parseServicePort(v); isService {
+				continue // a port of another container
+			}
+			parts := strings.Split(v, ":")
+			if r, ok := parsePortKey(strings.SplitN(parts[len(parts)-1], "/", 2)[0]); ok {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	return ranges
+}
+
+// uncoveredPortRanges returns the parts of r that no portsAttributes key
+// covers, matching each port against port and range keys alike
+func (c *Config) uncoveredPortRanges(r portRange) []portRange {
+	var explicit []portRange
+	for key := range c.PortsAttributes {
+		if k, ok := parsePortKey(key); ok {
+			explicit = append(explicit, k)
+		}
+	}
+	covered := func(port int) bool {
+		for _, k := range explicit {
+			if port >= k.start && port <= k.end {
+				return true
+			}
+		}
+		return false
+	}
+
+	var uncovered []portRange
+	for port := r.start; port <= r.end; port++ {
+		if covered(port) {
+			continue
+		}
+		if n := len(uncovered); n > 0 && uncovered[n-1].end == port-1 {
+			uncovered[n-1].end = port
+		} else {
+			uncovered = append(uncovered, portRange{port, port})
+		}
+	}
+	return uncovered
+}
+
+// PortAttributeLabels returns container labels describing port attributes.
+// Explicit portsAttributes entries are always labeled; forwarded ports no port
+// or range entry covers get otherPortsAttributes.
+func (c *Config) PortAttributeLabels() map[string]string {
+	labels := make(map[string]string)
+
+	for port, attrs := range c.PortsAttributes {
+		addPortAttributeLabels(labels, port, attrs)
+	}
+
+	if c.OtherPortsAttributes != (PortAttributes{}) {
+		for _, forwarded := range forwardedPortRanges(c.ForwardPorts) {
+			for _, r := range c.uncoveredPortRanges(forwarded) {
+				addPortAttributeLabels(labels, r.key(), c.OtherPortsAttributes)
+			}
+		}
+	}
+
+	return labels
+}
+
+// PortAttributeLabelArgs returns PortAttributeLabels as sorted --label arguments
+func (c *Config) PortAttributeLabelArgs() []string {
+	labels := c.PortAttributeLabels()
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return args
+}
+
+func addPortAttributeLabels(labels map[string]string, port string, attrs PortAttributes) {
+	prefix := fmt.Sprintf("devcontainer.port.%s.", port)
+	if attrs.Label != "" {
+		labels[prefix+"label"] = attrs.Label
+	}
+	if attrs.Protocol != "" {
+		labels[prefix+"protocol"] = attrs.Protocol
+	}
+	if attrs.OnAutoForward != "" {
+		labels[prefix+"onAutoForward"] = attrs.OnAutoForward
+	}
+	if attrs.RequireLocalPort != nil {
+		labels[prefix+"requireLocalPort"] = strconv.FormatBool(*attrs.RequireLocalPort)
+	}
+	if attrs.ElevateIfNeeded != nil {
+		labels[prefix+"elevateIfNeeded"] = strconv.FormatBool(*attrs.ElevateIfNeeded)
+	}
+}
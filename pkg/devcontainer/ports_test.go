@@ -2,6 +2,9 @@ package devcontainer
 
 import (
 	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -263,3 +266,126 @@ func TestOtherPortsAttributes_JSONMarshaling(t *testing.T) {
 		t.Errorf("Expected port 8080 to have onAutoForward 'ignore', got '%s'", attrs8080.OnAutoForward)
 	}
 }
+
+func TestParseForwardPorts_Range(t *testing.T) {
+	result, err := ParseForwardPorts([]interface{}{"8000-8010"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result[0] != "127.0.0.1:8000-8010:8000-8010" {
+		t.Errorf("Expected '127.0.0.1:8000-8010:8000-8010', got '%s'", result[0])
+	}
+}
+
+func TestParseForwardPorts_InvalidRange(t *testing.T) {
+	for _, spec := range []string{"8010-8000", "0-10", "9000-70000", "abc-def"} {
+		if _, err := ParseForwardPorts([]interface{}{spec}); err == nil {
+			t.Errorf("Expected error for range %q", spec)
+		}
+	}
+}
+
+func TestGetPortAttributes_RangeKey(t *testing.T) {
+	config := &Config{
+		PortsAttributes: map[string]PortAttributes{
+			"8000-8010": {Label: "Workers"},
+		},
+		OtherPortsAttributes: PortAttributes{Label: "Other"},
+	}
+
+	if got := config.GetPortAttributes("8005").Label; got != "Workers" {
+		t.Errorf("Expected range attributes for 8005, got %q", got)
+	}
+	if got := config.GetPortAttributes("8011").Label; got != "Other" {
+		t.Errorf("Expected otherPortsAttributes for 8011, got %q", got)
+	}
+}
+
+func TestPortAttributeLabels_OtherPortsAttributes(t *testing.T) {
+	config := &Config{
+		ForwardPorts: []interface{}{float64(3000), "9000:9001", "8000-8010"},
+		PortsAttributes: map[string]PortAttributes{
+			"3000": {Label: "Web"},
+		},
+		OtherPortsAttributes: PortAttributes{OnAutoForward: "silent"},
+	}
+
+	labels := config.PortAttributeLabels()
+
+	expected := map[string]string{
+		"devcontainer.port.3000.label":              "Web",
+		"devcontainer.port.9001.onAutoForward":      "silent",
+		"devcontainer.port.8000-8010.onAutoForward": "silent",
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, labels[k], v)
+		}
+	}
+	if _, ok := labels["devcontainer.port.3000.onAutoForward"]; ok {
+		t.Error("otherPortsAttributes should not apply to explicitly configured port 3000")
+	}
+}
+
+func TestPortAttributeLabels_MatchesRangesPerPort(t *testing.T) {
+	config := &Config{
+		ForwardPorts: []interface{}{"8000-8010", float64(9005), "db:5432"},
+		PortsAttributes: map[string]PortAttributes{
+			"8000-8004": {Label: "Workers"},
+			"8008":      {Label: "Admin"},
+			"9000-9100": {Label: "Debug"},
+		},
+		OtherPortsAttributes: PortAttributes{OnAutoForward: "silent"},
+	}
+
+	labels := config.PortAttributeLabels()
+
+	// Only the forwarded ports no entry covers get otherPortsAttributes
+	var other []string
+	for k := range labels {
+		if strings.HasSuffix(k, ".onAutoForward") {
+			other = append(other, k)
+		}
+	}
+	sort.Strings(other)
+	want := []string{"devcontainer.port.8005-8007.onAutoForward", "devcontainer.port.8009-8010.onAutoForward"}
+	if !reflect.DeepEqual(other, want) {
+		t.Errorf("otherPortsAttributes labels = %v, want %v", other, want)
+	}
+	// Another service's port is not the main container's
+	if _, ok := labels["devcontainer.port.5432.onAutoForward"]; ok {
+		t.Error("service:port entries should not label the main container")
+	}
+}
+
+func TestServiceForwardPorts(t *testing.T) {
+	ports := []interface{}{float64(3000), "8080:80", "127.0.0.1:9000:9000", "db:5432", "cache:6379"}
+
+	services, err := ServiceForwardPorts(ports)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(services) != 2 || services[0] != (ServicePort{Service: "db", Port: 5432}) || services[1] != (ServicePort{Service: "cache", Port: 6379}) {
+		t.Errorf("ServiceForwardPorts() = %+v", services)
+	}
+	if services[0].PublishArg() != "127.0.0.1:5432:5432" {
+		t.Errorf("PublishArg() = %q", services[0].PublishArg())
+	}
+
+	// The main container's bindings leave the service entries out
+	result, err := ParseForwardPorts(ports)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 3 {
+		t.Errorf("ParseForwardPorts() = %v, want the service entries left out", result)
+	}
+
+	if _, err := ServiceForwardPorts([]interface{}{"db:70000"}); err == nil {
+		t.Error("Expected error for an out of range service port")
+	}
+	if _, err := ParseForwardPorts([]interface{}{"db:postgres"}); err == nil {
+		t.Error("Expected error for a service entry without a port number")
+	}
+}
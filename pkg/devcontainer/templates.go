@@ -0,0 +1,243 @@
+package devcontainer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TemplateMetadata represents devcontainer-template.json
+type TemplateMetadata struct {
+	ID            string                `json:"id"`
+	Version       string                `json:"version"`
+	Name          string                `json:"name"`
+	Description   string                `json:"description,omitempty"`
+	Options       map[string]OptionSpec `json:"options,omitempty"`
+	OptionalPaths []string              `json:"optionalPaths,omitempty"`
+}
+
+// templateOptionPattern matches ${templateOption:name} placeholders
+var templateOptionPattern = regexp.MustCompile(`\$\{templateOption:([^}]+)\}`)
+
+// templateDocFiles are template documentation files that are never copied into a project
+var templateDocFiles = map[string]bool{
+	"devcontainer-template.json": true,
+	"README.md":                  true,
+	"NOTES.md":                   true,
+}
+
+// LoadTemplateMetadata reads devcontainer-template.json from a template directory
+func LoadTemplateMetadata(templateDir string) (*TemplateMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(templateDir, "devcontainer-template.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read devcontainer-template.json: %w", err)
+	}
+
+	var metadata TemplateMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse devcontainer-template.json: %w", err)
+	}
+	return &metadata, nil
+}
+
+// FetchTemplate returns a local directory containing the template. Local paths
+// are used as-is; OCI references are pulled with oras into destDir.
+func FetchTemplate(ref, destDir string) (string, error) {
+	if info, err := os.Stat(ref); err == nil && info.IsDir() {
+		return ref, nil
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create template directory: %w", err)
+	}
+
+	output, err := orasPull(ref, destDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to pull OCI template %s (is 'oras' installed?): %w\nOutput: %s", ref, err, string(output))
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	var tarballPath string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tar") {
+			tarballPath = filepath.Join(destDir, name)
+			break
+		}
+	}
+	if tarballPath == "" {
+		return "", fmt.Errorf("no tarball found after pulling template %s", ref)
+	}
+
+	if output, err := exec.Command("tar", "-xf", tarballPath, "-C", destDir).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract template: %w\nOutput: %s", err, string(output))
+	}
+	_ = os.Remove(tarballPath)
+
+	return destDir, nil
+}
+
+// ResolveOptions merges user-provided option values with template defaults.
+// Unknown options and values outside an enum are rejected; proposals are only suggestions.
+func (m *TemplateMetadata) ResolveOptions(userOptions map[string]string) (map[string]string, error) {
+	names := make([]string, 0, len(userOptions))
+	for name := range userOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec, ok := m.Options[name]
+		if !ok {
+			return nil, fmt.Errorf("template %s has no option '%s'", m.ID, name)
+		}
+		value := userOptions[name]
+		if spec.Type == "boolean" && value != "true" && value != "false" {
+			return nil, fmt.Errorf("option '%s' must be true or false (got %q)", name, value)
+		}
+		if len(spec.Enum) > 0 {
+			valid := false
+			for _, candidate := range spec.Enum {
+				if value == candidate {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Errorf("option '%s' value '%s' must be one of: %v", name, value, spec.Enum)
+			}
+		}
+	}
+
+	resolved := make(map[string]string)
+	for name, spec := range m.Options {
+		if spec.Default != nil {
+			resolved[name] = fmt.Sprintf("%v", spec.Default)
+		}
+	}
+	for name, value := range userOptions {
+		resolved[name] = value
+	}
+	return resolved, nil
+}
+
+// ApplyTemplateOptions controls how template files are materialized
+type ApplyTemplateOptions struct {
+	Options   map[string]string // resolved option values for ${templateOption:...}
+	OmitPaths []string          // optionalPaths entries to leave out
+	Force     bool              // overwrite existing files
+}
+
+// ApplyTemplate copies template files into projectDir with option substitution.
+// It refuses to overwrite existing files unless Force is set, checking all
+// files before writing any. Returns the project-relative paths written.
+func ApplyTemplate(templateDir, projectDir string, opts ApplyTemplateOptions) ([]string, error) {
+	type templateFile struct {
+		rel     string
+		mode    fs.FileMode
+		content []byte
+	}
+
+	var files []templateFile
+	err := filepath.WalkDir(templateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(templateDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if omitted(rel, opts.OmitPaths) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || templateDocFiles[rel] {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("template contains symlink %s", rel)
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read template file %s: %w", rel, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, templateFile{rel, info.Mode().Perm(), substituteTemplateOptions(content, opts.Options)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.Force {
+		var conflicts []string
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(projectDir, filepath.FromSlash(f.rel))); err == nil {
+				conflicts = append(conflicts, f.rel)
+			}
+		}
+		if len(conflicts) > 0 {
+			return nil, fmt.Errorf("template would overwrite existing files (use --force): %s", strings.Join(conflicts, ", "))
+		}
+	}
+
+	var written []string
+	for _, f := range files {
+		dst := filepath.Join(projectDir, filepath.FromSlash(f.rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return written, fmt.Errorf("failed to create directory for %s: %w", f.rel, err)
+		}
+		if err := os.WriteFile(dst, f.content, f.mode); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", f.rel, err)
+		}
+		written = append(written, f.rel)
+	}
+	return written, nil
+}
+
+// omitted reports whether rel matches an omitted optionalPaths entry ("dir/*" omits a directory)
+func omitted(rel string, omitPaths []string) bool {
+	for _, p := range omitPaths {
+		p = strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(p), "*"), "/")
+		if rel == p || strings.HasPrefix(rel, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// substituteTemplateOptions replaces ${templateOption:name} in text content.
+// Binary files (containing NUL bytes) and unknown options are left untouched.
+func substituteTemplateOptions(content []byte, options map[string]string) []byte {
+	if bytes.IndexByte(content, 0) >= 0 {
+		return content
+	}
+	return templateOptionPattern.ReplaceAllFunc(content, func(match []byte) []byte {
+		name := strings.TrimSpace(string(templateOptionPattern.FindSubmatch(match)[1]))
+		if value, ok := options[name]; ok {
+			return []byte(value)
+		}
+		return match
+	})
+}
@@ -0,0 +1,140 @@
+package devcontainer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTemplate creates a template directory from a map of relative paths to contents
+func writeTemplate(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const goTemplateMetadata = `{
+  "id": "go",
+  "version": "4.0.0",
+  "name": "Go",
+  "options": {
+    "imageVariant": {"type": "string", "proposals": ["1.23-bookworm", "1.22-bookworm"], "default": "1.23-bookworm"},
+    "installLinter": {"type": "boolean", "default": true},
+    "shell": {"type": "string", "enum": ["bash", "zsh"], "default": "bash"}
+  },
+  "optionalPaths": [".github/*"]
+}`
+
+func TestTemplateMetadata_ResolveOptions(t *testing.T) {
+	dir := writeTemplate(t, map[string]string{"devcontainer-template.json": goTemplateMetadata})
+	metadata, err := LoadTemplateMetadata(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplateMetadata() error = %v", err)
+	}
+
+	resolved, err := metadata.ResolveOptions(map[string]string{"imageVariant": "1.21-bullseye"})
+	if err != nil {
+		t.Fatalf("ResolveOptions() error = %v", err)
+	}
+	// Proposals are suggestions, custom values are allowed
+	if resolved["imageVariant"] != "1.21-bullseye" || resolved["installLinter"] != "true" || resolved["shell"] != "bash" {
+		t.Errorf("ResolveOptions() = %v", resolved)
+	}
+
+	invalid := []map[string]string{
+		{"unknown": "x"},
+		{"installLinter": "yes"},
+		{"shell": "fish"},
+	}
+	for _, options := range invalid {
+		if _, err := metadata.ResolveOptions(options); err == nil {
+			t.Errorf("ResolveOptions(%v) expected error", options)
+		}
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	templateDir := writeTemplate(t, map[string]string{
+		"devcontainer-template.json":      goTemplateMetadata,
+		"README.md":                       "# Go template",
+		"NOTES.md":                        "notes",
+		".devcontainer/devcontainer.json": `{"image": "mcr.microsoft.com/devcontainers/go:${templateOption:imageVariant}", "keep": "${templateOption:missing}"}`,
+		".github/dependabot.yml":          "version: 2",
+	})
+	projectDir := t.TempDir()
+
+	written, err := ApplyTemplate(templateDir, projectDir, ApplyTemplateOptions{
+		Options:   map[string]string{"imageVariant": "1.23-bookworm"},
+		OmitPaths: []string{".github/*"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyTemplate() error = %v", err)
+	}
+
+	sort.Strings(written)
+	if strings.Join(written, ",") != ".devcontainer/devcontainer.json" {
+		t.Errorf("written = %v", written)
+	}
+
+	content, err := os.ReadFile(filepath.Join(projectDir, ".devcontainer", "devcontainer.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "devcontainers/go:1.23-bookworm") {
+		t.Errorf("option not substituted: %s", content)
+	}
+	if !strings.Contains(string(content), "${templateOption:missing}") {
+		t.Errorf("unknown option placeholder should be kept: %s", content)
+	}
+	for _, doc := range []string{"README.md", "NOTES.md", "devcontainer-template.json"} {
+		if _, err := os.Stat(filepath.Join(projectDir, doc)); err == nil {
+			t.Errorf("%s should not be copied into the project", doc)
+		}
+	}
+}
+
+func TestApplyTemplate_RefusesOverwrite(t *testing.T) {
+	templateDir := writeTemplate(t, map[string]string{
+		".devcontainer/devcontainer.json": `{"image": "new"}`,
+		".devcontainer/Dockerfile":        "FROM new",
+	})
+	projectDir := writeTemplate(t, map[string]string{
+		".devcontainer/devcontainer.json": `{"image": "mine"}`,
+	})
+
+	_, err := ApplyTemplate(templateDir, projectDir, ApplyTemplateOptions{})
+	if err == nil || !strings.Contains(err.Error(), ".devcontainer/devcontainer.json") {
+		t.Fatalf("ApplyTemplate() error = %v, want overwrite conflict", err)
+	}
+	// Nothing is written when there's a conflict
+	if _, err := os.Stat(filepath.Join(projectDir, ".devcontainer", "Dockerfile")); err == nil {
+		t.Error("ApplyTemplate() wrote files despite conflict")
+	}
+
+	if _, err := ApplyTemplate(templateDir, projectDir, ApplyTemplateOptions{Force: true}); err != nil {
+		t.Fatalf("ApplyTemplate() with Force error = %v", err)
+	}
+	content, _ := os.ReadFile(filepath.Join(projectDir, ".devcontainer", "devcontainer.json"))
+	if string(content) != `{"image": "new"}` {
+		t.Errorf("Force did not overwrite: %s", content)
+	}
+}
+
+func TestFetchTemplate_LocalDirectory(t *testing.T) {
+	dir := writeTemplate(t, map[string]string{"devcontainer-template.json": goTemplateMetadata})
+	got, err := FetchTemplate(dir, filepath.Join(t.TempDir(), "unused"))
+	if err != nil || got != dir {
+		t.Errorf("FetchTemplate(local) = %q, %v; want %q", got, err, dir)
+	}
+}
@@ -17,6 +17,10 @@ type SubstituteContext struct {
 	// Built from containerEnv and remoteEnv in devcontainer.json
 	ContainerEnv map[string]string
 
+	// DevContainerID is the value of ${devcontainerId}, see DevContainerID.
+	// When empty it is derived from Labels.
+	DevContainerID string
+
 	// Labels are Docker labels used to generate devcontainerId
 	Labels map[string]string
 }
@@ -5,11 +5,12 @@
 package devcontainer
 
 import (
+	"bytes"
 	"crypto/sha256"
-	"encoding/base32"
+	"encoding/json"
+	"math/big"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 )
 
@@ -96,6 +97,9 @@ func substituteString(ctx *SubstituteContext, s string) string {
 			return filepath.Base(resolved)
 
 		case "devcontainerId":
+			if ctx.DevContainerID != "" {
+				return ctx.DevContainerID
+			}
 			return generateDevContainerID(ctx.Labels)
 		}
 
@@ -104,36 +108,37 @@ func substituteString(ctx *SubstituteContext, s string) string {
 	})
 }
 
-// generateDevContainerID creates a deterministic ID from labels
-// Uses SHA-256 hash + base32 encoding to create a 52-character ID
-// Label order doesn't matter (sorted for determinism)
-func generateDevContainerID(labels map[string]string) string {
-	// Sort keys for determinism
-	keys := make([]string, 0, len(labels))
-	for k := range labels {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	// Build sorted string
-	var builder strings.Builder
-	for _, k := range keys {
-		builder.WriteString(k)
-		builder.WriteString("=")
-		builder.WriteString(labels[k])
-		builder.WriteString("\n")
-	}
-
-	// SHA-256 hash
-	hash := sha256.Sum256([]byte(builder.String()))
+// ID labels identify a dev container to the reference implementation, which
+// derives ${devcontainerId} from them
+const (
+	LabelLocalFolder = "devcontainer.local_folder"
+	LabelConfigFile  = "devcontainer.config_file"
+)
 
-	// Base32 encode to 52 chars (base32 is safe for container names)
-	encoded := base32.StdEncoding.EncodeToString(hash[:])
-	encoded = strings.ToLower(encoded)
+// DevContainerID returns the ${devcontainerId} of the dev container for the
+// workspace folder localFolder configured by configFile. It stays the same as
+// long as neither moves, so it can name volumes that outlive the container.
+func DevContainerID(localFolder, configFile string) string {
+	return generateDevContainerID(map[string]string{
+		LabelLocalFolder: localFolder,
+		LabelConfigFile:  configFile,
+	})
+}
 
-	// Return first 52 characters
-	if len(encoded) > 52 {
-		return encoded[:52]
+// generateDevContainerID derives an ID from labels the way devcontainers/cli
+// does: the SHA-256 of the labels as JSON with sorted keys, written as a
+// base-32 number (digits 0-9a-v) padded to 52 characters
+func generateDevContainerID(labels map[string]string) string {
+	// encoding/json sorts map keys; JSON.stringify doesn't escape HTML characters
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if labels == nil {
+		labels = map[string]string{}
 	}
-	return encoded
+	_ = enc.Encode(labels)
+
+	hash := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	id := new(big.Int).SetBytes(hash[:]).Text(32)
+	return strings.Repeat("0", 52-len(id)) + id
 }
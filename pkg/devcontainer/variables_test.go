@@ -363,3 +363,19 @@ func TestSubstituteMultipleVariablesInString(t *testing.T) {
 		t.Errorf("Expected 'Path: /workspace, User: testuser', got '%s'", result)
 	}
 }
+
+func TestDevContainerIDMatchesReference(t *testing.T) {
+	// Values computed with the devcontainers/cli algorithm
+	got := DevContainerID("/home/dev/app", "/home/dev/app/.devcontainer/devcontainer.json")
+	if want := "06jak1t63th5o5cossaef7l468f48s1skje843igi9758sgeud4q"; got != want {
+		t.Errorf("DevContainerID() = %s, want %s", got, want)
+	}
+	if got := generateDevContainerID(map[string]string{"project": "a<b"}); got != "06s487m4du4746idtlmlhqk99t72h20q7mrdm1dhhihcbvc4501m" {
+		t.Errorf("generateDevContainerID() = %s, HTML characters should not be escaped", got)
+	}
+
+	ctx := &SubstituteContext{DevContainerID: "fixed", Labels: map[string]string{"project": "a"}}
+	if got := Substitute(ctx, "vol-${devcontainerId}"); got != "vol-fixed" {
+		t.Errorf("Substitute() = %v, want the context's DevContainerID", got)
+	}
+}
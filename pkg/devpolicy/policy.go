@@ -0,0 +1,342 @@
+// Package devpolicy enforces which devcontainer.json properties, docker run
+// arguments and features repositories may use. Policies are loaded from a
+// system-wide file managed by administrators and from the user's own config
+// directory; a devcontainer must satisfy both.
+package devpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// SystemPath is the administrator-managed policy file
+var SystemPath = "/etc/packnplay/policy.json"
+
+// ListRule allows or denies items by glob pattern ("*" also matches "/").
+// An item violates the rule if it matches a deny pattern, or if allow is not
+// empty and it matches no allow pattern.
+type ListRule struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Policy is a devcontainer policy loaded from policy.json
+type Policy struct {
+	Properties ListRule `json:"properties,omitempty"` // devcontainer.json property names, e.g. "privileged"
+	RunArgs    ListRule `json:"run_args,omitempty"`   // docker run flags, e.g. "--network=host" or "--cap-add"
+	Features   ListRule `json:"features,omitempty"`   // feature references, e.g. "ghcr.io/devcontainers/features/*"
+	Admins     []string `json:"admins,omitempty"`     // users allowed to override violations of this policy
+
+	path string
+}
+
+// Violation is one devcontainer setting a policy rejects
+type Violation struct {
+	Policy string // path of the policy file
+	Kind   string // "property", "run argument" or "feature"
+	Item   string
+	Reason string // the matching deny pattern, or "not in allow list"
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s %q: %s (%s)", v.Kind, v.Item, v.Reason, v.Policy)
+}
+
+// UserPath returns the XDG-compliant user policy file location
+func UserPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, _ := os.UserHomeDir()
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "packnplay", "policy.json")
+}
+
+// Load reads a policy file. A missing file yields nil.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	policy.path = path
+	return &policy, nil
+}
+
+// LoadAll loads the system and user policies that exist
+func LoadAll() ([]*Policy, error) {
+	var policies []*Policy
+	for _, p := range []string{SystemPath, UserPath()} {
+		policy, err := Load(p)
+		if err != nil {
+			return nil, err
+		}
+		if policy != nil {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// validate rejects malformed glob patterns
+func (p *Policy) validate() error {
+	rules := map[string]ListRule{"properties": p.Properties, "run_args": p.RunArgs, "features": p.Features}
+	for name, rule := range rules {
+		for _, pattern := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: invalid pattern %q", name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns the settings of cfg the policy rejects
+func (p *Policy) Check(cfg *devcontainer.Config) []Violation {
+	var violations []Violation
+	check := func(kind string, rule ListRule, items []string, match func(pattern, item string) bool) {
+		for _, item := range items {
+			if reason, ok := rule.violation(item, match); ok {
+				violations = append(violations, Violation{Policy: p.path, Kind: kind, Item: item, Reason: reason})
+			}
+		}
+	}
+
+	check("property", p.Properties, SetProperties(cfg), matchGlob)
+	check("run argument", p.RunArgs, ConfigRunFlags(cfg), matchFlag)
+
+	// A compose service's privileges and mounts are in the compose file, which
+	// this policy can't see into
+	if cfg.DockerComposeFile != nil && p.restrictsContainer() {
+		violations = append(violations, Violation{Policy: p.path, Kind: "property", Item: "dockerComposeFile", Reason: "compose services can't be checked against properties and run_args rules"})
+	}
+
+	features := make([]string, 0, len(cfg.Features))
+	for ref := range cfg.Features {
+		features = append(features, ref)
+	}
+	sort.Strings(features)
+	check("feature", p.Features, features, matchGlob)
+	return violations
+}
+
+// restrictsContainer reports whether the policy limits properties or run arguments
+func (p *Policy) restrictsContainer() bool {
+	return len(p.Properties.Allow)+len(p.Properties.Deny)+len(p.RunArgs.Allow)+len(p.RunArgs.Deny) > 0
+}
+
+// IsAdmin reports whether username may override this policy
+func (p *Policy) IsAdmin(username string) bool {
+	for _, admin := range p.Admins {
+		if admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the file the policy was loaded from
+func (p *Policy) Path() string {
+	return p.path
+}
+
+func (r ListRule) violation(item string, match func(pattern, item string) bool) (string, bool) {
+	for _, pattern := range r.Deny {
+		if match(pattern, item) {
+			return "denied by " + pattern, true
+		}
+	}
+	if len(r.Allow) == 0 {
+		return "", false
+	}
+	for _, pattern := range r.Allow {
+		if match(pattern, item) {
+			return "", false
+		}
+	}
+	return "not in allow list", true
+}
+
+// matchGlob matches item against a glob pattern in which "*" also matches "/"
+func matchGlob(pattern, item string) bool {
+	ok, _ := path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(item, "/", "\x00"))
+	return ok
+}
+
+// matchFlag matches a normalized run flag. A pattern without a value, such as
+// "--cap-add", matches the flag with any value.
+func matchFlag(pattern, flag string) bool {
+	if !strings.Contains(pattern, "=") {
+		name, _, _ := strings.Cut(flag, "=")
+		return matchGlob(pattern, name)
+	}
+	return matchGlob(pattern, flag)
+}
+
+// SetProperties returns the devcontainer.json properties cfg sets to something
+// other than an empty or false value, sorted
+func SetProperties(cfg *devcontainer.Config) []string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	var names []string
+	for name, value := range fields {
+		switch v := value.(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+		case bool:
+			if !v {
+				continue
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				continue
+			}
+		case map[string]interface{}:
+			if len(v) == 0 {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	if len(cfg.Entrypoint) > 0 {
+		names = append(names, "entrypoint")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagAliases maps docker run flag spellings to the name policies use
+var flagAliases = map[string]string{
+	"--net": "--network",
+}
+
+// RunFlags normalizes runArgs to one "--flag" or "--flag=value" entry per
+// flag, joining values given as a separate argument
+func RunFlags(args []string) []string {
+	var flags []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if alias, ok := flagAliases[name]; ok {
+			name = alias
+		}
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value, hasValue = args[i+1], true
+			i++
+		}
+		if hasValue {
+			flags = append(flags, name+"="+value)
+		} else {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// ConfigRunFlags returns the docker run flags cfg creates a container with,
+// normalized like RunFlags: its runArgs and the flags its privileged, init,
+// capAdd, securityOpt and mounts properties become, without duplicates. So a
+// rule on "--privileged" also covers "privileged": true, however it was set.
+func ConfigRunFlags(cfg *devcontainer.Config) []string {
+	flags := RunFlags(cfg.RunArgs)
+	if cfg.Privileged != nil && *cfg.Privileged {
+		flags = append(flags, "--privileged")
+	}
+	if cfg.Init != nil && *cfg.Init {
+		flags = append(flags, "--init")
+	}
+	for _, capability := range cfg.CapAdd {
+		flags = append(flags, "--cap-add="+capability)
+	}
+	for _, opt := range cfg.SecurityOpt {
+		flags = append(flags, "--security-opt="+opt)
+	}
+	for _, mount := range cfg.Mounts {
+		flags = append(flags, "--mount="+mount)
+	}
+
+	seen := make(map[string]bool, len(flags))
+	unique := flags[:0]
+	for _, flag := range flags {
+		if !seen[flag] {
+			seen[flag] = true
+			unique = append(unique, flag)
+		}
+	}
+	return unique
+}
+
+// Enforce checks cfg against every policy. Violations are returned as an
+// error unless overrideReason is set and the current user is an admin of
+// every policy that was violated, in which case they are returned as warnings.
+func Enforce(policies []*Policy, cfg *devcontainer.Config, overrideReason string) ([]Violation, error) {
+	var violations []Violation
+	username := currentUser()
+	canOverride := true
+	for _, policy := range policies {
+		found := policy.Check(cfg)
+		if len(found) > 0 && !policy.IsAdmin(username) {
+			canOverride = false
+		}
+		violations = append(violations, found...)
+	}
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	if overrideReason != "" && canOverride {
+		return violations, nil
+	}
+	var b strings.Builder
+	b.WriteString("devcontainer configuration violates policy:")
+	for _, v := range violations {
+		b.WriteString("\n  - " + v.String())
+	}
+	if overrideReason != "" {
+		fmt.Fprintf(&b, "\n%s is not an admin of every violated policy and cannot override it", username)
+	} else {
+		b.WriteString("\nPolicy admins can run anyway with --policy-override <reason>")
+	}
+	return violations, errors.New(b.String())
+}
+
+// currentUser returns the name admins are matched against
+var currentUser = func() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,137 @@
+package devpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+func TestRunFlags(t *testing.T) {
+	args := []string{"--network", "host", "--privileged", "--cap-add=SYS_ADMIN", "--net=bridge", "-e", "A=1"}
+	want := []string{"--network=host", "--privileged", "--cap-add=SYS_ADMIN", "--network=bridge", "-e=A=1"}
+	if got := RunFlags(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFlags() = %v, want %v", got, want)
+	}
+}
+
+func TestConfigRunFlags(t *testing.T) {
+	privileged := true
+	cfg := &devcontainer.Config{
+		RunArgs:     []string{"--privileged", "--memory", "2g"},
+		Privileged:  &privileged,
+		CapAdd:      []string{"SYS_PTRACE"},
+		SecurityOpt: []string{"seccomp=unconfined"},
+		Mounts:      []string{"type=bind,source=/,target=/host"},
+	}
+	want := []string{"--privileged", "--memory=2g", "--cap-add=SYS_PTRACE", "--security-opt=seccomp=unconfined", "--mount=type=bind,source=/,target=/host"}
+	if got := ConfigRunFlags(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigRunFlags() = %v, want %v", got, want)
+	}
+}
+
+func TestPolicyCheckCompose(t *testing.T) {
+	cfg := &devcontainer.Config{DockerComposeFile: "docker-compose.yml", Service: "app"}
+	restricted := &Policy{RunArgs: ListRule{Deny: []string{"--privileged"}}, path: "policy.json"}
+	if got := restricted.Check(cfg); len(got) != 1 || got[0].Item != "dockerComposeFile" {
+		t.Errorf("Check() = %v, want compose refused by a policy it can't evaluate", got)
+	}
+	featuresOnly := &Policy{Features: ListRule{Allow: []string{"ghcr.io/devcontainers/features/*"}}, path: "policy.json"}
+	if got := featuresOnly.Check(cfg); len(got) != 0 {
+		t.Errorf("Check() = %v, a features rule doesn't concern compose services", got)
+	}
+}
+
+func TestSetProperties(t *testing.T) {
+	privileged, init := true, false
+	cfg := &devcontainer.Config{Image: "alpine", Privileged: &privileged, Init: &init, RunArgs: []string{}}
+	want := []string{"image", "privileged"}
+	if got := SetProperties(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("SetProperties() = %v, want %v (false and empty values aren't set)", got, want)
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy := &Policy{
+		Properties: ListRule{Deny: []string{"privileged", "capAdd"}},
+		RunArgs:    ListRule{Allow: []string{"--memory", "--cpus"}, Deny: []string{"--network=host"}},
+		Features:   ListRule{Allow: []string{"ghcr.io/devcontainers/features/*"}},
+		path:       "policy.json",
+	}
+	privileged := true
+	cfg := &devcontainer.Config{
+		Image:      "alpine",
+		Privileged: &privileged,
+		RunArgs:    []string{"--memory=2g", "--network", "host", "--device", "/dev/fuse"},
+		Features: map[string]interface{}{
+			"ghcr.io/devcontainers/features/node:1": map[string]interface{}{},
+			"ghcr.io/someone/features/miner:1":      map[string]interface{}{},
+		},
+	}
+
+	var got []string
+	for _, v := range policy.Check(cfg) {
+		got = append(got, v.String())
+	}
+	want := []string{
+		`property "privileged": denied by privileged (policy.json)`,
+		`run argument "--network=host": denied by --network=host (policy.json)`,
+		`run argument "--device=/dev/fuse": not in allow list (policy.json)`,
+		`run argument "--privileged": not in allow list (policy.json)`,
+		`feature "ghcr.io/someone/features/miner:1": not in allow list (policy.json)`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestEnforceOverride(t *testing.T) {
+	orig := currentUser
+	t.Cleanup(func() { currentUser = orig })
+	currentUser = func() string { return "alice" }
+
+	privileged := true
+	cfg := &devcontainer.Config{Image: "alpine", Privileged: &privileged}
+	system := &Policy{Properties: ListRule{Deny: []string{"privileged"}}, Admins: []string{"alice"}, path: "/etc/packnplay/policy.json"}
+	user := &Policy{Properties: ListRule{Deny: []string{"privileged"}}, path: "user.json"}
+
+	if _, err := Enforce([]*Policy{system}, cfg, ""); err == nil || !strings.Contains(err.Error(), "--policy-override") {
+		t.Errorf("Enforce() error = %v, want violations reported", err)
+	}
+	violations, err := Enforce([]*Policy{system}, cfg, "debugging FUSE")
+	if err != nil || len(violations) != 1 {
+		t.Errorf("Enforce() by an admin = %v, %v, want the violation returned as a warning", violations, err)
+	}
+	if _, err := Enforce([]*Policy{system, user}, cfg, "debugging FUSE"); err == nil || !strings.Contains(err.Error(), "cannot override") {
+		t.Errorf("Enforce() error = %v, want the override refused for a policy alice doesn't administer", err)
+	}
+	if violations, err := Enforce([]*Policy{system}, &devcontainer.Config{Image: "alpine"}, ""); err != nil || violations != nil {
+		t.Errorf("Enforce() of a compliant config = %v, %v", violations, err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if policy, err := Load(filepath.Join(dir, "missing.json")); err != nil || policy != nil {
+		t.Errorf("Load() of missing file = %v, %v, want nil", policy, err)
+	}
+
+	path := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(path, []byte(`{"features": {"deny": ["[bad"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Errorf("Load() error = %v, want the malformed pattern rejected", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"properties": {"deny": ["privileged"]}, "admins": ["root"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := Load(path)
+	if err != nil || policy.Path() != path || !policy.IsAdmin("root") {
+		t.Errorf("Load() = %+v, %v", policy, err)
+	}
+}
@@ -0,0 +1,347 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported marks an operation the container runtime can't perform
+var ErrUnsupported = errors.New("not supported by this container runtime")
+
+// Runner runs commands of a container runtime's CLI. *Client implements it,
+// as do the runner's DockerClient and the fake runtime in tests.
+type Runner interface {
+	Run(args ...string) (string, error)
+	Command() string
+}
+
+// Capabilities are the runtime features packnplay adapts to. Code that
+// depends on one checks it rather than the runtime's name, so a new runtime
+// only needs a backend.
+type Capabilities struct {
+	Inspect           bool // inspect --format with Go templates: labels, state, config
+	PSFlags           bool // ps with docker's -a, -q, --filter, and Go template --format
+	Copy              bool // cp between the host and a container
+	Networks          bool // user-defined networks, for project networks and sidecars
+	NamedVolumes      bool // --mount type=volume
+	RestartPolicies   bool // run --restart
+	PortCommand       bool // port lists a container's published ports
+	Events            bool // events with --filter and JSON --format
+	Stats             bool // stats --no-stream with JSON --format
+	Top               bool // top lists a container's processes
+	SecurityOpts      bool // --security-opt and :z/:Z bind mount relabeling
+	SocketMounts      bool // bind mounting host unix sockets, for the host bridge
+	SocketPassthrough bool // the daemon serves a docker-compatible API socket containers can use
+}
+
+// RuntimeBackend is a container runtime's implementation of the operations
+// whose commands or support differ between runtimes. Operations a runtime
+// lacks return an error wrapping ErrUnsupported.
+type RuntimeBackend interface {
+	// Name is the runtime: docker, podman, nerdctl, or container (Apple)
+	Name() string
+	// Capabilities reports the optional features the runtime supports
+	Capabilities() Capabilities
+	// Create creates and starts a detached container from `run` arguments
+	// (without "run" itself) and returns its ID
+	Create(r Runner, args []string) (string, error)
+	// Start starts a stopped container
+	Start(r Runner, container string) error
+	// Exec runs a command in a container and returns its combined output
+	Exec(r Runner, container string, args ...string) (string, error)
+	// Inspect returns a Go template field of a container, such as Config.User
+	Inspect(r Runner, container, field string) (string, error)
+	// CopyIn copies the host path src to dst in a container
+	CopyIn(r Runner, container, src, dst string) error
+	// PortMap returns a container's published ports
+	PortMap(r Runner, container string) ([]PortBinding, error)
+	// Events returns a container's lifecycle events between since and until
+	Events(r Runner, container string, since, until time.Time) ([]Event, error)
+	// Stats returns a snapshot of the resource usage of running containers
+	Stats(r Runner, containers ...string) ([]ContainerStats, error)
+	// Top returns the process table of a running container, as the runtime
+	// prints it
+	Top(r Runner, container string) (string, error)
+}
+
+// PortBinding is a published container port
+type PortBinding struct {
+	ContainerPort string `json:"container_port"` // port/protocol, e.g. 3000/tcp
+	HostIP        string `json:"host_ip"`
+	HostPort      string `json:"host_port"`
+}
+
+// Event is a container lifecycle event reported by the runtime
+type Event struct {
+	Time      time.Time
+	Action    string // create, start, die, stop, ...
+	Container string // container ID
+}
+
+// ContainerStats is a snapshot of a container's resource usage, formatted by
+// the runtime
+type ContainerStats struct {
+	ID       string `json:"ID"`
+	Name     string `json:"Name"`
+	CPUPerc  string `json:"CPUPerc"`  // e.g. 12.50%
+	MemUsage string `json:"MemUsage"` // usage / limit, e.g. 512MiB / 7.6GiB
+	MemPerc  string `json:"MemPerc"`
+	NetIO    string `json:"NetIO"`
+	BlockIO  string `json:"BlockIO"` // read / written
+	PIDs     string `json:"PIDs"`
+}
+
+// cliBackend implements RuntimeBackend with the docker CLI's commands, which
+// podman and nerdctl accept as well
+type cliBackend struct {
+	name string
+	caps Capabilities
+}
+
+// dockerCapabilities are those of docker and podman
+var dockerCapabilities = Capabilities{
+	Inspect:           true,
+	PSFlags:           true,
+	Copy:              true,
+	Networks:          true,
+	NamedVolumes:      true,
+	RestartPolicies:   true,
+	PortCommand:       true,
+	Events:            true,
+	Stats:             true,
+	Top:               true,
+	SecurityOpts:      true,
+	SocketMounts:      true,
+	SocketPassthrough: true,
+}
+
+func (b *cliBackend) Name() string               { return b.name }
+func (b *cliBackend) Capabilities() Capabilities { return b.caps }
+
+func (b *cliBackend) unsupported(operation string) error {
+	return fmt.Errorf("%s: %w (%s)", operation, ErrUnsupported, b.name)
+}
+
+func (b *cliBackend) Create(r Runner, args []string) (string, error) {
+	output, err := r.Run(append([]string{"run"}, args...)...)
+	if err != nil {
+		return "", fmt.Errorf("%w\nDocker output:\n%s", err, output)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (b *cliBackend) Start(r Runner, container string) error {
+	if output, err := r.Run("start", container); err != nil {
+		return fmt.Errorf("%w\nDocker output:\n%s", err, output)
+	}
+	return nil
+}
+
+func (b *cliBackend) Exec(r Runner, container string, args ...string) (string, error) {
+	return r.Run(append([]string{"exec", container}, args...)...)
+}
+
+func (b *cliBackend) Inspect(r Runner, container, field string) (string, error) {
+	if !b.caps.Inspect {
+		return "", b.unsupported("inspect")
+	}
+	output, err := r.Run("inspect", "--format", "{{."+field+"}}", container)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", container, err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (b *cliBackend) CopyIn(r Runner, container, src, dst string) error {
+	if !b.caps.Copy {
+		return b.unsupported("cp")
+	}
+	if output, err := r.Run("cp", src, container+":"+dst); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w\nDocker output:\n%s", src, dst, err, output)
+	}
+	return nil
+}
+
+func (b *cliBackend) PortMap(r Runner, container string) ([]PortBinding, error) {
+	if !b.caps.PortCommand {
+		return nil, b.unsupported("port")
+	}
+	output, err := r.Run("port", container)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ports of %s: %w", container, err)
+	}
+	return ParsePortOutput(output), nil
+}
+
+func (b *cliBackend) Events(r Runner, container string, since, until time.Time) ([]Event, error) {
+	if !b.caps.Events {
+		return nil, b.unsupported("events")
+	}
+	output, err := r.Run("events",
+		"--since", strconv.FormatInt(since.Unix(), 10),
+		"--until", strconv.FormatInt(until.Unix(), 10),
+		"--filter", "container="+container,
+		"--format", "{{json .}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events of %s: %w", container, err)
+	}
+	return ParseEvents(output), nil
+}
+
+func (b *cliBackend) Stats(r Runner, containers ...string) ([]ContainerStats, error) {
+	if !b.caps.Stats {
+		return nil, b.unsupported("stats")
+	}
+	output, err := r.Run(append([]string{"stats", "--no-stream", "--format", "{{json .}}"}, containers...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats: %w\n%s", err, output)
+	}
+	return ParseStats(output), nil
+}
+
+func (b *cliBackend) Top(r Runner, container string) (string, error) {
+	if !b.caps.Top {
+		return "", b.unsupported("top")
+	}
+	output, err := r.Run("top", container)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the processes of %s: %w\n%s", container, err, output)
+	}
+	return output, nil
+}
+
+// ParseStats parses `stats --format '{{json .}}'` output, one container per
+// line. podman's PIDS matches PIDs, since field names are matched without
+// regard to case.
+func ParseStats(output string) []ContainerStats {
+	var stats []ContainerStats
+	for _, line := range strings.Split(output, "\n") {
+		var s ContainerStats
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &s); err != nil {
+			continue
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// ParsePortOutput parses `docker port` output lines like "3000/tcp -> 0.0.0.0:3000"
+func ParsePortOutput(output string) []PortBinding {
+	ports := []PortBinding{}
+	for _, line := range strings.Split(output, "\n") {
+		containerPort, host, ok := strings.Cut(strings.TrimSpace(line), " -> ")
+		if !ok {
+			continue
+		}
+		idx := strings.LastIndex(host, ":")
+		if idx == -1 {
+			continue
+		}
+		ports = append(ports, PortBinding{
+			ContainerPort: containerPort,
+			HostIP:        strings.Trim(host[:idx], "[]"),
+			HostPort:      host[idx+1:],
+		})
+	}
+	return ports
+}
+
+// ParseEvents parses `events --format '{{json .}}'` output, one event per
+// line, as docker, podman, and nerdctl print it
+func ParseEvents(output string) []Event {
+	var events []Event
+	for _, line := range strings.Split(output, "\n") {
+		var raw struct {
+			Action string `json:"Action"`
+			Status string `json:"Status"`
+			ID     string `json:"ID"`
+			Actor  struct {
+				ID string `json:"ID"`
+			} `json:"Actor"`
+			Time     json.RawMessage `json:"time"`
+			TimeNano int64           `json:"timeNano"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &raw); err != nil {
+			continue
+		}
+		event := Event{Action: raw.Action, Container: raw.Actor.ID}
+		if event.Action == "" {
+			event.Action = raw.Status
+		}
+		if event.Container == "" {
+			event.Container = raw.ID
+		}
+		switch {
+		case raw.TimeNano != 0:
+			event.Time = time.Unix(0, raw.TimeNano)
+		case len(raw.Time) > 0:
+			var seconds int64
+			var stamp time.Time
+			if json.Unmarshal(raw.Time, &seconds) == nil {
+				event.Time = time.Unix(seconds, 0)
+			} else if json.Unmarshal(raw.Time, &stamp) == nil {
+				event.Time = stamp
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// capabilityProbes decide capabilities that differ between versions of a
+// runtime by whether the runtime knows the subcommand
+var capabilityProbes = []struct {
+	args []string
+	set  func(c *Capabilities, ok bool)
+}{
+	{[]string{"cp", "--help"}, func(c *Capabilities, ok bool) { c.Copy = c.Copy && ok }},
+	{[]string{"port", "--help"}, func(c *Capabilities, ok bool) { c.PortCommand = c.PortCommand && ok }},
+	{[]string{"events", "--help"}, func(c *Capabilities, ok bool) { c.Events = c.Events && ok }},
+	{[]string{"stats", "--help"}, func(c *Capabilities, ok bool) { c.Stats = c.Stats && ok }},
+	{[]string{"top", "--help"}, func(c *Capabilities, ok bool) { c.Top = c.Top && ok }},
+}
+
+// ProbeCapabilities narrows caps to what the runtime r runs actually supports
+func ProbeCapabilities(r Runner, caps Capabilities) Capabilities {
+	for _, probe := range capabilityProbes {
+		_, err := r.Run(probe.args...)
+		probe.set(&caps, err == nil)
+	}
+	return caps
+}
+
+// probedBackends caches backends whose capabilities were probed, by command
+var probedBackends sync.Map
+
+// BackendFor returns the backend for the runtime r runs. nerdctl (including
+// Lima's nerdctl.lima) supports a subcommand set that varies by version, so
+// its capabilities are probed once per command. Other docker-compatible CLIs
+// (DOCKER_CMD) are treated as docker.
+func BackendFor(r Runner) RuntimeBackend {
+	command := r.Command()
+	name := filepath.Base(command)
+	switch {
+	case name == "container":
+		// Apple's container CLI has none of the optional features; the
+		// Client translates the commands it does have
+		return &cliBackend{name: "container"}
+	case name == "podman":
+		return &cliBackend{name: "podman", caps: dockerCapabilities}
+	case strings.HasPrefix(name, "nerdctl"):
+		if cached, ok := probedBackends.Load(command); ok {
+			return cached.(RuntimeBackend)
+		}
+		caps := dockerCapabilities
+		caps.SocketPassthrough = false // containerd has no docker API socket
+		backend := &cliBackend{name: "nerdctl", caps: ProbeCapabilities(r, caps)}
+		probedBackends.Store(command, backend)
+		return backend
+	}
+	return &cliBackend{name: "docker", caps: dockerCapabilities}
+}
@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedRunner answers commands by their first argument, failing unknown ones
+type scriptedRunner struct {
+	cmd     string
+	outputs map[string]string
+	calls   [][]string
+}
+
+func (r *scriptedRunner) Command() string { return r.cmd }
+
+func (r *scriptedRunner) Run(args ...string) (string, error) {
+	r.calls = append(r.calls, args)
+	output, ok := r.outputs[args[0]]
+	if !ok {
+		return "unknown command", errors.New("exit status 1")
+	}
+	return output, nil
+}
+
+func TestBackendForSelectsByRuntime(t *testing.T) {
+	tests := []struct {
+		cmd, name string
+		inspect   bool
+		socket    bool
+	}{
+		{"docker", "docker", true, true},
+		{"/usr/local/bin/podman", "podman", true, true},
+		{"container", "container", false, false},
+		{"finch", "docker", true, true},
+	}
+	for _, tt := range tests {
+		r := &scriptedRunner{cmd: tt.cmd}
+		backend := BackendFor(r)
+		caps := backend.Capabilities()
+		if backend.Name() != tt.name || caps.Inspect != tt.inspect || caps.SocketPassthrough != tt.socket {
+			t.Errorf("BackendFor(%s) = %s %+v", tt.cmd, backend.Name(), caps)
+		}
+		if len(r.calls) != 0 {
+			t.Errorf("BackendFor(%s) ran %v, want no probes", tt.cmd, r.calls)
+		}
+	}
+}
+
+func TestBackendForProbesNerdctl(t *testing.T) {
+	r := &scriptedRunner{cmd: "nerdctl-probe-test", outputs: map[string]string{"cp": "Usage: nerdctl cp", "port": "Usage: nerdctl port"}}
+	caps := BackendFor(r).Capabilities()
+	if !caps.Copy || !caps.PortCommand || caps.Events || caps.SocketPassthrough || !caps.Networks {
+		t.Errorf("Capabilities() = %+v, want events missing and no docker socket", caps)
+	}
+	probes := len(r.calls)
+	if BackendFor(r).Name() != "nerdctl" || len(r.calls) != probes {
+		t.Errorf("calls = %v, want the probes cached", r.calls)
+	}
+}
+
+func TestUnsupportedOperations(t *testing.T) {
+	r := &scriptedRunner{cmd: "container"}
+	backend := BackendFor(r)
+	if _, err := backend.Inspect(r, "c", "Config.User"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Inspect() error = %v, want ErrUnsupported", err)
+	}
+	if err := backend.CopyIn(r, "c", "/tmp/a", "/a"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("CopyIn() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := backend.PortMap(r, "c"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("PortMap() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := backend.Stats(r, "c"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Stats() error = %v, want ErrUnsupported", err)
+	}
+	if _, err := backend.Top(r, "c"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Top() error = %v, want ErrUnsupported", err)
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("calls = %v, want none", r.calls)
+	}
+}
+
+func TestBackendOperations(t *testing.T) {
+	r := &scriptedRunner{cmd: "docker", outputs: map[string]string{
+		"run":     "abc123\n",
+		"inspect": "dev\n",
+		"port":    "3000/tcp -> 0.0.0.0:3000\n",
+		"events":  `{"status":"start","id":"abc123","Action":"start","Actor":{"ID":"abc123"},"time":1700000000,"timeNano":1700000000000000000}` + "\n",
+	}}
+	backend := BackendFor(r)
+
+	if id, err := backend.Create(r, []string{"-d", "alpine"}); err != nil || id != "abc123" {
+		t.Errorf("Create() = %q, %v", id, err)
+	}
+	if user, err := backend.Inspect(r, "abc123", "Config.User"); err != nil || user != "dev" {
+		t.Errorf("Inspect() = %q, %v", user, err)
+	}
+	if ports, err := backend.PortMap(r, "abc123"); err != nil || len(ports) != 1 || ports[0].HostPort != "3000" {
+		t.Errorf("PortMap() = %+v, %v", ports, err)
+	}
+	events, err := backend.Events(r, "abc123", time.Unix(1699999999, 0), time.Unix(1700000001, 0))
+	if err != nil || len(events) != 1 || events[0].Action != "start" || events[0].Container != "abc123" || !events[0].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Events() = %+v, %v", events, err)
+	}
+	if err := backend.Start(r, "abc123"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("Start() error = %v, want the runtime's output", err)
+	}
+
+	want := [][]string{
+		{"run", "-d", "alpine"},
+		{"inspect", "--format", "{{.Config.User}}", "abc123"},
+		{"port", "abc123"},
+		{"events", "--since", "1699999999", "--until", "1700000001", "--filter", "container=abc123", "--format", "{{json .}}"},
+		{"start", "abc123"},
+	}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+}
+
+func TestBackendStatsAndTop(t *testing.T) {
+	r := &scriptedRunner{cmd: "docker", outputs: map[string]string{
+		"stats": `{"BlockIO":"1.2MB / 0B","CPUPerc":"12.50%","Container":"packnplay-app-main","ID":"abc123","MemPerc":"6.58%","MemUsage":"512MiB / 7.6GiB","Name":"packnplay-app-main","NetIO":"1kB / 2kB","PIDs":"7"}` + "\n" +
+			`{"ID":"def456","Name":"packnplay-api-main","CPUPerc":"0.00%","MemUsage":"10MB / 2GB","BlockIO":"0B / 0B","PIDS":"1"}` + "\n",
+		"top": "UID   PID   PPID   C   STIME   TTY   TIME       CMD\nroot  4242  4221   0   10:00   ?     00:00:00   sleep infinity\n",
+	}}
+	backend := BackendFor(r)
+
+	stats, err := backend.Stats(r, "packnplay-app-main", "packnplay-api-main")
+	if err != nil || len(stats) != 2 {
+		t.Fatalf("Stats() = %+v, %v", stats, err)
+	}
+	if stats[0] != (ContainerStats{ID: "abc123", Name: "packnplay-app-main", CPUPerc: "12.50%", MemUsage: "512MiB / 7.6GiB", MemPerc: "6.58%", NetIO: "1kB / 2kB", BlockIO: "1.2MB / 0B", PIDs: "7"}) {
+		t.Errorf("Stats()[0] = %+v", stats[0])
+	}
+	if stats[1].Name != "packnplay-api-main" || stats[1].PIDs != "1" {
+		t.Errorf("Stats()[1] = %+v, want podman's PIDS read", stats[1])
+	}
+	if top, err := backend.Top(r, "packnplay-app-main"); err != nil || !strings.Contains(top, "sleep infinity") {
+		t.Errorf("Top() = %q, %v", top, err)
+	}
+
+	want := [][]string{
+		{"stats", "--no-stream", "--format", "{{json .}}", "packnplay-app-main", "packnplay-api-main"},
+		{"top", "packnplay-app-main"},
+	}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+}
+
+func TestParseEventsPodman(t *testing.T) {
+	output := `{"ID":"def456","Image":"alpine","Name":"web","Status":"died","Time":"2024-05-01T10:00:00Z","Type":"container"}`
+	events := ParseEvents(output + "\nnot json\n")
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if len(events) != 1 || events[0].Action != "died" || events[0].Container != "def456" || !events[0].Time.Equal(want) {
+		t.Errorf("ParseEvents() = %+v", events)
+	}
+}
+
+func TestParsePortOutput(t *testing.T) {
+	output := "3000/tcp -> 0.0.0.0:3000\n3000/tcp -> [::]:3000\n5353/udp -> 127.0.0.1:15353\n\n"
+
+	want := []PortBinding{
+		{ContainerPort: "3000/tcp", HostIP: "0.0.0.0", HostPort: "3000"},
+		{ContainerPort: "3000/tcp", HostIP: "::", HostPort: "3000"},
+		{ContainerPort: "5353/udp", HostIP: "127.0.0.1", HostPort: "15353"},
+	}
+	if got := ParsePortOutput(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePortOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePortOutputEmpty(t *testing.T) {
+	got := ParsePortOutput("")
+	if got == nil || len(got) != 0 {
+		t.Errorf("ParsePortOutput(\"\") = %#v, want an empty (non-nil) slice so JSON prints []", got)
+	}
+}
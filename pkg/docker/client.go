@@ -2,20 +2,154 @@ package docker
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
 
+	"github.com/obra/packnplay/pkg/errdefs"
 	"github.com/obra/packnplay/pkg/progress"
+	"github.com/obra/packnplay/pkg/redact"
 )
 
+// daemonUnavailableMarkers are output fragments runtimes print when their daemon can't be reached
+var daemonUnavailableMarkers = []string{
+	"Cannot connect to the Docker daemon",
+	"Is the docker daemon running",
+	"error during connect",
+	"Cannot connect to Podman",
+	"unable to connect to Podman socket",
+}
+
+// DaemonUnavailable reports whether runtime output indicates the daemon is not running
+func DaemonUnavailable(output string) bool {
+	for _, marker := range daemonUnavailableMarkers {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrRegistryAuth marks runtime failures caused by a registry rejecting our credentials
+var ErrRegistryAuth = errors.New("registry authentication failed")
+
+// registryAuthMarkers are output fragments runtimes and oras print when a registry refuses access
+var registryAuthMarkers = []string{
+	"unauthorized",
+	"no basic auth credentials",
+	"authentication required",
+	"denied: ",
+	"401 Unauthorized",
+	"403 Forbidden",
+}
+
+// RegistryAuthFailed reports whether output indicates a registry rejected our credentials
+func RegistryAuthFailed(output string) bool {
+	lower := strings.ToLower(output)
+	for _, marker := range registryAuthMarkers {
+		if strings.Contains(lower, strings.ToLower(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError tags a failed runtime invocation as runtime_unavailable when the daemon
+// is down, and wraps ErrRegistryAuth when a registry rejected our credentials
+func classifyError(err error, output string) error {
+	if err == nil {
+		return nil
+	}
+	if DaemonUnavailable(output) {
+		return errdefs.New(errdefs.CategoryRuntimeUnavailable, err)
+	}
+	if RegistryAuthFailed(output) {
+		return fmt.Errorf("%w: %w", ErrRegistryAuth, err)
+	}
+	return err
+}
+
+// imageNotFoundMarkers are output fragments runtimes print when a pulled image doesn't exist
+var imageNotFoundMarkers = []string{
+	"manifest unknown",
+	"not found: manifest",
+	"repository does not exist",
+	"name unknown",
+}
+
+// ImageNotFound reports whether pull output indicates the image or tag doesn't exist
+func ImageNotFound(output string) bool {
+	lower := strings.ToLower(output)
+	for _, marker := range imageNotFoundMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimited reports whether pull output indicates the registry is throttling us
+func RateLimited(output string) bool {
+	lower := strings.ToLower(output)
+	return strings.Contains(lower, "toomanyrequests") || strings.Contains(lower, "429 too many requests")
+}
+
+// ErrPullTimeout marks a pull that was stopped by the pull timeout
+var ErrPullTimeout = errors.New("pull timed out")
+
+// PullError is a failed pull with the runtime's output and how far it got.
+// Layers that finished downloading stay in the runtime's store, so a retry
+// only fetches the rest.
+type PullError struct {
+	Err            error
+	Output         string
+	LayersComplete int
+	Layers         int
+}
+
+func (e *PullError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PullError) Unwrap() error {
+	return e.Err
+}
+
+// BuildError is a failed build with the end of its output, where a failing
+// RUN step prints what went wrong
+type BuildError struct {
+	Err    error
+	Output string
+}
+
+func (e *BuildError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// buildOutputLines is how much of a build's output a BuildError keeps
+const buildOutputLines = 200
+
 // Client handles Docker CLI interactions
 type Client struct {
 	cmd              string
 	verbose          bool
-	supportsProgress *bool // Cache for progress flag support
+	supportsProgress *bool         // Cache for progress flag support
+	pullTimeout      time.Duration // stop a single pull after this long, 0 for no limit
+}
+
+// SetPullTimeout limits how long a single pull may run
+func (c *Client) SetPullTimeout(timeout time.Duration) {
+	c.pullTimeout = timeout
 }
 
 // NewClient creates a new Docker client
@@ -37,7 +171,7 @@ func NewClientWithRuntime(preferredRuntime string, verbose bool) (*Client, error
 	}
 
 	if err != nil {
-		return nil, err
+		return nil, errdefs.New(errdefs.CategoryRuntimeUnavailable, err)
 	}
 	client.cmd = cmd
 	return client, nil
@@ -79,12 +213,23 @@ func (c *Client) UseSpecificRuntime(runtime string) (string, error) {
 		return "docker", nil
 	}
 
+	if runtime == "lima" {
+		// Lima installs a nerdctl wrapper that runs it in the Lima VM
+		if _, err := exec.LookPath(limaNerdctl); err != nil {
+			return "", fmt.Errorf("%s not found in PATH (it is installed with Lima)", limaNerdctl)
+		}
+		return limaNerdctl, nil
+	}
+
 	if _, err := exec.LookPath(runtime); err != nil {
 		return "", fmt.Errorf("container runtime '%s' not found in PATH", runtime)
 	}
 	return runtime, nil
 }
 
+// limaNerdctl is the nerdctl wrapper Lima installs on the host
+const limaNerdctl = "nerdctl.lima"
+
 // DetectCLI finds the docker command to use
 func (c *Client) DetectCLI() (string, error) {
 	// Check for DOCKER_CMD environment variable (legacy support)
@@ -95,16 +240,16 @@ func (c *Client) DetectCLI() (string, error) {
 		return envCmd, nil
 	}
 
-	// Try in order: docker, podman
+	// Try in order: docker, podman, nerdctl
 	// Note: Apple Container support disabled due to incompatibilities
-	runtimes := []string{"docker", "podman"}
+	runtimes := []string{"docker", "podman", "nerdctl"}
 	for _, runtime := range runtimes {
 		if _, err := exec.LookPath(runtime); err == nil {
 			return runtime, nil
 		}
 	}
 
-	return "", fmt.Errorf("no container runtime found (tried: docker, podman)")
+	return "", fmt.Errorf("no container runtime found (tried: docker, podman, nerdctl)")
 }
 
 // Run executes a docker command
@@ -117,16 +262,39 @@ func (c *Client) Run(args ...string) (string, error) {
 	cmd := exec.Command(c.cmd, args...)
 
 	if c.verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %v\n", c.cmd, args)
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", c.cmd, redact.Args(args))
 	}
 
 	output, err := cmd.CombinedOutput()
 
 	if c.verbose && len(output) > 0 {
-		fmt.Fprintf(os.Stderr, "%s\n", output)
+		fmt.Fprintf(os.Stderr, "%s\n", redact.String(string(output)))
 	}
 
-	return string(output), err
+	return string(output), classifyError(err, string(output))
+}
+
+// RunStreaming executes a docker command, writing its combined output to w as
+// it is produced
+func (c *Client) RunStreaming(w io.Writer, args ...string) error {
+	if c.cmd == "container" {
+		args = c.translateToAppleContainer(args)
+	}
+
+	cmd := exec.Command(c.cmd, args...)
+
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", c.cmd, redact.Args(args))
+	}
+
+	// Keep a copy of the output so failures are still classified
+	var output bytes.Buffer
+	out := io.MultiWriter(w, &output)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err := cmd.Run()
+	return classifyError(err, output.String())
 }
 
 // supportsProgressFlag checks if the Docker CLI supports the --progress flag
@@ -152,6 +320,15 @@ func (c *Client) supportsProgressFlag() bool {
 
 // RunWithProgress executes a docker command with real-time progress display
 func (c *Client) RunWithProgress(imageName string, args ...string) error {
+	isPull := len(args) > 0 && args[0] == "pull"
+	isBuild := len(args) > 0 && args[0] == "build"
+	ctx := context.Background()
+	if isPull && c.pullTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.pullTimeout)
+		defer cancel()
+	}
+
 	// Add progress flag for operations that support it, only if supported
 	if len(args) > 0 && c.supportsProgressFlag() {
 		switch args[0] {
@@ -169,10 +346,10 @@ func (c *Client) RunWithProgress(imageName string, args ...string) error {
 		args = c.translateToAppleContainer(args)
 	}
 
-	cmd := exec.Command(c.cmd, args...)
+	cmd := exec.CommandContext(ctx, c.cmd, args...)
 
 	if c.verbose {
-		fmt.Fprintf(os.Stderr, "+ %s %v\n", c.cmd, args)
+		fmt.Fprintf(os.Stderr, "+ %s %v\n", c.cmd, redact.Args(args))
 	}
 
 	// Docker commands output progress to different streams
@@ -238,13 +415,20 @@ func (c *Client) RunWithProgress(imageName string, args ...string) error {
 	var lastStatusText string
 	lastUpdateTime := time.Now()
 
-	// Read progress stream line by line
+	// Read progress stream line by line, keeping the end of a build's
+	var buildOutput []string
 	for progressScanner.Scan() {
 		line := progressScanner.Text()
+		if isBuild {
+			if len(buildOutput) == buildOutputLines {
+				buildOutput = buildOutput[1:]
+			}
+			buildOutput = append(buildOutput, line)
+		}
 
 		if c.verbose {
 			// In verbose mode, just show raw output without progress bar
-			fmt.Fprintf(os.Stderr, "%s\n", line)
+			fmt.Fprintf(os.Stderr, "%s\n", redact.String(line))
 			continue
 		}
 
@@ -281,16 +465,27 @@ func (c *Client) RunWithProgress(imageName string, args ...string) error {
 	// Wait for command to finish
 	err := cmd.Wait()
 
-	// Get any error output
-	var stderrOutput string
-	select {
-	case stderrOutput = <-errorOutput:
-	default:
-	}
+	// Get any error output; the reader finishes once Wait has closed the pipe
+	stderrOutput := <-errorOutput
 
 	// Handle completion
 	if err != nil {
-		progressBar.Error(fmt.Errorf("%w\nDocker output:\n%s", err, stderrOutput))
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("%w after %s", ErrPullTimeout, c.pullTimeout)
+		}
+		progressBar.Error(fmt.Errorf("%w\nDocker output:\n%s", err, redact.String(stderrOutput)))
+		err = classifyError(err, stderrOutput)
+		if isPull {
+			return &PullError{
+				Err:            err,
+				Output:         stderrOutput,
+				LayersComplete: tracker.CompletedLayerCount(),
+				Layers:         tracker.GetLayerCount(),
+			}
+		}
+		if isBuild {
+			return &BuildError{Err: err, Output: strings.Join(append(buildOutput, stderrOutput), "\n")}
+		}
 		return err
 	} else {
 		// Get final status for completion message
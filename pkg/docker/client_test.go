@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"errors"
 	"os"
 	"testing"
 )
@@ -53,3 +54,95 @@ func TestDetectDockerCLI(t *testing.T) {
 		})
 	}
 }
+
+func TestDaemonUnavailable(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?", true},
+		{"Error: unable to connect to Podman socket: dial unix /run/podman/podman.sock: connect: no such file or directory", true},
+		{"Error response from daemon: pull access denied for foo, repository does not exist", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := DaemonUnavailable(tt.output); got != tt.want {
+			t.Errorf("DaemonUnavailable(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRegistryAuthFailed(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Error response from daemon: Head \"https://123456789012.dkr.ecr.us-east-1.amazonaws.com/v2/app/manifests/latest\": no basic auth credentials", true},
+		{"denied: Your authorization token has expired. Reauthenticate and try again.", true},
+		{"Error: failed to resolve: GET https://ghcr.io/token: 401 Unauthorized", true},
+		{"unauthorized: authentication required", true},
+		{"Error response from daemon: manifest for alpine:nope not found", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := RegistryAuthFailed(tt.output); got != tt.want {
+			t.Errorf("RegistryAuthFailed(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyErrorRegistryAuth(t *testing.T) {
+	base := errors.New("exit status 1")
+
+	err := classifyError(base, "no basic auth credentials")
+	if !errors.Is(err, ErrRegistryAuth) || !errors.Is(err, base) {
+		t.Errorf("classifyError() = %v, want it to wrap ErrRegistryAuth and the original error", err)
+	}
+	if err := classifyError(base, "manifest unknown"); errors.Is(err, ErrRegistryAuth) {
+		t.Errorf("classifyError() = %v, should not be a registry auth error", err)
+	}
+	if classifyError(nil, "unauthorized") != nil {
+		t.Error("classifyError(nil) should be nil")
+	}
+}
+
+func TestImageNotFound(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Error response from daemon: manifest for alpine:nope not found: manifest unknown: manifest unknown", true},
+		{"Error response from daemon: pull access denied for foo, repository does not exist or may require 'docker login'", true},
+		{"Error: initializing source docker://quay.io/org/nope:latest: reading manifest latest in quay.io/org/nope: name unknown", true},
+		{"error pulling image configuration: download failed after attempts=6: net/http: TLS handshake timeout", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ImageNotFound(tt.output); got != tt.want {
+			t.Errorf("ImageNotFound(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	if !RateLimited("toomanyrequests: You have reached your pull rate limit.") {
+		t.Error("Docker Hub rate limit not detected")
+	}
+	if RateLimited("unexpected EOF") {
+		t.Error("network error reported as rate limit")
+	}
+}
+
+func TestPullErrorUnwraps(t *testing.T) {
+	err := error(&PullError{Err: classifyError(errors.New("exit status 1"), "unauthorized"), Output: "unauthorized", LayersComplete: 2, Layers: 5})
+	if !errors.Is(err, ErrRegistryAuth) {
+		t.Errorf("errors.Is(%v, ErrRegistryAuth) = false, want PullError to unwrap", err)
+	}
+	var pullErr *PullError
+	if !errors.As(err, &pullErr) || pullErr.LayersComplete != 2 {
+		t.Errorf("errors.As() = %+v", pullErr)
+	}
+}
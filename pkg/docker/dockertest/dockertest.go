@@ -0,0 +1,893 @@
+// Package dockertest provides an in-memory container runtime for unit tests.
+// FakeClient records every command and answers inspect, ps, exec and the
+// container lifecycle commands from its own containers and images, so code
+// written against the docker CLI can be tested without a daemon.
+package dockertest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Container is a container known to a FakeClient
+type Container struct {
+	ID         string
+	Name       string
+	Image      string
+	Running    bool
+	Labels     map[string]string
+	Env        []string
+	User       string
+	WorkingDir string
+	StartedAt  time.Time
+	Created    time.Time
+	Health     string // healthcheck status; empty when the container has none
+	ExitCode   int
+
+	// RunArgs are the arguments the container was created with by docker run
+	// or docker create, starting after the subcommand
+	RunArgs []string
+}
+
+// Image is an image known to a FakeClient
+type Image struct {
+	Name         string
+	ID           string
+	Os           string
+	Architecture string
+	Env          []string
+	User         string
+	Labels       map[string]string
+	RepoDigests  []string
+	Created      time.Time
+	Size         int64
+}
+
+// HandlerFunc answers a command instead of the fake's built-in behavior
+type HandlerFunc func(args []string) (string, error)
+
+// ExecFunc answers docker exec for a container
+type ExecFunc func(container *Container, command []string) (string, error)
+
+type handler struct {
+	prefix []string
+	fn     HandlerFunc
+}
+
+// FakeClient is an in-memory container runtime. It implements the Run,
+// RunWithProgress, RunStreaming and Command methods of docker.Client.
+type FakeClient struct {
+	// Cmd is returned by Command; "docker" by default
+	Cmd string
+	// Exec answers docker exec; by default exec succeeds with no output
+	Exec ExecFunc
+
+	mu         sync.Mutex
+	calls      [][]string
+	containers []*Container
+	images     map[string]*Image
+	handlers   []handler
+	nextID     int
+}
+
+// New creates an empty FakeClient
+func New() *FakeClient {
+	return &FakeClient{Cmd: "docker", images: make(map[string]*Image)}
+}
+
+// AddContainer adds a container, assigning an ID if it has none
+func (f *FakeClient) AddContainer(c Container) *Container {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addContainer(c)
+}
+
+func (f *FakeClient) addContainer(c Container) *Container {
+	if c.ID == "" {
+		c.ID = f.newID("container")
+	}
+	if c.Labels == nil {
+		c.Labels = make(map[string]string)
+	}
+	if c.Running && c.StartedAt.IsZero() {
+		c.StartedAt = time.Now()
+	}
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+	added := c
+	f.containers = append(f.containers, &added)
+	return &added
+}
+
+// AddImage adds an image, assigning an ID if it has none
+func (f *FakeClient) AddImage(img Image) *Image {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addImage(img)
+}
+
+func (f *FakeClient) addImage(img Image) *Image {
+	if img.ID == "" {
+		img.ID = "sha256:" + f.newID("image")
+	}
+	if img.Os == "" {
+		img.Os = "linux"
+	}
+	if img.Architecture == "" {
+		img.Architecture = "amd64"
+	}
+	if img.Created.IsZero() {
+		img.Created = time.Now()
+	}
+	added := img
+	f.images[normalizeImage(img.Name)] = &added
+	return &added
+}
+
+// Container returns the container with the given name or ID
+func (f *FakeClient) Container(nameOrID string) *Container {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.findContainer(nameOrID)
+}
+
+// Containers returns all containers
+func (f *FakeClient) Containers() []*Container {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Container(nil), f.containers...)
+}
+
+// Image returns the image with the given name, if present
+func (f *FakeClient) Image(name string) *Image {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.images[normalizeImage(name)]
+}
+
+// On answers commands starting with prefix (e.g. "image", "inspect") with fn.
+// Later handlers take precedence over earlier ones and over built-in behavior.
+func (f *FakeClient) On(fn HandlerFunc, prefix ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append(f.handlers, handler{prefix: prefix, fn: fn})
+}
+
+// Fail makes commands starting with prefix fail with output and err
+func (f *FakeClient) Fail(err error, output string, prefix ...string) {
+	f.On(func([]string) (string, error) { return output, err }, prefix...)
+}
+
+// Calls returns every command run so far
+func (f *FakeClient) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([][]string, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// CallsTo returns the commands that started with prefix
+func (f *FakeClient) CallsTo(prefix ...string) [][]string {
+	var matched [][]string
+	for _, call := range f.Calls() {
+		if hasPrefix(call, prefix) {
+			matched = append(matched, call)
+		}
+	}
+	return matched
+}
+
+// Command returns the runtime CLI name
+func (f *FakeClient) Command() string {
+	return f.Cmd
+}
+
+// RunWithProgress records the command and answers pull and build by adding
+// the image
+func (f *FakeClient) RunWithProgress(imageName string, args ...string) error {
+	_, err := f.Run(args...)
+	return err
+}
+
+// RunStreaming runs the command and writes its output to w
+func (f *FakeClient) RunStreaming(w io.Writer, args ...string) error {
+	output, err := f.Run(args...)
+	_, _ = io.WriteString(w, output)
+	return err
+}
+
+// Run records the command and answers it from the registered handlers or the
+// fake's containers and images
+func (f *FakeClient) Run(args ...string) (string, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, append([]string(nil), args...))
+	for i := len(f.handlers) - 1; i >= 0; i-- {
+		if hasPrefix(args, f.handlers[i].prefix) {
+			fn := f.handlers[i].fn
+			f.mu.Unlock()
+			return fn(args)
+		}
+	}
+	if len(args) > 0 && args[0] == "exec" {
+		// Exec handlers may call back into the fake, so answer them unlocked
+		f.mu.Unlock()
+		return f.exec(args[1:])
+	}
+	defer f.mu.Unlock()
+
+	if len(args) == 0 {
+		return "", nil
+	}
+	switch args[0] {
+	case "inspect":
+		return f.inspect(args[1:], "")
+	case "container":
+		if len(args) > 1 && args[1] == "inspect" {
+			return f.inspect(args[2:], "container")
+		}
+		if len(args) > 1 && (args[1] == "ls" || args[1] == "list") {
+			return f.ps(args[2:])
+		}
+		return "", nil
+	case "image":
+		if len(args) > 1 && args[1] == "inspect" {
+			return f.inspect(args[2:], "image")
+		}
+		if len(args) > 1 && args[1] == "rm" {
+			return f.removeImages(args[2:])
+		}
+		if len(args) > 1 && (args[1] == "ls" || args[1] == "list") {
+			return f.listImages(args[2:])
+		}
+		return "", nil
+	case "images":
+		return f.listImages(args[1:])
+	case "ps":
+		return f.ps(args[1:])
+	case "run", "create":
+		return f.create(args[1:], args[0] == "run")
+	case "start", "restart", "unpause":
+		return f.setRunning(args[1:], true)
+	case "stop", "kill":
+		return f.setRunning(args[1:], false)
+	case "rm":
+		return f.remove(args[1:])
+	case "pull":
+		return f.pull(args[1:])
+	case "build":
+		return f.build(args[1:])
+	case "tag":
+		return f.tag(args[1:])
+	case "rmi":
+		return f.removeImages(args[1:])
+	}
+	return "", nil
+}
+
+// exec answers docker exec [flags] container command...
+func (f *FakeClient) exec(args []string) (string, error) {
+	rest := skipFlags(args, execValueFlags)
+	if len(rest) == 0 {
+		return "", fmt.Errorf("docker exec requires a container")
+	}
+	f.mu.Lock()
+	c := f.findContainer(rest[0])
+	f.mu.Unlock()
+	if c == nil {
+		return noSuchContainer(rest[0])
+	}
+	if !c.Running {
+		return fmt.Sprintf("Error response from daemon: container %s is not running\n", c.ID), fmt.Errorf("exit status 1")
+	}
+	if f.Exec == nil {
+		return "", nil
+	}
+	return f.Exec(c, rest[1:])
+}
+
+// inspect answers docker inspect [--type t] [--format f] name...
+func (f *FakeClient) inspect(args []string, kind string) (string, error) {
+	var format string
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--type" && i+1 < len(args):
+			kind = args[i+1]
+			i++
+		case arg == "--format" || arg == "-f":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case strings.HasPrefix(arg, "-"):
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	var objects []interface{}
+	for _, name := range names {
+		var obj interface{}
+		if kind != "image" {
+			if c := f.findContainer(name); c != nil {
+				obj = containerObject(c)
+			}
+		}
+		if obj == nil && kind != "container" {
+			if img := f.images[normalizeImage(name)]; img != nil {
+				obj = imageObject(img)
+			}
+		}
+		if obj == nil {
+			return fmt.Sprintf("Error: No such object: %s\n", name), fmt.Errorf("exit status 1")
+		}
+		objects = append(objects, obj)
+	}
+
+	if format == "" {
+		data, _ := json.MarshalIndent(objects, "", "    ")
+		return string(data) + "\n", nil
+	}
+	var out strings.Builder
+	for _, obj := range objects {
+		line, err := render(format, obj)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// psRow is a row of docker ps, with the fields --format templates use
+type psRow struct {
+	ID     string `json:"ID"`
+	Names  string `json:"Names"`
+	Image  string `json:"Image"`
+	Status string `json:"Status"`
+	State  string `json:"State"`
+	Labels string `json:"Labels"`
+
+	labels map[string]string
+}
+
+// Label returns the value of a label, as in {{.Label "name"}}
+func (r psRow) Label(name string) string {
+	return r.labels[name]
+}
+
+// ps answers docker ps [-a] [-q] [--no-trunc] [--filter f]... [--format f]
+func (f *FakeClient) ps(args []string) (string, error) {
+	all, quiet, noTrunc := false, false, false
+	var format string
+	var filters []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-a", "--all":
+			all = true
+		case "-q", "--quiet":
+			quiet = true
+		case "-aq", "-qa":
+			all, quiet = true, true
+		case "--no-trunc":
+			noTrunc = true
+		case "--filter", "-f":
+			if i+1 < len(args) {
+				filters = append(filters, args[i+1])
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		}
+	}
+
+	var out strings.Builder
+	for _, c := range f.containers {
+		if !all && !c.Running {
+			continue
+		}
+		if !matchesFilters(c, filters) {
+			continue
+		}
+		id := c.ID
+		if !noTrunc && len(id) > 12 {
+			id = id[:12]
+		}
+		if quiet {
+			out.WriteString(id + "\n")
+			continue
+		}
+
+		row := psRow{ID: id, Names: c.Name, Image: c.Image, State: "exited", Status: fmt.Sprintf("Exited (%d) 1 minute ago", c.ExitCode), Labels: formatLabels(c.Labels), labels: c.Labels}
+		if c.Running {
+			row.State = "running"
+			row.Status = "Up 1 minute"
+		}
+		switch format {
+		case "json", "{{json .}}":
+			data, _ := json.Marshal(row)
+			out.Write(data)
+			out.WriteString("\n")
+		case "":
+			fmt.Fprintf(&out, "%s\t%s\t%s\t%s\n", row.ID, row.Image, row.Status, row.Names)
+		default:
+			line, err := render(format, row)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(line + "\n")
+		}
+	}
+	return out.String(), nil
+}
+
+// matchesFilters applies docker ps name, id, label and status filters
+func matchesFilters(c *Container, filters []string) bool {
+	for _, filter := range filters {
+		key, value, _ := strings.Cut(filter, "=")
+		switch key {
+		case "name":
+			re, err := regexp.Compile(value)
+			if err != nil || !re.MatchString(c.Name) {
+				return false
+			}
+		case "id":
+			if !strings.HasPrefix(c.ID, value) {
+				return false
+			}
+		case "label":
+			name, want, hasValue := strings.Cut(value, "=")
+			got, ok := c.Labels[name]
+			if !ok || (hasValue && got != want) {
+				return false
+			}
+		case "status":
+			running := value == "running"
+			if c.Running != running {
+				return false
+			}
+		case "ancestor":
+			if normalizeImage(c.Image) != normalizeImage(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// runBoolFlags are docker run/create flags without a value; every other flag
+// is assumed to take one
+var runBoolFlags = map[string]bool{
+	"-d": true, "--detach": true, "--rm": true, "-i": true, "--interactive": true,
+	"-t": true, "--tty": true, "-it": true, "-ti": true, "--init": true,
+	"--privileged": true, "--read-only": true, "-P": true, "--publish-all": true,
+	"--no-healthcheck": true, "--oom-kill-disable": true,
+}
+
+// execValueFlags are docker exec flags that take a value
+var execValueFlags = map[string]bool{
+	"-u": true, "--user": true, "-w": true, "--workdir": true, "-e": true,
+	"--env": true, "--env-file": true, "--detach-keys": true,
+}
+
+// create answers docker run and docker create, returning the new container's ID
+func (f *FakeClient) create(args []string, start bool) (string, error) {
+	c := Container{Running: start, Labels: make(map[string]string), RunArgs: append([]string(nil), args...)}
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+		if runBoolFlags[arg] || strings.Contains(arg, "=") && strings.HasPrefix(arg, "--") {
+			if name, value, ok := strings.Cut(arg, "="); ok {
+				f.applyRunFlag(&c, name, value)
+			}
+			continue
+		}
+		if i+1 < len(args) {
+			f.applyRunFlag(&c, arg, args[i+1])
+			i++
+		}
+	}
+	if i >= len(args) {
+		return "docker: 'docker run' requires at least 1 argument\n", fmt.Errorf("exit status 125")
+	}
+	c.Image = args[i]
+	if c.Name != "" && f.findContainer(c.Name) != nil {
+		return fmt.Sprintf("docker: Error response from daemon: Conflict. The container name \"/%s\" is already in use.\n", c.Name), fmt.Errorf("exit status 125")
+	}
+	if img := f.images[normalizeImage(c.Image)]; img != nil {
+		for k, v := range img.Labels {
+			if _, ok := c.Labels[k]; !ok {
+				c.Labels[k] = v
+			}
+		}
+		c.Env = append(append([]string(nil), img.Env...), c.Env...)
+		if c.User == "" {
+			c.User = img.User
+		}
+	} else {
+		f.addImage(Image{Name: c.Image})
+	}
+	if c.Name == "" {
+		c.Name = fmt.Sprintf("fake_container_%d", f.nextID+1)
+	}
+	added := f.addContainer(c)
+	return added.ID + "\n", nil
+}
+
+func (f *FakeClient) applyRunFlag(c *Container, flag, value string) {
+	switch flag {
+	case "--name":
+		c.Name = value
+	case "-l", "--label":
+		k, v, _ := strings.Cut(value, "=")
+		c.Labels[k] = v
+	case "-e", "--env":
+		c.Env = append(c.Env, value)
+	case "-u", "--user":
+		c.User = value
+	case "-w", "--workdir":
+		c.WorkingDir = value
+	}
+}
+
+// setRunning answers start, stop and their relatives
+func (f *FakeClient) setRunning(args []string, running bool) (string, error) {
+	var out strings.Builder
+	for _, name := range skipFlags(args, map[string]bool{"-t": true, "--time": true, "-s": true, "--signal": true}) {
+		c := f.findContainer(name)
+		if c == nil {
+			return noSuchContainer(name)
+		}
+		if running && !c.Running {
+			c.StartedAt = time.Now()
+		}
+		c.Running = running
+		out.WriteString(name + "\n")
+	}
+	return out.String(), nil
+}
+
+// remove answers docker rm [-f] name...
+func (f *FakeClient) remove(args []string) (string, error) {
+	force := false
+	var names []string
+	for _, arg := range args {
+		switch arg {
+		case "-f", "--force":
+			force = true
+		case "-v", "--volumes":
+		default:
+			names = append(names, arg)
+		}
+	}
+	var out strings.Builder
+	for _, name := range names {
+		c := f.findContainer(name)
+		if c == nil {
+			return noSuchContainer(name)
+		}
+		if c.Running && !force {
+			return fmt.Sprintf("Error response from daemon: cannot remove container %q: container is running: stop the container before removing or force remove\n", c.Name), fmt.Errorf("exit status 1")
+		}
+		for i, existing := range f.containers {
+			if existing == c {
+				f.containers = append(f.containers[:i], f.containers[i+1:]...)
+				break
+			}
+		}
+		out.WriteString(name + "\n")
+	}
+	return out.String(), nil
+}
+
+// pull answers docker pull [flags] image
+func (f *FakeClient) pull(args []string) (string, error) {
+	rest := skipFlags(args, map[string]bool{"--platform": true})
+	if len(rest) == 0 {
+		return "", fmt.Errorf("docker pull requires an image")
+	}
+	if f.images[normalizeImage(rest[0])] == nil {
+		f.addImage(Image{Name: rest[0]})
+	}
+	return "", nil
+}
+
+// build answers docker build by adding the images it tags, with the labels
+// it sets. Images tagged by one build share an ID.
+func (f *FakeClient) build(args []string) (string, error) {
+	var tags []string
+	labels := make(map[string]string)
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-t", "--tag":
+			tags = append(tags, args[i+1])
+		case "--label":
+			name, value, _ := strings.Cut(args[i+1], "=")
+			labels[name] = value
+		}
+	}
+	var id string
+	for _, tag := range tags {
+		img := f.addImage(Image{Name: tag, ID: id, Labels: labels})
+		id = img.ID
+	}
+	return "", nil
+}
+
+// imageRow is a row of docker image ls, with the fields --format templates use
+type imageRow struct {
+	Repository string `json:"Repository"`
+	Tag        string `json:"Tag"`
+	ID         string `json:"ID"`
+	Size       string `json:"Size"`
+}
+
+// listImages answers docker image ls [--filter reference=pattern]... [--format f]
+func (f *FakeClient) listImages(args []string) (string, error) {
+	var format string
+	var references []string
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "--filter", "-f":
+			if value, ok := strings.CutPrefix(args[i+1], "reference="); ok {
+				references = append(references, value)
+			}
+			i++
+		case "--format":
+			format = args[i+1]
+			i++
+		}
+	}
+
+	names := make([]string, 0, len(f.images))
+	for name := range f.images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	for _, name := range names {
+		img := f.images[name]
+		repository, tag := name, ""
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			repository, tag = name[:i], name[i+1:]
+		}
+		matched := len(references) == 0
+		for _, reference := range references {
+			if ok, _ := path.Match(reference, repository); ok {
+				matched = true
+			} else if ok, _ := path.Match(reference, name); ok {
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+		row := imageRow{Repository: repository, Tag: tag, ID: strings.TrimPrefix(img.ID, "sha256:")[:12], Size: fmt.Sprintf("%dB", img.Size)}
+		if format == "" {
+			fmt.Fprintf(&out, "%s\t%s\t%s\t%s\n", row.Repository, row.Tag, row.ID, row.Size)
+			continue
+		}
+		line, err := render(format, row)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// tag answers docker tag source target
+func (f *FakeClient) tag(args []string) (string, error) {
+	if len(args) != 2 {
+		return "", fmt.Errorf("docker tag requires source and target")
+	}
+	img := f.images[normalizeImage(args[0])]
+	if img == nil {
+		return fmt.Sprintf("Error response from daemon: No such image: %s\n", args[0]), fmt.Errorf("exit status 1")
+	}
+	tagged := *img
+	tagged.Name = args[1]
+	f.images[normalizeImage(args[1])] = &tagged
+	return "", nil
+}
+
+// removeImages answers docker rmi and docker image rm
+func (f *FakeClient) removeImages(args []string) (string, error) {
+	for _, name := range args {
+		if strings.HasPrefix(name, "-") {
+			continue
+		}
+		if f.images[normalizeImage(name)] == nil {
+			return fmt.Sprintf("Error response from daemon: No such image: %s\n", name), fmt.Errorf("exit status 1")
+		}
+		delete(f.images, normalizeImage(name))
+	}
+	return "", nil
+}
+
+// findContainer finds a container by name (with or without a leading /), full
+// ID, or unique ID prefix
+func (f *FakeClient) findContainer(nameOrID string) *Container {
+	name := strings.TrimPrefix(nameOrID, "/")
+	var byPrefix *Container
+	for _, c := range f.containers {
+		if c.Name == name || c.ID == name {
+			return c
+		}
+		if len(name) >= 4 && strings.HasPrefix(c.ID, name) {
+			byPrefix = c
+		}
+	}
+	return byPrefix
+}
+
+// newID returns a deterministic 64-character hex ID
+func (f *FakeClient) newID(kind string) string {
+	f.nextID++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", kind, f.nextID)))
+	return hex.EncodeToString(sum[:])
+}
+
+// containerObject is the subset of docker inspect's container JSON that
+// --format templates can reach
+func containerObject(c *Container) map[string]interface{} {
+	status := "exited"
+	if c.Running {
+		status = "running"
+	}
+	state := map[string]interface{}{
+		"Status":    status,
+		"Running":   c.Running,
+		"Paused":    false,
+		"ExitCode":  c.ExitCode,
+		"StartedAt": c.StartedAt.UTC().Format(time.RFC3339Nano),
+	}
+	if c.Health != "" {
+		state["Health"] = map[string]interface{}{"Status": c.Health}
+	}
+	env := c.Env
+	if env == nil {
+		env = []string{}
+	}
+	return map[string]interface{}{
+		"Id":      c.ID,
+		"Name":    "/" + c.Name,
+		"Image":   c.Image,
+		"Created": c.Created.UTC().Format(time.RFC3339Nano),
+		"State":   state,
+		"Config": map[string]interface{}{
+			"Image":      c.Image,
+			"User":       c.User,
+			"WorkingDir": c.WorkingDir,
+			"Env":        env,
+			"Labels":     c.Labels,
+		},
+	}
+}
+
+// imageObject is the subset of docker image inspect's JSON that --format
+// templates can reach
+func imageObject(img *Image) map[string]interface{} {
+	env := img.Env
+	if env == nil {
+		env = []string{}
+	}
+	digests := img.RepoDigests
+	if digests == nil {
+		digests = []string{}
+	}
+	return map[string]interface{}{
+		"Id":           img.ID,
+		"RepoTags":     []string{img.Name},
+		"RepoDigests":  digests,
+		"Created":      img.Created.UTC().Format(time.RFC3339Nano),
+		"Os":           img.Os,
+		"Architecture": img.Architecture,
+		"Size":         img.Size,
+		"Config": map[string]interface{}{
+			"User":   img.User,
+			"Env":    env,
+			"Labels": img.Labels,
+		},
+	}
+}
+
+// templateFuncs are the docker CLI's --format template functions
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"split": strings.Split,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// render executes a --format template against obj
+func render(format string, obj interface{}) (string, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return fmt.Sprintf("template parsing error: %v\n", err), fmt.Errorf("exit status 64")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, obj); err != nil {
+		return fmt.Sprintf("template: %v\n", err), fmt.Errorf("exit status 1")
+	}
+	return buf.String(), nil
+}
+
+// formatLabels renders labels as docker ps does: sorted k=v pairs joined by commas
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// normalizeImage drops the implicit Docker Hub prefix and adds the implicit
+// :latest tag
+func normalizeImage(name string) string {
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "docker.io/"), "library/")
+	if strings.Contains(name, "@") {
+		return name
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name
+	}
+	return name + ":latest"
+}
+
+// skipFlags drops leading flags (and the values of valueFlags) from args
+func skipFlags(args []string, valueFlags map[string]bool) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return args[i:]
+		}
+		if valueFlags[arg] {
+			i++
+		}
+	}
+	return nil
+}
+
+func hasPrefix(args, prefix []string) bool {
+	if len(prefix) > len(args) {
+		return false
+	}
+	for i, p := range prefix {
+		if args[i] != p {
+			return false
+		}
+	}
+	return true
+}
+
+func noSuchContainer(name string) (string, error) {
+	return fmt.Sprintf("Error response from daemon: No such container: %s\n", name), fmt.Errorf("exit status 1")
+}
@@ -0,0 +1,132 @@
+package dockertest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestContainerLifecycle(t *testing.T) {
+	f := New()
+	id, err := f.Run("run", "-d", "--name", "web", "--label", "managed-by=packnplay", "-e", "A=1", "--user", "dev", "alpine", "sleep", "infinity")
+	if err != nil {
+		t.Fatalf("run error = %v", err)
+	}
+	id = strings.TrimSpace(id)
+
+	c := f.Container("web")
+	if c == nil || c.ID != id || !c.Running || c.Image != "alpine" || c.User != "dev" || c.Labels["managed-by"] != "packnplay" {
+		t.Fatalf("container = %+v", c)
+	}
+	if _, err := f.Run("run", "--name", "web", "alpine"); err == nil {
+		t.Error("run should fail when the name is in use")
+	}
+
+	if _, err := f.Run("stop", "web"); err != nil || c.Running {
+		t.Errorf("stop: running = %v, err = %v", c.Running, err)
+	}
+	if _, err := f.Run("exec", "web", "true"); err == nil {
+		t.Error("exec into a stopped container should fail")
+	}
+	if _, err := f.Run("start", id); err != nil || !c.Running {
+		t.Errorf("start: running = %v, err = %v", c.Running, err)
+	}
+	if _, err := f.Run("rm", "web"); err == nil {
+		t.Error("rm of a running container should fail without -f")
+	}
+	if _, err := f.Run("rm", "-f", "web"); err != nil || f.Container("web") != nil {
+		t.Errorf("rm -f: err = %v, containers = %v", err, f.Containers())
+	}
+}
+
+func TestInspectFormats(t *testing.T) {
+	f := New()
+	f.AddImage(Image{Name: "node:20", User: "node", Labels: map[string]string{"devcontainer.metadata": "[]"}})
+	f.AddContainer(Container{Name: "app", Image: "node:20", Running: true, Labels: map[string]string{"packnplay-project": "app"}})
+
+	out, err := f.Run("inspect", "--format", "{{.State.Running}} {{index .Config.Labels \"packnplay-project\"}}", "app")
+	if err != nil || out != "true app\n" {
+		t.Errorf("inspect = %q, %v", out, err)
+	}
+	out, err = f.Run("image", "inspect", "--format", "{{.Config.User}}/{{.Os}}", "docker.io/library/node:20")
+	if err != nil || out != "node/linux\n" {
+		t.Errorf("image inspect = %q, %v", out, err)
+	}
+	if _, err := f.Run("image", "inspect", "missing:1"); err == nil {
+		t.Error("inspecting a missing image should fail")
+	}
+	if _, err := f.Run("container", "inspect", "node:20"); err == nil {
+		t.Error("container inspect should not find images")
+	}
+}
+
+func TestPsFilters(t *testing.T) {
+	f := New()
+	a := f.AddContainer(Container{Name: "packnplay-a", Running: true, Labels: map[string]string{"managed-by": "packnplay"}})
+	f.AddContainer(Container{Name: "packnplay-b", Labels: map[string]string{"managed-by": "packnplay"}})
+	f.AddContainer(Container{Name: "other", Running: true})
+
+	out, _ := f.Run("ps", "-q", "--filter", "label=managed-by=packnplay")
+	if strings.TrimSpace(out) != a.ID[:12] {
+		t.Errorf("ps -q = %q, want only the running packnplay container", out)
+	}
+	out, _ = f.Run("ps", "-a", "--filter", "label=managed-by=packnplay", "--format", "{{.Names}} {{.Label \"managed-by\"}}")
+	if out != "packnplay-a packnplay\npacknplay-b packnplay\n" {
+		t.Errorf("ps -a = %q", out)
+	}
+	out, _ = f.Run("ps", "-a", "--filter", "name=other", "--filter", "status=running", "--format", "{{.Names}}")
+	if out != "other\n" {
+		t.Errorf("ps with name and status filters = %q", out)
+	}
+}
+
+func TestImageList(t *testing.T) {
+	f := New()
+	f.AddImage(Image{Name: "alpine:3.20"})
+	if _, err := f.Run("build", "--label", "managed-by=packnplay", "-t", "packnplay-app-devcontainer:latest", "-t", "packnplay-app-devcontainer:abc", "."); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _ := f.Run("image", "ls", "--filter", "reference=packnplay-*-devcontainer", "--format", "{{.Repository}}:{{.Tag}}")
+	if out != "packnplay-app-devcontainer:abc\npacknplay-app-devcontainer:latest\n" {
+		t.Errorf("image ls = %q, want both tags of the build", out)
+	}
+	latest, tagged := f.Image("packnplay-app-devcontainer:latest"), f.Image("packnplay-app-devcontainer:abc")
+	if latest.ID != tagged.ID || latest.Labels["managed-by"] != "packnplay" {
+		t.Errorf("built images = %+v, %+v; want one labeled image", latest, tagged)
+	}
+}
+
+func TestHandlersAndExec(t *testing.T) {
+	f := New()
+	f.AddContainer(Container{Name: "app", Running: true})
+	f.Exec = func(c *Container, command []string) (string, error) {
+		// Exec may call back into the fake
+		if _, err := f.Run("inspect", c.ID); err != nil {
+			return "", err
+		}
+		return c.Name + ": " + strings.Join(command, " "), nil
+	}
+	out, err := f.Run("exec", "-i", "-u", "root", "-w", "/work", "app", "echo", "hi")
+	if err != nil || out != "app: echo hi" {
+		t.Errorf("exec = %q, %v", out, err)
+	}
+
+	if err := f.RunWithProgress("node:20", "pull", "node:20"); err != nil || f.Image("node:20") == nil {
+		t.Errorf("RunWithProgress pull should add the image: %v", err)
+	}
+
+	boom := errors.New("exit status 1")
+	f.Fail(boom, "no space left on device\n", "pull")
+	if out, err := f.Run("pull", "alpine"); err != boom || !strings.Contains(out, "no space") {
+		t.Errorf("pull = %q, %v; want the registered failure", out, err)
+	}
+	f.On(func(args []string) (string, error) { return "overridden", nil }, "pull", "alpine")
+	if out, _ := f.Run("pull", "alpine"); out != "overridden" {
+		t.Errorf("later handlers should take precedence, got %q", out)
+	}
+
+	if calls := f.CallsTo("pull"); len(calls) != 3 {
+		t.Errorf("CallsTo(pull) = %v", calls)
+	}
+}
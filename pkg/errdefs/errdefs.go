@@ -0,0 +1,124 @@
+// Package errdefs defines the categories packnplay failures fall into and the
+// process exit codes they map to, so scripts can tell them apart.
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Category identifies the kind of failure
+type Category string
+
+const (
+	// CategoryGeneral is any failure not covered by a more specific category
+	CategoryGeneral Category = "general"
+	// CategoryUsage is an invalid command line (unknown flag, missing argument)
+	CategoryUsage Category = "usage"
+	// CategoryConfig is an invalid or unreadable packnplay config or devcontainer.json
+	CategoryConfig Category = "config"
+	// CategoryRuntimeUnavailable means no container runtime was found or its daemon is not running
+	CategoryRuntimeUnavailable Category = "runtime_unavailable"
+	// CategoryImagePull is a failed image pull (not found, access denied, network)
+	CategoryImagePull Category = "image_pull"
+	// CategoryImageBuild is a failed Dockerfile or feature build
+	CategoryImageBuild Category = "image_build"
+	// CategoryPolicy is an image, feature or devcontainer setting rejected by a policy
+	CategoryPolicy Category = "policy"
+	// CategoryContainer is a failure creating, starting or reconnecting to a container
+	CategoryContainer Category = "container"
+	// CategoryLifecycle is a failed lifecycle command (initializeCommand, postCreateCommand, ...)
+	CategoryLifecycle Category = "lifecycle"
+	// CategoryWorktree is a failure resolving or creating a git worktree
+	CategoryWorktree Category = "worktree"
+	// CategoryTimeout means the command was stopped because it ran past run --timeout
+	CategoryTimeout Category = "timeout"
+	// CategoryInterrupted means SIGINT or SIGTERM stopped a run before it handed over to the command
+	CategoryInterrupted Category = "interrupted"
+)
+
+// exitCodes maps categories to documented process exit codes. Codes stay out
+// of 125-127 so they never collide with docker's own run failures.
+var exitCodes = map[Category]int{
+	CategoryGeneral:            1,
+	CategoryUsage:              2,
+	CategoryConfig:             3,
+	CategoryRuntimeUnavailable: 4,
+	CategoryImagePull:          5,
+	CategoryImageBuild:         6,
+	CategoryPolicy:             7,
+	CategoryContainer:          8,
+	CategoryLifecycle:          9,
+	CategoryWorktree:           10,
+	CategoryTimeout:            124, // as with timeout(1)
+	CategoryInterrupted:        130, // as shells report SIGINT
+}
+
+// ExitCode returns the process exit code for the category
+func (c Category) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+	return exitCodes[CategoryGeneral]
+}
+
+// Error attaches a category to an underlying error without changing its message
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New tags err with a category. If err already carries a category, the more
+// specific inner one is kept and err is returned unchanged.
+func New(category Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) {
+		return err
+	}
+	return &Error{Category: category, Err: err}
+}
+
+// Errorf formats an error like fmt.Errorf and tags it with a category,
+// keeping any category already present on a %w-wrapped error
+func Errorf(category Category, format string, args ...interface{}) error {
+	return New(category, fmt.Errorf(format, args...))
+}
+
+// CategoryOf returns the category of err, or CategoryGeneral if it has none
+func CategoryOf(err error) Category {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Category
+	}
+	return CategoryGeneral
+}
+
+// ExitCode returns the process exit code for err (0 for nil)
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return CategoryOf(err).ExitCode()
+}
+
+// CategoryForExitCode returns the category a packnplay process exited with,
+// e.g. a `packnplay run` started by another command
+func CategoryForExitCode(code int) Category {
+	for category, c := range exitCodes {
+		if c == code {
+			return category
+		}
+	}
+	return CategoryGeneral
+}
@@ -0,0 +1,73 @@
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorf_KeepsMessageAndCategory(t *testing.T) {
+	base := errors.New("pull access denied")
+	err := Errorf(CategoryImagePull, "failed to pull image %s: %w", "ubuntu", base)
+
+	if err.Error() != "failed to pull image ubuntu: pull access denied" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if !errors.Is(err, base) {
+		t.Error("Errorf() should keep the wrapped error in the chain")
+	}
+	if got := CategoryOf(err); got != CategoryImagePull {
+		t.Errorf("CategoryOf() = %s, want %s", got, CategoryImagePull)
+	}
+	if got := ExitCode(err); got != 5 {
+		t.Errorf("ExitCode() = %d, want 5", got)
+	}
+}
+
+func TestNew_InnerCategoryWins(t *testing.T) {
+	inner := New(CategoryRuntimeUnavailable, errors.New("Cannot connect to the Docker daemon"))
+	outer := Errorf(CategoryImagePull, "failed to pull image: %w", inner)
+
+	if got := CategoryOf(fmt.Errorf("failed to ensure image: %w", outer)); got != CategoryRuntimeUnavailable {
+		t.Errorf("CategoryOf() = %s, want %s", got, CategoryRuntimeUnavailable)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, 0},
+		{"untyped", errors.New("boom"), 1},
+		{"usage", New(CategoryUsage, errors.New("bad flag")), 2},
+		{"lifecycle", New(CategoryLifecycle, errors.New("exit 1")), 9},
+		{"timeout", New(CategoryTimeout, errors.New("timed out")), 124},
+		{"interrupted", New(CategoryInterrupted, errors.New("interrupted")), 130},
+		{"unknown category", &Error{Category: "bogus", Err: errors.New("x")}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if New(CategoryConfig, nil) != nil {
+		t.Error("New(nil) should return nil")
+	}
+}
+
+func TestCategoryForExitCode(t *testing.T) {
+	for category, code := range exitCodes {
+		if got := CategoryForExitCode(code); got != category {
+			t.Errorf("CategoryForExitCode(%d) = %s, want %s", code, got, category)
+		}
+	}
+	if got := CategoryForExitCode(125); got != CategoryGeneral {
+		t.Errorf("CategoryForExitCode(125) = %s, want general", got)
+	}
+}
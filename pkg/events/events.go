@@ -0,0 +1,148 @@
+// Package events writes a run's progress as newline-delimited JSON, for
+// orchestrators that drive packnplay and need to follow it without scraping
+// its human-readable output.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/redact"
+)
+
+// EnvFD names the environment variable holding a file descriptor, inherited
+// from the orchestrator, to write events to
+const EnvFD = "PACKNPLAY_EVENTS_FD"
+
+// Event types
+const (
+	TypeRunStarted       = "run_started"       // Path
+	TypePhaseStarted     = "phase_started"     // Phase
+	TypePhaseFinished    = "phase_finished"    // Phase, Status, DurationMS, Error
+	TypeImageReady       = "image_ready"       // Phase (image_pull, image_build or feature_build), Image, Cached, DurationMS
+	TypeContainerCreated = "container_created" // Container, ContainerID, Image
+	TypeContainerReused  = "container_reused"  // Container, ContainerID, Status (running or restarted)
+	TypeLifecycle        = "lifecycle_command" // Command, Status, DurationMS, Error
+	TypeLifecycleTask    = "lifecycle_task"    // Command, Task, Status, DurationMS
+	TypeExecStarted      = "exec_started"      // Container, ContainerID, Args
+	TypeRunFailed        = "run_failed"        // Error, Category, ExitCode
+)
+
+// Pipeline phases reported by phase_started and phase_finished
+const (
+	PhaseResolve   = "resolve"   // workspace and devcontainer configuration
+	PhaseImage     = "image"     // pulling or building the image
+	PhaseCreate    = "create"    // starting and preparing a new container
+	PhaseLifecycle = "lifecycle" // onCreate through postAttach commands
+)
+
+// Statuses of phases and lifecycle commands
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// Event is one line of the stream. Fields that don't apply to a type are omitted.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Path        string    `json:"path,omitempty"`
+	Phase       string    `json:"phase,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	ContainerID string    `json:"container_id,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Cached      bool      `json:"cached,omitempty"`
+	Command     string    `json:"command,omitempty"` // lifecycle command type, e.g. postCreate
+	Task        string    `json:"task,omitempty"`    // task of an object-format lifecycle command
+	Args        []string  `json:"args,omitempty"`
+	DurationMS  int64     `json:"duration_ms,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Category    string    `json:"category,omitempty"`
+	ExitCode    int       `json:"exit_code,omitempty"`
+}
+
+// Emitter writes events. A nil Emitter writes nothing, so callers don't need
+// to check whether events were asked for.
+type Emitter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// New creates an Emitter writing to w
+func New(w io.Writer) *Emitter {
+	return &Emitter{w: w, now: time.Now}
+}
+
+// FromEnv returns an Emitter writing to the descriptor in EnvFD, or nil when
+// it isn't set. The descriptor is closed on exec so it isn't handed on to the
+// container runtime.
+func FromEnv() (*Emitter, error) {
+	value := os.Getenv(EnvFD)
+	if value == "" {
+		return nil, nil
+	}
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "%s must be a file descriptor number, got %q", EnvFD, value)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("events-fd-%d", fd))
+	if _, err := f.Stat(); err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "%s=%d is not an open file descriptor", EnvFD, fd)
+	}
+	syscall.CloseOnExec(fd)
+	return New(f), nil
+}
+
+// Emit writes an event, stamping its time. Write errors are ignored: events
+// must never break a run.
+func (e *Emitter) Emit(event Event) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.Time = e.now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = e.w.Write(append([]byte(redact.String(string(data))), '\n'))
+}
+
+// Phase reports that a phase started and returns a function reporting its
+// end, successful unless given an error
+func (e *Emitter) Phase(phase string) func(err error) {
+	if e == nil {
+		return func(error) {}
+	}
+	start := e.now()
+	e.Emit(Event{Type: TypePhaseStarted, Phase: phase})
+	return func(err error) {
+		event := Event{Type: TypePhaseFinished, Phase: phase, Status: StatusSucceeded, DurationMS: e.now().Sub(start).Milliseconds()}
+		if err != nil {
+			event.Status = StatusFailed
+			event.Error = err.Error()
+		}
+		e.Emit(event)
+	}
+}
+
+// Failed reports that the run failed, with the error's category and the exit
+// code packnplay will exit with
+func (e *Emitter) Failed(err error) {
+	if e == nil || err == nil {
+		return
+	}
+	category := errdefs.CategoryOf(err)
+	e.Emit(Event{Type: TypeRunFailed, Error: err.Error(), Category: string(category), ExitCode: errdefs.ExitCode(err)})
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+func decode(t *testing.T, data []byte) []Event {
+	t.Helper()
+	var got []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		got = append(got, event)
+	}
+	return got
+}
+
+func TestEmitterPhase(t *testing.T) {
+	var buf bytes.Buffer
+	e := New(&buf)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.now = func() time.Time { return now }
+
+	finish := e.Phase(PhaseImage)
+	now = now.Add(1500 * time.Millisecond)
+	finish(errors.New("pull failed"))
+
+	got := decode(t, buf.Bytes())
+	if len(got) != 2 || got[0].Type != TypePhaseStarted || got[0].Phase != PhaseImage {
+		t.Fatalf("events = %+v", got)
+	}
+	if got[1].Type != TypePhaseFinished || got[1].Status != StatusFailed || got[1].DurationMS != 1500 || got[1].Error != "pull failed" || !got[1].Time.Equal(now) {
+		t.Errorf("finished event = %+v", got[1])
+	}
+}
+
+func TestEmitterFailed(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf).Failed(errdefs.Errorf(errdefs.CategoryImagePull, "failed to pull image"))
+
+	got := decode(t, buf.Bytes())
+	if len(got) != 1 || got[0].Type != TypeRunFailed || got[0].Category != string(errdefs.CategoryImagePull) || got[0].ExitCode != errdefs.CategoryImagePull.ExitCode() {
+		t.Errorf("events = %+v", got)
+	}
+}
+
+func TestNilEmitter(t *testing.T) {
+	var e *Emitter
+	e.Emit(Event{Type: TypeRunStarted})
+	e.Phase(PhaseCreate)(nil)
+	e.Failed(errors.New("boom"))
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(EnvFD, "")
+	if e, err := FromEnv(); e != nil || err != nil {
+		t.Errorf("FromEnv() unset = %v, %v", e, err)
+	}
+
+	t.Setenv(EnvFD, "events")
+	if _, err := FromEnv(); errdefs.CategoryOf(err) != errdefs.CategoryUsage {
+		t.Errorf("FromEnv() error = %v, want a usage error", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close(); _ = w.Close() }()
+	// The emitter owns the descriptor it is given, so hand it a copy
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvFD, strconv.Itoa(fd))
+	e, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v", err)
+	}
+	e.Emit(Event{Type: TypeRunStarted, Path: "/src/app"})
+
+	var event Event
+	if err := json.NewDecoder(r).Decode(&event); err != nil || event.Type != TypeRunStarted || event.Path != "/src/app" {
+		t.Errorf("event = %+v, %v", event, err)
+	}
+}
@@ -0,0 +1,239 @@
+// Package ghtoken mints short-lived GitHub tokens limited to one repository,
+// through a GitHub App installed on it, so containers needn't be given the
+// host's broad gh token. Installation tokens last an hour; the expiry of each
+// repository's latest token is kept in a state file so the credential watcher
+// can mint a new one before it runs out.
+package ghtoken
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the GitHub.com REST API
+const DefaultAPIURL = "https://api.github.com"
+
+// DefaultPermissions are what an agent working on a repository needs: reading
+// and pushing code, and opening pull requests
+var DefaultPermissions = map[string]string{
+	"contents":      "write",
+	"pull_requests": "write",
+}
+
+// RefreshMargin is how long before expiry a token is replaced
+const RefreshMargin = 10 * time.Minute
+
+// App is a GitHub App that mints installation tokens
+type App struct {
+	ID         int64
+	PrivateKey *rsa.PrivateKey
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+// LoadApp reads a GitHub App's PEM private key
+func LoadApp(id int64, keyPath, apiURL string) (*App, error) {
+	if id == 0 || keyPath == "" {
+		return nil, fmt.Errorf("a GitHub App needs github.app_id and github.app_private_key")
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App private key %s is not PEM encoded", keyPath)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if pkcs8Err != nil || !ok {
+			return nil, fmt.Errorf("GitHub App private key %s is not an RSA key: %w", keyPath, err)
+		}
+		key = rsaKey
+	}
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &App{ID: id, PrivateKey: key, APIURL: strings.TrimSuffix(apiURL, "/"), HTTPClient: http.DefaultClient}, nil
+}
+
+// Token is an installation token and when it expires
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// jwt signs the short-lived JWT the App authenticates as
+func (a *App) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(), // allow for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(a.ID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Mint creates a token for the App's installation on owner/repo, limited to
+// that repository and the given permissions (DefaultPermissions when empty)
+func (a *App) Mint(owner, repo string, permissions map[string]string) (*Token, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := a.call("GET", fmt.Sprintf("/repos/%s/%s/installation", owner, repo), jwt, nil, &installation); err != nil {
+		return nil, fmt.Errorf("GitHub App %d is not installed on %s/%s: %w", a.ID, owner, repo, err)
+	}
+
+	if len(permissions) == 0 {
+		permissions = DefaultPermissions
+	}
+	request := map[string]interface{}{"repositories": []string{repo}, "permissions": permissions}
+	var token Token
+	if err := a.call("POST", fmt.Sprintf("/app/installations/%d/access_tokens", installation.ID), jwt, request, &token); err != nil {
+		return nil, fmt.Errorf("failed to create a token for %s/%s: %w", owner, repo, err)
+	}
+	if token.Token == "" {
+		return nil, fmt.Errorf("GitHub returned no token for %s/%s", owner, repo)
+	}
+	return &token, nil
+}
+
+// call makes an authenticated API request, decoding the JSON response into out
+func (a *App) call(method, path, jwt string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, a.APIURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s (HTTP %d)", apiErr.Message, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// remotePattern matches GitHub remotes: https://github.com/o/r(.git),
+// git@github.com:o/r(.git) and ssh://git@github.com/o/r(.git)
+var remotePattern = regexp.MustCompile(`^(?:https?://(?:[^@/]+@)?|ssh://(?:[^@/]+@)?|[^@/]+@)([^/:]+)[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+// ParseRemote returns the owner and repository of a git remote on host
+// (github.com, or a GitHub Enterprise Server host)
+func ParseRemote(remoteURL, host string) (owner, repo string, ok bool) {
+	match := remotePattern.FindStringSubmatch(strings.TrimSpace(remoteURL))
+	if match == nil || !strings.EqualFold(match[1], host) {
+		return "", "", false
+	}
+	return match[2], match[3], true
+}
+
+// APIHost is the git host an API URL serves: github.com for the public API,
+// otherwise the Enterprise Server host
+func APIHost(apiURL string) string {
+	if apiURL == "" || apiURL == DefaultAPIURL {
+		return "github.com"
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(apiURL, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	return host
+}
+
+// StatePath is the file recording when each repository's token expires
+func StatePath(runtimeDir string) string {
+	return filepath.Join(runtimeDir, "gh-tokens.json")
+}
+
+// LoadExpiries reads the expiry of each repository's latest token; tokens
+// themselves are never written to disk
+func LoadExpiries(path string) map[string]time.Time {
+	expiries := make(map[string]time.Time)
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &expiries)
+	}
+	return expiries
+}
+
+// SaveExpiries writes the expiry of each repository's latest token, renaming
+// a new file into place rather than writing through whatever is at path
+func SaveExpiries(path string, expiries map[string]time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(expiries)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gh-tokens-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
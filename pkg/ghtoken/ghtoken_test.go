@@ -0,0 +1,161 @@
+package ghtoken
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeKey generates an App private key, PKCS#1 encoded as GitHub issues them
+func writeKey(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "app.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+// verifyJWT checks an App JWT's signature and returns its claims
+func verifyJWT(t *testing.T, token string, key *rsa.PublicKey) map[string]interface{} {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT %q has %d parts", token, len(parts))
+	}
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("JWT signature: %v", err)
+	}
+	var claims map[string]interface{}
+	data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(data, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestMint(t *testing.T) {
+	keyPath, key := writeKey(t)
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var request map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := verifyJWT(t, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		if claims["iss"] != "1234" {
+			t.Errorf("iss = %v, want the App ID", claims["iss"])
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/acme/api/installation":
+			_, _ = w.Write([]byte(`{"id": 42}`))
+		case r.Method == "POST" && r.URL.Path == "/app/installations/42/access_tokens":
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": "ghs_scoped", "expires_at": expires})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	app, err := LoadApp(1234, keyPath, server.URL+"/")
+	if err != nil {
+		t.Fatalf("LoadApp() error = %v", err)
+	}
+	token, err := app.Mint("acme", "api", nil)
+	if err != nil {
+		t.Fatalf("Mint() error = %v", err)
+	}
+	if token.Token != "ghs_scoped" || !token.ExpiresAt.Equal(expires) {
+		t.Errorf("token = %+v", token)
+	}
+	want := map[string]interface{}{
+		"repositories": []interface{}{"api"},
+		"permissions":  map[string]interface{}{"contents": "write", "pull_requests": "write"},
+	}
+	if !reflect.DeepEqual(request, want) {
+		t.Errorf("token request = %v, want %v", request, want)
+	}
+
+	if _, err := app.Mint("acme", "other", nil); err == nil || !strings.Contains(err.Error(), "not installed on acme/other: Not Found (HTTP 404)") {
+		t.Errorf("Mint() error = %v, want the App not installed", err)
+	}
+}
+
+func TestLoadAppErrors(t *testing.T) {
+	if _, err := LoadApp(0, "key.pem", ""); err == nil {
+		t.Error("LoadApp() without an App ID should fail")
+	}
+	notPEM := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadApp(1, notPEM, ""); err == nil || !strings.Contains(err.Error(), "not PEM encoded") {
+		t.Errorf("LoadApp() error = %v", err)
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote, host, owner, repo string
+		ok                        bool
+	}{
+		{"https://github.com/obra/packnplay.git", "github.com", "obra", "packnplay", true},
+		{"https://github.com/obra/packnplay", "github.com", "obra", "packnplay", true},
+		{"git@github.com:obra/packnplay.git", "github.com", "obra", "packnplay", true},
+		{"ssh://git@github.com/obra/packnplay", "github.com", "obra", "packnplay", true},
+		{"https://x-access-token@github.com/obra/packnplay.git", "github.com", "obra", "packnplay", true},
+		{"git@github.example.com:team/svc.git", "github.example.com", "team", "svc", true},
+		{"git@gitlab.com:obra/packnplay.git", "github.com", "", "", false},
+		{"/srv/git/packnplay.git", "github.com", "", "", false},
+	}
+	for _, tt := range tests {
+		owner, repo, ok := ParseRemote(tt.remote, tt.host)
+		if owner != tt.owner || repo != tt.repo || ok != tt.ok {
+			t.Errorf("ParseRemote(%q) = %q, %q, %v", tt.remote, owner, repo, ok)
+		}
+	}
+
+	if got := APIHost(""); got != "github.com" {
+		t.Errorf("APIHost() = %q", got)
+	}
+	if got := APIHost("https://github.example.com/api/v3"); got != "github.example.com" {
+		t.Errorf("APIHost() = %q", got)
+	}
+}
+
+func TestExpiries(t *testing.T) {
+	path := StatePath(filepath.Join(t.TempDir(), "runtime"))
+	if got := LoadExpiries(path); len(got) != 0 {
+		t.Errorf("LoadExpiries() = %v without a state file", got)
+	}
+	expires := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if err := SaveExpiries(path, map[string]time.Time{"acme/api": expires}); err != nil {
+		t.Fatal(err)
+	}
+	if got := LoadExpiries(path); !got["acme/api"].Equal(expires) {
+		t.Errorf("LoadExpiries() = %v", got)
+	}
+	if data, _ := os.ReadFile(path); strings.Contains(string(data), "ghs_") {
+		t.Error("tokens should never be written")
+	}
+}
@@ -0,0 +1,63 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/redact"
+)
+
+// SparseFetch checks out only paths (gitignore-style patterns) of ref in the
+// repository at url into dir, creating it on first use and moving it to the
+// ref's latest commit on later ones. Only the commit itself is fetched, so a
+// project's devcontainer.json can be read without cloning the repository. An
+// empty ref is the remote's default branch.
+func SparseFetch(dir, url, ref string, paths []string, verbose bool) error {
+	if !IsGitRepo(dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := runGit(dir, verbose, "init", "--quiet"); err != nil {
+			return err
+		}
+		if err := runGit(dir, verbose, "remote", "add", "origin", url); err != nil {
+			return err
+		}
+		if err := runGit(dir, verbose, "config", "core.sparseCheckout", "true"); err != nil {
+			return err
+		}
+		sparseFile := filepath.Join(dir, ".git", "info", "sparse-checkout")
+		if err := os.MkdirAll(filepath.Dir(sparseFile), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(sparseFile, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+	} else if err := runGit(dir, verbose, "remote", "set-url", "origin", url); err != nil {
+		return err
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := runGit(dir, verbose, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return fmt.Errorf("failed to fetch %s of %s: %w", ref, url, err)
+	}
+	return runGit(dir, verbose, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD")
+}
+
+// runGit runs git in dir, failing without waiting on a credential prompt
+func runGit(dir string, verbose bool, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if verbose {
+		fmt.Fprintf(os.Stderr, "+ git %s\n", strings.Join(redact.Args(args), " "))
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(redact.String(string(output))))
+	}
+	return nil
+}
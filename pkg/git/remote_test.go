@@ -0,0 +1,65 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSparseFetch(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	for name, content := range map[string]string{
+		".devcontainer/devcontainer.json": `{"image": "alpine:3.20"}`,
+		".devcontainer/Dockerfile":        "FROM alpine:3.20\n",
+		"src/main.go":                     "package main\n",
+	} {
+		path := filepath.Join(origin, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitRun(t, origin, "init", "-q", "-b", "main")
+	gitRun(t, origin, "add", ".")
+	gitRun(t, origin, "commit", "-q", "-m", "initial")
+	gitRun(t, origin, "checkout", "-q", "-b", "fix/x")
+	if err := os.WriteFile(filepath.Join(origin, ".devcontainer", "devcontainer.json"), []byte(`{"image": "alpine:3.21"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, origin, "commit", "-q", "-am", "bump")
+	gitRun(t, origin, "checkout", "-q", "main")
+
+	dir := filepath.Join(t.TempDir(), "checkout")
+	paths := []string{"/.devcontainer/", "/.devcontainer.json"}
+	if err := SparseFetch(dir, "file://"+origin, "", paths, false); err != nil {
+		t.Fatalf("SparseFetch() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, ".devcontainer", "devcontainer.json")); string(got) != `{"image": "alpine:3.20"}` {
+		t.Errorf("devcontainer.json = %q, want the default branch's", got)
+	}
+	if !fileExists(filepath.Join(dir, ".devcontainer", "Dockerfile")) {
+		t.Error("the rest of .devcontainer should be checked out")
+	}
+	if fileExists(filepath.Join(dir, "src", "main.go")) {
+		t.Error("files outside the sparse paths should not be checked out")
+	}
+
+	// Fetching again moves the checkout to another branch
+	if err := SparseFetch(dir, "file://"+origin, "fix/x", paths, false); err != nil {
+		t.Fatalf("SparseFetch() of a branch error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, ".devcontainer", "devcontainer.json")); string(got) != `{"image": "alpine:3.21"}` {
+		t.Errorf("devcontainer.json = %q, want fix/x's", got)
+	}
+
+	if err := SparseFetch(dir, "file://"+origin, "no-such-branch", paths, false); err == nil {
+		t.Error("SparseFetch() of a missing branch should fail")
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
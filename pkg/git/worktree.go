@@ -5,7 +5,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/obra/packnplay/pkg/redact"
 )
 
 // DetermineWorktreePath calculates the path for a worktree
@@ -62,9 +65,29 @@ func GetCurrentBranch(path string) (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
-// WorktreeExists checks if a worktree with the given name exists
-func WorktreeExists(worktreeName string) (bool, error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+// GetRepoRoot returns the top-level directory of the working tree path is in
+func GetRepoRoot(path string) (string, error) {
+	cmd := exec.Command("git", "-C", path, "rev-parse", "--show-toplevel")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// GetRemoteURL returns the URL of the named remote
+func GetRemoteURL(path, remote string) (string, error) {
+	cmd := exec.Command("git", "-C", path, "remote", "get-url", remote)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// WorktreeExists checks if the repository at repoPath has a worktree with the given name
+func WorktreeExists(repoPath, worktreeName string) (bool, error) {
+	cmd := exec.Command("git", "-C", repoPath, "worktree", "list", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
 		return false, err
@@ -83,9 +106,9 @@ func WorktreeExists(worktreeName string) (bool, error) {
 	return false, nil
 }
 
-// GetWorktreePath gets the actual path of an existing worktree
-func GetWorktreePath(worktreeName string) (string, error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+// GetWorktreePath gets the actual path of an existing worktree of the repository at repoPath
+func GetWorktreePath(repoPath, worktreeName string) (string, error) {
+	cmd := exec.Command("git", "-C", repoPath, "worktree", "list", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", err
@@ -112,31 +135,94 @@ func GetWorktreePath(worktreeName string) (string, error) {
 	return "", fmt.Errorf("worktree '%s' not found", worktreeName)
 }
 
-// CreateWorktree creates a new worktree
-func CreateWorktree(path, branchName string, verbose bool) error {
-	// Check if branch already exists
-	checkCmd := exec.Command("git", "show-ref", "--verify", "--quiet", fmt.Sprintf("refs/heads/%s", branchName))
-	branchExists := checkCmd.Run() == nil
+// WorktreeOptions controls how CreateWorktree creates a branch that doesn't
+// exist yet
+type WorktreeOptions struct {
+	From  string // start point, e.g. origin/main; empty for HEAD
+	Track bool   // without From, check out <remote>/<branch> with tracking when a remote has the branch
+}
 
-	var cmd *exec.Cmd
-	if branchExists {
+// CreateWorktree creates a worktree of the repository at repoPath, checking
+// out branchName or creating it
+func CreateWorktree(repoPath, path, branchName string, opts WorktreeOptions, verbose bool) error {
+	args := []string{"worktree", "add"}
+	if BranchExists(repoPath, branchName) {
 		// Branch exists, check it out in the worktree
-		cmd = exec.Command("git", "worktree", "add", path, branchName)
-		if verbose {
-			fmt.Fprintf(os.Stderr, "+ git worktree add %s %s\n", path, branchName)
+		args = append(args, path, branchName)
+	} else if opts.From != "" {
+		if !refExists(repoPath, opts.From) {
+			return fmt.Errorf("base ref %q not found (fetch it first, e.g. git fetch origin)", opts.From)
 		}
+		// A branch started from origin/main mustn't push to main
+		args = append(args, "--no-track", "-b", branchName, path, opts.From)
+	} else if remoteBranch := findRemoteBranch(repoPath, branchName); opts.Track && remoteBranch != "" {
+		// Continue the remote's branch rather than forking it from HEAD
+		args = append(args, "--track", "-b", branchName, path, remoteBranch)
 	} else {
 		// Branch doesn't exist, create it
-		cmd = exec.Command("git", "worktree", "add", path, "-b", branchName)
-		if verbose {
-			fmt.Fprintf(os.Stderr, "+ git worktree add %s -b %s\n", path, branchName)
-		}
+		args = append(args, "-b", branchName, path)
 	}
 
+	cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
 	if verbose {
+		fmt.Fprintf(os.Stderr, "+ git %s\n", strings.Join(redact.Args(args), " "))
 		cmd.Stdout = os.Stderr
 		cmd.Stderr = os.Stderr
+		return cmd.Run()
 	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// BranchExists reports whether the repository at repoPath has a local branch
+func BranchExists(repoPath, branchName string) bool {
+	return exec.Command("git", "-C", repoPath, "show-ref", "--verify", "--quiet", "refs/heads/"+branchName).Run() == nil
+}
+
+// refExists reports whether ref names a commit
+func refExists(repoPath, ref string) bool {
+	return exec.Command("git", "-C", repoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() == nil
+}
+
+// findRemoteBranch returns the remote-tracking branch (e.g. origin/feature)
+// of branchName, preferring origin, or "" if no remote has it
+func findRemoteBranch(repoPath, branchName string) string {
+	output, err := exec.Command("git", "-C", repoPath, "remote").Output()
+	if err != nil {
+		return ""
+	}
+	remotes := strings.Fields(string(output))
+	sort.SliceStable(remotes, func(i, j int) bool { return remotes[i] == "origin" && remotes[j] != "origin" })
+	for _, remote := range remotes {
+		ref := remote + "/" + branchName
+		if exec.Command("git", "-C", repoPath, "show-ref", "--verify", "--quiet", "refs/remotes/"+ref).Run() == nil {
+			return ref
+		}
+	}
+	return ""
+}
 
-	return cmd.Run()
+// ExpandWorktreePath returns the worktree path a template such as
+// ../{project}-worktrees/{branch} gives: {project} is the project directory's
+// name and {branch} the filesystem-safe branch name. A relative path is
+// relative to the project, and ~ is the home directory.
+func ExpandWorktreePath(template, projectPath, worktreeName string) (string, error) {
+	if !strings.Contains(template, "{branch}") {
+		return "", fmt.Errorf("worktree path template %q must contain {branch}", template)
+	}
+	path := strings.NewReplacer("{project}", filepath.Base(projectPath), "{branch}", sanitizeBranchName(worktreeName)).Replace(template)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to expand %s: %w", template, err)
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectPath, path)
+	}
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
+	return filepath.Clean(path), nil
 }
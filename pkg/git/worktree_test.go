@@ -1,6 +1,10 @@
 package git
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -38,6 +42,81 @@ func TestDetermineWorktreePath(t *testing.T) {
 	}
 }
 
+func TestExpandWorktreePath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	project := filepath.Join(t.TempDir(), "myproject")
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"../{project}-worktrees/{branch}", filepath.Join(filepath.Dir(project), "myproject-worktrees", "feature-auth")},
+		{"/srv/wt/{project}/{branch}", "/srv/wt/myproject/feature-auth"},
+		{"~/worktrees/{branch}", filepath.Join(home, "worktrees", "feature-auth")},
+	}
+	for _, tt := range tests {
+		got, err := ExpandWorktreePath(tt.template, project, "feature/auth")
+		if err != nil || got != tt.want {
+			t.Errorf("ExpandWorktreePath(%q) = %q, %v; want %q", tt.template, got, err, tt.want)
+		}
+	}
+	if _, err := ExpandWorktreePath("../{project}-worktree", project, "main"); err == nil {
+		t.Error("ExpandWorktreePath() should require {branch}")
+	}
+}
+
+// gitRun runs git in dir, skipping the test if git is unavailable
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Skipf("git %v failed: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestCreateWorktree(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	if err := os.MkdirAll(origin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, origin, "init", "-q", "-b", "main")
+	gitRun(t, origin, "commit", "-q", "--allow-empty", "-m", "initial")
+	gitRun(t, origin, "branch", "shared")
+	gitRun(t, origin, "checkout", "-q", "shared")
+	gitRun(t, origin, "commit", "-q", "--allow-empty", "-m", "shared work")
+	gitRun(t, origin, "checkout", "-q", "main")
+	repo := filepath.Join(t.TempDir(), "repo")
+	gitRun(t, filepath.Dir(repo), "clone", "-q", origin, repo)
+	worktrees := t.TempDir()
+
+	// A branch the remote has is continued, tracking it
+	if err := CreateWorktree(repo, filepath.Join(worktrees, "shared"), "shared", WorktreeOptions{Track: true}, false); err != nil {
+		t.Fatalf("CreateWorktree(shared) error = %v", err)
+	}
+	if upstream := gitRun(t, repo, "rev-parse", "--abbrev-ref", "shared@{upstream}"); upstream != "origin/shared" {
+		t.Errorf("shared upstream = %q, want origin/shared", upstream)
+	}
+
+	// A new branch starts from the base without tracking it
+	if err := CreateWorktree(repo, filepath.Join(worktrees, "feature-new"), "feature/new", WorktreeOptions{From: "origin/shared", Track: true}, false); err != nil {
+		t.Fatalf("CreateWorktree(feature/new) error = %v", err)
+	}
+	if got, want := gitRun(t, repo, "rev-parse", "feature/new"), gitRun(t, repo, "rev-parse", "origin/shared"); got != want {
+		t.Errorf("feature/new = %s, want it started from origin/shared (%s)", got, want)
+	}
+	if output, err := exec.Command("git", "-C", repo, "rev-parse", "--abbrev-ref", "feature/new@{upstream}").CombinedOutput(); err == nil {
+		t.Errorf("feature/new should have no upstream, has %s", output)
+	}
+	if exists, err := WorktreeExists(repo, "feature/new"); err != nil || !exists {
+		t.Errorf("WorktreeExists(feature/new) = %v, %v", exists, err)
+	}
+
+	if err := CreateWorktree(repo, filepath.Join(worktrees, "other"), "other", WorktreeOptions{From: "origin/missing"}, false); err == nil || !strings.Contains(err.Error(), "origin/missing") {
+		t.Errorf("CreateWorktree() with a missing base = %v, want an error naming it", err)
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) &&
 		(s == substr || len(s) > len(substr) &&
@@ -0,0 +1,107 @@
+// Package hooks runs user-defined host commands at points in a container's
+// lifecycle. Each command gets a JSON description of the container on stdin.
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Hook points
+const (
+	PreCreate  = "pre-create"  // before the container is created; failure aborts the run
+	PostCreate = "post-create" // after the container is created and its lifecycle commands ran
+	PreAttach  = "pre-attach"  // before an interactive session is attached; failure aborts the attach
+	PostStop   = "post-stop"   // after the container is stopped and removed
+)
+
+// Names lists the valid hook points
+var Names = []string{PreCreate, PostCreate, PreAttach, PostStop}
+
+// Hooks maps hook points to host shell commands, run in order
+type Hooks map[string][]string
+
+// Payload describes the container a hook runs for; it is written to the hook's stdin as JSON
+type Payload struct {
+	Hook        string `json:"hook"`
+	Container   string `json:"container"`
+	ContainerID string `json:"container_id,omitempty"` // empty before the container exists
+	Image       string `json:"image,omitempty"`
+	Project     string `json:"project,omitempty"`
+	Worktree    string `json:"worktree,omitempty"`
+	HostPath    string `json:"host_path,omitempty"` // project directory mounted into the container
+	Runtime     string `json:"runtime,omitempty"`   // docker, podman, or container
+}
+
+// Validate reports hook points that don't exist
+func (h Hooks) Validate() error {
+	var unknown []string
+	for name := range h {
+		if !isName(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown hook %s (valid hooks: %s)", strings.Join(unknown, ", "), strings.Join(Names, ", "))
+	}
+	return nil
+}
+
+// Merge combines hooks, running each set's commands after those of the sets before it
+func Merge(sets ...Hooks) Hooks {
+	merged := make(Hooks)
+	for _, set := range sets {
+		for name, commands := range set {
+			merged[name] = append(merged[name], commands...)
+		}
+	}
+	return merged
+}
+
+// Run runs the commands for hook with sh -c, stopping at the first failure.
+// Output goes to stderr so it doesn't mix with packnplay's own stdout.
+func (h Hooks) Run(hook string, payload Payload, verbose bool) error {
+	commands := h[hook]
+	if len(commands) == 0 {
+		return nil
+	}
+
+	payload.Hook = hook
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s hook payload: %w", hook, err)
+	}
+
+	for _, command := range commands {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Running %s hook: %s\n", hook, command)
+		}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "PACKNPLAY_HOOK="+hook, "PACKNPLAY_CONTAINER="+payload.Container)
+		if payload.HostPath != "" {
+			cmd.Dir = payload.HostPath
+		}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", hook, command, err)
+		}
+	}
+	return nil
+}
+
+func isName(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if err := (Hooks{PreCreate: {"true"}, PostStop: {"true"}}).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	err := (Hooks{"post-start": {"true"}, PreAttach: {"true"}}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "post-start") {
+		t.Errorf("Validate() error = %v, want unknown post-start", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	global := Hooks{PreCreate: {"global"}}
+	project := Hooks{PreCreate: {"project"}, PostStop: {"cleanup"}}
+
+	merged := Merge(global, project)
+	if got := strings.Join(merged[PreCreate], ","); got != "global,project" {
+		t.Errorf("pre-create = %q, want global,project", got)
+	}
+	if got := strings.Join(merged[PostStop], ","); got != "cleanup" {
+		t.Errorf("post-stop = %q, want cleanup", got)
+	}
+	if len(global[PreCreate]) != 1 {
+		t.Error("Merge() modified its input")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "payload.json")
+	h := Hooks{PostCreate: {
+		`cat > "` + out + `"`,
+		`test "$PACKNPLAY_HOOK" = post-create && test "$PACKNPLAY_CONTAINER" = packnplay-demo-main && test "$PWD" = "` + dir + `"`,
+	}}
+
+	payload := Payload{Container: "packnplay-demo-main", ContainerID: "abc123", Project: "demo", HostPath: dir}
+	if err := h.Run(PostCreate, payload, false); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Payload
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("hook stdin is not JSON: %v", err)
+	}
+	if got.Hook != PostCreate || got.ContainerID != "abc123" || got.Project != "demo" {
+		t.Errorf("payload = %+v", got)
+	}
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "ran")
+	h := Hooks{PreCreate: {"exit 3", "touch " + marker}}
+
+	err := h.Run(PreCreate, Payload{Container: "c"}, false)
+	if err == nil || !strings.Contains(err.Error(), "pre-create hook") {
+		t.Fatalf("Run() error = %v, want pre-create failure", err)
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Error("commands after a failure should not run")
+	}
+	if err := h.Run(PostStop, Payload{Container: "c"}, false); err != nil {
+		t.Errorf("Run() with no commands error = %v", err)
+	}
+}
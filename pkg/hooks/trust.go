@@ -0,0 +1,82 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Project hooks come from a repository's devcontainer.json, which anyone who
+// can write to the repository (including an agent in its container) can change,
+// so they only run once the user has trusted them. Trust is recorded on the
+// host per project directory, against a hash of the hooks: editing them
+// revokes it.
+
+// trustFile returns $XDG_DATA_HOME/packnplay/trusted-hooks.json
+func trustFile() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataHome, "packnplay", "trusted-hooks.json"), nil
+}
+
+// Hash fingerprints hooks, so trust granted to them ends when they change
+func (h Hooks) Hash() string {
+	data, _ := json.Marshal(h) // map keys are sorted, so equal hooks hash alike
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func loadTrusted() (map[string]string, string, error) {
+	path, err := trustFile()
+	if err != nil {
+		return nil, "", err
+	}
+	trusted := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trusted, path, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read trusted hooks: %w", err)
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return trusted, path, nil
+}
+
+// Trusted reports whether the user trusted exactly these hooks for the project
+// directory projectDir
+func Trusted(projectDir string, h Hooks) bool {
+	trusted, _, err := loadTrusted()
+	return err == nil && trusted[projectDir] == h.Hash()
+}
+
+// Trust records the user's trust in the project directory's hooks as they are now
+func Trust(projectDir string, h Hooks) error {
+	trusted, path, err := loadTrusted()
+	if err != nil {
+		return err
+	}
+	trusted[projectDir] = h.Hash()
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trusted hooks: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to record trusted hooks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+// Package hostbridge lets processes inside a container ask the host to open
+// URLs, launch an editor, or copy text to the clipboard. Requests travel over a
+// unix socket bind-mounted into the container and are checked against an
+// allowlist of actions.
+package hostbridge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/obra/packnplay/pkg/redact"
+)
+
+const (
+	// Label marks containers created with the host bridge enabled
+	Label = "packnplay-host-bridge"
+	// WorkspaceLabel records the host path of the workspace mounted in the
+	// container, the only place the code action opens
+	WorkspaceLabel = "packnplay-host-bridge-workspace"
+	// ContainerDir is where the socket directory is mounted in the container
+	ContainerDir = "/run/packnplay-bridge"
+	// SocketName is the socket file name inside the bridge directory
+	SocketName = "host.sock"
+	// ShimPath is where the request shim is installed in the container
+	ShimPath = "/usr/local/bin/packnplay-host-open"
+	// DefaultClipboardMaxBytes limits a clipboard copy when none is configured
+	DefaultClipboardMaxBytes = 1 << 20
+)
+
+// Actions understood by the bridge
+const (
+	ActionOpen      = "open"      // open an http(s)/mailto URL in the host browser
+	ActionCode      = "code"      // open host paths in VS Code
+	ActionClipboard = "clipboard" // copy stdin to the host clipboard
+)
+
+// ClipboardShimNames are the clipboard tools the shim stands in for
+var ClipboardShimNames = []string{"pbcopy", "xclip", "xsel", "wl-copy"}
+
+// DefaultActions are allowed when no explicit allowlist is configured
+var DefaultActions = []string{ActionOpen}
+
+// ShimScript forwards its arguments to the host bridge. Invoked as `code` it
+// requests the code action, as a clipboard tool (pbcopy, xclip, xsel,
+// wl-copy, packnplay-clipboard) it sends stdin to the clipboard action, and
+// under any other name (packnplay-host-open, xdg-open, $BROWSER) it requests
+// open.
+const ShimScript = `#!/bin/sh
+# packnplay host bridge shim
+sock="${PACKNPLAY_HOST_BRIDGE:-/run/packnplay-bridge/host.sock}"
+name="$(basename "$0")"
+case "$name" in
+  code) action=code ;;
+  pbcopy|xclip|xsel|wl-copy|packnplay-clipboard) action=clipboard ;;
+  *) action=open ;;
+esac
+if ! command -v curl >/dev/null 2>&1; then
+  echo "packnplay-host-open: curl is required to reach the host bridge" >&2
+  exit 1
+fi
+if [ ! -S "$sock" ]; then
+  echo "packnplay-host-open: host bridge is not running ($sock)" >&2
+  exit 1
+fi
+if [ "$action" = clipboard ]; then
+  for a in "$@"; do
+    case "$a" in
+      -o|-out|--output) echo "$name: only copying to the host clipboard is supported" >&2; exit 1 ;;
+    esac
+  done
+  exec curl -fsS -X POST --unix-socket "$sock" -H "Content-Type: application/octet-stream" --data-binary @- "http://packnplay/$action"
+fi
+n=$#
+for a in "$@"; do set -- "$@" --data-urlencode "arg=$a"; done
+shift $n
+exec curl -fsS -X POST --unix-socket "$sock" "$@" "http://packnplay/$action"
+`
+
+// ContainerSocket returns the socket path as seen from inside the container
+func ContainerSocket() string {
+	return ContainerDir + "/" + SocketName
+}
+
+// SocketDir returns the host directory holding the bridge socket for a
+// container. Its parent is private to the user (see StartDaemon), since the
+// socket itself is open to any UID.
+func SocketDir(containerName string) (string, error) {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		dataHome := os.Getenv("XDG_DATA_HOME")
+		if dataHome == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("failed to get home directory: %w", err)
+			}
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		base = dataHome
+	}
+	return filepath.Join(base, "packnplay", "bridge", containerName), nil
+}
+
+// makeSocketDir creates the container's socket directory below a parent only
+// the user can enter (without XDG_RUNTIME_DIR, it's in the world-readable
+// ~/.local/share). The container mounts its own directory, world-traversable
+// so a container user with a different UID can reach the socket.
+func makeSocketDir(containerName string) (string, error) {
+	dir, err := SocketDir(containerName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return "", fmt.Errorf("failed to create bridge directory: %w", err)
+	}
+	// Directories created before it was private keep their old mode otherwise
+	if err := os.Chmod(filepath.Dir(dir), 0700); err != nil {
+		return "", fmt.Errorf("failed to restrict bridge directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create bridge directory: %w", err)
+	}
+	return dir, nil
+}
+
+// Running reports whether a bridge daemon is listening on socketPath
+func Running(socketPath string) bool {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// StartDaemon launches a detached `packnplay host-bridge` process for the
+// container unless one is already serving its socket. workspace is the host
+// path of the container's workspace mount, or "" when it has none.
+func StartDaemon(containerName string, actions []string, workspace string) error {
+	dir, err := makeSocketDir(containerName)
+	if err != nil {
+		return err
+	}
+	if Running(filepath.Join(dir, SocketName)) {
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate packnplay executable: %w", err)
+	}
+
+	logFile, err := os.OpenFile(filepath.Join(dir, "bridge.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open bridge log: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+
+	cmd := exec.Command(exe, "host-bridge", "--container", containerName, "--actions", strings.Join(actions, ","), "--workspace", workspace)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start host bridge: %w", err)
+	}
+	return cmd.Process.Release()
+}
+
+// Server handles bridge requests
+type Server struct {
+	actions      map[string]bool
+	workspace    string // host path the code action is confined to
+	start        func(name string, args ...string) error
+	copy         func(name string, args []string, data []byte) error
+	lookPath     func(file string) (string, error)
+	getenv       func(key string) string
+	goos         string
+	clipboardMax int64
+}
+
+// NewServer creates a Server allowing only the given actions
+func NewServer(actions []string) *Server {
+	allowed := make(map[string]bool)
+	for _, action := range actions {
+		allowed[strings.TrimSpace(action)] = true
+	}
+	return &Server{
+		actions: allowed,
+		start: func(name string, args ...string) error {
+			cmd := exec.Command(name, args...)
+			if err := cmd.Start(); err != nil {
+				return err
+			}
+			go func() { _ = cmd.Wait() }()
+			return nil
+		},
+		copy: func(name string, args []string, data []byte) error {
+			cmd := exec.Command(name, args...)
+			cmd.Stdin = bytes.NewReader(data)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+			}
+			return nil
+		},
+		lookPath:     exec.LookPath,
+		getenv:       os.Getenv,
+		goos:         runtime.GOOS,
+		clipboardMax: DefaultClipboardMaxBytes,
+	}
+}
+
+// SetClipboardLimit sets the largest clipboard copy accepted, in bytes.
+// Zero or less restores the default.
+func (s *Server) SetClipboardLimit(maxBytes int64) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultClipboardMaxBytes
+	}
+	s.clipboardMax = maxBytes
+}
+
+// SetWorkspace confines the code action to paths in the host directory dir,
+// the container's workspace. Without one, code opens nothing.
+func (s *Server) SetWorkspace(dir string) {
+	s.workspace = dir
+}
+
+// ServeHTTP executes an allowed action: POST /<action> with repeated "arg" form values
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := strings.TrimPrefix(r.URL.Path, "/")
+	if action == ActionClipboard {
+		s.serveClipboard(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	name, args, err := s.command(action, r.PostForm["arg"])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rejected %s %q: %v\n", action, r.PostForm["arg"], err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if err := s.start(name, args...); err != nil {
+		http.Error(w, fmt.Sprintf("failed to run %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", name, strings.Join(redact.Args(args), " "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveClipboard copies the request body to the host clipboard
+func (s *Server) serveClipboard(w http.ResponseWriter, r *http.Request) {
+	if !s.actions[ActionClipboard] {
+		fmt.Fprintf(os.Stderr, "rejected clipboard copy: action is not allowed\n")
+		http.Error(w, fmt.Sprintf("action %q is not allowed", ActionClipboard), http.StatusForbidden)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.clipboardMax))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			fmt.Fprintf(os.Stderr, "rejected clipboard copy over %d bytes\n", s.clipboardMax)
+			http.Error(w, fmt.Sprintf("clipboard copies are limited to %d bytes", s.clipboardMax), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	name, args, err := s.clipboardCommand()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.copy(name, args, data); err != nil {
+		http.Error(w, fmt.Sprintf("failed to run %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "copied %d bytes to the clipboard with %s\n", len(data), name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clipboardCommand returns the host command that copies stdin to the clipboard
+func (s *Server) clipboardCommand() (string, []string, error) {
+	if s.goos == "darwin" {
+		return "pbcopy", nil, nil
+	}
+	candidates := []struct {
+		name string
+		args []string
+		env  string // display the tool needs
+	}{
+		{"wl-copy", nil, "WAYLAND_DISPLAY"},
+		{"xclip", []string{"-selection", "clipboard"}, "DISPLAY"},
+		{"xsel", []string{"--clipboard", "--input"}, "DISPLAY"},
+	}
+	for _, c := range candidates {
+		if s.getenv(c.env) == "" {
+			continue
+		}
+		if _, err := s.lookPath(c.name); err == nil {
+			return c.name, c.args, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no host clipboard tool found (install wl-clipboard, xclip, or xsel)")
+}
+
+// codeFlags are the VS Code flags a container may pass through
+var codeFlags = map[string]bool{
+	"-g": true, "--goto": true,
+	"-r": true, "--reuse-window": true,
+	"-n": true, "--new-window": true,
+}
+
+// lineSuffix matches the :line[:column] suffix accepted by code --goto
+var lineSuffix = regexp.MustCompile(`(:\d+){1,2}$`)
+
+// command validates a request and maps it to the host command to run
+func (s *Server) command(action string, args []string) (string, []string, error) {
+	if !s.actions[action] {
+		return "", nil, fmt.Errorf("action %q is not allowed", action)
+	}
+
+	switch action {
+	case ActionOpen:
+		if len(args) != 1 {
+			return "", nil, fmt.Errorf("open takes exactly one URL")
+		}
+		u, err := url.Parse(args[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto") {
+			return "", nil, fmt.Errorf("only http, https, and mailto URLs can be opened")
+		}
+		if s.goos == "darwin" {
+			return "open", []string{args[0]}, nil
+		}
+		return "xdg-open", []string{args[0]}, nil
+
+	case ActionCode:
+		var paths int
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") {
+				if !codeFlags[arg] {
+					return "", nil, fmt.Errorf("code flag %q is not allowed", arg)
+				}
+				continue
+			}
+			// packnplay mounts projects at their host path, so container paths are host paths
+			path := lineSuffix.ReplaceAllString(arg, "")
+			if !filepath.IsAbs(path) {
+				return "", nil, fmt.Errorf("code paths must be absolute: %s", arg)
+			}
+			if _, err := os.Stat(path); err != nil {
+				return "", nil, fmt.Errorf("path does not exist on host: %s", path)
+			}
+			if !s.inWorkspace(path) {
+				return "", nil, fmt.Errorf("code paths must be in the workspace: %s", path)
+			}
+			paths++
+		}
+		if paths == 0 {
+			return "", nil, fmt.Errorf("code needs at least one path")
+		}
+		return "code", args, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown action %q", action)
+}
+
+// inWorkspace reports whether path, with symlinks resolved, is the workspace
+// or below it, so a link the container plants can't lead outside
+func (s *Server) inWorkspace(path string) bool {
+	if s.workspace == "" {
+		return false
+	}
+	workspace, err := filepath.EvalSymlinks(s.workspace)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(workspace, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Serve listens on socketPath until alive reports the container is gone
+func Serve(socketPath string, handler http.Handler, alive func() bool, checkInterval time.Duration) error {
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	defer func() { _ = os.Remove(socketPath) }()
+
+	// Container users may have a different UID than the host user
+	if err := os.Chmod(socketPath, 0666); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		for alive() {
+			time.Sleep(checkInterval)
+		}
+		_ = server.Close()
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
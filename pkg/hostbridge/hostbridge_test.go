@@ -0,0 +1,303 @@
+package hostbridge
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_Command(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer([]string{ActionOpen, ActionCode})
+	s.SetWorkspace(dir)
+	s.goos = "linux"
+
+	tests := []struct {
+		name     string
+		action   string
+		args     []string
+		wantCmd  string
+		wantFail bool
+	}{
+		{"open https", ActionOpen, []string{"https://example.com/login"}, "xdg-open", false},
+		{"open mailto", ActionOpen, []string{"mailto:dev@example.com"}, "xdg-open", false},
+		{"open file URL", ActionOpen, []string{"file:///etc/passwd"}, "", true},
+		{"open app scheme", ActionOpen, []string{"vscode://extension"}, "", true},
+		{"open multiple", ActionOpen, []string{"https://a", "https://b"}, "", true},
+		{"code path", ActionCode, []string{file}, "code", false},
+		{"code goto", ActionCode, []string{"--goto", file + ":12:3"}, "code", false},
+		{"code relative path", ActionCode, []string{"main.go"}, "", true},
+		{"code missing path", ActionCode, []string{filepath.Join(dir, "nope")}, "", true},
+		{"code workspace", ActionCode, []string{dir}, "code", false},
+		{"code outside workspace", ActionCode, []string{outside}, "", true},
+		{"code symlink out of workspace", ActionCode, []string{filepath.Join(dir, "link")}, "", true},
+		{"code parent of workspace", ActionCode, []string{filepath.Join(dir, "..")}, "", true},
+		{"code disallowed flag", ActionCode, []string{"--install-extension", "evil"}, "", true},
+		{"code no path", ActionCode, []string{"-n"}, "", true},
+		{"unknown action", "exec", []string{"sh"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, _, err := s.command(tt.action, tt.args)
+			if tt.wantFail {
+				if err == nil {
+					t.Errorf("command(%s, %v) expected error", tt.action, tt.args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("command(%s, %v) error = %v", tt.action, tt.args, err)
+			}
+			if name != tt.wantCmd {
+				t.Errorf("command() = %q, want %q", name, tt.wantCmd)
+			}
+		})
+	}
+
+	// Without a workspace mounted from the host, code opens nothing
+	if _, _, err := NewServer([]string{ActionCode}).command(ActionCode, []string{file}); err == nil {
+		t.Error("code action allowed without a workspace")
+	}
+
+	// Actions outside the allowlist are rejected
+	openOnly := NewServer(DefaultActions)
+	if _, _, err := openOnly.command(ActionCode, []string{file}); err == nil {
+		t.Error("code action allowed without being configured")
+	}
+
+	s.goos = "darwin"
+	if name, _, _ := s.command(ActionOpen, []string{"https://example.com"}); name != "open" {
+		t.Errorf("command() on darwin = %q, want open", name)
+	}
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	var started []string
+	s := NewServer(DefaultActions)
+	s.goos = "linux"
+	s.start = func(name string, args ...string) error {
+		started = append(started, name+" "+strings.Join(args, " "))
+		return nil
+	}
+
+	form := url.Values{"arg": {"https://example.com/?a=1&b=2"}}
+	req := httptest.NewRequest(http.MethodPost, "/open", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("ServeHTTP() status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if len(started) != 1 || started[0] != "xdg-open https://example.com/?a=1&b=2" {
+		t.Errorf("started = %v", started)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/open", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/code", strings.NewReader("arg=/tmp"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("disallowed action status = %d, want 403", rec.Code)
+	}
+}
+
+func TestMakeSocketDir(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	parent := filepath.Join(os.Getenv("XDG_DATA_HOME"), "packnplay", "bridge")
+	// Left open by an earlier version
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := makeSocketDir("packnplay-app")
+	if err != nil {
+		t.Fatalf("makeSocketDir() error = %v", err)
+	}
+	if dir != filepath.Join(parent, "packnplay-app") {
+		t.Errorf("makeSocketDir() = %s, want it in %s", dir, parent)
+	}
+	for path, want := range map[string]os.FileMode{parent: 0700, dir: 0755} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("/tmp", "pnp-bridge-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	socketPath := filepath.Join(dir, SocketName)
+
+	alive := make(chan bool, 1)
+	alive <- true
+	isAlive := func() bool {
+		select {
+		case v := <-alive:
+			alive <- v
+			return v
+		default:
+			return false
+		}
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	done := make(chan error, 1)
+	go func() { done <- Serve(socketPath, handler, isAlive, 10*time.Millisecond) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !Running(socketPath) {
+		if time.Now().After(deadline) {
+			t.Fatal("bridge socket never came up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		},
+	}}
+	resp, err := client.Post("http://packnplay/open", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatalf("request over socket failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+
+	// Container going away shuts the bridge down and removes the socket
+	<-alive
+	alive <- false
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve() did not exit after container stopped")
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Error("socket was not removed")
+	}
+}
+
+func TestShimScript(t *testing.T) {
+	for _, want := range []string{"--unix-socket", "--data-urlencode", "code) action=code", ContainerSocket()} {
+		if !strings.Contains(ShimScript, want) {
+			t.Errorf("ShimScript missing %q", want)
+		}
+	}
+}
+
+func TestServer_Clipboard(t *testing.T) {
+	var copied []string
+	s := NewServer([]string{ActionOpen, ActionClipboard})
+	s.goos = "linux"
+	s.getenv = func(key string) string {
+		if key == "DISPLAY" {
+			return ":0"
+		}
+		return ""
+	}
+	s.lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	s.copy = func(name string, args []string, data []byte) error {
+		copied = append(copied, name+" "+strings.Join(args, " ")+": "+string(data))
+		return nil
+	}
+	s.SetClipboardLimit(16)
+
+	post := func(s *Server, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/clipboard", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(s, "arg=not a form\n"); code != http.StatusNoContent {
+		t.Fatalf("clipboard status = %d, want 204", code)
+	}
+	if len(copied) != 1 || copied[0] != "xclip -selection clipboard: arg=not a form\n" {
+		t.Errorf("copied = %q, want the body copied verbatim with xclip", copied)
+	}
+
+	if code := post(s, strings.Repeat("x", 17)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized clipboard status = %d, want 413", code)
+	}
+	if code := post(NewServer(DefaultActions), "hi"); code != http.StatusForbidden {
+		t.Errorf("clipboard status without the action = %d, want 403", code)
+	}
+	if len(copied) != 1 {
+		t.Errorf("copied = %q, rejected copies should not reach the clipboard", copied)
+	}
+}
+
+func TestServer_ClipboardCommand(t *testing.T) {
+	s := NewServer([]string{ActionClipboard})
+	env := map[string]string{}
+	installed := map[string]bool{}
+	s.getenv = func(key string) string { return env[key] }
+	s.lookPath = func(file string) (string, error) {
+		if installed[file] {
+			return "/usr/bin/" + file, nil
+		}
+		return "", os.ErrNotExist
+	}
+
+	s.goos = "darwin"
+	if name, _, err := s.clipboardCommand(); err != nil || name != "pbcopy" {
+		t.Errorf("clipboardCommand() on darwin = %q, %v, want pbcopy", name, err)
+	}
+
+	s.goos = "linux"
+	if _, _, err := s.clipboardCommand(); err == nil {
+		t.Error("clipboardCommand() without a display should fail")
+	}
+	env["WAYLAND_DISPLAY"], env["DISPLAY"] = "wayland-0", ":0"
+	installed["xsel"] = true
+	if name, args, _ := s.clipboardCommand(); name != "xsel" || strings.Join(args, " ") != "--clipboard --input" {
+		t.Errorf("clipboardCommand() = %s %v, want xsel when it is the only tool", name, args)
+	}
+	installed["wl-copy"] = true
+	if name, _, _ := s.clipboardCommand(); name != "wl-copy" {
+		t.Errorf("clipboardCommand() = %s, want wl-copy under Wayland", name)
+	}
+}
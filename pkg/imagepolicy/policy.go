@@ -0,0 +1,306 @@
+package imagepolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Mode controls what happens when an image fails verification
+type Mode string
+
+const (
+	ModeOff   Mode = "off"   // don't verify
+	ModeWarn  Mode = "warn"  // verify, print a warning on failure and continue
+	ModeBlock Mode = "block" // verify, refuse to run on failure
+)
+
+// Identity is a keyless (Fulcio certificate) signer identity
+type Identity struct {
+	Issuer        string `json:"issuer"`                   // OIDC issuer, e.g. https://token.actions.githubusercontent.com
+	Subject       string `json:"subject,omitempty"`        // exact certificate identity
+	SubjectRegexp string `json:"subject_regexp,omitempty"` // certificate identity regexp
+}
+
+// Rule describes how references under a registry prefix are verified
+type Rule struct {
+	Mode       Mode       `json:"mode"`
+	Keys       []string   `json:"keys,omitempty"`       // cosign public key paths or KMS URIs
+	Identities []Identity `json:"identities,omitempty"` // accepted keyless signers
+}
+
+// Policy is the image verification policy loaded from image-policy.json
+type Policy struct {
+	Default    Rule            `json:"default"`
+	Registries map[string]Rule `json:"registries,omitempty"` // keyed by reference prefix, e.g. "ghcr.io/myorg"
+	// AllowUnverified lists features that can't carry a signature (local
+	// features and https:// tarballs) but may be used where the policy would
+	// block them, by reference prefix, e.g. "./" or "https://example.com/features/"
+	AllowUnverified []string `json:"allow_unverified,omitempty"`
+}
+
+// DefaultPath returns the XDG-compliant policy file location
+func DefaultPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, _ := os.UserHomeDir()
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "packnplay", "image-policy.json")
+}
+
+// Load reads a policy file. A missing file yields an empty policy that verifies nothing.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Policy{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse image policy %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid image policy %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// validate rejects unknown modes and enforcing rules without any trust roots
+func (p *Policy) validate() error {
+	check := func(name string, rule Rule) error {
+		switch rule.Mode {
+		case "", ModeOff:
+			return nil
+		case ModeWarn, ModeBlock:
+			if len(rule.Keys) == 0 && len(rule.Identities) == 0 {
+				return fmt.Errorf("%s: mode %q requires keys or identities", name, rule.Mode)
+			}
+			for _, id := range rule.Identities {
+				if id.Issuer == "" || (id.Subject == "" && id.SubjectRegexp == "") {
+					return fmt.Errorf("%s: identities need an issuer and a subject or subject_regexp", name)
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("%s: unknown mode %q (use off, warn, or block)", name, rule.Mode)
+		}
+	}
+
+	if err := check("default", p.Default); err != nil {
+		return err
+	}
+	for prefix, rule := range p.Registries {
+		if err := check(prefix, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RuleFor returns the most specific rule matching ref
+func (p *Policy) RuleFor(ref string) Rule {
+	normalized := NormalizeReference(ref)
+
+	best := ""
+	rule := p.Default
+	for prefix, r := range p.Registries {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if !matchesPrefix(normalized, prefix) {
+			continue
+		}
+		if len(prefix) > len(best) {
+			best = prefix
+			rule = r
+		}
+	}
+	return rule
+}
+
+// matchesPrefix reports whether ref falls under prefix on a path boundary
+func matchesPrefix(ref, prefix string) bool {
+	if !strings.HasPrefix(ref, prefix) {
+		return false
+	}
+	if len(ref) == len(prefix) {
+		return true
+	}
+	switch ref[len(prefix)] {
+	case '/', ':', '@':
+		return true
+	}
+	return false
+}
+
+// NormalizeReference expands Docker Hub shorthand (ubuntu -> docker.io/library/ubuntu)
+func NormalizeReference(ref string) string {
+	first, rest, hasSlash := strings.Cut(ref, "/")
+	if !hasSlash {
+		return "docker.io/library/" + ref
+	}
+	if !strings.ContainsAny(first, ".:") && first != "localhost" {
+		return "docker.io/" + first + "/" + rest
+	}
+	return ref
+}
+
+// Verifier checks references against a policy using cosign
+type Verifier struct {
+	policy *Policy
+	run    func(name string, args ...string) ([]byte, error)
+	warn   func(format string, args ...interface{})
+}
+
+// NewVerifier creates a Verifier that shells out to cosign
+func NewVerifier(policy *Policy) *Verifier {
+	return &Verifier{
+		policy: policy,
+		run: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+		warn: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, "Warning: "+format+"\n", args...)
+		},
+	}
+}
+
+// Verify checks ref's signature and returns ref pinned to the digest the
+// signature covers (repo@sha256:...), so callers use what was verified even if
+// the tag moves afterwards. It returns "" when nothing was verified: ref isn't
+// covered by the policy, or failed verification in warn mode, where the failure
+// is printed as a warning. In block mode failures are returned.
+func (v *Verifier) Verify(ref string) (string, error) {
+	rule := v.policy.RuleFor(ref)
+	if rule.Mode == "" || rule.Mode == ModeOff {
+		return "", nil
+	}
+
+	pinned, err := v.verifySignature(ref, rule)
+	if err == nil {
+		return pinned, nil
+	}
+	if rule.Mode == ModeWarn {
+		v.warn("%v", err)
+		return "", nil
+	}
+	return "", err
+}
+
+// CheckUnverifiable applies the policy to a feature that can't carry a
+// signature: a local feature or an https:// tarball. Those covered by an
+// enforcing rule fail in block mode and print a warning in warn mode, unless
+// listed in allow_unverified. URLs fall under the rule for their host and path,
+// local features under the default rule.
+func (v *Verifier) CheckUnverifiable(ref string) error {
+	for _, prefix := range v.policy.AllowUnverified {
+		if prefix != "" && strings.HasPrefix(ref, prefix) {
+			return nil
+		}
+	}
+
+	rule := v.policy.Default
+	if rest, ok := strings.CutPrefix(ref, "https://"); ok {
+		rule = v.policy.RuleFor(rest)
+	} else if rest, ok := strings.CutPrefix(ref, "http://"); ok {
+		rule = v.policy.RuleFor(rest)
+	}
+	switch rule.Mode {
+	case ModeBlock:
+		return fmt.Errorf("%s can't be signature verified; list it in allow_unverified in the image policy to use it", ref)
+	case ModeWarn:
+		v.warn("%s can't be signature verified, using it unverified", ref)
+	}
+	return nil
+}
+
+// verifySignature succeeds if any configured key or identity verifies ref,
+// returning ref pinned to the verified digest
+func (v *Verifier) verifySignature(ref string, rule Rule) (string, error) {
+	var attempts []string
+	for _, key := range rule.Keys {
+		output, err := v.run("cosign", "verify", "--key", key, ref)
+		if err == nil {
+			return pinnedReference(ref, output)
+		}
+		attempts = append(attempts, fmt.Sprintf("key %s: %s", key, summarize(output, err)))
+	}
+
+	for _, id := range rule.Identities {
+		args := []string{"verify", "--certificate-oidc-issuer", id.Issuer}
+		if id.Subject != "" {
+			args = append(args, "--certificate-identity", id.Subject)
+		} else {
+			args = append(args, "--certificate-identity-regexp", id.SubjectRegexp)
+		}
+		args = append(args, ref)
+
+		output, err := v.run("cosign", args...)
+		if err == nil {
+			return pinnedReference(ref, output)
+		}
+		attempts = append(attempts, fmt.Sprintf("identity %s: %s", id.Subject+id.SubjectRegexp, summarize(output, err)))
+	}
+
+	return "", fmt.Errorf("signature verification failed for %s:\n  %s", ref, strings.Join(attempts, "\n  "))
+}
+
+// cosignPayload is the part of a verified signature payload naming the signed manifest
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			Digest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// pinnedReference pins ref to the manifest digest in the output of a successful
+// cosign verify, which prints the verified payloads as a JSON array
+func pinnedReference(ref string, output []byte) (string, error) {
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") {
+			continue
+		}
+		var payloads []cosignPayload
+		if json.Unmarshal([]byte(line), &payloads) != nil {
+			continue
+		}
+		for _, payload := range payloads {
+			if digest := payload.Critical.Image.Digest; strings.HasPrefix(digest, "sha256:") {
+				return PinReference(ref, digest), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("signature verification of %s did not report the signed digest", ref)
+}
+
+// PinReference replaces ref's tag or digest with digest
+func PinReference(ref, digest string) string {
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	// A colon before the last slash is a registry port, not a tag
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return ref + "@" + digest
+}
+
+// summarize returns the last non-empty line of cosign output, or the error
+func summarize(output []byte, err error) string {
+	if errors.Is(err, exec.ErrNotFound) {
+		return "cosign not found in PATH"
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return last
+	}
+	return err.Error()
+}
@@ -0,0 +1,181 @@
+package imagepolicy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeReference(t *testing.T) {
+	tests := map[string]string{
+		"ubuntu:22.04":                     "docker.io/library/ubuntu:22.04",
+		"myorg/app:1":                      "docker.io/myorg/app:1",
+		"ghcr.io/myorg/app:1":              "ghcr.io/myorg/app:1",
+		"localhost/app":                    "localhost/app",
+		"registry.local:5000/team/app@sha": "registry.local:5000/team/app@sha",
+	}
+	for ref, want := range tests {
+		if got := NormalizeReference(ref); got != want {
+			t.Errorf("NormalizeReference(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestPolicy_RuleFor(t *testing.T) {
+	policy := &Policy{
+		Default: Rule{Mode: ModeWarn, Keys: []string{"default.pub"}},
+		Registries: map[string]Rule{
+			"ghcr.io/myorg":       {Mode: ModeBlock, Keys: []string{"org.pub"}},
+			"ghcr.io/myorg/infra": {Mode: ModeOff},
+			"docker.io/library":   {Mode: ModeOff},
+		},
+	}
+
+	tests := map[string]Mode{
+		"ghcr.io/myorg/app:1":          ModeBlock,
+		"ghcr.io/myorg/infra/base:2":   ModeOff,
+		"ghcr.io/myorganization/app:1": ModeWarn, // prefix must end on a path boundary
+		"ubuntu:22.04":                 ModeOff,
+		"quay.io/other/app":            ModeWarn,
+	}
+	for ref, want := range tests {
+		if got := policy.RuleFor(ref).Mode; got != want {
+			t.Errorf("RuleFor(%q).Mode = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	policy, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+	if policy.RuleFor("ubuntu").Mode != "" {
+		t.Errorf("missing policy should verify nothing")
+	}
+
+	invalid := map[string]string{
+		"bad mode":       `{"default": {"mode": "maybe"}}`,
+		"no trust roots": `{"registries": {"ghcr.io/x": {"mode": "block"}}}`,
+		"no issuer":      `{"default": {"mode": "warn", "identities": [{"subject": "me"}]}}`,
+	}
+	for name, content := range invalid {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-")+".json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) expected error", name)
+		}
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	policy := &Policy{
+		Registries: map[string]Rule{
+			"ghcr.io/blocked": {Mode: ModeBlock, Keys: []string{"k.pub"}},
+			"ghcr.io/warned": {Mode: ModeWarn, Identities: []Identity{
+				{Issuer: "https://token.actions.githubusercontent.com", SubjectRegexp: "^https://github.com/org/"},
+			}},
+		},
+	}
+
+	var calls [][]string
+	var warnings []string
+	v := NewVerifier(policy)
+	v.run = func(name string, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		return []byte("Error: no matching signatures\n"), errors.New("exit status 1")
+	}
+	v.warn = func(format string, args ...interface{}) {
+		warnings = append(warnings, format)
+	}
+
+	// Unlisted references aren't verified
+	if _, err := v.Verify("ubuntu:22.04"); err != nil || len(calls) != 0 {
+		t.Errorf("Verify() of unlisted image = %v with %d cosign calls", err, len(calls))
+	}
+
+	_, err := v.Verify("ghcr.io/blocked/app:1")
+	if err == nil || !strings.Contains(err.Error(), "no matching signatures") {
+		t.Errorf("Verify() in block mode error = %v", err)
+	}
+	if got := strings.Join(calls[0], " "); got != "verify --key k.pub ghcr.io/blocked/app:1" {
+		t.Errorf("cosign args = %q", got)
+	}
+
+	if _, err := v.Verify("ghcr.io/warned/app:1"); err != nil {
+		t.Errorf("Verify() in warn mode error = %v, want nil", err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected 1 warning, got %d", len(warnings))
+	}
+	if got := strings.Join(calls[1], " "); !strings.Contains(got, "--certificate-identity-regexp ^https://github.com/org/") {
+		t.Errorf("keyless cosign args = %q", got)
+	}
+
+	// Success on any trust root passes, pinning the reference to the signed digest
+	v.run = func(name string, args ...string) ([]byte, error) {
+		return []byte("\nVerification for ghcr.io/blocked/app:1 --\n" +
+			`[{"critical":{"identity":{"docker-reference":"ghcr.io/blocked/app"},"image":{"docker-manifest-digest":"sha256:abc"},"type":"cosign container image signature"}}]` + "\n"), nil
+	}
+	pinned, err := v.Verify("ghcr.io/blocked/app:1")
+	if err != nil || pinned != "ghcr.io/blocked/app@sha256:abc" {
+		t.Errorf("Verify() with valid signature = %q, %v, want ghcr.io/blocked/app@sha256:abc", pinned, err)
+	}
+
+	// A signature that doesn't name its digest can't be pinned
+	v.run = func(name string, args ...string) ([]byte, error) { return nil, nil }
+	if _, err := v.Verify("ghcr.io/blocked/app:1"); err == nil {
+		t.Error("Verify() without a signed digest should fail")
+	}
+}
+
+func TestPinReference(t *testing.T) {
+	tests := map[string]string{
+		"ubuntu:22.04":                 "ubuntu@sha256:abc",
+		"ghcr.io/org/app":              "ghcr.io/org/app@sha256:abc",
+		"localhost:5000/app:1":         "localhost:5000/app@sha256:abc",
+		"ghcr.io/org/app:1@sha256:old": "ghcr.io/org/app@sha256:abc",
+	}
+	for ref, want := range tests {
+		if got := PinReference(ref, "sha256:abc"); got != want {
+			t.Errorf("PinReference(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestVerifier_CheckUnverifiable(t *testing.T) {
+	policy := &Policy{
+		Default: Rule{Mode: ModeBlock, Keys: []string{"k.pub"}},
+		Registries: map[string]Rule{
+			"example.com/features": {Mode: ModeWarn, Keys: []string{"k.pub"}},
+			"example.com/open":     {Mode: ModeOff},
+		},
+		AllowUnverified: []string{"./.devcontainer/"},
+	}
+	var warnings []string
+	v := NewVerifier(policy)
+	v.warn = func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	for _, ref := range []string{"./local-feature", "https://github.com/org/feature.tgz"} {
+		if err := v.CheckUnverifiable(ref); err == nil || !strings.Contains(err.Error(), "allow_unverified") {
+			t.Errorf("CheckUnverifiable(%s) under a blocking default = %v, want error", ref, err)
+		}
+	}
+	for _, ref := range []string{"./.devcontainer/my-feature", "https://example.com/open/feature.tgz"} {
+		if err := v.CheckUnverifiable(ref); err != nil {
+			t.Errorf("CheckUnverifiable(%s) = %v, want nil", ref, err)
+		}
+	}
+	if err := v.CheckUnverifiable("https://example.com/features/node.tgz"); err != nil || len(warnings) != 1 {
+		t.Errorf("CheckUnverifiable() in warn mode = %v with warnings %v, want one warning", err, warnings)
+	}
+}
@@ -0,0 +1,54 @@
+// Package logrotate keeps append-only log files such as the audit log and
+// run stats from growing without bound, by size-based rotation: log.jsonl is
+// renamed to log.jsonl.1, shifting older files up and dropping the oldest.
+package logrotate
+
+import (
+	"os"
+	"strconv"
+)
+
+// BeforeAppend rotates the file at path when appending size more bytes would
+// take it past maxSize, keeping keep older files
+func BeforeAppend(path string, size, maxSize int64, keep int) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size()+size <= maxSize {
+		return nil
+	}
+	return Rotate(path, keep)
+}
+
+// Rotate shifts path.N to path.N+1, dropping the oldest, and path itself to
+// path.1. With keep below 1, path is removed.
+func Rotate(path string, keep int) error {
+	if err := os.Remove(RotatedPath(path, keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := keep - 1; i >= 1; i-- {
+		if err := os.Rename(RotatedPath(path, i), RotatedPath(path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if keep < 1 {
+		return os.Remove(path)
+	}
+	return os.Rename(path, RotatedPath(path, 1))
+}
+
+// RotatedPath is the nth older file of the log at path
+func RotatedPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// Files returns the log's rotated files that exist, oldest first, followed
+// by path itself
+func Files(path string) []string {
+	var files []string
+	for n := 1; ; n++ {
+		if _, err := os.Stat(RotatedPath(path, n)); err != nil {
+			break
+		}
+		files = append([]string{RotatedPath(path, n)}, files...)
+	}
+	return append(files, path)
+}
@@ -0,0 +1,41 @@
+package logrotate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBeforeAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	write := func(content string) {
+		if err := BeforeAppend(path, int64(len(content)), 10, 2); err != nil {
+			t.Fatalf("BeforeAppend() error = %v", err)
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.WriteString(content)
+		_ = f.Close()
+	}
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		write(line)
+	}
+
+	want := []string{RotatedPath(path, 2), RotatedPath(path, 1), path}
+	if got := Files(path); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Files() = %v, want %v", got, want)
+	}
+	var contents []string
+	for _, file := range want {
+		data, _ := os.ReadFile(file)
+		contents = append(contents, string(data))
+	}
+	// The oldest file, holding one and two, was dropped
+	if wantContents := []string{"three\n", "four\nfive\n", "six\n"}; !reflect.DeepEqual(contents, wantContents) {
+		t.Errorf("contents = %q, want %q", contents, wantContents)
+	}
+}
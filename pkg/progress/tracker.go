@@ -213,6 +213,17 @@ func (t *ProgressTracker) GetLayerCount() int {
 	return len(t.layers)
 }
 
+// CompletedLayerCount returns the number of layers that finished downloading
+func (t *ProgressTracker) CompletedLayerCount() int {
+	n := 0
+	for _, layer := range t.layers {
+		if layer.Complete {
+			n++
+		}
+	}
+	return n
+}
+
 // IsComplete returns true if the operation is complete
 func (t *ProgressTracker) IsComplete() bool {
 	return t.status == "complete" || t.status == "cached"
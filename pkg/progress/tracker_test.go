@@ -96,6 +96,9 @@ func TestProgressTracker_MultipleLayerProgress(t *testing.T) {
 	if percent < expected-0.01 || percent > expected+0.01 {
 		t.Errorf("expected ~%f, got %f", expected, percent)
 	}
+	if got := tracker.CompletedLayerCount(); got != 1 {
+		t.Errorf("CompletedLayerCount() = %d, want 1 of %d", got, tracker.GetLayerCount())
+	}
 }
 
 func TestProgressTracker_FormatBytes(t *testing.T) {
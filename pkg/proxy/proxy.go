@@ -0,0 +1,263 @@
+// Package proxy works out the HTTP proxy that image builds and containers
+// should use, from the host's proxy variables, the macOS system proxy and
+// packnplay's settings, so that package managers inside the container reach
+// the network the same way the host does.
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Settings are proxy URLs and the hosts that bypass them
+type Settings struct {
+	HTTP    string
+	HTTPS   string
+	FTP     string
+	All     string
+	NoProxy []string
+
+	// AddHost is an --add-host value the container needs to reach a proxy on
+	// the host's loopback interface, set by ForRuntime
+	AddHost string
+}
+
+// variables pairs each setting with the variable names that carry it
+var variables = []struct {
+	upper, lower string
+	field        func(*Settings) *string
+}{
+	{"HTTP_PROXY", "http_proxy", func(s *Settings) *string { return &s.HTTP }},
+	{"HTTPS_PROXY", "https_proxy", func(s *Settings) *string { return &s.HTTPS }},
+	{"FTP_PROXY", "ftp_proxy", func(s *Settings) *string { return &s.FTP }},
+	{"ALL_PROXY", "all_proxy", func(s *Settings) *string { return &s.All }},
+}
+
+// IsZero reports whether no proxy is set
+func (s Settings) IsZero() bool {
+	return s.HTTP == "" && s.HTTPS == "" && s.FTP == "" && s.All == ""
+}
+
+// FromEnv reads the proxy variables, preferring the upper-case name
+func FromEnv(getenv func(string) string) Settings {
+	var s Settings
+	for _, v := range variables {
+		value := getenv(v.upper)
+		if value == "" {
+			value = getenv(v.lower)
+		}
+		*v.field(&s) = value
+	}
+	noProxy := getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = getenv("no_proxy")
+	}
+	s.NoProxy = splitHosts(noProxy)
+	return s
+}
+
+// systemProxy returns the output of `scutil --proxy`, replaced in tests
+var systemProxy = func() (string, error) {
+	output, err := exec.Command("scutil", "--proxy").Output()
+	return string(output), err
+}
+
+// Detect returns the host's proxy: its proxy variables or, when none are set
+// on macOS, the system proxy from Network settings
+func Detect(getenv func(string) string) Settings {
+	s := FromEnv(getenv)
+	if !s.IsZero() || runtime.GOOS != "darwin" {
+		return s
+	}
+	output, err := systemProxy()
+	if err != nil {
+		return s
+	}
+	return ParseScutil(output)
+}
+
+// ParseScutil reads the enabled HTTP and HTTPS proxies and the exceptions list
+// from `scutil --proxy` output
+func ParseScutil(output string) Settings {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if inExceptions {
+			if line == "}" {
+				inExceptions = false
+				continue
+			}
+			if _, value, ok := strings.Cut(line, " : "); ok {
+				exceptions = append(exceptions, strings.TrimSpace(value))
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if key == "ExceptionsList" {
+			inExceptions = true
+			continue
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+
+	proxyURL := func(prefix string) string {
+		if values[prefix+"Enable"] != "1" || values[prefix+"Proxy"] == "" {
+			return ""
+		}
+		host := values[prefix+"Proxy"]
+		if port := values[prefix+"Port"]; port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		return "http://" + host
+	}
+	return Settings{HTTP: proxyURL("HTTP"), HTTPS: proxyURL("HTTPS"), NoProxy: exceptions}
+}
+
+// Override returns s with the proxies set in override replacing its own and
+// override's NoProxy hosts added to its
+func (s Settings) Override(override Settings) Settings {
+	for _, v := range variables {
+		if value := *v.field(&override); value != "" {
+			*v.field(&s) = value
+		}
+	}
+	s.NoProxy = appendHosts(slices.Clone(s.NoProxy), override.NoProxy...)
+	return s
+}
+
+// hostAliases are the names containers of each runtime reach the host at
+var hostAliases = map[string]string{
+	"docker": "host.docker.internal",
+	"podman": "host.containers.internal",
+}
+
+// ForRuntime adapts host settings for a container of the given runtime:
+// proxies on the host's loopback interface are addressed through the
+// runtime's host alias (docker also needs AddHost for it on Linux), and
+// loopback addresses and noProxy hosts, such as sidecar services, bypass the
+// proxy. Settings without a proxy are returned unchanged.
+func (s Settings) ForRuntime(runtimeName string, noProxy ...string) Settings {
+	if s.IsZero() {
+		return s
+	}
+	alias := hostAliases[runtimeName]
+	for _, v := range variables {
+		field := v.field(&s)
+		if rewritten, ok := replaceLoopback(*field, alias); ok {
+			*field = rewritten
+			if runtimeName == "docker" {
+				s.AddHost = alias + ":host-gateway"
+			}
+		}
+	}
+	s.NoProxy = appendHosts(slices.Clone(s.NoProxy), "localhost", "127.0.0.1", "::1")
+	if alias != "" {
+		s.NoProxy = appendHosts(s.NoProxy, alias)
+	}
+	s.NoProxy = appendHosts(s.NoProxy, noProxy...)
+	return s
+}
+
+// replaceLoopback points a proxy URL on a loopback address at alias
+func replaceLoopback(proxyURL, alias string) (string, bool) {
+	if proxyURL == "" || alias == "" {
+		return proxyURL, false
+	}
+	withScheme := proxyURL
+	if !strings.Contains(withScheme, "://") {
+		withScheme = "http://" + withScheme
+	}
+	u, err := url.Parse(withScheme)
+	if err != nil || !isLoopback(u.Hostname()) {
+		return proxyURL, false
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(alias, port)
+	} else {
+		u.Host = alias
+	}
+	return u.String(), true
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Env returns the settings as KEY=VALUE pairs, in both cases since tools
+// disagree on which they read
+func (s Settings) Env() []string {
+	if s.IsZero() {
+		return nil
+	}
+	var env []string
+	for _, v := range variables {
+		if value := *v.field(&s); value != "" {
+			env = append(env, v.upper+"="+value, v.lower+"="+value)
+		}
+	}
+	if len(s.NoProxy) > 0 {
+		noProxy := strings.Join(s.NoProxy, ",")
+		env = append(env, "NO_PROXY="+noProxy, "no_proxy="+noProxy)
+	}
+	return env
+}
+
+// RunArgs returns the container runtime arguments that apply the settings
+func (s Settings) RunArgs() []string {
+	return s.args("-e")
+}
+
+// BuildArgs returns the build arguments that apply the settings. The proxy
+// variables are predefined build args, so they reach RUN steps without being
+// kept in the image history.
+func (s Settings) BuildArgs() []string {
+	return s.args("--build-arg")
+}
+
+func (s Settings) args(flag string) []string {
+	var args []string
+	for _, kv := range s.Env() {
+		args = append(args, flag, kv)
+	}
+	if s.AddHost != "" {
+		args = append(args, "--add-host", s.AddHost)
+	}
+	return args
+}
+
+// splitHosts splits a comma-separated no_proxy value
+func splitHosts(value string) []string {
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// appendHosts adds the hosts not already in list
+func appendHosts(list []string, hosts ...string) []string {
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" || slices.Contains(list, host) {
+			continue
+		}
+		list = append(list, host)
+	}
+	return list
+}
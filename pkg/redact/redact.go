@@ -0,0 +1,141 @@
+// Package redact hides credentials in what packnplay prints: the runtime
+// commands shown with --verbose, dry-run output, and error messages, which
+// often end up in CI logs. Values of variables named like credentials
+// (ANTHROPIC_API_KEY=..., GITHUB_TOKEN=...) are replaced, as are values that
+// look like well-known tokens or passwords in URLs wherever they appear.
+// Redaction is on unless turned off with SetEnabled, for --no-redact.
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+var disabled atomic.Bool
+
+// SetEnabled turns redaction on or off for the whole process
+func SetEnabled(enabled bool) {
+	disabled.Store(!enabled)
+}
+
+// Enabled reports whether output is redacted
+func Enabled() bool {
+	return !disabled.Load()
+}
+
+// sensitiveName matches variable names whose values are likely credentials.
+// AUTH is only matched on its own, not as part of GIT_AUTHOR_NAME.
+var sensitiveName = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSW(OR)?D|PASSPHRASE|API_?KEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIAL|AUTH([^O]|$|ORIZATION))`)
+
+// SensitiveName reports whether name, a variable or setting name, is likely
+// to hold a credential
+func SensitiveName(name string) bool {
+	return sensitiveName.MatchString(name)
+}
+
+var (
+	// assignment is NAME=value, the value ending at whitespace or a quote
+	assignment = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)=([^\s"']+)`)
+	// quotedAssignment is "NAME=value", a JSON string such as an entry of a
+	// container's Env, whose value may contain spaces
+	quotedAssignment = regexp.MustCompile(`"([A-Za-z_][A-Za-z0-9_]*)=(?:[^"\\]|\\.)*"`)
+	// jsonPair is "NAME": "value"
+	jsonPair = regexp.MustCompile(`"([A-Za-z_][A-Za-z0-9_]*)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	// urlPassword is the password of user:password@ in a URL
+	urlPassword = regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`)
+	// privateKey is a PEM private key block
+	privateKey = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+	// tokens match well-known credential formats regardless of where they appear
+	tokens = regexp.MustCompile(strings.Join([]string{
+		`sk-[A-Za-z0-9_-]{20,}`,         // Anthropic, OpenAI
+		`gh[pousr]_[A-Za-z0-9]{20,}`,    // GitHub
+		`github_pat_[A-Za-z0-9_]{20,}`,  // GitHub fine-grained
+		`glpat-[A-Za-z0-9_-]{20,}`,      // GitLab
+		`xox[abposr]-[A-Za-z0-9-]{10,}`, // Slack
+		`npm_[A-Za-z0-9]{36}`,           // npm
+		`(AKIA|ASIA)[0-9A-Z]{16}`,       // AWS access key IDs
+		`eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`, // JWTs
+	}, "|"))
+)
+
+// String redacts credentials in free text, such as an error message or a
+// runtime's output
+func String(s string) string {
+	if !Enabled() {
+		return s
+	}
+	s = privateKey.ReplaceAllString(s, Placeholder)
+	s = quotedAssignment.ReplaceAllStringFunc(s, func(quoted string) string {
+		name := quotedAssignment.FindStringSubmatch(quoted)[1]
+		if !SensitiveName(name) {
+			return quoted
+		}
+		return `"` + name + "=" + Placeholder + `"`
+	})
+	s = redactAssignments(s)
+	s = jsonPair.ReplaceAllStringFunc(s, func(pair string) string {
+		m := jsonPair.FindStringSubmatch(pair)
+		if !SensitiveName(m[1]) {
+			return pair
+		}
+		return `"` + m[1] + `"` + m[2] + `"` + Placeholder + `"`
+	})
+	return redactValues(s)
+}
+
+// redactAssignments replaces the values of NAME=value assignments to
+// sensitive names, looking inside the values of others (--env=NAME=value)
+func redactAssignments(s string) string {
+	return assignment.ReplaceAllStringFunc(s, func(match string) string {
+		name, value, _ := strings.Cut(match, "=")
+		if SensitiveName(name) {
+			return name + "=" + Placeholder
+		}
+		return name + "=" + redactAssignments(value)
+	})
+}
+
+// redactValues replaces values that look like credentials
+func redactValues(s string) string {
+	s = urlPassword.ReplaceAllString(s, "${1}"+Placeholder+"@")
+	return tokens.ReplaceAllString(s, Placeholder)
+}
+
+// Args redacts credentials in a command line, such as a runtime's -e
+// NAME=value arguments, returning a copy. Each argument is taken whole, so a
+// value containing spaces is replaced entirely.
+func Args(args []string) []string {
+	if !Enabled() || args == nil {
+		return args
+	}
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = String(Env(arg))
+	}
+	return redacted
+}
+
+// Env redacts the value of a NAME=value environment entry, or of a flag
+// giving one (--env=NAME=value), if the name is sensitive
+func Env(entry string) string {
+	if !Enabled() {
+		return entry
+	}
+	prefix := ""
+	if strings.HasPrefix(entry, "-") {
+		flag, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			return entry
+		}
+		prefix, entry = flag+"=", rest
+	}
+	name, _, ok := strings.Cut(entry, "=")
+	if !ok || !SensitiveName(name) {
+		return prefix + entry
+	}
+	return prefix + name + "=" + Placeholder
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrOffline is returned instead of pulling anything while offline
+var ErrOffline = errors.New("not available locally, and pulls are disabled (offline)")
+
+// Mirrors routes pulls of images and OCI artifacts through pull-through
+// registry mirrors. The zero value pulls everything from its own registry.
+type Mirrors struct {
+	Hosts      map[string]string // registry host to mirror, e.g. "ghcr.io": "harbor.corp/ghcr"
+	NoFallback bool              // fail when the mirror does, rather than pulling from the registry itself
+	Offline    bool              // pull nothing: only what is already local can be used
+}
+
+// Mirror returns ref as served by its registry's mirror, e.g.
+// harbor.corp/ghcr/devcontainers/features/node:1 for
+// ghcr.io/devcontainers/features/node:1, or "" when no mirror serves the
+// registry. Tags and digests are kept: a pull-through mirror serves the same
+// manifests, so digests pinned in a lockfile still match.
+func (m Mirrors) Mirror(ref string) string {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	mirror := strings.TrimSuffix(m.Hosts[r.Host], "/")
+	if mirror == "" {
+		return ""
+	}
+	mirrored := mirror + "/" + r.Repository
+	if r.Tag != "" {
+		mirrored += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		mirrored += "@" + r.Digest
+	}
+	return mirrored
+}
+
+// Pull pulls ref with pull, given the reference to pull from: the mirror of
+// ref's registry, if any, and then ref itself if the mirror fails (unless
+// NoFallback is set). It returns the reference that was pulled.
+func (m Mirrors) Pull(ref string, pull func(source string) error) (string, error) {
+	if m.Offline {
+		return "", fmt.Errorf("%s is %w", ref, ErrOffline)
+	}
+	mirrored := m.Mirror(ref)
+	if mirrored == "" {
+		return ref, pull(ref)
+	}
+
+	err := pull(mirrored)
+	if err == nil {
+		return mirrored, nil
+	}
+	if m.NoFallback {
+		return "", fmt.Errorf("failed to pull %s from mirror %s: %w", ref, mirrored, err)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: failed to pull %s from mirror %s: %v\nPulling from the registry instead\n", ref, mirrored, err)
+	if err := pull(ref); err != nil {
+		return "", err
+	}
+	return ref, nil
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMirrorsMirror(t *testing.T) {
+	m := Mirrors{Hosts: map[string]string{"ghcr.io": "harbor.corp/ghcr/", "docker.io": "harbor.corp/hub"}}
+	tests := map[string]string{
+		"ghcr.io/devcontainers/features/node:1":               "harbor.corp/ghcr/devcontainers/features/node:1",
+		"ghcr.io/devcontainers/features/node@sha256:0123abcd": "harbor.corp/ghcr/devcontainers/features/node@sha256:0123abcd",
+		"ubuntu:22.04": "harbor.corp/hub/library/ubuntu:22.04",
+		"mcr.microsoft.com/devcontainers/base:ubuntu": "",
+		"localhost:5000/app":                          "",
+	}
+	for ref, want := range tests {
+		if got := m.Mirror(ref); got != want {
+			t.Errorf("Mirror(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestMirrorsPull(t *testing.T) {
+	m := Mirrors{Hosts: map[string]string{"ghcr.io": "harbor.corp/ghcr"}}
+	const ref = "ghcr.io/obra/app:1"
+	var pulled []string
+	failMirror := func(source string) error {
+		pulled = append(pulled, source)
+		if source != ref {
+			return errors.New("mirror unavailable")
+		}
+		return nil
+	}
+
+	if got, err := m.Pull(ref, failMirror); err != nil || got != ref || len(pulled) != 2 {
+		t.Errorf("Pull() = %q, %v after %v; want the registry used after the mirror failed", got, err, pulled)
+	}
+
+	pulled = nil
+	m.NoFallback = true
+	if _, err := m.Pull(ref, failMirror); err == nil || len(pulled) != 1 {
+		t.Errorf("Pull() without fallback = %v after %v; want only the mirror tried", err, pulled)
+	}
+
+	m.Offline = true
+	if _, err := m.Pull(ref, failMirror); !errors.Is(err, ErrOffline) {
+		t.Errorf("Pull() offline = %v, want ErrOffline", err)
+	}
+}
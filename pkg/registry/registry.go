@@ -0,0 +1,370 @@
+// Package registry looks up image manifest digests directly from OCI/Docker
+// registries, so update checks can compare them with local images without pulling.
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/registryauth"
+)
+
+// manifestAccept lists the manifest types we accept, multi-platform indexes first,
+// so the digest matches the one the runtime records when it pulls by tag
+var manifestAccept = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// dockerHubAuthKey is the key Docker Hub credentials are stored under in config.json
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// Reference is a parsed image reference
+type Reference struct {
+	Host       string // registry host, docker.io for Docker Hub
+	Repository string // e.g. library/ubuntu
+	Tag        string // empty when Digest is set
+	Digest     string
+}
+
+// ParseReference parses an image reference, expanding Docker Hub shorthand
+// (ubuntu -> docker.io/library/ubuntu:latest)
+func ParseReference(ref string) (Reference, error) {
+	if ref == "" {
+		return Reference{}, fmt.Errorf("empty image reference")
+	}
+
+	r := Reference{Host: registryauth.Host(ref)}
+	rest := ref
+	if first, after, ok := strings.Cut(ref, "/"); ok && first == r.Host {
+		rest = after
+	}
+
+	if name, digest, ok := strings.Cut(rest, "@"); ok {
+		rest, r.Digest = name, digest
+	}
+	// A tag follows the last colon after the last slash (a colon before it is a port)
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, r.Tag = rest[:i], rest[i+1:]
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	if r.Host == "docker.io" && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	if rest == "" {
+		return Reference{}, fmt.Errorf("invalid image reference %q", ref)
+	}
+	r.Repository = rest
+	return r, nil
+}
+
+// Name returns the fully qualified repository name, e.g. docker.io/library/ubuntu
+func (r Reference) Name() string {
+	return r.Host + "/" + r.Repository
+}
+
+// apiHost returns the host serving the registry API
+func (r Reference) apiHost() string {
+	if r.Host == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return r.Host
+}
+
+// MatchRepoDigest returns the digest from a local image's RepoDigests
+// (name@sha256:...) that belongs to ref's repository, or ""
+func MatchRepoDigest(ref string, repoDigests []string) string {
+	want, err := ParseReference(ref)
+	if err != nil {
+		return ""
+	}
+	for _, repoDigest := range repoDigests {
+		got, err := ParseReference(repoDigest)
+		if err == nil && got.Digest != "" && got.Name() == want.Name() {
+			return got.Digest
+		}
+	}
+	return ""
+}
+
+// Client fetches manifest digests from registries
+type Client struct {
+	http        *http.Client
+	credentials func(host string) (username, secret string)
+}
+
+// NewClient creates a Client using credentials from the docker config
+// ($DOCKER_CONFIG/config.json, including credential helpers)
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		http:        &http.Client{Timeout: timeout},
+		credentials: dockerCredentials,
+	}
+}
+
+// Digest returns the manifest digest the registry currently serves for ref
+func (c *Client) Digest(ref string) (string, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	if r.Digest != "" {
+		return r.Digest, nil
+	}
+
+	manifestURL := fmt.Sprintf("https://%s/v2/%s/manifests/%s", r.apiHost(), r.Repository, r.Tag)
+	resp, err := c.manifestRequest(http.MethodHead, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	authorization := ""
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization, err = c.authorize(r, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", err
+		}
+		if resp, err = c.manifestRequest(http.MethodHead, manifestURL, authorization); err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+	if err := statusError(resp, ref); err != nil {
+		return "", err
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries only send the digest on GET; hash the manifest ourselves
+	if resp, err = c.manifestRequest(http.MethodGet, manifestURL, authorization); err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := statusError(resp, ref); err != nil {
+		return "", err
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read manifest for %s: %w", ref, err)
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// manifestRequest sends a manifest request with the accepted manifest types
+func (c *Client) manifestRequest(method, manifestURL, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestAccept, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	return resp, nil
+}
+
+// authorize answers a registry's auth challenge, returning an Authorization header
+func (c *Client) authorize(r Reference, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	username, secret := "", ""
+	if c.credentials != nil {
+		username, secret = c.credentials(r.Host)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" && secret == "" {
+			return "", fmt.Errorf("registry %s requires a login (run: %s)", r.Host, registryauth.LoginHint(r.Name()))
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+secret)), nil
+	case "bearer":
+		return c.bearerToken(r, params, username, secret)
+	}
+	return "", fmt.Errorf("registry %s uses unsupported authentication %q", r.Host, scheme)
+}
+
+// bearerToken runs the token flow from the registry's challenge
+func (c *Client) bearerToken(r Reference, params map[string]string, username, secret string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry %s sent a bearer challenge without a realm", r.Host)
+	}
+	query := url.Values{}
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", r.Repository)
+	}
+	query.Set("scope", scope)
+
+	tokenURL := realm
+	if strings.Contains(realm, "?") {
+		tokenURL += "&" + query.Encode()
+	} else {
+		tokenURL += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" || secret != "" {
+		req.SetBasicAuth(username, secret)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s refused a token (%s); run: %s", r.Host, resp.Status, registryauth.LoginHint(r.Name()))
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %w", r.Host, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("registry %s returned an empty token", r.Host)
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.TrimSpace(key); key != "" {
+			params[strings.ToLower(key)] = value
+		}
+	}
+	return scheme, params
+}
+
+// statusError turns a failed manifest response into an error
+func statusError(resp *http.Response, ref string) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("image %s not found in registry", ref)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("unauthorized to read %s (run: %s)", ref, registryauth.LoginHint(ref))
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("registry rate limit reached (toomanyrequests) checking %s", ref)
+	}
+	return fmt.Errorf("registry returned %s for %s", resp.Status, ref)
+}
+
+// dockerConfig is the subset of config.json holding registry credentials
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth"`
+		IdentityToken string `json:"identitytoken"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// dockerCredentials returns the login stored for host by `docker login`, if any
+func dockerCredentials(host string) (string, string) {
+	data, err := os.ReadFile(filepath.Join(registryauth.DockerConfigDir(), "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", ""
+	}
+
+	key := host
+	if host == "docker.io" {
+		key = dockerHubAuthKey
+	}
+	helper := cfg.CredHelpers[key]
+	if helper == "" {
+		helper = cfg.CredsStore
+	}
+	if helper != "" {
+		if username, secret, err := helperCredentials(helper, key); err == nil {
+			return username, secret
+		}
+	}
+
+	for _, candidate := range []string{key, "https://" + key} {
+		entry, ok := cfg.Auths[candidate]
+		if !ok {
+			continue
+		}
+		if entry.IdentityToken != "" {
+			return "<token>", entry.IdentityToken
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return "", ""
+		}
+		username, secret, _ := strings.Cut(string(decoded), ":")
+		return username, secret
+	}
+	return "", ""
+}
+
+// helperCredentials asks a docker credential helper for a registry login
+func helperCredentials(helper, serverURL string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", "", err
+	}
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
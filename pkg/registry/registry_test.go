@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Reference
+	}{
+		{"ubuntu", Reference{Host: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{"ubuntu:22.04", Reference{Host: "docker.io", Repository: "library/ubuntu", Tag: "22.04"}},
+		{"obra/tool:1", Reference{Host: "docker.io", Repository: "obra/tool", Tag: "1"}},
+		{"docker.io/library/ubuntu", Reference{Host: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{"ghcr.io/obra/packnplay/devcontainer:latest", Reference{Host: "ghcr.io", Repository: "obra/packnplay/devcontainer", Tag: "latest"}},
+		{"localhost:5000/app", Reference{Host: "localhost:5000", Repository: "app", Tag: "latest"}},
+		{"ubuntu@sha256:abc", Reference{Host: "docker.io", Repository: "library/ubuntu", Digest: "sha256:abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if err != nil {
+				t.Fatalf("ParseReference() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRepoDigest(t *testing.T) {
+	repoDigests := []string{
+		"mirror.example.com/library/ubuntu@sha256:mirror",
+		"ubuntu@sha256:hub",
+	}
+	if got := MatchRepoDigest("docker.io/library/ubuntu:22.04", repoDigests); got != "sha256:hub" {
+		t.Errorf("MatchRepoDigest() = %q, want sha256:hub", got)
+	}
+	if got := MatchRepoDigest("ghcr.io/obra/other", repoDigests); got != "" {
+		t.Errorf("MatchRepoDigest() = %q, want no match", got)
+	}
+}
+
+// newTestRegistry starts a TLS registry that requires a bearer token from its own token endpoint
+func newTestRegistry(t *testing.T, sendDigestOnHead bool) (*httptest.Server, string) {
+	t.Helper()
+	manifest := []byte(`{"schemaVersion":2}`)
+	sum := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" || r.URL.Query().Get("service") != "test-registry" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"token":"secret-token"}`))
+		case r.URL.Path == "/v2/team/app/manifests/1.0":
+			if r.Header.Get("Authorization") != "Bearer secret-token" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test-registry",scope="repository:team/app:pull"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json") {
+				http.Error(w, "missing accept", http.StatusBadRequest)
+				return
+			}
+			if sendDigestOnHead {
+				w.Header().Set("Docker-Content-Digest", digest)
+			}
+			if r.Method == http.MethodGet {
+				w.Write(manifest)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, digest
+}
+
+func TestClientDigest(t *testing.T) {
+	for _, sendDigest := range []bool{true, false} {
+		server, wantDigest := newTestRegistry(t, sendDigest)
+		client := &Client{http: server.Client()}
+		host := strings.TrimPrefix(server.URL, "https://")
+
+		got, err := client.Digest(host + "/team/app:1.0")
+		if err != nil {
+			t.Fatalf("Digest() error = %v", err)
+		}
+		if got != wantDigest {
+			t.Errorf("Digest() = %q, want %q (digest header sent: %v)", got, wantDigest, sendDigest)
+		}
+
+		if _, err := client.Digest(host + "/team/missing:1.0"); err == nil {
+			t.Error("Digest() of a missing image should fail")
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme = %q, want Bearer", scheme)
+	}
+	if params["realm"] != "https://auth.docker.io/token" || params["service"] != "registry.docker.io" || params["scope"] != "repository:library/ubuntu:pull" {
+		t.Errorf("params = %v", params)
+	}
+}
+
+func TestDockerCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	config := `{"auths":{"ghcr.io":{"auth":"dXNlcjpwYXNz"},"https://index.docker.io/v1/":{"auth":"aHViOnRva2Vu"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, secret := dockerCredentials("ghcr.io"); user != "user" || secret != "pass" {
+		t.Errorf("dockerCredentials(ghcr.io) = %q, %q", user, secret)
+	}
+	if user, secret := dockerCredentials("docker.io"); user != "hub" || secret != "token" {
+		t.Errorf("dockerCredentials(docker.io) = %q, %q", user, secret)
+	}
+	if user, _ := dockerCredentials("quay.io"); user != "" {
+		t.Errorf("dockerCredentials(quay.io) = %q, want none", user)
+	}
+}
@@ -0,0 +1,264 @@
+// Package registryauth keeps logins to cloud container registries (ECR, GCR/Artifact
+// Registry, ACR) fresh before images and OCI features are pulled, and suggests the
+// exact login command when a registry rejects our credentials.
+package registryauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Provider identifies the cloud behind a registry host
+type Provider string
+
+const (
+	ProviderNone Provider = ""
+	ProviderECR  Provider = "ecr"
+	ProviderGCR  Provider = "gcr"
+	ProviderACR  Provider = "acr"
+)
+
+// tokenLifetime is how long a login obtained from each provider's CLI stays valid.
+// Logins are refreshed a little before they expire.
+var tokenLifetime = map[Provider]time.Duration{
+	ProviderECR: 12 * time.Hour,
+	ProviderGCR: time.Hour,
+	ProviderACR: 3 * time.Hour,
+}
+
+// refreshMargin is how long before expiry a cached login is considered stale
+const refreshMargin = 5 * time.Minute
+
+var ecrHostPattern = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// Registry describes a registry host and how to log in to it
+type Registry struct {
+	Host     string
+	Provider Provider
+	Region   string // ECR region
+	Name     string // ACR registry name
+}
+
+// Host returns the registry host of an image or OCI artifact reference
+func Host(ref string) string {
+	first, _, hasSlash := strings.Cut(ref, "/")
+	if !hasSlash || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return "docker.io"
+	}
+	return first
+}
+
+// Parse detects which cloud registry an image or OCI artifact reference points at
+func Parse(ref string) Registry {
+	host := Host(ref)
+	reg := Registry{Host: host}
+
+	switch {
+	case ecrHostPattern.MatchString(host):
+		reg.Provider = ProviderECR
+		reg.Region = ecrHostPattern.FindStringSubmatch(host)[3]
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		reg.Provider = ProviderGCR
+	case strings.HasSuffix(host, ".azurecr.io"):
+		reg.Provider = ProviderACR
+		reg.Name = strings.TrimSuffix(host, ".azurecr.io")
+	}
+	return reg
+}
+
+// LoginHint returns the command a user should run to log in to the registry of ref
+func LoginHint(ref string) string {
+	reg := Parse(ref)
+	switch reg.Provider {
+	case ProviderECR:
+		return fmt.Sprintf("aws ecr get-login-password --region %s | docker login --username AWS --password-stdin %s", reg.Region, reg.Host)
+	case ProviderGCR:
+		return fmt.Sprintf("gcloud auth configure-docker %s", reg.Host)
+	case ProviderACR:
+		return fmt.Sprintf("az acr login --name %s", reg.Name)
+	}
+	if reg.Host == "docker.io" {
+		return "docker login"
+	}
+	return fmt.Sprintf("docker login %s", reg.Host)
+}
+
+// dockerConfigFile is the subset of ~/.docker/config.json that decides how credentials are stored
+type dockerConfigFile struct {
+	CredsStore  string            `json:"credsStore,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// DockerConfigDir returns $DOCKER_CONFIG or ~/.docker
+func DockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+// DefaultStatePath returns where login expiry times are cached
+func DefaultStatePath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, _ := os.UserHomeDir()
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "packnplay", "registry-logins.json")
+}
+
+// Helper refreshes cloud registry logins through the provider CLIs
+type Helper struct {
+	runtime   string // container runtime CLI used for "login"
+	configDir string
+	statePath string
+
+	run      func(stdin, name string, args ...string) ([]byte, error)
+	lookPath func(file string) (string, error)
+	now      func() time.Time
+}
+
+// NewHelper creates a Helper that logs in with the given runtime CLI (docker, podman, container)
+func NewHelper(runtime string) *Helper {
+	return &Helper{
+		runtime:   runtime,
+		configDir: DockerConfigDir(),
+		statePath: DefaultStatePath(),
+		run: func(stdin, name string, args ...string) ([]byte, error) {
+			cmd := exec.Command(name, args...)
+			if stdin != "" {
+				cmd.Stdin = strings.NewReader(stdin)
+			}
+			return cmd.CombinedOutput()
+		},
+		lookPath: exec.LookPath,
+		now:      time.Now,
+	}
+}
+
+// LoginHint returns the command a user should run to log in to the registry of ref
+func (h *Helper) LoginHint(ref string) string {
+	return LoginHint(ref)
+}
+
+// Refresh makes sure the login for ref's registry is current. Registries that
+// aren't ECR, GCR or ACR are left alone. When docker is configured with a
+// credential helper for the registry, the helper refreshes tokens itself and
+// Refresh only checks that it is installed.
+func (h *Helper) Refresh(ref string) error {
+	reg := Parse(ref)
+	if reg.Provider == ProviderNone {
+		return nil
+	}
+
+	if helper := h.credentialHelper(reg); helper != "" {
+		binary := "docker-credential-" + helper
+		if _, err := h.lookPath(binary); err != nil {
+			return fmt.Errorf("%s is configured as the credential helper for %s but is not installed", binary, reg.Host)
+		}
+		return nil
+	}
+
+	state := h.loadState()
+	key := h.stateKey(reg.Host)
+	if expires, ok := state[key]; ok && h.now().Add(refreshMargin).Before(expires) {
+		return nil
+	}
+
+	username, token, err := h.fetchToken(reg)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"login", "--username", username, "--password-stdin", reg.Host}
+	if h.runtime == "container" {
+		args = append([]string{"registry"}, args...)
+	}
+	if output, err := h.run(token, h.runtime, args...); err != nil {
+		return fmt.Errorf("failed to log in to %s: %w\n%s", reg.Host, err, strings.TrimSpace(string(output)))
+	}
+
+	state[key] = h.now().Add(tokenLifetime[reg.Provider])
+	h.saveState(state)
+	return nil
+}
+
+// credentialHelper returns the docker credential helper configured for the registry, if any
+func (h *Helper) credentialHelper(reg Registry) string {
+	data, err := os.ReadFile(filepath.Join(h.configDir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ""
+	}
+	if helper := cfg.CredHelpers[reg.Host]; helper != "" {
+		return helper
+	}
+	// A global ecr-login store (amazon-ecr-credential-helper) covers every ECR host
+	if reg.Provider == ProviderECR && cfg.CredsStore == "ecr-login" {
+		return cfg.CredsStore
+	}
+	return ""
+}
+
+// fetchToken obtains a short-lived registry password from the provider's CLI
+func (h *Helper) fetchToken(reg Registry) (username, token string, err error) {
+	var name string
+	var args []string
+	switch reg.Provider {
+	case ProviderECR:
+		username, name, args = "AWS", "aws", []string{"ecr", "get-login-password", "--region", reg.Region}
+	case ProviderGCR:
+		username, name, args = "oauth2accesstoken", "gcloud", []string{"auth", "print-access-token"}
+	case ProviderACR:
+		username = "00000000-0000-0000-0000-000000000000"
+		name, args = "az", []string{"acr", "login", "--name", reg.Name, "--expose-token", "--output", "tsv", "--query", "accessToken"}
+	}
+
+	if _, err := h.lookPath(name); err != nil {
+		return "", "", fmt.Errorf("cannot refresh login for %s: %s CLI not found", reg.Host, name)
+	}
+	output, err := h.run("", name, args...)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get a token for %s from %s: %w\n%s", reg.Host, name, err, strings.TrimSpace(string(output)))
+	}
+	token = strings.TrimSpace(string(output))
+	if token == "" {
+		return "", "", fmt.Errorf("%s returned an empty token for %s", name, reg.Host)
+	}
+	return username, token, nil
+}
+
+// stateKey scopes cached logins to the docker config directory they were written to
+func (h *Helper) stateKey(host string) string {
+	return h.configDir + "|" + host
+}
+
+func (h *Helper) loadState() map[string]time.Time {
+	state := make(map[string]time.Time)
+	if data, err := os.ReadFile(h.statePath); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// saveState records login expiry times; failing to cache only costs an extra login next time
+func (h *Helper) saveState(state map[string]time.Time) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.statePath), 0755); err != nil {
+		return
+	}
+	_ = os.WriteFile(h.statePath, data, 0600)
+}
@@ -0,0 +1,199 @@
+package registryauth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Registry
+	}{
+		{"123456789012.dkr.ecr.us-west-2.amazonaws.com/app:latest", Registry{Host: "123456789012.dkr.ecr.us-west-2.amazonaws.com", Provider: ProviderECR, Region: "us-west-2"}},
+		{"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com/app", Registry{Host: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com", Provider: ProviderECR, Region: "us-gov-west-1"}},
+		{"gcr.io/project/app", Registry{Host: "gcr.io", Provider: ProviderGCR}},
+		{"eu.gcr.io/project/app", Registry{Host: "eu.gcr.io", Provider: ProviderGCR}},
+		{"us-central1-docker.pkg.dev/project/repo/feature:1", Registry{Host: "us-central1-docker.pkg.dev", Provider: ProviderGCR}},
+		{"myreg.azurecr.io/app:1", Registry{Host: "myreg.azurecr.io", Provider: ProviderACR, Name: "myreg"}},
+		{"ghcr.io/devcontainers/features/node:1", Registry{Host: "ghcr.io"}},
+		{"ubuntu:22.04", Registry{Host: "docker.io"}},
+		{"myorg/app", Registry{Host: "docker.io"}},
+		{"localhost:5000/app", Registry{Host: "localhost:5000"}},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.ref); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestLoginHint(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/app", "aws ecr get-login-password --region us-east-1 | docker login --username AWS --password-stdin 123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+		{"us-docker.pkg.dev/p/r/app", "gcloud auth configure-docker us-docker.pkg.dev"},
+		{"myreg.azurecr.io/app", "az acr login --name myreg"},
+		{"ghcr.io/org/app", "docker login ghcr.io"},
+		{"org/app", "docker login"},
+	}
+
+	for _, tt := range tests {
+		if got := LoginHint(tt.ref); got != tt.want {
+			t.Errorf("LoginHint(%q) = %q, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+type call struct {
+	stdin string
+	argv  string
+}
+
+func newTestHelper(t *testing.T, installed ...string) (*Helper, *[]call) {
+	t.Helper()
+	dir := t.TempDir()
+	var calls []call
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h := &Helper{
+		runtime:   "docker",
+		configDir: filepath.Join(dir, "docker"),
+		statePath: filepath.Join(dir, "state", "registry-logins.json"),
+		run: func(stdin, name string, args ...string) ([]byte, error) {
+			calls = append(calls, call{stdin: stdin, argv: name + " " + strings.Join(args, " ")})
+			if name != "docker" {
+				return []byte("token-from-" + name + "\n"), nil
+			}
+			return []byte("Login Succeeded"), nil
+		},
+		lookPath: func(file string) (string, error) {
+			for _, name := range installed {
+				if name == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", errors.New("not found")
+		},
+		now: func() time.Time { return now },
+	}
+	return h, &calls
+}
+
+func TestRefreshECRLogsInAndCaches(t *testing.T) {
+	h, calls := newTestHelper(t, "aws")
+	ref := "123456789012.dkr.ecr.us-east-1.amazonaws.com/app:latest"
+
+	if err := h.Refresh(ref); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(*calls) != 2 {
+		t.Fatalf("calls = %v, want token fetch and login", *calls)
+	}
+	if got := (*calls)[0].argv; got != "aws ecr get-login-password --region us-east-1" {
+		t.Errorf("token command = %q", got)
+	}
+	login := (*calls)[1]
+	if login.argv != "docker login --username AWS --password-stdin 123456789012.dkr.ecr.us-east-1.amazonaws.com" {
+		t.Errorf("login command = %q", login.argv)
+	}
+	if login.stdin != "token-from-aws" {
+		t.Errorf("login stdin = %q, want the token", login.stdin)
+	}
+
+	// A second refresh within the token lifetime is a no-op
+	if err := h.Refresh(ref); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(*calls) != 2 {
+		t.Errorf("calls = %v, cached login should not be refreshed", *calls)
+	}
+
+	// Once it is about to expire it is refreshed again
+	later := h.now().Add(12 * time.Hour)
+	h.now = func() time.Time { return later }
+	if err := h.Refresh(ref); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if len(*calls) != 4 {
+		t.Errorf("calls = %v, expired login should be refreshed", *calls)
+	}
+}
+
+func TestRefreshACRUsesExposedToken(t *testing.T) {
+	h, calls := newTestHelper(t, "az")
+	if err := h.Refresh("myreg.azurecr.io/app:1"); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := (*calls)[0].argv; got != "az acr login --name myreg --expose-token --output tsv --query accessToken" {
+		t.Errorf("token command = %q", got)
+	}
+	if got := (*calls)[1].argv; !strings.Contains(got, "--username 00000000-0000-0000-0000-000000000000") {
+		t.Errorf("login command = %q", got)
+	}
+}
+
+func TestRefreshAppleContainerLogin(t *testing.T) {
+	h, calls := newTestHelper(t, "gcloud")
+	h.runtime = "container"
+	if err := h.Refresh("gcr.io/project/app"); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := (*calls)[1].argv; got != "container registry login --username oauth2accesstoken --password-stdin gcr.io" {
+		t.Errorf("login command = %q", got)
+	}
+}
+
+func TestRefreshSkipsOtherRegistries(t *testing.T) {
+	h, calls := newTestHelper(t, "aws", "gcloud", "az")
+	for _, ref := range []string{"ubuntu:22.04", "ghcr.io/devcontainers/features/node:1", "quay.io/org/app"} {
+		if err := h.Refresh(ref); err != nil {
+			t.Errorf("Refresh(%q) error = %v", ref, err)
+		}
+	}
+	if len(*calls) != 0 {
+		t.Errorf("calls = %v, want none", *calls)
+	}
+}
+
+func TestRefreshMissingCLI(t *testing.T) {
+	h, _ := newTestHelper(t)
+	err := h.Refresh("gcr.io/project/app")
+	if err == nil || !strings.Contains(err.Error(), "gcloud CLI not found") {
+		t.Errorf("Refresh() error = %v, want missing CLI error", err)
+	}
+}
+
+func TestRefreshDefersToCredentialHelper(t *testing.T) {
+	h, calls := newTestHelper(t, "aws")
+	if err := os.MkdirAll(h.configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"credsStore": "ecr-login", "credHelpers": {"gcr.io": "gcloud"}}`
+	if err := os.WriteFile(filepath.Join(h.configDir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// ecr-login is not installed
+	err := h.Refresh("123456789012.dkr.ecr.us-east-1.amazonaws.com/app")
+	if err == nil || !strings.Contains(err.Error(), "docker-credential-ecr-login") {
+		t.Errorf("Refresh() error = %v, want missing helper error", err)
+	}
+
+	h.lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	if err := h.Refresh("123456789012.dkr.ecr.us-east-1.amazonaws.com/app"); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if err := h.Refresh("gcr.io/project/app"); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("calls = %v, credential helpers should refresh their own tokens", *calls)
+	}
+}
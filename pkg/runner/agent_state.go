@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/obra/packnplay/pkg/agents"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+)
+
+// LabelAgentState marks volumes holding an isolated agent's config dir, with
+// the agent's name
+const LabelAgentState = "packnplay-agent-state"
+
+// AgentVolume is a volume mounted over an isolated agent's config dir instead
+// of the host's, so one project's conversations aren't visible to another's
+type AgentVolume struct {
+	Agent    string `json:"agent"`
+	Name     string `json:"name,omitempty"` // empty for an ephemeral container's anonymous volume
+	Target   string `json:"target"`
+	Template string `json:"template,omitempty"` // host directory a new volume is seeded from
+
+	created bool // the volume is new and has to be seeded
+}
+
+// MountArgs returns the runtime arguments mounting the volume
+func (v AgentVolume) MountArgs() []string {
+	if v.Name == "" {
+		return []string{"--mount", "type=volume,target=" + v.Target}
+	}
+	return []string{"--mount", fmt.Sprintf("type=volume,source=%s,target=%s", v.Name, v.Target)}
+}
+
+// AgentStateVolumeName returns the name of a container's state volume for an agent
+func AgentStateVolumeName(containerName, agent string) string {
+	return containerName + "-" + agent + "-state"
+}
+
+// agentStateVolumes returns volumes for the agents whose state is isolated:
+// Claude, and the others whose config dir or template exists on the host.
+// Ephemeral containers get anonymous volumes removed with them.
+func agentStateVolumes(settings config.AgentStateConfig, containerName, homeDir, remoteHome string, ephemeral, namedVolumes bool) []AgentVolume {
+	var volumes []AgentVolume
+	for _, agent := range agents.GetSupportedAgents() {
+		if settings.Mode(agent.Name()) != config.AgentStateIsolated {
+			continue
+		}
+		mounts := agent.GetMounts(homeDir, remoteHome)
+		if len(mounts) == 0 {
+			continue
+		}
+		template := config.AgentTemplateDir(agent.Name())
+		if !fileExists(template) {
+			template = ""
+		}
+		if !agent.RequiresSpecialHandling() && template == "" && !fileExists(mounts[0].HostPath) {
+			continue
+		}
+		if !namedVolumes {
+			fmt.Fprintf(os.Stderr, "Warning: this runtime has no named volumes; sharing %s with other containers\n", mounts[0].HostPath)
+			continue
+		}
+		volume := AgentVolume{Agent: agent.Name(), Target: mounts[0].ContainerPath, Template: template}
+		if !ephemeral {
+			volume.Name = AgentStateVolumeName(containerName, agent.Name())
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// findAgentVolume returns the volume for an agent, if its state is isolated
+func findAgentVolume(volumes []AgentVolume, agent string) (AgentVolume, bool) {
+	for _, volume := range volumes {
+		if volume.Agent == agent {
+			return volume, true
+		}
+	}
+	return AgentVolume{}, false
+}
+
+// ensureAgentStateVolumes creates the named state volumes earlier runs didn't,
+// marking them to be seeded once the container is up
+func ensureAgentStateVolumes(dockerClient DockerClient, volumes []AgentVolume, hostPath string, verbose bool) error {
+	for i := range volumes {
+		volume := &volumes[i]
+		if volume.Name == "" {
+			volume.created = true
+			continue
+		}
+		if _, err := dockerClient.Run("volume", "inspect", volume.Name); err == nil {
+			continue
+		}
+		output, err := dockerClient.Run("volume", "create",
+			"--label", container.LabelManagedBy+"=packnplay",
+			"--label", container.LabelProject+"="+filepath.Base(hostPath),
+			"--label", container.LabelHostPath+"="+hostPath,
+			"--label", LabelAgentState+"="+volume.Agent,
+			volume.Name)
+		if err != nil {
+			return fmt.Errorf("failed to create %s state volume %s: %w\n%s", volume.Agent, volume.Name, err, output)
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Created %s state volume %s\n", volume.Agent, volume.Name)
+		}
+		volume.created = true
+	}
+	return nil
+}
+
+// seedAgentStateVolumes gives new state volumes to the remote user and copies
+// the agents' templates into them
+func seedAgentStateVolumes(dockerClient DockerClient, containerID, user string, volumes []AgentVolume, verbose bool) error {
+	for _, volume := range volumes {
+		if !volume.created {
+			continue
+		}
+		// A new volume's mount point belongs to root
+		if output, err := dockerClient.Run("exec", "-u", "root", containerID, "chown", userOwner(user), volume.Target); err != nil {
+			return fmt.Errorf("failed to give %s the %s state volume: %w\n%s", user, volume.Agent, err, output)
+		}
+		if volume.Template == "" {
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Seeding %s state from %s\n", volume.Agent, volume.Template)
+		}
+		err := filepath.WalkDir(volume.Template, func(src string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(volume.Template, src)
+			if err != nil {
+				return err
+			}
+			return copyFileToContainer(dockerClient, containerID, src, path.Join(volume.Target, filepath.ToSlash(rel)), user, verbose)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to seed %s state from %s: %w", volume.Agent, volume.Template, err)
+		}
+		// Directories copying created belong to the runtime's default user
+		if output, err := dockerClient.Run("exec", "-u", "root", containerID, "chown", "-R", userOwner(user), volume.Target); err != nil {
+			return fmt.Errorf("failed to give %s the %s state: %w\n%s", user, volume.Agent, err, output)
+		}
+	}
+	return nil
+}
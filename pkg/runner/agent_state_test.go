@@ -0,0 +1,116 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunIsolatedAgentState(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	fake.Fail(errors.New("exit status 1"), "Error: no such volume", "volume", "inspect")
+	useFakeRuntime(t, fake)
+	home := os.Getenv("HOME")
+	for _, dir := range []string{".claude", ".codex"} {
+		if err := os.MkdirAll(filepath.Join(home, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	template := config.AgentTemplateDir("claude")
+	if err := os.MkdirAll(filepath.Join(template, "commands"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"settings.json", filepath.Join("commands", "review.md")} {
+		if err := os.WriteFile(filepath.Join(template, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "dev"}`)
+
+	settings := config.AgentStateConfig{"claude": config.AgentStateIsolated}
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, AgentState: settings, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	volume := AgentStateVolumeName(name, "claude")
+	c := fake.Container(name)
+	if c == nil {
+		t.Fatalf("container %s should be created: %v", name, fake.Containers())
+	}
+	if !contains(c.RunArgs, "--mount type=volume,source="+volume+",target=/home/dev/.claude") {
+		t.Errorf("docker run args = %v, want the state volume mounted over ~/.claude", c.RunArgs)
+	}
+	if contains(c.RunArgs, "-v "+home+"/.claude:/home/dev/.claude") {
+		t.Errorf("docker run args = %v, the host's ~/.claude should not be mounted", c.RunArgs)
+	}
+	if !contains(c.RunArgs, "-v "+home+"/.codex:/home/dev/.codex") {
+		t.Errorf("docker run args = %v, want the shared ~/.codex still mounted", c.RunArgs)
+	}
+
+	if creates := fake.CallsTo("volume", "create"); len(creates) != 1 || creates[0][len(creates[0])-1] != volume || !contains(creates[0], "--label "+LabelAgentState+"=claude") {
+		t.Errorf("volume create calls = %v, want %s labeled", creates, volume)
+	}
+	if len(fake.CallsTo("exec", "-u", "root", c.ID, "chown", "dev:dev", "/home/dev/.claude")) != 1 {
+		t.Errorf("exec calls = %v, want the volume given to dev", fake.CallsTo("exec"))
+	}
+	var seeded []string
+	for _, call := range fake.CallsTo("cp") {
+		seeded = append(seeded, call[len(call)-1])
+	}
+	joined := strings.Join(seeded, " ")
+	if !strings.Contains(joined, c.ID+":/home/dev/.claude/settings.json") || !strings.Contains(joined, c.ID+":/home/dev/.claude/commands/review.md") {
+		t.Errorf("copied %v, want the template seeded into the volume", seeded)
+	}
+}
+
+func TestRunIsolatedAgentStateEphemeral(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "dev"}`)
+
+	spec := dryRunSpec(t, &RunConfig{Path: project, Ephemeral: true, AgentState: config.AgentStateConfig{"default": config.AgentStateIsolated}})
+	if len(spec.AgentVolumes) != 1 || spec.AgentVolumes[0].Agent != "claude" || spec.AgentVolumes[0].Name != "" {
+		t.Fatalf("AgentVolumes = %+v, want an anonymous volume for claude only", spec.AgentVolumes)
+	}
+	if !contains(spec.RunArgs, "--mount type=volume,target=/home/dev/.claude") {
+		t.Errorf("docker run args = %v, want an anonymous volume over ~/.claude", spec.RunArgs)
+	}
+}
+
+func TestRunSharedAgentStateByDefault(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "dev"}`)
+
+	spec := dryRunSpec(t, &RunConfig{Path: project, NoWorktree: true})
+	if len(spec.AgentVolumes) != 0 || !contains(spec.RunArgs, "-v "+os.Getenv("HOME")+"/.claude:/home/dev/.claude") {
+		t.Errorf("spec = %+v, want the host's ~/.claude mounted", spec)
+	}
+}
+
+// dryRunSpec returns the RunSpec a dry run of config prints
+func dryRunSpec(t *testing.T, config *RunConfig) RunSpec {
+	t.Helper()
+	config.DryRun, config.DryRunJSON, config.Command = true, true, []string{"bash"}
+	stdout := captureStdout(t, func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	var spec RunSpec
+	if err := json.Unmarshal([]byte(stdout), &spec); err != nil {
+		t.Fatalf("dry run output is not a RunSpec: %v\n%s", err, stdout)
+	}
+	return spec
+}
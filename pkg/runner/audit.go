@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/redact"
+)
+
+// RecordAudit appends an event to the audit log, shown by `packnplay audit
+// show`, with credentials in its commands redacted. A failure is reported but
+// never stops what is being recorded.
+func RecordAudit(event audit.Event) {
+	event.Argv = redact.Args(event.Argv)
+	event.Error = redact.String(event.Error)
+	if err := audit.NewLog(audit.DefaultPath()).Record(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write audit log: %v\n", err)
+	}
+}
+
+// auditCredentials lists the credential types given to a container, a
+// repository-scoped gh token naming its repository
+func auditCredentials(creds config.Credentials, ghRepo string, ghWithheld bool) []string {
+	var types []string
+	add := func(enabled bool, name string) {
+		if enabled {
+			types = append(types, name)
+		}
+	}
+	add(creds.Git, "git")
+	add(creds.SSH, "ssh")
+	add(creds.SSHAgent, "ssh-agent")
+	switch {
+	case ghRepo != "":
+		types = append(types, "gh:"+ghRepo)
+	case creds.GH && !ghWithheld:
+		types = append(types, "gh")
+	}
+	add(creds.GPG, "gpg")
+	add(creds.NPM, "npm")
+	add(creds.AWS, "aws")
+	add(creds.ClaudeMode() != config.ClaudeCredsNone, "claude")
+	return types
+}
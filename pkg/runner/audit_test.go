@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunRecordsAuditEvents(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postCreateCommand": "make deps"}`)
+
+	creds := config.Credentials{Git: true, Claude: config.ClaudeCredsNone}
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Credentials: creds, Command: []string{"make", "test"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	events, err := audit.Load(audit.DefaultPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.Project != project || event.Container != container.GenerateContainerName(project, "no-worktree") {
+			t.Errorf("event %+v, want it recorded for the project's container", event)
+		}
+	}
+	if want := []string{audit.TypeCreate, audit.TypeLifecycle, audit.TypeExec}; !reflect.DeepEqual(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+	if events[0].Image != "alpine:3.20" || !reflect.DeepEqual(events[0].Credentials, []string{"git"}) {
+		t.Errorf("create event = %+v", events[0])
+	}
+	if events[1].Command != "postCreate" || !reflect.DeepEqual(events[1].Argv, []string{"make deps"}) {
+		t.Errorf("lifecycle event = %+v", events[1])
+	}
+	if !reflect.DeepEqual(events[2].Argv, []string{"make", "test"}) {
+		t.Errorf("exec event = %+v", events[2])
+	}
+}
+
+func TestAuditCredentials(t *testing.T) {
+	creds := config.Credentials{SSHAgent: true, GH: true, AWS: true}
+	if got := auditCredentials(creds, "", false); !reflect.DeepEqual(got, []string{"ssh-agent", "gh", "aws", "claude"}) {
+		t.Errorf("auditCredentials() = %v", got)
+	}
+	creds.Claude = config.ClaudeCredsNone
+	if got := auditCredentials(creds, "acme/api", false); !reflect.DeepEqual(got, []string{"ssh-agent", "gh:acme/api", "aws"}) {
+		t.Errorf("auditCredentials() = %v, want the token's repository", got)
+	}
+	if got := auditCredentials(creds, "", true); !reflect.DeepEqual(got, []string{"ssh-agent", "aws"}) {
+		t.Errorf("auditCredentials() = %v, want a withheld gh token left out", got)
+	}
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+)
+
+// autoPullStaleAfter is how long a background pull may stay unfinished before
+// it is reported as failed and retried on the next check
+const autoPullStaleAfter = 24 * time.Hour
+
+// autoPullLogPath returns the log file background pulls write to
+func autoPullLogPath() string {
+	return filepath.Join(filepath.Dir(container.LastUsedPath()), "auto-pull.log")
+}
+
+// startBackgroundPull pulls image in a detached process that outlives packnplay,
+// so the pull doesn't delay the container being started; replaced in tests
+var startBackgroundPull = func(runtime, image string) error {
+	logPath := autoPullLogPath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open pull log: %w", err)
+	}
+	defer func() { _ = logFile.Close() }()
+	fmt.Fprintf(logFile, "%s: %s pull %s\n", time.Now().Format(time.RFC3339), runtime, image)
+
+	cmd := exec.Command(runtime, "pull", image)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s pull: %w", runtime, err)
+	}
+	return cmd.Process.Release()
+}
+
+// autoPullUpdate starts a background pull of a newer imageName unless one for
+// the same digest is already pending
+func autoPullUpdate(runtime, imageName string, localInfo, remoteInfo *ImageVersionInfo, tracking *config.VersionTrackingData) error {
+	if pending, ok := tracking.AutoPulls[imageName]; ok && pending.ToDigest == remoteInfo.Digest {
+		return nil
+	}
+	if err := startBackgroundPull(runtime, imageName); err != nil {
+		return err
+	}
+	tracking.AutoPulls[imageName] = config.AutoPull{
+		FromDigest:  localInfo.Digest,
+		FromCreated: localInfo.Created,
+		ToDigest:    remoteInfo.Digest,
+		StartedAt:   time.Now(),
+	}
+	fmt.Fprintf(os.Stderr, "ℹ️  Pulling new version of %s (%s) in the background; new containers will use it once it finishes\n",
+		imageName, remoteInfo.ShortDigest())
+	return nil
+}
+
+// reportAutoPull announces a finished background pull of imageName, or gives up
+// on one that never finished. Returns true when tracking changed.
+func reportAutoPull(dockerClient DockerClient, tracking *config.VersionTrackingData, imageName string) bool {
+	pending, ok := tracking.AutoPulls[imageName]
+	if !ok {
+		return false
+	}
+
+	localInfo, err := getLocalImageInfo(dockerClient, imageName)
+	if err == nil && localInfo.Digest != pending.FromDigest {
+		fmt.Fprintln(os.Stderr, formatAutoPullSummary(imageName, pending, localInfo))
+		delete(tracking.AutoPulls, imageName)
+		return true
+	}
+	if time.Since(pending.StartedAt) > autoPullStaleAfter {
+		fmt.Fprintf(os.Stderr, "Warning: background pull of %s did not finish; see %s\n", imageName, autoPullLogPath())
+		delete(tracking.AutoPulls, imageName)
+		return true
+	}
+	return false
+}
+
+// formatAutoPullSummary describes an image update completed in the background
+func formatAutoPullSummary(imageName string, pending config.AutoPull, current *ImageVersionInfo) string {
+	previous := &ImageVersionInfo{Digest: pending.FromDigest, Created: pending.FromCreated}
+	return fmt.Sprintf(`✅ Updated %s in the background
+   Was: %s (%s)
+   Now: %s (%s)
+
+   New containers use it; to move an existing one: packnplay refresh-container`,
+		imageName,
+		previous.ShortDigest(), previous.AgeString(),
+		current.ShortDigest(), current.AgeString())
+}
@@ -0,0 +1,155 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+)
+
+// writeUpdateConfig writes a config enabling auto-pull under XDG_CONFIG_HOME
+func writeUpdateConfig(t *testing.T, baseImages bool) {
+	t.Helper()
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := &config.Config{
+		ContainerRuntime: "docker",
+		DefaultContainer: config.GetDefaultContainerConfig(),
+	}
+	cfg.DefaultContainer.AutoPullUpdates = true
+	cfg.DefaultContainer.AutoPullBaseImages = baseImages
+	if err := os.MkdirAll(filepath.Join(configHome, "packnplay"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Save(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stubAutoPull replaces the registry lookup and background pull for a test
+func stubAutoPull(t *testing.T, remoteDigest string) *[]string {
+	t.Helper()
+	origDigest, origPull := registryDigest, startBackgroundPull
+	t.Cleanup(func() { registryDigest, startBackgroundPull = origDigest, origPull })
+
+	registryDigest = func(ref string) (string, error) { return remoteDigest, nil }
+	var pulls []string
+	startBackgroundPull = func(runtime, image string) error {
+		pulls = append(pulls, runtime+" pull "+image)
+		return nil
+	}
+	return &pulls
+}
+
+func TestAutoPullUpdates(t *testing.T) {
+	writeUpdateConfig(t, false)
+	pulls := stubAutoPull(t, "sha256:new456")
+	image := "ghcr.io/obra/packnplay/devcontainer:latest"
+
+	client := &inspectClient{inspectOutput: `["ghcr.io/obra/packnplay/devcontainer@sha256:old123"]|2024-05-01T10:00:00Z`}
+	if err := checkAndNotifyAboutUpdates(client, image, false); err != nil {
+		t.Fatalf("checkAndNotifyAboutUpdates() error = %v", err)
+	}
+	if len(*pulls) != 1 || (*pulls)[0] != "docker pull "+image {
+		t.Fatalf("background pulls = %v, want one pull of %s", *pulls, image)
+	}
+
+	tracking, err := config.LoadVersionTracking(config.GetVersionTrackingPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := tracking.AutoPulls[image]
+	if pending.FromDigest != "sha256:old123" || pending.ToDigest != "sha256:new456" {
+		t.Errorf("pending pull = %+v", pending)
+	}
+	if _, notified := tracking.Notifications[image]; notified {
+		t.Error("auto-pull should replace the update notification")
+	}
+
+	// The pull finished: the next run reports it and forgets it
+	client.inspectOutput = `["ghcr.io/obra/packnplay/devcontainer@sha256:new456"]|2024-06-01T10:00:00Z`
+	if err := checkAndNotifyAboutUpdates(client, image, false); err != nil {
+		t.Fatalf("checkAndNotifyAboutUpdates() error = %v", err)
+	}
+	tracking, err = config.LoadVersionTracking(config.GetVersionTrackingPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tracking.AutoPulls[image]; ok {
+		t.Error("completed pull should be cleared")
+	}
+	if len(*pulls) != 1 {
+		t.Errorf("background pulls = %v, want no new pull", *pulls)
+	}
+}
+
+func TestAutoPullBaseImages(t *testing.T) {
+	image := "mcr.microsoft.com/devcontainers/go:1"
+	client := &inspectClient{inspectOutput: `["mcr.microsoft.com/devcontainers/go@sha256:old123"]|2024-05-01T10:00:00Z`}
+
+	writeUpdateConfig(t, false)
+	pulls := stubAutoPull(t, "sha256:new456")
+	if err := checkAndNotifyAboutUpdates(client, image, false); err != nil {
+		t.Fatalf("checkAndNotifyAboutUpdates() error = %v", err)
+	}
+	if len(*pulls) != 0 {
+		t.Fatalf("base image pulled without auto_pull_base_images: %v", *pulls)
+	}
+
+	writeUpdateConfig(t, true)
+	pulls = stubAutoPull(t, "sha256:new456")
+	if err := checkAndNotifyAboutUpdates(client, image, false); err != nil {
+		t.Fatalf("checkAndNotifyAboutUpdates() error = %v", err)
+	}
+	if len(*pulls) != 1 {
+		t.Fatalf("background pulls = %v, want one", *pulls)
+	}
+	tracking, err := config.LoadVersionTracking(config.GetVersionTrackingPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.BaseImageChecks[image].IsZero() {
+		t.Error("base image check time should be recorded")
+	}
+	if !tracking.LastCheck.IsZero() {
+		t.Error("base image checks should not delay the default image check")
+	}
+}
+
+func TestReportAutoPullGivesUpOnStalePull(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	image := "ghcr.io/obra/packnplay/devcontainer:latest"
+	tracking := &config.VersionTrackingData{AutoPulls: map[string]config.AutoPull{
+		image: {FromDigest: "sha256:old123", ToDigest: "sha256:new456", StartedAt: time.Now().Add(-2 * autoPullStaleAfter)},
+	}}
+	client := &inspectClient{inspectOutput: `["ghcr.io/obra/packnplay/devcontainer@sha256:old123"]|2024-05-01T10:00:00Z`}
+
+	if !reportAutoPull(client, tracking, image) {
+		t.Fatal("reportAutoPull() should drop a stale pull")
+	}
+	if len(tracking.AutoPulls) != 0 {
+		t.Errorf("AutoPulls = %v, want empty", tracking.AutoPulls)
+	}
+
+	tracking.AutoPulls[image] = config.AutoPull{FromDigest: "sha256:old123", ToDigest: "sha256:new456", StartedAt: time.Now()}
+	if reportAutoPull(client, tracking, image) {
+		t.Error("reportAutoPull() should keep waiting on a recent pull")
+	}
+}
+
+func TestFormatAutoPullSummary(t *testing.T) {
+	pending := config.AutoPull{FromDigest: "sha256:abc123def456", FromCreated: time.Now().Add(-72 * time.Hour)}
+	current := &ImageVersionInfo{Digest: "sha256:xyz789ghi012", Created: time.Now().Add(-2 * time.Hour)}
+
+	message := formatAutoPullSummary("ghcr.io/obra/packnplay/devcontainer:latest", pending, current)
+	for _, want := range []string{"abc123de", "3 days old", "xyz789gh", "2 hours old", "packnplay refresh-container"} {
+		if !containsString(message, want) {
+			t.Errorf("summary missing %q:\n%s", want, message)
+		}
+	}
+}
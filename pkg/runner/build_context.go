@@ -0,0 +1,228 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// DefaultBuildContextWarnMB is the build context size, after .dockerignore, above
+// which packnplay warns before a Dockerfile build
+const DefaultBuildContextWarnMB = 200
+
+// errContextTooLarge stops measuring a build context once it passes the limit
+var errContextTooLarge = errors.New("build context exceeds limit")
+
+// dockerIgnore holds .dockerignore patterns, matched the way the Docker CLI
+// matches them: relative to the context root, ** spanning directories, !
+// re-including, and a pattern that matches a directory covering its contents
+type dockerIgnore struct {
+	patterns      []ignorePattern
+	hasExceptions bool
+}
+
+type ignorePattern struct {
+	re        *regexp.Regexp
+	exception bool
+}
+
+// loadDockerIgnore reads the ignore file Docker would use for a build: the
+// Dockerfile-specific <Dockerfile>.dockerignore if present, else the context's
+// .dockerignore. It returns the file's path, empty when there is none.
+func loadDockerIgnore(contextDir, dockerfilePath string) (*dockerIgnore, string) {
+	candidates := []string{filepath.Join(contextDir, ".dockerignore")}
+	if dockerfilePath != "" {
+		candidates = append([]string{dockerfilePath + ".dockerignore"}, candidates...)
+	}
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return parseDockerIgnore(string(data)), path
+		}
+	}
+	return &dockerIgnore{}, ""
+}
+
+// parseDockerIgnore parses .dockerignore content, skipping comments and
+// patterns that don't compile
+func parseDockerIgnore(content string) *dockerIgnore {
+	ignore := &dockerIgnore{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := strings.HasPrefix(line, "!")
+		if exception {
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(line)), "/")
+		if line == "" || line == "." {
+			continue
+		}
+		re, err := regexp.Compile(ignorePatternRegexp(line))
+		if err != nil {
+			continue
+		}
+		ignore.patterns = append(ignore.patterns, ignorePattern{re: re, exception: exception})
+		ignore.hasExceptions = ignore.hasExceptions || exception
+	}
+	return ignore
+}
+
+// ignorePatternRegexp translates a .dockerignore glob into an anchored regexp
+func ignorePatternRegexp(pattern string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// matches reports whether rel (slash-separated, relative to the context root)
+// is left out of the context, either itself or through a parent directory
+func (di *dockerIgnore) matches(rel string) bool {
+	parents := strings.Split(rel, "/")
+	ignored := false
+	for _, p := range di.patterns {
+		matched := p.re.MatchString(rel)
+		for i := 1; !matched && i < len(parents); i++ {
+			matched = p.re.MatchString(strings.Join(parents[:i], "/"))
+		}
+		if matched {
+			ignored = !p.exception
+		}
+	}
+	return ignored
+}
+
+// walkContext calls fn with each regular file Docker would send for
+// contextDir, given its slash-separated path relative to contextDir
+func walkContext(contextDir string, ignore *dockerIgnore, fn func(rel string, entry fs.DirEntry) error) error {
+	return filepath.WalkDir(contextDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if ignore.matches(filepath.ToSlash(rel)) {
+			// An exception may re-include something inside an ignored directory
+			if entry.IsDir() && !ignore.hasExceptions {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		return fn(filepath.ToSlash(rel), entry)
+	})
+}
+
+// contextSize adds up the size of the files Docker would send for contextDir.
+// Once the total passes limit (when positive) it stops and returns
+// errContextTooLarge, so measuring a huge context stays cheap.
+func contextSize(contextDir string, ignore *dockerIgnore, limit int64) (int64, error) {
+	var size int64
+	err := walkContext(contextDir, ignore, func(rel string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		if limit > 0 && size > limit {
+			return errContextTooLarge
+		}
+		return nil
+	})
+	return size, err
+}
+
+// warnLargeContext warns when the files a build would send from contextDir
+// (after .dockerignore) pass the configured size
+func (im *ImageManager) warnLargeContext(contextDir, dockerfilePath string) {
+	if im.contextWarnMB <= 0 {
+		return
+	}
+	limit := int64(im.contextWarnMB) << 20
+
+	ignore, ignoreFile := loadDockerIgnore(contextDir, dockerfilePath)
+	_, err := contextSize(contextDir, ignore, limit)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, errContextTooLarge) {
+		if im.verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to measure build context %s: %v\n", contextDir, err)
+		}
+		return
+	}
+
+	hint := "add a .dockerignore leaving out what the build doesn't need (e.g. node_modules, .git)"
+	if ignoreFile != "" {
+		hint = fmt.Sprintf("extend %s to leave out what the build doesn't need", ignoreFile)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: build context %s is over %dMB after .dockerignore, all of which is sent to the daemon; %s\n", contextDir, im.contextWarnMB, hint)
+}
+
+// featureBuildContext creates a throwaway build context holding only the
+// features of a feature build, so the project itself is never sent to the
+// daemon. Each feature is staged into it (honoring .featureignore) and its
+// InstallPath updated. The caller removes the returned directory.
+func featureBuildContext(features []*devcontainer.ResolvedFeature) (string, error) {
+	contextDir, err := os.MkdirTemp("", "packnplay-build-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build context: %w", err)
+	}
+	stagingRoot := filepath.Join(contextDir, featureStagingDir)
+	for _, feature := range features {
+		destDir, err := stageFeature(feature.InstallPath, stagingRoot)
+		if err != nil {
+			os.RemoveAll(contextDir)
+			return "", fmt.Errorf("failed to copy feature %s into build context: %w", feature.ID, err)
+		}
+		feature.InstallPath = destDir
+	}
+	return contextDir, nil
+}
@@ -0,0 +1,138 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerIgnoreMatches(t *testing.T) {
+	ignore := parseDockerIgnore(`
+# dependencies
+node_modules
+**/*.log
+/build
+docs/*.pdf
+!docs/keep.pdf
+.git/
+`)
+	tests := map[string]bool{
+		"node_modules":              true,
+		"node_modules/react/index":  true,
+		"web/node_modules":          false, // not anchored with **
+		"server.log":                true,
+		"web/logs/server.log":       true,
+		"build/out.bin":             true,
+		"src/build":                 false,
+		"docs/guide.pdf":            true,
+		"docs/keep.pdf":             false,
+		"docs/sub/guide.pdf":        false,
+		".git/HEAD":                 true,
+		"src/main.go":               false,
+		"node_modules_backup/a.txt": false,
+	}
+	for path, want := range tests {
+		if got := ignore.matches(path); got != want {
+			t.Errorf("matches(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestLoadDockerIgnorePrefersDockerfileSpecific(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, ".devcontainer", "Dockerfile")
+	if err := os.MkdirAll(filepath.Dir(dockerfile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("vendor\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ignore, path := loadDockerIgnore(dir, dockerfile)
+	if path != filepath.Join(dir, ".dockerignore") || !ignore.matches("vendor/x") {
+		t.Errorf("loadDockerIgnore() = %s, want the context's .dockerignore", path)
+	}
+
+	if err := os.WriteFile(dockerfile+".dockerignore", []byte("data\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ignore, path = loadDockerIgnore(dir, dockerfile)
+	if path != dockerfile+".dockerignore" || ignore.matches("vendor/x") || !ignore.matches("data") {
+		t.Errorf("loadDockerIgnore() = %s, want the Dockerfile-specific ignore file", path)
+	}
+}
+
+func TestContextSize(t *testing.T) {
+	dir := t.TempDir()
+	writeSized := func(rel string, size int) {
+		t.Helper()
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSized("src/main.go", 100)
+	writeSized("node_modules/big/blob", 5000)
+	writeSized("node_modules/keep/license", 10)
+
+	size, err := contextSize(dir, parseDockerIgnore("node_modules"), 0)
+	if err != nil || size != 100 {
+		t.Errorf("contextSize() = %d, %v; want 100 with node_modules ignored", size, err)
+	}
+	size, err = contextSize(dir, parseDockerIgnore("node_modules\n!node_modules/keep"), 0)
+	if err != nil || size != 110 {
+		t.Errorf("contextSize() = %d, %v; want 110 with an exception re-including a file", size, err)
+	}
+	if _, err := contextSize(dir, &dockerIgnore{}, 1000); !errors.Is(err, errContextTooLarge) {
+		t.Errorf("contextSize() error = %v, want errContextTooLarge", err)
+	}
+}
+
+func TestWarnLargeContext(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "blob"), make([]byte, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	im := NewImageManager(&mockDockerClient{}, false)
+	im.SetContextWarnSize(1)
+
+	warning := captureStderr(t, func() { im.warnLargeContext(dir, "") })
+	if !strings.Contains(warning, "over 1MB") || !strings.Contains(warning, "add a .dockerignore") {
+		t.Errorf("warning = %q", warning)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("blob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if warning := captureStderr(t, func() { im.warnLargeContext(dir, "") }); warning != "" {
+		t.Errorf("ignored files should not count toward the limit: %q", warning)
+	}
+}
+
+// captureStderr returns what fn writes to os.Stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = orig }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r)
+		done <- buf.String()
+	}()
+	fn()
+	_ = w.Close()
+	return <-done
+}
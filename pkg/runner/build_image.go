@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// BuildProjectImage pulls or builds the image of the project at config.Path,
+// with its features, as a run would, without creating a container or running
+// lifecycle commands. The image is also tagged as each of tags, which are
+// pushed when push is set. It returns the image's local name followed by
+// tags.
+func BuildProjectImage(config *RunConfig, tags []string, push bool) ([]string, error) {
+	project := *config
+	project.NoWorktree = true
+	project.DryRun = false
+
+	dockerClient, err := newDockerClient(project.Runtime, project.Verbose)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to initialize container runtime: %w", err)
+	}
+	ws, err := ResolveWorkspace(&project)
+	if err != nil {
+		return nil, err
+	}
+	devConfig, err := ResolveConfig(&project, ws)
+	if err != nil {
+		return nil, err
+	}
+	if len(devConfig.GetDockerComposeFiles()) > 0 {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "the project's images are built by Docker Compose; use docker compose build")
+	}
+	lockfile, err := devcontainer.LoadLockFile(ws.MountPath)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load lockfile: %w", err)
+	}
+
+	imageName, err := ensureImage(dockerClient, &project, ws, devConfig, lockfile, nil)
+	if err != nil {
+		return nil, err
+	}
+	references := []string{imageName}
+	for _, tag := range tags {
+		if output, err := dockerClient.Run("tag", imageName, tag); err != nil {
+			return nil, fmt.Errorf("failed to tag %s as %s: %w\n%s", imageName, tag, err, output)
+		}
+		references = append(references, tag)
+	}
+	if push {
+		for _, tag := range tags {
+			if err := dockerClient.RunWithProgress(tag, "push", tag); err != nil {
+				return nil, fmt.Errorf("failed to push %s: %w", tag, err)
+			}
+		}
+	}
+	return references, nil
+}
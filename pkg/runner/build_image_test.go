@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestBuildProjectImageTagsAndPushes(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"build": {"dockerfile": "Dockerfile"}, "postCreateCommand": "make setup"}`)
+	if err := os.WriteFile(filepath.Join(project, ".devcontainer", "Dockerfile"), []byte("FROM alpine:3.20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := []string{"ghcr.io/acme/api-dev:abc123", "ghcr.io/acme/api-dev:latest"}
+	references, err := BuildProjectImage(&RunConfig{Path: project}, tags, true)
+	if err != nil {
+		t.Fatalf("BuildProjectImage() error = %v", err)
+	}
+	image := container.GenerateImageName(project)
+	if len(references) != 3 || references[0] != image || !contains(references, tags...) {
+		t.Errorf("references = %v, want %s then the tags", references, image)
+	}
+	if len(fake.CallsTo("build")) != 1 {
+		t.Errorf("the image should be built once: %v", fake.Calls())
+	}
+	for _, tag := range tags {
+		if len(fake.CallsTo("tag", image, tag)) != 1 {
+			t.Errorf("expected %s to be tagged %s: %v", image, tag, fake.Calls())
+		}
+		if len(fake.CallsTo("push", tag)) != 1 {
+			t.Errorf("expected %s to be pushed: %v", tag, fake.Calls())
+		}
+	}
+	if len(fake.CallsTo("run")) != 0 || len(fake.CallsTo("create")) != 0 || len(fake.CallsTo("exec")) != 0 {
+		t.Errorf("building shouldn't start containers or run commands: %v", fake.Calls())
+	}
+}
+
+func TestBuildProjectImageWithoutPush(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20"}`)
+
+	references, err := BuildProjectImage(&RunConfig{Path: project}, []string{"registry.local/dev:1"}, false)
+	if err != nil {
+		t.Fatalf("BuildProjectImage() error = %v", err)
+	}
+	if len(references) != 2 || references[0] != "alpine:3.20" {
+		t.Errorf("references = %v, want the project's image then the tag", references)
+	}
+	if len(fake.CallsTo("push")) != 0 {
+		t.Errorf("nothing should be pushed without push: %v", fake.Calls())
+	}
+}
+
+func TestBuildProjectImageRejectsCompose(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	project := newProject(t, `{"dockerComposeFile": "compose.yml", "service": "app"}`)
+	if _, err := BuildProjectImage(&RunConfig{Path: project}, nil, false); err == nil {
+		t.Fatal("expected an error for a compose project")
+	}
+}
@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// buildSecretArgs returns the docker build --secret and --ssh arguments for
+// customizations.packnplay.build. Values never appear on the command line:
+// environment variables are passed by name, files by path, and secrets from
+// the credential store are written to a file only the user can read, in the
+// RAM-backed runtime directory, which cleanup removes once the build is done.
+// Relative file paths are relative to the .devcontainer directory.
+//
+// The repository controls both this configuration and the Dockerfile, which
+// could copy what it's given into an image layer, so environment variables,
+// files, secrets from the store and SSH access must be allowed in the user's
+// config.
+func buildSecretArgs(build *devcontainer.BuildCustomization, configDir, storeBackend string, allowed config.BuildSecretsConfig) (args []string, cleanup func(), err error) {
+	var files []string
+	cleanup = func() {
+		for _, path := range files {
+			os.Remove(path)
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+	if build == nil {
+		return nil, cleanup, nil
+	}
+
+	ids := make([]string, 0, len(build.Secrets))
+	for id := range build.Secrets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var store credstore.Store
+	for _, id := range ids {
+		secret := build.Secrets[id]
+		switch {
+		case secret.Env != "":
+			if !slices.Contains(allowed.Env, secret.Env) {
+				return nil, cleanup, notAllowedError(id, "environment variable "+secret.Env, "build_secrets.env")
+			}
+			if _, ok := os.LookupEnv(secret.Env); !ok {
+				return nil, cleanup, errdefs.Errorf(errdefs.CategoryConfig, "build secret %q: environment variable %s is not set", id, secret.Env)
+			}
+			args = append(args, "--secret", "id="+id+",env="+secret.Env)
+		case secret.File != "":
+			homeDir, _ := os.UserHomeDir()
+			path := expandExcludePath(secret.File, homeDir)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(configDir, path)
+			}
+			if !slices.ContainsFunc(allowed.Files, func(file string) bool { return expandExcludePath(file, homeDir) == path }) {
+				return nil, cleanup, notAllowedError(id, path, "build_secrets.files")
+			}
+			if !fileExists(path) {
+				return nil, cleanup, errdefs.Errorf(errdefs.CategoryConfig, "build secret %q: %s does not exist", id, path)
+			}
+			args = append(args, "--secret", "id="+id+",src="+path)
+		case secret.Store != "":
+			if !slices.Contains(allowed.Store, secret.Store) {
+				return nil, cleanup, notAllowedError(id, "stored secret "+secret.Store, "build_secrets.store")
+			}
+			if store == nil {
+				if store, err = credstore.Open(storeBackend, credstore.DefaultDir()); err != nil {
+					return nil, cleanup, err
+				}
+			}
+			value, err := store.Get(credstore.BuildSecretKey(secret.Store))
+			if errors.Is(err, credstore.ErrNotFound) {
+				return nil, cleanup, errdefs.Errorf(errdefs.CategoryConfig, "build secret %q: %s is not in the %s credential store; add it with: packnplay secret set %s", id, secret.Store, store.Name(), secret.Store)
+			} else if err != nil {
+				return nil, cleanup, fmt.Errorf("build secret %q: %w", id, err)
+			}
+			path, err := writeBuildSecretFile(value)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("build secret %q: %w", id, err)
+			}
+			files = append(files, path)
+			args = append(args, "--secret", "id="+id+",src="+path)
+		}
+	}
+
+	for _, ssh := range build.SSH {
+		if !slices.Contains(allowed.SSH, ssh) {
+			return nil, cleanup, notAllowedError("ssh", ssh, "build_secrets.ssh")
+		}
+		if ssh == "default" && os.Getenv("SSH_AUTH_SOCK") == "" {
+			return nil, cleanup, errdefs.Errorf(errdefs.CategoryConfig, "build ssh %q forwards the SSH agent, but SSH_AUTH_SOCK is not set", ssh)
+		}
+		args = append(args, "--ssh", ssh)
+	}
+	return args, cleanup, nil
+}
+
+// notAllowedError reports a build secret source the user's config doesn't allow
+func notAllowedError(id, source, key string) error {
+	return errdefs.Errorf(errdefs.CategoryConfig, "build secret %q reads %s, which the project can't hand to its build unless you add it to %s in config.json", id, source, key)
+}
+
+// writeBuildSecretFile writes value to a new file in the runtime directory,
+// readable only by the user
+func writeBuildSecretFile(value []byte) (string, error) {
+	f, err := credstore.CreateRuntimeTemp("build-secret-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(value); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write secret file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// withBuildContextLast inserts extra arguments into a build command line
+// before its final argument, the build context
+func withBuildContextLast(args, extra []string) []string {
+	if len(extra) == 0 || len(args) == 0 {
+		return args
+	}
+	last := len(args) - 1
+	return append(append(append([]string{}, args[:last]...), extra...), args[last])
+}
@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestBuildSecretArgs(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("PIP_TOKEN", "s3cret")
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	configDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(configDir, "npmrc"), []byte("//npm.acme.dev/:_authToken=abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := credstore.NewFileStore(credstore.DefaultDir()).Set(credstore.BuildSecretKey("index"), []byte("from-store")); err != nil {
+		t.Fatal(err)
+	}
+
+	args, cleanup, err := buildSecretArgs(&devcontainer.BuildCustomization{
+		Secrets: map[string]devcontainer.BuildSecret{
+			"pip":   {Env: "PIP_TOKEN"},
+			"npmrc": {File: "npmrc"},
+			"index": {Store: "index"},
+		},
+		SSH: []string{"default"},
+	}, configDir, credstore.BackendFile, config.BuildSecretsConfig{
+		Env:   []string{"PIP_TOKEN"},
+		Files: []string{filepath.Join(configDir, "npmrc")},
+		Store: []string{"index"},
+		SSH:   []string{"default"},
+	})
+	if err != nil {
+		t.Fatalf("buildSecretArgs() error = %v", err)
+	}
+	joined := strings.Join(args, " ")
+	if strings.Contains(joined, "s3cret") || strings.Contains(joined, "from-store") {
+		t.Fatalf("args = %v, secret values must not be on the command line", args)
+	}
+	for _, want := range []string{"--secret id=pip,env=PIP_TOKEN", "--secret id=npmrc,src=" + filepath.Join(configDir, "npmrc"), "--ssh default"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args = %v, want %q", args, want)
+		}
+	}
+
+	// Secrets are passed sorted by id, so index comes first
+	storeFile := strings.TrimPrefix(argValue(args, "--secret"), "id=index,src=")
+	if data, err := os.ReadFile(storeFile); err != nil || string(data) != "from-store" {
+		t.Errorf("store secret file %s = %q, %v", storeFile, data, err)
+	}
+	if info, err := os.Stat(storeFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("store secret file mode = %v, %v; want 0600", info, err)
+	}
+	cleanup()
+	if _, err := os.Stat(storeFile); !os.IsNotExist(err) {
+		t.Errorf("cleanup should remove %s: %v", storeFile, err)
+	}
+}
+
+func TestBuildSecretArgsMissingSource(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	os.Unsetenv("PACKNPLAY_TEST_UNSET")
+	tests := map[string]*devcontainer.BuildCustomization{
+		"env":   {Secrets: map[string]devcontainer.BuildSecret{"pip": {Env: "PACKNPLAY_TEST_UNSET"}}},
+		"file":  {Secrets: map[string]devcontainer.BuildSecret{"npmrc": {File: "missing"}}},
+		"store": {Secrets: map[string]devcontainer.BuildSecret{"index": {Store: "missing"}}},
+		"ssh":   {SSH: []string{"default"}},
+	}
+	for name, build := range tests {
+		t.Run(name, func(t *testing.T) {
+			configDir := t.TempDir()
+			allowed := config.BuildSecretsConfig{
+				Env:   []string{"PACKNPLAY_TEST_UNSET"},
+				Files: []string{filepath.Join(configDir, "missing")},
+				Store: []string{"missing"},
+				SSH:   []string{"default"},
+			}
+			if _, _, err := buildSecretArgs(build, configDir, credstore.BackendFile, allowed); err == nil || strings.Contains(err.Error(), "config.json") {
+				t.Errorf("buildSecretArgs() error = %v, want the missing source reported", err)
+			}
+		})
+	}
+}
+
+func TestBuildSecretArgsNotAllowed(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant")
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// What the user allowed for their own builds
+	allowed := config.BuildSecretsConfig{Env: []string{"NPM_TOKEN"}, Files: []string{"~/.npmrc"}, Store: []string{"npm-token"}, SSH: []string{"github=~/.ssh/deploy"}}
+
+	tests := map[string]struct {
+		build *devcontainer.BuildCustomization
+		key   string
+	}{
+		"env":  {&devcontainer.BuildCustomization{Secrets: map[string]devcontainer.BuildSecret{"key": {Env: "ANTHROPIC_API_KEY"}}}, "build_secrets.env"},
+		"file": {&devcontainer.BuildCustomization{Secrets: map[string]devcontainer.BuildSecret{"key": {File: "~/.ssh/id_ed25519"}}}, "build_secrets.files"},
+		"ssh":  {&devcontainer.BuildCustomization{SSH: []string{"default"}}, "build_secrets.ssh"},
+		// Stored for another project's build
+		"store": {&devcontainer.BuildCustomization{Secrets: map[string]devcontainer.BuildSecret{"key": {Store: "prod-deploy-key"}}}, "build_secrets.store"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			args, _, err := buildSecretArgs(tt.build, t.TempDir(), credstore.BackendFile, allowed)
+			if err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("buildSecretArgs() = %v, %v; want the source refused until allowed in %s", args, err, tt.key)
+			}
+		})
+	}
+}
+
+func TestBuildImagePassesSecretsBeforeContext(t *testing.T) {
+	t.Setenv("PIP_TOKEN", "s3cret")
+	fake := dockertest.New()
+	project := newProject(t, `{
+		"build": {"dockerfile": "Dockerfile"},
+		"customizations": {"packnplay": {"build": {"secrets": {"pip": {"env": "PIP_TOKEN"}}}}}
+	}`)
+	devConfig, err := devcontainer.LoadConfig(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewImageManager(fake, false).EnsureAvailable(devConfig, project); err == nil {
+		t.Fatal("EnsureAvailable() should refuse a build secret config.json doesn't allow")
+	}
+	imageManager := NewImageManager(fake, false)
+	imageManager.SetBuildSecrets(config.BuildSecretsConfig{Env: []string{"PIP_TOKEN"}})
+	if err := imageManager.EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	builds := fake.CallsTo("build")
+	if len(builds) != 1 {
+		t.Fatalf("build calls = %v, want one", fake.Calls())
+	}
+	build := builds[0]
+	if argValue(build, "--secret") != "id=pip,env=PIP_TOKEN" || build[len(build)-1] != filepath.Join(project, ".devcontainer") {
+		t.Errorf("build = %v, want the secret passed and the context last", build)
+	}
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// minHostCredentialsSize is the smallest host .credentials.json taken to hold
+// credentials rather than an empty placeholder ("{}")
+const minHostCredentialsSize = 20
+
+// ClaudeCredentials is where a container's ~/.claude/.credentials.json comes
+// from, and why
+type ClaudeCredentials struct {
+	Source string `json:"source"` // host, managed, or none (see config.ClaudeCredsHost)
+	Reason string `json:"reason"`
+}
+
+// Overlay reports whether the container-managed credential file is mounted
+// over the host's
+func (c ClaudeCredentials) Overlay() bool {
+	return c.Source == config.ClaudeCredsManaged
+}
+
+// resolveClaudeCredentials decides where Claude credentials come from. In
+// auto mode the host's file is used when it holds credentials; an empty or
+// missing one (the host logs in through the macOS Keychain, or not at all) is
+// replaced with the container-managed file.
+func resolveClaudeCredentials(mode, hostCredFile string) (ClaudeCredentials, error) {
+	switch mode {
+	case "", config.ClaudeCredsAuto:
+	case config.ClaudeCredsHost:
+		reason := "default_credentials.claude is host"
+		if size := getFileSize(hostCredFile); size < minHostCredentialsSize {
+			reason += fmt.Sprintf(" (%s holds no credentials yet; log in inside the container to create them)", hostCredFile)
+		}
+		return ClaudeCredentials{Source: config.ClaudeCredsHost, Reason: reason}, nil
+	case config.ClaudeCredsManaged:
+		return ClaudeCredentials{Source: config.ClaudeCredsManaged, Reason: "default_credentials.claude is managed"}, nil
+	case config.ClaudeCredsNone:
+		return ClaudeCredentials{Source: config.ClaudeCredsNone, Reason: "default_credentials.claude is none: ~/.claude is mounted as is"}, nil
+	default:
+		return ClaudeCredentials{}, errdefs.Errorf(errdefs.CategoryConfig, "invalid default_credentials.claude %q (use auto, host, managed, or none)", mode)
+	}
+
+	if !fileExists(hostCredFile) {
+		return ClaudeCredentials{Source: config.ClaudeCredsManaged, Reason: "host has no .credentials.json"}, nil
+	}
+	if size := getFileSize(hostCredFile); size < minHostCredentialsSize {
+		return ClaudeCredentials{Source: config.ClaudeCredsManaged, Reason: fmt.Sprintf("host .credentials.json is too small (%d bytes)", size)}, nil
+	}
+	return ClaudeCredentials{Source: config.ClaudeCredsHost, Reason: fmt.Sprintf("host .credentials.json (%d bytes)", getFileSize(hostCredFile))}, nil
+}
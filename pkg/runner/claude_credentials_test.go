@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestResolveClaudeCredentials(t *testing.T) {
+	dir := t.TempDir()
+	full := filepath.Join(dir, "full.json")
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(full, []byte(`{"claudeAiOauth":{"accessToken":"token"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+
+	tests := []struct {
+		name     string
+		mode     string
+		hostFile string
+		want     string
+	}{
+		{"auto with host credentials", "", full, config.ClaudeCredsHost},
+		{"auto with empty host file", config.ClaudeCredsAuto, empty, config.ClaudeCredsManaged},
+		{"auto without host file", "", missing, config.ClaudeCredsManaged},
+		{"host without host file", config.ClaudeCredsHost, missing, config.ClaudeCredsHost},
+		{"managed with host credentials", config.ClaudeCredsManaged, full, config.ClaudeCredsManaged},
+		{"none", config.ClaudeCredsNone, empty, config.ClaudeCredsNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveClaudeCredentials(tt.mode, tt.hostFile)
+			if err != nil {
+				t.Fatalf("resolveClaudeCredentials() error = %v", err)
+			}
+			if got.Source != tt.want || got.Reason == "" {
+				t.Errorf("resolveClaudeCredentials(%q, %s) = %+v, want source %s and a reason", tt.mode, filepath.Base(tt.hostFile), got, tt.want)
+			}
+		})
+	}
+
+	if _, err := resolveClaudeCredentials("keychain", full); err == nil {
+		t.Error("resolveClaudeCredentials() should reject an unknown mode")
+	}
+}
+
+func TestRunDryRunClaudeCredentials(t *testing.T) {
+	for _, mode := range []string{config.ClaudeCredsManaged, config.ClaudeCredsNone} {
+		t.Run(mode, func(t *testing.T) {
+			useFakeRuntime(t, dockertest.New())
+			project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+			runConfig := &RunConfig{Path: project, NoWorktree: true, DryRun: true, DryRunJSON: true, Command: []string{"bash"}, Credentials: config.Credentials{Claude: mode}}
+
+			stdout := captureStdout(t, func() {
+				if err := Run(runConfig); err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+			})
+			var spec RunSpec
+			if err := json.Unmarshal([]byte(stdout), &spec); err != nil {
+				t.Fatalf("dry run output is not a RunSpec: %v\n%s", err, stdout)
+			}
+
+			overlaid := strings.Contains(strings.Join(spec.RunArgs, " "), ":/home/root/.claude/.credentials.json")
+			if spec.ClaudeCredentials.Source != mode || overlaid != (mode == config.ClaudeCredsManaged) {
+				t.Errorf("claude credentials = %+v, run args = %v; want %s, overlaid only when managed", spec.ClaudeCredentials, spec.RunArgs, mode)
+			}
+
+			var buf bytes.Buffer
+			if err := PrintRunSpec(&buf, &spec, false); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "Claude:    "+mode+" credentials (") {
+				t.Errorf("output doesn't explain the credential decision:\n%s", buf.String())
+			}
+		})
+	}
+}
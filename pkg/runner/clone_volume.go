@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/git"
+)
+
+// CloneCurrentBranch is the --clone-in-volume ref meaning the branch checked
+// out in the host repository
+const CloneCurrentBranch = "HEAD"
+
+// resolveCloneVolume works out the volume a run --clone-in-volume clones the
+// repository at workDir into, and the pseudo-worktree name its container uses.
+// ref is a branch or tag, or CloneCurrentBranch.
+func resolveCloneVolume(workDir, ref string) (*container.WorkspaceVolume, string, error) {
+	if !git.IsGitRepo(workDir) {
+		return nil, "", errdefs.Errorf(errdefs.CategoryWorktree, "--clone-in-volume needs a git repository, and %s is not one", workDir)
+	}
+	cloneURL, err := git.GetRemoteURL(workDir, "origin")
+	if err != nil || cloneURL == "" {
+		return nil, "", errdefs.Errorf(errdefs.CategoryWorktree, "--clone-in-volume clones the origin remote, and %s has none", workDir)
+	}
+	if isLocalRemote(cloneURL) {
+		return nil, "", errdefs.Errorf(errdefs.CategoryWorktree, "origin remote %s is a host path the container can't clone from", cloneURL)
+	}
+
+	if ref == CloneCurrentBranch {
+		branch, err := git.GetCurrentBranch(workDir)
+		if err != nil {
+			return nil, "", errdefs.Errorf(errdefs.CategoryWorktree, "failed to get current branch: %w", err)
+		}
+		// Empty on a detached HEAD, which clones the remote's default branch
+		ref = branch
+	}
+	volume, worktreeName := newCloneVolume(workDir, cloneURL, ref)
+	return volume, worktreeName, nil
+}
+
+// newCloneVolume describes the volume cloneURL's ref is cloned into for the
+// project at hostPath, and the pseudo-worktree name its container uses
+func newCloneVolume(hostPath, cloneURL, ref string) (*container.WorkspaceVolume, string) {
+	// Named apart from host worktrees so both kinds of container can coexist
+	worktreeName := "volume"
+	if ref != "" {
+		worktreeName += "-" + ref
+	}
+	containerName := container.GenerateContainerName(hostPath, worktreeName)
+	return &container.WorkspaceVolume{
+		Name:      container.WorkspaceVolumeName(containerName),
+		Container: containerName,
+		HostPath:  hostPath,
+		CloneURL:  cloneURL,
+		Ref:       ref,
+		Target:    path.Join("/workspaces", filepath.Base(hostPath)),
+	}, worktreeName
+}
+
+// isLocalRemote reports whether a remote URL points at the host filesystem
+func isLocalRemote(url string) bool {
+	return strings.HasPrefix(url, "/") || strings.HasPrefix(url, ".") || strings.HasPrefix(url, "file://")
+}
+
+// ensureWorkspaceVolume creates the clone volume unless an earlier run did
+func ensureWorkspaceVolume(dockerClient DockerClient, volume *container.WorkspaceVolume, verbose bool) error {
+	if _, err := dockerClient.Run("volume", "inspect", volume.Name); err == nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Using existing workspace volume %s\n", volume.Name)
+		}
+		return nil
+	}
+
+	output, err := dockerClient.Run("volume", "create",
+		"--label", container.LabelManagedBy+"=packnplay",
+		"--label", container.LabelProject+"="+filepath.Base(volume.HostPath),
+		"--label", container.LabelHostPath+"="+volume.HostPath,
+		volume.Name)
+	if err != nil {
+		return fmt.Errorf("failed to create workspace volume %s: %w\n%s", volume.Name, err, output)
+	}
+	return nil
+}
+
+// cloneIntoVolume clones the repository into the volume as user, using the SSH
+// keys, agent or gh credentials the container was given. A volume that already
+// holds a clone is left as it is, so work in it survives recreating the container.
+func cloneIntoVolume(dockerClient DockerClient, containerID, user string, volume *container.WorkspaceVolume, ghCredentials, verbose bool) error {
+	if _, err := dockerClient.Run("exec", containerID, "test", "-e", volume.Target+"/.git"); err == nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Volume %s already holds a clone, skipping git clone\n", volume.Name)
+		}
+		return nil
+	}
+
+	// A new volume's mount point belongs to root
+	if user != "" && user != "root" {
+		if output, err := dockerClient.Run("exec", "-u", "root", containerID, "chown", user, volume.Target); err != nil {
+			return fmt.Errorf("failed to give %s the workspace volume: %w\n%s", user, err, output)
+		}
+	}
+
+	args := []string{"exec"}
+	if user != "" {
+		args = append(args, "-u", user)
+	}
+	// Fail instead of waiting on a prompt nobody can answer; trust a host key on first use
+	args = append(args, "-e", "GIT_TERMINAL_PROMPT=0", "-e", "GIT_SSH_COMMAND=ssh -o StrictHostKeyChecking=accept-new", "-w", "/", containerID, "git")
+	if ghCredentials && strings.HasPrefix(volume.CloneURL, "https://") {
+		args = append(args, "-c", "credential.helper=!gh auth git-credential")
+	}
+	args = append(args, "clone")
+	if volume.Ref != "" {
+		args = append(args, "--branch", volume.Ref)
+	}
+	args = append(args, volume.CloneURL, volume.Target)
+
+	ref := volume.Ref
+	if ref == "" {
+		ref = "default branch"
+	}
+	fmt.Fprintf(os.Stderr, "Cloning %s (%s) into volume %s...\n", volume.CloneURL, ref, volume.Name)
+	if output, err := dockerClient.Run(args...); err != nil {
+		return fmt.Errorf("failed to clone %s into volume %s: %w\n%s", volume.CloneURL, volume.Name, err, output)
+	}
+	return nil
+}
+
+// recordWorkspaceVolume tracks the volume for reuse and `packnplay volume`
+func recordWorkspaceVolume(volume *container.WorkspaceVolume, verbose bool) {
+	record := *volume
+	record.Created = time.Now()
+	record.LastUsed = record.Created
+	if err := container.RecordVolume(container.VolumesPath(), record); err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record workspace volume: %v\n", err)
+	}
+}
@@ -0,0 +1,192 @@
+package runner
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+// newRepoProject creates a project that is a git repository on branch main
+// with the given origin remote
+func newRepoProject(t *testing.T, devcontainerJSON, origin string) string {
+	t.Helper()
+	project := newProject(t, devcontainerJSON)
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"remote", "add", "origin", origin}} {
+		if output, err := exec.Command("git", append([]string{"-C", project}, args...)...).CombinedOutput(); err != nil {
+			t.Skipf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	return project
+}
+
+func TestRunCloneInVolume(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	fake.Fail(errors.New("exit status 1"), "Error: no such volume", "volume", "inspect")
+	fake.Exec = func(c *dockertest.Container, command []string) (string, error) {
+		if command[0] == "test" {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	call := useFakeRuntime(t, fake)
+	project := newRepoProject(t, `{"image": "alpine:3.20", "remoteUser": "dev"}`, "git@github.com:me/app.git")
+
+	if err := Run(&RunConfig{Path: project, CloneInVolume: CloneCurrentBranch, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	name := container.GenerateContainerName(project, "volume-main")
+	volume := container.WorkspaceVolumeName(name)
+	target := "/workspaces/" + filepath.Base(project)
+
+	if creates := fake.CallsTo("volume", "create"); len(creates) != 1 || creates[0][len(creates[0])-1] != volume || !contains(creates[0], "--label managed-by=packnplay") {
+		t.Errorf("volume create calls = %v, want one labeled create of %s", creates, volume)
+	}
+	c := fake.Container(name)
+	if c == nil {
+		t.Fatalf("container %s should be created: %v", name, fake.Containers())
+	}
+	if !contains(c.RunArgs, "--mount type=volume,source="+volume+",target="+target) || argValue(c.RunArgs, "-w") != target {
+		t.Errorf("docker run args = %v, want the volume mounted and used as the workspace", c.RunArgs)
+	}
+	if contains(c.RunArgs, "-v "+project+":"+project) {
+		t.Errorf("docker run args = %v, the host directory should not be mounted", c.RunArgs)
+	}
+	if c.Labels[container.LabelWorkspaceVolume] != volume {
+		t.Errorf("labels = %v, want the workspace volume recorded", c.Labels)
+	}
+
+	var cloned bool
+	for _, call := range fake.CallsTo("exec") {
+		joined := strings.Join(call, " ")
+		if strings.Contains(joined, "chown dev "+target) && argValue(call, "-u") != "root" {
+			t.Errorf("chown ran as %s, want root", argValue(call, "-u"))
+		}
+		if strings.Contains(joined, "git clone --branch main git@github.com:me/app.git "+target) {
+			cloned = argValue(call, "-u") == "dev" && contains(call, "-e GIT_TERMINAL_PROMPT=0")
+		}
+	}
+	if !cloned {
+		t.Errorf("exec calls = %v, want the repository cloned as dev without prompts", fake.CallsTo("exec"))
+	}
+
+	recorded, ok := container.LoadVolumes(container.VolumesPath())[volume]
+	if !ok || recorded.Container != name || recorded.Ref != "main" || recorded.HostPath != project {
+		t.Errorf("recorded volumes = %v, want %s tracked", container.LoadVolumes(container.VolumesPath()), volume)
+	}
+	if argValue(call.argv, "-w") != target {
+		t.Errorf("exec = %v, want the command run in the clone", call.argv)
+	}
+}
+
+func TestRunCloneInVolumeReusesClone(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newRepoProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "workspaceFolder": "/src"}`, "https://github.com/me/app.git")
+
+	// The volume exists and exec (test -e /src/.git) succeeds
+	if err := Run(&RunConfig{Path: project, CloneInVolume: "v1.2", Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	c := fake.Container(container.GenerateContainerName(project, "volume-v1.2"))
+	if c == nil || !contains(c.RunArgs, "--mount type=volume,source="+container.WorkspaceVolumeName(c.Name)+",target=/src") {
+		t.Fatalf("container = %+v, want the volume mounted at workspaceFolder", c)
+	}
+	if len(fake.CallsTo("volume", "create")) != 0 {
+		t.Error("an existing volume should not be created again")
+	}
+	for _, call := range fake.CallsTo("exec") {
+		if contains(call, "git clone") {
+			t.Errorf("exec %v: a volume holding a clone should not be cloned into again", call)
+		}
+	}
+}
+
+func TestResolveCloneVolumeRejectsLocalOrigin(t *testing.T) {
+	project := newRepoProject(t, `{"image": "alpine:3.20"}`, "/srv/git/app.git")
+	if _, _, err := resolveCloneVolume(project, CloneCurrentBranch); err == nil || !strings.Contains(err.Error(), "host path") {
+		t.Errorf("resolveCloneVolume() error = %v, want a local origin rejected", err)
+	}
+	if _, _, err := resolveCloneVolume(t.TempDir(), CloneCurrentBranch); err == nil || !strings.Contains(err.Error(), "git repository") {
+		t.Errorf("resolveCloneVolume() error = %v, want a non-repository rejected", err)
+	}
+}
+
+func TestRunRepo(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	fake.Fail(errors.New("exit status 1"), "Error: no such volume", "volume", "inspect")
+	fake.Exec = func(c *dockertest.Container, command []string) (string, error) {
+		if command[0] == "test" {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	call := useFakeRuntime(t, fake)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// The "remote" repository is a local one git is told to fetch it from
+	origin := newRepoProject(t, `{"image": "alpine:3.20", "remoteUser": "dev", "initializeCommand": "touch initialized"}`, "https://example.com/unused.git")
+	for _, args := range [][]string{{"add", "."}, {"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"}, {"branch", "fix/x"}} {
+		if output, err := exec.Command("git", append([]string{"-C", origin}, args...)...).CombinedOutput(); err != nil {
+			t.Skipf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	repo := "https://git.example.com/acme/api.git"
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url."+origin+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", repo)
+
+	if err := Run(&RunConfig{Repo: repo, Branch: "fix/x", Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	checkout, err := remoteCheckoutDir(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fileExists(filepath.Join(checkout, ".devcontainer", "devcontainer.json")) {
+		t.Errorf("the devcontainer configuration should be checked out in %s", checkout)
+	}
+	if fileExists(filepath.Join(checkout, "initialized")) {
+		t.Error("initializeCommand should not run without a host checkout")
+	}
+
+	name := container.GenerateContainerName(checkout, "volume-fix/x")
+	c := fake.Container(name)
+	if c == nil {
+		t.Fatalf("container %s should be created: %v", name, fake.Containers())
+	}
+	target := "/workspaces/api"
+	if !contains(c.RunArgs, "--mount type=volume,source="+container.WorkspaceVolumeName(name)+",target="+target) {
+		t.Errorf("docker run args = %v, want the volume mounted at %s", c.RunArgs, target)
+	}
+	if contains(c.RunArgs, "-v "+checkout+":"+checkout) {
+		t.Errorf("docker run args = %v, the checkout should not be mounted", c.RunArgs)
+	}
+	var cloned bool
+	for _, call := range fake.CallsTo("exec") {
+		cloned = cloned || strings.Contains(strings.Join(call, " "), "git clone --branch fix/x "+repo+" "+target)
+	}
+	if !cloned {
+		t.Errorf("exec calls = %v, want %s cloned into the volume", fake.CallsTo("exec"), repo)
+	}
+	if argValue(call.argv, "-w") != target {
+		t.Errorf("exec = %v, want the command run in the clone", call.argv)
+	}
+}
+
+func TestRunRepoRejectsLocalURL(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	if err := Run(&RunConfig{Repo: "/srv/git/app.git", Command: []string{"bash"}}); err == nil || !strings.Contains(err.Error(), "host path") {
+		t.Errorf("Run() error = %v, want a local repository rejected", err)
+	}
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+func TestContainerCredentialFileMigratesPlaintext(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	legacy := filepath.Join(credstore.DefaultDir(), ContainerCredentialFile)
+	if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+		t.Fatal(err)
+	}
+	creds := `{"claudeAiOauth":{"accessToken":"token"}}`
+	if err := os.WriteFile(legacy, []byte(creds), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := getOrCreateContainerCredentialFile(credstore.BackendFile)
+	if err != nil {
+		t.Fatalf("getOrCreateContainerCredentialFile() error = %v", err)
+	}
+	if path != filepath.Join(credstore.RuntimeDir(), ContainerCredentialFile) {
+		t.Errorf("credential file = %s, want it in the runtime directory", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != creds {
+		t.Errorf("credential file holds %q, want %q", data, creds)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("credential file mode = %v, %v; want 0600", info.Mode(), err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("plaintext %s should be removed once migrated: %v", legacy, err)
+	}
+	if stored, err := credstore.NewFileStore(credstore.DefaultDir()).Get(credstore.ClaudeCredentials); err != nil || string(stored) != creds {
+		t.Errorf("stored credentials = %q, %v; want them encrypted into the store", stored, err)
+	}
+
+	// Recreated from the store once the runtime copy is gone
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if path, err = getOrCreateContainerCredentialFile(credstore.BackendFile); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != creds {
+		t.Errorf("recreated credential file holds %q, want %q", data, creds)
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/contentwatch"
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// startContentWatchDaemon is replaced in tests, which must not spawn the test binary
+var startContentWatchDaemon = contentwatch.StartDaemon
+
+// startContentWatch starts the host-side workspace watcher when
+// customizations.packnplay.watchContent or autoUpdateContent asks for it.
+// Volume clones aren't on the host, so there is nothing to watch.
+func startContentWatch(config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, containerName string) {
+	if config.DryRun || config.Ephemeral || ws.Volume != nil {
+		return
+	}
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil || !(custom.WatchContent || custom.AutoUpdateContent) {
+		return
+	}
+	if err := startContentWatchDaemon(containerName, ws.MountPath, custom.ContentFiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to start workspace watcher: %v\n", err)
+	}
+}
+
+// applyContentChanges acts on the dependency changes the watcher recorded since
+// the container was last attached: with autoUpdateContent it reruns
+// updateContentCommand, otherwise it points the changes out once
+func applyContentChanges(dockerClient DockerClient, containerName, containerID string, devConfig *devcontainer.Config, workingDir string, env []string, verbose bool) {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil || !(custom.WatchContent || custom.AutoUpdateContent) {
+		return
+	}
+	changed, err := contentwatch.Pending(containerName)
+	if err != nil || len(changed) == 0 {
+		return
+	}
+	defer func() {
+		if err := contentwatch.Clear(containerName); err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}()
+	if devConfig.UpdateContentCommand == nil {
+		return
+	}
+
+	summary := summarizeChanges(changed)
+	if !custom.AutoUpdateContent {
+		fmt.Fprintf(os.Stderr, "Note: %s changed since updateContentCommand last ran; it may need to run again (set customizations.packnplay.autoUpdateContent to rerun it automatically)\n", summary)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s changed; running updateContentCommand...\n", summary)
+	metadata, err := LoadMetadata(containerID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load metadata: %v\n", err)
+		metadata = nil
+	} else {
+		// Forget the previous run so the unchanged command (and all its tasks) runs again
+		delete(metadata.LifecycleRan, "updateContent")
+	}
+
+	executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.LifecycleUser(), verbose, metadata)
+	executor.SetWorkingDir(workingDir)
+	executor.SetEnv(env)
+	executor.SetTaskPolicy(lifecycleTaskPolicy(devConfig))
+	executor.SetShell(lifecycleShell(devConfig))
+	executor.SetAudit("", containerName)
+	if err := executor.Execute("updateContent", devConfig.UpdateContentCommand); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: updateContentCommand failed: %v\n", err)
+	}
+	if metadata != nil {
+		if err := SaveMetadata(metadata); err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save metadata: %v\n", err)
+		}
+	}
+}
+
+// summarizeChanges names up to three changed files
+func summarizeChanges(paths []string) string {
+	if len(paths) <= 3 {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:3], ", "), len(paths)-3)
+}
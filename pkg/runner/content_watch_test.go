@@ -0,0 +1,54 @@
+package runner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/contentwatch"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunReconnectAppliesContentChanges(t *testing.T) {
+	for _, auto := range []bool{false, true} {
+		fake := dockertest.New()
+		fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+		useFakeRuntime(t, fake)
+		orig := startContentWatchDaemon
+		t.Cleanup(func() { startContentWatchDaemon = orig })
+		var watched string
+		startContentWatchDaemon = func(containerName, root string, extra []string) error {
+			watched = root
+			return nil
+		}
+
+		custom := `"watchContent": true`
+		if auto {
+			custom = `"autoUpdateContent": true`
+		}
+		project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "updateContentCommand": "npm ci", "customizations": {"packnplay": {`+custom+`}}}`)
+		name := container.GenerateContainerName(project, "no-worktree")
+		fake.AddContainer(dockertest.Container{
+			Name:    name,
+			Image:   "alpine:3.20",
+			Running: true,
+			Labels:  map[string]string{"managed-by": "packnplay", "packnplay-project": filepath.Base(project), "packnplay-worktree": "no-worktree", "packnplay-host-path": project},
+		})
+		if err := contentwatch.Record(name, "package-lock.json"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, Command: []string{"bash"}}); err != nil {
+			t.Fatalf("Run() with Reconnect error = %v", err)
+		}
+		if ran := containsCall(fake.CallsTo("exec"), "npm ci"); ran != auto {
+			t.Errorf("autoUpdateContent=%v: updateContentCommand ran = %v, exec calls %v", auto, ran, fake.CallsTo("exec"))
+		}
+		if pending, _ := contentwatch.Pending(name); len(pending) != 0 {
+			t.Errorf("pending changes = %v, want them cleared once acted on", pending)
+		}
+		if watched != project {
+			t.Errorf("watcher root = %q, want %q", watched, project)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package runner
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ContainerPathPrefix marks the container side of a `packnplay cp` argument
+const ContainerPathPrefix = "container:"
+
+// CopyPath is one side of a copy between the host and a container
+type CopyPath struct {
+	Path      string
+	Container bool // Path is inside the container
+}
+
+// ParseCopyPath reads a `packnplay cp` argument, where a container: prefix
+// names a path inside the container
+func ParseCopyPath(arg string) CopyPath {
+	if p, ok := strings.CutPrefix(arg, ContainerPathPrefix); ok {
+		return CopyPath{Path: p, Container: true}
+	}
+	return CopyPath{Path: arg}
+}
+
+// containerInspect returns a Go template field of a container's config, or ""
+// when the runtime can't report it
+func containerInspect(dockerClient DockerClient, containerName, field string) string {
+	value, err := runtimeBackend(dockerClient).Inspect(dockerClient, containerName, field)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+// ContainerUser returns the user a container's commands run as, or "" if unknown
+func ContainerUser(dockerClient DockerClient, containerName string) string {
+	return containerInspect(dockerClient, containerName, "Config.User")
+}
+
+// containerPath makes a container path absolute, relative to the container's
+// working directory (its workspace folder)
+func containerPath(dockerClient DockerClient, containerName, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	workDir := containerInspect(dockerClient, containerName, "Config.WorkingDir")
+	if workDir == "" {
+		workDir = "/"
+	}
+	return path.Join(workDir, p)
+}
+
+// containerIsDir reports whether p is a directory in the container
+func containerIsDir(dockerClient DockerClient, containerName, p string) bool {
+	_, err := dockerClient.Run("exec", containerName, "test", "-d", p)
+	return err == nil
+}
+
+// CopyToContainer copies the host file or directory src to dst in the
+// container, following `cp -r`: into dst when it is an existing directory,
+// otherwise as dst. The copy is handed to user, since the runtime creates
+// it as root. Runtimes without a cp command (Apple Container) get the copy
+// streamed through tar in the container.
+func CopyToContainer(dockerClient DockerClient, containerName, src, dst, user string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	dst = containerPath(dockerClient, containerName, dst)
+	target := dst
+	if containerIsDir(dockerClient, containerName, dst) {
+		target = path.Join(dst, filepath.Base(filepath.Clean(src)))
+	}
+
+	backend := runtimeBackend(dockerClient)
+	if !backend.Capabilities().Copy {
+		if err := copyToContainerViaTar(dockerClient, containerName, src, target); err != nil {
+			return err
+		}
+	} else if err := backend.CopyIn(dockerClient, containerName, src, target); err != nil {
+		return err
+	}
+
+	if user == "" || user == "root" || user == "0" {
+		return nil
+	}
+	chown := `chown -R "$(id -u "$1"):$(id -g "$1")" "$2"`
+	if output, err := dockerClient.Run("exec", "-u", "root", containerName, "/bin/sh", "-c", chown, "sh", user, target); err != nil {
+		return fmt.Errorf("failed to give %s to %s: %w\nDocker output:\n%s", target, user, err, output)
+	}
+	return nil
+}
+
+// CopyFromContainer copies the file or directory src in the container to the
+// host path dst, into dst when it is an existing directory, otherwise as dst
+func CopyFromContainer(dockerClient DockerClient, containerName, src, dst string) error {
+	src = containerPath(dockerClient, containerName, src)
+	target := dst
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		target = filepath.Join(dst, path.Base(src))
+	}
+
+	if !runtimeSupports(dockerClient).Copy {
+		return copyFromContainerViaTar(dockerClient, containerName, src, target)
+	}
+	if output, err := dockerClient.Run("cp", containerName+":"+src, target); err != nil {
+		return fmt.Errorf("failed to copy %s from the container to %s: %w\nDocker output:\n%s", src, target, err, output)
+	}
+	return nil
+}
+
+// copyToContainerViaTar pipes a tar of src into `tar -x` in the container,
+// creating it as target
+func copyToContainerViaTar(dockerClient DockerClient, containerName, src, target string) error {
+	cmdPath, err := lookPath(dockerClient.Command())
+	if err != nil {
+		return fmt.Errorf("failed to find %s command: %w", dockerClient.Command(), err)
+	}
+	if output, err := dockerClient.Run("exec", containerName, "mkdir", "-p", path.Dir(target)); err != nil {
+		return fmt.Errorf("failed to create %s: %w\nDocker output:\n%s", path.Dir(target), err, output)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTar(writer, src, path.Base(target)))
+	}()
+	cmd := exec.Command(cmdPath, "exec", "-i", containerName, "tar", "-xf", "-", "-C", path.Dir(target))
+	cmd.Stdin = reader
+	if output, err := cmd.CombinedOutput(); err != nil {
+		reader.CloseWithError(err)
+		return fmt.Errorf("failed to copy %s to %s: %w\n%s", src, target, err, output)
+	}
+	return nil
+}
+
+// copyFromContainerViaTar reads a tar of src from `tar -c` in the container
+// and extracts it as target
+func copyFromContainerViaTar(dockerClient DockerClient, containerName, src, target string) error {
+	cmdPath, err := lookPath(dockerClient.Command())
+	if err != nil {
+		return fmt.Errorf("failed to find %s command: %w", dockerClient.Command(), err)
+	}
+	cmd := exec.Command(cmdPath, "exec", containerName, "tar", "-cf", "-", "-C", path.Dir(src), path.Base(src))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to copy %s from the container: %w", src, err)
+	}
+	extractErr := extractTar(stdout, target)
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to copy %s from the container: %w\n%s", src, err, stderr.String())
+	}
+	return extractErr
+}
+
+// writeTar writes the file or directory src to w as an archive whose top
+// entry is named name
+func writeTar(w io.Writer, src, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts an archive of a single file or directory as target,
+// whatever its top entry is called. Entries that would land outside target,
+// directly or through a symlink in the archive, are rejected.
+func extractTar(r io.Reader, target string) error {
+	tr := tar.NewReader(r)
+	top := ""
+	var symlinks []string
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if top == "" {
+			top = strings.SplitN(name, "/", 2)[0]
+		}
+		rel, ok := strings.CutPrefix(name, top)
+		if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+			return fmt.Errorf("archive entry %s is outside %s", header.Name, top)
+		}
+		for _, link := range symlinks {
+			if strings.HasPrefix(rel, link+"/") {
+				return fmt.Errorf("archive entry %s is inside a symlink", header.Name)
+			}
+		}
+		dest := filepath.Join(target, filepath.FromSlash(rel))
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, dest); err != nil {
+				return err
+			}
+			symlinks = append(symlinks, rel)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package runner
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestParseCopyPath(t *testing.T) {
+	if got := ParseCopyPath("container:/tmp/out"); got != (CopyPath{Path: "/tmp/out", Container: true}) {
+		t.Errorf("ParseCopyPath(container:) = %+v", got)
+	}
+	if got := ParseCopyPath("./fixtures"); got != (CopyPath{Path: "./fixtures"}) {
+		t.Errorf("ParseCopyPath(host) = %+v", got)
+	}
+}
+
+func TestCopyToContainer(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true, User: "vscode", WorkingDir: "/workspaces/app"})
+	fake.Exec = func(c *dockertest.Container, command []string) (string, error) {
+		if reflect.DeepEqual(command, []string{"test", "-d", "/workspaces/app/data"}) {
+			return "", nil
+		}
+		if len(command) > 0 && command[0] == "test" {
+			return "", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	src := filepath.Join(t.TempDir(), "fixtures")
+	if err := os.Mkdir(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Into an existing directory, relative to the workspace folder
+	if err := CopyToContainer(fake, "packnplay-app-main", src, "data", ContainerUser(fake, "packnplay-app-main")); err != nil {
+		t.Fatalf("CopyToContainer() error = %v", err)
+	}
+	if !containsCall(fake.CallsTo("cp"), src, "packnplay-app-main:/workspaces/app/data/fixtures") {
+		t.Errorf("cp calls = %v, want the copy placed inside the directory", fake.CallsTo("cp"))
+	}
+	if !containsCall(fake.CallsTo("exec", "-u", "root"), "chown -R", "vscode", "/workspaces/app/data/fixtures") {
+		t.Errorf("exec calls = %v, want the copy handed to the remote user", fake.CallsTo("exec"))
+	}
+
+	// As a new path, owned by root
+	if err := CopyToContainer(fake, "packnplay-app-main", src, "/tmp/renamed", "root"); err != nil {
+		t.Fatalf("CopyToContainer() error = %v", err)
+	}
+	if !containsCall(fake.CallsTo("cp"), "packnplay-app-main:/tmp/renamed") {
+		t.Errorf("cp calls = %v, want the copy created as the destination", fake.CallsTo("cp"))
+	}
+	if len(fake.CallsTo("exec", "-u", "root")) != 1 {
+		t.Errorf("files copied for root don't need their ownership changed: %v", fake.CallsTo("exec"))
+	}
+}
+
+func TestCopyFromContainer(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true, WorkingDir: "/workspaces/app"})
+	dst := t.TempDir()
+
+	if err := CopyFromContainer(fake, "packnplay-app-main", "coverage.html", dst); err != nil {
+		t.Fatalf("CopyFromContainer() error = %v", err)
+	}
+	if !containsCall(fake.CallsTo("cp"), "packnplay-app-main:/workspaces/app/coverage.html", filepath.Join(dst, "coverage.html")) {
+		t.Errorf("cp calls = %v", fake.CallsTo("cp"))
+	}
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/run.sh", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err := writeTar(&archive, src, "renamed"); err != nil {
+		t.Fatalf("writeTar() error = %v", err)
+	}
+	target := filepath.Join(t.TempDir(), "copy")
+	if err := extractTar(&archive, target); err != nil {
+		t.Fatalf("extractTar() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(target, "sub", "run.sh"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("sub/run.sh = %v, %v; want it copied with its mode", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(target, "link")); err != nil || link != "sub/run.sh" {
+		t.Errorf("link = %q, %v; want the symlink kept", link, err)
+	}
+}
+
+func TestExtractTarRejectsEscapes(t *testing.T) {
+	tests := map[string][]tar.Header{
+		"parent directory": {
+			{Name: "out", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "out/../../evil", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"through a symlink": {
+			{Name: "out", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "out/etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+			{Name: "out/etc/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+	}
+	for name, headers := range tests {
+		t.Run(name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			for _, header := range headers {
+				if err := tw.WriteHeader(&header); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw.Close()
+
+			if err := extractTar(&archive, filepath.Join(t.TempDir(), "copy")); err == nil {
+				t.Error("extractTar() should reject the archive")
+			}
+		})
+	}
+}
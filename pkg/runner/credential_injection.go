@@ -0,0 +1,272 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+// injectedCredential is a sanitized credential file destined for the container
+type injectedCredential struct {
+	credType string
+	name     string // path relative to the user's home directory
+	content  string
+}
+
+// copyInjected reports whether a credential type is copied in rather than bind mounted
+func copyInjected(creds config.Credentials, credType string) bool {
+	return creds.InjectionMode(credType) == config.InjectCopy
+}
+
+// buildInjectedCredentials prepares sanitized copies of credentials configured for copy injection
+func buildInjectedCredentials(homeDir string, creds config.Credentials) []injectedCredential {
+	var result []injectedCredential
+
+	if creds.Git && copyInjected(creds, "git") {
+		if content, err := os.ReadFile(filepath.Join(homeDir, ".gitconfig")); err == nil {
+			result = append(result, injectedCredential{"git", ".gitconfig", sanitizeGitconfig(string(content))})
+		}
+	}
+
+	if creds.NPM && copyInjected(creds, "npm") {
+		if content, err := os.ReadFile(filepath.Join(homeDir, ".npmrc")); err == nil {
+			result = append(result, injectedCredential{"npm", ".npmrc", sanitizeNpmrc(string(content))})
+		}
+	}
+
+	if creds.AWS && copyInjected(creds, "aws") {
+		profile := os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+		if content, err := os.ReadFile(filepath.Join(homeDir, ".aws", "config")); err == nil {
+			result = append(result, injectedCredential{"aws", ".aws/config", filterINISections(string(content), func(name string) bool {
+				return name == profile || name == "profile "+profile || strings.HasPrefix(name, "sso-session ")
+			})})
+		}
+		if content, err := os.ReadFile(filepath.Join(homeDir, ".aws", "credentials")); err == nil {
+			result = append(result, injectedCredential{"aws", ".aws/credentials", filterINISections(string(content), func(name string) bool {
+				return name == profile
+			})})
+		}
+	}
+
+	return result
+}
+
+// injectCredentials copies sanitized credentials into the container and records them for scrubbing
+func injectCredentials(dockerClient DockerClient, containerID, homeDir, remoteUser, remoteHome string, creds config.Credentials, verbose bool) error {
+	injected := buildInjectedCredentials(homeDir, creds)
+	if len(injected) == 0 {
+		return nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "packnplay-inject-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	var copied []string
+	for i, cred := range injected {
+		srcPath := filepath.Join(tempDir, fmt.Sprintf("%d-%s", i, filepath.Base(cred.name)))
+		if err := os.WriteFile(srcPath, []byte(cred.content), 0600); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", cred.name, err)
+		}
+
+		dstPath := path.Join(remoteHome, cred.name)
+		if err := copyFileToContainer(dockerClient, containerID, srcPath, dstPath, remoteUser, verbose); err != nil {
+			return fmt.Errorf("failed to inject %s credentials: %w", cred.credType, err)
+		}
+		_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chmod", "600", dstPath)
+		copied = append(copied, dstPath)
+	}
+
+	return recordInjectedFiles(dockerClient, containerID, copied)
+}
+
+// resumeInjectedCredentials copies credentials configured for copy injection
+// into a restarted container again: they were scrubbed when it stopped
+func resumeInjectedCredentials(dockerClient DockerClient, containerID, remoteUser string, creds config.Credentials, verbose bool) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	remoteHome := containerRemoteHome(dockerClient, containerID, remoteUser)
+	return injectCredentials(dockerClient, containerID, homeDir, remoteUser, remoteHome, creds, verbose)
+}
+
+// injectedManifestPath returns the file listing the credentials copied into a
+// container, so they can be scrubbed on stop. It's kept on the host, since the
+// scrub removes its paths as root and the container's processes could
+// otherwise add any file to it.
+func injectedManifestPath(dockerClient DockerClient, nameOrID string) string {
+	id := nameOrID
+	if runtimeSupports(dockerClient).Inspect {
+		if output, err := dockerClient.Run("inspect", "--type", "container", "--format", "{{.Id}}", nameOrID); err == nil && strings.TrimSpace(output) != "" {
+			id = strings.TrimSpace(output)
+		}
+	}
+	return filepath.Join(credstore.RuntimeDir(), "injected-credentials", id)
+}
+
+// readInjectedFiles returns the paths listed in a scrub manifest
+func readInjectedFiles(manifest string) ([]string, error) {
+	data, err := os.ReadFile(manifest)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read injected credentials: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// recordInjectedFiles adds paths to the container's scrub manifest, each once
+func recordInjectedFiles(dockerClient DockerClient, containerID string, paths []string) error {
+	manifest := injectedManifestPath(dockerClient, containerID)
+	recorded, err := readInjectedFiles(manifest)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if !slices.Contains(recorded, p) {
+			recorded = append(recorded, p)
+		}
+	}
+	name := filepath.Join("injected-credentials", filepath.Base(manifest))
+	if _, err := credstore.WriteRuntimeFileAtomic(name, []byte(strings.Join(recorded, "\n")+"\n")); err != nil {
+		return fmt.Errorf("failed to record injected credentials: %w", err)
+	}
+	return nil
+}
+
+// InjectedCredentialFiles returns the credentials copied into a container: gh's
+// hosts.yml and the files of copy injection. Snapshots leave them out.
+func InjectedCredentialFiles(dockerClient DockerClient, containerName string) ([]string, error) {
+	return readInjectedFiles(injectedManifestPath(dockerClient, containerName))
+}
+
+// ScrubInjectedCredentials removes credentials copied into a running container
+func ScrubInjectedCredentials(dockerClient DockerClient, containerName string) error {
+	manifest := injectedManifestPath(dockerClient, containerName)
+	paths, err := readInjectedFiles(manifest)
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+	args := append([]string{"exec", "-u", "root", containerName, "rm", "-f", "--"}, paths...)
+	if output, err := dockerClient.Run(args...); err != nil {
+		return fmt.Errorf("failed to scrub credentials: %w\nDocker output:\n%s", err, output)
+	}
+	if err := os.Remove(manifest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", manifest, err)
+	}
+	return nil
+}
+
+// sanitizeGitconfig drops signing keys, credential helpers and host-only includes
+func sanitizeGitconfig(content string) string {
+	var out strings.Builder
+	skipSection := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if name, ok := iniSectionName(trimmed); ok {
+			base := strings.ToLower(strings.Fields(name + " ")[0])
+			skipSection = base == "credential" || base == "gpg" || base == "include" || base == "includeif"
+			if skipSection {
+				continue
+			}
+		} else if skipSection {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[0]))
+		if key == "signingkey" || key == "gpgsign" {
+			continue
+		}
+
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+// sanitizeNpmrc keeps only auth tokens for registries the npmrc actually uses.
+// Unscoped _auth, _authToken and _password lines are dropped: npm sends them
+// to whichever registry is configured, including one set in the container.
+func sanitizeNpmrc(content string) string {
+	lines := strings.Split(content, "\n")
+
+	used := map[string]bool{"//registry.npmjs.org/": true}
+	for _, line := range lines {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || (key != "registry" && !strings.HasSuffix(key, ":registry")) {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "https:"), "http:")
+		if !strings.HasSuffix(value, "/") {
+			value += "/"
+		}
+		used[value] = true
+	}
+
+	var out []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		key, _, _ := strings.Cut(trimmed, "=")
+		if strings.HasPrefix(trimmed, "//") {
+			registry := key[:strings.LastIndex(key, "/")+1]
+			if !used[registry] {
+				continue
+			}
+		}
+		switch strings.TrimSpace(key) {
+		case "_auth", "_authToken", "_password":
+			continue
+		}
+		out = append(out, line)
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// filterINISections keeps only sections whose name satisfies keep
+func filterINISections(content string, keep func(name string) bool) string {
+	var out strings.Builder
+	keeping := false
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := iniSectionName(strings.TrimSpace(line)); ok {
+			keeping = keep(name)
+		}
+		if keeping {
+			out.WriteString(line)
+			out.WriteString("\n")
+		}
+	}
+
+	return out.String()
+}
+
+// iniSectionName returns the section name if line is an INI section header
+func iniSectionName(line string) (string, bool) {
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
@@ -0,0 +1,172 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestSanitizeGitconfig(t *testing.T) {
+	input := `[user]
+	name = Jane Dev
+	email = jane@example.com
+	signingkey = ABCDEF123456
+[commit]
+	gpgsign = true
+[credential]
+	helper = osxkeychain
+[gpg "ssh"]
+	program = /Applications/1Password.app/op-ssh-sign
+[includeIf "gitdir:~/work/"]
+	path = ~/.gitconfig-work
+[alias]
+	co = checkout
+`
+	got := sanitizeGitconfig(input)
+
+	for _, want := range []string{"name = Jane Dev", "email = jane@example.com", "[alias]", "co = checkout"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sanitizeGitconfig() dropped %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"signingkey", "gpgsign", "osxkeychain", "op-ssh-sign", "gitconfig-work", "[credential]"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("sanitizeGitconfig() kept %q:\n%s", unwanted, got)
+		}
+	}
+}
+
+func TestSanitizeNpmrc(t *testing.T) {
+	input := `registry=https://registry.npmjs.org/
+@corp:registry=https://npm.corp.example.com
+//registry.npmjs.org/:_authToken=public-token
+//npm.corp.example.com/:_authToken=corp-token
+//npm.pkg.github.com/:_authToken=unused-token
+_authToken=global-token
+_auth = Z2xvYmFsOmF1dGg=
+save-exact=true`
+
+	got := sanitizeNpmrc(input)
+
+	for _, want := range []string{"public-token", "corp-token", "save-exact=true"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sanitizeNpmrc() dropped %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "unused-token") {
+		t.Errorf("sanitizeNpmrc() kept token for unused registry:\n%s", got)
+	}
+	if strings.Contains(got, "global-token") || strings.Contains(got, "Z2xvYmFsOmF1dGg=") {
+		t.Errorf("sanitizeNpmrc() kept unscoped credentials:\n%s", got)
+	}
+}
+
+func TestFilterINISections(t *testing.T) {
+	input := `[default]
+aws_access_key_id = AKIADEFAULT
+[work]
+aws_access_key_id = AKIAWORK
+[personal]
+aws_access_key_id = AKIAPERSONAL
+`
+	got := filterINISections(input, func(name string) bool { return name == "work" })
+
+	if !strings.Contains(got, "AKIAWORK") {
+		t.Errorf("filterINISections() dropped selected section:\n%s", got)
+	}
+	if strings.Contains(got, "AKIADEFAULT") || strings.Contains(got, "AKIAPERSONAL") {
+		t.Errorf("filterINISections() kept other sections:\n%s", got)
+	}
+}
+
+func TestBuildInjectedCredentials(t *testing.T) {
+	homeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("[user]\n\tsigningkey = KEY\n\tname = Test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, ".npmrc"), []byte("//registry.npmjs.org/:_authToken=tok\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mount mode (default) injects nothing
+	creds := config.Credentials{Git: true, NPM: true}
+	if got := buildInjectedCredentials(homeDir, creds); len(got) != 0 {
+		t.Errorf("buildInjectedCredentials() in mount mode = %d files, want 0", len(got))
+	}
+
+	// Copy mode only applies to the selected credential types
+	creds.Inject = map[string]string{"git": config.InjectCopy}
+	got := buildInjectedCredentials(homeDir, creds)
+	if len(got) != 1 {
+		t.Fatalf("buildInjectedCredentials() = %d files, want 1", len(got))
+	}
+	if got[0].name != ".gitconfig" {
+		t.Errorf("injected file = %q, want .gitconfig", got[0].name)
+	}
+	if strings.Contains(got[0].content, "signingkey") {
+		t.Errorf("injected .gitconfig was not sanitized:\n%s", got[0].content)
+	}
+}
+
+func TestScrubInjectedCredentials(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	fake := dockertest.New()
+	c := fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true})
+
+	// Recorded by ID and found by name, each path once
+	if err := recordInjectedFiles(fake, c.ID, []string{"/home/dev/.gitconfig", "/home/dev/.npmrc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordInjectedFiles(fake, c.ID, []string{"/home/dev/.gitconfig"}); err != nil {
+		t.Fatal(err)
+	}
+	manifest := injectedManifestPath(fake, "packnplay-app-main")
+	if !strings.HasPrefix(manifest, credstore.RuntimeDir()) {
+		t.Errorf("manifest = %s, want it on the host under %s", manifest, credstore.RuntimeDir())
+	}
+
+	if err := ScrubInjectedCredentials(fake, "packnplay-app-main"); err != nil {
+		t.Fatalf("ScrubInjectedCredentials() error = %v", err)
+	}
+	calls := fake.CallsTo("exec")
+	want := "exec -u root packnplay-app-main rm -f -- /home/dev/.gitconfig /home/dev/.npmrc"
+	if len(calls) != 1 || strings.Join(calls[0], " ") != want {
+		t.Errorf("scrub calls = %v, want %q", calls, want)
+	}
+	if _, err := os.Stat(manifest); !os.IsNotExist(err) {
+		t.Errorf("manifest still exists after the scrub: %v", err)
+	}
+
+	// Nothing recorded, nothing to do
+	if err := ScrubInjectedCredentials(fake, "packnplay-app-main"); err != nil || len(fake.CallsTo("exec")) != 1 {
+		t.Errorf("second scrub = %v with %d exec calls, want nothing run", err, len(fake.CallsTo("exec")))
+	}
+}
+
+func TestResumeInjectedCredentials(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := os.WriteFile(filepath.Join(homeDir, ".gitconfig"), []byte("[user]\n\tname = Test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fake := dockertest.New()
+	c := fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true})
+
+	creds := config.Credentials{Git: true, Inject: map[string]string{"git": config.InjectCopy}}
+	if err := resumeInjectedCredentials(fake, c.ID, "dev", creds, false); err != nil {
+		t.Fatalf("resumeInjectedCredentials() error = %v", err)
+	}
+	if cp := fake.CallsTo("cp"); len(cp) != 1 || cp[0][2] != c.ID+":/home/dev/.gitconfig" {
+		t.Errorf("cp calls = %v, want .gitconfig copied to /home/dev", cp)
+	}
+	recorded, err := readInjectedFiles(injectedManifestPath(fake, c.ID))
+	if err != nil || len(recorded) != 1 || recorded[0] != "/home/dev/.gitconfig" {
+		t.Errorf("recorded = %v, %v, want /home/dev/.gitconfig", recorded, err)
+	}
+}
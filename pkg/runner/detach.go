@@ -0,0 +1,71 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// DetachedContainer is what run --detach reports about the container it brought up
+type DetachedContainer struct {
+	Name       string        `json:"name"`
+	ID         string        `json:"id"`
+	Ports      []PortBinding `json:"ports"`
+	WorkingDir string        `json:"working_dir"`           // workspace folder inside the container
+	RemoteUser string        `json:"remote_user,omitempty"` // user commands run as, when not the image default
+}
+
+// PortBinding is a published container port
+type PortBinding = docker.PortBinding
+
+// detachFromContainer finishes a --detach run: the user's command (if any) is started
+// in the background and the container's name, ID, and published ports are printed
+// instead of exec'ing into it.
+func detachFromContainer(config *RunConfig, dockerClient DockerClient, containerID, remoteUser, workingDir string, env []string) error {
+	if len(config.Command) > 0 {
+		args := []string{"exec", "-d"}
+		if remoteUser != "" {
+			args = append(args, "--user", remoteUser)
+		}
+		args = append(args, envArgs(env)...)
+		args = append(args, "-w", workingDir, containerID)
+		args = append(args, config.Command...)
+		if output, err := dockerClient.Run(args...); err != nil {
+			return errdefs.Errorf(errdefs.CategoryContainer, "failed to start command in background: %w\nDocker output:\n%s", err, output)
+		}
+	}
+
+	info := DetachedContainer{Name: containerID, ID: containerID, Ports: []PortBinding{}, WorkingDir: workingDir, RemoteUser: remoteUser}
+	if output, err := dockerClient.Run("inspect", "--format", "{{.Name}}|{{.Id}}", containerID); err == nil {
+		if name, id, ok := strings.Cut(strings.TrimSpace(output), "|"); ok {
+			info.Name = strings.TrimPrefix(name, "/")
+			info.ID = id
+		}
+	}
+	if len(config.Command) > 0 {
+		RecordAudit(audit.Event{Type: audit.TypeExec, Container: info.Name, Argv: config.Command})
+	}
+	if ports, err := runtimeBackend(dockerClient).PortMap(dockerClient, containerID); err == nil {
+		info.Ports = ports
+	}
+
+	if config.DetachJSON {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return fmt.Errorf("failed to encode container info: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("%s %s\n", info.Name, info.ID)
+	for _, port := range info.Ports {
+		fmt.Fprintf(os.Stderr, "  %s -> %s:%s\n", port.ContainerPort, port.HostIP, port.HostPort)
+	}
+	return nil
+}
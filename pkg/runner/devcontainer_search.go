@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/git"
+)
+
+// Devcontainer search modes: how far up from a directory without a
+// devcontainer.json packnplay looks for one
+const (
+	DevcontainerSearchGit     = "git"     // up to the root of the git repository (default)
+	DevcontainerSearchParents = "parents" // up to, but not including, the home directory
+	DevcontainerSearchOff     = "off"     // only the directory itself
+)
+
+// findProjectRoot returns the directory whose .devcontainer/devcontainer.json
+// applies to dir: dir itself if it has one, otherwise the nearest parent
+// within the search boundary that does. It returns "" when none does, so a
+// subdirectory of a monorepo without any config keeps running as before.
+func findProjectRoot(dir, mode string) (string, error) {
+	if fileExists(devcontainer.ConfigFilePath(dir)) {
+		return dir, nil
+	}
+
+	var boundary string
+	switch mode {
+	case "", DevcontainerSearchGit:
+		root, err := git.GetRepoRoot(dir)
+		if err != nil {
+			return "", nil // not in a git repository
+		}
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		boundary = root
+	case DevcontainerSearchParents:
+		boundary = filepath.VolumeName(dir) + string(filepath.Separator)
+	case DevcontainerSearchOff:
+		return "", nil
+	default:
+		return "", errdefs.Errorf(errdefs.CategoryConfig, "invalid devcontainer_search mode %q (use git, parents, or off)", mode)
+	}
+
+	home, _ := os.UserHomeDir()
+	for current := dir; ; {
+		parent := filepath.Dir(current)
+		if parent == current || !withinDir(parent, boundary) || (mode == DevcontainerSearchParents && parent == home) {
+			return "", nil
+		}
+		current = parent
+		if fileExists(devcontainer.ConfigFilePath(current)) {
+			return current, nil
+		}
+	}
+}
+
+// reportConfigFile says which devcontainer.json of projectDir is used, in
+// verbose mode, or whenever it was picked from several
+// .devcontainer/<name>/devcontainer.json files with none of the others taking
+// precedence
+func reportConfigFile(projectDir, configPath string, verbose bool) {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(projectDir, path); err == nil {
+			return r
+		}
+		return path
+	}
+	files := devcontainer.ConfigFiles(projectDir)
+	if len(files) > 1 && filepath.Dir(filepath.Dir(files[0])) == filepath.Join(projectDir, ".devcontainer") {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = filepath.Base(filepath.Dir(file))
+		}
+		fmt.Fprintf(os.Stderr, "Found devcontainer configurations %s; using %s\n", strings.Join(names, ", "), rel(configPath))
+		return
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Using %s\n", rel(configPath))
+	}
+}
+
+// withinDir reports whether target is dir or below it
+func withinDir(target, dir string) bool {
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sessionDir is the directory shells and commands start in: the workspace
+// folder, or the subdirectory of it packnplay was run from
+func (ws *Workspace) sessionDir(workspaceFolder string) string {
+	if ws.Subdir == "" {
+		return workspaceFolder
+	}
+	return path.Join(workspaceFolder, filepath.ToSlash(ws.Subdir))
+}
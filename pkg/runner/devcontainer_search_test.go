@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+// mkdirs creates dir below root and returns its path
+func mkdirs(t *testing.T, root string, dir string) string {
+	t.Helper()
+	path := filepath.Join(root, dir)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindProjectRoot(t *testing.T) {
+	repo := newRepoProject(t, `{"image": "alpine:3.20"}`, "https://github.com/me/mono.git")
+	plain := newProject(t, `{"image": "alpine:3.20"}`)
+	nested := mkdirs(t, repo, "services/web")
+	if err := os.WriteFile(filepath.Join(mkdirs(t, nested, ".devcontainer"), "devcontainer.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootFile := mkdirs(t, repo, "services/api")
+	if err := os.WriteFile(filepath.Join(rootFile, ".devcontainer.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		mode string
+		want string
+	}{
+		{"own config", repo, "", repo},
+		{"git subdirectory", mkdirs(t, repo, "packages/api"), "", repo},
+		{"nearest config wins", mkdirs(t, nested, "src"), DevcontainerSearchGit, nested},
+		{".devcontainer.json", mkdirs(t, rootFile, "cmd"), DevcontainerSearchGit, rootFile},
+		{"off", mkdirs(t, repo, "docs"), DevcontainerSearchOff, ""},
+		{"outside git", mkdirs(t, plain, "lib"), DevcontainerSearchGit, ""},
+		{"parents outside git", mkdirs(t, plain, "lib/deep"), DevcontainerSearchParents, plain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findProjectRoot(tt.dir, tt.mode)
+			if err != nil {
+				t.Fatalf("findProjectRoot() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("findProjectRoot(%s) = %q, want %q", tt.dir, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := findProjectRoot(mkdirs(t, plain, "x"), "everywhere"); err == nil {
+		t.Error("findProjectRoot() should reject an unknown mode")
+	}
+}
+
+func TestRunFromProjectSubdirectory(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	project := newRepoProject(t, `{"image": "alpine:3.20"}`, "https://github.com/me/mono.git")
+	subdir := mkdirs(t, project, "packages/api")
+
+	if err := Run(&RunConfig{Path: subdir, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	c := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if c == nil {
+		t.Fatalf("container for %s should be created: %v", project, fake.Containers())
+	}
+	if !contains(c.RunArgs, "-v "+project+":"+project) || argValue(c.RunArgs, "-w") != project {
+		t.Errorf("docker run args = %v, want the repository root mounted as the workspace", c.RunArgs)
+	}
+	if argValue(call.argv, "-w") != subdir {
+		t.Errorf("exec = %v, want the command run in %s", call.argv, subdir)
+	}
+}
+
+func TestRunWithNamedConfigs(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	project := t.TempDir()
+	for name, image := range map[string]string{"python": "python:3", "node": "node:22"} {
+		if err := os.WriteFile(filepath.Join(mkdirs(t, project, ".devcontainer/"+name), "devcontainer.json"), []byte(`{"image": "`+image+`", "remoteUser": "root"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var spec RunSpec
+	stderr := captureStderr(t, func() {
+		spec = dryRunSpec(t, &RunConfig{Path: project, NoWorktree: true})
+	})
+	if spec.Image != "node:22" {
+		t.Errorf("spec.Image = %s, want the first configuration by name", spec.Image)
+	}
+	if !strings.Contains(stderr, "Found devcontainer configurations node, python; using "+filepath.Join(".devcontainer", "node", "devcontainer.json")) {
+		t.Errorf("stderr = %q, want the choice reported", stderr)
+	}
+}
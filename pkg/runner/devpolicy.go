@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/devpolicy"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// enforceDevPolicy checks cfg against the system and user devcontainer
+// policies. Violations an admin overrides are printed as warnings, except
+// those already reported for checked, an earlier form of cfg.
+func enforceDevPolicy(cfg, checked *devcontainer.Config, override string) error {
+	policies, err := devpolicy.LoadAll()
+	if err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+	violations, err := devpolicy.Enforce(policies, cfg, override)
+	if err != nil {
+		return errdefs.New(errdefs.CategoryPolicy, err)
+	}
+
+	reported := make(map[string]bool)
+	if checked != nil {
+		earlier, _ := devpolicy.Enforce(policies, checked, override)
+		for _, v := range earlier {
+			reported[v.String()] = true
+		}
+	}
+	warned := false
+	for _, v := range violations {
+		if reported[v.String()] {
+			continue
+		}
+		if !warned {
+			fmt.Fprintf(os.Stderr, "Warning: overriding devcontainer policy (%s):\n", override)
+			warned = true
+		}
+		fmt.Fprintf(os.Stderr, "  - %s\n", v)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+func TestRunEnforcesDevcontainerPolicy(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	policyPath := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "packnplay", "policy.json")
+	if err := os.MkdirAll(filepath.Dir(policyPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policyPath, []byte(`{"properties": {"deny": ["privileged"]}, "run_args": {"deny": ["--network=host"]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project := newProject(t, `{"image": "alpine:3.20", "privileged": true, "runArgs": ["--net", "host"]}`)
+
+	err := Run(&RunConfig{Path: project, Command: []string{"bash"}})
+	var typed *errdefs.Error
+	if !errors.As(err, &typed) || typed.Category != errdefs.CategoryPolicy {
+		t.Fatalf("Run() error = %v, want a policy error", err)
+	}
+	for _, want := range []string{`property "privileged"`, `run argument "--network=host"`, policyPath} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() error = %v, want it to mention %s", err, want)
+		}
+	}
+	if len(fake.Containers()) != 0 {
+		t.Errorf("containers = %v, none should be created", fake.Containers())
+	}
+
+	// The user is not an admin of the policy, so an override is refused too
+	if err := Run(&RunConfig{Path: project, Command: []string{"bash"}, PolicyOverride: "testing"}); err == nil || !strings.Contains(err.Error(), "cannot override") {
+		t.Errorf("Run() with override error = %v, want the override refused", err)
+	}
+}
+
+func TestRunEnforcesPolicyOnFeatureProperties(t *testing.T) {
+	tests := []struct {
+		name      string
+		devConfig string
+		policy    string
+		want      string
+	}{
+		{
+			name:      "local feature",
+			devConfig: `{"image": "alpine:3.20", "remoteUser": "root", "features": {"./escalate": {}}}`,
+			policy:    `{"properties": {"deny": ["privileged"]}}`,
+			want:      `property "privileged"`,
+		},
+		{
+			name:      "inline feature",
+			devConfig: `{"image": "alpine:3.20", "remoteUser": "root", "customizations": {"packnplay": {"inlineFeatures": {"tools": {"installScript": "true", "capAdd": ["SYS_ADMIN"]}}}}}`,
+			policy:    `{"run_args": {"deny": ["--cap-add=SYS_ADMIN"]}}`,
+			want:      `run argument "--cap-add=SYS_ADMIN"`,
+		},
+		{
+			name:      "substituted runArgs",
+			devConfig: `{"image": "alpine:3.20", "remoteUser": "root", "runArgs": ["--network=${localEnv:PACKNPLAY_TEST_NETWORK}"]}`,
+			policy:    `{"run_args": {"deny": ["--network=host"]}}`,
+			want:      `run argument "--network=host"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRuntime(t, dockertest.New())
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			t.Setenv("PACKNPLAY_TEST_NETWORK", "host")
+			policyPath := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "packnplay", "policy.json")
+			if err := os.MkdirAll(filepath.Dir(policyPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(policyPath, []byte(tt.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			project := newProject(t, tt.devConfig)
+			featureDir := mkdirs(t, project, ".devcontainer/escalate")
+			if err := os.WriteFile(filepath.Join(featureDir, "devcontainer-feature.json"), []byte(`{"id": "escalate", "version": "1.0.0", "privileged": true}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(featureDir, "install.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Run(&RunConfig{Path: project, NoWorktree: true, DryRun: true, Command: []string{"bash"}})
+			if errdefs.CategoryOf(err) != errdefs.CategoryPolicy || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Run() error = %v, want a policy error for %s", err, tt.want)
+			}
+		})
+	}
+}
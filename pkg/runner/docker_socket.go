@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	// defaultDockerSocket is the daemon socket on Linux hosts and inside the
+	// Docker Desktop/Colima VMs on macOS
+	defaultDockerSocket = "/var/run/docker.sock"
+	// dockerHostSocketTarget is where docker-outside-of-docker features expect
+	// the host socket; their entrypoint proxies it to /var/run/docker.sock
+	dockerHostSocketTarget = "/var/run/docker-host.sock"
+)
+
+// dockerSocketWarning is printed whenever the host daemon socket is mounted
+const dockerSocketWarning = "Warning: --docker-socket gives the container full control of the host's container runtime (effectively root on the host)\n"
+
+// dockerFeatureKind classifies the docker features a devcontainer.json requests:
+// "outside" for docker-outside-of-docker, "in" for docker-in-docker, or ""
+func dockerFeatureKind(features map[string]interface{}) string {
+	kind := ""
+	for ref := range features {
+		name := featureName(ref)
+		switch {
+		case name == "docker-outside-of-docker" || name == "docker-from-docker":
+			return "outside"
+		case name == "docker-in-docker":
+			kind = "in"
+		}
+	}
+	return kind
+}
+
+// featureName returns the last path element of a feature reference without its version
+func featureName(ref string) string {
+	name := ref
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// hostDockerSocket returns the daemon socket to mount for the given runtime.
+// Bind mount sources are resolved by the daemon, so on macOS this is the path
+// inside the runtime's VM rather than the socket the CLI talks to.
+func hostDockerSocket(runtime string, isLinux bool) (string, error) {
+	if runtime == "container" {
+		return "", fmt.Errorf("docker socket passthrough is not supported with Apple Container")
+	}
+	if !isLinux {
+		return defaultDockerSocket, nil
+	}
+
+	var candidates []string
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return "", fmt.Errorf("DOCKER_HOST=%s is not a local unix socket", host)
+		}
+		candidates = append(candidates, strings.TrimPrefix(host, "unix://"))
+	} else if runtime == "podman" {
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+			candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+		}
+		candidates = append(candidates, "/run/podman/podman.sock")
+	} else {
+		candidates = append(candidates, defaultDockerSocket)
+	}
+
+	for _, path := range candidates {
+		if fileExists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no %s socket found at %s", runtime, strings.Join(candidates, " or "))
+}
+
+// dockerSocketArgs returns the docker run args that mount socket at target and
+// let a non-root container user use it. On Linux the container joins the
+// socket's group; elsewhere the socket is owned by root in the VM and its
+// permissions are adjusted after the container starts (see fixDockerSocketCommand).
+func dockerSocketArgs(socket, target string, isLinux bool) []string {
+	args := []string{"-v", fmt.Sprintf("%s:%s", socket, target)}
+	if isLinux {
+		if gid, ok := socketGroup(socket); ok && gid != 0 {
+			args = append(args, "--group-add", fmt.Sprintf("%d", gid))
+		}
+	}
+	return args
+}
+
+// socketGroup returns the owning group ID of a socket
+func socketGroup(path string) (uint32, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return stat.Gid, true
+}
+
+// fixDockerSocketCommand makes the mounted socket usable by the remote user when
+// it can't be granted through group membership. The socket is the VM's own, so
+// the new group and mode apply to every container that mounts it
+func fixDockerSocketCommand(target, remoteUser string) []string {
+	user, socket := shellQuote(remoteUser), shellQuote(target)
+	return []string{"sh", "-c", fmt.Sprintf("chgrp \"$(id -g %s)\" %s && chmod g+rw %s", user, socket, socket)}
+}
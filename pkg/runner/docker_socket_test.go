@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+func TestDockerFeatureKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		features map[string]interface{}
+		want     string
+	}{
+		{name: "none", features: nil, want: ""},
+		{name: "unrelated", features: map[string]interface{}{"ghcr.io/devcontainers/features/node:1": map[string]interface{}{}}, want: ""},
+		{name: "outside", features: map[string]interface{}{"ghcr.io/devcontainers/features/docker-outside-of-docker:1": map[string]interface{}{}}, want: "outside"},
+		{name: "legacy docker-from-docker", features: map[string]interface{}{"ghcr.io/devcontainers/features/docker-from-docker@sha256:abc": map[string]interface{}{}}, want: "outside"},
+		{name: "in", features: map[string]interface{}{"ghcr.io/devcontainers/features/docker-in-docker:2": map[string]interface{}{}}, want: "in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dockerFeatureKind(tt.features); got != tt.want {
+				t.Errorf("dockerFeatureKind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostDockerSocket(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	t.Run("DOCKER_HOST unix socket", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "unix://"+sock)
+		got, err := hostDockerSocket("docker", true)
+		if err != nil || got != sock {
+			t.Errorf("hostDockerSocket() = %q, %v; want %q", got, err, sock)
+		}
+	})
+
+	t.Run("DOCKER_HOST over tcp", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "tcp://10.0.0.1:2375")
+		if _, err := hostDockerSocket("docker", true); err == nil {
+			t.Error("hostDockerSocket() should reject a remote DOCKER_HOST")
+		}
+	})
+
+	t.Run("rootless podman", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "")
+		runtimeDir := t.TempDir()
+		podmanSock := filepath.Join(runtimeDir, "podman", "podman.sock")
+		if err := os.MkdirAll(filepath.Dir(podmanSock), 0755); err != nil {
+			t.Fatal(err)
+		}
+		podmanListener, err := net.Listen("unix", podmanSock)
+		if err != nil {
+			t.Skipf("unix sockets unavailable: %v", err)
+		}
+		defer podmanListener.Close()
+		t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+		got, err := hostDockerSocket("podman", true)
+		if err != nil || got != podmanSock {
+			t.Errorf("hostDockerSocket() = %q, %v; want %q", got, err, podmanSock)
+		}
+	})
+
+	t.Run("macOS uses the VM socket", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "unix:///Users/me/.colima/default/docker.sock")
+		got, err := hostDockerSocket("docker", false)
+		if err != nil || got != defaultDockerSocket {
+			t.Errorf("hostDockerSocket() = %q, %v; want %q", got, err, defaultDockerSocket)
+		}
+	})
+
+	t.Run("Apple Container", func(t *testing.T) {
+		if _, err := hostDockerSocket("container", false); err == nil {
+			t.Error("hostDockerSocket() should fail for Apple Container")
+		}
+	})
+}
+
+func TestDockerSocketArgs(t *testing.T) {
+	got := dockerSocketArgs("/run/user/1000/docker.sock", defaultDockerSocket, false)
+	want := []string{"-v", "/run/user/1000/docker.sock:/var/run/docker.sock"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dockerSocketArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestFixDockerSocketCommandQuotesUser(t *testing.T) {
+	got := fixDockerSocketCommand(defaultDockerSocket, "dev; rm -rf /")
+	want := []string{"sh", "-c", `chgrp "$(id -g 'dev; rm -rf /')" /var/run/docker.sock && chmod g+rw /var/run/docker.sock`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fixDockerSocketCommand() = %v, want %v", got, want)
+	}
+}
+
+func TestApplyFeaturePropertiesRewritesDockerSocket(t *testing.T) {
+	features := []*devcontainer.ResolvedFeature{{
+		ID: "docker-outside-of-docker",
+		Metadata: &devcontainer.FeatureMetadata{
+			Mounts: []devcontainer.Mount{{Source: defaultDockerSocket, Target: dockerHostSocketTarget, Type: "bind"}},
+		},
+	}}
+	ctx := &devcontainer.SubstituteContext{LocalEnv: map[string]string{}, ContainerEnv: map[string]string{}}
+
+	applier := NewFeaturePropertiesApplier()
+	applier.SetDockerSocket("/run/user/1000/docker.sock")
+	args, _, _, _, _ := applier.ApplyFeatureProperties(nil, features, map[string]string{}, ctx, false, "")
+
+	want := "--mount=type=bind,source=/run/user/1000/docker.sock,target=" + dockerHostSocketTarget
+	if strings.Join(args, " ") != want {
+		t.Errorf("ApplyFeatureProperties() args = %v, want [%s]", args, want)
+	}
+}
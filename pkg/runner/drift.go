@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// Config drift modes: what reusing a container whose effective configuration
+// changed since it was created does
+const (
+	DriftWarn     = "warn"     // print the changed settings (default)
+	DriftPrompt   = "prompt"   // ask whether to recreate the container, warning without a terminal
+	DriftRecreate = "recreate" // recreate the container without asking
+	DriftIgnore   = "ignore"   // say nothing
+)
+
+// effectiveSettings fingerprints the configuration a container is created
+// with, one hash per setting so a later run can tell which ones changed: each
+// top-level devcontainer.json property after merging and remoteUser detection,
+// the image, the locked feature versions, and the packnplay settings applied at
+// creation. Settings named after a flag (--ssh) are left out when unset, since
+// a reconnect needn't repeat the flags the container was created with.
+func effectiveSettings(config *RunConfig, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, imageName string) map[string]string {
+	settings := make(map[string]string)
+	set := func(name string, value interface{}) {
+		if data, err := json.Marshal(value); err == nil {
+			sum := sha256.Sum256(data)
+			settings[name] = hex.EncodeToString(sum[:8])
+		}
+	}
+
+	var properties map[string]json.RawMessage
+	if data, err := json.Marshal(devConfig); err == nil && json.Unmarshal(data, &properties) == nil {
+		for name, value := range properties {
+			set(name, value)
+		}
+	}
+	if len(devConfig.Entrypoint) > 0 {
+		set("entrypoint", devConfig.Entrypoint)
+	}
+	set("image", imageName)
+	if lockfile != nil && len(lockfile.Features) > 0 {
+		set("features (lockfile)", lockfile.Features)
+	}
+
+	set("credentials", config.Credentials)
+	set("default_env_vars", config.DefaultEnvVars)
+	set("mount_excludes", config.MountExcludes)
+	set("proxy", config.Proxy)
+	set("shell", config.Shell)
+	set("security", []string{config.MountRelabel, config.AppArmorProfile})
+	if config.DisableLabels {
+		set("security.disable_labels", true)
+	}
+	if policy, err := restartPolicy(config, devConfig); err == nil && policy != "" && policy != devcontainer.RestartNo {
+		set("restart_policy", policy)
+	}
+
+	if config.Platform != "" {
+		set("--platform", config.Platform)
+	}
+	if config.DockerSocket {
+		set("--docker-socket", true)
+	}
+	if config.HostBridge {
+		set("--host-bridge", config.HostBridgeActions)
+	}
+	if config.SSH {
+		set("--ssh", true)
+	}
+	return settings
+}
+
+// configDrift returns the names of the settings that differ between those
+// recorded when a container was created and the current ones, sorted
+func configDrift(recorded, current map[string]string) []string {
+	var changed []string
+	for name, value := range current {
+		if recorded[name] != value {
+			changed = append(changed, name)
+		}
+	}
+	for name := range recorded {
+		if _, ok := current[name]; !ok && !strings.HasPrefix(name, "--") {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// checkConfigDrift compares the settings recorded on an existing container
+// with current ones and applies the drift mode. It reports whether the
+// container should be recreated, having removed it. confirm asks on the
+// terminal, nil when there is none. Containers without recorded settings
+// (created by older versions, or on runtimes whose labels can't be read) are
+// never reported.
+func checkConfigDrift(dockerClient DockerClient, mode, containerName string, current map[string]string, confirm func(prompt string) bool, verbose bool) (bool, error) {
+	switch mode {
+	case "", DriftWarn, DriftPrompt, DriftRecreate:
+	case DriftIgnore:
+		return false, nil
+	default:
+		return false, errdefs.Errorf(errdefs.CategoryConfig, "invalid config_drift mode %q (use warn, prompt, recreate, or ignore)", mode)
+	}
+
+	labels := container.InspectLabels(dockerClient, containerName)[containerName]
+	recorded := container.ReadMetadata(labels).Settings
+	if len(recorded) == 0 {
+		return false, nil
+	}
+	changed := configDrift(recorded, current)
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	summary := fmt.Sprintf("the configuration of %s changed since it was created: %s", containerName, strings.Join(changed, ", "))
+	recreate := mode == DriftRecreate
+	if mode == DriftPrompt && confirm != nil {
+		fmt.Fprintf(os.Stderr, "Note: %s\nRecreating discards changes made in the container outside the workspace.\n", summary)
+		recreate = confirm("Recreate the container now? [y/N] ")
+	}
+	if !recreate {
+		if mode != DriftPrompt || confirm == nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\nThese changes don't apply to the existing container. To recreate it: packnplay stop %s\n", summary, containerName)
+		}
+		return false, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Recreating %s because its configuration changed\n", containerName)
+	if err := RunPreStop(dockerClient, containerName, verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if output, err := dockerClient.Run("rm", "-f", containerName); err != nil {
+		return false, errdefs.Errorf(errdefs.CategoryContainer, "failed to remove %s: %w\nDocker output:\n%s", containerName, err, output)
+	}
+	if err := RemoveSidecars(dockerClient, containerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return true, nil
+}
+
+// terminalConfirm returns confirmOnTerminal when stdin is a terminal, else nil
+func terminalConfirm() func(prompt string) bool {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	return confirmOnTerminal
+}
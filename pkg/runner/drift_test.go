@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestEffectiveSettingsFingerprintEachSetting(t *testing.T) {
+	devConfig := &devcontainer.Config{Image: "alpine:3.20", RemoteUser: "dev", ForwardPorts: []interface{}{3000}}
+	config := &RunConfig{}
+	base := effectiveSettings(config, devConfig, nil, "alpine:3.20")
+	if base["image"] == "" || base["remoteUser"] == "" || base["forwardPorts"] == "" {
+		t.Fatalf("effectiveSettings() = %v, want devcontainer properties and the image", base)
+	}
+	if _, ok := base["--ssh"]; ok {
+		t.Error("unset flags should not be recorded")
+	}
+
+	devConfig.ForwardPorts = []interface{}{3000, 8080}
+	config.SSH = true
+	got := configDrift(base, effectiveSettings(config, devConfig, nil, "alpine:3.20"))
+	if strings.Join(got, ",") != "--ssh,forwardPorts" {
+		t.Errorf("configDrift() = %v, want the changed port list and the new flag", got)
+	}
+}
+
+func TestConfigDriftIgnoresOmittedFlags(t *testing.T) {
+	recorded := map[string]string{"image": "a", "--ssh": "b", "remoteUser": "c"}
+	if got := configDrift(recorded, map[string]string{"image": "a", "remoteUser": "c"}); len(got) != 0 {
+		t.Errorf("configDrift() = %v, want a flag left off a reconnect ignored", got)
+	}
+	if got := configDrift(recorded, map[string]string{"image": "a", "--ssh": "b"}); strings.Join(got, ",") != "remoteUser" {
+		t.Errorf("configDrift() = %v, want a removed property reported", got)
+	}
+}
+
+func TestRunReportsConfigDrift(t *testing.T) {
+	for _, tt := range []struct {
+		mode     string
+		recreate bool
+	}{
+		{mode: "", recreate: false},
+		{mode: DriftIgnore, recreate: false},
+		{mode: DriftPrompt, recreate: false}, // no terminal in tests
+		{mode: DriftRecreate, recreate: true},
+	} {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			fake := dockertest.New()
+			fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+			call := useFakeRuntime(t, fake)
+			project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+			if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			name := container.GenerateContainerName(project, "no-worktree")
+			first := fake.Container(name)
+			if len(container.ReadMetadata(first.Labels).Settings) == 0 {
+				t.Fatalf("labels = %v, want the effective settings recorded", first.Labels)
+			}
+
+			// Unchanged configuration: reused without a second look
+			if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, ConfigDrift: tt.mode, Command: []string{"bash"}}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if len(fake.CallsTo("run")) != 1 {
+				t.Fatal("an unchanged configuration should reuse the container")
+			}
+
+			devcontainerJSON := `{"image": "alpine:3.20", "remoteUser": "root", "containerEnv": {"MODE": "new"}}`
+			if err := os.WriteFile(filepath.Join(project, ".devcontainer", "devcontainer.json"), []byte(devcontainerJSON), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, ConfigDrift: tt.mode, Command: []string{"bash"}}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			recreated := len(fake.CallsTo("run")) == 2
+			if recreated != tt.recreate {
+				t.Fatalf("recreated = %v, want %v", recreated, tt.recreate)
+			}
+			current := fake.Container(name)
+			if tt.recreate && (current.ID == first.ID || !contains(current.RunArgs, "-e MODE=new")) {
+				t.Errorf("container = %+v, want a new one with the changed containerEnv", current)
+			}
+			if !contains(call.argv, current.ID, "bash") {
+				t.Errorf("exec = %v, want the current container", call.argv)
+			}
+		})
+	}
+}
+
+func TestCheckConfigDriftRejectsUnknownMode(t *testing.T) {
+	fake := dockertest.New()
+	if _, err := checkConfigDrift(fake, "sometimes", "c", nil, nil, false); err == nil {
+		t.Error("checkConfigDrift() should reject an unknown mode")
+	}
+}
@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+// LabelEphemeral marks throwaway containers created by run --ephemeral
+const LabelEphemeral = "packnplay-ephemeral"
+
+// ephemeralWorktreeName returns a unique pseudo-worktree name so an ephemeral
+// container never collides with the named container for the real worktree
+func ephemeralWorktreeName() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("ephemeral-%d", os.Getpid())
+	}
+	return "ephemeral-" + hex.EncodeToString(b)
+}
+
+// createEphemeralCredentialFile writes the container credentials to a
+// temporary file in the runtime directory instead of the shared one, so nothing
+// an ephemeral container does to them outlives it
+func createEphemeralCredentialFile(backend string) (string, error) {
+	f, err := credstore.CreateRuntimeTemp("ephemeral-credentials-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create credential file: %w", err)
+	}
+	defer f.Close()
+
+	creds := "{}"
+	if store, err := credstore.Open(backend, credstore.DefaultDir()); err == nil {
+		if stored, err := readContainerCredentials(store); err == nil {
+			creds = string(stored)
+		}
+	}
+	if creds == "{}" {
+		if initial, err := getInitialContainerCredentials(); err == nil {
+			creds = initial
+		}
+	}
+	if _, err := f.WriteString(creds); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write credential file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// runEphemeralCommand runs the user's command in an ephemeral container, then
+// stops it (the runtime removes it because it was started with --rm) and runs
+// cleanup. The command's exit status becomes packnplay's.
+func runEphemeralCommand(dockerClient DockerClient, containerID string, execArgs []string, timeout *execTimeout, cleanup func()) error {
+	cmdPath, err := lookPath(dockerClient.Command())
+	if err != nil {
+		return fmt.Errorf("failed to find docker command: %w", err)
+	}
+
+	var runErr error
+	if timeout != nil {
+		runErr = timeout.run(dockerClient, cmdPath, execArgs, containerID)
+		if err := performShutdownAction("stopContainer", dockerClient, containerID, nil, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: shutdown action failed: %v\n", err)
+		}
+	} else {
+		runErr = execWithShutdownAction(cmdPath, execArgs, "stopContainer", dockerClient, containerID, nil, "")
+	}
+	cleanup()
+	return exitWithCommandStatus(runErr)
+}
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+func TestEphemeralWorktreeName(t *testing.T) {
+	a := ephemeralWorktreeName()
+	b := ephemeralWorktreeName()
+	if !strings.HasPrefix(a, "ephemeral-") {
+		t.Errorf("ephemeralWorktreeName() = %q, want ephemeral- prefix", a)
+	}
+	if a == b {
+		t.Errorf("ephemeralWorktreeName() returned %q twice, want unique names", a)
+	}
+}
+
+func TestCreateEphemeralCredentialFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	path, err := createEphemeralCredentialFile(credstore.BackendFile)
+	if err != nil {
+		t.Fatalf("createEphemeralCredentialFile() error = %v", err)
+	}
+	defer os.Remove(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("credential file missing: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("credential file mode = %o, want 600", perm)
+	}
+	if strings.Contains(path, "credentials/claude-credentials.json") {
+		t.Errorf("ephemeral credential file %q must not be the shared persistent file", path)
+	}
+}
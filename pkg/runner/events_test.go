@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+)
+
+func decodeEvents(t *testing.T, data []byte) []events.Event {
+	t.Helper()
+	var got []events.Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event events.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		got = append(got, event)
+	}
+	return got
+}
+
+func TestRunEmitsEvents(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postCreateCommand": {"deps": "make deps"}}`)
+
+	var buf bytes.Buffer
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"make", "test"}, Events: events.New(&buf)}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var types []string
+	byType := make(map[string]events.Event)
+	for _, event := range decodeEvents(t, buf.Bytes()) {
+		types = append(types, event.Type)
+		if _, seen := byType[event.Type]; !seen {
+			byType[event.Type] = event
+		}
+	}
+	want := []string{
+		events.TypeRunStarted,
+		events.TypePhaseStarted, events.TypePhaseFinished, // resolve
+		events.TypePhaseStarted, events.TypeImageReady, events.TypePhaseFinished, // image
+		events.TypePhaseStarted, events.TypeContainerCreated, events.TypePhaseFinished, // create
+		events.TypePhaseStarted, events.TypeLifecycleTask, events.TypeLifecycle, events.TypePhaseFinished, // lifecycle
+		events.TypeExecStarted,
+	}
+	if !slices.Equal(types, want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	id := fake.Container(name).ID
+	if e := byType[events.TypeImageReady]; e.Image != "alpine:3.20" || !e.Cached {
+		t.Errorf("image_ready = %+v", e)
+	}
+	if e := byType[events.TypeContainerCreated]; e.Container != name || e.ContainerID != id {
+		t.Errorf("container_created = %+v", e)
+	}
+	if e := byType[events.TypeLifecycle]; e.Command != "postCreate" || e.Status != events.StatusSucceeded {
+		t.Errorf("lifecycle_command = %+v", e)
+	}
+	if e := byType[events.TypeLifecycleTask]; e.Task != "deps" || e.Status != events.StatusSucceeded {
+		t.Errorf("lifecycle_task = %+v", e)
+	}
+	if e := byType[events.TypeExecStarted]; e.ContainerID != id || !slices.Equal(e.Args, []string{"make", "test"}) {
+		t.Errorf("exec_started = %+v", e)
+	}
+}
+
+func TestRunEmitsFailure(t *testing.T) {
+	fake := dockertest.New()
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": `)
+
+	var buf bytes.Buffer
+	err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}, Events: events.New(&buf)})
+	if err == nil {
+		t.Fatal("Run() should fail on a broken devcontainer.json")
+	}
+
+	got := decodeEvents(t, buf.Bytes())
+	last := got[len(got)-1]
+	if last.Type != events.TypeRunFailed || last.Category != string(errdefs.CategoryConfig) || last.ExitCode != errdefs.ExitCode(err) {
+		t.Errorf("last event = %+v, want run_failed with the config category", last)
+	}
+	if finished := got[len(got)-2]; finished.Type != events.TypePhaseFinished || finished.Phase != events.PhaseResolve || finished.Status != events.StatusFailed {
+		t.Errorf("resolve phase = %+v, want failed", finished)
+	}
+}
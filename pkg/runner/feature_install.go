@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/internal/dockerfile"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// DefaultFeatureRetryPolicy tries a failing feature install three times, a
+// flaky mirror or network hiccup usually clearing up within a minute
+var DefaultFeatureRetryPolicy = PullRetryPolicy{Attempts: 3, InitialDelay: 5 * time.Second, MaxDelay: time.Minute}
+
+// featureRetryPolicy applies customizations.packnplay.features to the default policy
+func featureRetryPolicy(custom *devcontainer.FeatureCustomization) PullRetryPolicy {
+	policy := DefaultFeatureRetryPolicy
+	if custom != nil && custom.InstallAttempts > 0 {
+		policy.Attempts = custom.InstallAttempts
+	}
+	if custom != nil && custom.RetryDelay > 0 {
+		policy.InitialDelay = time.Duration(custom.RetryDelay) * time.Second
+		policy.MaxDelay = max(policy.MaxDelay, policy.InitialDelay)
+	}
+	return policy
+}
+
+// featureInstallLines is how much of a failed install's output is reported
+const featureInstallLines = 10
+
+// featureInstallError is a feature whose install.sh failed during an image build
+type featureInstallError struct {
+	Feature  string   // feature id
+	Status   int      // install.sh's exit status
+	Line     int      // the last line install.sh ran, 0 when unknown (not a bash script)
+	Command  string   // that line
+	Output   []string // the end of the install's output
+	Attempts int
+	Err      error
+}
+
+func (e *featureInstallError) Error() string {
+	msg := fmt.Sprintf("feature %s failed to install", e.Feature)
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" after %d attempts", e.Attempts)
+	}
+	msg += fmt.Sprintf(" (exit %d)", e.Status)
+	if e.Line > 0 {
+		msg += fmt.Sprintf(" at line %d of its install.sh: %s", e.Line, e.Command)
+	}
+	if len(e.Output) > 0 {
+		msg += "\n  " + strings.Join(e.Output, "\n  ")
+	}
+	return msg
+}
+
+func (e *featureInstallError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// featureFailurePattern matches the line dockerfile.InstallWrapper prints
+	featureFailurePattern = regexp.MustCompile(`^` + regexp.QuoteMeta(dockerfile.FeatureFailurePrefix) + `(\S+) failed \(exit (\d+)\)(?: at install\.sh line (\d+): (.*))?$`)
+	// buildKitLinePattern matches BuildKit's plain progress prefix: the step and the time into it
+	buildKitLinePattern = regexp.MustCompile(`^(#\d+) \d+(?:\.\d+)? (.*)$`)
+)
+
+// parseFeatureFailure finds the feature install that failed a build in its
+// output, or returns nil when the build failed some other way
+func parseFeatureFailure(err error) *featureInstallError {
+	var buildErr *docker.BuildError
+	if !errors.As(err, &buildErr) {
+		return nil
+	}
+	lines := strings.Split(buildErr.Output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		step, text := buildKitLine(lines[i])
+		match := featureFailurePattern.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		failure := &featureInstallError{Feature: match[1], Command: match[4], Err: err}
+		failure.Status, _ = strconv.Atoi(match[2])
+		failure.Line, _ = strconv.Atoi(match[3])
+
+		// The install's own output leads up to the failure line
+		for j := i - 1; j >= 0 && len(failure.Output) < featureInstallLines; j-- {
+			lineStep, text := buildKitLine(lines[j])
+			if step != "" && lineStep != step {
+				continue
+			}
+			if step == "" && (strings.HasPrefix(text, "STEP ") || strings.HasPrefix(text, "Step ")) {
+				break
+			}
+			failure.Output = append([]string{text}, failure.Output...)
+		}
+		return failure
+	}
+	return nil
+}
+
+// buildKitLine splits a BuildKit progress line into its step and text; other
+// builders' lines have no step
+func buildKitLine(line string) (step, text string) {
+	if match := buildKitLinePattern.FindStringSubmatch(line); match != nil {
+		return match[1], match[2]
+	}
+	return "", line
+}
+
+// buildFeatureImage runs a feature image build, retrying it while a feature
+// install fails. The features before the failing one are in the layer cache
+// by then, so a retry starts at the one that failed.
+func (im *ImageManager) buildFeatureImage(imageName string, buildArgs []string, policy PullRetryPolicy) error {
+	attempts := max(policy.Attempts, 1)
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := im.client.RunWithProgress(imageName, buildArgs...)
+		if err == nil {
+			return nil
+		}
+		failure := parseFeatureFailure(err)
+		if failure == nil {
+			return errdefs.Errorf(errdefs.CategoryImageBuild, "failed to build image with features: %w", err)
+		}
+		if attempt == attempts {
+			failure.Attempts = attempt
+			return errdefs.New(errdefs.CategoryImageBuild, failure)
+		}
+		fmt.Fprintf(os.Stderr, "Feature %s failed to install (exit %d)\nRetrying in %s (attempt %d/%d)...\n", failure.Feature, failure.Status, delay, attempt+1, attempts)
+		im.sleep(delay)
+		delay = min(delay*2, policy.MaxDelay)
+		// The first attempt rebuilt the features before the failing one
+		buildArgs = withoutArg(buildArgs, "--no-cache")
+	}
+}
+
+// withoutArg returns args without any occurrence of arg
+func withoutArg(args []string, arg string) []string {
+	var result []string
+	for _, a := range args {
+		if a != arg {
+			result = append(result, a)
+		}
+	}
+	return result
+}
@@ -0,0 +1,188 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+const buildKitFailure = `#7 [3/5] RUN cd /tmp/devcontainer-features/0-flaky && chmod +x install.sh && sh /tmp/devcontainer-features/packnplay-install.sh 'flaky'
+#7 0.231 Reading package lists...
+#8 [4/5] COPY other /tmp/devcontainer-features/1-other
+#7 1.020 E: Failed to fetch http://deb.debian.org/debian/pool/curl.deb  Connection timed out
+#7 1.022 packnplay: feature flaky failed (exit 100) at install.sh line 4: apt-get install -y curl
+#7 ERROR: process "/bin/sh -c cd /tmp/devcontainer-features/0-flaky" did not complete successfully: exit code: 100`
+
+func buildFailure(output string) error {
+	return &docker.BuildError{Err: errors.New("exit status 1"), Output: output}
+}
+
+func TestParseFeatureFailure(t *testing.T) {
+	failure := parseFeatureFailure(buildFailure(buildKitFailure))
+	if failure == nil {
+		t.Fatal("parseFeatureFailure() = nil for a failed install")
+	}
+	if failure.Feature != "flaky" || failure.Status != 100 || failure.Line != 4 || failure.Command != "apt-get install -y curl" {
+		t.Errorf("failure = %+v", failure)
+	}
+	wantOutput := []string{"Reading package lists...", "E: Failed to fetch http://deb.debian.org/debian/pool/curl.deb  Connection timed out"}
+	if !reflect.DeepEqual(failure.Output, wantOutput) {
+		t.Errorf("output = %q, want the feature's step only: %q", failure.Output, wantOutput)
+	}
+
+	podman := "STEP 4/6: RUN cd /tmp/devcontainer-features/0-tool && sh /tmp/devcontainer-features/packnplay-install.sh 'tool'\ndownloading tool\npackaging failed\npacknplay: feature tool failed (exit 2)\nError: building at STEP \"RUN cd\": exit status 2"
+	failure = parseFeatureFailure(buildFailure(podman))
+	if failure == nil || failure.Feature != "tool" || failure.Line != 0 || !reflect.DeepEqual(failure.Output, []string{"downloading tool", "packaging failed"}) {
+		t.Errorf("failure = %+v, want tool's output without a line", failure)
+	}
+
+	if failure := parseFeatureFailure(buildFailure("#3 ERROR: failed to solve: ubuntu:nope: not found")); failure != nil {
+		t.Errorf("parseFeatureFailure() = %+v for a build that failed otherwise", failure)
+	}
+	if failure := parseFeatureFailure(errors.New("exit status 1")); failure != nil {
+		t.Errorf("parseFeatureFailure() = %+v without build output", failure)
+	}
+}
+
+func TestFeatureRetryPolicy(t *testing.T) {
+	if got := featureRetryPolicy(nil); got != DefaultFeatureRetryPolicy {
+		t.Errorf("featureRetryPolicy(nil) = %+v, want the default", got)
+	}
+	got := featureRetryPolicy(&devcontainer.FeatureCustomization{InstallAttempts: 5, RetryDelay: 90})
+	if want := (PullRetryPolicy{Attempts: 5, InitialDelay: 90 * time.Second, MaxDelay: 90 * time.Second}); got != want {
+		t.Errorf("featureRetryPolicy() = %+v, want %+v", got, want)
+	}
+}
+
+// scriptedBuildClient fails builds with each output in turn, then succeeds,
+// recording each build's arguments and generated Dockerfile
+type scriptedBuildClient struct {
+	failures    []string
+	builds      [][]string
+	dockerfiles []string
+}
+
+func (c *scriptedBuildClient) RunWithProgress(imageName string, args ...string) error {
+	if args[0] != "build" {
+		return nil
+	}
+	c.builds = append(c.builds, args)
+	for i, arg := range args {
+		if arg == "-f" {
+			data, _ := os.ReadFile(args[i+1])
+			c.dockerfiles = append(c.dockerfiles, string(data))
+		}
+	}
+	if n := len(c.builds); n <= len(c.failures) {
+		return buildFailure(c.failures[n-1])
+	}
+	return nil
+}
+
+func (c *scriptedBuildClient) Run(args ...string) (string, error) {
+	return "", errors.New("not found")
+}
+
+func (c *scriptedBuildClient) Command() string {
+	return "docker"
+}
+
+// featureProject creates a project whose devcontainer.json uses local features
+func featureProject(t *testing.T, customizations string, ids ...string) (string, *devcontainer.Config) {
+	t.Helper()
+	project := t.TempDir()
+	devConfig := &devcontainer.Config{Image: "ubuntu:22.04", Features: map[string]interface{}{}}
+	for _, id := range ids {
+		dir := filepath.Join(project, ".devcontainer", id)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "devcontainer-feature.json"), []byte(`{"id": "`+id+`", "version": "1.0.0"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "install.sh"), []byte("#!/bin/bash\necho installing\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		devConfig.Features["./"+id] = map[string]interface{}{}
+	}
+	if customizations != "" {
+		devConfig.Customizations = map[string]json.RawMessage{"packnplay": json.RawMessage(customizations)}
+	}
+	return project, devConfig
+}
+
+func TestBuildWithFeaturesRetriesFailedInstall(t *testing.T) {
+	project, devConfig := featureProject(t, "", "flaky")
+	client := &scriptedBuildClient{failures: []string{buildKitFailure}}
+	im, waits := newRetryingManager(client)
+	im.SetRefresh(true, true)
+
+	if err := im.EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	if len(client.builds) != 2 {
+		t.Fatalf("builds = %d, want a retry after the failed install", len(client.builds))
+	}
+	if !contains(client.builds[0], "--no-cache") || contains(client.builds[1], "--no-cache") {
+		t.Errorf("builds = %v, want the retry to reuse the layers the first attempt built", client.builds)
+	}
+	if want := []time.Duration{5 * time.Second}; !reflect.DeepEqual(*waits, want) {
+		t.Errorf("waits = %v, want %v", *waits, want)
+	}
+	if !strings.Contains(client.dockerfiles[0], "sh /tmp/devcontainer-features/packnplay-install.sh 'flaky'") {
+		t.Errorf("Dockerfile should install through the wrapper:\n%s", client.dockerfiles[0])
+	}
+}
+
+func TestBuildWithFeaturesReportsPersistentFailure(t *testing.T) {
+	project, devConfig := featureProject(t, `{"features": {"installAttempts": 2}}`, "flaky")
+	client := &scriptedBuildClient{failures: []string{buildKitFailure, buildKitFailure, buildKitFailure}}
+	im, _ := newRetryingManager(client)
+
+	err := im.EnsureAvailable(devConfig, project)
+	if errdefs.CategoryOf(err) != errdefs.CategoryImageBuild {
+		t.Fatalf("EnsureAvailable() error = %v, want an image build error", err)
+	}
+	for _, want := range []string{"feature flaky failed to install after 2 attempts (exit 100) at line 4 of its install.sh: apt-get install -y curl", "Connection timed out"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want %q", err, want)
+		}
+	}
+	if len(client.builds) != 2 {
+		t.Errorf("builds = %d, want installAttempts", len(client.builds))
+	}
+}
+
+func TestBuildWithFeaturesLeavesOutOptionalFeature(t *testing.T) {
+	project, devConfig := featureProject(t, `{"features": {"installAttempts": 1, "optional": ["./flaky"]}}`, "flaky", "tool")
+	client := &scriptedBuildClient{failures: []string{buildKitFailure}}
+	im, _ := newRetryingManager(client)
+
+	if err := im.EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	if len(client.dockerfiles) != 2 {
+		t.Fatalf("builds = %d, want one more without the optional feature", len(client.dockerfiles))
+	}
+	last := client.dockerfiles[1]
+	if strings.Contains(last, "'flaky'") || !strings.Contains(last, "'tool'") {
+		t.Errorf("Dockerfile should leave out only the optional feature:\n%s", last)
+	}
+
+	// A required feature still fails the build
+	project, devConfig = featureProject(t, `{"features": {"installAttempts": 1, "optional": ["tool"]}}`, "flaky", "tool")
+	client = &scriptedBuildClient{failures: []string{buildKitFailure}}
+	im, _ = newRetryingManager(client)
+	if err := im.EnsureAvailable(devConfig, project); err == nil || !strings.Contains(err.Error(), "feature flaky failed") {
+		t.Errorf("EnsureAvailable() error = %v, want the required feature's failure", err)
+	}
+}
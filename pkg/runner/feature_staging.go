@@ -0,0 +1,106 @@
+package runner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// featureStagingDir is the directory inside a feature build's context that the
+// features are copied into
+const featureStagingDir = "oci-cache"
+
+// featureIgnoreFile lists paths to leave out when staging a local feature
+const featureIgnoreFile = ".featureignore"
+
+// featureSourcePath resolves a feature reference from devcontainer.json to the path
+// the resolver should load. Registry and URL references pass through unchanged;
+// local paths (including ../ paths outside .devcontainer) resolve relative to the
+// directory holding the devcontainer.json.
+func featureSourcePath(projectPath, ref string) string {
+	if filepath.IsAbs(ref) ||
+		strings.Contains(ref, "ghcr.io/") ||
+		strings.Contains(ref, "mcr.microsoft.com/") ||
+		strings.HasPrefix(ref, "http://") ||
+		strings.HasPrefix(ref, "https://") {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(devcontainer.ConfigFilePath(projectPath)), ref)
+}
+
+// stageFeature copies a feature directory into the staging area of the build
+// context, honoring its .featureignore. The staged name includes a hash of the
+// source path so features with the same directory name don't collide.
+func stageFeature(src, stagingRoot string) (string, error) {
+	sum := sha256.Sum256([]byte(src))
+	dst := filepath.Join(stagingRoot, filepath.Base(src)+"-"+hex.EncodeToString(sum[:])[:8])
+
+	if err := os.RemoveAll(dst); err != nil {
+		return "", err
+	}
+	ignore := loadFeatureIgnore(src)
+	if err := copyDir(src, dst, ignore.matches); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// featureIgnore holds .featureignore patterns (gitignore-style subset: globs,
+// leading / to anchor, trailing / for directories, ! to re-include)
+type featureIgnore struct {
+	patterns []string
+}
+
+// loadFeatureIgnore reads dir/.featureignore; a missing file ignores only .git
+func loadFeatureIgnore(dir string) *featureIgnore {
+	ignore := &featureIgnore{patterns: []string{".git/"}}
+
+	f, err := os.Open(filepath.Join(dir, featureIgnoreFile))
+	if err != nil {
+		return ignore
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ignore.patterns = append(ignore.patterns, line)
+	}
+	return ignore
+}
+
+// matches reports whether rel (slash-separated, relative to the feature root) is ignored
+func (fi *featureIgnore) matches(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	ignored := false
+	for _, pattern := range fi.patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+
+		var matched bool
+		if strings.HasPrefix(pattern, "/") || strings.Contains(pattern, "/") {
+			matched, _ = filepath.Match(strings.TrimPrefix(pattern, "/"), rel)
+		} else {
+			matched, _ = filepath.Match(pattern, filepath.Base(rel))
+		}
+		if matched {
+			ignored = !negate
+		}
+	}
+	return ignored
+}
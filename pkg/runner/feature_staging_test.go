@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestFeatureSourcePath(t *testing.T) {
+	tests := map[string]string{
+		"./local-feature":                       "/proj/.devcontainer/local-feature",
+		"../shared-features/foo":                "/proj/shared-features/foo",
+		"/opt/features/bar":                     "/opt/features/bar",
+		"ghcr.io/devcontainers/features/node:1": "ghcr.io/devcontainers/features/node:1",
+		"https://example.com/feature.tgz":       "https://example.com/feature.tgz",
+		"mcr.microsoft.com/devcontainers/foo:1": "mcr.microsoft.com/devcontainers/foo:1",
+	}
+	for ref, want := range tests {
+		if got := featureSourcePath("/proj", ref); got != want {
+			t.Errorf("featureSourcePath(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
+
+func TestFeatureIgnore(t *testing.T) {
+	ignore := &featureIgnore{patterns: []string{".git/", "node_modules/", "*.log", "/fixtures", "!keep.log"}}
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"node_modules", true, true},
+		{"lib/node_modules", true, true},
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"fixtures", true, true},
+		{"lib/fixtures", true, false},
+		{"install.sh", false, false},
+		{".git", true, true},
+	}
+	for _, tt := range tests {
+		if got := ignore.matches(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("matches(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestStageFeature(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "shared-features", "tool")
+	if err := os.MkdirAll(filepath.Join(src, "node_modules", "dep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"install.sh":                "#!/bin/sh\n",
+		".featureignore":            "# big stuff\nnode_modules/\n",
+		"node_modules/dep/index.js": "x",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	staging := filepath.Join(root, "proj", ".devcontainer", featureStagingDir)
+	dst, err := stageFeature(src, staging)
+	if err != nil {
+		t.Fatalf("stageFeature() error = %v", err)
+	}
+	if !strings.HasPrefix(filepath.Base(dst), "tool-") {
+		t.Errorf("staged dir = %s, want tool-<hash>", dst)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "install.sh")); err != nil {
+		t.Errorf("install.sh not staged: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("ignored node_modules was staged")
+	}
+
+	// A different feature with the same directory name must not collide
+	other := filepath.Join(root, "other", "tool")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	otherDst, err := stageFeature(other, staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherDst == dst {
+		t.Errorf("features from different sources staged to the same path %s", dst)
+	}
+}
+
+func TestImageManager_BuildWithSharedLocalFeature(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "apps", "web")
+	if err := os.MkdirAll(filepath.Join(projectDir, ".devcontainer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	featureDir := filepath.Join(root, "shared-features", "lint")
+	if err := os.MkdirAll(featureDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(featureDir, "devcontainer-feature.json"), []byte(`{"id": "lint", "version": "1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(featureDir, "install.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The build context only exists during the build, so look at it then
+	fake := dockertest.New()
+	var contextDir, generated string
+	fake.On(func(args []string) (string, error) {
+		contextDir = args[len(args)-1]
+		data, err := os.ReadFile(argValue(args, "-f"))
+		generated = string(data)
+		return "", err
+	}, "build")
+
+	im := NewImageManager(fake, false)
+	devConfig := &devcontainer.Config{
+		Image:      "ubuntu:22.04",
+		RemoteUser: "dev",
+		Features: map[string]interface{}{
+			"../../../shared-features/lint": map[string]interface{}{},
+		},
+	}
+
+	if err := im.EnsureAvailable(devConfig, projectDir); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+
+	if !strings.Contains(generated, "COPY "+featureStagingDir+"/lint-") {
+		t.Errorf("generated Dockerfile does not copy the staged feature:\n%s", generated)
+	}
+	if strings.HasPrefix(contextDir, root) {
+		t.Errorf("build context %s should be a synthetic directory, not part of the project", contextDir)
+	}
+	if _, err := os.Stat(contextDir); !os.IsNotExist(err) {
+		t.Errorf("build context %s should be removed after the build", contextDir)
+	}
+	if fileExists(filepath.Join(projectDir, ".devcontainer", "Dockerfile.generated")) {
+		t.Error("feature builds should not write into .devcontainer")
+	}
+}
@@ -0,0 +1,251 @@
+package runner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// foreign_binaries modes: what a new container does about native binaries in
+// mounted config directories that can't run in it
+const (
+	ForeignBinariesWarn    = "warn"    // list them (default)
+	ForeignBinariesShadow  = "shadow"  // list them and hide their node_modules so tools reinstall
+	ForeignBinariesRebuild = "rebuild" // list them and rebuild plugins' node_modules in the container
+	ForeignBinariesOff     = "off"     // don't scan
+)
+
+const (
+	// foreignScanLimit bounds the files looked at under one mount, so a huge
+	// config directory doesn't hold up container creation
+	foreignScanLimit = 50000
+	// foreignListLimit is how many foreign binaries a warning lists
+	foreignListLimit = 10
+)
+
+// foreignBinary is a native binary built for another OS or architecture than
+// the container's
+type foreignBinary struct {
+	HostPath string
+	Target   string // path in the container
+	Format   string // e.g. "Mach-O", "Windows PE", "ELF x86-64"
+}
+
+// elfMachines names the ELF e_machine values of the architectures containers run
+var elfMachines = map[uint16]string{
+	0x03: "386",
+	0x28: "arm",
+	0x3e: "amd64",
+	0xb7: "arm64",
+	0x14: "ppc",
+	0x15: "ppc64le",
+	0x16: "s390x",
+	0xf3: "riscv64",
+}
+
+// elfMachineNames are the names the ELF tools use for those architectures
+var elfMachineNames = map[string]string{
+	"386":   "i386",
+	"amd64": "x86-64",
+	"arm64": "aarch64",
+}
+
+// binaryFormat reads a file's header and returns the format of a native
+// binary that can't run on a linux/arch container, or "" when it can (or
+// isn't a binary)
+func binaryFormat(path, arch string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return ""
+	}
+
+	switch {
+	case string(header[:4]) == "\x7fELF":
+		order := binary.ByteOrder(binary.LittleEndian)
+		if header[5] == 2 {
+			order = binary.BigEndian
+		}
+		machine, ok := elfMachines[order.Uint16(header[18:20])]
+		if !ok || machine == arch {
+			return ""
+		}
+		if name, ok := elfMachineNames[machine]; ok {
+			return "ELF " + name
+		}
+		return "ELF " + machine
+	case isMachO(header[:4]):
+		return "Mach-O"
+	case string(header[:2]) == "MZ":
+		return "Windows PE"
+	}
+	return ""
+}
+
+// isMachO reports whether magic starts a Mach-O binary or universal binary
+func isMachO(magic []byte) bool {
+	switch binary.BigEndian.Uint32(magic) {
+	case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe, 0xcafebabe:
+		return true
+	}
+	return false
+}
+
+// mayBeBinary reports whether a file is worth reading the header of: native
+// modules and shared libraries by name, anything else only when executable
+func mayBeBinary(d fs.DirEntry) bool {
+	switch filepath.Ext(d.Name()) {
+	case ".node", ".so", ".dylib", ".dll", ".exe":
+		return true
+	}
+	info, err := d.Info()
+	return err == nil && info.Mode()&0111 != 0
+}
+
+// scanForeignBinaries walks a mounted host directory for binaries that can't
+// run on a linux/arch container
+func scanForeignBinaries(mount bindMount, arch string) []foreignBinary {
+	var found []foreignBinary
+	visited := 0
+	_ = filepath.WalkDir(mount.source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if visited++; visited > foreignScanLimit {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !mayBeBinary(d) {
+			return nil
+		}
+		if format := binaryFormat(path, arch); format != "" {
+			target, _ := excludeTarget([]bindMount{mount}, path)
+			found = append(found, foreignBinary{HostPath: path, Target: target, Format: format})
+		}
+		return nil
+	})
+	return found
+}
+
+// shadowPath is the directory to hide so a foreign binary's tool reinstalls
+// it: its outermost node_modules below the mount, or else its own directory
+func shadowPath(mount bindMount, binaryPath string) string {
+	rel, err := filepath.Rel(mount.source, binaryPath)
+	if err != nil {
+		return filepath.Dir(binaryPath)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts[:len(parts)-1] {
+		if part == "node_modules" {
+			return filepath.Join(append([]string{mount.source}, parts[:i+1]...)...)
+		}
+	}
+	return filepath.Dir(binaryPath)
+}
+
+// containerArch is the architecture a container for platform runs: the
+// platform's, or the host's since the runtime's VM matches it
+func containerArch(platform string) string {
+	if platform != "" {
+		return platformArch(platform)
+	}
+	return runtime.GOARCH
+}
+
+// foreignBinaryPlan is what a new container does about the foreign binaries
+// in its mounts
+type foreignBinaryPlan struct {
+	Shadows  []string        // host paths to hide, passed to mountExcludeArgs
+	Rebuilds []pluginRebuild // plugins whose node_modules are rebuilt in the container
+}
+
+// checkForeignBinaries scans the directories bind mounted from the host home
+// (agent config directories such as ~/.claude, and mounts of other tools'
+// config) for native binaries built for another OS or architecture, such as
+// Mach-O modules a plugin installed on a Mac. They fail with "exec format
+// error" or "invalid ELF header" in the container, so each is listed. In
+// shadow mode the directories holding them are hidden; in rebuild mode the
+// node_modules of plugins (directories with a package.json) are rebuilt in the
+// container instead, and only the rest hidden. The workspace is left out: it
+// is the project's own to rebuild.
+func checkForeignBinaries(args []string, mode, platform, homeDir, workspace string, verbose bool) (*foreignBinaryPlan, error) {
+	switch mode {
+	case "", ForeignBinariesWarn, ForeignBinariesShadow, ForeignBinariesRebuild:
+	case ForeignBinariesOff:
+		return &foreignBinaryPlan{}, nil
+	default:
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "invalid foreign_binaries mode %q (use warn, shadow, rebuild, or off)", mode)
+	}
+
+	arch := containerArch(platform)
+	plan := &foreignBinaryPlan{}
+	seen := make(map[string]bool)
+	for _, mount := range parseBindMounts(args) {
+		if !withinDir(mount.source, homeDir) || withinDir(mount.source, workspace) || mount.source == filepath.Clean(homeDir) || seen[mount.source] {
+			continue
+		}
+		seen[mount.source] = true
+		if info, err := os.Stat(mount.source); err != nil || !info.IsDir() {
+			continue
+		}
+
+		found := scanForeignBinaries(mount, arch)
+		if len(found) == 0 {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %d native binaries in %s are built for another platform and will fail in this linux/%s container:\n", len(found), mount.source, arch)
+		for i, binary := range found {
+			if i == foreignListLimit && !verbose {
+				fmt.Fprintf(os.Stderr, "  ... and %d more (--verbose lists them all)\n", len(found)-i)
+				break
+			}
+			fmt.Fprintf(os.Stderr, "  %s (%s)\n", binary.Target, binary.Format)
+		}
+
+		if mode == "" || mode == ForeignBinariesWarn {
+			fmt.Fprintf(os.Stderr, "  Set foreign_binaries to rebuild in config.json to rebuild plugins' native modules for the container, or to shadow to hide them\n")
+			continue
+		}
+		var dirs []string
+		for _, binary := range found {
+			dirs = append(dirs, shadowPath(mount, binary.HostPath))
+		}
+		sort.Strings(dirs)
+		var covered string
+		for _, dir := range dirs {
+			// Covers a nested node_modules too
+			if covered != "" && withinDir(dir, covered) {
+				continue
+			}
+			covered = dir
+			target, _ := excludeTarget([]bindMount{mount}, dir)
+			if mode == ForeignBinariesRebuild {
+				if rebuild, ok := planPluginRebuild(dir, target, arch, homeDir); ok {
+					plan.Rebuilds = append(plan.Rebuilds, rebuild)
+					fmt.Fprintf(os.Stderr, "  Rebuilding %s for the container (plugin %s %s)\n", target, rebuild.Name, rebuild.Version)
+					continue
+				}
+			}
+			plan.Shadows = append(plan.Shadows, dir)
+			fmt.Fprintf(os.Stderr, "  Hiding %s in the container, so tools reinstall it\n", target)
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// elfHeader returns the start of a little-endian ELF binary for machine
+func elfHeader(machine byte) []byte {
+	header := make([]byte, 64)
+	copy(header, "\x7fELF\x02\x01")
+	header[18] = machine
+	return header
+}
+
+var machOHeader = append([]byte{0xcf, 0xfa, 0xed, 0xfe}, make([]byte, 60)...)
+
+func writeBinary(t *testing.T, path string, data []byte, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		arch string
+		want string
+	}{
+		{"mach-o", machOHeader, "arm64", "Mach-O"},
+		{"universal", append([]byte{0xca, 0xfe, 0xba, 0xbe}, make([]byte, 60)...), "amd64", "Mach-O"},
+		{"elf other arch", elfHeader(0x3e), "arm64", "ELF x86-64"},
+		{"elf same arch", elfHeader(0xb7), "arm64", ""},
+		{"pe", append([]byte("MZ"), make([]byte, 62)...), "amd64", "Windows PE"},
+		{"script", []byte("#!/bin/sh\necho hello from a script\n"), "amd64", ""},
+		{"short", []byte("\x7fELF"), "amd64", ""},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		writeBinary(t, path, tt.data, 0755)
+		if got := binaryFormat(path, tt.arch); got != tt.want {
+			t.Errorf("binaryFormat(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckForeignBinaries(t *testing.T) {
+	home := t.TempDir()
+	claude := filepath.Join(home, ".claude")
+	plugin := filepath.Join(claude, "plugins", "search")
+	writeBinary(t, filepath.Join(plugin, "node_modules", "fsevents", "fsevents.node"), machOHeader, 0644)
+	writeBinary(t, filepath.Join(plugin, "node_modules", "sharp", "node_modules", "vips", "vips.node"), machOHeader, 0644)
+	writeBinary(t, filepath.Join(claude, "local", "bin", "rg"), elfHeader(0x3e), 0755)
+	writeBinary(t, filepath.Join(claude, "local", "bin", "fd"), elfHeader(0xb7), 0755)
+	writeBinary(t, filepath.Join(claude, "projects", "notes.jsonl"), machOHeader, 0644)
+	workspace := filepath.Join(home, "src", "app")
+	writeBinary(t, filepath.Join(workspace, "node_modules", "esbuild", "bin", "esbuild"), machOHeader, 0755)
+
+	args := []string{"-v", claude + ":/home/dev/.claude", "-v", workspace + ":/workspace", "-v", "/etc/hosts:/etc/hosts:ro"}
+
+	plan, err := checkForeignBinaries(args, "", "linux/arm64", home, workspace, false)
+	if err != nil || plan.Shadows != nil || plan.Rebuilds != nil {
+		t.Fatalf("checkForeignBinaries() = %+v, %v; want nothing hidden by default", plan, err)
+	}
+
+	plan, err = checkForeignBinaries(args, ForeignBinariesShadow, "linux/arm64", home, workspace, false)
+	if err != nil {
+		t.Fatalf("checkForeignBinaries() error = %v", err)
+	}
+	want := []string{filepath.Join(claude, "local", "bin"), filepath.Join(plugin, "node_modules")}
+	if !reflect.DeepEqual(plan.Shadows, want) {
+		t.Errorf("shadows = %v, want %v", plan.Shadows, want)
+	}
+	overlay := mountExcludeArgs(args, plan.Shadows, home, false)
+	if !contains(overlay, "type=tmpfs,destination=/home/dev/.claude/plugins/search/node_modules", "type=tmpfs,destination=/home/dev/.claude/local/bin") {
+		t.Errorf("overlay = %v", overlay)
+	}
+
+	if plan, _ := checkForeignBinaries(args, ForeignBinariesOff, "linux/arm64", home, workspace, false); plan.Shadows != nil {
+		t.Errorf("off mode shadows = %v", plan.Shadows)
+	}
+	if _, err := checkForeignBinaries(args, "hide", "", home, workspace, false); errdefs.CategoryOf(err) != errdefs.CategoryConfig {
+		t.Errorf("checkForeignBinaries() error = %v, want a config error for an unknown mode", err)
+	}
+}
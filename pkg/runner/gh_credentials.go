@@ -0,0 +1,268 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/ghtoken"
+	"github.com/obra/packnplay/pkg/git"
+)
+
+// GHBridgeLabel marks containers that receive gh credentials copied from the host.
+// Its value is the container user whose hosts.yml is kept in sync.
+const GHBridgeLabel = "packnplay-gh-bridge"
+
+// GHRepoLabel marks containers whose gh credentials are a token minted for one
+// repository (github.token_scope repo). Its value is owner/repo; the
+// credential watcher mints a new token before the last one expires.
+const GHRepoLabel = "packnplay-gh-repo"
+
+// GetHostGHToken returns the host's GitHub CLI token (from Keychain on macOS)
+func GetHostGHToken() (string, error) {
+	output, err := exec.Command("gh", "auth", "token", "--hostname", "github.com").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get gh auth token: %w", err)
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("gh auth token returned no token")
+	}
+	return token, nil
+}
+
+// getHostGHUser returns the login of the authenticated gh user, if known
+func getHostGHUser() string {
+	output, err := exec.Command("gh", "api", "user", "--jq", ".login").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// buildGHHostsYAML renders a hosts.yml scoped to github.com
+func buildGHHostsYAML(token, user string) string {
+	var b strings.Builder
+	b.WriteString("github.com:\n")
+	fmt.Fprintf(&b, "    oauth_token: %s\n", token)
+	b.WriteString("    git_protocol: https\n")
+	if user != "" {
+		fmt.Fprintf(&b, "    user: %s\n", user)
+	}
+	return b.String()
+}
+
+// WriteGHCredentials writes a hosts.yml carrying the given token into the container
+func WriteGHCredentials(dockerClient DockerClient, containerID, remoteUser, token string, verbose bool) error {
+	return writeGHHosts(dockerClient, containerID, remoteUser, token, getHostGHUser(), verbose)
+}
+
+// writeGHHosts writes a hosts.yml carrying the token, and the user it belongs
+// to when known, into the container
+func writeGHHosts(dockerClient DockerClient, containerID, remoteUser, token, user string, verbose bool) error {
+	tempDir, err := os.MkdirTemp("", "packnplay-gh-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	srcPath := filepath.Join(tempDir, "hosts.yml")
+	if err := os.WriteFile(srcPath, []byte(buildGHHostsYAML(token, user)), 0600); err != nil {
+		return fmt.Errorf("failed to stage hosts.yml: %w", err)
+	}
+
+	dstPath := path.Join(containerRemoteHome(dockerClient, containerID, remoteUser), ".config", "gh", "hosts.yml")
+	if err := copyFileToContainer(dockerClient, containerID, srcPath, dstPath, remoteUser, verbose); err != nil {
+		return fmt.Errorf("failed to copy gh credentials: %w", err)
+	}
+	_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chmod", "600", dstPath)
+	_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chown", userOwner(remoteUser), path.Dir(dstPath))
+
+	return recordInjectedFiles(dockerClient, containerID, []string{dstPath})
+}
+
+// injectGHCredentials bridges the host gh token into the container
+func injectGHCredentials(dockerClient DockerClient, containerID, remoteUser string, verbose bool) error {
+	token, err := GetHostGHToken()
+	if err != nil {
+		return err
+	}
+	return WriteGHCredentials(dockerClient, containerID, remoteUser, token, verbose)
+}
+
+// ghTokenRepo returns the owner/repo a repo-scoped token is minted for: the
+// workspace's origin remote, which must be on the configured GitHub host
+func ghTokenRepo(settings config.GitHubConfig, mountPath string) (string, error) {
+	remote, err := git.GetRemoteURL(mountPath, "origin")
+	if err != nil {
+		return "", fmt.Errorf("the workspace has no origin remote to scope a GitHub token to")
+	}
+	host := ghtoken.APIHost(settings.APIURL)
+	owner, repo, ok := ghtoken.ParseRemote(remote, host)
+	if !ok {
+		return "", fmt.Errorf("origin %s is not a %s repository", remote, host)
+	}
+	return owner + "/" + repo, nil
+}
+
+// mintRepoGHToken mints a token for owner/repo through the configured GitHub App
+func mintRepoGHToken(settings config.GitHubConfig, ownerRepo string) (*ghtoken.Token, error) {
+	keyPath := settings.AppPrivateKey
+	if home, err := os.UserHomeDir(); err == nil && keyPath != "" {
+		keyPath = expandExcludePath(keyPath, home)
+	}
+	app, err := ghtoken.LoadApp(settings.AppID, keyPath, settings.APIURL)
+	if err != nil {
+		return nil, err
+	}
+	owner, repo, _ := strings.Cut(ownerRepo, "/")
+	return app.Mint(owner, repo, settings.Permissions)
+}
+
+// injectRepoGHToken mints a token for the container's repository and writes it
+// into the container's gh hosts.yml, recording its expiry for the watcher
+func injectRepoGHToken(dockerClient DockerClient, containerID, remoteUser string, settings config.GitHubConfig, ownerRepo string, verbose bool) error {
+	token, err := mintRepoGHToken(settings, ownerRepo)
+	if err != nil {
+		return err
+	}
+	if err := writeGHHosts(dockerClient, containerID, remoteUser, token.Token, "", verbose); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "GitHub token limited to %s, valid until %s\n", ownerRepo, token.ExpiresAt.Local().Format(time.Kitchen))
+	}
+	return recordGHTokenExpiry(ownerRepo, token.ExpiresAt)
+}
+
+// recordGHTokenExpiry notes when the latest token for a repository expires
+func recordGHTokenExpiry(ownerRepo string, expiresAt time.Time) error {
+	dir, err := credstore.EnsureRuntimeDir()
+	if err != nil {
+		return err
+	}
+	path := ghtoken.StatePath(dir)
+	expiries := ghtoken.LoadExpiries(path)
+	expiries[ownerRepo] = expiresAt
+	return ghtoken.SaveExpiries(path, expiries)
+}
+
+// resumeGHCredentials gives a restarted container its gh credentials again.
+// The host's token was scrubbed from hosts.yml when it stopped, and a
+// repo-scoped token may have expired while it was stopped, since the watcher
+// only refreshes running containers.
+func resumeGHCredentials(dockerClient DockerClient, containerName string, settings config.GitHubConfig, verbose bool) error {
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil
+	}
+	output, err := dockerClient.Run("inspect", "--format", "{{json .Config.Labels}}", containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &labels); err != nil {
+		return fmt.Errorf("failed to parse container labels: %w", err)
+	}
+	remoteUser, bridged := labels[GHBridgeLabel]
+	if !bridged {
+		return nil
+	}
+	ownerRepo, scoped := labels[GHRepoLabel]
+	if !scoped {
+		if err := injectGHCredentials(dockerClient, containerName, remoteUser, verbose); err != nil {
+			return fmt.Errorf("GitHub CLI credentials not available in container: %w", err)
+		}
+		return nil
+	}
+	if err := injectRepoGHToken(dockerClient, containerName, remoteUser, settings, ownerRepo, verbose); err != nil {
+		return fmt.Errorf("GitHub credentials for %s not refreshed: %w", ownerRepo, err)
+	}
+	return nil
+}
+
+// RefreshRepoGHTokens mints new tokens for the repositories whose latest token
+// expires within ghtoken.RefreshMargin of now, writing them into the running
+// containers that use them. Repositories no container uses any more are
+// forgotten. The credential watcher calls it periodically.
+func RefreshRepoGHTokens(dockerClient DockerClient, settings config.GitHubConfig, now time.Time) error {
+	dir, err := credstore.EnsureRuntimeDir()
+	if err != nil {
+		return err
+	}
+	path := ghtoken.StatePath(dir)
+	expiries := ghtoken.LoadExpiries(path)
+	var failed error
+	for ownerRepo, expiresAt := range expiries {
+		if expiresAt.Sub(now) > ghtoken.RefreshMargin {
+			continue
+		}
+		output, err := dockerClient.Run("ps", "--filter", fmt.Sprintf("label=%s=%s", GHRepoLabel, ownerRepo), "--format", fmt.Sprintf("{{.ID}} {{.Label %q}}", GHBridgeLabel))
+		if err != nil {
+			return fmt.Errorf("failed to list containers using %s tokens: %w", ownerRepo, err)
+		}
+		var containers [][]string
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 {
+				containers = append(containers, fields)
+			}
+		}
+		if len(containers) == 0 {
+			delete(expiries, ownerRepo)
+			continue
+		}
+
+		token, err := mintRepoGHToken(settings, ownerRepo)
+		if err != nil {
+			failed = fmt.Errorf("failed to refresh the GitHub token for %s: %w", ownerRepo, err)
+			continue
+		}
+		for _, c := range containers {
+			if err := writeGHHosts(dockerClient, c[0], c[1], token.Token, "", false); err != nil {
+				failed = err
+			}
+		}
+		expiries[ownerRepo] = token.ExpiresAt
+	}
+	if err := ghtoken.SaveExpiries(path, expiries); err != nil {
+		return err
+	}
+	return failed
+}
+
+// planRepoGHToken decides whether a new container's gh credentials are a
+// token minted for the workspace's repository, returning the repository. When
+// github.token_scope is repo but no token can be minted for the workspace, the
+// host's token is withheld rather than passed instead.
+func planRepoGHToken(creds config.Credentials, settings config.GitHubConfig, mountPath string) (repo string, withhold bool, err error) {
+	switch settings.TokenScope {
+	case "", config.GHTokenHost:
+		return "", false, nil
+	case config.GHTokenRepo:
+	default:
+		return "", false, errdefs.Errorf(errdefs.CategoryConfig, "invalid github.token_scope %q (use host or repo)", settings.TokenScope)
+	}
+	if !creds.GH {
+		return "", false, nil
+	}
+	repo, err = ghTokenRepo(settings, mountPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: no GitHub credentials in the container: github.token_scope is repo but %v\n", err)
+		return "", true, nil
+	}
+	return repo, false, nil
+}
+
+// withheldGHEnv reports whether a host environment variable carrying a GitHub
+// token is kept out of the container, because tokens are scoped to the
+// repository and the host's may grant much more
+func withheldGHEnv(name string, settings config.GitHubConfig) bool {
+	return settings.TokenScope == config.GHTokenRepo && (name == "GH_TOKEN" || name == "GITHUB_TOKEN")
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/ghtoken"
+)
+
+func TestBuildGHHostsYAML(t *testing.T) {
+	got := buildGHHostsYAML("gho_abc123", "octocat")
+
+	want := "github.com:\n    oauth_token: gho_abc123\n    git_protocol: https\n    user: octocat\n"
+	if got != want {
+		t.Errorf("buildGHHostsYAML() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// User is optional when the login can't be determined
+	got = buildGHHostsYAML("gho_abc123", "")
+	if strings.Contains(got, "user:") {
+		t.Errorf("buildGHHostsYAML() without user should omit user key:\n%s", got)
+	}
+}
+
+// ghAppServer serves the GitHub App endpoints, minting token for any repository
+func ghAppServer(t *testing.T, token string, expires time.Time) (config.GitHubConfig, *[]string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var minted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			minted = append(minted, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/repos/"), "/installation"))
+			_, _ = w.Write([]byte(`{"id": 7}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_at": expires})
+	}))
+	t.Cleanup(server.Close)
+	return config.GitHubConfig{TokenScope: config.GHTokenRepo, AppID: 99, AppPrivateKey: keyPath, APIURL: server.URL}, &minted
+}
+
+func TestPlanRepoGHToken(t *testing.T) {
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init", "-q"}, {"remote", "add", "origin", "git@github.com:acme/api.git"}} {
+		if output, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	creds := config.Credentials{GH: true}
+	settings := config.GitHubConfig{TokenScope: config.GHTokenRepo}
+
+	if got, withhold, err := planRepoGHToken(creds, settings, repo); err != nil || got != "acme/api" || withhold {
+		t.Errorf("planRepoGHToken() = %q, %v, %v; want the origin repository", got, withhold, err)
+	}
+	if got, withhold, _ := planRepoGHToken(creds, settings, t.TempDir()); got != "" || !withhold {
+		t.Errorf("planRepoGHToken() = %q, %v; want the host token withheld without a GitHub origin", got, withhold)
+	}
+	if got, withhold, _ := planRepoGHToken(creds, config.GitHubConfig{}, repo); got != "" || withhold {
+		t.Errorf("planRepoGHToken() = %q, %v; want the host token by default", got, withhold)
+	}
+	if _, _, err := planRepoGHToken(creds, config.GitHubConfig{TokenScope: "org"}, repo); errdefs.CategoryOf(err) != errdefs.CategoryConfig {
+		t.Errorf("planRepoGHToken() error = %v, want a config error", err)
+	}
+
+	if !withheldGHEnv("GH_TOKEN", settings) || withheldGHEnv("ANTHROPIC_API_KEY", settings) || withheldGHEnv("GH_TOKEN", config.GitHubConfig{}) {
+		t.Error("withheldGHEnv() should keep only GitHub tokens out, and only when scoping")
+	}
+}
+
+func TestRefreshRepoGHTokens(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	now := time.Now()
+	settings, minted := ghAppServer(t, "ghs_fresh", now.Add(time.Hour))
+	path := ghtoken.StatePath(credstore.RuntimeDir())
+	if err := ghtoken.SaveExpiries(path, map[string]time.Time{
+		"acme/api":  now.Add(5 * time.Minute),  // about to expire
+		"acme/web":  now.Add(50 * time.Minute), // still fresh
+		"acme/gone": now.Add(-time.Minute),     // no container uses it
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-api-main", Running: true, Labels: map[string]string{GHRepoLabel: "acme/api", GHBridgeLabel: "dev"}})
+	var written []string
+	fake.On(func(args []string) (string, error) {
+		data, _ := os.ReadFile(args[1])
+		written = append(written, string(data))
+		return "", nil
+	}, "cp")
+
+	if err := RefreshRepoGHTokens(fake, settings, now); err != nil {
+		t.Fatalf("RefreshRepoGHTokens() error = %v", err)
+	}
+	if !reflect.DeepEqual(*minted, []string{"acme/api"}) {
+		t.Errorf("minted = %v, want only the expiring repository's token", *minted)
+	}
+	if len(written) != 1 || !strings.Contains(written[0], "oauth_token: ghs_fresh") {
+		t.Errorf("hosts.yml written = %q", written)
+	}
+	expiries := ghtoken.LoadExpiries(path)
+	if _, ok := expiries["acme/gone"]; ok || !expiries["acme/api"].After(now.Add(30*time.Minute)) {
+		t.Errorf("expiries = %v, want acme/api renewed and acme/gone forgotten", expiries)
+	}
+}
+
+func TestResumeGHCredentials(t *testing.T) {
+	// gh on the host hands out its token, but can't look up the user
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = auth ]; then echo gho_host; else exit 1; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "gh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-bridged-main", Running: true, Labels: map[string]string{GHBridgeLabel: "dev"}})
+	fake.AddContainer(dockertest.Container{Name: "packnplay-mounted-main", Running: true})
+	var written []string
+	fake.On(func(args []string) (string, error) {
+		data, _ := os.ReadFile(args[1])
+		written = append(written, string(data))
+		return "", nil
+	}, "cp")
+
+	// The host token scrubbed on stop is copied in again
+	if err := resumeGHCredentials(fake, "packnplay-bridged-main", config.GitHubConfig{}, false); err != nil {
+		t.Fatalf("resumeGHCredentials() error = %v", err)
+	}
+	if len(written) != 1 || !strings.Contains(written[0], "oauth_token: gho_host") {
+		t.Errorf("hosts.yml written = %q, want the host token", written)
+	}
+
+	// Containers that mount ~/.config/gh (or have no gh credentials) get nothing
+	if err := resumeGHCredentials(fake, "packnplay-mounted-main", config.GitHubConfig{}, false); err != nil || len(written) != 1 {
+		t.Errorf("resumeGHCredentials() without the bridge label = %v, wrote %d files", err, len(written)-1)
+	}
+}
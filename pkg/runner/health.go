@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ContainerState is the subset of docker inspect's .State used for health checks
+type ContainerState struct {
+	Status     string `json:"Status"`
+	Running    bool   `json:"Running"`
+	Paused     bool   `json:"Paused"`
+	Restarting bool   `json:"Restarting"`
+	Dead       bool   `json:"Dead"`
+	ExitCode   int    `json:"ExitCode"`
+	StartedAt  string `json:"StartedAt"`
+}
+
+// Healthy reports whether the container's keep-alive process is up and usable
+func (s *ContainerState) Healthy() bool {
+	return s.Running && !s.Paused && !s.Restarting
+}
+
+// parseContainerState parses "<id> <state json>" as produced by inspectContainerState
+func parseContainerState(output string) (string, *ContainerState, error) {
+	id, stateJSON, ok := strings.Cut(strings.TrimSpace(output), " ")
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected inspect output: %q", output)
+	}
+
+	var state ContainerState
+	if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+		return "", nil, fmt.Errorf("failed to parse container state: %w", err)
+	}
+
+	return id, &state, nil
+}
+
+// inspectContainerState returns the full container ID and current state
+func inspectContainerState(dockerClient DockerClient, name string) (string, *ContainerState, error) {
+	output, err := dockerClient.Run("inspect", "--type", "container", "--format", "{{.Id}} {{json .State}}", name)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to inspect container %s: %w", name, err)
+	}
+	return parseContainerState(output)
+}
+
+// ensureContainerHealthy verifies the container's actual state and repairs it when
+// it diverges from what a reconnect expects: paused containers are unpaused,
+// restarting containers are waited on, and stopped ones are started again.
+// Returns the full container ID and whether the container was (re)started.
+func ensureContainerHealthy(dockerClient DockerClient, name string, verbose bool) (string, bool, error) {
+	// Without docker-compatible inspect (Apple Container), trust ps
+	if !runtimeSupports(dockerClient).Inspect {
+		id, err := getContainerID(dockerClient, name)
+		return id, false, err
+	}
+
+	id, state, err := inspectContainerState(dockerClient, name)
+	if err != nil {
+		return "", false, err
+	}
+
+	if state.Paused {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Container %s is paused, unpausing...\n", name)
+		}
+		if output, err := dockerClient.Run("unpause", id); err != nil {
+			return "", false, fmt.Errorf("failed to unpause container: %w\nDocker output:\n%s", err, output)
+		}
+		return id, false, nil
+	}
+
+	started := false
+	if !state.Running || state.Dead {
+		fmt.Fprintf(os.Stderr, "Container %s is not running (status: %s, exit code %d), restarting...\n", name, state.Status, state.ExitCode)
+		if err := runtimeBackend(dockerClient).Start(dockerClient, id); err != nil {
+			return "", false, fmt.Errorf("failed to restart container: %w", err)
+		}
+		started = true
+	}
+
+	// Give the keep-alive process a moment to settle (or to crash again)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, state, err = inspectContainerState(dockerClient, id)
+		if err != nil {
+			return "", started, err
+		}
+		if state.Healthy() {
+			return id, started, nil
+		}
+		if !state.Restarting && !state.Running {
+			return "", started, fmt.Errorf("container keep-alive process exited (status: %s, exit code %d)", state.Status, state.ExitCode)
+		}
+		if time.Now().After(deadline) {
+			return "", started, fmt.Errorf("container %s did not become healthy (status: %s)", name, state.Status)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// PruneStaleMetadata removes the lifecycle metadata of the runtime's
+// containers that no longer exist, returning their IDs. Metadata recorded by
+// another runtime, or by none, is left alone: its containers aren't listed.
+func PruneStaleMetadata(dockerClient DockerClient) ([]string, error) {
+	if !runtimeSupports(dockerClient).PSFlags {
+		return nil, nil
+	}
+
+	output, err := dockerClient.Run("ps", "-aq", "--no-trunc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, id := range strings.Fields(output) {
+		existing[id] = true
+	}
+
+	metadataDir, err := getMetadataDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(metadataDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		if !isStaleMetadataID(id, existing) {
+			continue
+		}
+		metadata, err := LoadMetadata(id)
+		if err != nil || metadata.Runtime != dockerClient.Command() {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return pruned, fmt.Errorf("failed to remove metadata of %s: %w", id, err)
+		}
+		pruned = append(pruned, id)
+	}
+	return pruned, nil
+}
+
+// isStaleMetadataID reports whether a metadata file's container ID (full or short) is gone
+func isStaleMetadataID(id string, existing map[string]bool) bool {
+	if existing[id] {
+		return false
+	}
+	for fullID := range existing {
+		if strings.HasPrefix(fullID, id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestParseContainerState(t *testing.T) {
+	output := `abc123def456 {"Status":"exited","Running":false,"Paused":false,"Restarting":false,"Dead":false,"ExitCode":137,"StartedAt":"2024-01-01T00:00:00Z"}` + "\n"
+
+	id, state, err := parseContainerState(output)
+	if err != nil {
+		t.Fatalf("parseContainerState() error = %v", err)
+	}
+	if id != "abc123def456" {
+		t.Errorf("id = %q, want abc123def456", id)
+	}
+	if state.Status != "exited" || state.ExitCode != 137 {
+		t.Errorf("state = %+v, want exited with code 137", state)
+	}
+	if state.Healthy() {
+		t.Error("exited container should not be healthy")
+	}
+
+	if _, _, err := parseContainerState("garbage"); err == nil {
+		t.Error("parseContainerState() should fail on malformed output")
+	}
+}
+
+func TestContainerState_Healthy(t *testing.T) {
+	tests := []struct {
+		name  string
+		state ContainerState
+		want  bool
+	}{
+		{"running", ContainerState{Running: true}, true},
+		{"paused", ContainerState{Running: true, Paused: true}, false},
+		{"restarting", ContainerState{Running: true, Restarting: true}, false},
+		{"stopped", ContainerState{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.state.Healthy(); got != tt.want {
+				t.Errorf("Healthy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsStaleMetadataID(t *testing.T) {
+	existing := map[string]bool{
+		"abc123def4567890": true,
+	}
+
+	if isStaleMetadataID("abc123def4567890", existing) {
+		t.Error("full ID of existing container reported stale")
+	}
+	if isStaleMetadataID("abc123def456", existing) {
+		t.Error("short ID of existing container reported stale")
+	}
+	if !isStaleMetadataID("fff999", existing) {
+		t.Error("ID of removed container not reported stale")
+	}
+}
+
+func TestPruneStaleMetadataKeepsOtherRuntimes(t *testing.T) {
+	fake := dockertest.New()
+	useFakeRuntime(t, fake)
+	fake.On(func(args []string) (string, error) { return "running1\n", nil }, "ps", "-aq")
+
+	for id, runtime := range map[string]string{
+		"running1":   "docker",
+		"removed1":   "docker",
+		"podman1":    "podman",
+		"unrecorded": "",
+	} {
+		if err := SaveMetadata(&ContainerMetadata{ContainerID: id, Runtime: runtime}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := PruneStaleMetadata(fake)
+	if err != nil {
+		t.Fatalf("PruneStaleMetadata() error = %v", err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"removed1"}) {
+		t.Errorf("PruneStaleMetadata() = %v, want [removed1]", pruned)
+	}
+	for _, id := range []string{"running1", "podman1", "unrecorded"} {
+		path, _ := GetMetadataPath(id)
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("metadata of %s removed: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/hooks"
+)
+
+// HooksLabel carries the container's host hooks so `packnplay stop` and
+// `packnplay attach` can run them without the config they were created from
+const HooksLabel = "packnplay-hooks"
+
+// hooksSpec is the JSON stored in HooksLabel
+type hooksSpec struct {
+	Hooks    hooks.Hooks `json:"hooks"`
+	HostPath string      `json:"host_path,omitempty"`
+}
+
+// containerHooks returns the user's hooks followed by the project's
+// customizations.packnplay.hooks. Project hooks run on the host but come from
+// the repository, so they are left out, with a warning, unless the user trusted
+// them for projectDir; --trust-hooks records that trust.
+func containerHooks(config *RunConfig, devConfig *devcontainer.Config, projectDir string) (hooks.Hooks, error) {
+	if err := config.Hooks.Validate(); err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "invalid hooks in config: %w", err)
+	}
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "%w", err)
+	}
+	if len(custom.Hooks) == 0 {
+		return hooks.Merge(config.Hooks), nil
+	}
+
+	switch {
+	case config.TrustHooks && !config.DryRun:
+		if err := hooks.Trust(projectDir, custom.Hooks); err != nil {
+			return nil, err
+		}
+	case config.TrustHooks, hooks.Trusted(projectDir, custom.Hooks):
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: skipping the project's hooks (customizations.packnplay.hooks), which would run on the host:\n")
+		for _, name := range hooks.Names {
+			for _, command := range custom.Hooks[name] {
+				fmt.Fprintf(os.Stderr, "  %s: %s\n", name, command)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Review them and run with --trust-hooks to trust them for this project until they change\n")
+		return hooks.Merge(config.Hooks), nil
+	}
+	return hooks.Merge(config.Hooks, custom.Hooks), nil
+}
+
+// hooksLabelValue encodes hooks for HooksLabel, returning "" when there are none
+func hooksLabelValue(h hooks.Hooks, hostPath string) (string, error) {
+	if len(h) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(hooksSpec{Hooks: h, HostPath: hostPath})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode hooks: %w", err)
+	}
+	return string(data), nil
+}
+
+// LoadContainerHooks returns the hooks recorded on a container and the payload
+// describing it. Load them before removing the container to run post-stop hooks.
+func LoadContainerHooks(dockerClient DockerClient, containerName string) (hooks.Hooks, hooks.Payload, error) {
+	payload := hooks.Payload{Container: containerName, Runtime: dockerClient.Command()}
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil, payload, nil
+	}
+
+	output, err := dockerClient.Run("inspect", "--format", "{{.Id}}|{{.Config.Image}}|{{json .Config.Labels}}", containerName)
+	if err != nil {
+		return nil, payload, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	parts := strings.SplitN(strings.TrimSpace(output), "|", 3)
+	if len(parts) != 3 {
+		return nil, payload, fmt.Errorf("unexpected inspect output for %s: %q", containerName, output)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(parts[2]), &labels); err != nil {
+		return nil, payload, fmt.Errorf("failed to parse labels of %s: %w", containerName, err)
+	}
+
+	payload.ContainerID = parts[0]
+	payload.Image = parts[1]
+	payload.Project = container.GetProjectFromLabels(labels)
+	payload.Worktree = container.GetWorktreeFromLabels(labels)
+
+	value := labels[HooksLabel]
+	if value == "" {
+		return nil, payload, nil
+	}
+	var spec hooksSpec
+	if err := json.Unmarshal([]byte(value), &spec); err != nil {
+		return nil, payload, fmt.Errorf("invalid %s label: %w", HooksLabel, err)
+	}
+	payload.HostPath = spec.HostPath
+	return spec.Hooks, payload, nil
+}
+
+// RunContainerHook runs a hook recorded on an existing container
+func RunContainerHook(dockerClient DockerClient, containerName, hook string, verbose bool) error {
+	h, payload, err := LoadContainerHooks(dockerClient, containerName)
+	if err != nil {
+		return err
+	}
+	return h.Run(hook, payload, verbose)
+}
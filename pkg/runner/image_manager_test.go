@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
 )
 
 func TestImageManager_EnsureAvailable_WithImage(t *testing.T) {
@@ -84,6 +89,67 @@ func TestImageManager_EnsureAvailable_PullError(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error when pull fails")
 	}
+	if got := errdefs.CategoryOf(err); got != errdefs.CategoryImagePull {
+		t.Errorf("CategoryOf() = %s, want %s", got, errdefs.CategoryImagePull)
+	}
+}
+
+type fakeRegistryAuth struct {
+	refreshed  []string
+	refreshErr error
+}
+
+func (f *fakeRegistryAuth) Refresh(ref string) error {
+	f.refreshed = append(f.refreshed, ref)
+	return f.refreshErr
+}
+
+func (f *fakeRegistryAuth) LoginHint(ref string) string {
+	return "login-for " + ref
+}
+
+func TestImageManager_EnsureAvailable_RefreshesRegistryLogin(t *testing.T) {
+	auth := &fakeRegistryAuth{refreshErr: fmt.Errorf("aws CLI not found")}
+	mockClient := &mockDockerClient{}
+	im := NewImageManager(mockClient, false)
+	im.SetRegistryAuth(auth)
+
+	image := "123456789012.dkr.ecr.us-east-1.amazonaws.com/app:latest"
+	if err := im.EnsureAvailable(&devcontainer.Config{Image: image}, "/test/project"); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v, refresh failures should only warn", err)
+	}
+	if len(auth.refreshed) != 1 || auth.refreshed[0] != image {
+		t.Errorf("refreshed = %v, want [%s]", auth.refreshed, image)
+	}
+	if !mockClient.pullCalled {
+		t.Error("Expected pull after login refresh")
+	}
+}
+
+func TestImageManager_EnsureAvailable_AuthErrorHint(t *testing.T) {
+	image := "myregistry.azurecr.io/app:1"
+	mockClient := &mockDockerClient{
+		pullError: fmt.Errorf("%w: exit status 1", docker.ErrRegistryAuth),
+	}
+	im := NewImageManager(mockClient, false)
+	im.SetRegistryAuth(&fakeRegistryAuth{})
+
+	err := im.EnsureAvailable(&devcontainer.Config{Image: image}, "/test/project")
+	if err == nil {
+		t.Fatal("Expected error when pull is unauthorized")
+	}
+	if !strings.Contains(err.Error(), "login-for "+image) {
+		t.Errorf("error = %q, want login hint", err)
+	}
+	if got := errdefs.CategoryOf(err); got != errdefs.CategoryImagePull {
+		t.Errorf("CategoryOf() = %s, want %s", got, errdefs.CategoryImagePull)
+	}
+
+	// Other failures don't get a hint
+	mockClient.pullError = fmt.Errorf("network error")
+	if err := im.EnsureAvailable(&devcontainer.Config{Image: image}, "/test/project"); strings.Contains(err.Error(), "login-for") {
+		t.Errorf("error = %q, should not contain a login hint", err)
+	}
 }
 
 func TestImageManager_EnsureAvailable_BuildError(t *testing.T) {
@@ -161,6 +227,8 @@ type mockDockerClient struct {
 	execCalls    [][]string // Track exec calls for lifecycle testing
 	execOutput   string     // Output to return for exec
 	execError    error      // Error to return for exec
+	inspectOut   string     // Output to return for container inspect
+	mu           sync.Mutex // lifecycle tasks call Run concurrently
 }
 
 func (m *mockDockerClient) RunWithProgress(imageName string, args ...string) error {
@@ -181,6 +249,8 @@ func (m *mockDockerClient) RunWithProgress(imageName string, args ...string) err
 }
 
 func (m *mockDockerClient) Run(args ...string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if len(args) > 0 {
 		m.calls = append(m.calls, args[0])
 
@@ -193,6 +263,10 @@ func (m *mockDockerClient) Run(args ...string) (string, error) {
 			return m.execOutput, nil
 		}
 
+		if args[0] == "inspect" {
+			return m.inspectOut, nil
+		}
+
 		// For image inspect, return the configured error (default: image not found)
 		if args[0] == "image" && len(args) > 1 && args[1] == "inspect" {
 			// If imageExists is true, return success (no error)
@@ -358,3 +432,151 @@ echo "Installing test feature"
 		t.Error("Expected image build to be called when features are present")
 	}
 }
+
+// recordingVerifier records verified references, rejects those in reject and
+// pins those in pinned
+type recordingVerifier struct {
+	verified     []string
+	unverifiable []string
+	reject       map[string]bool
+	pinned       map[string]string
+}
+
+func (v *recordingVerifier) CheckUnverifiable(ref string) error {
+	v.unverifiable = append(v.unverifiable, ref)
+	if v.reject[ref] {
+		return fmt.Errorf("%s can't be signature verified", ref)
+	}
+	return nil
+}
+
+func (v *recordingVerifier) Verify(ref string) (string, error) {
+	v.verified = append(v.verified, ref)
+	if v.reject[ref] {
+		return "", fmt.Errorf("signature verification failed for %s", ref)
+	}
+	return v.pinned[ref], nil
+}
+
+func TestImageManager_VerifiesBeforePull(t *testing.T) {
+	mockClient := &mockDockerClient{}
+	verifier := &recordingVerifier{reject: map[string]bool{"evil/image:latest": true}}
+
+	im := NewImageManager(mockClient, false)
+	im.SetVerifier(verifier)
+
+	err := im.EnsureAvailable(&devcontainer.Config{Image: "evil/image:latest"}, "/test/project")
+	if err == nil {
+		t.Fatal("Expected verification failure to block the pull")
+	}
+	if mockClient.pullCalled {
+		t.Error("Image was pulled despite failed verification")
+	}
+}
+
+func TestImageManager_PullsVerifiedDigest(t *testing.T) {
+	fake := dockertest.New()
+	// The tag was cached before it moved to an image the signature doesn't cover
+	fake.AddImage(dockertest.Image{Name: "ghcr.io/org/app:1"})
+	im := NewImageManager(fake, false)
+	im.SetVerifier(&recordingVerifier{pinned: map[string]string{"ghcr.io/org/app:1": "ghcr.io/org/app@sha256:abc"}})
+
+	for i := 0; i < 2; i++ {
+		if err := im.EnsureAvailable(&devcontainer.Config{Image: "ghcr.io/org/app:1"}, t.TempDir()); err != nil {
+			t.Fatalf("EnsureAvailable() error = %v", err)
+		}
+	}
+
+	// Pulled by digest once, then found locally by digest; tagged both times
+	if got := fake.CallsTo("pull"); len(got) != 1 || strings.Join(got[0], " ") != "pull ghcr.io/org/app@sha256:abc" {
+		t.Errorf("pulls = %v, want one pull of ghcr.io/org/app@sha256:abc", got)
+	}
+	for _, call := range fake.CallsTo("tag") {
+		if got := strings.Join(call, " "); got != "tag ghcr.io/org/app@sha256:abc ghcr.io/org/app:1" {
+			t.Errorf("tag call = %q, want the verified digest tagged as ghcr.io/org/app:1", got)
+		}
+	}
+	if len(fake.CallsTo("tag")) != 2 {
+		t.Errorf("tag calls = %v, want 2", fake.CallsTo("tag"))
+	}
+}
+
+func TestImageManager_VerifyReferences(t *testing.T) {
+	projectDir := t.TempDir()
+	devcontainerDir := filepath.Join(projectDir, ".devcontainer")
+	if err := os.MkdirAll(devcontainerDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dockerfile := `ARG VARIANT=3.12
+FROM --platform=linux/amd64 golang:1.23 AS builder
+FROM python:${VARIANT}
+FROM builder AS final
+FROM scratch
+`
+	if err := os.WriteFile(filepath.Join(devcontainerDir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &recordingVerifier{}
+	im := NewImageManager(&mockDockerClient{}, false)
+	im.SetVerifier(verifier)
+
+	devConfig := &devcontainer.Config{
+		DockerFile: "Dockerfile",
+		Features: map[string]interface{}{
+			"ghcr.io/devcontainers/features/node:1": map[string]interface{}{},
+			"./local-feature":                       map[string]interface{}{},
+			"https://example.com/feature.tgz":       map[string]interface{}{},
+		},
+	}
+	if err := im.verifyReferences(devConfig, projectDir); err != nil {
+		t.Fatalf("verifyReferences() error = %v", err)
+	}
+
+	want := []string{"ghcr.io/devcontainers/features/node:1", "golang:1.23"}
+	if fmt.Sprint(verifier.verified) != fmt.Sprint(want) {
+		t.Errorf("verified = %v, want %v", verifier.verified, want)
+	}
+	wantUnverifiable := []string{"./local-feature", "https://example.com/feature.tgz"}
+	if fmt.Sprint(verifier.unverifiable) != fmt.Sprint(wantUnverifiable) {
+		t.Errorf("checked unverifiable = %v, want %v", verifier.unverifiable, wantUnverifiable)
+	}
+
+	// A policy blocking an unverifiable feature stops the run
+	verifier.reject = map[string]bool{"https://example.com/feature.tgz": true}
+	if err := im.verifyReferences(devConfig, projectDir); err == nil {
+		t.Error("verifyReferences() with a blocked tarball feature succeeded, want error")
+	}
+}
+
+// TestImageManager_Refresh tests that refresh pulls and rebuilds images that already exist
+func TestImageManager_Refresh(t *testing.T) {
+	mockClient := &mockDockerClient{imageExists: true}
+	im := NewImageManager(mockClient, false)
+
+	if err := im.EnsureAvailable(&devcontainer.Config{Image: "ubuntu:22.04"}, t.TempDir()); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	if mockClient.pullCalled {
+		t.Fatal("existing image should not be pulled without refresh")
+	}
+
+	im.SetRefresh(true, false)
+	if err := im.EnsureAvailable(&devcontainer.Config{Image: "ubuntu:22.04"}, t.TempDir()); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	if !mockClient.pullCalled {
+		t.Error("refresh should pull an image that already exists")
+	}
+
+	got := strings.Join(im.buildCommand([]string{"build", "-t", "img", "."}), " ")
+	if got != "build --pull -t img ." {
+		t.Errorf("buildCommand() = %q, want base images pulled", got)
+	}
+
+	im.SetRefresh(true, true)
+	got = strings.Join(im.buildCommand([]string{"build", "-t", "img", "."}), " ")
+	if got != "build --pull --no-cache -t img ." {
+		t.Errorf("buildCommand() = %q, want the layer cache skipped", got)
+	}
+}
@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+)
+
+// DefaultImagePruneAfter is how long a project image can go unused before
+// prune removes it, when images.prune_after_days isn't set
+const DefaultImagePruneAfter = 30 * 24 * time.Hour
+
+// ProjectImage is an image packnplay built for a project (from a Dockerfile or
+// with features), with every tag it has
+type ProjectImage struct {
+	ID         string    `json:"id"`
+	Tags       []string  `json:"tags"`
+	Project    string    `json:"project,omitempty"`
+	HostPath   string    `json:"host_path,omitempty"`
+	ConfigHash string    `json:"config_hash,omitempty"`
+	Size       int64     `json:"size"`
+	Created    time.Time `json:"created"`
+	LastUsed   time.Time `json:"last_used,omitempty"` // zero when no run has recorded using it
+	InUse      bool      `json:"in_use"`              // a container (running or stopped) uses it
+}
+
+// lastActive is when the image was last used, or built if no run recorded using it
+func (img ProjectImage) lastActive() time.Time {
+	if img.LastUsed.After(img.Created) {
+		return img.LastUsed
+	}
+	return img.Created
+}
+
+// ImagePrunePolicy decides which unused project images prune removes
+type ImagePrunePolicy struct {
+	MaxAge       time.Duration // remove images unused for longer; 0 keeps them regardless of age
+	MaxTotalSize int64         // then remove the least recently used until the rest fit; 0 is no limit
+}
+
+// NewImagePrunePolicy returns the prune policy of the images settings
+func NewImagePrunePolicy(settings config.ImagesConfig) ImagePrunePolicy {
+	policy := ImagePrunePolicy{MaxAge: DefaultImagePruneAfter, MaxTotalSize: int64(settings.MaxTotalMB) << 20}
+	if settings.PruneAfterDays < 0 {
+		policy.MaxAge = 0
+	} else if settings.PruneAfterDays > 0 {
+		policy.MaxAge = time.Duration(settings.PruneAfterDays) * 24 * time.Hour
+	}
+	return policy
+}
+
+// imageBuildArgs labels an image built for a project with what it was built
+// from, and tags it with its config hash too, so the image a rebuild replaces
+// stays listed by `packnplay images` instead of turning into an anonymous
+// dangling image
+func imageBuildArgs(devConfig *devcontainer.Config, projectPath string) []string {
+	hash := configHash(devConfig)
+	labels := container.ImageLabels(projectPath, hash)
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		args = append(args, "--label", name+"="+labels[name])
+	}
+	if hash != "" {
+		args = append(args, "-t", container.GenerateConfigImageName(projectPath, hash))
+	}
+	return args
+}
+
+// ListProjectImages returns the images packnplay built for projects, most
+// recently used first
+func ListProjectImages(dockerClient DockerClient) ([]ProjectImage, error) {
+	backend := runtimeBackend(dockerClient)
+	if caps := backend.Capabilities(); !caps.Inspect || !caps.PSFlags {
+		return nil, fmt.Errorf("listing project images: %w (%s)", docker.ErrUnsupported, backend.Name())
+	}
+
+	output, err := dockerClient.Run("image", "ls", "--filter", "reference="+container.ProjectImageReference, "--format", "{{.Repository}}:{{.Tag}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	var tags []string
+	for _, line := range strings.Split(output, "\n") {
+		// Images without a tag (<none>) can't be inspected by name
+		if tag := strings.TrimSpace(line); tag != "" && !strings.HasSuffix(tag, ":<none>") {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	inspectArgs := append([]string{"image", "inspect", "--format", "{{.Id}}|{{.Size}}|{{.Created}}|{{json .Config.Labels}}"}, tags...)
+	output, err = dockerClient.Run(inspectArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect images: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != len(tags) {
+		return nil, fmt.Errorf("failed to inspect images: got %d results for %d images", len(lines), len(tags))
+	}
+
+	inUse, err := containerImages(dockerClient)
+	if err != nil {
+		return nil, err
+	}
+	lastUsed := container.LoadLastUsed(container.ImagesLastUsedPath())
+
+	byID := make(map[string]*ProjectImage)
+	var images []*ProjectImage
+	for i, line := range lines {
+		fields := strings.SplitN(line, "|", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected image inspect output %q", line)
+		}
+		img := byID[fields[0]]
+		if img == nil {
+			img = &ProjectImage{ID: fields[0]}
+			img.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+			img.Created, _ = time.Parse(time.RFC3339Nano, fields[2])
+			var labels map[string]string
+			_ = json.Unmarshal([]byte(fields[3]), &labels)
+			img.Project, img.HostPath, img.ConfigHash = labels[container.LabelProject], labels[container.LabelHostPath], labels[container.LabelConfigHash]
+			byID[img.ID] = img
+			images = append(images, img)
+		}
+		tag := tags[i]
+		img.Tags = append(img.Tags, tag)
+		if used := lastUsed[tag]; used.After(img.LastUsed) {
+			img.LastUsed = used
+		}
+		if inUse[tag] || inUse[img.ID] || inUse[strings.TrimPrefix(img.ID, "sha256:")] {
+			img.InUse = true
+		}
+	}
+
+	result := make([]ProjectImage, 0, len(images))
+	for _, img := range images {
+		// Images of a project predating labels are named after it
+		if img.Project == "" {
+			img.Project = projectFromImageName(img.Tags[0])
+		}
+		result = append(result, *img)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].lastActive().After(result[j].lastActive())
+	})
+	return result, nil
+}
+
+// containerImages returns the images of every container, as ps reports them
+// (the name the container was created from, or an ID once that name moved to
+// a newer image)
+func containerImages(dockerClient DockerClient) (map[string]bool, error) {
+	output, err := dockerClient.Run("ps", "-a", "--no-trunc", "--format", "{{.Image}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	images := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if image := strings.TrimSpace(line); image != "" {
+			images[image] = true
+			images[strings.TrimPrefix(image, "sha256:")] = true
+			if !strings.Contains(image, ":") {
+				images[image+":latest"] = true
+			}
+		}
+	}
+	return images, nil
+}
+
+// projectFromImageName returns the project part of a GenerateImageName name
+func projectFromImageName(name string) string {
+	repository, _, _ := strings.Cut(name, ":")
+	return strings.TrimSuffix(strings.TrimPrefix(repository, "packnplay-"), "-devcontainer")
+}
+
+// SelectImagesToPrune returns the images policy removes: those unused for
+// longer than MaxAge, then the least recently used of the rest until they fit
+// in MaxTotalSize. Images a container uses are never removed.
+func SelectImagesToPrune(images []ProjectImage, policy ImagePrunePolicy, now time.Time) []ProjectImage {
+	candidates := make([]ProjectImage, 0, len(images))
+	var kept int64
+	for _, img := range images {
+		if img.InUse {
+			kept += img.Size
+			continue
+		}
+		candidates = append(candidates, img)
+	}
+	// Least recently used first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].lastActive().Before(candidates[j].lastActive())
+	})
+
+	var selected []ProjectImage
+	var remaining []ProjectImage
+	for _, img := range candidates {
+		if policy.MaxAge > 0 && now.Sub(img.lastActive()) > policy.MaxAge {
+			selected = append(selected, img)
+			continue
+		}
+		remaining = append(remaining, img)
+		kept += img.Size
+	}
+	for _, img := range remaining {
+		if policy.MaxTotalSize <= 0 || kept <= policy.MaxTotalSize {
+			break
+		}
+		selected = append(selected, img)
+		kept -= img.Size
+	}
+	return selected
+}
+
+// PruneProjectImages removes the project images policy selects and returns
+// them. A dry run only selects them.
+func PruneProjectImages(dockerClient DockerClient, policy ImagePrunePolicy, dryRun bool) ([]ProjectImage, error) {
+	images, err := ListProjectImages(dockerClient)
+	if err != nil {
+		return nil, err
+	}
+	selected := SelectImagesToPrune(images, policy, time.Now())
+	if dryRun {
+		return selected, nil
+	}
+
+	var pruned []ProjectImage
+	for _, img := range selected {
+		// Removing by tag untags the image, and deletes it with its last tag
+		args := append([]string{"image", "rm"}, img.Tags...)
+		if output, err := dockerClient.Run(args...); err != nil {
+			return pruned, fmt.Errorf("failed to remove image %s: %w\n%s", img.Tags[0], err, output)
+		}
+		container.ForgetLastUsed(container.ImagesLastUsedPath(), img.Tags...)
+		pruned = append(pruned, img)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestSelectImagesToPrune(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	images := []ProjectImage{
+		{Tags: []string{"recent"}, Size: 300, Created: now.Add(-40 * day), LastUsed: now.Add(-day)},
+		{Tags: []string{"stale"}, Size: 100, Created: now.Add(-40 * day)},
+		{Tags: []string{"stale-in-use"}, Size: 100, Created: now.Add(-90 * day), InUse: true},
+		{Tags: []string{"older"}, Size: 200, Created: now.Add(-10 * day)},
+	}
+
+	tests := []struct {
+		name   string
+		policy ImagePrunePolicy
+		want   []string
+	}{
+		{"age", ImagePrunePolicy{MaxAge: 30 * day}, []string{"stale"}},
+		{"no limits", ImagePrunePolicy{}, nil},
+		{"size after age", ImagePrunePolicy{MaxAge: 30 * day, MaxTotalSize: 450}, []string{"stale", "older"}},
+		{"size only", ImagePrunePolicy{MaxTotalSize: 400}, []string{"stale", "older"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, img := range SelectImagesToPrune(images, tt.policy, now) {
+				got = append(got, img.Tags[0])
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("SelectImagesToPrune() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewImagePrunePolicy(t *testing.T) {
+	if got := NewImagePrunePolicy(config.ImagesConfig{}); got.MaxAge != DefaultImagePruneAfter || got.MaxTotalSize != 0 {
+		t.Errorf("default policy = %+v", got)
+	}
+	if got := NewImagePrunePolicy(config.ImagesConfig{PruneAfterDays: -1, MaxTotalMB: 2}); got.MaxAge != 0 || got.MaxTotalSize != 2<<20 {
+		t.Errorf("policy = %+v, want no age limit and 2MB", got)
+	}
+}
+
+func TestProjectImageLifecycle(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	fake := dockertest.New()
+	project := newProject(t, `{"build": {"dockerfile": "Dockerfile"}}`)
+	devConfig, err := devcontainer.LoadConfig(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewImageManager(fake, false).EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	imageName := container.GenerateImageName(project)
+	configTag := container.GenerateConfigImageName(project, configHash(devConfig))
+	if fake.Image(configTag) == nil {
+		t.Fatalf("build = %v, want the image also tagged %s", fake.CallsTo("build"), configTag)
+	}
+
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	fake.AddImage(dockertest.Image{Name: "packnplay-stale-devcontainer:latest", Created: old, Size: 1 << 20})
+	fake.AddImage(dockertest.Image{Name: "packnplay-busy-devcontainer:latest", Created: old})
+	fake.AddContainer(dockertest.Container{Name: "packnplay-busy-main", Image: "packnplay-busy-devcontainer:latest"})
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20", Created: old})
+
+	images, err := ListProjectImages(fake)
+	if err != nil {
+		t.Fatalf("ListProjectImages() error = %v", err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("ListProjectImages() = %+v, want the built, stale and busy images", images)
+	}
+	built := images[0]
+	if len(built.Tags) != 2 || built.HostPath != project || built.ConfigHash != configHash(devConfig) {
+		t.Errorf("built image = %+v, want both tags and its labels", built)
+	}
+
+	pruned, err := PruneProjectImages(fake, ImagePrunePolicy{MaxAge: DefaultImagePruneAfter}, false)
+	if err != nil {
+		t.Fatalf("PruneProjectImages() error = %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].Project != "stale" {
+		t.Errorf("PruneProjectImages() = %+v, want only the unused stale image", pruned)
+	}
+	if fake.Image("packnplay-stale-devcontainer:latest") != nil || fake.Image("packnplay-busy-devcontainer:latest") == nil || fake.Image(imageName) == nil {
+		t.Errorf("images after prune: stale should be removed, busy and built kept; calls %v", fake.CallsTo("image"))
+	}
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// inlineFeatureShell starts an install script that has no #! line of its own
+const inlineFeatureShell = "#!/bin/sh\nset -e\n"
+
+// userCacheDir is the host's cache directory: $XDG_CACHE_HOME, else ~/.cache
+func userCacheDir() (string, error) {
+	if cacheDir := os.Getenv("XDG_CACHE_HOME"); cacheDir != "" {
+		return cacheDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".cache"), nil
+}
+
+// materializeInlineFeatures writes each of customizations.packnplay.inlineFeatures
+// out as a feature directory and adds it to devConfig's features, so it is
+// built like any other local feature. The directories are named after their
+// content, so changing a script makes a new one and the image is rebuilt.
+func materializeInlineFeatures(devConfig *devcontainer.Config) error {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+	if len(custom.InlineFeatures) == 0 {
+		return nil
+	}
+	cacheDir, err := userCacheDir()
+	if err != nil {
+		return err
+	}
+	root := filepath.Join(cacheDir, "packnplay", "inline-features")
+
+	names := make([]string, 0, len(custom.InlineFeatures))
+	for name := range custom.InlineFeatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if devConfig.Features == nil {
+		devConfig.Features = map[string]interface{}{}
+	}
+	for _, name := range names {
+		dir, err := writeInlineFeature(root, name, custom.InlineFeatures[name])
+		if err != nil {
+			return fmt.Errorf("failed to write inline feature %s: %w", name, err)
+		}
+		devConfig.Features[dir] = map[string]interface{}{}
+	}
+	return nil
+}
+
+// writeInlineFeature writes an inline feature's devcontainer-feature.json and
+// install.sh into a directory under root, unless an earlier run did, and
+// returns the directory
+func writeInlineFeature(root, name string, feature devcontainer.InlineFeature) (string, error) {
+	metadata, err := json.MarshalIndent(devcontainer.FeatureMetadata{
+		ID:           name,
+		Version:      "1.0.0",
+		Name:         name,
+		ContainerEnv: feature.ContainerEnv,
+		CapAdd:       feature.CapAdd,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	script := feature.InstallScript
+	if !strings.HasPrefix(script, "#!") {
+		script = inlineFeatureShell + script
+	}
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
+	}
+
+	sum := sha256.Sum256(append(append(metadata, 0), script...))
+	dir := filepath.Join(root, name+"-"+hex.EncodeToString(sum[:])[:12])
+	if fileExists(dir) {
+		return dir, nil
+	}
+
+	// Written next to its final name and renamed, so a concurrent run never
+	// sees a partial feature
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(root, ".tmp-"+name+"-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.WriteFile(filepath.Join(tmp, "devcontainer-feature.json"), metadata, 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "install.sh"), []byte(script), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, dir); err != nil && !fileExists(dir) {
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func inlineFeatureConfig(t *testing.T, script string) *devcontainer.Config {
+	t.Helper()
+	var devConfig devcontainer.Config
+	data := `{"image": "alpine:3.20", "customizations": {"packnplay": {"inlineFeatures": {"tools": {"installScript": ` + script + `, "capAdd": ["SYS_PTRACE"]}}}}}`
+	if err := json.Unmarshal([]byte(data), &devConfig); err != nil {
+		t.Fatal(err)
+	}
+	return &devConfig
+}
+
+func TestMaterializeInlineFeatures(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	devConfig := inlineFeatureConfig(t, `"apk add jq"`)
+	if err := materializeInlineFeatures(devConfig); err != nil {
+		t.Fatalf("materializeInlineFeatures() error = %v", err)
+	}
+	if len(devConfig.Features) != 1 {
+		t.Fatalf("Features = %v, want the inline feature", devConfig.Features)
+	}
+	var dir string
+	for dir = range devConfig.Features {
+	}
+	if !filepath.IsAbs(dir) || !strings.HasPrefix(filepath.Base(dir), "tools-") {
+		t.Errorf("feature reference = %s, want a directory named after the feature", dir)
+	}
+
+	script, err := os.ReadFile(filepath.Join(dir, "install.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(script) != inlineFeatureShell+"apk add jq\n" {
+		t.Errorf("install.sh = %q, want the script run by sh", script)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "install.sh")); err != nil || info.Mode()&0100 == 0 {
+		t.Errorf("install.sh should be executable: %v", info)
+	}
+	feature, err := devcontainer.NewFeatureResolver(t.TempDir(), nil).ResolveFeature(dir, nil)
+	if err != nil {
+		t.Fatalf("ResolveFeature() error = %v", err)
+	}
+	if feature.ID != "tools" || len(feature.Metadata.CapAdd) != 1 || feature.Metadata.CapAdd[0] != "SYS_PTRACE" {
+		t.Errorf("feature = %+v, want id tools adding SYS_PTRACE", feature.Metadata)
+	}
+
+	// The same feature is written once; a changed one gets a new directory
+	again := inlineFeatureConfig(t, `"apk add jq"`)
+	if err := materializeInlineFeatures(again); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := again.Features[dir]; !ok {
+		t.Errorf("Features = %v, want %s reused", again.Features, dir)
+	}
+	changed := inlineFeatureConfig(t, `"#!/bin/bash\napk add jq curl"`)
+	if err := materializeInlineFeatures(changed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := changed.Features[dir]; ok {
+		t.Errorf("Features = %v, a changed script should get a new directory", changed.Features)
+	}
+}
+
+func TestRunDryRunInlineFeature(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "customizations": {"packnplay": {"inlineFeatures": {"tools": {"installScript": "apk add jq", "capAdd": ["SYS_PTRACE"]}}}}}`)
+
+	spec := dryRunSpec(t, &RunConfig{Path: project, NoWorktree: true})
+	if !strings.HasPrefix(spec.Image, "packnplay-") {
+		t.Errorf("spec.Image = %s, want a built image", spec.Image)
+	}
+	if !contains(spec.RunArgs, "--cap-add=SYS_PTRACE") {
+		t.Errorf("docker run args = %v, want the inline feature's capAdd", spec.RunArgs)
+	}
+}
@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/stats"
+)
+
+// interruptGuard catches SIGINT and SIGTERM while a run builds and sets up its
+// container, so that an interruption stops the run between steps instead of
+// killing packnplay halfway through one. Child processes on the terminal get
+// Ctrl-C too, so the step in progress usually ends at once; a second signal
+// exits immediately.
+type interruptGuard struct {
+	signals     chan os.Signal
+	stop        chan struct{}
+	stopOnce    sync.Once
+	interrupted atomic.Bool
+}
+
+// guardInterrupts starts catching SIGINT and SIGTERM
+func guardInterrupts() *interruptGuard {
+	g := &interruptGuard{signals: make(chan os.Signal, 2), stop: make(chan struct{})}
+	signal.Notify(g.signals, syscall.SIGINT, syscall.SIGTERM)
+	go g.watch()
+	return g
+}
+
+func (g *interruptGuard) watch() {
+	for {
+		select {
+		case <-g.signals:
+			if g.interrupted.Swap(true) {
+				fmt.Fprintf(os.Stderr, "Interrupted again, exiting\n")
+				exitProcess(errdefs.CategoryInterrupted.ExitCode())
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Interrupted; stopping after the current step (interrupt again to exit now)\n")
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// Interrupted reports whether a signal arrived; a nil guard never is
+func (g *interruptGuard) Interrupted() bool {
+	return g != nil && g.interrupted.Load()
+}
+
+// Stop restores the default signal handling, before handing over to the
+// user's command
+func (g *interruptGuard) Stop() {
+	if g == nil {
+		return
+	}
+	g.stopOnce.Do(func() {
+		signal.Stop(g.signals)
+		close(g.stop)
+	})
+}
+
+// interruptedError is returned by a run stopped by a signal
+func interruptedError(format string, args ...interface{}) error {
+	return errdefs.Errorf(errdefs.CategoryInterrupted, "interrupted "+format, args...)
+}
+
+// rollBackCreation removes a container whose creation was interrupted before
+// any lifecycle command ran, along with its sidecars. Images and build caches
+// are kept, so the next run picks up where this one stopped.
+func rollBackCreation(dockerClient DockerClient, spec *RunSpec) {
+	_, _ = dockerClient.Run("rm", "-f", spec.ContainerName)
+	RecordAudit(audit.Event{Type: audit.TypeRemove, Project: spec.Workspace.WorkDir, Container: spec.ContainerName})
+	if len(spec.Services) > 0 {
+		_ = RemoveSidecars(dockerClient, spec.ContainerName)
+	}
+}
+
+// resumeCreation runs the lifecycle commands an interrupted (or killed)
+// creation of the container didn't finish, followed by postStart. It reports
+// whether the container needed it; when it didn't, postStart is left to the
+// caller.
+func resumeCreation(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, imageName, containerName, containerID, workingDir string, recorder *stats.Recorder) (bool, error) {
+	metadata, err := LoadMetadata(containerID)
+	if err != nil || !metadata.Incomplete {
+		return false, nil
+	}
+	fmt.Fprintf(os.Stderr, "Resuming the interrupted setup of %s\n", containerName)
+
+	runHooks, err := containerHooks(config, devConfig, ws.WorkDir)
+	if err != nil {
+		return true, err
+	}
+	spec := &RunSpec{
+		Workspace:     *ws,
+		Runtime:       dockerClient.Command(),
+		ContainerName: containerName,
+		Image:         imageName,
+		WorkingDir:    workingDir,
+		devConfig:     devConfig,
+		lockfile:      lockfile,
+		hooks:         runHooks,
+	}
+	return true, RunLifecycle(dockerClient, config, spec, containerID, recorder)
+}
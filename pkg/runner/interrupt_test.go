@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+func TestInterruptGuard(t *testing.T) {
+	exited := make(chan int, 1)
+	origExit := exitProcess
+	t.Cleanup(func() { exitProcess = origExit })
+	exitProcess = func(code int) { exited <- code }
+
+	var none *interruptGuard
+	if none.Interrupted() {
+		t.Error("a nil guard should never be interrupted")
+	}
+	none.Stop()
+
+	g := guardInterrupts()
+	defer g.Stop()
+	g.signals <- syscall.SIGINT
+	deadline := time.Now().Add(5 * time.Second)
+	for !g.Interrupted() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !g.Interrupted() {
+		t.Fatal("Interrupted() = false after a signal")
+	}
+	select {
+	case code := <-exited:
+		t.Fatalf("exited with %d on the first signal", code)
+	default:
+	}
+
+	g.signals <- syscall.SIGTERM
+	select {
+	case code := <-exited:
+		if code != 130 {
+			t.Errorf("exit code = %d, want 130", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a second signal should exit")
+	}
+}
+
+func TestRunResumesInterruptedLifecycle(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "onCreateCommand": "echo one", "postCreateCommand": "echo two"}`)
+	name := container.GenerateContainerName(project, "no-worktree")
+
+	config := &RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}
+	fake.On(func(args []string) (string, error) {
+		if strings.Contains(strings.Join(args, " "), "echo one") {
+			config.interrupts.interrupted.Store(true)
+		}
+		return "", nil
+	}, "exec")
+
+	err := Run(config)
+	if errdefs.CategoryOf(err) != errdefs.CategoryInterrupted || !strings.Contains(err.Error(), "packnplay stop "+name) {
+		t.Fatalf("Run() error = %v, want an interrupted error naming the container", err)
+	}
+	if containsCall(fake.CallsTo("exec"), "echo two") {
+		t.Error("postCreateCommand should not run after an interrupt")
+	}
+	created := fake.Container(name)
+	if created == nil {
+		t.Fatal("an interrupted lifecycle should keep the container")
+	}
+	metadata, err := LoadMetadata(created.ID)
+	if err != nil || !metadata.Incomplete {
+		t.Fatalf("metadata = %+v (%v), want it marked incomplete", metadata, err)
+	}
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() with Reconnect error = %v", err)
+	}
+	if !containsCall(fake.CallsTo("exec"), "echo two") {
+		t.Errorf("postCreateCommand should run when resuming: %v", fake.CallsTo("exec"))
+	}
+	if metadata, err := LoadMetadata(created.ID); err != nil || metadata.Incomplete {
+		t.Errorf("metadata = %+v (%v), want it complete after resuming", metadata, err)
+	}
+}
+
+func TestRunRollsBackInterruptedCreation(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	config := &RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}
+	fake.On(func(args []string) (string, error) {
+		config.interrupts.interrupted.Store(true)
+		return "", nil
+	}, "exec")
+
+	err := Run(config)
+	if errdefs.CategoryOf(err) != errdefs.CategoryInterrupted {
+		t.Fatalf("Run() error = %v, want an interrupted error", err)
+	}
+	if len(fake.Containers()) != 0 {
+		t.Errorf("containers = %v, want the partial container removed", fake.Containers())
+	}
+	if fake.Image("alpine:3.20") == nil {
+		t.Error("the image should be kept")
+	}
+}
+
+func TestRunRollsBackCreationFailedByInterrupt(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	// The signal reaches docker run too, which fails after the daemon created the container
+	config := &RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}
+	fake.On(func(args []string) (string, error) {
+		fake.AddContainer(dockertest.Container{Name: argValue(args, "--name")})
+		config.interrupts.interrupted.Store(true)
+		return "context canceled", errors.New("exit status 130")
+	}, "run")
+
+	err := Run(config)
+	if errdefs.CategoryOf(err) != errdefs.CategoryInterrupted {
+		t.Fatalf("Run() error = %v, want an interrupted error", err)
+	}
+	if len(fake.Containers()) != 0 {
+		t.Errorf("containers = %v, want the partial container removed", fake.Containers())
+	}
+}
+
+func TestRunStopsOnInterruptWhileReconnecting(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postStartCommand": "echo started"}`)
+	name := container.GenerateContainerName(project, "no-worktree")
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"true"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// The container was restarted since, so postStartCommand runs again and is interrupted
+	fake.Container(name).StartedAt = time.Now().Add(time.Minute)
+	config := &RunConfig{Path: project, NoWorktree: true, Reconnect: true, Command: []string{"session-command"}}
+	fake.On(func(args []string) (string, error) {
+		if strings.Contains(strings.Join(args, " "), "echo started") {
+			config.interrupts.interrupted.Store(true)
+		}
+		return "", nil
+	}, "exec")
+
+	err := Run(config)
+	if errdefs.CategoryOf(err) != errdefs.CategoryInterrupted || !strings.Contains(err.Error(), name) {
+		t.Fatalf("Run() error = %v, want an interrupted error naming the container", err)
+	}
+	if containsCall(fake.CallsTo("exec"), "session-command") {
+		t.Error("the session should not start after an interrupt")
+	}
+	if fake.Container(name) == nil {
+		t.Error("a reconnect interrupt should keep the container")
+	}
+}
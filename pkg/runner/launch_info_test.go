@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
 )
 
 func TestRunConfigLaunchInfo(t *testing.T) {
@@ -66,3 +67,42 @@ func TestLaunchCommandReconstruction(t *testing.T) {
 		t.Errorf("launch command missing command args: %v", config.LaunchCommand)
 	}
 }
+
+func TestRunRecordsMetadataLabel(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	launchCommand := "packnplay run --no-worktree --env A=1,2 bash -c 'x, y'"
+	if err := Run(&RunConfig{
+		Path:          project,
+		NoWorktree:    true,
+		HostPath:      project,
+		LaunchCommand: launchCommand,
+		LaunchArgs:    []string{"run", "--no-worktree", "--env", "A=1,2", "bash", "-c", "x, y"},
+		Command:       []string{"bash", "-c", "x, y"},
+	}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	c := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if c == nil {
+		t.Fatal("container should be created")
+	}
+	metadata := container.ReadMetadata(c.Labels)
+	if metadata.Version != container.MetadataVersion || metadata.HostPath != project || metadata.LaunchCommand != launchCommand || metadata.ConfigHash == "" {
+		t.Errorf("metadata = %+v, want v2 metadata with the launch command intact", metadata)
+	}
+	if metadata.Launch == nil || metadata.Launch.Args[3] != "A=1,2" {
+		t.Errorf("metadata launch = %+v, want the launch args", metadata.Launch)
+	}
+	if c.Labels[container.LabelHostPath] != project {
+		t.Errorf("labels = %v, want the v1 host path label kept for filters", c.Labels)
+	}
+
+	details, err := getContainerDetails(fake, c.Name)
+	if err != nil || details.LaunchCommand != launchCommand {
+		t.Errorf("getContainerDetails() = %+v, %v; want the launch command read with inspect", details, err)
+	}
+}
@@ -1,23 +1,123 @@
 package runner
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/obra/packnplay/pkg/audit"
 	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+	"github.com/obra/packnplay/pkg/stats"
 )
 
 // LifecycleExecutor executes lifecycle commands in a container.
 // It supports three command formats:
-//   - String: Shell command executed via sh -c
+//   - String: Shell command executed via sh -c (or the configured shell)
 //   - Array: Direct command execution without shell
-//   - Object: Multiple commands executed in parallel
+//   - Object: Named tasks executed in parallel, with their output prefixed by
+//     the task name and their status recorded per task
 type LifecycleExecutor struct {
 	client        DockerClient
 	containerName string
 	containerUser string
 	verbose       bool
 	metadata      *ContainerMetadata
+	recorder      *stats.Recorder
+	events        *events.Emitter
+	env           []string // extra KEY=VALUE pairs passed to each exec
+	workingDir    string   // directory commands run in, normally the workspace folder
+	parallelism   int      // object-format tasks run at once, 0 for defaultLifecycleParallelism
+	failurePolicy string   // devcontainer.LifecycleFailFast or LifecycleContinueOnError (the default)
+	shell         []string // shell and flags string-format commands run with, nil for defaultLifecycleShell
+	auditProject  string   // project recorded in the audit log with each command
+	auditName     string   // container name recorded in the audit log, "" to record nothing
+	out           io.Writer
+	outMu         sync.Mutex // keeps lines from concurrent tasks whole
+}
+
+// defaultLifecycleParallelism bounds how many object-format tasks run at once
+// when the project doesn't set lifecycleParallelism
+const defaultLifecycleParallelism = 4
+
+// defaultLifecycleShell runs string-format commands when no shell is configured
+var defaultLifecycleShell = []string{"/bin/sh", "-c"}
+
+// lifecycleOutputLines is how many trailing lines of output a failed command's
+// error carries
+const lifecycleOutputLines = 20
+
+// LifecycleError is a failed lifecycle command or task, with the end of its
+// output so the failure explains itself
+type LifecycleError struct {
+	Task   string   // task of an object-format command, "" otherwise
+	Output []string // last lines of output
+	Err    error
+}
+
+func (e *LifecycleError) Error() string {
+	msg := e.Err.Error()
+	if e.Task != "" {
+		msg = fmt.Sprintf("task %s: %s", e.Task, msg)
+	}
+	if len(e.Output) > 0 {
+		msg += "\n    last output:\n      " + strings.Join(e.Output, "\n      ")
+	}
+	return msg
+}
+
+func (e *LifecycleError) Unwrap() error {
+	return e.Err
+}
+
+// newLifecycleError wraps a failed command's error with the tail of its output
+func newLifecycleError(task string, err error, output string) *LifecycleError {
+	return &LifecycleError{Task: task, Output: tailLines(output, lifecycleOutputLines), Err: err}
+}
+
+// tailLines returns the last n lines of output, ignoring trailing blank space
+func tailLines(output string, n int) []string {
+	output = strings.TrimRight(output, " \t\r\n")
+	if output == "" {
+		return nil
+	}
+	lines := strings.Split(output, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines
+}
+
+// tailBuffer keeps the end of a stream, enough for its last lines
+type tailBuffer struct {
+	buf []byte
+}
+
+// tailBufferSize bounds what tailBuffer keeps
+const tailBufferSize = 16 << 10
+
+func (t *tailBuffer) Write(b []byte) (int, error) {
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > tailBufferSize {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-tailBufferSize:]...)
+	}
+	return len(b), nil
+}
+
+// outputStreamer is implemented by clients that can stream a command's output
+// while it runs
+type outputStreamer interface {
+	RunStreaming(w io.Writer, args ...string) error
 }
 
 // NewLifecycleExecutor creates a new lifecycle executor.
@@ -28,9 +128,74 @@ func NewLifecycleExecutor(client DockerClient, containerName, containerUser stri
 		containerUser: containerUser,
 		verbose:       verbose,
 		metadata:      metadata,
+		out:           os.Stdout,
 	}
 }
 
+// SetRecorder sets where lifecycle command durations are recorded.
+func (le *LifecycleExecutor) SetRecorder(recorder *stats.Recorder) {
+	le.recorder = recorder
+}
+
+// SetEvents sets where lifecycle command and task results are reported.
+func (le *LifecycleExecutor) SetEvents(emitter *events.Emitter) {
+	le.events = emitter
+}
+
+// SetEnv sets extra environment variables (KEY=VALUE) for lifecycle commands.
+func (le *LifecycleExecutor) SetEnv(env []string) {
+	le.env = env
+}
+
+// SetWorkingDir sets the directory lifecycle commands run in.
+func (le *LifecycleExecutor) SetWorkingDir(dir string) {
+	le.workingDir = dir
+}
+
+// SetTaskPolicy sets how many tasks of an object-format command run at once
+// (0 for the default) and whether a failed task stops the ones not yet started.
+func (le *LifecycleExecutor) SetTaskPolicy(parallelism int, failurePolicy string) {
+	le.parallelism = parallelism
+	le.failurePolicy = failurePolicy
+}
+
+// SetShell sets the shell and flags string-format commands run with, the
+// command following as the last argument; nil restores sh -c.
+func (le *LifecycleExecutor) SetShell(shell []string) {
+	le.shell = shell
+}
+
+// SetAudit records each command run in the audit log, as run in container of
+// project.
+func (le *LifecycleExecutor) SetAudit(project, container string) {
+	le.auditProject = project
+	le.auditName = container
+}
+
+// shellArgs returns the exec args that run cmd through the shell
+func (le *LifecycleExecutor) shellArgs(cmd string) []string {
+	shell := le.shell
+	if len(shell) == 0 {
+		shell = defaultLifecycleShell
+	}
+	args := append(le.execArgs(), shell...)
+	return append(args, cmd)
+}
+
+// execArgs returns the docker exec args (up to the container name) shared by every
+// lifecycle command: its user, working directory, and environment
+func (le *LifecycleExecutor) execArgs() []string {
+	args := []string{"exec"}
+	if le.containerUser != "" {
+		args = append(args, "-u", le.containerUser)
+	}
+	if le.workingDir != "" {
+		args = append(args, "-w", le.workingDir)
+	}
+	args = append(args, envArgs(le.env)...)
+	return append(args, le.containerName)
+}
+
 // Execute executes a lifecycle command in the container.
 // The commandType parameter is used for tracking (e.g., "onCreate", "postCreate", "postStart").
 // Returns error if execution fails, nil if skipped or successful.
@@ -44,10 +209,12 @@ func (le *LifecycleExecutor) Execute(commandType string, cmd *devcontainer.Lifec
 		if le.verbose {
 			fmt.Printf("Skipping %s (already executed)\n", commandType)
 		}
+		le.events.Emit(events.Event{Type: events.TypeLifecycle, Command: commandType, Status: events.StatusSkipped})
 		return nil
 	}
 
 	// Handle different command types
+	start := time.Now()
 	var err error
 	if cmd.IsMerged() {
 		// Handle merged commands from feature lifecycle hooks
@@ -61,17 +228,34 @@ func (le *LifecycleExecutor) Execute(commandType string, cmd *devcontainer.Lifec
 		err = le.executeDirectCommand(arr)
 	} else if cmd.IsObject() {
 		obj, _ := cmd.AsObject()
-		err = le.executeParallelCommands(obj)
+		err = le.executeParallelCommands(commandType, obj)
 	} else {
 		return fmt.Errorf("unknown lifecycle command type")
 	}
 
-	// Mark as executed if successful
+	// Mark as executed if successful, or keep what went wrong
 	if err == nil && le.metadata != nil {
 		le.metadata.MarkExecuted(commandType, cmd)
+	} else if err != nil && le.metadata != nil {
+		le.metadata.RecordFailure(commandType, err)
+	}
+	if err == nil {
+		le.recorder.Record(stats.LifecyclePhase(commandType), time.Since(start), false)
 	}
+	if le.auditName != "" {
+		event := audit.Event{Type: audit.TypeLifecycle, Project: le.auditProject, Container: le.auditName, Command: commandType, Argv: cmd.ToStringSlice()}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		RecordAudit(event)
+	}
+	result := events.Event{Type: events.TypeLifecycle, Command: commandType, Status: events.StatusSucceeded, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status, result.Error = events.StatusFailed, err.Error()
+	}
+	le.events.Emit(result)
 
-	return err
+	return errdefs.New(errdefs.CategoryLifecycle, err)
 }
 
 // executeShellCommand executes a single shell command in the container.
@@ -82,19 +266,14 @@ func (le *LifecycleExecutor) Execute(commandType string, cmd *devcontainer.Lifec
 // in their own environment, so command injection is not a concern here.
 func (le *LifecycleExecutor) executeShellCommand(cmd string) error {
 	// Use docker exec to run command in container
-	args := []string{
-		"exec",
-		"-u", le.containerUser,
-		le.containerName,
-		"/bin/sh", "-c", cmd,
-	}
-
-	output, err := le.client.Run(args...)
+	output, err := le.client.Run(le.shellArgs(cmd)...)
 	if le.verbose || err != nil {
 		fmt.Println(output)
 	}
-
-	return err
+	if err != nil {
+		return newLifecycleError("", err, output)
+	}
+	return nil
 }
 
 // executeMergedCommands executes a sequence of merged commands from features and user config.
@@ -115,80 +294,227 @@ func (le *LifecycleExecutor) executeDirectCommand(cmdArray []string) error {
 	}
 
 	// Build docker exec args
-	args := []string{
-		"exec",
-		"-u", le.containerUser,
-		le.containerName,
-	}
-	args = append(args, cmdArray...)
+	args := append(le.execArgs(), cmdArray...)
 
 	output, err := le.client.Run(args...)
 	if le.verbose || err != nil {
 		fmt.Println(output)
 	}
-
-	return err
+	if err != nil {
+		return newLifecycleError("", err, output)
+	}
+	return nil
 }
 
-// executeParallelCommands executes multiple commands in parallel.
-func (le *LifecycleExecutor) executeParallelCommands(commands map[string]interface{}) error {
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(commands))
+// executeParallelCommands executes the tasks of an object-format command in
+// parallel, at most le.parallelism at a time and in name order. Tasks that
+// already succeeded with the same command are skipped. Under fail-fast, a failed
+// task stops the tasks that haven't started yet; running tasks finish.
+func (le *LifecycleExecutor) executeParallelCommands(commandType string, commands map[string]interface{}) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parallelism := le.parallelism
+	if parallelism <= 0 {
+		parallelism = defaultLifecycleParallelism
+	}
+	failFast := le.failurePolicy == devcontainer.LifecycleFailFast
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  bool
+		states  = make(map[string]TaskState, len(names))
+		errs    = make(map[string]error)
+		skipped []string
+	)
+	slots := make(chan struct{}, parallelism)
+
+	for _, name := range names {
+		taskCmd := commands[name]
+		hash := HashTask(taskCmd)
+		if le.metadata != nil && le.metadata.TaskDone(commandType, name, hash) {
+			if le.verbose {
+				fmt.Printf("Skipping %s task %s (already executed)\n", commandType, name)
+			}
+			mu.Lock()
+			states[name] = le.metadata.LifecycleRan[commandType].Tasks[name]
+			mu.Unlock()
+			continue
+		}
+
+		slots <- struct{}{}
+		mu.Lock()
+		stop := failFast && failed
+		if stop {
+			skipped = append(skipped, name)
+			states[name] = TaskState{Status: TaskSkipped, Timestamp: time.Now(), CommandHash: hash}
+		}
+		mu.Unlock()
+		if stop {
+			<-slots
+			le.reportTask(commandType, name, TaskState{Status: TaskSkipped})
+			continue
+		}
 
-	for name, cmd := range commands {
 		wg.Add(1)
-		go func(taskName string, taskCmd interface{}) {
+		go func(taskName string, taskCmd interface{}, hash string) {
 			defer wg.Done()
+			defer func() { <-slots }()
 
-			var err error
-			switch v := taskCmd.(type) {
-			case string:
-				err = le.executeShellCommand(v)
-			case []interface{}:
-				// Convert []interface{} to []string
-				strArray := make([]string, len(v))
-				for i, item := range v {
-					if s, ok := item.(string); ok {
-						strArray[i] = s
-					} else {
-						err = fmt.Errorf("task %s: invalid command array element type: %T", taskName, item)
-						errChan <- err
-						return
-					}
+			start := time.Now()
+			err := le.runTask(taskName, taskCmd)
+			state := TaskState{Status: TaskSucceeded, Timestamp: start, CommandHash: hash, DurationMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				state.Status = TaskFailed
+				state.Error = err.Error()
+				var lifecycleErr *LifecycleError
+				if errors.As(err, &lifecycleErr) {
+					state.Error, state.Output = lifecycleErr.Err.Error(), lifecycleErr.Output
 				}
-				err = le.executeDirectCommand(strArray)
-			default:
-				err = fmt.Errorf("task %s: invalid command type: %T", taskName, taskCmd)
 			}
 
+			mu.Lock()
+			states[taskName] = state
 			if err != nil {
-				errChan <- fmt.Errorf("task %s: %w", taskName, err)
+				failed = true
+				errs[taskName] = err
 			}
-		}(name, cmd)
+			mu.Unlock()
+			le.reportTask(commandType, taskName, state)
+		}(name, taskCmd, hash)
 	}
-
 	wg.Wait()
-	close(errChan)
 
-	// Collect all errors
-	var errors []error
-	for err := range errChan {
-		errors = append(errors, err)
+	if le.metadata != nil {
+		le.metadata.RecordTasks(commandType, states)
+	}
+
+	var taskErrs []error
+	for _, name := range names {
+		if err, ok := errs[name]; ok {
+			taskErrs = append(taskErrs, err)
+		}
 	}
 
-	if len(errors) == 0 {
+	if len(taskErrs) == 0 {
 		return nil
 	}
 
 	// Return single error or combined error message
-	if len(errors) == 1 {
-		return errors[0]
+	if len(taskErrs) == 1 && len(skipped) == 0 {
+		return taskErrs[0]
 	}
 
-	// Multiple errors - combine them
 	errMsg := "multiple tasks failed:"
-	for _, err := range errors {
+	if len(taskErrs) == 1 {
+		errMsg = "task failed:"
+	}
+	for _, err := range taskErrs {
 		errMsg += fmt.Sprintf("\n  - %s", err.Error())
 	}
+	if len(skipped) > 0 {
+		errMsg += fmt.Sprintf("\n  (not started after the failure: %s)", strings.Join(skipped, ", "))
+	}
 	return fmt.Errorf("%s", errMsg)
 }
+
+// runTask runs one task of an object-format command, prefixing each line of its
+// output with the task name. Output streams as it's produced in verbose mode and
+// is otherwise shown only when the task fails. A failure is a *LifecycleError
+// naming the task.
+func (le *LifecycleExecutor) runTask(name string, taskCmd interface{}) error {
+	var args []string
+	switch v := taskCmd.(type) {
+	case string:
+		args = le.shellArgs(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		args = le.execArgs()
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return &LifecycleError{Task: name, Err: fmt.Errorf("invalid command array element type: %T", item)}
+			}
+			args = append(args, s)
+		}
+	default:
+		return &LifecycleError{Task: name, Err: fmt.Errorf("invalid command type: %T", taskCmd)}
+	}
+
+	w := &prefixWriter{w: le.out, prefix: "[" + name + "] ", mu: &le.outMu}
+	defer w.Flush()
+
+	if streamer, ok := le.client.(outputStreamer); ok && le.verbose {
+		var tail tailBuffer
+		if err := streamer.RunStreaming(io.MultiWriter(w, &tail), args...); err != nil {
+			return newLifecycleError(name, err, string(tail.buf))
+		}
+		return nil
+	}
+	output, err := le.client.Run(args...)
+	if le.verbose || err != nil {
+		_, _ = w.Write([]byte(output))
+	}
+	if err != nil {
+		return newLifecycleError(name, err, output)
+	}
+	return nil
+}
+
+// reportTask prints a task's outcome; successes only in verbose mode
+func (le *LifecycleExecutor) reportTask(commandType, name string, state TaskState) {
+	le.events.Emit(events.Event{Type: events.TypeLifecycleTask, Command: commandType, Task: name, Status: string(state.Status), DurationMS: state.DurationMs})
+	if state.Status == TaskSucceeded && !le.verbose {
+		return
+	}
+	le.outMu.Lock()
+	defer le.outMu.Unlock()
+	switch state.Status {
+	case TaskSkipped:
+		_, _ = fmt.Fprintf(le.out, "%s task %s: skipped after an earlier task failed\n", commandType, name)
+	default:
+		_, _ = fmt.Fprintf(le.out, "%s task %s: %s in %s\n", commandType, name, state.Status, (time.Duration(state.DurationMs) * time.Millisecond).String())
+	}
+}
+
+// prefixWriter writes each line written to it with a prefix, so output from
+// concurrent tasks stays attributable. Whole lines are written under mu.
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes a trailing partial line
+func (p *prefixWriter) Flush() {
+	if len(strings.TrimSpace(string(p.buf))) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+	}
+	p.buf = nil
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+}
@@ -1,12 +1,17 @@
 package runner
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
 )
 
 // TestLifecycleExecutor_ExecuteString tests executing a string command
@@ -124,6 +129,9 @@ func TestLifecycleExecutor_ExecuteError(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error, got nil")
 	}
+	if got := errdefs.CategoryOf(err); got != errdefs.CategoryLifecycle {
+		t.Errorf("CategoryOf() = %s, want %s", got, errdefs.CategoryLifecycle)
+	}
 }
 
 // TestLifecycleExecutor_NilCommand tests handling of nil command
@@ -272,3 +280,290 @@ func contains(slice []string, strs ...string) bool {
 	}
 	return true
 }
+
+// TestLifecycleExecutor_UserWorkingDirAndEnv tests that commands run as the given
+// user in the workspace folder with remoteEnv applied
+func TestLifecycleExecutor_UserWorkingDirAndEnv(t *testing.T) {
+	var shellCmd, arrayCmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(`"make setup"`), &shellCmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`["npm", "ci"]`), &arrayCmd); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &mockDockerClient{execCalls: [][]string{}}
+	executor := NewLifecycleExecutor(mockClient, "test-container", "vscode", false, nil)
+	executor.SetWorkingDir("/workspaces/app")
+	executor.SetEnv([]string{"API_URL=http://localhost"})
+
+	if err := executor.Execute("onCreate", &shellCmd); err != nil {
+		t.Fatalf("Execute(onCreate) error = %v", err)
+	}
+	if err := executor.Execute("postCreate", &arrayCmd); err != nil {
+		t.Fatalf("Execute(postCreate) error = %v", err)
+	}
+
+	want := [][]string{
+		{"exec", "-u", "vscode", "-w", "/workspaces/app", "-e", "API_URL=http://localhost", "test-container", "/bin/sh", "-c", "make setup"},
+		{"exec", "-u", "vscode", "-w", "/workspaces/app", "-e", "API_URL=http://localhost", "test-container", "npm", "ci"},
+	}
+	if len(mockClient.execCalls) != len(want) {
+		t.Fatalf("Expected %d exec calls, got %d: %v", len(want), len(mockClient.execCalls), mockClient.execCalls)
+	}
+	for i, call := range mockClient.execCalls {
+		if strings.Join(call, " ") != strings.Join(want[i], " ") {
+			t.Errorf("exec call %d = %v, want %v", i, call, want[i])
+		}
+	}
+}
+
+// TestLifecycleExecutor_DefaultUser tests that no -u flag is passed without a user
+func TestLifecycleExecutor_DefaultUser(t *testing.T) {
+	var cmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(`"true"`), &cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	mockClient := &mockDockerClient{execCalls: [][]string{}}
+	executor := NewLifecycleExecutor(mockClient, "test-container", "", false, nil)
+	if err := executor.Execute("onCreate", &cmd); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if contains(mockClient.execCalls[0], "-u") {
+		t.Errorf("exec args should not include -u without a user: %v", mockClient.execCalls[0])
+	}
+}
+
+// taskClient runs object-format tasks: commands containing "fail" fail, and it
+// records which commands ran and how many ran at once
+type taskClient struct {
+	mockDockerClient
+	delay   time.Duration
+	mu      sync.Mutex
+	running int
+	peak    int
+	ran     []string
+}
+
+func (c *taskClient) Run(args ...string) (string, error) {
+	command := args[len(args)-1]
+	c.mu.Lock()
+	c.running++
+	if c.running > c.peak {
+		c.peak = c.running
+	}
+	c.ran = append(c.ran, command)
+	c.mu.Unlock()
+
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	c.running--
+	c.mu.Unlock()
+	if strings.Contains(command, "fail") {
+		return "boom\n", fmt.Errorf("exit status 1")
+	}
+	return "ok\n", nil
+}
+
+func objectCommand(t *testing.T, tasks string) *devcontainer.LifecycleCommand {
+	t.Helper()
+	var cmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(tasks), &cmd); err != nil {
+		t.Fatal(err)
+	}
+	return &cmd
+}
+
+func TestLifecycleExecutor_BoundedParallelism(t *testing.T) {
+	client := &taskClient{delay: 20 * time.Millisecond}
+	executor := NewLifecycleExecutor(client, "test-container", "", false, nil)
+	executor.SetTaskPolicy(2, "")
+
+	cmd := objectCommand(t, `{"a": "echo a", "b": "echo b", "c": "echo c", "d": "echo d", "e": "echo e"}`)
+	if err := executor.Execute("postCreate", cmd); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(client.ran) != 5 {
+		t.Errorf("ran %v, want all 5 tasks", client.ran)
+	}
+	if client.peak > 2 {
+		t.Errorf("%d tasks ran at once, want at most 2", client.peak)
+	}
+}
+
+func TestLifecycleExecutor_FailFast(t *testing.T) {
+	client := &taskClient{}
+	metadata := &ContainerMetadata{LifecycleRan: make(map[string]LifecycleState)}
+	executor := NewLifecycleExecutor(client, "test-container", "", false, metadata)
+	executor.out = io.Discard
+	executor.SetTaskPolicy(1, devcontainer.LifecycleFailFast)
+
+	cmd := objectCommand(t, `{"a": "fail", "b": "echo b", "c": "echo c"}`)
+	err := executor.Execute("onCreate", cmd)
+	if err == nil || !strings.Contains(err.Error(), "not started after the failure: b, c") {
+		t.Fatalf("Execute() error = %v, want b and c reported as not started", err)
+	}
+	if strings.Join(client.ran, ",") != "fail" {
+		t.Errorf("ran %v, want only the failing task", client.ran)
+	}
+
+	tasks := metadata.LifecycleRan["onCreate"].Tasks
+	if tasks["a"].Status != TaskFailed || tasks["b"].Status != TaskSkipped || tasks["c"].Status != TaskSkipped {
+		t.Errorf("task states = %+v", tasks)
+	}
+	if metadata.LifecycleRan["onCreate"].Executed {
+		t.Error("a failed command should not be marked executed")
+	}
+}
+
+func TestLifecycleExecutor_ContinueOnErrorRerunsOnlyFailedTasks(t *testing.T) {
+	client := &taskClient{}
+	metadata := &ContainerMetadata{LifecycleRan: make(map[string]LifecycleState)}
+	executor := NewLifecycleExecutor(client, "test-container", "", false, metadata)
+	executor.out = io.Discard
+
+	err := executor.Execute("postCreate", objectCommand(t, `{"deps": "npm ci", "db": "fail migrate"}`))
+	if err == nil || !strings.Contains(err.Error(), "task db") {
+		t.Fatalf("Execute() error = %v, want task db to fail", err)
+	}
+	if len(client.ran) != 2 {
+		t.Fatalf("ran %v, want both tasks despite the failure", client.ran)
+	}
+	tasks := metadata.LifecycleRan["postCreate"].Tasks
+	if tasks["deps"].Status != TaskSucceeded || tasks["db"].Status != TaskFailed || tasks["deps"].CommandHash == "" {
+		t.Errorf("task states = %+v", tasks)
+	}
+
+	// Fixing the failed task reruns only that task
+	client.ran = nil
+	fixed := objectCommand(t, `{"deps": "npm ci", "db": "migrate"}`)
+	if err := executor.Execute("postCreate", fixed); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if strings.Join(client.ran, ",") != "migrate" {
+		t.Errorf("ran %v, want only the previously failed task", client.ran)
+	}
+	state := metadata.LifecycleRan["postCreate"]
+	if !state.Executed || state.Tasks["db"].Status != TaskSucceeded || state.Tasks["deps"].Status != TaskSucceeded {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+// streamingTaskClient streams its output like docker.Client
+type streamingTaskClient struct {
+	taskClient
+}
+
+func (c *streamingTaskClient) RunStreaming(w io.Writer, args ...string) error {
+	_, _ = io.WriteString(w, "step 1\nstep ")
+	_, _ = io.WriteString(w, "2\n")
+	return nil
+}
+
+func TestLifecycleExecutor_PrefixedTaskOutput(t *testing.T) {
+	var out bytes.Buffer
+	executor := NewLifecycleExecutor(&streamingTaskClient{}, "test-container", "", true, nil)
+	executor.out = &out
+
+	if err := executor.Execute("postStart", objectCommand(t, `{"watch": "npm run watch"}`)); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "[watch] step 1\n[watch] step 2\n") {
+		t.Errorf("output = %q, want each line prefixed with the task name", out.String())
+	}
+	if !strings.Contains(out.String(), "postStart task watch: succeeded") {
+		t.Errorf("output = %q, want the task status", out.String())
+	}
+
+	// Without streaming, a failed task's output is still shown with its prefix
+	out.Reset()
+	executor = NewLifecycleExecutor(&taskClient{}, "test-container", "", false, nil)
+	executor.out = &out
+	if err := executor.Execute("postStart", objectCommand(t, `{"lint": "fail lint"}`)); err == nil {
+		t.Fatal("Execute() should fail")
+	}
+	if !strings.Contains(out.String(), "[lint] boom\n") || !strings.Contains(out.String(), "postStart task lint: failed") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+// recordingClient records exec args and fails commands containing "fail" after
+// printing more output than an error keeps
+type recordingClient struct {
+	mockDockerClient
+	calls [][]string
+}
+
+func (c *recordingClient) Run(args ...string) (string, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, args)
+	c.mu.Unlock()
+	if strings.Contains(args[len(args)-1], "fail") {
+		var output strings.Builder
+		for i := 1; i <= 30; i++ {
+			fmt.Fprintf(&output, "line %d\n", i)
+		}
+		return output.String() + "npm ERR! missing script: build\n", fmt.Errorf("exit status 1")
+	}
+	return "", nil
+}
+
+func TestLifecycleExecutor_StrictShellArgs(t *testing.T) {
+	client := &recordingClient{}
+	executor := NewLifecycleExecutor(client, "test-container", "", false, nil)
+	executor.out = io.Discard
+	executor.SetShell(devcontainer.StrictLifecycleShell)
+
+	var shellCmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(`"curl -fsSL x | sh"`), &shellCmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.Execute("onCreate", &shellCmd); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if err := executor.Execute("postCreate", objectCommand(t, `{"deps": "npm ci"}`)); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := []string{"/bin/sh -euo pipefail -c curl -fsSL x | sh", "/bin/sh -euo pipefail -c npm ci"}
+	for i, args := range client.calls {
+		if got := strings.Join(args[len(args)-5:], " "); got != want[i] {
+			t.Errorf("exec %d = %v, want it to end with %q", i, args, want[i])
+		}
+	}
+}
+
+func TestLifecycleExecutor_FailureContext(t *testing.T) {
+	client := &recordingClient{}
+	metadata := &ContainerMetadata{LifecycleRan: make(map[string]LifecycleState)}
+	executor := NewLifecycleExecutor(client, "test-container", "", false, metadata)
+	executor.out = io.Discard
+
+	var shellCmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(`"npm run fail"`), &shellCmd); err != nil {
+		t.Fatal(err)
+	}
+	err := executor.Execute("postCreate", &shellCmd)
+	if err == nil || !strings.Contains(err.Error(), "exit status 1") || !strings.Contains(err.Error(), "npm ERR! missing script: build") {
+		t.Fatalf("Execute() error = %v, want the end of the output", err)
+	}
+	if strings.Contains(err.Error(), "line 11\n") || !strings.Contains(err.Error(), "line 12\n") {
+		t.Errorf("Execute() error = %v, want only the last %d lines", err, lifecycleOutputLines)
+	}
+	failure := metadata.LifecycleRan["postCreate"].Failure
+	if failure == nil || failure.Error != "exit status 1" || len(failure.Output) != lifecycleOutputLines {
+		t.Errorf("recorded failure = %+v, want the error and output tail", failure)
+	}
+
+	// A failed task is named, and its output tail kept with the task
+	err = executor.Execute("postCreate", objectCommand(t, `{"build": "npm run fail", "lint": "npm run lint"}`))
+	if err == nil || !strings.Contains(err.Error(), "task build: exit status 1") || !strings.Contains(err.Error(), "missing script") {
+		t.Fatalf("Execute() error = %v, want the task name and its output", err)
+	}
+	task := metadata.LifecycleRan["postCreate"].Tasks["build"]
+	if task.Status != TaskFailed || task.Error != "exit status 1" || task.Output[len(task.Output)-1] != "npm ERR! missing script: build" {
+		t.Errorf("task state = %+v", task)
+	}
+}
@@ -3,6 +3,7 @@ package runner
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,19 +14,59 @@ import (
 
 // ContainerMetadata tracks the lifecycle execution state for a container.
 // This metadata is persisted to disk to ensure onCreate/postCreate commands
-// run only once, while postStart commands always run.
+// run only once, and postStart commands once each time the container starts.
 type ContainerMetadata struct {
 	ContainerID  string                    `json:"containerId"`
 	CreatedAt    time.Time                 `json:"createdAt"`
 	UpdatedAt    time.Time                 `json:"updatedAt"`
 	LifecycleRan map[string]LifecycleState `json:"lifecycleRan"`
+
+	// Incomplete is set while the lifecycle commands of a new container run,
+	// so a creation that was interrupted (or killed) is resumed by the next run
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// StartedAt is the container's start packnplay last saw, as the runtime
+	// reports it, so a restart by the runtime itself can be noticed
+	StartedAt string `json:"startedAt,omitempty"`
+
+	// Runtime is the command of the runtime running the container (docker,
+	// podman, ...). The metadata directory is shared, so pruning only
+	// considers the containers of the runtime that records them.
+	Runtime string `json:"runtime,omitempty"`
 }
 
 // LifecycleState tracks the execution state of a specific lifecycle command.
 type LifecycleState struct {
-	Executed    bool      `json:"executed"`
+	Executed    bool                 `json:"executed"`
+	Timestamp   time.Time            `json:"timestamp"`
+	CommandHash string               `json:"commandHash"`
+	Tasks       map[string]TaskState `json:"tasks,omitempty"`     // per task of an object-format command
+	Failure     *LifecycleFailure    `json:"failure,omitempty"`   // the latest run's failure, cleared by a success
+	StartedAt   string               `json:"startedAt,omitempty"` // the container start the command ran in
+}
+
+// LifecycleFailure records how a lifecycle command last failed
+type LifecycleFailure struct {
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error"`
+	Output    []string  `json:"output,omitempty"` // last lines of output
+}
+
+// Statuses of the tasks of object-format lifecycle commands
+const (
+	TaskSucceeded = "succeeded"
+	TaskFailed    = "failed"
+	TaskSkipped   = "skipped" // not started because another task failed under fail-fast
+)
+
+// TaskState tracks the last run of one task of an object-format lifecycle command.
+type TaskState struct {
+	Status      string    `json:"status"`
 	Timestamp   time.Time `json:"timestamp"`
 	CommandHash string    `json:"commandHash"`
+	DurationMs  int64     `json:"durationMs,omitempty"`
+	Error       string    `json:"error,omitempty"`  // why a failed task failed
+	Output      []string  `json:"output,omitempty"` // last lines of a failed task's output
 }
 
 // GetMetadataPath returns the path where metadata for a container should be stored.
@@ -33,6 +74,16 @@ type LifecycleState struct {
 // Location: ${XDG_DATA_HOME}/packnplay/metadata/{container-id}.json
 // or ~/.local/share/packnplay/metadata/{container-id}.json
 func GetMetadataPath(containerID string) (string, error) {
+	metadataDir, err := getMetadataDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(metadataDir, containerID+".json"), nil
+}
+
+// getMetadataDir returns the metadata directory, creating it if needed
+func getMetadataDir() (string, error) {
 	// Get data directory
 	dataHome := os.Getenv("XDG_DATA_HOME")
 	if dataHome == "" {
@@ -49,7 +100,7 @@ func GetMetadataPath(containerID string) (string, error) {
 		return "", fmt.Errorf("failed to create metadata directory: %w", err)
 	}
 
-	return filepath.Join(metadataDir, containerID+".json"), nil
+	return metadataDir, nil
 }
 
 // LoadMetadata loads the metadata for a container from disk.
@@ -148,9 +199,21 @@ func HashCommand(cmd *devcontainer.LifecycleCommand) string {
 	return fmt.Sprintf("%x", hash)
 }
 
+// HashTask computes a deterministic hash of one task of an object-format
+// lifecycle command.
+func HashTask(task interface{}) string {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("%x", hash)
+}
+
 // ShouldRun determines whether a lifecycle command should be executed.
 // Returns true if:
-//   - This is postStart (always runs)
+//   - This is postStart and the container started again since it ran, or
+//     packnplay can't tell when the container started
 //   - Command hasn't been executed before
 //   - Command has changed (different hash)
 //
@@ -163,11 +226,6 @@ func (m *ContainerMetadata) ShouldRun(commandType string, cmd *devcontainer.Life
 		return false
 	}
 
-	// postStart always runs (no tracking)
-	if commandType == "postStart" {
-		return true
-	}
-
 	// Check if command has been executed before
 	state, exists := m.LifecycleRan[commandType]
 	if !exists {
@@ -175,6 +233,11 @@ func (m *ContainerMetadata) ShouldRun(commandType string, cmd *devcontainer.Life
 		return true
 	}
 
+	// postStart runs once per start of the container
+	if commandType == "postStart" && (m.StartedAt == "" || state.StartedAt != m.StartedAt) {
+		return true
+	}
+
 	// Command has been executed before - check if it changed
 	currentHash := HashCommand(cmd)
 	if currentHash != state.CommandHash {
@@ -198,6 +261,42 @@ func (m *ContainerMetadata) MarkExecuted(commandType string, cmd *devcontainer.L
 		Executed:    true,
 		Timestamp:   now,
 		CommandHash: HashCommand(cmd),
+		Tasks:       m.LifecycleRan[commandType].Tasks,
+		StartedAt:   m.StartedAt,
 	}
 	m.UpdatedAt = now
 }
+
+// RecordFailure records a lifecycle command's failure, keeping the output of
+// a single failed command (a failed task's is kept with the task)
+func (m *ContainerMetadata) RecordFailure(commandType string, err error) {
+	failure := &LifecycleFailure{Timestamp: time.Now(), Error: err.Error()}
+	var lifecycleErr *LifecycleError
+	if errors.As(err, &lifecycleErr) && lifecycleErr.Task == "" {
+		failure.Error, failure.Output = lifecycleErr.Err.Error(), lifecycleErr.Output
+	}
+	state := m.LifecycleRan[commandType]
+	state.Failure = failure
+	m.LifecycleRan[commandType] = state
+	m.UpdatedAt = failure.Timestamp
+}
+
+// TaskDone reports whether a task of an object-format command already succeeded
+// with the same command, so a rerun after a partial failure or an edit to
+// another task only repeats the tasks that need it. postStart tasks always run.
+func (m *ContainerMetadata) TaskDone(commandType, task, hash string) bool {
+	if commandType == "postStart" {
+		return false
+	}
+	state, ok := m.LifecycleRan[commandType].Tasks[task]
+	return ok && state.Status == TaskSucceeded && state.CommandHash == hash
+}
+
+// RecordTasks records the task states of an object-format command's latest run,
+// dropping tasks that are no longer part of it.
+func (m *ContainerMetadata) RecordTasks(commandType string, tasks map[string]TaskState) {
+	state := m.LifecycleRan[commandType]
+	state.Tasks = tasks
+	m.LifecycleRan[commandType] = state
+	m.UpdatedAt = time.Now()
+}
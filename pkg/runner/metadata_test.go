@@ -212,6 +212,31 @@ func TestMetadata_ShouldRun_PostStartAlwaysRuns(t *testing.T) {
 	}
 }
 
+func TestMetadata_ShouldRun_PostStartOncePerStart(t *testing.T) {
+	var cmd devcontainer.LifecycleCommand
+	if err := json.Unmarshal([]byte(`"npm run dev"`), &cmd); err != nil {
+		t.Fatalf("Failed to create command: %v", err)
+	}
+
+	metadata := &ContainerMetadata{
+		ContainerID:  "test-container",
+		LifecycleRan: make(map[string]LifecycleState),
+		StartedAt:    "2026-01-02T03:04:05.000000001Z",
+	}
+	if !metadata.ShouldRun("postStart", &cmd) {
+		t.Error("postStart should run in a new container")
+	}
+	metadata.MarkExecuted("postStart", &cmd)
+	if metadata.ShouldRun("postStart", &cmd) {
+		t.Error("postStart should not run again until the container restarts")
+	}
+
+	metadata.StartedAt = "2026-01-02T04:00:00.000000001Z"
+	if !metadata.ShouldRun("postStart", &cmd) {
+		t.Error("postStart should run after the container restarted")
+	}
+}
+
 func TestMetadata_HashCommand_Deterministic(t *testing.T) {
 	// Test string command
 	cmdJSON := `"npm install"`
@@ -0,0 +1,27 @@
+package runner
+
+import (
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/registry"
+)
+
+// Registry mirror fallbacks: what a pull does when the mirror fails
+const (
+	MirrorFallbackOrigin = "origin" // pull from the registry itself (default)
+	MirrorFallbackNone   = "none"   // fail rather than bypass the mirror
+)
+
+// registryMirrors returns how pulls use the registry settings' mirrors
+func registryMirrors(settings config.RegistryConfig) (registry.Mirrors, error) {
+	switch settings.Fallback {
+	case "", MirrorFallbackOrigin, MirrorFallbackNone:
+	default:
+		return registry.Mirrors{}, errdefs.Errorf(errdefs.CategoryConfig, "invalid registry.fallback %q (use origin or none)", settings.Fallback)
+	}
+	return registry.Mirrors{
+		Hosts:      settings.Mirrors,
+		NoFallback: settings.Fallback == MirrorFallbackNone,
+		Offline:    settings.Offline,
+	}, nil
+}
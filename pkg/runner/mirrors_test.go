@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/registry"
+)
+
+func TestRegistryMirrors(t *testing.T) {
+	hosts := map[string]string{"ghcr.io": "harbor.corp/ghcr"}
+	mirrors, err := registryMirrors(config.RegistryConfig{Mirrors: hosts, Fallback: MirrorFallbackNone})
+	if err != nil {
+		t.Fatalf("registryMirrors() error = %v", err)
+	}
+	if !mirrors.NoFallback || mirrors.Hosts["ghcr.io"] != "harbor.corp/ghcr" {
+		t.Errorf("registryMirrors() = %+v", mirrors)
+	}
+	if mirrors, _ := registryMirrors(config.RegistryConfig{Mirrors: hosts}); mirrors.NoFallback {
+		t.Error("pulls should fall back to the registry by default")
+	}
+	if _, err := registryMirrors(config.RegistryConfig{Fallback: "never"}); err == nil {
+		t.Error("registryMirrors() should reject an unknown fallback")
+	}
+}
+
+func TestPullImageThroughMirror(t *testing.T) {
+	fake := dockertest.New()
+	im := NewImageManager(fake, false)
+	im.SetMirrors(registry.Mirrors{Hosts: map[string]string{"ghcr.io": "harbor.corp/ghcr"}})
+
+	if err := im.pullImage("ghcr.io/acme/base:1"); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+	pulls := fake.CallsTo("pull")
+	if len(pulls) != 1 || pulls[0][len(pulls[0])-1] != "harbor.corp/ghcr/acme/base:1" {
+		t.Errorf("pulls = %v, want the mirror's image", pulls)
+	}
+	if fake.Image("ghcr.io/acme/base:1") == nil {
+		t.Error("the mirrored image should be tagged with its own name")
+	}
+
+	// Images of other registries are pulled as before
+	if err := im.pullImage("alpine:3.20"); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+	if got := fake.CallsTo("pull"); len(got) != 2 || got[1][len(got[1])-1] != "alpine:3.20" {
+		t.Errorf("pulls = %v", got)
+	}
+}
+
+func TestPullImageMirrorFallback(t *testing.T) {
+	for _, noFallback := range []bool{false, true} {
+		fake := dockertest.New()
+		fake.On(func([]string) (string, error) { return "", errors.New("mirror down") }, "pull", "harbor.corp/ghcr/acme/base:1")
+		im := NewImageManager(fake, false)
+		im.SetMirrors(registry.Mirrors{Hosts: map[string]string{"ghcr.io": "harbor.corp/ghcr"}, NoFallback: noFallback})
+
+		err := im.pullImage("ghcr.io/acme/base:1")
+		if noFallback {
+			if err == nil || !strings.Contains(err.Error(), "mirror down") {
+				t.Errorf("pullImage() error = %v, want the mirror's failure", err)
+			}
+			if fake.Image("ghcr.io/acme/base:1") != nil {
+				t.Error("the registry should not be used without fallback")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("pullImage() error = %v", err)
+		}
+		pulls := fake.CallsTo("pull")
+		if last := pulls[len(pulls)-1]; last[len(last)-1] != "ghcr.io/acme/base:1" {
+			t.Errorf("pulls = %v, want a fallback to the registry", pulls)
+		}
+	}
+}
+
+func TestPullImageOffline(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	im := NewImageManager(fake, false)
+	im.SetMirrors(registry.Mirrors{Offline: true})
+	im.SetRefresh(true, false)
+
+	if err := im.pullImage("alpine:3.20"); err != nil {
+		t.Errorf("pullImage() of a local image error = %v", err)
+	}
+	if err := im.pullImage("ghcr.io/acme/base:1"); !errors.Is(err, registry.ErrOffline) {
+		t.Errorf("pullImage() error = %v, want ErrOffline", err)
+	}
+	if pulls := fake.CallsTo("pull"); len(pulls) != 0 {
+		t.Errorf("pulls = %v, want none offline", pulls)
+	}
+}
+
+func TestBuildPullsBaseImagesThroughMirror(t *testing.T) {
+	fake := dockertest.New()
+	project := newProject(t, `{"build": {"dockerfile": "Dockerfile"}}`)
+	if err := os.WriteFile(filepath.Join(project, ".devcontainer", "Dockerfile"), []byte("FROM ghcr.io/acme/base:1\nRUN true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	devConfig, err := devcontainer.LoadConfig(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	im := NewImageManager(fake, false)
+	im.SetMirrors(registry.Mirrors{Hosts: map[string]string{"ghcr.io": "harbor.corp/ghcr"}})
+	im.SetRefresh(true, false)
+	if err := im.EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	pulls := fake.CallsTo("pull")
+	if len(pulls) != 1 || pulls[0][len(pulls[0])-1] != "harbor.corp/ghcr/acme/base:1" {
+		t.Errorf("pulls = %v, want the base image from the mirror", pulls)
+	}
+	for _, build := range fake.CallsTo("build") {
+		for _, arg := range build {
+			if arg == "--pull" {
+				t.Errorf("build = %v, should find the pulled base image rather than pull it itself", build)
+			}
+		}
+	}
+}
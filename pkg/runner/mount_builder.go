@@ -13,17 +13,17 @@ import (
 // It handles project mounts, credential mounts, and AI agent configuration mounts.
 type MountBuilder struct {
 	hostHomeDir   string
-	containerUser string
+	containerHome string
 }
 
 // NewMountBuilder creates a MountBuilder with the specified host home directory
-// and container user. The hostHomeDir is used to locate credential and agent
-// configuration directories. The containerUser determines the target paths in
-// the container.
-func NewMountBuilder(hostHomeDir, containerUser string) *MountBuilder {
+// and container user's home directory. The hostHomeDir is used to locate
+// credential and agent configuration directories. The containerHome determines
+// the target paths in the container.
+func NewMountBuilder(hostHomeDir, containerHome string) *MountBuilder {
 	return &MountBuilder{
 		hostHomeDir:   hostHomeDir,
-		containerUser: containerUser,
+		containerHome: containerHome,
 	}
 }
 
@@ -76,7 +76,7 @@ func (mb *MountBuilder) BuildMounts(cfg *RunConfig) ([]string, error) {
 	args = append(args, credMounts...)
 
 	// 4. Mount agent configs using Agent abstraction (NOT hardcoded list)
-	agentMounts := mb.BuildAgentMounts()
+	agentMounts := mb.BuildAgentMounts(nil)
 	args = append(args, agentMounts...)
 
 	return args, nil
@@ -89,7 +89,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.Git {
 		gitconfig := filepath.Join(mb.hostHomeDir, ".gitconfig")
 		if fileExists(gitconfig) {
-			target := fmt.Sprintf("/home/%s/.gitconfig", mb.containerUser)
+			target := mb.containerHome + "/.gitconfig"
 			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", gitconfig, target))
 		}
 	}
@@ -97,7 +97,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.SSH {
 		sshDir := filepath.Join(mb.hostHomeDir, ".ssh")
 		if fileExists(sshDir) {
-			target := fmt.Sprintf("/home/%s/.ssh", mb.containerUser)
+			target := mb.containerHome + "/.ssh"
 			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", sshDir, target))
 		}
 	}
@@ -105,7 +105,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.GH {
 		ghConfigPath := filepath.Join(mb.hostHomeDir, ".config", "gh")
 		if fileExists(ghConfigPath) {
-			target := fmt.Sprintf("/home/%s/.config/gh", mb.containerUser)
+			target := mb.containerHome + "/.config/gh"
 			args = append(args, "-v", fmt.Sprintf("%s:%s", ghConfigPath, target))
 		}
 	}
@@ -113,7 +113,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.GPG {
 		gnupgPath := filepath.Join(mb.hostHomeDir, ".gnupg")
 		if fileExists(gnupgPath) {
-			target := fmt.Sprintf("/home/%s/.gnupg", mb.containerUser)
+			target := mb.containerHome + "/.gnupg"
 			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", gnupgPath, target))
 		}
 	}
@@ -121,7 +121,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.NPM {
 		npmrcPath := filepath.Join(mb.hostHomeDir, ".npmrc")
 		if fileExists(npmrcPath) {
-			target := fmt.Sprintf("/home/%s/.npmrc", mb.containerUser)
+			target := mb.containerHome + "/.npmrc"
 			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", npmrcPath, target))
 		}
 	}
@@ -129,7 +129,7 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 	if creds.AWS {
 		awsDir := filepath.Join(mb.hostHomeDir, ".aws")
 		if fileExists(awsDir) {
-			target := fmt.Sprintf("/home/%s/.aws", mb.containerUser)
+			target := mb.containerHome + "/.aws"
 			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", awsDir, target))
 		}
 	}
@@ -140,10 +140,16 @@ func (mb *MountBuilder) buildCredentialMounts(creds config.Credentials) []string
 // BuildAgentMounts constructs agent config directory mounts
 // Uses the Agent abstraction instead of hardcoded list (fixes architectural smell)
 // Exported for use in runner.Run() to replace hardcoded agent list
-func (mb *MountBuilder) BuildAgentMounts() []string {
+// Agents with a volume in isolated get it instead of the host's config dir.
+func (mb *MountBuilder) BuildAgentMounts(isolated []AgentVolume) []string {
 	var args []string
 
 	for _, agent := range agents.GetSupportedAgents() {
+		if volume, ok := findAgentVolume(isolated, agent.Name()); ok {
+			args = append(args, volume.MountArgs()...)
+			continue
+		}
+
 		// Check if agent config exists on host
 		agentPath := filepath.Join(mb.hostHomeDir, agent.ConfigDir())
 		if !fileExists(agentPath) {
@@ -151,7 +157,7 @@ func (mb *MountBuilder) BuildAgentMounts() []string {
 		}
 
 		// Get mounts from agent
-		mounts := agent.GetMounts(mb.hostHomeDir, mb.containerUser)
+		mounts := agent.GetMounts(mb.hostHomeDir, mb.containerHome)
 		for _, mount := range mounts {
 			// Convert Mount struct to Docker -v format
 			// IMPORTANT: Mount struct has no String() method, convert manually
@@ -9,7 +9,7 @@ import (
 )
 
 func TestMountBuilder_BuildMounts_Basic(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	cfg := &RunConfig{
 		Path: "/project/path",
@@ -43,7 +43,7 @@ func TestMountBuilder_BuildMounts_Basic(t *testing.T) {
 }
 
 func TestMountBuilder_BuildMounts_WithSSH(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	cfg := &RunConfig{
 		Path: "/project/path",
@@ -67,7 +67,7 @@ func TestMountBuilder_BuildMounts_WithSSH(t *testing.T) {
 }
 
 func TestMountBuilder_BuildMounts_WithAgents(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	cfg := &RunConfig{
 		Path:        "/project/path",
@@ -87,7 +87,7 @@ func TestMountBuilder_BuildMounts_WithAgents(t *testing.T) {
 
 func TestMountBuilder_BuildMounts_NoAgentsExist(t *testing.T) {
 	// Test with non-existent home directory to simulate no agent configs
-	mb := NewMountBuilder("/nonexistent/path", "testuser")
+	mb := NewMountBuilder("/nonexistent/path", "/home/testuser")
 
 	cfg := &RunConfig{
 		Path:        "/project/path",
@@ -113,7 +113,7 @@ func TestMountBuilder_BuildMounts_NoAgentsExist(t *testing.T) {
 }
 
 func TestMountBuilder_BuildMounts_WithWorkspaceMount(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	// Create a substitution context for variable substitution
 	ctx := &devcontainer.SubstituteContext{
@@ -174,7 +174,7 @@ func TestMountBuilder_BuildMounts_WithWorkspaceMount(t *testing.T) {
 }
 
 func TestMountBuilder_BuildMounts_WithWorkspaceMount_RequiresWorkspaceFolder(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	ctx := &devcontainer.SubstituteContext{
 		LocalWorkspaceFolder:     "/host/project",
@@ -202,7 +202,7 @@ func TestMountBuilder_BuildMounts_WithWorkspaceMount_RequiresWorkspaceFolder(t *
 }
 
 func TestMountBuilder_BuildMounts_WithoutWorkspaceMount_UsesDefaultVolumeMount(t *testing.T) {
-	mb := NewMountBuilder("/home/testuser", "testuser")
+	mb := NewMountBuilder("/home/testuser", "/home/testuser")
 
 	cfg := &RunConfig{
 		Path:           "/project/path",
@@ -0,0 +1,131 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bindMount is a host directory or file bind mounted into the container
+type bindMount struct {
+	source string
+	target string
+}
+
+// parseBindMounts extracts host bind mounts from -v and --mount docker args
+func parseBindMounts(args []string) []bindMount {
+	var mounts []bindMount
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-v", "--volume":
+			parts := strings.SplitN(args[i+1], ":", 3)
+			if len(parts) >= 2 && filepath.IsAbs(parts[0]) {
+				mounts = append(mounts, bindMount{source: filepath.Clean(parts[0]), target: parts[1]})
+			}
+			i++
+		case "--mount":
+			fields := make(map[string]string)
+			for _, field := range strings.Split(args[i+1], ",") {
+				key, value, _ := strings.Cut(field, "=")
+				fields[key] = value
+			}
+			source := firstNonEmpty(fields["source"], fields["src"])
+			target := firstNonEmpty(fields["target"], fields["destination"], fields["dst"])
+			if fields["type"] == "bind" && filepath.IsAbs(source) && target != "" {
+				mounts = append(mounts, bindMount{source: filepath.Clean(source), target: target})
+			}
+			i++
+		}
+	}
+	return mounts
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// expandExcludePath resolves ~/ against homeDir and cleans the path
+func expandExcludePath(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(homeDir, path[2:])
+	}
+	return filepath.Clean(path)
+}
+
+// excludeTarget returns where a host path appears inside the container, using the
+// most specific bind mount that contains it
+func excludeTarget(mounts []bindMount, hostPath string) (string, bool) {
+	best := -1
+	for i, m := range mounts {
+		if hostPath != m.source && !strings.HasPrefix(hostPath, m.source+string(filepath.Separator)) {
+			continue
+		}
+		if best == -1 || len(m.source) > len(mounts[best].source) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return "", false
+	}
+	rel, err := filepath.Rel(mounts[best].source, hostPath)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(filepath.Join(mounts[best].target, rel)), true
+}
+
+// mountExcludeArgs hides excluded host paths that fall inside bind mounts:
+// directories are covered with an empty tmpfs and files with /dev/null.
+// Must be applied after mount relabeling so /dev/null is never relabeled.
+func mountExcludeArgs(args []string, excludes []string, homeDir string, verbose bool) []string {
+	if len(excludes) == 0 {
+		return nil
+	}
+
+	mounts := parseBindMounts(args)
+	var overlay []string
+	for _, exclude := range excludes {
+		hostPath := expandExcludePath(exclude, homeDir)
+
+		// Overlaying a path that doesn't exist would create it on the host
+		info, err := os.Stat(hostPath)
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Mount exclude %s does not exist, skipping\n", exclude)
+			}
+			continue
+		}
+
+		target, ok := excludeTarget(mounts, hostPath)
+		if !ok {
+			if resolved, err := filepath.EvalSymlinks(hostPath); err == nil {
+				target, ok = excludeTarget(mounts, resolved)
+			}
+		}
+		if !ok {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Mount exclude %s is not inside a mounted directory, skipping\n", exclude)
+			}
+			continue
+		}
+
+		if info.IsDir() {
+			overlay = append(overlay, "--mount", fmt.Sprintf("type=tmpfs,destination=%s", target))
+		} else {
+			overlay = append(overlay, "-v", fmt.Sprintf("/dev/null:%s:ro", target))
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Hiding %s from the container (%s)\n", exclude, target)
+		}
+	}
+	return overlay
+}
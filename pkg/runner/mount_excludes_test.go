@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBindMounts(t *testing.T) {
+	args := []string{
+		"run", "-d",
+		"-v", "/home/u/.claude:/home/dev/.claude",
+		"-v", "/home/u/.gitconfig:/home/dev/.gitconfig:ro",
+		"-v", "named-volume:/data",
+		"--mount", "type=bind,source=/src/app,target=/workspace",
+		"--mount", "type=tmpfs,destination=/tmp/x",
+		"-e", "FOO=bar",
+	}
+	want := []bindMount{
+		{"/home/u/.claude", "/home/dev/.claude"},
+		{"/home/u/.gitconfig", "/home/dev/.gitconfig"},
+		{"/src/app", "/workspace"},
+	}
+	if got := parseBindMounts(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseBindMounts() = %v, want %v", got, want)
+	}
+}
+
+func TestExcludeTarget_MostSpecificMount(t *testing.T) {
+	mounts := []bindMount{
+		{"/home/u", "/home/dev"},
+		{"/home/u/.claude", "/root/.claude"},
+	}
+	got, ok := excludeTarget(mounts, "/home/u/.claude/session-env")
+	if !ok || got != "/root/.claude/session-env" {
+		t.Errorf("excludeTarget() = %q, %v", got, ok)
+	}
+	if _, ok := excludeTarget(mounts, "/home/user2/x"); ok {
+		t.Error("excludeTarget() matched a path outside every mount")
+	}
+}
+
+func TestMountExcludeArgs(t *testing.T) {
+	home := t.TempDir()
+	claudeDir := filepath.Join(home, ".claude")
+	if err := os.MkdirAll(filepath.Join(claudeDir, "session-env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(claudeDir, "tokens.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-v", claudeDir + ":/home/dev/.claude"}
+	excludes := []string{"~/.claude/session-env", "~/.claude/tokens.json", "~/.claude/missing", "~/.codex/auth.json"}
+
+	got := mountExcludeArgs(args, excludes, home, false)
+	want := []string{
+		"--mount", "type=tmpfs,destination=/home/dev/.claude/session-env",
+		"-v", "/dev/null:/home/dev/.claude/tokens.json:ro",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mountExcludeArgs() = %v, want %v", got, want)
+	}
+
+	if got := mountExcludeArgs(args, nil, home, false); got != nil {
+		t.Errorf("mountExcludeArgs() with no excludes = %v, want nil", got)
+	}
+}
@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PacknplayIgnoreFile lists workspace paths to hide from the container, one
+// .gitignore pattern per line
+const PacknplayIgnoreFile = ".packnplayignore"
+
+// maxIgnoredPaths bounds how many paths .packnplayignore hides, since each is
+// a mount of its own
+const maxIgnoredPaths = 256
+
+// packnplayIgnore holds .packnplayignore patterns, matched the way git
+// matches .gitignore: a pattern without a slash matches a name at any depth,
+// one with a slash is relative to the workspace root, a trailing slash
+// matches only directories, and ! re-includes what an earlier pattern
+// excluded, unless a parent directory is excluded
+type packnplayIgnore struct {
+	patterns []gitignorePattern
+}
+
+type gitignorePattern struct {
+	re        *regexp.Regexp
+	exception bool
+	dirOnly   bool
+}
+
+// parsePacknplayIgnore parses .packnplayignore content, skipping comments and
+// patterns that don't compile
+func parsePacknplayIgnore(content string) *packnplayIgnore {
+	ignore := &packnplayIgnore{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := trimIgnoreLine(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p gitignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.exception, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		line = strings.TrimPrefix(line, "/")
+		if line == "" || line == "**/" {
+			continue
+		}
+		re, err := regexp.Compile(ignorePatternRegexp(line))
+		if err != nil {
+			continue
+		}
+		p.re = re
+		ignore.patterns = append(ignore.patterns, p)
+	}
+	return ignore
+}
+
+// trimIgnoreLine drops trailing spaces from a pattern, except one escaped
+// with a backslash
+func trimIgnoreLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	trimmed := strings.TrimRight(line, " ")
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	return trimmed
+}
+
+// matches reports whether rel (slash-separated, relative to the workspace
+// root) is excluded by its own patterns; callers skip the contents of excluded
+// directories, so a parent's exclusion can't be undone
+func (ig *packnplayIgnore) matches(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range ig.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			ignored = !p.exception
+		}
+	}
+	return ignored
+}
+
+// ignoredWorkspacePaths returns the host paths in workspaceDir that its
+// .packnplayignore excludes, outermost first, for mountExcludeArgs to hide.
+// .git is never excluded, and symlinks are left alone, since covering one
+// would hide whatever it points to in the container.
+func ignoredWorkspacePaths(workspaceDir string, verbose bool) []string {
+	data, err := os.ReadFile(filepath.Join(workspaceDir, PacknplayIgnoreFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", PacknplayIgnoreFile, err)
+		}
+		return nil
+	}
+	ignore := parsePacknplayIgnore(string(data))
+	if len(ignore.patterns) == 0 {
+		return nil
+	}
+
+	var paths []string
+	truncated := false
+	_ = filepath.WalkDir(workspaceDir, func(path string, entry fs.DirEntry, err error) error {
+		if path == workspaceDir {
+			return err
+		}
+		if err != nil {
+			// Unreadable directories can't be listed, let alone shadowed below
+			return nil
+		}
+		rel, _ := filepath.Rel(workspaceDir, path)
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+		if !ignore.matches(rel, entry.IsDir()) {
+			return nil
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s matches symlink %s, skipping\n", PacknplayIgnoreFile, rel)
+			}
+			return nil
+		}
+		if len(paths) == maxIgnoredPaths {
+			truncated = true
+			return filepath.SkipAll
+		}
+		paths = append(paths, path)
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if truncated {
+		fmt.Fprintf(os.Stderr, "Warning: %s matches more than %d paths; hiding the first %d (exclude their directories instead)\n", PacknplayIgnoreFile, maxIgnoredPaths, maxIgnoredPaths)
+	}
+	return paths
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestPacknplayIgnoreMatches(t *testing.T) {
+	ignore := parsePacknplayIgnore(`# build output
+target/
+/datasets
+*.log
+!keep.log
+docs/**/*.pdf
+\#notes
+` + "trailing\\ \n")
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"target", true, true},
+		{"crates/app/target", true, true},
+		{"target", false, false}, // trailing slash matches only directories
+		{"datasets", true, true},
+		{"src/datasets", true, false}, // leading slash anchors to the root
+		{"debug.log", false, true},
+		{"logs/debug.log", false, true},
+		{"keep.log", false, false},
+		{"docs/a/b/manual.pdf", false, true},
+		{"docs/manual.pdf", false, true},
+		{"manual.pdf", false, false},
+		{"#notes", false, true},
+		{"trailing ", false, true},
+		{"src/main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := ignore.matches(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("matches(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoredWorkspacePaths(t *testing.T) {
+	workspace := t.TempDir()
+	for _, dir := range []string{".git/objects", ".venv/lib", "target/debug", "data", "src"} {
+		if err := os.MkdirAll(filepath.Join(workspace, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"data/big.csv", "data/README", "src/main.go"} {
+		if err := os.WriteFile(filepath.Join(workspace, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(workspace, "data"), filepath.Join(workspace, "data-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ignoredWorkspacePaths(workspace, false); got != nil {
+		t.Errorf("ignoredWorkspacePaths() without %s = %v, want nil", PacknplayIgnoreFile, got)
+	}
+
+	// .git and the symlink are left alone, and nothing is listed below target/
+	ignore := ".git\n.venv/\ntarget\ntarget/debug\ndata/*\n!data/README\ndata-link\n"
+	if err := os.WriteFile(filepath.Join(workspace, PacknplayIgnoreFile), []byte(ignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(workspace, ".venv"),
+		filepath.Join(workspace, "data", "big.csv"),
+		filepath.Join(workspace, "target"),
+	}
+	if got := ignoredWorkspacePaths(workspace, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("ignoredWorkspacePaths() = %v, want %v", got, want)
+	}
+}
+
+func TestRunHidesPacknplayIgnorePaths(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+	mkdirs(t, project, ".venv/lib")
+	if err := os.WriteFile(filepath.Join(project, PacknplayIgnoreFile), []byte(".venv/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := dryRunSpec(t, &RunConfig{Path: project, NoWorktree: true})
+	if want := "type=tmpfs,destination=" + filepath.Join(project, ".venv"); !contains(spec.RunArgs, want) {
+		t.Errorf("docker run args = %v, want .venv covered with %s", spec.RunArgs, want)
+	}
+}
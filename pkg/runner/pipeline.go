@@ -0,0 +1,1446 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/audit"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/contentwatch"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+	"github.com/obra/packnplay/pkg/hooks"
+	"github.com/obra/packnplay/pkg/imagepolicy"
+	"github.com/obra/packnplay/pkg/redact"
+	"github.com/obra/packnplay/pkg/registryauth"
+	"github.com/obra/packnplay/pkg/stats"
+	"github.com/obra/packnplay/pkg/userdetect"
+)
+
+// Run is a pipeline of stages, each taking what the earlier ones resolved:
+//
+//	ResolveWorkspace → ResolveConfig → PrepareImage → BuildRunSpec →
+//	CreateContainer → RunLifecycle → Attach
+//
+// A container that already exists is reused after PrepareImage instead of
+// building a new RunSpec, and a dry run stops after BuildRunSpec.
+
+// Workspace is the host directory a run works in
+type Workspace struct {
+	Provider       string `json:"provider"`                    // WorkspaceProvider that supplied it
+	WorkDir        string `json:"work_dir"`                    // project directory, symlinks resolved
+	MountPath      string `json:"mount_path"`                  // directory mounted as the workspace (the worktree, if any)
+	WorktreeName   string `json:"worktree"`                    // worktree name, or no-worktree
+	MainRepoGitDir string `json:"main_repo_git_dir,omitempty"` // main repo's .git, mounted so a worktree's .git file resolves
+	Subdir         string `json:"subdir,omitempty"`            // directory packnplay was run from, relative to WorkDir, when the devcontainer.json was found in a parent
+
+	// Volume is set with --clone-in-volume and --repo: the repository is
+	// cloned into it inside the container instead of mounting MountPath
+	Volume *container.WorkspaceVolume `json:"volume,omitempty"`
+}
+
+// RunSpec is the container a run creates: everything BuildRunSpec resolved
+// from the workspace, devcontainer.json, features, credentials and flags
+type RunSpec struct {
+	Workspace      Workspace         `json:"workspace"`
+	Runtime        string            `json:"runtime"`
+	ContainerName  string            `json:"container_name"`
+	DevContainerID string            `json:"devcontainer_id"` // value of ${devcontainerId}
+	Image          string            `json:"image"`
+	Platform       string            `json:"platform,omitempty"`
+	RemoteUser     string            `json:"remote_user,omitempty"`
+	RemoteHome     string            `json:"remote_home,omitempty"`   // RemoteUser's home, where credentials and agent configs go
+	AgentVolumes   []AgentVolume     `json:"agent_volumes,omitempty"` // volumes mounted over isolated agents' config dirs
+	WorkingDir     string            `json:"working_dir"`
+	Labels         map[string]string `json:"labels"`
+	RunArgs        []string          `json:"run_args"` // arguments to the runtime CLI, starting with "run"
+	Command        []string          `json:"command"`  // command exec'd as RemoteUser in WorkingDir
+	Services       []Sidecar         `json:"services,omitempty"`
+
+	// ClaudeCredentials is where ~/.claude/.credentials.json comes from
+	ClaudeCredentials ClaudeCredentials `json:"claude_credentials"`
+
+	// Config is the effective devcontainer configuration: devcontainer.json
+	// (or the default) with the features' properties and lifecycle commands merged in
+	Config *devcontainer.Config `json:"config"`
+
+	// Host-side state the later stages need
+	devConfig              *devcontainer.Config
+	lockfile               *devcontainer.LockFile
+	hooks                  hooks.Hooks
+	launchInfo             *container.LaunchInfo
+	homeDir                string
+	isLinux                bool
+	credentialFile         string
+	needsCredentialOverlay bool
+	createRemoteHome       bool // RemoteHome isn't in the image
+	dockerSocket           string
+	dockerFeature          string
+	projectNetwork         string
+	hostname               string
+	pluginRebuilds         []pluginRebuild
+	ghRepo                 string // repository gh credentials are a token minted for
+	ghWithheld             bool   // gh credentials are scoped to a repository but none could be
+}
+
+// hookPayload describes the container to host lifecycle hooks
+func (s *RunSpec) hookPayload(containerID string) hooks.Payload {
+	return hooks.Payload{
+		Container:   s.ContainerName,
+		ContainerID: containerID,
+		Image:       s.Image,
+		Project:     filepath.Base(s.Workspace.WorkDir),
+		Worktree:    s.Workspace.WorktreeName,
+		HostPath:    s.Workspace.MountPath,
+		Runtime:     s.Runtime,
+	}
+}
+
+// ResolveConfig loads the workspace's devcontainer.json, falling back to the
+// configured default image, and rejects combinations packnplay can't run
+func ResolveConfig(config *RunConfig, ws *Workspace) (*devcontainer.Config, error) {
+	configDir := ws.MountPath
+	if config.DryRun && !fileExists(configDir) {
+		// A dry run doesn't create the worktree; it would be checked out from this repository
+		configDir = ws.WorkDir
+	}
+
+	// Load devcontainer config
+	devConfig, err := devcontainer.LoadConfig(configDir)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load devcontainer config: %w", err)
+	}
+	if devConfig == nil {
+		// Use configured default image (supports custom default containers)
+		defaultImage := getConfiguredDefaultImage(config)
+		devConfig = devcontainer.GetDefaultConfig(defaultImage)
+	} else {
+		reportConfigFile(configDir, devConfig.Path(), config.Verbose)
+	}
+
+	// Inline features become ordinary local features, before anything
+	// (including the policy below) looks at the features
+	if err := materializeInlineFeatures(devConfig); err != nil {
+		return nil, err
+	}
+
+	// Detect orchestration mode
+	composeFiles := devConfig.GetDockerComposeFiles()
+	isComposeMode := len(composeFiles) > 0
+	isImageMode := devConfig.Image != ""
+	isDockerfileMode := devConfig.HasDockerfile()
+
+	// Validate mutually exclusive modes
+	if isComposeMode && (isImageMode || isDockerfileMode) {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "dockerComposeFile is mutually exclusive with image/build.dockerfile")
+	}
+
+	// Validate compose + features incompatibility
+	// Features require building a custom image, but compose mode uses pre-built service images
+	if isComposeMode && len(devConfig.Features) > 0 {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "dockerComposeFile does not support devcontainer features - install features in your compose service image instead")
+	}
+	if isComposeMode && config.Ephemeral {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "--ephemeral is not supported with dockerComposeFile configurations")
+	}
+	if isComposeMode && config.DryRun {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "--dry-run is not supported with dockerComposeFile configurations")
+	}
+	if isComposeMode && ws.Volume != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "--clone-in-volume is not supported with dockerComposeFile configurations")
+	}
+	if isComposeMode {
+		if custom, err := devConfig.PacknplayCustomizations(); err == nil && len(custom.Services) > 0 {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "customizations.packnplay.services is not supported with dockerComposeFile configurations - add the services to the compose file instead")
+		}
+	}
+
+	// Enforce the system and user devcontainer policies before anything is
+	// built; BuildRunSpec checks again once features are resolved
+	if err := enforceDevPolicy(devConfig, nil, config.PolicyOverride); err != nil {
+		return nil, err
+	}
+
+	// Clone where devcontainer.json expects the workspace, so the working
+	// directory logic of every later stage finds it
+	if ws.Volume != nil {
+		if devConfig.WorkspaceFolder != "" {
+			ws.Volume.Target = devConfig.WorkspaceFolder
+		} else {
+			devConfig.WorkspaceFolder = ws.Volume.Target
+		}
+	}
+
+	return devConfig, nil
+}
+
+// PrepareImage makes the container image available, pulling or building it as
+// needed, fills in remoteUser from a built image, and returns the image name.
+// A dry run only works out the name.
+func PrepareImage(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, recorder *stats.Recorder) (string, error) {
+	imageName, err := ensureImage(dockerClient, config, ws, devConfig, lockfile, recorder)
+	if err != nil || config.DryRun {
+		return imageName, err
+	}
+
+	// Detect RemoteUser if not specified and we built from Dockerfile or features
+	if devConfig.RemoteUser == "" && (devConfig.HasDockerfile() || len(devConfig.Features) > 0) {
+		userResult, err := userdetect.DetectContainerUser(imageName, &userdetect.DevcontainerConfig{
+			RemoteUser:   devConfig.RemoteUser,
+			UserEnvProbe: devConfig.UserEnvProbe,
+		})
+		if err != nil {
+			// If detection fails, fall back to root
+			devConfig.RemoteUser = "root"
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to detect user from built image, using root: %v\n", err)
+			}
+		} else {
+			devConfig.RemoteUser = userResult.User
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Detected user %s from built image\n", devConfig.RemoteUser)
+			}
+		}
+	}
+
+	return imageName, nil
+}
+
+// ensureImage pulls or builds the container image, with its features, and
+// returns its name, without starting anything
+func ensureImage(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, recorder *stats.Recorder) (string, error) {
+	workDir, mountPath := ws.WorkDir, ws.MountPath
+
+	platform := resolvePlatform(config.Platform, devConfig)
+	warnIfEmulated(platform)
+	imageName := projectImageName(devConfig, workDir)
+	mirrors, err := registryMirrors(config.Registry)
+	if err != nil {
+		return "", err
+	}
+	if config.DryRun {
+		// Detecting the user needs the built image; a dry run doesn't build it
+		if devConfig.RemoteUser == "" && (devConfig.HasDockerfile() || len(devConfig.Features) > 0) {
+			fmt.Fprintf(os.Stderr, "Note: remoteUser is detected from the built image at run time; assuming root\n")
+			devConfig.RemoteUser = "root"
+		}
+		return imageName, nil
+	}
+
+	if c, ok := dockerClient.(pullTimeoutSetter); ok {
+		c.SetPullTimeout(config.PullTimeout)
+	}
+	imageManager := NewImageManager(dockerClient, config.Verbose)
+	imageManager.SetPlatform(platform)
+	imageManager.SetSkipFeatureValidation(config.SkipFeatureValidation)
+	imageManager.SetRecorder(recorder)
+	imageManager.SetEvents(config.Events)
+	imageManager.SetRefresh(config.RefreshImage, config.NoBuildCache)
+	imageManager.SetMirrors(mirrors)
+	proxySettings, err := resolveProxy(config, devConfig)
+	if err != nil {
+		return "", err
+	}
+	imageManager.SetProxy(proxySettings.ForRuntime(dockerClient.Command()))
+	imageManager.SetCredentialStore(config.CredentialStore)
+	imageManager.SetBuildSecrets(config.BuildSecrets)
+	if config.BuildContextWarnMB != 0 {
+		imageManager.SetContextWarnSize(config.BuildContextWarnMB)
+	}
+	policy, err := imagepolicy.Load(imagepolicy.DefaultPath())
+	if err != nil {
+		return "", err
+	}
+	imageManager.SetVerifier(imagepolicy.NewVerifier(policy))
+	if !config.NoRegistryLogin {
+		imageManager.SetRegistryAuth(registryauth.NewHelper(dockerClient.Command()))
+	}
+	if err := imageManager.EnsureAvailableWithLockfile(devConfig, mountPath, lockfile); err != nil {
+		return "", fmt.Errorf("failed to ensure image: %w", err)
+	}
+	if imageName != devConfig.Image {
+		container.RecordLastUsed(container.ImagesLastUsedPath(), imageName, time.Now())
+	}
+	if devConfig.Image != "" && !mirrors.Offline {
+		if err := checkAndNotifyAboutUpdates(dockerClient, devConfig.Image, config.Verbose); err != nil && config.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: update check failed: %v\n", err)
+		}
+	}
+	return imageName, nil
+}
+
+// projectImageName is the image a project's containers are created from: the
+// one packnplay builds when there is a Dockerfile or features, else the image
+// devcontainer.json names
+func projectImageName(devConfig *devcontainer.Config, workDir string) string {
+	if devConfig.HasDockerfile() || len(devConfig.Features) > 0 {
+		return container.GenerateImageName(workDir)
+	}
+	return devConfig.Image
+}
+
+// reuseExistingContainer execs into the workspace's container if it is running
+// (with --reconnect) or can be restarted. It reports whether it handled the run.
+func reuseExistingContainer(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, imageName string, recorder *stats.Recorder, runStart time.Time) (bool, error) {
+	containerName := container.GenerateContainerName(ws.WorkDir, ws.WorktreeName)
+	settings := effectiveSettings(config, devConfig, lockfile, imageName)
+	if err := checkContainerWorktree(dockerClient, containerName, ws.WorktreeName); err != nil {
+		return true, err
+	}
+
+	if isRunning, err := containerIsRunning(dockerClient, containerName); err != nil {
+		return true, errdefs.Errorf(errdefs.CategoryContainer, "failed to check container status: %w", err)
+	} else if isRunning {
+		// Container is running - check if user wants to reconnect.
+		// A persistent session is meant to be re-entered, so it implies --reconnect.
+		if !config.Reconnect && !config.PersistSession {
+			return true, containerRunningError(dockerClient, config, ws, containerName)
+		}
+
+		// User explicitly wants to reconnect
+		if warning := ignoredCreationFlags(config); warning != "" {
+			fmt.Fprintln(os.Stderr, warning)
+		}
+		if recreate, err := checkConfigDrift(dockerClient, config.ConfigDrift, containerName, settings, terminalConfirm(), config.Verbose); err != nil || recreate {
+			return !recreate, err
+		}
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Reconnecting to existing container %s\n", containerName)
+		}
+
+		// Verify the container is actually healthy before reconnecting; this also
+		// resolves the full container ID so lifecycle metadata lines up with creation
+		containerID, restarted, err := ensureContainerHealthy(dockerClient, containerName, config.Verbose)
+		if err != nil {
+			return true, errdefs.Errorf(errdefs.CategoryContainer, "container %s is unhealthy: %w\nTo recreate it: packnplay stop %s", containerName, err, containerName)
+		}
+		if restarted && config.Verbose {
+			fmt.Fprintf(os.Stderr, "Restarted container %s\n", containerName)
+		}
+		// A restart policy may have restarted it since the last run, after a
+		// reboot or daemon restart; that needs what packnplay's own restart does
+		if recordContainerStart(dockerClient, containerID, config.Verbose) && !restarted {
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Container %s was restarted by %s since the last run\n", containerName, dockerClient.Command())
+			}
+			restarted = true
+		}
+		reused := events.Event{Type: events.TypeContainerReused, Container: containerName, ContainerID: containerID, Status: "running"}
+		if restarted {
+			reused.Status = "restarted"
+		}
+		config.Events.Emit(reused)
+
+		return true, resumeAndAttach(dockerClient, config, ws, devConfig, lockfile, imageName, recorder, containerName, containerID, restarted, stats.PhaseReconnect, runStart)
+	}
+
+	// Check for stopped container with same name and try to restart it
+	// NOTE: Container restart preserves container state (files, environment variables,
+	// installed packages) but does NOT update creation-time configuration such as:
+	// - Port mappings (-p flags)
+	// - Volume mounts (-v flags)
+	// - Environment variables (-e flags)
+	// - Network settings
+	// To apply new configuration from devcontainer.json or CLI flags, you must
+	// stop and remove the container first with: packnplay stop <container-name>
+	if config.Verbose {
+		fmt.Fprintf(os.Stderr, "Checking for stopped container with same name...\n")
+	}
+
+	// Check if a container with this name exists (running or stopped)
+	existingID, err := dockerClient.Run("ps", "-aq", "--filter", fmt.Sprintf("name=^%s$", containerName))
+	existingID = strings.TrimSpace(existingID)
+
+	if err == nil && existingID != "" {
+		// Container exists - check if it's stopped
+		runningCheck, err := dockerClient.Run("ps", "-q", "--filter", fmt.Sprintf("name=^%s$", containerName))
+		runningCheck = strings.TrimSpace(runningCheck)
+
+		if err == nil && runningCheck == "" {
+			// Container exists but is not running - try to restart it
+			if warning := ignoredCreationFlags(config); warning != "" {
+				fmt.Fprintln(os.Stderr, warning)
+			}
+			if recreate, err := checkConfigDrift(dockerClient, config.ConfigDrift, containerName, settings, terminalConfirm(), config.Verbose); err != nil || recreate {
+				return !recreate, err
+			}
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Found stopped container %s, attempting to restart...\n", containerName)
+			}
+
+			restartErr := runtimeBackend(dockerClient).Start(dockerClient, existingID)
+			var containerID string
+			if restartErr == nil {
+				// Make sure the keep-alive process survived the restart
+				containerID, _, restartErr = ensureContainerHealthy(dockerClient, containerName, config.Verbose)
+			}
+			if restartErr == nil {
+				recordContainerStart(dockerClient, containerID, config.Verbose)
+			}
+			if restartErr == nil {
+				// Successfully restarted - use the existing container
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Successfully restarted container %s\n", containerName)
+				}
+				config.Events.Emit(events.Event{Type: events.TypeContainerReused, Container: containerName, ContainerID: containerID, Status: "restarted"})
+				return true, resumeAndAttach(dockerClient, config, ws, devConfig, lockfile, imageName, recorder, containerName, containerID, true, stats.PhaseStartup, runStart)
+			}
+
+			// Restart failed - log and fall through to recreation
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Failed to restart container: %v\nWill remove and recreate: %s\n", restartErr, containerName)
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// containerRunningError explains that the workspace's container is already
+// running, and how to run the command in it or stop it
+func containerRunningError(dockerClient DockerClient, config *RunConfig, ws *Workspace, containerName string) error {
+	// Get detailed container information
+	details, err := getContainerDetails(dockerClient, containerName)
+	if err != nil {
+		// Fallback to basic error if we can't get details
+		return fmt.Errorf("container already running for this worktree (unable to get details: %v)", err)
+	}
+
+	// Build command string
+	var cmdStr strings.Builder
+	for i, arg := range config.Command {
+		if i > 0 {
+			cmdStr.WriteString(" ")
+		}
+		if strings.Contains(arg, " ") {
+			cmdStr.WriteString(fmt.Sprintf("'%s'", arg))
+		} else {
+			cmdStr.WriteString(arg)
+		}
+	}
+
+	// Determine current working directory
+	currentDir, err := os.Getwd()
+	if err != nil {
+		currentDir = ""
+	} else {
+		// Make absolute for comparison
+		currentDir, _ = filepath.Abs(currentDir)
+	}
+
+	// Determine if we need worktree flag (if current dir doesn't match container's host path)
+	needWorktreeFlag := true
+	if currentDir != "" && details.HostPath != "" {
+		// If current directory matches container's host path, we don't need --worktree
+		needWorktreeFlag = currentDir != details.HostPath
+	}
+
+	worktreeFlag := ""
+	if config.Repo != "" {
+		worktreeFlag = " --repo " + config.Repo
+		if config.Branch != "" {
+			worktreeFlag += " --branch " + config.Branch
+		}
+	} else if ws.Volume != nil {
+		worktreeFlag = " --clone-in-volume"
+		if ws.Volume.Ref != "" {
+			worktreeFlag += "=" + ws.Volume.Ref
+		}
+	} else if needWorktreeFlag && ws.WorktreeName != "no-worktree" {
+		worktreeFlag = fmt.Sprintf(" --worktree=%s", ws.WorktreeName)
+	}
+
+	// Build detailed error message
+	errorMsg := "container already running for this worktree\n\n"
+	errorMsg += "Container Details:\n"
+	errorMsg += fmt.Sprintf("  Name: %s\n", details.Names)
+	errorMsg += fmt.Sprintf("  Status: %s\n", details.Status)
+	errorMsg += fmt.Sprintf("  Project: %s\n", details.Project)
+	errorMsg += fmt.Sprintf("  Worktree: %s\n", details.Worktree)
+	if details.HostPath != "" {
+		errorMsg += fmt.Sprintf("  Host Path: %s\n", details.HostPath)
+	}
+	if details.LaunchCommand != "" {
+		errorMsg += fmt.Sprintf("  Original Command: %s\n", details.LaunchCommand)
+	}
+
+	errorMsg += "\nTo run your command in the existing container:\n"
+	errorMsg += fmt.Sprintf("  packnplay run%s --reconnect %s\n", worktreeFlag, cmdStr.String())
+	errorMsg += "\nTo stop the existing container:\n"
+	errorMsg += fmt.Sprintf("  packnplay stop %s", details.Names)
+
+	return errdefs.Errorf(errdefs.CategoryContainer, "%s", errorMsg)
+}
+
+// resumeAndAttach brings a reused container's services back, finishes or
+// refreshes its lifecycle commands, and attaches (or detaches) the session.
+// restarted is set when the container started since the last run, which
+// needs credentials resumed and postStartCommand run again; phase is the stats
+// phase the time until then is recorded under.
+func resumeAndAttach(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, imageName string, recorder *stats.Recorder, containerName, containerID string, restarted bool, phase string, runStart time.Time) error {
+	// The bridge daemon exits with the container; bring it back if this container uses it
+	if err := resumeHostBridge(dockerClient, containerName); err != nil && config.Verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to resume host bridge: %v\n", err)
+	}
+	if err := resumeSSHServer(dockerClient, containerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to restart SSH server: %v\n", err)
+	}
+	if err := resumeSidecars(dockerClient, containerName); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if restarted {
+		if err := resumeGHCredentials(dockerClient, containerName, config.GitHub, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		if err := resumeInjectedCredentials(dockerClient, containerID, devConfig.RemoteUser, config.Credentials, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	if config.interrupts.Interrupted() {
+		return interruptedError("while reconnecting to %s; it keeps running", containerName)
+	}
+
+	// Respect workspaceFolder from devcontainer.json, as container creation does
+	mountPath := ws.MountPath
+	workingDir := mountPath
+	if devConfig.WorkspaceFolder != "" {
+		workingDir = devConfig.WorkspaceFolder
+	}
+
+	// remoteEnv was resolved when the container was created; pick up host changes since
+	remoteEnv := refreshRemoteEnv(dockerClient, containerID, devConfig, mountPath, workingDir, config.Verbose)
+
+	// Finish the lifecycle commands of an interrupted creation; otherwise rerun
+	// (or suggest) updateContentCommand after dependency changes, and keep
+	// watching for more
+	if resumed, err := resumeCreation(dockerClient, config, ws, devConfig, lockfile, imageName, containerName, containerID, workingDir, recorder); err != nil {
+		return err
+	} else if !resumed {
+		applyContentChanges(dockerClient, containerName, containerID, devConfig, workingDir, remoteEnv, config.Verbose)
+		startContentWatch(config, ws, devConfig, containerName)
+
+		// Run postStart command if defined and the container started since it last ran
+		if err := executePostStart(dockerClient, containerID, containerName, ws.WorkDir, devConfig, workingDir, remoteEnv, config.Events, config.Verbose); err != nil {
+			return err
+		}
+	}
+	// A Ctrl-C during postStart or content changes stops before attaching
+	if config.interrupts.Interrupted() {
+		return interruptedError("while reconnecting to %s; it keeps running", containerName)
+	}
+	config.interrupts.Stop()
+
+	// Exec into the container with the user's command
+	recorder.Record(phase, time.Since(runStart), false)
+	container.RecordLastUsed(container.LastUsedPath(), containerName, time.Now())
+	sessionDir := ws.sessionDir(workingDir)
+	if config.Detach {
+		return detachFromContainer(config, dockerClient, containerID, devConfig.RemoteUser, sessionDir, remoteEnv)
+	}
+	if err := RunContainerHook(dockerClient, containerName, hooks.PreAttach, config.Verbose); err != nil {
+		return errdefs.Errorf(errdefs.CategoryLifecycle, "%w", err)
+	}
+	command := sessionCommand(config, dockerClient, containerID, sessionDir)
+	config.Events.Emit(events.Event{Type: events.TypeExecStarted, Container: containerName, ContainerID: containerID, Args: command})
+	RecordAudit(audit.Event{Type: audit.TypeExec, Project: ws.WorkDir, Container: containerName, Argv: command})
+	return execIntoContainer(dockerClient, containerID, devConfig.RemoteUser, sessionDir, append(remoteEnv, config.ExecEnv...), command, devConfig.ShouldOverrideCommand(), devConfig.ShutdownAction, nil, "", newExecTimeout(config), config.Reattach)
+}
+
+// BuildRunSpec works out the container to create: its name, labels, mounts,
+// environment, ports, security options and feature properties. Apart from
+// starting the host bridge, preparing credential files and running an AWS
+// credential_process, all skipped in a dry run, it changes nothing on the host
+// or in the runtime.
+func BuildRunSpec(dockerClient DockerClient, config *RunConfig, ws *Workspace, devConfig *devcontainer.Config, lockfile *devcontainer.LockFile, imageName string) (spec *RunSpec, err error) {
+	workDir, mountPath, worktreeName, mainRepoGitDir := ws.WorkDir, ws.MountPath, ws.WorktreeName, ws.MainRepoGitDir
+	platform := resolvePlatform(config.Platform, devConfig)
+	backend := runtimeBackend(dockerClient)
+	supports := backend.Capabilities()
+
+	projectName := filepath.Base(workDir)
+	containerName := container.GenerateContainerName(workDir, worktreeName)
+	devcontainerID := devcontainer.DevContainerID(mountPath, devcontainer.ConfigFilePath(mountPath))
+
+	if ws.Volume != nil && !supports.NamedVolumes {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "--clone-in-volume is not supported with %s: it has no named volumes", backend.Name())
+	}
+
+	// Keep the structured command so `packnplay resume` can re-run it exactly
+	var launchInfo *container.LaunchInfo
+	if len(config.LaunchArgs) > 0 && !config.Ephemeral {
+		launchInfo = &container.LaunchInfo{
+			Args:     config.LaunchArgs,
+			Dir:      config.LaunchDir,
+			HostPath: config.HostPath,
+			Worktree: worktreeName,
+			Time:     time.Now(),
+		}
+	}
+
+	metadata := container.Metadata{
+		Project:    projectName,
+		Worktree:   worktreeName,
+		ConfigHash: configHash(devConfig),
+		Launch:     launchInfo,
+		Settings:   effectiveSettings(config, devConfig, lockfile, imageName),
+	}
+	if !config.Ephemeral {
+		metadata.HostPath = config.HostPath
+		metadata.LaunchCommand = config.LaunchCommand
+	}
+	labels, err := metadata.Labels()
+	if err != nil {
+		return nil, err
+	}
+	if config.Ephemeral {
+		labels[LabelEphemeral] = "true"
+	}
+
+	if ws.Volume != nil {
+		labels[container.LabelWorkspaceVolume] = ws.Volume.Name
+	}
+
+	// Host hooks are recorded on the container so stop and attach can run them later
+	runHooks, err := containerHooks(config, devConfig, workDir)
+	if err != nil {
+		return nil, err
+	}
+	if value, err := hooksLabelValue(runHooks, mountPath); err != nil {
+		return nil, err
+	} else if value != "" {
+		labels[HooksLabel] = value
+	}
+
+	// The project's containers share a network and reach each other by worktree name
+	var projectNetwork, hostname string
+	if !config.NoProjectNetwork && !config.Ephemeral && supports.Networks && !networkFromRunArgs(devConfig.RunArgs) {
+		projectNetwork = container.GenerateNetworkName(workDir)
+		hostname = container.GenerateHostname(workDir, worktreeName)
+		labels[ProjectNetworkLabel] = projectNetwork
+	}
+
+	// Get current user and detect OS
+	currentUser, err := lookupCurrentUser()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	// Check if we're on Linux (idmap only supported on Linux)
+	isLinux := os.Getenv("OSTYPE") == "linux-gnu" || fileExists("/proc/version")
+
+	// Note: Credentials are now managed by separate per-container files and watcher daemon
+	// No need for Keychain extraction during container startup
+
+	// Validate host requirements (advisory only - shows warnings but allows container to run)
+	if devConfig.HostRequirements != nil {
+		validateHostRequirements(devConfig.HostRequirements, config.Verbose)
+	}
+
+	// Build docker run command for background container: detached, without TTY
+	// flags (Apple Container doesn't support -it with -d), with signal handling
+	// (Microsoft pattern)
+	args := []string{"run", "-d", "--sig-proxy=false"}
+	if config.Ephemeral {
+		// The runtime removes the container as soon as it stops
+		args = append(args, "--rm")
+	}
+	restartArgs, err := restartPolicyArgs(dockerClient, config, devConfig)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, restartArgs...)
+
+	// Add labels
+	args = append(args, container.LabelsToArgs(labels)...)
+
+	// Record preStopCommand so stop can run it without devcontainer.json
+	preStopArgs, err := preStopLabelArgs(devConfig)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, preStopArgs...)
+
+	// Add port attributes as labels (for IDE integration and metadata)
+	// Forwarded ports without explicit attributes get otherPortsAttributes
+	args = append(args, devConfig.PortAttributeLabelArgs()...)
+
+	// Add name
+	args = append(args, "--name", containerName)
+
+	homeDir := currentUser.HomeDir
+
+	// Decide where the container's Claude credentials come from
+	claudeCreds, credentialFile, err := prepareClaudeCredentials(config, homeDir)
+	if err != nil {
+		return nil, err
+	}
+	needsCredentialOverlay := credentialFile != ""
+	if needsCredentialOverlay && config.Ephemeral && !config.DryRun {
+		// Run removes it when it's done with the container
+		defer func() {
+			if spec == nil {
+				os.Remove(credentialFile)
+			}
+		}()
+	}
+
+	// Everything the remote user's tools read from ~ is mounted under their home
+	remoteHome, createRemoteHome := resolveRemoteHome(dockerClient, config, imageName, devConfig.RemoteUser)
+
+	// Agents whose state is isolated get a volume per container instead of the host's config dir
+	agentVolumes := agentStateVolumes(config.AgentState, containerName, homeDir, remoteHome, config.Ephemeral, supports.NamedVolumes)
+
+	// Set working directory - respect workspaceFolder from devcontainer.json
+	workingDir := mountPath
+	if devConfig.WorkspaceFolder != "" {
+		workingDir = devConfig.WorkspaceFolder
+	}
+
+	b := &runArgsBuilder{
+		dockerClient:   dockerClient,
+		config:         config,
+		ws:             ws,
+		devConfig:      devConfig,
+		supports:       supports,
+		runtimeName:    backend.Name(),
+		containerName:  containerName,
+		devcontainerID: devcontainerID,
+		labels:         labels,
+		homeDir:        homeDir,
+		remoteHome:     remoteHome,
+		workingDir:     workingDir,
+		isLinux:        isLinux,
+	}
+
+	mountArgs, err := b.mountArgs(agentVolumes, credentialFile)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, mountArgs...)
+
+	credentialArgs, ghRepo, ghWithheld, err := b.credentialArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, credentialArgs...)
+
+	serviceArgs, err := b.hostServiceArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, serviceArgs...)
+
+	// Keep shell history across containers
+	args = append(args, shellBootstrapArgs(config.Shell, supports.NamedVolumes, config.Ephemeral)...)
+
+	networkArgs, sidecars, sidecarEnv, err := b.networkArgs(projectNetwork, hostname)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, networkArgs...)
+
+	socketArgs, dockerSocket, dockerFeature, err := b.runtimeSocketArgs()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, socketArgs...)
+
+	args = append(args, b.toolConfigArgs()...)
+
+	awsArgs, awsCredentials := b.awsCredentialArgs()
+	args = append(args, awsArgs...)
+
+	args = append(args, "-w", workingDir)
+
+	// Sidecars and the project's other containers are reached without the proxy
+	noProxy := make([]string, 0, len(sidecars)+1)
+	for _, sidecar := range sidecars {
+		noProxy = append(noProxy, sidecar.Service)
+	}
+	if hostname != "" {
+		noProxy = append(noProxy, hostname)
+	}
+	envArgs, err := b.envArgs(awsCredentials, sidecarEnv, noProxy)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, envArgs...)
+
+	ports, err := portArgs(devConfig.ForwardPorts, config.PublishPorts)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, ports...)
+
+	args = append(args, b.volumeArgs()...)
+
+	// Add user for container operations (docker run --user)
+	// Use containerUser if specified, otherwise fall back to remoteUser for backward compatibility
+	containerUser := devConfig.ContainerUser
+	if containerUser == "" {
+		containerUser = devConfig.RemoteUser
+	}
+	if containerUser != "" {
+		args = append(args, "--user", containerUser)
+	}
+
+	// Run the image variant for the requested platform (runArgs may already carry it)
+	if platform != "" && platformFromRunArgs(devConfig.RunArgs) == "" {
+		args = append(args, "--platform", platform)
+	}
+
+	runArgs := b.substitutedRunArgs()
+	args = append(args, runArgs...)
+
+	securityArgs, entrypointArgs := securityArgs(devConfig)
+	args = append(args, securityArgs...)
+
+	// Apply feature-contributed container properties (security options, capabilities, etc.)
+	resolvedFeatures, err := b.resolveFeatureProperties(lockfile)
+	if err != nil {
+		return nil, err
+	}
+	args, entrypointArgs = b.featurePropertyArgs(args, resolvedFeatures, dockerSocket, entrypointArgs)
+
+	// Native binaries for another platform in mounted config directories:
+	// plugins rebuilt in the container get a cached node_modules mounted over
+	// theirs, the others may be hidden below
+	foreign, err := checkForeignBinaries(args, config.ForeignBinaries, platform, homeDir, mountPath, config.Verbose)
+	if err != nil {
+		return nil, err
+	}
+	if len(foreign.Rebuilds) > 0 && !config.DryRun {
+		if err := preparePluginCaches(foreign.Rebuilds); err != nil {
+			return nil, errdefs.New(errdefs.CategoryContainer, err)
+		}
+	}
+	args = append(args, pluginRebuildArgs(foreign.Rebuilds)...)
+
+	// Relabel bind mounts and apply the AppArmor profile on LSM-enforcing hosts
+	if supports.SecurityOpts {
+		owned := append([]string{mountPath, mainRepoGitDir}, packnplayDirs(homeDir)...)
+		args = applyMountRelabel(args, effectiveRelabel(config.MountRelabel), owned, config.DisableLabels, config.Verbose)
+		args = append(args, appArmorSecurityOpt(config.AppArmorProfile)...)
+	}
+
+	// Hide excluded subpaths of mounted directories (after relabeling, which must not touch /dev/null),
+	// along with native binaries built for another platform when shadowing them and the workspace
+	// paths .packnplayignore excludes (a clone volume isn't mounted from the host, so it has none)
+	excludes := append(append([]string{}, config.MountExcludes...), foreign.Shadows...)
+	if ws.Volume == nil {
+		excludes = append(excludes, ignoredWorkspacePaths(mountPath, config.Verbose)...)
+	}
+	args = append(args, mountExcludeArgs(args, excludes, homeDir, config.Verbose)...)
+
+	// Add the image and a signal-aware command that keeps the container alive
+	args = append(args, imageName)
+	args = append(args, keepAliveCommand(entrypointArgs)...)
+
+	// The policies checked devcontainer.json before features were resolved;
+	// check what the container is created with: privileges and mounts from
+	// features (local and inline ones included) and runArgs after substitution
+	effective := devConfig.WithFeatures(resolvedFeatures)
+	effective.RunArgs = runArgs
+	for _, feature := range resolvedFeatures {
+		if feature.Metadata != nil && len(feature.Metadata.Entrypoint) > 0 {
+			effective.Entrypoint = feature.Metadata.Entrypoint
+		}
+	}
+	if err := enforceDevPolicy(effective, devConfig, config.PolicyOverride); err != nil {
+		return nil, err
+	}
+
+	return &RunSpec{
+		Workspace:              *ws,
+		Runtime:                dockerClient.Command(),
+		ContainerName:          containerName,
+		DevContainerID:         devcontainerID,
+		Image:                  imageName,
+		Platform:               platform,
+		RemoteUser:             devConfig.RemoteUser,
+		RemoteHome:             remoteHome,
+		AgentVolumes:           agentVolumes,
+		WorkingDir:             workingDir,
+		Labels:                 labels,
+		RunArgs:                args,
+		Command:                config.Command,
+		Services:               sidecars,
+		pluginRebuilds:         foreign.Rebuilds,
+		ghRepo:                 ghRepo,
+		ghWithheld:             ghWithheld,
+		Config:                 devConfig.WithFeatures(resolvedFeatures),
+		devConfig:              devConfig,
+		lockfile:               lockfile,
+		hooks:                  runHooks,
+		launchInfo:             launchInfo,
+		homeDir:                homeDir,
+		isLinux:                isLinux,
+		ClaudeCredentials:      claudeCreds,
+		credentialFile:         credentialFile,
+		needsCredentialOverlay: needsCredentialOverlay,
+		createRemoteHome:       createRemoteHome,
+		dockerSocket:           dockerSocket,
+		dockerFeature:          dockerFeature,
+		projectNetwork:         projectNetwork,
+		hostname:               hostname,
+	}, nil
+}
+
+// CreateContainer starts the container described by spec and prepares it:
+// the workspace's directory structure, copied config files and credentials,
+// and the remote user's UID. It returns the container ID.
+func CreateContainer(dockerClient DockerClient, config *RunConfig, spec *RunSpec) (string, error) {
+	devConfig := spec.devConfig
+	containerName, mountPath, homeDir, isLinux := spec.ContainerName, spec.Workspace.MountPath, spec.homeDir, spec.isLinux
+	dockerSocket, dockerFeature := spec.dockerSocket, spec.dockerFeature
+
+	if err := spec.hooks.Run(hooks.PreCreate, spec.hookPayload(""), config.Verbose); err != nil {
+		return "", errdefs.Errorf(errdefs.CategoryLifecycle, "%w", err)
+	}
+	if volume := spec.Workspace.Volume; volume != nil {
+		if err := ensureWorkspaceVolume(dockerClient, volume, config.Verbose); err != nil {
+			return "", errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+		}
+	}
+	if err := ensureAgentStateVolumes(dockerClient, spec.AgentVolumes, spec.Workspace.WorkDir, config.Verbose); err != nil {
+		return "", errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+	}
+	if config.Verbose {
+		fmt.Fprintf(os.Stderr, "Starting container %s\n", containerName)
+		fmt.Fprintf(os.Stderr, "Full command: docker %v\n", redact.Args(spec.RunArgs))
+	}
+
+	if spec.projectNetwork != "" {
+		if err := ensureProjectNetwork(dockerClient, spec.projectNetwork, filepath.Base(spec.Workspace.WorkDir)); err != nil {
+			return "", errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+		}
+	}
+	if len(spec.Services) > 0 {
+		if err := startSidecars(dockerClient, containerName, spec.Services, config.Verbose); err != nil {
+			return "", errdefs.Errorf(errdefs.CategoryContainer, "%w", err)
+		}
+	}
+
+	containerID, err := runtimeBackend(dockerClient).Create(dockerClient, spec.RunArgs[1:])
+	if err != nil {
+		if len(spec.Services) > 0 {
+			_ = RemoveSidecars(dockerClient, containerName)
+		}
+		_ = ReleaseProjectNetwork(dockerClient, spec.projectNetwork)
+		return "", errdefs.Errorf(errdefs.CategoryContainer, "failed to start container: %w", err)
+	}
+	config.Events.Emit(events.Event{Type: events.TypeContainerCreated, Container: containerName, ContainerID: containerID, Image: spec.Image})
+	RecordAudit(audit.Event{Type: audit.TypeCreate, Project: spec.Workspace.WorkDir, Container: containerName, ContainerID: containerID, Image: spec.Image, Credentials: auditCredentials(config.Credentials, spec.ghRepo, spec.ghWithheld)})
+	if spec.projectNetwork != "" && len(spec.Services) > 0 {
+		if err := connectProjectNetwork(dockerClient, containerID, spec.projectNetwork, spec.hostname); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	// Ensure host directory structure exists in container (a cloned workspace has none)
+	var dirCommands [][]string
+	if spec.Workspace.Volume == nil {
+		dirCommands = generateDirectoryCreationCommands(mountPath)
+	}
+	for _, dirCmd := range dirCommands {
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Creating directory structure: %v\n", dirCmd)
+		}
+		_, err := dockerClient.Run(append([]string{"exec", containerID}, dirCmd...)...)
+		if err != nil {
+			_, _ = dockerClient.Run("rm", "-f", containerID)
+			return "", fmt.Errorf("failed to create directory structure: %w", err)
+		}
+	}
+
+	// A numeric remoteUser without a passwd entry has no home in the image;
+	// mounts under it leave one owned by root
+	if spec.createRemoteHome {
+		if err := ensureRemoteHome(dockerClient, containerID, devConfig.RemoteUser, spec.RemoteHome); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	if err := seedAgentStateVolumes(dockerClient, containerID, devConfig.RemoteUser, spec.AgentVolumes, config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if !config.Ephemeral {
+		recordContainerStart(dockerClient, containerID, config.Verbose)
+	}
+
+	// Copy config files into container
+
+	// Copy ~/.claude.json
+	claudeConfigSrc := filepath.Join(homeDir, ".claude.json")
+	if _, err := os.Stat(claudeConfigSrc); err == nil {
+		if err := copyFileToContainer(dockerClient, containerID, claudeConfigSrc, spec.RemoteHome+"/.claude.json", devConfig.RemoteUser, config.Verbose); err != nil {
+			_, _ = dockerClient.Run("rm", "-f", containerID)
+			return "", fmt.Errorf("failed to copy .claude.json: %w", err)
+		}
+	}
+
+	// Copy container-managed credentials into place if needed (host has no .credentials.json)
+	hostCredFile2 := filepath.Join(homeDir, ".claude", ".credentials.json")
+	if !fileExists(hostCredFile2) {
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Copying container credentials into .claude directory...\n")
+		}
+		// Copy from mounted temp location to .claude directory
+		_, err = dockerClient.Run("exec", containerID, "cp", "/tmp/packnplay-credentials.json", spec.RemoteHome+"/.claude/.credentials.json")
+		if err != nil && config.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to copy credentials: %v\n", err)
+		}
+	}
+
+	// Copy SSH config into container when using SSH agent forwarding
+	if config.Credentials.SSHAgent {
+		sshConfig := filepath.Join(homeDir, ".ssh", "config")
+		if fileExists(sshConfig) {
+			dstDir := spec.RemoteHome + "/.ssh"
+			// Create .ssh dir with correct ownership and permissions
+			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "mkdir", "-p", dstDir)
+			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chown", userOwner(devConfig.RemoteUser), dstDir)
+			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chmod", "700", dstDir)
+			if err := copyFileToContainer(dockerClient, containerID, sshConfig, dstDir+"/config", devConfig.RemoteUser, config.Verbose); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to copy SSH config: %v\n", err)
+			}
+		}
+	}
+
+	// Bridge gh credentials from Keychain on macOS (Linux mounts ~/.config/gh instead),
+	// or a token minted for the repository
+	if spec.ghRepo != "" {
+		if err := injectRepoGHToken(dockerClient, containerID, devConfig.RemoteUser, config.GitHub, spec.ghRepo, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: GitHub CLI credentials not available in container: %v\n", err)
+		}
+	} else if config.Credentials.GH && !isLinux && !spec.ghWithheld {
+		if err := injectGHCredentials(dockerClient, containerID, devConfig.RemoteUser, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: GitHub CLI credentials not available in container: %v\n", err)
+		}
+	}
+
+	// Copy sanitized credentials for types configured with copy injection
+	if err := injectCredentials(dockerClient, containerID, homeDir, devConfig.RemoteUser, spec.RemoteHome, config.Credentials, config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if config.HostBridge && runtimeSupports(dockerClient).SocketMounts {
+		if err := installHostBridgeShim(dockerClient, containerID, config.HostBridgeActions, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	if config.SSH {
+		if err := ensureSSHServer(dockerClient, containerID, devConfig.RemoteUser, homeDir, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: SSH server unavailable: %v\n", err)
+		} else {
+			printSSHConfig(dockerClient, containerID, spec.ContainerName, devConfig.RemoteUser)
+		}
+	}
+
+	if dockerSocket != "" && dockerFeature != "outside" && !isLinux && devConfig.RemoteUser != "" && devConfig.RemoteUser != "root" {
+		fixArgs := append([]string{"exec", "-u", "root", containerID}, fixDockerSocketCommand(defaultDockerSocket, devConfig.RemoteUser)...)
+		if _, err := dockerClient.Run(fixArgs...); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to grant %s access to the docker socket: %v\n", devConfig.RemoteUser, err)
+		}
+	}
+
+	// Update remote user UID/GID to match host (Linux only)
+	// This prevents permission issues with mounted volumes
+	if devConfig.UpdateRemoteUserUID && devConfig.RemoteUser != "" && devConfig.RemoteUser != "root" && !isNumericUser(devConfig.RemoteUser) {
+		if err := updateRemoteUserUID(dockerClient, containerID, devConfig.RemoteUser, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update remote user UID/GID: %v\n", err)
+			// Continue anyway - this is not a fatal error
+		}
+	}
+
+	// Give the remote user's shell a prompt, history and aliases
+	if !config.Shell.Disabled {
+		if err := installShellBootstrap(dockerClient, containerID, devConfig.RemoteUser, config.Shell, filepath.Base(spec.Workspace.WorkDir), spec.Workspace.WorktreeName, config.Verbose); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+
+	// Rebuild mounted plugins' native modules for the container, once per plugin version
+	rebuildPlugins(dockerClient, containerID, devConfig.RemoteUser, spec.pluginRebuilds, config.Verbose)
+
+	// Clone last, with the credentials set up above and the remote user's final UID
+	if volume := spec.Workspace.Volume; volume != nil {
+		if err := cloneIntoVolume(dockerClient, containerID, devConfig.RemoteUser, volume, config.Credentials.GH, config.Verbose); err != nil {
+			_, _ = dockerClient.Run("rm", "-f", containerID)
+			return "", errdefs.Errorf(errdefs.CategoryWorktree, "%w", err)
+		}
+		recordWorkspaceVolume(volume, config.Verbose)
+	}
+
+	// Make sure the user can work in the workspace before lifecycle commands run in it
+	if err := checkWorkspaceOwnership(dockerClient, config.WorkspaceOwnership, containerID, devConfig.RemoteUser, spec.WorkingDir, spec.Workspace.Volume != nil, config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return containerID, nil
+}
+
+// RunLifecycle runs devcontainer.json's and the features' lifecycle commands in
+// a newly created container, then the host post-create hooks
+func RunLifecycle(dockerClient DockerClient, config *RunConfig, spec *RunSpec, containerID string, recorder *stats.Recorder) error {
+	devConfig, lockfile := spec.devConfig, spec.lockfile
+	mountPath, workingDir := spec.Workspace.MountPath, spec.WorkingDir
+
+	// Commands are tracked: onCreate/postCreate run once, postStart once per start
+	// Feature lifecycle commands execute before user commands per specification
+	//
+	// IMPORTANT: All lifecycle commands execute synchronously in order before the user
+	// command runs. This implicitly honors the waitFor property - the container is only
+	// considered ready after all lifecycle commands complete. The waitFor property is
+	// primarily informational for editors that might run commands in the background.
+	hasLifecycleCommands := devConfig.OnCreateCommand != nil || devConfig.UpdateContentCommand != nil || devConfig.PostCreateCommand != nil || devConfig.PostStartCommand != nil
+	hasFeatures := len(devConfig.Features) > 0
+
+	if hasLifecycleCommands || hasFeatures {
+		// Load metadata for tracking lifecycle execution (ephemeral containers keep none)
+		var metadata *ContainerMetadata
+		var err error
+		if !config.Ephemeral {
+			metadata, err = LoadMetadata(containerID)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load metadata, commands will run: %v\n", err)
+			// Continue with nil metadata - commands will run but not be tracked
+			metadata = nil
+		}
+		if metadata != nil {
+			// Until every command ran, so the next run resumes an interrupted creation
+			metadata.Incomplete = true
+			if err := SaveMetadata(metadata); err != nil && config.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to save metadata: %v\n", err)
+			}
+		}
+
+		executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.LifecycleUser(), config.Verbose, metadata)
+		executor.SetRecorder(recorder)
+		executor.SetEvents(config.Events)
+		executor.SetAudit(spec.Workspace.WorkDir, spec.ContainerName)
+		executor.SetWorkingDir(workingDir)
+		executor.SetEnv(refreshRemoteEnv(dockerClient, containerID, devConfig, mountPath, workingDir, false))
+		executor.SetTaskPolicy(lifecycleTaskPolicy(devConfig))
+		executor.SetShell(lifecycleShell(devConfig))
+
+		// Resolve features and merge lifecycle commands if features exist
+		var mergedCommands map[string]*devcontainer.LifecycleCommand
+		if hasFeatures {
+			// Resolve features for lifecycle merging
+			// Use the same lockfile loaded earlier to ensure consistent feature versions
+			mirrors, err := registryMirrors(config.Registry)
+			if err != nil {
+				return err
+			}
+			resolver := devcontainer.NewFeatureResolver(filepath.Join(os.TempDir(), "packnplay-features-cache"), lockfile)
+			resolver.SetSkipOptionValidation(config.SkipFeatureValidation)
+			resolver.SetMirrors(mirrors)
+
+			var resolvedFeatures []*devcontainer.ResolvedFeature
+			for reference, options := range devConfig.Features {
+				// Convert options from map[string]interface{} if needed
+				optionsMap, ok := options.(map[string]interface{})
+				if !ok {
+					if config.Verbose {
+						fmt.Fprintf(os.Stderr, "Warning: skipping feature %s with invalid options type\n", reference)
+					}
+					continue
+				}
+
+				feature, err := resolver.ResolveFeature(featureSourcePath(mountPath, reference), optionsMap)
+				if err != nil {
+					if config.Verbose {
+						fmt.Fprintf(os.Stderr, "Warning: failed to resolve feature %s for lifecycle: %v\n", reference, err)
+					}
+					continue
+				}
+				resolvedFeatures = append(resolvedFeatures, feature)
+			}
+
+			// Merge feature and user lifecycle commands
+			if len(resolvedFeatures) > 0 {
+				merger := devcontainer.NewLifecycleMerger()
+				userCommands := map[string]*devcontainer.LifecycleCommand{
+					"onCreateCommand":      devConfig.OnCreateCommand,
+					"updateContentCommand": devConfig.UpdateContentCommand,
+					"postCreateCommand":    devConfig.PostCreateCommand,
+					"postStartCommand":     devConfig.PostStartCommand,
+				}
+				mergedCommands = merger.MergeCommands(resolvedFeatures, userCommands)
+			}
+		}
+
+		// Use merged commands if available, otherwise use user commands directly
+		onCreateCmd := devConfig.OnCreateCommand
+		updateContentCmd := devConfig.UpdateContentCommand
+		postCreateCmd := devConfig.PostCreateCommand
+		postStartCmd := devConfig.PostStartCommand
+
+		if mergedCommands != nil {
+			if cmd, exists := mergedCommands["onCreateCommand"]; exists {
+				onCreateCmd = cmd
+			}
+			if cmd, exists := mergedCommands["updateContentCommand"]; exists {
+				updateContentCmd = cmd
+			}
+			if cmd, exists := mergedCommands["postCreateCommand"]; exists {
+				postCreateCmd = cmd
+			}
+			if cmd, exists := mergedCommands["postStartCommand"]; exists {
+				postStartCmd = cmd
+			}
+		}
+
+		// onCreateCommand and postCreateCommand run once on creation, and again
+		// if the command changes; updateContentCommand runs after workspace
+		// content is mounted (e.g., 'npm install'), likewise once; and
+		// postStartCommand runs every time the container starts. An interrupt
+		// stops before the next command.
+		phases := []struct {
+			name string
+			cmd  *devcontainer.LifecycleCommand
+		}{
+			{"onCreate", onCreateCmd},
+			{"updateContent", updateContentCmd},
+			{"postCreate", postCreateCmd},
+			{"postStart", postStartCmd},
+		}
+		for _, phase := range phases {
+			if phase.cmd == nil {
+				continue
+			}
+			if config.interrupts.Interrupted() {
+				break
+			}
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Running %sCommand...\n", phase.name)
+			}
+			if err := executor.Execute(phase.name, phase.cmd); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %sCommand failed: %v\n", phase.name, err)
+			}
+		}
+		interrupted := config.interrupts.Interrupted()
+
+		// Save metadata after lifecycle execution
+		if metadata != nil {
+			metadata.Incomplete = interrupted
+			if err := SaveMetadata(metadata); err != nil {
+				// Warn but don't fail container startup
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Warning: failed to save metadata: %v\n", err)
+				}
+			}
+		}
+		if interrupted {
+			if config.Ephemeral {
+				return interruptedError("while running lifecycle commands")
+			}
+			return interruptedError("while running lifecycle commands; the next packnplay run resumes them in %s (or discard it: packnplay stop %s)", spec.ContainerName, spec.ContainerName)
+		}
+
+		// Validate and log waitFor property
+		// Since we execute synchronously, all commands complete before proceeding.
+		// This validates the property is set correctly and provides transparency.
+		if devConfig.WaitFor != "" {
+			validCommands := map[string]bool{
+				"onCreateCommand":      true,
+				"updateContentCommand": true,
+				"postCreateCommand":    true,
+				"postStartCommand":     true,
+			}
+			if !validCommands[devConfig.WaitFor] {
+				fmt.Fprintf(os.Stderr, "Warning: waitFor value '%s' is not a valid lifecycle command\n", devConfig.WaitFor)
+			} else if config.Verbose {
+				fmt.Fprintf(os.Stderr, "waitFor: %s (completed synchronously)\n", devConfig.WaitFor)
+			}
+		}
+	}
+
+	// updateContentCommand just ran in the new container, so earlier changes are moot
+	if !config.DryRun && !config.Ephemeral {
+		_ = contentwatch.Clear(spec.ContainerName)
+	}
+	startContentWatch(config, &spec.Workspace, devConfig, spec.ContainerName)
+
+	if err := spec.hooks.Run(hooks.PostCreate, spec.hookPayload(containerID), config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return nil
+}
+
+// Attach records the launch and execs the user's command in the container,
+// replacing this process (or runs it in the background with --detach)
+func Attach(dockerClient DockerClient, config *RunConfig, spec *RunSpec, containerID string) error {
+	devConfig := spec.devConfig
+	containerName, launchInfo, workingDir := spec.ContainerName, spec.launchInfo, spec.WorkingDir
+	// From here on, signals go to the user's command
+	config.interrupts.Stop()
+
+	if !config.Ephemeral {
+		container.RecordLastUsed(container.LastUsedPath(), containerName, time.Now())
+	}
+	if launchInfo != nil {
+		if err := container.RecordLaunch(container.LaunchesPath(), containerName, *launchInfo); err != nil && config.Verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record launch command: %v\n", err)
+		}
+	}
+	workingDir = spec.Workspace.sessionDir(workingDir)
+	if config.Detach {
+		return detachFromContainer(config, dockerClient, containerID, devConfig.RemoteUser, workingDir, nil)
+	}
+	cmdPath, err := lookPath(dockerClient.Command())
+	if err != nil {
+		return fmt.Errorf("failed to find docker command: %w", err)
+	}
+
+	execArgs := []string{filepath.Base(cmdPath), "exec"}
+	execArgs = append(execArgs, getTTYFlags()...)
+
+	// Add user flag to exec if remoteUser is specified
+	if devConfig.RemoteUser != "" {
+		execArgs = append(execArgs, "--user", devConfig.RemoteUser)
+	}
+
+	execArgs = append(execArgs, "-w", workingDir, containerID)
+	command := sessionCommand(config, dockerClient, containerID, workingDir)
+	timeout := newExecTimeout(config)
+	if timeout != nil {
+		execArgs = append(execArgs, timeout.wrap(command)...)
+	} else {
+		execArgs = append(execArgs, command...)
+	}
+
+	hookPayload := spec.hookPayload(containerID)
+	if err := spec.hooks.Run(hooks.PreAttach, hookPayload, config.Verbose); err != nil {
+		if !config.Ephemeral {
+			fmt.Fprintf(os.Stderr, "Container %s is still running; stop it with: packnplay stop %s\n", containerName, containerName)
+		}
+		return errdefs.Errorf(errdefs.CategoryLifecycle, "%w", err)
+	}
+
+	config.Events.Emit(events.Event{Type: events.TypeExecStarted, Container: containerName, ContainerID: containerID, Args: command})
+	RecordAudit(audit.Event{Type: audit.TypeExec, Project: spec.Workspace.WorkDir, Container: containerName, Argv: command})
+	if config.Ephemeral {
+		return runEphemeralCommand(dockerClient, containerID, execArgs, timeout, func() {
+			_, _ = dockerClient.Run("rm", "-f", containerID)
+			RecordAudit(audit.Event{Type: audit.TypeRemove, Project: spec.Workspace.WorkDir, Container: containerName, ContainerID: containerID})
+			if len(spec.Services) > 0 {
+				_ = RemoveSidecars(dockerClient, containerName)
+			}
+			if spec.credentialFile != "" && spec.needsCredentialOverlay {
+				os.Remove(spec.credentialFile)
+			}
+			if err := spec.hooks.Run(hooks.PostStop, hookPayload, config.Verbose); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		})
+	}
+
+	if config.Reattach {
+		_, err := superviseSession(dockerClient, containerID, execArgs, func(execArgs []string, containerID string) error {
+			if timeout != nil {
+				return timeout.run(dockerClient, cmdPath, execArgs, containerID)
+			}
+			return runSupervised(cmdPath, execArgs)
+		})
+		return exitWithCommandStatus(err)
+	}
+	if timeout != nil {
+		return exitWithCommandStatus(timeout.run(dockerClient, cmdPath, execArgs, containerID))
+	}
+
+	// Replace the current process
+	return execProcess(cmdPath, execArgs, os.Environ())
+}
+
+// PrintRunSpec writes spec for a dry run, as JSON or as the commands a run would
+// use followed by the effective devcontainer configuration
+func PrintRunSpec(w io.Writer, spec *RunSpec, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(spec, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode run spec: %w", err)
+		}
+		_, err = fmt.Fprintln(w, redact.String(string(data)))
+		return err
+	}
+	command := func(args []string) {
+		fmt.Fprintf(w, "%s\n", shellJoin(redact.Args(args)))
+	}
+
+	fmt.Fprintf(w, "Container: %s\n", spec.ContainerName)
+	fmt.Fprintf(w, "Image:     %s\n", spec.Image)
+	if volume := spec.Workspace.Volume; volume != nil {
+		fmt.Fprintf(w, "Workspace: %s cloned into volume %s at %s\n", volume.CloneURL, volume.Name, volume.Target)
+	} else {
+		fmt.Fprintf(w, "Workspace: %s (worktree: %s)\n", spec.Workspace.MountPath, spec.Workspace.WorktreeName)
+	}
+	if creds := spec.ClaudeCredentials; creds.Source != "" {
+		fmt.Fprintf(w, "Claude:    %s credentials (%s)\n", creds.Source, creds.Reason)
+	}
+	fmt.Fprintf(w, "\nCommands:\n")
+	if spec.projectNetwork != "" {
+		command(append([]string{spec.Runtime}, projectNetworkCreateArgs(spec.projectNetwork, filepath.Base(spec.Workspace.WorkDir))...))
+	}
+	if len(spec.Services) > 0 {
+		command([]string{spec.Runtime, "network", "create", "--label", SidecarOfLabel + "=" + spec.ContainerName, SidecarNetwork(spec.ContainerName)})
+	}
+	for _, sidecar := range spec.Services {
+		command(append([]string{spec.Runtime}, sidecar.RunArgs...))
+	}
+	command(append([]string{spec.Runtime}, spec.RunArgs...))
+	if spec.projectNetwork != "" && len(spec.Services) > 0 {
+		command([]string{spec.Runtime, "network", "connect", "--alias", spec.hostname, spec.projectNetwork, spec.ContainerName})
+	}
+	command(spec.execArgs())
+
+	if spec.Config != nil {
+		data, err := json.MarshalIndent(spec.Config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode effective configuration: %w", err)
+		}
+		fmt.Fprintf(w, "\nEffective configuration:\n%s\n", redact.String(string(data)))
+	}
+	return nil
+}
+
+// execArgs returns the runtime command line that execs the user's command
+func (s *RunSpec) execArgs() []string {
+	args := append([]string{s.Runtime, "exec"}, getTTYFlags()...)
+	if s.RemoteUser != "" {
+		args = append(args, "--user", s.RemoteUser)
+	}
+	args = append(args, "-w", s.Workspace.sessionDir(s.WorkingDir), s.ContainerName)
+	return append(args, s.Command...)
+}
+
+// shellJoin quotes args into a command line that can be pasted into a shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// configHash identifies a resolved devcontainer config, recorded in the
+// container's metadata to tell whether the config changed since creation
+func configHash(devConfig *devcontainer.Config) string {
+	data, err := json.Marshal(devConfig)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
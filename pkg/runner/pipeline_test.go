@@ -0,0 +1,239 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestResolveWorkspaceWithoutWorktree(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	resolved, _ := filepath.EvalSymlinks(dir)
+
+	ws, err := ResolveWorkspace(&RunConfig{Path: link})
+	if err != nil {
+		t.Fatalf("ResolveWorkspace() error = %v", err)
+	}
+	want := Workspace{Provider: ProviderLocalDir, WorkDir: resolved, MountPath: resolved, WorktreeName: "no-worktree"}
+	if *ws != want {
+		t.Errorf("ResolveWorkspace() = %+v, want %+v (a non-git directory is used directly)", *ws, want)
+	}
+
+	if _, err := ResolveWorkspace(&RunConfig{Path: dir, Worktree: "feature"}); err == nil {
+		t.Error("ResolveWorkspace() should reject --worktree outside a git repository")
+	}
+}
+
+func TestResolveConfigRejectsComposeDryRun(t *testing.T) {
+	project := newProject(t, `{"dockerComposeFile": "compose.yml", "service": "app"}`)
+	ws := &Workspace{WorkDir: project, MountPath: project, WorktreeName: "no-worktree"}
+	if _, err := ResolveConfig(&RunConfig{}, ws); err != nil {
+		t.Fatalf("ResolveConfig() error = %v", err)
+	}
+	if _, err := ResolveConfig(&RunConfig{DryRun: true}, ws); err == nil {
+		t.Error("ResolveConfig() should reject a dry run of a compose configuration")
+	}
+}
+
+func TestBuildRunSpec(t *testing.T) {
+	fake := dockertest.New()
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{
+		"image": "node:20",
+		"remoteUser": "node",
+		"workspaceFolder": "/workspace",
+		"workspaceMount": "source=${localWorkspaceFolder},target=/workspace,type=bind",
+		"containerEnv": {"MODE": "dev"},
+		"forwardPorts": [3000],
+		"capAdd": ["SYS_PTRACE"]
+	}`)
+	config := &RunConfig{Path: project, NoWorktree: true, Command: []string{"npm", "test"}, PublishPorts: []string{"9229:9229"}}
+	ws, err := ResolveWorkspace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devConfig, err := ResolveConfig(config, ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := BuildRunSpec(fake, config, ws, devConfig, nil, "node:20")
+	if err != nil {
+		t.Fatalf("BuildRunSpec() error = %v", err)
+	}
+	if spec.RemoteUser != "node" || spec.WorkingDir != "/workspace" || spec.Image != "node:20" {
+		t.Errorf("spec = %+v", spec)
+	}
+	if spec.Labels["managed-by"] != "packnplay" || spec.Labels["packnplay-worktree"] != "no-worktree" {
+		t.Errorf("labels = %v", spec.Labels)
+	}
+	if !contains(spec.RunArgs, "--mount source="+project+",target=/workspace,type=bind", "-e MODE=dev", "-p 127.0.0.1:3000:3000", "-p 9229:9229", "-w /workspace", "--user node", "--cap-add=SYS_PTRACE") {
+		t.Errorf("run args = %v", spec.RunArgs)
+	}
+	if spec.RunArgs[0] != "run" || spec.RunArgs[len(spec.RunArgs)-4] != "node:20" {
+		t.Errorf("run args should start with run and end with the image and keep-alive command: %v", spec.RunArgs)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("BuildRunSpec() should not run anything: %v", fake.Calls())
+	}
+}
+
+func TestBuildRunSpecDevContainerID(t *testing.T) {
+	fake := dockertest.New()
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{
+		"image": "node:20",
+		"remoteUser": "node",
+		"containerEnv": {"CACHE_VOLUME": "cache-${devcontainerId}"},
+		"mounts": ["source=history-${devcontainerId},target=/commandhistory,type=volume"],
+		"runArgs": ["--label=dev.id=${devcontainerId}"]
+	}`)
+	config := &RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}, HostPath: project, LaunchCommand: "packnplay run bash"}
+	ws, err := ResolveWorkspace(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devConfig, err := ResolveConfig(config, ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := BuildRunSpec(fake, config, ws, devConfig, nil, "node:20")
+	if err != nil {
+		t.Fatalf("BuildRunSpec() error = %v", err)
+	}
+
+	id := devcontainer.DevContainerID(project, filepath.Join(project, ".devcontainer", "devcontainer.json"))
+	if spec.DevContainerID != id {
+		t.Errorf("DevContainerID = %s, want %s", spec.DevContainerID, id)
+	}
+	if !contains(spec.RunArgs, "-e CACHE_VOLUME=cache-"+id, "--mount source=history-"+id+",target=/commandhistory,type=volume", "--label=dev.id="+id) {
+		t.Errorf("run args = %v, want ${devcontainerId} substituted with %s", spec.RunArgs, id)
+	}
+
+	// The ID doesn't depend on how the run was launched
+	config.LaunchCommand = "packnplay run --verbose bash"
+	again, err := BuildRunSpec(fake, config, ws, devConfig, nil, "node:20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.DevContainerID != id {
+		t.Errorf("DevContainerID changed with the launch command: %s", again.DevContainerID)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	fake := dockertest.New()
+	call := useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postCreateCommand": "make deps", "initializeCommand": "touch initialized"}`)
+
+	stdout := captureStdout(t, func() {
+		if err := Run(&RunConfig{Path: project, NoWorktree: true, DryRun: true, DryRunJSON: true, Command: []string{"bash"}}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	var spec RunSpec
+	if err := json.Unmarshal([]byte(stdout), &spec); err != nil {
+		t.Fatalf("dry run output is not a RunSpec: %v\n%s", err, stdout)
+	}
+	if spec.Image != "alpine:3.20" || spec.Workspace.MountPath != project || spec.Command[0] != "bash" || !contains(spec.RunArgs, "--user root") {
+		t.Errorf("spec = %+v", spec)
+	}
+	if spec.Config == nil || spec.Config.PostCreateCommand == nil {
+		t.Errorf("spec.Config = %+v, want the effective devcontainer config", spec.Config)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("a dry run should not contact the daemon: %v", calls)
+	}
+	if call.path != "" {
+		t.Errorf("a dry run should not exec: %v", call.argv)
+	}
+	if fileExists(filepath.Join(project, "initialized")) {
+		t.Error("a dry run should not run initializeCommand")
+	}
+}
+
+func TestPrintRunSpec(t *testing.T) {
+	spec := &RunSpec{
+		Workspace:     Workspace{MountPath: "/src/app", WorktreeName: "main"},
+		Runtime:       "docker",
+		ContainerName: "packnplay-app-main",
+		Image:         "node:20",
+		RemoteUser:    "node",
+		WorkingDir:    "/src/app",
+		RunArgs:       []string{"run", "-d", "-e", "GREETING=hello world", "node:20"},
+		Command:       []string{"npm", "test"},
+		Config:        &devcontainer.Config{Image: "node:20", RemoteUser: "node"},
+	}
+	var buf bytes.Buffer
+	if err := PrintRunSpec(&buf, spec, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Container: packnplay-app-main",
+		"docker run -d -e 'GREETING=hello world' node:20\n",
+		"docker exec -i --user node -w /src/app packnplay-app-main npm test\n",
+		"Effective configuration:\n{\n  \"image\": \"node:20\",",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrintRunSpecRedactsCredentials(t *testing.T) {
+	spec := &RunSpec{
+		Workspace:     Workspace{MountPath: "/src/app", WorktreeName: "main"},
+		Runtime:       "docker",
+		ContainerName: "packnplay-app-main",
+		Image:         "node:20",
+		RunArgs:       []string{"run", "-d", "-e", "ANTHROPIC_API_KEY=sk-ant-REDACTED", "-e", "GREETING=hello", "node:20"},
+		Config:        &devcontainer.Config{Image: "node:20", ContainerEnv: map[string]string{"NPM_TOKEN": "npm-secret"}},
+	}
+	for _, asJSON := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := PrintRunSpec(&buf, spec, asJSON); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if strings.Contains(out, "secretsecret") || strings.Contains(out, "npm-secret") {
+			t.Errorf("credentials leaked (json=%v):\n%s", asJSON, out)
+		}
+		if !strings.Contains(out, "ANTHROPIC_API_KEY=[REDACTED]") || !strings.Contains(out, "GREETING=hello") {
+			t.Errorf("expected only the credential to be redacted (json=%v):\n%s", asJSON, out)
+		}
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r)
+		done <- buf.String()
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
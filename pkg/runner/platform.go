@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// resolvePlatform determines the target platform: --platform flag, then
+// build.platform, then a --platform entry in runArgs. Empty means native.
+func resolvePlatform(flagPlatform string, devConfig *devcontainer.Config) string {
+	if flagPlatform != "" {
+		return flagPlatform
+	}
+	if devConfig.Build != nil && devConfig.Build.Platform != "" {
+		return devConfig.Build.Platform
+	}
+	return platformFromRunArgs(devConfig.RunArgs)
+}
+
+// platformFromRunArgs extracts the value of --platform from docker run arguments
+func platformFromRunArgs(runArgs []string) string {
+	for i, arg := range runArgs {
+		if value, ok := strings.CutPrefix(arg, "--platform="); ok {
+			return value
+		}
+		if arg == "--platform" && i+1 < len(runArgs) {
+			return runArgs[i+1]
+		}
+	}
+	return ""
+}
+
+// platformArch returns the architecture component of a platform string (linux/arm64/v8 → arm64)
+func platformArch(platform string) string {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 {
+		return platform
+	}
+	return parts[1]
+}
+
+// isEmulatedPlatform reports whether running platform on this host requires emulation
+func isEmulatedPlatform(platform string) bool {
+	return platform != "" && platformArch(platform) != runtime.GOARCH
+}
+
+// warnIfEmulated prints a warning when the requested platform needs CPU emulation
+func warnIfEmulated(platform string) {
+	if isEmulatedPlatform(platform) {
+		fmt.Fprintf(os.Stderr, "Warning: platform %s differs from host architecture %s; the container runs under emulation and will be significantly slower\n", platform, runtime.GOARCH)
+	}
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+func TestResolvePlatform(t *testing.T) {
+	tests := []struct {
+		name      string
+		flag      string
+		devConfig *devcontainer.Config
+		want      string
+	}{
+		{
+			name:      "native by default",
+			devConfig: &devcontainer.Config{},
+			want:      "",
+		},
+		{
+			name:      "flag wins",
+			flag:      "linux/amd64",
+			devConfig: &devcontainer.Config{Build: &devcontainer.BuildConfig{Platform: "linux/arm64"}},
+			want:      "linux/amd64",
+		},
+		{
+			name:      "build.platform",
+			devConfig: &devcontainer.Config{Build: &devcontainer.BuildConfig{Platform: "linux/arm64"}},
+			want:      "linux/arm64",
+		},
+		{
+			name:      "runArgs equals form",
+			devConfig: &devcontainer.Config{RunArgs: []string{"--init", "--platform=linux/amd64"}},
+			want:      "linux/amd64",
+		},
+		{
+			name:      "runArgs separate value",
+			devConfig: &devcontainer.Config{RunArgs: []string{"--platform", "linux/amd64"}},
+			want:      "linux/amd64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolvePlatform(tt.flag, tt.devConfig); got != tt.want {
+				t.Errorf("resolvePlatform() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEmulatedPlatform(t *testing.T) {
+	if isEmulatedPlatform("") {
+		t.Error("empty platform should not be emulated")
+	}
+	if isEmulatedPlatform("linux/" + runtime.GOARCH) {
+		t.Error("host architecture should not be emulated")
+	}
+	other := "amd64"
+	if runtime.GOARCH == "amd64" {
+		other = "arm64"
+	}
+	if !isEmulatedPlatform("linux/" + other) {
+		t.Errorf("linux/%s should be emulated on %s", other, runtime.GOARCH)
+	}
+}
+
+func TestImageManager_BuildCommandWithPlatform(t *testing.T) {
+	im := NewImageManager(&mockDockerClient{}, false)
+
+	args := []string{"build", "-f", "Dockerfile", "-t", "img", "."}
+	if got := im.buildCommand(args); got[0] != "build" {
+		t.Errorf("native build should use docker build, got %v", got)
+	}
+
+	im.SetPlatform("linux/amd64")
+	got := im.buildCommand(args)
+	want := []string{"buildx", "build", "--platform", "linux/amd64", "--load", "-f", "Dockerfile", "-t", "img", "."}
+	if len(got) != len(want) {
+		t.Fatalf("buildCommand() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("buildCommand()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pluginRebuiltMarker is written next to a cached node_modules once it has been
+// rebuilt for the container's platform
+const pluginRebuiltMarker = ".packnplay-rebuilt"
+
+// pluginRebuild is a plugin in a mounted config directory whose node_modules
+// hold native modules built for another platform. A copy rebuilt in the
+// container is cached on the host, in
+// ~/.cache/packnplay/plugins/<arch>/<plugin>/<version>/, and mounted over the
+// plugin's own node_modules. A new plugin version gets a new cache directory.
+type pluginRebuild struct {
+	Name        string // package.json name
+	Version     string // package.json version
+	NodeModules string // the plugin's node_modules on the host
+	Target      string // the plugin's node_modules in the container
+	Cache       string // the cache directory for this plugin version
+	Command     string // the package manager's rebuild command
+	needsBuild  bool   // the cache isn't rebuilt yet
+}
+
+// CacheModules is the cached node_modules mounted over the plugin's
+func (p pluginRebuild) CacheModules() string {
+	return filepath.Join(p.Cache, "node_modules")
+}
+
+// pluginCacheRoot is where rebuilt plugins are cached
+func pluginCacheRoot(homeDir string) string {
+	cacheDir := os.Getenv("XDG_CACHE_HOME")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(homeDir, ".cache")
+	}
+	return filepath.Join(cacheDir, "packnplay", "plugins")
+}
+
+// unsafePathChars are replaced in names used as cache directories
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._+-]+`)
+
+// planPluginRebuild describes rebuilding nodeModules, the outermost
+// node_modules holding foreign binaries, when the directory above it is a
+// package with a package.json. target is nodeModules in the container.
+func planPluginRebuild(nodeModules, target, arch, homeDir string) (pluginRebuild, bool) {
+	if filepath.Base(nodeModules) != "node_modules" {
+		return pluginRebuild{}, false
+	}
+	dir := filepath.Dir(nodeModules)
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return pluginRebuild{}, false
+	}
+	var pkg struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return pluginRebuild{}, false
+	}
+	if pkg.Name == "" {
+		pkg.Name = filepath.Base(dir)
+	}
+	if pkg.Version == "" {
+		pkg.Version = "0.0.0"
+	}
+
+	command := "npm rebuild"
+	if _, err := os.Stat(filepath.Join(dir, "pnpm-lock.yaml")); err == nil {
+		command = "pnpm rebuild"
+	}
+	name := strings.Trim(unsafePathChars.ReplaceAllString(strings.TrimPrefix(pkg.Name, "@"), "-"), "-.")
+	version := strings.Trim(unsafePathChars.ReplaceAllString(pkg.Version, "-"), "-.")
+	return pluginRebuild{
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		NodeModules: nodeModules,
+		Target:      target,
+		Cache:       filepath.Join(pluginCacheRoot(homeDir), arch, name, version),
+		Command:     command,
+	}, true
+}
+
+// pluginRebuildArgs mounts the cached node_modules over the plugins' own
+func pluginRebuildArgs(rebuilds []pluginRebuild) []string {
+	var args []string
+	for _, rebuild := range rebuilds {
+		args = append(args, "-v", rebuild.CacheModules()+":"+rebuild.Target)
+	}
+	return args
+}
+
+// preparePluginCaches makes sure each plugin's cache directory exists before
+// it is mounted. One not rebuilt yet starts as a copy of the plugin's own
+// node_modules, for the rebuild to replace the native modules in; the other
+// versions of the plugin cached for this platform are removed.
+func preparePluginCaches(rebuilds []pluginRebuild) error {
+	for i := range rebuilds {
+		rebuild := &rebuilds[i]
+		if _, err := os.Stat(filepath.Join(rebuild.Cache, pluginRebuiltMarker)); err == nil {
+			continue
+		}
+		rebuild.needsBuild = true
+		if err := os.RemoveAll(rebuild.Cache); err != nil {
+			return fmt.Errorf("failed to reset the plugin cache %s: %w", rebuild.Cache, err)
+		}
+		if err := copyTree(rebuild.NodeModules, rebuild.CacheModules()); err != nil {
+			return fmt.Errorf("failed to copy %s into the plugin cache: %w", rebuild.NodeModules, err)
+		}
+
+		versions, _ := os.ReadDir(filepath.Dir(rebuild.Cache))
+		for _, version := range versions {
+			if version.Name() != filepath.Base(rebuild.Cache) && !usedPluginCache(rebuilds, filepath.Join(filepath.Dir(rebuild.Cache), version.Name())) {
+				_ = os.RemoveAll(filepath.Join(filepath.Dir(rebuild.Cache), version.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+// usedPluginCache reports whether one of rebuilds uses the cache directory
+func usedPluginCache(rebuilds []pluginRebuild, cache string) bool {
+	for _, rebuild := range rebuilds {
+		if rebuild.Cache == cache {
+			return true
+		}
+	}
+	return false
+}
+
+// copyTree copies a directory like copyDir, but keeps symlinks as symlinks:
+// node_modules/.bin entries point into their packages
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, rel)
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(dstPath, 0755)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dstPath)
+		case entry.Type().IsRegular():
+			return copyFile(path, dstPath)
+		}
+		return nil
+	})
+}
+
+// rebuildPlugins runs each plugin's rebuild in the new container, where its
+// cached node_modules are mounted, and marks the cache rebuilt. A failure
+// leaves the copy of the host's modules in place and is retried by the next
+// container.
+func rebuildPlugins(dockerClient DockerClient, containerID, user string, rebuilds []pluginRebuild, verbose bool) {
+	for _, rebuild := range rebuilds {
+		if !rebuild.needsBuild {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Rebuilding native modules of plugin %s %s...\n", rebuild.Name, rebuild.Version)
+		tool, _, _ := strings.Cut(rebuild.Command, " ")
+		missing := "packnplay: no " + tool
+		script := fmt.Sprintf("command -v %s >/dev/null 2>&1 || { echo '%s'; exit 1; }; %s", tool, missing, rebuild.Command)
+		args := []string{"exec"}
+		if user != "" {
+			args = append(args, "-u", user)
+		}
+		args = append(args, "-w", filepath.Dir(rebuild.Target), containerID, "sh", "-c", script)
+		output, err := dockerClient.Run(args...)
+		if err != nil {
+			if strings.Contains(output, missing) {
+				fmt.Fprintf(os.Stderr, "Warning: can't rebuild plugin %s: %s isn't installed in the container (add Node.js, e.g. the ghcr.io/devcontainers/features/node feature)\n", rebuild.Name, tool)
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: failed to rebuild plugin %s: %v\n%s\n", rebuild.Name, err, output)
+			}
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "%s\n", output)
+		}
+		if err := os.WriteFile(filepath.Join(rebuild.Cache, pluginRebuiltMarker), []byte(rebuild.Version+"\n"), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to mark plugin %s rebuilt: %v\n", rebuild.Name, err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+// pluginFixture creates a plugin under home/.claude whose node_modules hold a
+// Mach-O native module and a .bin symlink
+func pluginFixture(t *testing.T, home, version string) string {
+	t.Helper()
+	plugin := filepath.Join(home, ".claude", "plugins", "search")
+	writeBinary(t, filepath.Join(plugin, "package.json"), []byte(`{"name": "@acme/search", "version": "`+version+`"}`), 0644)
+	writeBinary(t, filepath.Join(plugin, "node_modules", "fsevents", "fsevents.node"), machOHeader, 0644)
+	writeBinary(t, filepath.Join(plugin, "node_modules", "fsevents", "cli.js"), []byte("console.log(1)\n"), 0755)
+	if err := os.MkdirAll(filepath.Join(plugin, "node_modules", ".bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../fsevents/cli.js", filepath.Join(plugin, "node_modules", ".bin", "fsevents")); err != nil {
+		t.Fatal(err)
+	}
+	return plugin
+}
+
+func TestCheckForeignBinariesPlansPluginRebuild(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", "")
+	plugin := pluginFixture(t, home, "1.2.0")
+	writeBinary(t, filepath.Join(home, ".claude", "local", "bin", "rg"), machOHeader, 0755)
+	args := []string{"-v", filepath.Join(home, ".claude") + ":/home/dev/.claude"}
+
+	plan, err := checkForeignBinaries(args, ForeignBinariesRebuild, "linux/amd64", home, filepath.Join(home, "src"), false)
+	if err != nil {
+		t.Fatalf("checkForeignBinaries() error = %v", err)
+	}
+	if len(plan.Rebuilds) != 1 {
+		t.Fatalf("rebuilds = %+v, want the plugin", plan.Rebuilds)
+	}
+	rebuild := plan.Rebuilds[0]
+	if rebuild.Name != "@acme/search" || rebuild.Target != "/home/dev/.claude/plugins/search/node_modules" || rebuild.Command != "npm rebuild" {
+		t.Errorf("rebuild = %+v", rebuild)
+	}
+	if want := filepath.Join(home, ".cache", "packnplay", "plugins", "amd64", "acme-search", "1.2.0"); rebuild.Cache != want {
+		t.Errorf("cache = %s, want %s", rebuild.Cache, want)
+	}
+	if len(plan.Shadows) != 1 || plan.Shadows[0] != filepath.Join(home, ".claude", "local", "bin") {
+		t.Errorf("shadows = %v, want what isn't a plugin hidden", plan.Shadows)
+	}
+	if got := pluginRebuildArgs(plan.Rebuilds); !contains(got, rebuild.CacheModules()+":/home/dev/.claude/plugins/search/node_modules") {
+		t.Errorf("pluginRebuildArgs() = %v", got)
+	}
+	if _, ok := planPluginRebuild(filepath.Join(plugin, "node_modules", "fsevents"), "/x", "amd64", home); ok {
+		t.Error("only a node_modules directory is rebuilt")
+	}
+}
+
+func TestPluginCacheRebuild(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+	plugin := pluginFixture(t, home, "1.2.0")
+	stale := filepath.Join(home, "cache", "packnplay", "plugins", "amd64", "acme-search", "1.1.0")
+	if err := os.MkdirAll(stale, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rebuild, ok := planPluginRebuild(filepath.Join(plugin, "node_modules"), "/home/dev/.claude/plugins/search/node_modules", "amd64", home)
+	if !ok {
+		t.Fatal("planPluginRebuild() = false for a plugin")
+	}
+	rebuilds := []pluginRebuild{rebuild}
+	if err := preparePluginCaches(rebuilds); err != nil {
+		t.Fatalf("preparePluginCaches() error = %v", err)
+	}
+	if !rebuilds[0].needsBuild {
+		t.Error("a new cache needs building")
+	}
+	if link, err := os.Readlink(filepath.Join(rebuild.CacheModules(), ".bin", "fsevents")); err != nil || link != "../fsevents/cli.js" {
+		t.Errorf(".bin link = %q (%v), want it kept a symlink", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(rebuild.CacheModules(), "fsevents", "fsevents.node")); err != nil {
+		t.Errorf("the plugin's modules should be copied: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("the cache of another version should be removed")
+	}
+
+	fake := dockertest.New()
+	created := fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true})
+	rebuildPlugins(fake, created.ID, "dev", rebuilds, false)
+	calls := fake.CallsTo("exec")
+	if len(calls) != 1 || !contains(calls[0], "-u", "dev", "-w", "/home/dev/.claude/plugins/search") || !strings.Contains(strings.Join(calls[0], " "), "npm rebuild") {
+		t.Fatalf("exec calls = %v", calls)
+	}
+	if _, err := os.Stat(filepath.Join(rebuild.Cache, pluginRebuiltMarker)); err != nil {
+		t.Errorf("a rebuilt cache should be marked: %v", err)
+	}
+
+	// A rebuilt cache is reused as it is
+	rebuilds = []pluginRebuild{rebuild}
+	if err := preparePluginCaches(rebuilds); err != nil || rebuilds[0].needsBuild {
+		t.Errorf("preparePluginCaches() = %v, needsBuild %v; want the rebuilt cache reused", err, rebuilds[0].needsBuild)
+	}
+}
+
+func TestRebuildPluginsWithoutNode(t *testing.T) {
+	home := t.TempDir()
+	rebuild := pluginRebuild{Name: "search", Command: "npm rebuild", Target: "/p/node_modules", Cache: filepath.Join(home, "cache"), needsBuild: true}
+	fake := dockertest.New()
+	fake.On(func(args []string) (string, error) {
+		return "packnplay: no npm\n", errors.New("exit status 1")
+	}, "exec")
+
+	rebuildPlugins(fake, "abc123", "", []pluginRebuild{rebuild}, false)
+	if _, err := os.Stat(filepath.Join(rebuild.Cache, pluginRebuiltMarker)); !os.IsNotExist(err) {
+		t.Error("a failed rebuild shouldn't be marked, so the next container retries it")
+	}
+}
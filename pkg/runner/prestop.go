@@ -0,0 +1,96 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// PreStopLabel carries the container's preStopCommand so `packnplay stop` can
+// run it without the project's devcontainer.json
+const PreStopLabel = "packnplay-prestop"
+
+// defaultPreStopTimeout bounds preStopCommand when no preStopTimeout is configured
+const defaultPreStopTimeout = 30 * time.Second
+
+// preStopSpec is the JSON stored in PreStopLabel
+type preStopSpec struct {
+	Command        *devcontainer.LifecycleCommand `json:"command"`
+	User           string                         `json:"user,omitempty"`
+	TimeoutSeconds int                            `json:"timeout,omitempty"`
+}
+
+// preStopLabelArgs returns the --label args recording customizations.packnplay.preStopCommand
+func preStopLabelArgs(devConfig *devcontainer.Config) ([]string, error) {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return nil, err
+	}
+	if custom.PreStopCommand == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(preStopSpec{
+		Command:        custom.PreStopCommand,
+		User:           devConfig.RemoteUser,
+		TimeoutSeconds: custom.PreStopTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode preStopCommand: %w", err)
+	}
+	return []string{"--label", fmt.Sprintf("%s=%s", PreStopLabel, data)}, nil
+}
+
+// RunPreStop runs the container's preStopCommand, if any, giving up after its timeout.
+// Callers stop the container afterwards regardless of the result.
+func RunPreStop(dockerClient DockerClient, containerName string, verbose bool) error {
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil
+	}
+
+	output, err := dockerClient.Run("inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", PreStopLabel), containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	value := strings.TrimSpace(output)
+	if value == "" || value == "<no value>" {
+		return nil
+	}
+
+	var spec preStopSpec
+	if err := json.Unmarshal([]byte(value), &spec); err != nil {
+		return fmt.Errorf("invalid %s label: %w", PreStopLabel, err)
+	}
+	if spec.Command == nil {
+		return nil
+	}
+
+	timeout := defaultPreStopTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Running preStopCommand in %s (timeout %s)...\n", containerName, timeout)
+	}
+
+	executor := NewLifecycleExecutor(dockerClient, containerName, spec.User, verbose, nil)
+	executor.SetAudit("", containerName)
+	done := make(chan error, 1)
+	go func() { done <- executor.Execute("preStop", spec.Command) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("preStopCommand failed: %w", err)
+		}
+		return nil
+	case <-time.After(timeout):
+		// Stopping the container terminates the still-running exec
+		return fmt.Errorf("preStopCommand timed out after %s", timeout)
+	}
+}
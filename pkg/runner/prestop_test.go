@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+func TestPreStopLabelArgs(t *testing.T) {
+	var devConfig devcontainer.Config
+	data := `{
+		"image": "ubuntu",
+		"remoteUser": "vscode",
+		"customizations": {
+			"packnplay": {"preStopCommand": ["pkill", "-INT", "node"], "preStopTimeout": 5},
+			"vscode": {"extensions": ["golang.go"]}
+		}
+	}`
+	if err := json.Unmarshal([]byte(data), &devConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := preStopLabelArgs(&devConfig)
+	if err != nil {
+		t.Fatalf("preStopLabelArgs() error = %v", err)
+	}
+	if len(args) != 2 || args[0] != "--label" {
+		t.Fatalf("preStopLabelArgs() = %v", args)
+	}
+
+	value := strings.TrimPrefix(args[1], PreStopLabel+"=")
+	var spec preStopSpec
+	if err := json.Unmarshal([]byte(value), &spec); err != nil {
+		t.Fatalf("label value is not valid JSON: %v", err)
+	}
+	if spec.User != "vscode" || spec.TimeoutSeconds != 5 {
+		t.Errorf("spec = %+v", spec)
+	}
+	if arr, ok := spec.Command.AsArray(); !ok || strings.Join(arr, " ") != "pkill -INT node" {
+		t.Errorf("command round-trip = %v", spec.Command)
+	}
+
+	// No preStopCommand, no label
+	if args, err := preStopLabelArgs(&devcontainer.Config{}); err != nil || args != nil {
+		t.Errorf("preStopLabelArgs() without command = %v, %v", args, err)
+	}
+}
+
+func TestRunPreStop(t *testing.T) {
+	mock := &mockDockerClient{inspectOut: `{"command":"redis-cli save","user":"vscode"}` + "\n"}
+	if err := RunPreStop(mock, "packnplay-app", false); err != nil {
+		t.Fatalf("RunPreStop() error = %v", err)
+	}
+	if len(mock.execCalls) != 1 {
+		t.Fatalf("expected 1 exec call, got %d", len(mock.execCalls))
+	}
+	call := strings.Join(mock.execCalls[0], " ")
+	if !strings.Contains(call, "packnplay-app") || !strings.Contains(call, "redis-cli save") || !strings.Contains(call, "vscode") {
+		t.Errorf("exec call = %q", call)
+	}
+
+	// Failures are reported so callers can warn before stopping anyway
+	mock = &mockDockerClient{inspectOut: `{"command":"false"}`, execError: fmt.Errorf("exit status 1")}
+	if err := RunPreStop(mock, "packnplay-app", false); err == nil {
+		t.Error("RunPreStop() expected error for failing command")
+	}
+
+	// Containers without the label are a no-op
+	mock = &mockDockerClient{inspectOut: "<no value>"}
+	if err := RunPreStop(mock, "packnplay-app", false); err != nil || len(mock.execCalls) != 0 {
+		t.Errorf("RunPreStop() without label = %v with %d execs", err, len(mock.execCalls))
+	}
+}
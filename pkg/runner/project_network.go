@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ProjectNetworkLabel records the project network a container joined
+	ProjectNetworkLabel = "packnplay-network"
+	// projectNetworkOwnerLabel marks networks packnplay created for a project
+	projectNetworkOwnerLabel = "packnplay-project-network"
+)
+
+// projectNetworkCreateArgs returns the runtime arguments that create a project network
+func projectNetworkCreateArgs(network, project string) []string {
+	return []string{"network", "create", "--label", "managed-by=packnplay", "--label", projectNetworkOwnerLabel + "=" + project, network}
+}
+
+// ensureProjectNetwork creates the project's network unless it exists
+func ensureProjectNetwork(dockerClient DockerClient, network, project string) error {
+	if _, err := dockerClient.Run("network", "inspect", network); err == nil {
+		return nil
+	}
+	output, err := dockerClient.Run(projectNetworkCreateArgs(network, project)...)
+	// Another run may have created it in the meantime
+	if err != nil && !strings.Contains(output, "already exists") {
+		return fmt.Errorf("failed to create network %s: %w\nDocker output:\n%s", network, err, output)
+	}
+	return nil
+}
+
+// connectProjectNetwork joins a container started on another network (its
+// sidecars') to the project network under its hostname
+func connectProjectNetwork(dockerClient DockerClient, containerID, network, hostname string) error {
+	if output, err := dockerClient.Run("network", "connect", "--alias", hostname, network, containerID); err != nil {
+		return fmt.Errorf("failed to join network %s: %w\nDocker output:\n%s", network, err, output)
+	}
+	return nil
+}
+
+// ContainerProjectNetwork returns the project network a container joined, if any
+func ContainerProjectNetwork(dockerClient DockerClient, containerName string) string {
+	if !runtimeSupports(dockerClient).Inspect {
+		return ""
+	}
+	output, err := dockerClient.Run("inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", ProjectNetworkLabel), containerName)
+	if network := strings.TrimSpace(output); err == nil && network != "<no value>" {
+		return network
+	}
+	return ""
+}
+
+// projectNetworkInUse reports whether any container, running or stopped,
+// belongs to a project network
+func projectNetworkInUse(dockerClient DockerClient, network string) (bool, error) {
+	output, err := dockerClient.Run("ps", "-aq", "--filter", "label="+ProjectNetworkLabel+"="+network)
+	if err != nil {
+		return false, fmt.Errorf("failed to list containers on network %s: %w", network, err)
+	}
+	return strings.TrimSpace(output) != "", nil
+}
+
+// removeProjectNetwork removes a project network that may already be gone
+func removeProjectNetwork(dockerClient DockerClient, network string) error {
+	if output, err := dockerClient.Run("network", "rm", network); err != nil && !strings.Contains(strings.ToLower(output), "not found") {
+		return fmt.Errorf("failed to remove network %s: %w\nDocker output:\n%s", network, err, output)
+	}
+	return nil
+}
+
+// ReleaseProjectNetwork removes a project network once no container belongs to it
+func ReleaseProjectNetwork(dockerClient DockerClient, network string) error {
+	if network == "" {
+		return nil
+	}
+	inUse, err := projectNetworkInUse(dockerClient, network)
+	if err != nil || inUse {
+		return err
+	}
+	return removeProjectNetwork(dockerClient, network)
+}
+
+// PruneProjectNetworks removes project networks no container belongs to,
+// returning their names
+func PruneProjectNetworks(dockerClient DockerClient) ([]string, error) {
+	output, err := dockerClient.Run("network", "ls", "--filter", "label="+projectNetworkOwnerLabel, "--format", "{{.Name}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	var pruned []string
+	for _, network := range strings.Split(output, "\n") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		inUse, err := projectNetworkInUse(dockerClient, network)
+		if err != nil {
+			return pruned, err
+		}
+		if inUse {
+			continue
+		}
+		if err := removeProjectNetwork(dockerClient, network); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, network)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunJoinsProjectNetwork(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	fake.Fail(errors.New("exit status 1"), "Error response from daemon: network not found\n", "network", "inspect")
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	network := container.GenerateNetworkName(project)
+	hostname := container.GenerateHostname(project, "no-worktree")
+	main := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if main == nil {
+		t.Fatal("container should be created")
+	}
+	if argValue(main.RunArgs, "--network") != network || argValue(main.RunArgs, "--network-alias") != hostname ||
+		argValue(main.RunArgs, "--hostname") != hostname || main.Labels[ProjectNetworkLabel] != network {
+		t.Errorf("docker run args = %v, want the project network and hostname", main.RunArgs)
+	}
+	if !containsCall(fake.CallsTo("network", "create"), network) {
+		t.Errorf("the project network should be created: %v", fake.Calls())
+	}
+}
+
+func TestRunWithoutProjectNetwork(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "runArgs": ["--network=host"]}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	main := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if main == nil || contains(main.RunArgs, "--hostname") || len(fake.CallsTo("network", "create")) != 0 {
+		t.Errorf("a --network runArg should opt out of the project network: %v", fake.Calls())
+	}
+}
+
+func TestReleaseProjectNetwork(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-feature", Labels: map[string]string{ProjectNetworkLabel: "packnplay-app"}})
+
+	if err := ReleaseProjectNetwork(fake, "packnplay-app"); err != nil {
+		t.Fatalf("ReleaseProjectNetwork() error = %v", err)
+	}
+	if len(fake.CallsTo("network", "rm")) != 0 {
+		t.Fatal("the network should stay while a container still belongs to it")
+	}
+
+	if _, err := fake.Run("rm", "-f", "packnplay-app-feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseProjectNetwork(fake, "packnplay-app"); err != nil {
+		t.Fatalf("ReleaseProjectNetwork() error = %v", err)
+	}
+	if !containsCall(fake.CallsTo("network", "rm"), "packnplay-app") {
+		t.Error("the network should be removed with its last container")
+	}
+}
+
+func TestPruneProjectNetworks(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Labels: map[string]string{ProjectNetworkLabel: "packnplay-app"}})
+	fake.On(func(args []string) (string, error) {
+		return "packnplay-app\npacknplay-gone\n", nil
+	}, "network", "ls")
+
+	pruned, err := PruneProjectNetworks(fake)
+	if err != nil || !reflect.DeepEqual(pruned, []string{"packnplay-gone"}) {
+		t.Fatalf("PruneProjectNetworks() = %v, %v", pruned, err)
+	}
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"os"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/proxy"
+)
+
+// detectProxy finds the host's proxy, replaced in tests
+var detectProxy = func() proxy.Settings {
+	return proxy.Detect(os.Getenv)
+}
+
+// resolveProxy works out the proxy builds and the container use: the host's,
+// overridden by the user's config and then by the project's
+// customizations.packnplay.proxy. Either can turn it off.
+func resolveProxy(config *RunConfig, devConfig *devcontainer.Config) (proxy.Settings, error) {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return proxy.Settings{}, errdefs.Errorf(errdefs.CategoryConfig, "%w", err)
+	}
+	if config.Proxy.Disabled || (custom.Proxy != nil && custom.Proxy.Disabled) {
+		return proxy.Settings{}, nil
+	}
+	settings := detectProxy().Override(proxy.Settings{
+		HTTP:    config.Proxy.HTTP,
+		HTTPS:   config.Proxy.HTTPS,
+		NoProxy: config.Proxy.NoProxy,
+	})
+	if custom.Proxy != nil {
+		settings = settings.Override(proxy.Settings{
+			HTTP:    custom.Proxy.HTTP,
+			HTTPS:   custom.Proxy.HTTPS,
+			NoProxy: custom.Proxy.NoProxy,
+		})
+	}
+	return settings, nil
+}
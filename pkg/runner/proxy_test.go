@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/proxy"
+)
+
+func TestRunForwardsHostProxy(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	detectProxy = func() proxy.Settings {
+		return proxy.Settings{HTTPS: "http://127.0.0.1:3128", NoProxy: []string{".corp.example"}}
+	}
+	project := newProject(t, `{
+		"image": "alpine:3.20",
+		"remoteUser": "root",
+		"customizations": {"packnplay": {
+			"proxy": {"noProxy": ["registry.internal"]},
+			"services": {"db": {"image": "postgres:16"}}
+		}}
+	}`)
+	fake.AddImage(dockertest.Image{Name: "postgres:16"})
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	main := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if main == nil {
+		t.Fatal("container should be created")
+	}
+	if !contains(main.RunArgs, "-e HTTPS_PROXY=http://host.docker.internal:3128", "-e https_proxy=http://host.docker.internal:3128", "--add-host host.docker.internal:host-gateway") {
+		t.Errorf("docker run args = %v, want the proxy on the host's loopback reached through host.docker.internal", main.RunArgs)
+	}
+	var noProxy string
+	for i, arg := range main.RunArgs {
+		if arg == "-e" && strings.HasPrefix(main.RunArgs[i+1], "NO_PROXY=") {
+			noProxy = main.RunArgs[i+1]
+		}
+	}
+	hostname := container.GenerateHostname(project, "no-worktree")
+	for _, host := range []string{".corp.example", "localhost", "registry.internal", "db", hostname} {
+		if !strings.Contains(noProxy, host) {
+			t.Errorf("%s should include %s", noProxy, host)
+		}
+	}
+}
+
+func TestRunWithProxyDisabled(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	detectProxy = func() proxy.Settings { return proxy.Settings{HTTP: "http://proxy.corp.example:8080"} }
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}, Proxy: config.ProxyConfig{Disabled: true}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	main := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if main == nil || contains(main.RunArgs, "HTTP_PROXY") {
+		t.Errorf("a disabled proxy shouldn't be forwarded: %v", fake.Calls())
+	}
+}
+
+func TestResolveProxyPrecedence(t *testing.T) {
+	orig := detectProxy
+	t.Cleanup(func() { detectProxy = orig })
+	detectProxy = func() proxy.Settings {
+		return proxy.Settings{HTTP: "http://host-proxy:3128", HTTPS: "http://host-proxy:3128"}
+	}
+	project := newProject(t, `{"image": "alpine:3.20", "customizations": {"packnplay": {"proxy": {"https": "http://project-proxy:8080"}}}}`)
+	cfg := &RunConfig{Path: project, NoWorktree: true, Proxy: config.ProxyConfig{HTTP: "http://user-proxy:3128", HTTPS: "http://user-proxy:3128"}}
+	ws, err := ResolveWorkspace(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devConfig, err := ResolveConfig(cfg, ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveProxy(cfg, devConfig)
+	if err != nil {
+		t.Fatalf("resolveProxy() error = %v", err)
+	}
+	if got.HTTP != "http://user-proxy:3128" || got.HTTPS != "http://project-proxy:8080" {
+		t.Errorf("resolveProxy() = %+v, want the user's HTTP proxy and the project's HTTPS proxy", got)
+	}
+}
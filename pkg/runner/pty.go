@@ -0,0 +1,121 @@
+package runner
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/cancelreader"
+	"golang.org/x/sys/unix"
+)
+
+// ptyDrainTimeout bounds how long output still buffered in the pseudo-terminal
+// is copied after the child exits
+const ptyDrainTimeout = time.Second
+
+// startSupervised starts a docker exec that packnplay supervises instead of
+// exec'ing into. It returns the command and a channel receiving its Wait
+// result once the terminal has been restored.
+//
+// When packnplay's stdin is a terminal, the child gets a pseudo-terminal of
+// its own sized like it, and packnplay's terminal is put in raw mode while
+// input and output are copied across. Keys like Ctrl-C and Ctrl-Z then reach
+// the command in the container as they would with exec handoff, instead of
+// signalling packnplay and the runtime CLI. Window resizes are passed on, and
+// the terminal is restored however the child ends, even if it is killed.
+// Without a terminal, or where pseudo-terminals aren't available, the child
+// inherits packnplay's stdio.
+func startSupervised(cmdPath string, execArgs []string) (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(cmdPath, execArgs[1:]...) // Skip the program name in execArgs
+	if term.IsTerminal(os.Stdin.Fd()) {
+		if master, slave, err := openPTY(); err == nil {
+			done, err := startWithPTY(cmd, master, slave, os.Stdin, os.Stdout)
+			return cmd, done, err
+		}
+	}
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return cmd, nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	return cmd, done, nil
+}
+
+// startWithPTY starts cmd on the pseudo-terminal master/slave, relaying to
+// host, the terminal packnplay was started from, and out
+func startWithPTY(cmd *exec.Cmd, master, slave, host *os.File, out io.Writer) (<-chan error, error) {
+	// Size it before the start, so the command sees the right size from the first line it draws
+	_ = copyTerminalSize(host, master)
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, err
+	}
+	slave.Close()
+
+	state, rawErr := term.MakeRaw(host.Fd())
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			_ = copyTerminalSize(host, master)
+		}
+	}()
+
+	outputDone := make(chan struct{})
+	go func() {
+		// Ends with EIO once the child and its descendants have closed the terminal
+		_, _ = io.Copy(out, master)
+		close(outputDone)
+	}()
+	input, inputErr := cancelreader.NewReader(host)
+	if inputErr == nil {
+		go func() {
+			_, _ = io.Copy(master, input)
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		select {
+		case <-outputDone:
+		case <-time.After(ptyDrainTimeout):
+		}
+		signal.Stop(winch)
+		close(winch)
+		if inputErr == nil {
+			input.Cancel()
+			input.Close()
+		}
+		if rawErr == nil {
+			_ = term.Restore(host.Fd(), state)
+		}
+		master.Close()
+		done <- err
+	}()
+	return done, nil
+}
+
+// copyTerminalSize resizes the terminal to to match from
+func copyTerminalSize(from, to *os.File) error {
+	size, err := unix.IoctlGetWinsize(int(from.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return err
+	}
+	return unix.IoctlSetWinsize(int(to.Fd()), unix.TIOCSWINSZ, size)
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package runner
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY reports that pseudo-terminals aren't supported here, so supervised
+// commands inherit packnplay's stdio
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pseudo-terminals are not supported on this platform")
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/sys/unix"
+)
+
+func TestStartWithPTY(t *testing.T) {
+	// A pseudo-terminal stands in for the terminal packnplay was started from
+	hostMaster, host, err := openPTY()
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+	defer hostMaster.Close()
+	defer host.Close()
+	if err := unix.IoctlSetWinsize(int(hostMaster.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Row: 40, Col: 100}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := term.GetState(host.Fd())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, slave, err := openPTY()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "stty size; test -t 0 && echo tty; exit 3")
+	done, err := startWithPTY(cmd, master, slave, host, &out)
+	if err != nil {
+		t.Fatalf("startWithPTY() error = %v", err)
+	}
+	err = <-done
+
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("Wait() = %v, want the command's exit status 3", err)
+	}
+	if got := out.String(); !strings.Contains(got, "40 100") || !strings.Contains(got, "tty") {
+		t.Errorf("output = %q, want a terminal sized like the host's", got)
+	}
+	if after, err := term.GetState(host.Fd()); err != nil || !reflect.DeepEqual(after, before) {
+		t.Errorf("the host terminal should be restored after the command exits")
+	}
+}
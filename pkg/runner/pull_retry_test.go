@@ -0,0 +1,171 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/proxy"
+)
+
+// sequencePullClient fails pulls with each error in turn, then succeeds
+type sequencePullClient struct {
+	errs  []error
+	pulls int
+}
+
+func (c *sequencePullClient) RunWithProgress(imageName string, args ...string) error {
+	c.pulls++
+	if c.pulls <= len(c.errs) {
+		return c.errs[c.pulls-1]
+	}
+	return nil
+}
+
+func (c *sequencePullClient) Run(args ...string) (string, error) {
+	return "", errors.New("not found")
+}
+
+func (c *sequencePullClient) Command() string {
+	return "podman"
+}
+
+func pullFailure(output string) error {
+	return &docker.PullError{Err: errors.New("exit status 1"), Output: output, LayersComplete: 1, Layers: 3}
+}
+
+func newRetryingManager(client DockerClient) (*ImageManager, *[]time.Duration) {
+	var waits []time.Duration
+	im := NewImageManager(client, false)
+	im.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return im, &waits
+}
+
+func TestPullRetriesTransientFailures(t *testing.T) {
+	client := &sequencePullClient{errs: []error{pullFailure("unexpected EOF"), pullFailure("connection reset by peer")}}
+	im, waits := newRetryingManager(client)
+
+	if err := im.pullImage("ubuntu:22.04"); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+	if client.pulls != 3 {
+		t.Errorf("pulls = %d, want 3", client.pulls)
+	}
+	if want := []time.Duration{2 * time.Second, 4 * time.Second}; !reflect.DeepEqual(*waits, want) {
+		t.Errorf("waits = %v, want %v", *waits, want)
+	}
+}
+
+func TestPullGivesUpAfterAttempts(t *testing.T) {
+	failure := pullFailure("TLS handshake timeout")
+	client := &sequencePullClient{errs: []error{failure, failure, failure, failure, failure}}
+	im, waits := newRetryingManager(client)
+	im.SetPullRetryPolicy(PullRetryPolicy{Attempts: 4, InitialDelay: 10 * time.Second, MaxDelay: 15 * time.Second})
+
+	if err := im.pullImage("ubuntu:22.04"); err == nil {
+		t.Fatal("pullImage() should fail once attempts are exhausted")
+	}
+	if client.pulls != 4 {
+		t.Errorf("pulls = %d, want 4", client.pulls)
+	}
+	if want := []time.Duration{10 * time.Second, 15 * time.Second, 15 * time.Second}; !reflect.DeepEqual(*waits, want) {
+		t.Errorf("waits = %v, want backoff capped at MaxDelay: %v", *waits, want)
+	}
+}
+
+func TestPullDoesNotRetryPermanentFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"missing image", pullFailure("manifest unknown")},
+		{"rejected credentials", &docker.PullError{Err: docker.ErrRegistryAuth, Output: "unauthorized"}},
+		{"failed to start", errors.New("failed to start command: exec: not found")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &sequencePullClient{errs: []error{tt.err, tt.err}}
+			im, _ := newRetryingManager(client)
+			if err := im.pullImage("ubuntu:nope"); err == nil {
+				t.Fatal("pullImage() should fail")
+			}
+			if client.pulls != 1 {
+				t.Errorf("pulls = %d, want no retries", client.pulls)
+			}
+		})
+	}
+}
+
+func TestPullWaitsLongerWhenRateLimited(t *testing.T) {
+	client := &sequencePullClient{errs: []error{pullFailure("toomanyrequests: You have reached your pull rate limit")}}
+	im, waits := newRetryingManager(client)
+
+	if err := im.pullImage("ubuntu:22.04"); err != nil {
+		t.Fatalf("pullImage() error = %v", err)
+	}
+	if len(*waits) != 1 || (*waits)[0] < rateLimitDelay {
+		t.Errorf("waits = %v, want at least %s after a rate limit", *waits, rateLimitDelay)
+	}
+}
+
+func TestProxyBuildArgs(t *testing.T) {
+	for _, name := range proxyEnvVars {
+		t.Setenv(name, "")
+	}
+	im := NewImageManager(&sequencePullClient{}, false)
+	if got := im.buildCommand([]string{"build", "-t", "img", "."}); !reflect.DeepEqual(got, []string{"build", "-t", "img", "."}) {
+		t.Errorf("buildCommand() = %v, want no proxy args without proxy variables", got)
+	}
+
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	t.Setenv("no_proxy", "localhost")
+	got := im.buildCommand([]string{"build", "-t", "img", "."})
+	want := []string{"build", "--build-arg", "HTTPS_PROXY", "--build-arg", "no_proxy", "-t", "img", "."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildCommand() = %v, want %v", got, want)
+	}
+
+	im.SetPlatform("linux/amd64")
+	if got := strings.Join(im.buildCommand([]string{"build", "."}), " "); got != "buildx build --platform linux/amd64 --load --build-arg HTTPS_PROXY --build-arg no_proxy ." {
+		t.Errorf("buildCommand() with platform = %q", got)
+	}
+}
+
+func TestProxyBuildArgsFromSettings(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	im := NewImageManager(&sequencePullClient{}, false)
+	im.SetProxy(proxy.Settings{HTTP: "http://system-proxy:8080", AddHost: "host.docker.internal:host-gateway"})
+
+	got := strings.Join(im.buildCommand([]string{"build", "."}), " ")
+	want := "build --build-arg HTTP_PROXY=http://system-proxy:8080 --build-arg http_proxy=http://system-proxy:8080 --add-host host.docker.internal:host-gateway ."
+	if got != want {
+		t.Errorf("buildCommand() = %q, want %q", got, want)
+	}
+
+	im.SetProxy(proxy.Settings{})
+	if got := im.buildCommand([]string{"build", "."}); !reflect.DeepEqual(got, []string{"build", "."}) {
+		t.Errorf("buildCommand() = %v, want no proxy args when the proxy is off", got)
+	}
+}
+
+func TestWithProxyHint(t *testing.T) {
+	for _, name := range proxyEnvVars {
+		t.Setenv(name, "")
+	}
+	err := pullFailure("dial tcp: i/o timeout")
+	if got := withProxyHint(err, "docker"); got != err {
+		t.Errorf("withProxyHint() = %v, want unchanged without proxy variables", got)
+	}
+
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	if got := withProxyHint(err, "docker"); !strings.Contains(got.Error(), "daemon.json") {
+		t.Errorf("withProxyHint() = %v, want daemon proxy hint", got)
+	}
+	if got := withProxyHint(err, "podman"); got != err {
+		t.Errorf("withProxyHint() = %v, podman reads proxy variables itself", got)
+	}
+}
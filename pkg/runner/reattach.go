@@ -0,0 +1,164 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// Daemon restart handling, replaced in tests
+var (
+	// daemonPollInterval is how often the daemon is checked on during a session
+	// and while waiting for it to come back
+	daemonPollInterval = 5 * time.Second
+	// daemonWaitTimeout bounds how long packnplay waits for a restarted daemon
+	daemonWaitTimeout = 2 * time.Minute
+)
+
+// daemonReachable reports whether the runtime's daemon answers
+func daemonReachable(dockerClient DockerClient) bool {
+	_, err := dockerClient.Run("version")
+	return err == nil
+}
+
+// waitForDaemon waits until the daemon answers again, up to daemonWaitTimeout
+func waitForDaemon(dockerClient DockerClient) error {
+	deadline := time.Now().Add(daemonWaitTimeout)
+	for waited := false; !daemonReachable(dockerClient); waited = true {
+		if !waited {
+			fmt.Fprintf(os.Stderr, "Waiting for the %s daemon to come back...\n", dockerClient.Command())
+		}
+		if time.Now().After(deadline) {
+			return errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "the %s daemon did not come back within %s", dockerClient.Command(), daemonWaitTimeout)
+		}
+		time.Sleep(daemonPollInterval)
+	}
+	return nil
+}
+
+// daemonWatch checks on the daemon in the background while a session runs,
+// remembering whether it ever stopped answering
+type daemonWatch struct {
+	lost atomic.Bool
+	stop chan struct{}
+	done chan struct{}
+}
+
+// watchDaemon starts checking on the daemon every daemonPollInterval
+func watchDaemon(dockerClient DockerClient) *daemonWatch {
+	w := &daemonWatch{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(daemonPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				if !daemonReachable(dockerClient) {
+					w.lost.Store(true)
+				}
+			}
+		}
+	}()
+	return w
+}
+
+// Stop ends the watch, reporting whether the daemon went away during it
+func (w *daemonWatch) Stop() bool {
+	close(w.stop)
+	<-w.done
+	return w.lost.Load()
+}
+
+// sessionContainer identifies the container a session was attached to
+type sessionContainer struct {
+	ID      string
+	Name    string
+	Running bool
+}
+
+// inspectSessionContainer looks up a container by name or ID
+func inspectSessionContainer(dockerClient DockerClient, nameOrID string) (sessionContainer, error) {
+	output, err := dockerClient.Run("inspect", "--type", "container", "--format", "{{.Id}} {{.Name}} {{.State.Running}}", nameOrID)
+	if err != nil {
+		return sessionContainer{}, fmt.Errorf("failed to inspect container %s: %w", nameOrID, err)
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 3 {
+		return sessionContainer{}, fmt.Errorf("unexpected inspect output for container %s: %q", nameOrID, output)
+	}
+	return sessionContainer{
+		ID:      fields[0],
+		Name:    strings.TrimPrefix(fields[1], "/"),
+		Running: fields[2] == "true",
+	}, nil
+}
+
+// reattachContainer waits for the daemon to come back and finds the session's
+// container again by name, since a restart policy or compose may have replaced
+// it, starting it if the restart left it stopped
+func reattachContainer(dockerClient DockerClient, name string) (string, error) {
+	if err := waitForDaemon(dockerClient); err != nil {
+		return "", err
+	}
+	current, err := inspectSessionContainer(dockerClient, name)
+	if err != nil {
+		return "", errdefs.Errorf(errdefs.CategoryContainer, "container %s is gone after the daemon restarted: %w", name, err)
+	}
+	if !current.Running {
+		if output, err := dockerClient.Run("start", current.ID); err != nil {
+			return "", errdefs.Errorf(errdefs.CategoryContainer, "failed to restart container %s: %w\n%s", name, err, output)
+		}
+	}
+	return current.ID, nil
+}
+
+// superviseSession runs a session in containerID with run, and while the
+// daemon restarts under it, waits for the daemon, finds the container again
+// and runs the session in it anew. execArgs are the runtime arguments naming
+// containerID, passed to run with the current container's ID. It returns the
+// container the last session ran in and that session's result.
+func superviseSession(dockerClient DockerClient, containerID string, execArgs []string, run func(execArgs []string, containerID string) error) (string, error) {
+	target, err := inspectSessionContainer(dockerClient, containerID)
+	if err != nil {
+		// Without a name to find the container by, there's nothing to reattach to
+		return containerID, run(execArgs, containerID)
+	}
+	original := containerID
+	for {
+		watch := watchDaemon(dockerClient)
+		runErr := run(withContainerID(execArgs, original, containerID), containerID)
+		lost := watch.Stop()
+		if runErr == nil || (!lost && daemonReachable(dockerClient)) {
+			return containerID, runErr
+		}
+
+		fmt.Fprintf(os.Stderr, "The %s daemon restarted; reattaching to %s...\n", dockerClient.Command(), target.Name)
+		newID, err := reattachContainer(dockerClient, target.Name)
+		if err != nil {
+			return containerID, err
+		}
+		containerID = newID
+	}
+}
+
+// withContainerID returns execArgs with the original container's ID replaced by id
+func withContainerID(execArgs []string, original, id string) []string {
+	if original == id {
+		return execArgs
+	}
+	args := make([]string, len(execArgs))
+	for i, arg := range execArgs {
+		if arg == original {
+			arg = id
+		}
+		args[i] = arg
+	}
+	return args
+}
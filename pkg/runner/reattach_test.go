@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// useFastDaemonPolling makes daemon checks quick for a test
+func useFastDaemonPolling(t *testing.T) {
+	origInterval, origTimeout := daemonPollInterval, daemonWaitTimeout
+	t.Cleanup(func() { daemonPollInterval, daemonWaitTimeout = origInterval, origTimeout })
+	daemonPollInterval, daemonWaitTimeout = 5*time.Millisecond, time.Second
+}
+
+func TestSuperviseSessionReattachesAfterDaemonRestart(t *testing.T) {
+	useFastDaemonPolling(t)
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{ID: "abc123", Name: "packnplay-app-main", Running: true})
+	var down atomic.Int32
+	fake.On(func([]string) (string, error) {
+		if down.Load() > 0 {
+			down.Add(-1)
+			return "Cannot connect to the Docker daemon at unix:///var/run/docker.sock", errdefs.New(errdefs.CategoryRuntimeUnavailable, errors.New("exit status 1"))
+		}
+		return "Server: Docker Engine", nil
+	}, "version")
+
+	var sessions [][]string
+	containerID, err := superviseSession(fake, "abc123", []string{"docker", "exec", "-w", "/src", "abc123", "bash"}, func(execArgs []string, containerID string) error {
+		sessions = append(sessions, execArgs)
+		if len(sessions) > 1 {
+			return nil
+		}
+		// The daemon restarts, replacing the container with a stopped one
+		_, _ = fake.Run("rm", "-f", "abc123")
+		fake.AddContainer(dockertest.Container{ID: "def456", Name: "packnplay-app-main"})
+		down.Store(3)
+		return errors.New("exit status 1")
+	})
+
+	if err != nil || containerID != "def456" {
+		t.Fatalf("superviseSession() = %s, %v; want the session rerun in def456", containerID, err)
+	}
+	if len(sessions) != 2 || sessions[1][4] != "def456" {
+		t.Errorf("sessions = %v, want the second exec into def456", sessions)
+	}
+	if !fake.Container("def456").Running {
+		t.Error("the stopped container should be started again")
+	}
+}
+
+func TestSuperviseSessionKeepsCommandFailure(t *testing.T) {
+	useFastDaemonPolling(t)
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{ID: "abc123", Name: "packnplay-app-main", Running: true})
+
+	runs := 0
+	failure := errors.New("exit status 3")
+	_, err := superviseSession(fake, "abc123", []string{"docker", "exec", "abc123", "false"}, func([]string, string) error {
+		runs++
+		return failure
+	})
+	if !errors.Is(err, failure) || runs != 1 {
+		t.Errorf("superviseSession() = %v after %d runs, want the command's own failure once", err, runs)
+	}
+	if len(fake.CallsTo("start")) != 0 {
+		t.Errorf("nothing should be restarted: %v", fake.Calls())
+	}
+}
+
+func TestSuperviseSessionGivesUpOnDaemon(t *testing.T) {
+	useFastDaemonPolling(t)
+	daemonWaitTimeout = 20 * time.Millisecond
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{ID: "abc123", Name: "packnplay-app-main", Running: true})
+
+	_, err := superviseSession(fake, "abc123", []string{"docker", "exec", "abc123", "bash"}, func([]string, string) error {
+		fake.Fail(errors.New("exit status 1"), "Cannot connect to the Docker daemon", "version")
+		return errors.New("exit status 1")
+	})
+	if errdefs.CategoryOf(err) != errdefs.CategoryRuntimeUnavailable {
+		t.Errorf("superviseSession() error = %v, want the daemon reported unavailable", err)
+	}
+}
+
+func TestRunWithReattachSupervisesCommand(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	lookPath = func(string) (string, error) { return "/bin/true", nil }
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"agent"}, Reattach: true}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if call.path != "" {
+		t.Errorf("with --reattach packnplay should supervise the command, not exec %s", call.path)
+	}
+}
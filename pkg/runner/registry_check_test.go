@@ -5,21 +5,21 @@ import (
 	"testing"
 	"time"
 
+	"github.com/obra/packnplay/pkg/config"
 	"github.com/obra/packnplay/pkg/docker"
 )
 
 func TestGetRemoteImageInfo(t *testing.T) {
 	// Test getting version info from remote registry
 
-	// Skip if no network/docker available
-	dockerClient, err := NewTestDockerClient()
-	if err != nil {
+	// Skip if no docker available
+	if _, err := NewTestDockerClient(); err != nil {
 		t.Skip("Docker not available for registry testing")
 	}
 
 	imageName := "ubuntu:22.04" // Use a known stable image for testing
 
-	info, err := getRemoteImageInfo(dockerClient, imageName)
+	info, err := getRemoteImageInfo(imageName)
 	if err != nil {
 		if isTransientRegistryError(err) {
 			t.Skipf("Skipping due to transient registry error: %v", err)
@@ -148,3 +148,68 @@ func containsString(s, substr string) bool {
 }
 
 // Types are implemented in runner.go
+
+// inspectClient answers image inspect with fixed output
+type inspectClient struct {
+	mockDockerClient
+	inspectOutput string
+}
+
+func (c *inspectClient) Run(args ...string) (string, error) {
+	if len(args) > 1 && args[0] == "image" && args[1] == "inspect" {
+		return c.inspectOutput, nil
+	}
+	return c.mockDockerClient.Run(args...)
+}
+
+func TestGetLocalImageInfo(t *testing.T) {
+	client := &inspectClient{inspectOutput: `["ghcr.io/obra/packnplay/devcontainer@sha256:abc123def456"]|2024-05-01T10:00:00.123456789Z`}
+	info, err := getLocalImageInfo(client, "ghcr.io/obra/packnplay/devcontainer:latest")
+	if err != nil {
+		t.Fatalf("getLocalImageInfo() error = %v", err)
+	}
+	if info.Digest != "sha256:abc123def456" {
+		t.Errorf("Digest = %q, want sha256:abc123def456", info.Digest)
+	}
+	if info.Created.IsZero() {
+		t.Error("Created should be parsed")
+	}
+
+	built := &inspectClient{inspectOutput: `[]|2024-05-01T10:00:00Z`}
+	if _, err := getLocalImageInfo(built, "packnplay-myproject-devcontainer:latest"); err == nil {
+		t.Error("getLocalImageInfo() should fail for an image without a registry digest")
+	}
+}
+
+func TestCheckAndNotifyAboutUpdates(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	image := "ghcr.io/obra/packnplay/devcontainer:latest"
+
+	remoteCalls := 0
+	origDigest := registryDigest
+	registryDigest = func(ref string) (string, error) {
+		remoteCalls++
+		return "sha256:new456", nil
+	}
+	defer func() { registryDigest = origDigest }()
+
+	client := &inspectClient{inspectOutput: `["ghcr.io/obra/packnplay/devcontainer@sha256:old123"]|2024-05-01T10:00:00Z`}
+	if err := checkAndNotifyAboutUpdates(client, image, false); err != nil {
+		t.Fatalf("checkAndNotifyAboutUpdates() error = %v", err)
+	}
+	if remoteCalls != 1 {
+		t.Fatalf("registry checked %d times, want 1", remoteCalls)
+	}
+
+	tracking, err := config.LoadVersionTracking(config.GetVersionTrackingPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracking.Notifications[image].Digest != "sha256:new456" {
+		t.Errorf("notification not recorded: %+v", tracking.Notifications)
+	}
+	if tracking.LastCheck.IsZero() {
+		t.Error("LastCheck should be recorded")
+	}
+}
@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+// containerEnvironment returns the environment an existing container was created with
+func containerEnvironment(client DockerClient, containerID string) map[string]string {
+	output, err := client.Run("inspect", "--format", "{{json .Config.Env}}", containerID)
+	if err != nil {
+		return make(map[string]string)
+	}
+	return parseEnvJSON(output)
+}
+
+// imageEnvironment returns the ENV baked into an image
+func imageEnvironment(client DockerClient, image string) map[string]string {
+	output, err := client.Run("image", "inspect", "--format", "{{json .Config.Env}}", image)
+	if err != nil {
+		return make(map[string]string)
+	}
+	return parseEnvJSON(output)
+}
+
+// expandEnvReferences expands $VAR and ${VAR} in value from env, as Dockerfile ENV does
+func expandEnvReferences(value string, env map[string]string) string {
+	return os.Expand(value, func(name string) string {
+		return env[name]
+	})
+}
+
+// parseEnvJSON parses a {{json .Config.Env}} list of KEY=VALUE entries
+func parseEnvJSON(output string) map[string]string {
+	env := make(map[string]string)
+	var entries []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &entries); err != nil {
+		return env
+	}
+	for _, entry := range entries {
+		if k, v, ok := strings.Cut(entry, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// refreshRemoteEnv re-evaluates remoteEnv against the current host environment so
+// changes made since the container was created (a rotated API key, say) reach
+// commands exec'd into it. Returns sorted KEY=VALUE pairs to pass with -e.
+func refreshRemoteEnv(client DockerClient, containerID string, devConfig *devcontainer.Config, mountPath, workingDir string, verbose bool) []string {
+	if len(devConfig.RemoteEnv) == 0 {
+		return nil
+	}
+
+	current := containerEnvironment(client, containerID)
+	ctx := &devcontainer.SubstituteContext{
+		LocalWorkspaceFolder:     mountPath,
+		ContainerWorkspaceFolder: workingDir,
+		LocalEnv:                 getLocalEnvMap(),
+		ContainerEnv:             current,
+		DevContainerID:           devcontainer.DevContainerID(mountPath, devcontainer.ConfigFilePath(mountPath)),
+	}
+	resolved := devConfig.ResolveRemoteEnv(ctx)
+
+	keys := make([]string, 0, len(resolved))
+	for k := range resolved {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, resolved[k]))
+		if verbose && current[k] != resolved[k] {
+			fmt.Fprintf(os.Stderr, "remoteEnv %s changed on the host since the container was created; using the new value\n", k)
+		}
+	}
+	return env
+}
+
+// RemoteEnv resolves the project's remoteEnv for a command exec'd into a
+// running container from outside a run, such as attach: against the invoking
+// shell's environment and the container's, with the container's working
+// directory as the workspace folder unless devcontainer.json sets one.
+// Returns sorted KEY=VALUE pairs to pass with -e.
+func RemoteEnv(client DockerClient, containerName string, devConfig *devcontainer.Config, mountPath string) []string {
+	if devConfig == nil || len(devConfig.RemoteEnv) == 0 {
+		return nil
+	}
+	workingDir := devConfig.WorkspaceFolder
+	if workingDir == "" {
+		workingDir = containerInspect(client, containerName, "Config.WorkingDir")
+	}
+	return refreshRemoteEnv(client, containerName, devConfig, mountPath, workingDir, false)
+}
+
+// envArgs turns KEY=VALUE pairs into docker exec -e flags
+func envArgs(env []string) []string {
+	args := make([]string, 0, len(env)*2)
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	return args
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRefreshRemoteEnv(t *testing.T) {
+	t.Setenv("PACKNPLAY_TEST_API_KEY", "rotated-key")
+
+	client := &mockDockerClient{inspectOut: `["PATH=/usr/bin","API_KEY=old-key","HOME=/home/vscode"]` + "\n"}
+	devConfig := &devcontainer.Config{
+		RemoteEnv: map[string]string{
+			"API_KEY":   "${localEnv:PACKNPLAY_TEST_API_KEY}",
+			"TOOL_PATH": "${containerEnv:HOME}/bin",
+			"REMOVED":   "",
+		},
+	}
+
+	got := refreshRemoteEnv(client, "abc123", devConfig, "/host/project", "/workspace", false)
+	want := []string{"API_KEY=rotated-key", "TOOL_PATH=/home/vscode/bin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshRemoteEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshRemoteEnvNoRemoteEnv(t *testing.T) {
+	client := &mockDockerClient{}
+	if got := refreshRemoteEnv(client, "abc123", &devcontainer.Config{}, "/host", "/workspace", false); got != nil {
+		t.Errorf("refreshRemoteEnv() = %v, want nil", got)
+	}
+	if len(client.calls) != 0 {
+		t.Errorf("calls = %v, should not inspect without remoteEnv", client.calls)
+	}
+}
+
+func TestRemoteEnvForRunningContainer(t *testing.T) {
+	t.Setenv("PACKNPLAY_TEST_TOKEN", "from-this-shell")
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "dev", Running: true, Env: []string{"HOME=/home/vscode"}, WorkingDir: "/workspaces/app"})
+
+	devConfig := &devcontainer.Config{RemoteEnv: map[string]string{
+		"TOKEN":     "${localEnv:PACKNPLAY_TEST_TOKEN}",
+		"CACHE":     "${containerEnv:HOME}/.cache",
+		"WORKSPACE": "${containerWorkspaceFolder}",
+	}}
+	got := RemoteEnv(fake, "dev", devConfig, "/host/app")
+	want := []string{"CACHE=/home/vscode/.cache", "TOKEN=from-this-shell", "WORKSPACE=/workspaces/app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoteEnv() = %v, want %v", got, want)
+	}
+
+	if got := RemoteEnv(fake, "dev", nil, "/host/app"); got != nil {
+		t.Errorf("RemoteEnv() without a devcontainer.json = %v, want nil", got)
+	}
+}
+
+func TestLifecycleExecutorEnv(t *testing.T) {
+	client := &mockDockerClient{}
+	executor := NewLifecycleExecutor(client, "container", "vscode", false, nil)
+	executor.SetEnv([]string{"API_KEY=rotated-key"})
+
+	cmd := &devcontainer.LifecycleCommand{}
+	if err := cmd.UnmarshalJSON([]byte(`"echo hi"`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := executor.Execute("postStart", cmd); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := []string{"exec", "-u", "vscode", "-e", "API_KEY=rotated-key", "container", "/bin/sh", "-c", "echo hi"}
+	if len(client.execCalls) != 1 || !reflect.DeepEqual(client.execCalls[0], want) {
+		t.Errorf("exec calls = %v, want [%v]", client.execCalls, want)
+	}
+}
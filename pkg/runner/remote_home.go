@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultNumericHome is the home of a numeric remoteUser the image has no
+// /etc/passwd entry for, created once the container is up
+const defaultNumericHome = "/home/user"
+
+// isNumericUser reports whether a remoteUser is a UID ("1000" or "1000:1000")
+// rather than a user name
+func isNumericUser(user string) bool {
+	uid, _, _ := strings.Cut(user, ":")
+	if uid == "" {
+		return false
+	}
+	for _, r := range uid {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultRemoteHome is the remote user's home when the image isn't consulted
+func defaultRemoteHome(user string) string {
+	if isNumericUser(user) {
+		return defaultNumericHome
+	}
+	return "/home/" + user
+}
+
+// userOwner is the owner to chown the remote user's files to: user:user for a
+// name, or the UID and GID as given
+func userOwner(user string) string {
+	if strings.Contains(user, ":") {
+		return user
+	}
+	return user + ":" + user
+}
+
+// passwdHome returns the home directory of the UID of user in an /etc/passwd,
+// or "" if it has no usable entry
+func passwdHome(passwd, user string) string {
+	uid, _, _ := strings.Cut(user, ":")
+	for _, line := range strings.Split(passwd, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) < 6 || fields[2] != uid {
+			continue
+		}
+		switch home := fields[5]; home {
+		case "", "/", "/nonexistent":
+			return ""
+		default:
+			return home
+		}
+	}
+	return ""
+}
+
+// resolveRemoteHome works out the remote user's home in the container, and
+// whether it has to be created. A named user's is /home/<name>; a numeric
+// one's comes from the image's /etc/passwd, falling back to /home/user.
+func resolveRemoteHome(dockerClient DockerClient, config *RunConfig, image, user string) (string, bool) {
+	if !isNumericUser(user) {
+		return defaultRemoteHome(user), false
+	}
+	if config.DryRun {
+		// Reading /etc/passwd needs the image; a dry run doesn't pull it
+		fmt.Fprintf(os.Stderr, "Note: the home of remoteUser %s is read from the image at run time; assuming %s\n", user, defaultNumericHome)
+		return defaultNumericHome, true
+	}
+	passwd, err := dockerClient.Run("run", "--rm", "--entrypoint", "cat", image, "/etc/passwd")
+	if err == nil {
+		if home := passwdHome(passwd, user); home != "" {
+			return home, false
+		}
+	}
+	if config.Verbose {
+		fmt.Fprintf(os.Stderr, "Image %s has no home directory for UID %s; using %s\n", image, user, defaultNumericHome)
+	}
+	return defaultNumericHome, true
+}
+
+// ensureRemoteHome creates the remote user's home directory, owned by them
+func ensureRemoteHome(dockerClient DockerClient, containerID, user, home string) error {
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "mkdir", "-p", home); err != nil {
+		return fmt.Errorf("failed to create home directory %s: %w\n%s", home, err, output)
+	}
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "chown", userOwner(user), home); err != nil {
+		return fmt.Errorf("failed to give %s home directory %s: %w\n%s", user, home, err, output)
+	}
+	return nil
+}
+
+// containerRemoteHome returns the home of user in a running container: the
+// HOME it was created with, for a numeric user
+func containerRemoteHome(dockerClient DockerClient, containerID, user string) string {
+	if !isNumericUser(user) {
+		return defaultRemoteHome(user)
+	}
+	if output, err := dockerClient.Run("exec", "-u", user, containerID, "printenv", "HOME"); err == nil && strings.HasPrefix(strings.TrimSpace(output), "/") {
+		return strings.TrimSpace(output)
+	}
+	return defaultNumericHome
+}
@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestIsNumericUser(t *testing.T) {
+	for user, want := range map[string]bool{
+		"1000":      true,
+		"1000:1000": true,
+		"0":         true,
+		"vscode":    false,
+		"user1":     false,
+		":1000":     false,
+		"":          false,
+	} {
+		if got := isNumericUser(user); got != want {
+			t.Errorf("isNumericUser(%q) = %v, want %v", user, got, want)
+		}
+	}
+}
+
+func TestPasswdHome(t *testing.T) {
+	passwd := "root:x:0:0:root:/root:/bin/bash\n" +
+		"nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin\n" +
+		"dev:x:1000:1000::/srv/dev:/bin/sh\n"
+	for user, want := range map[string]string{
+		"1000":      "/srv/dev",
+		"1000:1000": "/srv/dev",
+		"0":         "/root",
+		"65534":     "",
+		"2000":      "",
+	} {
+		if got := passwdHome(passwd, user); got != want {
+			t.Errorf("passwdHome(%q) = %q, want %q", user, got, want)
+		}
+	}
+}
+
+// runNumericUser runs a project whose remoteUser is UID 1000 in an image with
+// the given /etc/passwd, returning the container
+func runNumericUser(t *testing.T, passwd string) (*dockertest.FakeClient, *dockertest.Container) {
+	t.Helper()
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	fake.On(func(args []string) (string, error) { return passwd, nil }, "run", "--rm", "--entrypoint", "cat")
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "1000"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	c := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if c == nil {
+		t.Fatalf("container should be created: %v", fake.Containers())
+	}
+	return fake, c
+}
+
+func TestRunNumericRemoteUserFromPasswd(t *testing.T) {
+	fake, c := runNumericUser(t, "root:x:0:0:root:/root:/bin/sh\ndev:x:1000:1000::/srv/dev:/bin/sh\n")
+
+	if !contains(c.RunArgs, "-e HOME=/srv/dev") {
+		t.Errorf("docker run args = %v, want HOME from the image's passwd", c.RunArgs)
+	}
+	if !contains(c.RunArgs, "-v "+os.Getenv("HOME")+"/.claude:/srv/dev/.claude") {
+		t.Errorf("docker run args = %v, want ~/.claude mounted in the passwd home", c.RunArgs)
+	}
+	if len(fake.CallsTo("exec", "-u", "root", c.ID, "mkdir", "-p", "/srv/dev")) != 0 {
+		t.Error("a home the image has should not be created")
+	}
+}
+
+func TestRunNumericRemoteUserWithoutPasswdEntry(t *testing.T) {
+	fake, c := runNumericUser(t, "root:x:0:0:root:/root:/bin/sh\n")
+
+	if !contains(c.RunArgs, "-e HOME="+defaultNumericHome) || !contains(c.RunArgs, "-v "+os.Getenv("HOME")+"/.claude:"+defaultNumericHome+"/.claude") {
+		t.Errorf("docker run args = %v, want %s as the home", c.RunArgs, defaultNumericHome)
+	}
+	for _, arg := range c.RunArgs {
+		if arg == "HOME=/home/1000" {
+			t.Errorf("docker run args = %v, should not build a home from the UID", c.RunArgs)
+		}
+	}
+	if len(fake.CallsTo("exec", "-u", "root", c.ID, "mkdir", "-p", defaultNumericHome)) != 1 ||
+		len(fake.CallsTo("exec", "-u", "root", c.ID, "chown", "1000:1000", defaultNumericHome)) != 1 {
+		t.Errorf("exec calls = %v, want %s created and given to UID 1000", fake.CallsTo("exec"), defaultNumericHome)
+	}
+}
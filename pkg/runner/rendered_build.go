@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// RenderedBuild is the Dockerfile a project's image is built from and the
+// files of its build context, for seeing what a build does without running
+// it. A feature build's Dockerfile is generated; the last one generated for
+// each image is kept in the state directory for a post-mortem.
+type RenderedBuild struct {
+	Image        string   // image the build tags
+	Dockerfile   string   // content of the Dockerfile
+	Generated    bool     // the Dockerfile was generated to install features
+	ContextDir   string   // build context on the host, a throwaway directory for a feature build
+	ContextFiles []string // files sent to the daemon, relative to ContextDir
+}
+
+// Format renders the Dockerfile followed by the build context's files as
+// comments, so the result is still a Dockerfile
+func (r *RenderedBuild) Format() string {
+	var sb strings.Builder
+	sb.WriteString(r.Dockerfile)
+	if !strings.HasSuffix(r.Dockerfile, "\n") {
+		sb.WriteString("\n")
+	}
+	context := r.ContextDir
+	if r.Generated {
+		context = "generated feature context"
+	}
+	fmt.Fprintf(&sb, "\n# Build context: %s (%d files)\n", context, len(r.ContextFiles))
+	for _, file := range r.ContextFiles {
+		fmt.Fprintf(&sb, "#   %s\n", file)
+	}
+	return sb.String()
+}
+
+// RenderedBuildPath is where the last Dockerfile generated for image is kept
+func RenderedBuildPath(image string) string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, _ := os.UserHomeDir()
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(image)
+	return filepath.Join(stateHome, "packnplay", "dockerfiles", name+".Dockerfile")
+}
+
+// newRenderedBuild lists the files a build of dockerfile from contextDir
+// sends, after the .dockerignore Docker would use (dockerfilePath's own, or
+// the context's)
+func newRenderedBuild(image, dockerfile, contextDir, dockerfilePath string, generated bool) (*RenderedBuild, error) {
+	ignore, _ := loadDockerIgnore(contextDir, dockerfilePath)
+	rendered := &RenderedBuild{Image: image, Dockerfile: dockerfile, Generated: generated, ContextDir: contextDir}
+	err := walkContext(contextDir, ignore, func(rel string, entry fs.DirEntry) error {
+		rendered.ContextFiles = append(rendered.ContextFiles, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list build context %s: %w", contextDir, err)
+	}
+	return rendered, nil
+}
+
+// saveRenderedBuild keeps a generated Dockerfile, best effort
+func saveRenderedBuild(rendered *RenderedBuild, err error, verbose bool) {
+	if err == nil {
+		path := RenderedBuildPath(rendered.Image)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+			err = os.WriteFile(path, []byte(rendered.Format()), 0644)
+		}
+	}
+	if err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to keep the generated Dockerfile: %v\n", err)
+	}
+}
+
+// RenderBuild works out the Dockerfile and build context the image of
+// devConfig is built from, generating the Dockerfile of a feature build,
+// without building anything
+func (im *ImageManager) RenderBuild(devConfig *devcontainer.Config, projectPath string, lockfile *devcontainer.LockFile) (*RenderedBuild, error) {
+	imageName := container.GenerateImageName(projectPath)
+	if len(devConfig.Features) > 0 {
+		build, err := im.prepareFeatureBuild(devConfig, projectPath, lockfile)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(build.contextDir)
+		_, content, err := build.generate(devConfig.RemoteUser)
+		if err != nil {
+			return nil, err
+		}
+		return newRenderedBuild(imageName, content, build.contextDir, "", true)
+	}
+
+	if !devConfig.HasDockerfile() {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "the project uses image %s as is; there is no Dockerfile to render", devConfig.Image)
+	}
+	dockerfilePath, contextPath := devConfig.BuildPaths(projectPath)
+	data, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to read Dockerfile: %w", err)
+	}
+	return newRenderedBuild(imageName, string(data), contextPath, dockerfilePath, false)
+}
+
+// LastRenderedBuild reads the Dockerfile the last feature build of the
+// project at config.Path generated, as formatted by RenderedBuild.Format
+func LastRenderedBuild(config *RunConfig) (string, error) {
+	project := *config
+	project.NoWorktree = true
+	ws, err := ResolveWorkspace(&project)
+	if err != nil {
+		return "", err
+	}
+	image := container.GenerateImageName(ws.MountPath)
+	data, err := os.ReadFile(RenderedBuildPath(image))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no generated Dockerfile kept for %s; only feature builds generate one", image)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the last generated Dockerfile: %w", err)
+	}
+	return string(data), nil
+}
+
+// RenderProjectBuild resolves the project at config.Path, as a run would,
+// and renders its image build
+func RenderProjectBuild(config *RunConfig) (*RenderedBuild, error) {
+	project := *config
+	project.NoWorktree = true
+	ws, err := ResolveWorkspace(&project)
+	if err != nil {
+		return nil, err
+	}
+	devConfig, err := ResolveConfig(&project, ws)
+	if err != nil {
+		return nil, err
+	}
+	if len(devConfig.GetDockerComposeFiles()) > 0 {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "the project's images are built by Docker Compose; there is no Dockerfile to render")
+	}
+	lockfile, err := devcontainer.LoadLockFile(ws.MountPath)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load lockfile: %w", err)
+	}
+	mirrors, err := registryMirrors(config.Registry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rendering resolves and stages features but never talks to the runtime
+	imageManager := NewImageManager(nil, config.Verbose)
+	imageManager.SetSkipFeatureValidation(config.SkipFeatureValidation)
+	imageManager.SetMirrors(mirrors)
+	return imageManager.RenderBuild(devConfig, ws.MountPath, lockfile)
+}
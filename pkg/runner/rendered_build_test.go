@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+)
+
+func TestRenderProjectBuild_Dockerfile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	project := newProject(t, `{"build": {"dockerfile": "Dockerfile", "context": ".."}}`)
+	files := map[string]string{
+		".devcontainer/Dockerfile": "FROM ubuntu:22.04\nCOPY . /src\n",
+		".dockerignore":            "secrets\n",
+		"main.go":                  "package main\n",
+		"secrets/token":            "hunter2\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(project, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rendered, err := RenderProjectBuild(&RunConfig{Path: project})
+	if err != nil {
+		t.Fatalf("RenderProjectBuild() error = %v", err)
+	}
+	if rendered.Generated {
+		t.Error("a plain Dockerfile build should not be marked generated")
+	}
+	if rendered.Image != container.GenerateImageName(project) {
+		t.Errorf("Image = %q, want the project's image", rendered.Image)
+	}
+	if !slices.Contains(rendered.ContextFiles, "main.go") {
+		t.Errorf("ContextFiles = %v, want main.go", rendered.ContextFiles)
+	}
+	if slices.Contains(rendered.ContextFiles, filepath.Join("secrets", "token")) {
+		t.Errorf("ContextFiles = %v, should honor .dockerignore", rendered.ContextFiles)
+	}
+
+	out := rendered.Format()
+	if !strings.HasPrefix(out, "FROM ubuntu:22.04\nCOPY . /src\n") {
+		t.Errorf("Format() should start with the Dockerfile, got:\n%s", out)
+	}
+	if !strings.Contains(out, "# Build context: "+project+" (") || !strings.Contains(out, "#   main.go\n") {
+		t.Errorf("Format() should list the build context, got:\n%s", out)
+	}
+}
+
+func TestRenderBuild_NestedConfig(t *testing.T) {
+	project := t.TempDir()
+	configDir := filepath.Join(project, ".devcontainer", "python")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "Dockerfile"), []byte("FROM python:3.12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "requirements.txt"), []byte("requests\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	devConfig := &devcontainer.Config{Build: &devcontainer.BuildConfig{Dockerfile: "Dockerfile", Context: "../.."}}
+	devConfig.SetPath(filepath.Join(configDir, "devcontainer.json"))
+
+	rendered, err := NewImageManager(nil, false).RenderBuild(devConfig, project, nil)
+	if err != nil {
+		t.Fatalf("RenderBuild() error = %v", err)
+	}
+	if rendered.Dockerfile != "FROM python:3.12\n" {
+		t.Errorf("Dockerfile = %q, want the one next to the nested devcontainer.json", rendered.Dockerfile)
+	}
+	if rendered.ContextDir != project || !slices.Contains(rendered.ContextFiles, "requirements.txt") {
+		t.Errorf("context = %s %v, want the project root", rendered.ContextDir, rendered.ContextFiles)
+	}
+}
+
+func TestRenderProjectBuild_ImageOnly(t *testing.T) {
+	project := newProject(t, `{"image": "ubuntu:22.04"}`)
+	if _, err := RenderProjectBuild(&RunConfig{Path: project}); err == nil {
+		t.Fatal("expected an error for a project without a Dockerfile")
+	}
+}
+
+func TestRenderBuild_FeaturesKeptAfterBuild(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	project := t.TempDir()
+	featureDir := filepath.Join(project, ".devcontainer", "test-feature")
+	if err := os.MkdirAll(featureDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(featureDir, "devcontainer-feature.json"), []byte(`{"id": "test-feature", "version": "1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(featureDir, "install.sh"), []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	devConfig := &devcontainer.Config{
+		Image:    "ubuntu:22.04",
+		Features: map[string]interface{}{"./test-feature": map[string]interface{}{}},
+	}
+
+	rendered, err := NewImageManager(nil, false).RenderBuild(devConfig, project, nil)
+	if err != nil {
+		t.Fatalf("RenderBuild() error = %v", err)
+	}
+	if !rendered.Generated || !strings.Contains(rendered.Dockerfile, "FROM ubuntu:22.04") {
+		t.Errorf("expected a generated Dockerfile from the base image, got:\n%s", rendered.Dockerfile)
+	}
+	if len(rendered.ContextFiles) == 0 {
+		t.Error("expected the staged feature files in the build context")
+	}
+	if _, err := os.Stat(RenderedBuildPath(rendered.Image)); !os.IsNotExist(err) {
+		t.Error("rendering should not keep the Dockerfile; only builds do")
+	}
+
+	mockClient := &mockDockerClient{}
+	if err := NewImageManager(mockClient, false).EnsureAvailable(devConfig, project); err != nil {
+		t.Fatalf("EnsureAvailable() error = %v", err)
+	}
+	kept, err := os.ReadFile(RenderedBuildPath(rendered.Image))
+	if err != nil {
+		t.Fatalf("the build should keep its generated Dockerfile: %v", err)
+	}
+	if !strings.HasPrefix(string(kept), rendered.Dockerfile) {
+		t.Errorf("kept Dockerfile differs from the rendered one:\n%s", kept)
+	}
+	if !strings.Contains(string(kept), "# Build context: generated feature context") {
+		t.Errorf("kept Dockerfile should list the build context:\n%s", kept)
+	}
+}
+
+func TestRenderedBuildPath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	got := RenderedBuildPath("packnplay-myproj-abc123:latest")
+	want := filepath.Join("/state", "packnplay", "dockerfiles", "packnplay-myproj-abc123_latest.Dockerfile")
+	if got != want {
+		t.Errorf("RenderedBuildPath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// restartPolicy returns the restart policy a new container is created with:
+// customizations.packnplay.restartPolicy, else the restart_policy setting
+func restartPolicy(config *RunConfig, devConfig *devcontainer.Config) (string, error) {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return "", errdefs.New(errdefs.CategoryConfig, err)
+	}
+	if custom.RestartPolicy != "" {
+		return custom.RestartPolicy, nil
+	}
+	switch config.RestartPolicy {
+	case "", devcontainer.RestartNo, devcontainer.RestartOnFailure, devcontainer.RestartUnlessStopped:
+		return config.RestartPolicy, nil
+	default:
+		return "", errdefs.Errorf(errdefs.CategoryConfig, "invalid restart_policy %q (use no, on-failure, or unless-stopped)", config.RestartPolicy)
+	}
+}
+
+// restartPolicyArgs returns the run arguments applying the container's
+// restart policy. Ephemeral containers are removed when they stop, so they
+// are never restarted.
+func restartPolicyArgs(dockerClient DockerClient, config *RunConfig, devConfig *devcontainer.Config) ([]string, error) {
+	policy, err := restartPolicy(config, devConfig)
+	if err != nil || policy == "" || policy == devcontainer.RestartNo || config.Ephemeral {
+		return nil, err
+	}
+	if !runtimeSupports(dockerClient).RestartPolicies {
+		fmt.Fprintf(os.Stderr, "Warning: %s has no restart policies; ignoring restart policy %s\n", runtimeBackend(dockerClient).Name(), policy)
+		return nil, nil
+	}
+	return []string{"--restart", policy}, nil
+}
+
+// containerStartedAt returns when the runtime last started the container, or
+// "" when it can't tell
+func containerStartedAt(dockerClient DockerClient, containerID string) string {
+	if !runtimeSupports(dockerClient).Inspect {
+		return ""
+	}
+	output, err := dockerClient.Run("inspect", "--type", "container", "--format", "{{.State.StartedAt}}", containerID)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(output)
+}
+
+// recordContainerStart notes the container's current start in its metadata.
+// It reports whether the container started again since the start recorded
+// before, which packnplay didn't see when the runtime restarted it on its own
+// (a restart policy after a reboot or daemon restart).
+func recordContainerStart(dockerClient DockerClient, containerID string, verbose bool) bool {
+	startedAt := containerStartedAt(dockerClient, containerID)
+	if startedAt == "" {
+		return false
+	}
+	metadata, err := LoadMetadata(containerID)
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to load metadata: %v\n", err)
+		}
+		return false
+	}
+	if metadata.StartedAt == startedAt && metadata.Runtime == dockerClient.Command() {
+		return false
+	}
+	restarted := metadata.StartedAt != "" && metadata.StartedAt != startedAt
+	metadata.StartedAt = startedAt
+	metadata.Runtime = dockerClient.Command()
+	if err := SaveMetadata(metadata); err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save metadata: %v\n", err)
+	}
+	return restarted
+}
@@ -0,0 +1,95 @@
+package runner
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+)
+
+func TestRunRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		devConfig string
+		config    RunConfig
+		want      string
+	}{
+		{"setting", `{"image": "alpine:3.20", "remoteUser": "root"}`, RunConfig{RestartPolicy: "on-failure"}, "--restart on-failure"},
+		{"customization wins", `{"image": "alpine:3.20", "remoteUser": "root", "customizations": {"packnplay": {"restartPolicy": "unless-stopped"}}}`, RunConfig{RestartPolicy: "on-failure"}, "--restart unless-stopped"},
+		{"no", `{"image": "alpine:3.20", "remoteUser": "root"}`, RunConfig{RestartPolicy: "no"}, ""},
+		{"ephemeral", `{"image": "alpine:3.20", "remoteUser": "root"}`, RunConfig{RestartPolicy: "unless-stopped", Ephemeral: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeRuntime(t, dockertest.New())
+			config := tt.config
+			config.Path, config.NoWorktree = newProject(t, tt.devConfig), true
+
+			spec := dryRunSpec(t, &config)
+			restart := slices.IndexFunc(spec.RunArgs, func(arg string) bool { return strings.HasPrefix(arg, "--restart") })
+			if tt.want == "" && restart >= 0 {
+				t.Errorf("docker run args = %v, want no restart policy", spec.RunArgs)
+			}
+			if tt.want != "" && !contains(spec.RunArgs, tt.want) {
+				t.Errorf("docker run args = %v, want %s", spec.RunArgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunRejectsInvalidRestartPolicy(t *testing.T) {
+	useFakeRuntime(t, dockertest.New())
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	err := Run(&RunConfig{Path: project, NoWorktree: true, RestartPolicy: "always", DryRun: true, Command: []string{"bash"}})
+	if errdefs.CategoryOf(err) != errdefs.CategoryConfig {
+		t.Errorf("Run() error = %v, want a config error", err)
+	}
+}
+
+func TestRunReconnectNoticesRuntimeRestart(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	reuse := func() string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, Command: []string{"bash"}, Events: events.New(&buf)}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		for _, event := range decodeEvents(t, buf.Bytes()) {
+			if event.Type == events.TypeContainerReused {
+				return event.Status
+			}
+		}
+		t.Fatalf("no container.reused event in %s", buf.String())
+		return ""
+	}
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if status := reuse(); status == "restarted" {
+		t.Errorf("reconnect status = %s, the container has not restarted", status)
+	}
+
+	// The runtime restarts the container behind packnplay's back
+	containers := fake.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("containers = %v, want one", containers)
+	}
+	containers[0].StartedAt = containers[0].StartedAt.Add(time.Hour)
+	if status := reuse(); status != "restarted" {
+		t.Errorf("reconnect status = %s, want the runtime's restart noticed", status)
+	}
+	if status := reuse(); status == "restarted" {
+		t.Errorf("reconnect status = %s, the restart was already noticed", status)
+	}
+}
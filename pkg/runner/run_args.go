@@ -0,0 +1,714 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/aws"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/credstore"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// keepAliveScript keeps the container running until it is stopped, exiting
+// cleanly on SIGTERM (the Microsoft pattern)
+const keepAliveScript = "echo 'Container started' && trap 'exit 0' 15 && while true; do sleep 1 & wait $!; done"
+
+// runArgsBuilder assembles the docker run arguments of a RunSpec. BuildRunSpec
+// appends what each of its steps returns, in order.
+type runArgsBuilder struct {
+	dockerClient   DockerClient
+	config         *RunConfig
+	ws             *Workspace
+	devConfig      *devcontainer.Config
+	supports       docker.Capabilities
+	runtimeName    string // the runtime's name, for errors about what it can't do
+	containerName  string
+	devcontainerID string
+	labels         map[string]string
+	homeDir        string // the host user's home
+	remoteHome     string // the remote user's home in the container
+	workingDir     string // workspaceFolder, or the workspace's host path
+	isLinux        bool
+}
+
+// substituteContext resolves ${...} variables in devcontainer.json values
+func (b *runArgsBuilder) substituteContext() *devcontainer.SubstituteContext {
+	return &devcontainer.SubstituteContext{
+		LocalWorkspaceFolder:     b.ws.MountPath,
+		ContainerWorkspaceFolder: b.workingDir,
+		LocalEnv:                 getLocalEnvMap(),
+		ContainerEnv:             make(map[string]string),
+		DevContainerID:           b.devcontainerID,
+		Labels:                   b.labels,
+	}
+}
+
+// prepareClaudeCredentials decides where the container's Claude credentials
+// come from, returning the file mounted over ~/.claude/.credentials.json when
+// they need one. An ephemeral container's file is new and for the caller to remove.
+func prepareClaudeCredentials(config *RunConfig, homeDir string) (ClaudeCredentials, string, error) {
+	hostCredFile := filepath.Join(homeDir, ".claude", ".credentials.json")
+	claudeCreds, err := resolveClaudeCredentials(config.Credentials.Claude, hostCredFile)
+	if err != nil {
+		return ClaudeCredentials{}, "", err
+	}
+	if config.Verbose {
+		fmt.Fprintf(os.Stderr, "Claude credentials: %s (%s)\n", claudeCreds.Source, claudeCreds.Reason)
+	}
+	if !claudeCreds.Overlay() {
+		return claudeCreds, "", nil
+	}
+
+	var credentialFile string
+	switch {
+	case config.DryRun && config.Ephemeral:
+		credentialFile = filepath.Join(credstore.RuntimeDir(), "ephemeral-credentials-*.json")
+	case config.DryRun:
+		credentialFile = containerCredentialFilePath()
+	case config.Ephemeral:
+		credentialFile, err = createEphemeralCredentialFile(config.CredentialStore)
+	default:
+		credentialFile, err = getOrCreateContainerCredentialFile(config.CredentialStore)
+	}
+	if err != nil {
+		return ClaudeCredentials{}, "", fmt.Errorf("failed to get credential file: %w", err)
+	}
+	return claudeCreds, credentialFile, nil
+}
+
+// mountArgs mounts ~/.claude (with credentialFile over its credentials, if
+// any), the workspace, the agents' config directories and, for a worktree, the
+// main repository's .git directory
+func (b *runArgsBuilder) mountArgs(agentVolumes []AgentVolume, credentialFile string) ([]string, error) {
+	var args []string
+	homeDir, remoteHome, mountPath := b.homeDir, b.remoteHome, b.ws.MountPath
+
+	// Mount .claude directory, unless it's isolated (the MountBuilder mounts its volume)
+	if _, isolated := findAgentVolume(agentVolumes, "claude"); !isolated {
+		args = append(args, "-v", fmt.Sprintf("%s/.claude:%s/.claude", homeDir, remoteHome))
+	}
+
+	// Overlay mount credential file after .claude directory mount
+	if credentialFile != "" {
+		args = append(args, "-v", fmt.Sprintf("%s:%s/.claude/.credentials.json", credentialFile, remoteHome))
+	}
+
+	// Mount workspace - the clone volume, workspaceMount if specified, otherwise default -v
+	if b.ws.Volume != nil {
+		// The repository is cloned into the volume once the container is up
+		if b.devConfig.WorkspaceMount != "" && b.config.Verbose {
+			fmt.Fprintf(os.Stderr, "Ignoring workspaceMount: the workspace is cloned into volume %s\n", b.ws.Volume.Name)
+		}
+		args = append(args, "--mount", fmt.Sprintf("type=volume,source=%s,target=%s", b.ws.Volume.Name, b.ws.Volume.Target))
+	} else if b.devConfig.WorkspaceMount != "" {
+		// Validate that workspaceFolder is also set (Microsoft spec requirement)
+		if b.devConfig.WorkspaceFolder == "" {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "workspaceMount requires workspaceFolder to be set")
+		}
+
+		// Perform variable substitution on workspaceMount
+		substituted := devcontainer.Substitute(b.substituteContext(), b.devConfig.WorkspaceMount)
+		mountSpec, ok := substituted.(string)
+		if !ok {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "workspaceMount substitution did not produce a string")
+		}
+
+		// Use Docker --mount syntax
+		args = append(args, "--mount", mountSpec)
+	} else {
+		// Default behavior: mount workspace at host path (preserving absolute paths)
+		args = append(args, "-v", fmt.Sprintf("%s:%s", mountPath, mountPath))
+	}
+
+	// Mount AI agent config directories using MountBuilder (replaces hardcoded list)
+	mountBuilder := NewMountBuilder(homeDir, remoteHome)
+	args = append(args, mountBuilder.BuildAgentMounts(agentVolumes)...)
+
+	// If using a worktree, also mount the main repo's .git directory at its real path
+	// This allows the worktree's .git file (which contains gitdir: <path>) to resolve correctly
+	if gitDir := b.ws.MainRepoGitDir; gitDir != "" {
+		args = append(args, "-v", fmt.Sprintf("%s:%s", gitDir, gitDir))
+	}
+	return args, nil
+}
+
+// credentialArgs mounts git config, SSH keys or the SSH agent, and gh
+// credentials, returning the repository gh credentials are a token minted for
+// and whether they're withheld (see planRepoGHToken)
+func (b *runArgsBuilder) credentialArgs() (args []string, ghRepo string, ghWithheld bool, err error) {
+	config, homeDir, remoteHome := b.config, b.homeDir, b.remoteHome
+
+	// Mount git config (copy injection happens after the container starts)
+	if config.Credentials.Git && !copyInjected(config.Credentials, "git") {
+		gitconfigPath := filepath.Join(homeDir, ".gitconfig")
+		if fileExists(gitconfigPath) {
+			// Resolve symlinks to get the actual file path
+			resolvedPath, err := resolveMountPath(gitconfigPath)
+			if err != nil {
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Warning: failed to resolve .gitconfig symlink: %v\n", err)
+				}
+				// Fall back to original path if symlink resolution fails
+				resolvedPath = gitconfigPath
+			}
+			args = append(args, "-v", fmt.Sprintf("%s:%s/.gitconfig:ro", resolvedPath, remoteHome))
+		}
+	}
+
+	// Mount SSH keys or forward SSH agent
+	if config.Credentials.SSHAgent {
+		socketPath, err := findSSHAgentSocket()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: SSH agent forwarding not available: %v\n", err)
+		} else {
+			containerSocket := "/tmp/ssh-agent.sock"
+			args = append(args, "-v", fmt.Sprintf("%s:%s", socketPath, containerSocket))
+			args = append(args, "-e", fmt.Sprintf("SSH_AUTH_SOCK=%s", containerSocket))
+		}
+	} else if config.Credentials.SSH {
+		sshPath := filepath.Join(homeDir, ".ssh")
+		if fileExists(sshPath) {
+			args = append(args, "-v", fmt.Sprintf("%s:%s/.ssh:ro", sshPath, remoteHome))
+		}
+	} else {
+		warnSSHInsteadOfRules()
+	}
+
+	// On Linux, mount the gh config directory if it exists
+	// On macOS, gh credentials live in Keychain and are copied in after container starts;
+	// the label lets the credential watcher refresh them when the host token rotates.
+	// A token minted for the workspace's repository is copied in on every OS.
+	ghRepo, ghWithheld, err = planRepoGHToken(config.Credentials, config.GitHub, b.ws.MountPath)
+	if err != nil {
+		return nil, "", false, err
+	}
+	switch {
+	case ghRepo != "":
+		args = append(args, "--label", fmt.Sprintf("%s=%s", GHBridgeLabel, b.devConfig.RemoteUser), "--label", fmt.Sprintf("%s=%s", GHRepoLabel, ghRepo))
+	case !config.Credentials.GH || ghWithheld:
+	case b.isLinux:
+		ghConfigPath := filepath.Join(homeDir, ".config", "gh")
+		if fileExists(ghConfigPath) {
+			args = append(args, "-v", fmt.Sprintf("%s:%s/.config/gh", ghConfigPath, remoteHome))
+		}
+	default:
+		args = append(args, "--label", fmt.Sprintf("%s=%s", GHBridgeLabel, b.devConfig.RemoteUser))
+	}
+	return args, ghRepo, ghWithheld, nil
+}
+
+// hostServiceArgs mounts the host bridge socket, so the container can open
+// URLs and editors on the host, and publishes an sshd for editors that attach
+// over SSH
+func (b *runArgsBuilder) hostServiceArgs() ([]string, error) {
+	var args []string
+	config := b.config
+	if config.HostBridge && b.supports.SocketMounts {
+		// A clone volume isn't on the host, so code has no workspace to open
+		var workspace string
+		if b.ws.Volume == nil {
+			workspace = b.ws.MountPath
+		}
+		bridgeArgs, err := hostBridgeArgs(b.containerName, config.HostBridgeActions, workspace, !config.DryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: host bridge unavailable: %v\n", err)
+		} else {
+			args = append(args, bridgeArgs...)
+		}
+	}
+
+	if config.SSH {
+		if !b.supports.PortCommand {
+			return nil, errdefs.Errorf(errdefs.CategoryUsage, "--ssh is not supported with %s: it can't report published ports", b.runtimeName)
+		}
+		args = append(args, sshServerArgs(b.devConfig.RemoteUser)...)
+	}
+	return args, nil
+}
+
+// networkArgs puts the container on its sidecar services' network, where they
+// are reached by service name, and on the project network under hostname when
+// there is one. It returns the sidecars and their connection settings.
+func (b *runArgsBuilder) networkArgs(projectNetwork, hostname string) ([]string, []Sidecar, map[string]string, error) {
+	var args []string
+	devConfig := b.devConfig
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return nil, nil, nil, errdefs.Errorf(errdefs.CategoryConfig, "%w", err)
+	}
+	// forwardPorts entries such as "db:5432" are published by the sidecar they name
+	servicePorts, err := devcontainer.ServiceForwardPorts(devConfig.ForwardPorts)
+	if err != nil {
+		return nil, nil, nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to parse forwardPorts from devcontainer.json: %w", err)
+	}
+	serviceNames := make([]string, 0, len(custom.Services))
+	for name := range custom.Services {
+		serviceNames = append(serviceNames, name)
+	}
+	if err := checkServicePorts(servicePorts, serviceNames, "customizations.packnplay.services"); err != nil {
+		return nil, nil, nil, err
+	}
+	var sidecars []Sidecar
+	var sidecarEnv map[string]string
+	if len(custom.Services) > 0 {
+		if !b.supports.Networks {
+			return nil, nil, nil, errdefs.Errorf(errdefs.CategoryUsage, "customizations.packnplay.services are not supported with %s: it has no user-defined networks", b.runtimeName)
+		}
+		if networkFromRunArgs(devConfig.RunArgs) {
+			return nil, nil, nil, errdefs.Errorf(errdefs.CategoryConfig, "customizations.packnplay.services can't be used with a --network runArg")
+		}
+		sidecars, sidecarEnv = planSidecars(b.containerName, custom.Services, servicePorts)
+		args = append(args, "--network", SidecarNetwork(b.containerName))
+	}
+	if projectNetwork != "" {
+		args = append(args, "--hostname", hostname)
+		// With sidecars the container joins the project network once it has started
+		if len(sidecars) == 0 {
+			args = append(args, "--network", projectNetwork, "--network-alias", hostname)
+		}
+	}
+	return args, sidecars, sidecarEnv, nil
+}
+
+// runtimeSocketArgs mounts the host's container runtime socket as a lighter
+// alternative to docker-in-docker, returning the socket and the kind of docker
+// feature devcontainer.json uses (see dockerFeatureKind)
+func (b *runArgsBuilder) runtimeSocketArgs() (args []string, socket, dockerFeature string, err error) {
+	dockerFeature = dockerFeatureKind(b.devConfig.Features)
+	if !b.config.DockerSocket {
+		return nil, "", dockerFeature, nil
+	}
+	if dockerFeature == "in" {
+		fmt.Fprintf(os.Stderr, "Warning: --docker-socket ignored: the docker-in-docker feature runs its own daemon\n")
+		return nil, "", dockerFeature, nil
+	}
+	if !b.supports.SocketPassthrough {
+		return nil, "", "", errdefs.Errorf(errdefs.CategoryConfig, "failed to mount docker socket: %s has no docker-compatible API socket", b.runtimeName)
+	}
+	socket, err = hostDockerSocket(b.dockerClient.Command(), b.isLinux)
+	if err != nil {
+		return nil, "", "", errdefs.Errorf(errdefs.CategoryConfig, "failed to mount docker socket: %w", err)
+	}
+	fmt.Fprint(os.Stderr, dockerSocketWarning)
+	// A docker-outside-of-docker feature mounts the socket itself and proxies it for the user
+	if dockerFeature != "outside" {
+		args = dockerSocketArgs(socket, defaultDockerSocket, b.isLinux)
+	}
+	return args, socket, dockerFeature, nil
+}
+
+// toolConfigArgs mounts OpenCode's config directory, ~/.gnupg and ~/.npmrc
+func (b *runArgsBuilder) toolConfigArgs() []string {
+	var args []string
+	config, homeDir, remoteHome := b.config, b.homeDir, b.remoteHome
+
+	// Mount OpenCode config directory if it exists (for opencode-ai CLI tool)
+	opencodeConfigPath := filepath.Join(homeDir, ".config", "opencode")
+	if fileExists(opencodeConfigPath) {
+		args = append(args, "-v", fmt.Sprintf("%s:%s/.config/opencode", opencodeConfigPath, remoteHome))
+	}
+
+	if config.Credentials.GPG {
+		// Mount .gnupg directory (read-only for security)
+		gnupgPath := filepath.Join(homeDir, ".gnupg")
+		if fileExists(gnupgPath) {
+			args = append(args, "-v", fmt.Sprintf("%s:%s/.gnupg:ro", gnupgPath, remoteHome))
+		}
+	}
+
+	if config.Credentials.NPM && !copyInjected(config.Credentials, "npm") {
+		// Mount .npmrc file
+		npmrcPath := filepath.Join(homeDir, ".npmrc")
+		if fileExists(npmrcPath) {
+			// Resolve symlinks to get the actual file path
+			resolvedPath, err := resolveMountPath(npmrcPath)
+			if err != nil {
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Warning: failed to resolve .npmrc symlink: %v\n", err)
+				}
+				// Fall back to original path if symlink resolution fails
+				resolvedPath = npmrcPath
+			}
+			args = append(args, "-v", fmt.Sprintf("%s:%s/.npmrc:ro", resolvedPath, remoteHome))
+		}
+	}
+	return args
+}
+
+// awsCredentialArgs mounts ~/.aws and returns the AWS environment variables
+// to pass: the host's static credentials, else those from the profile's
+// credential_process, else whatever AWS_* variables the host has
+func (b *runArgsBuilder) awsCredentialArgs() ([]string, map[string]string) {
+	config := b.config
+	if !config.Credentials.AWS {
+		return nil, nil
+	}
+	var args []string
+	awsCredentials := make(map[string]string)
+	var awsCredSource string
+
+	// Priority 1: Check if static credentials are already set in environment
+	if aws.HasStaticCredentials() {
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Using existing AWS credentials from environment variables\n")
+		}
+		// Get all AWS_* env vars from host, these will be added later
+		for key, value := range aws.GetAWSEnvVars() {
+			awsCredentials[key] = value
+		}
+	} else {
+		// Priority 2: Try credential_process if AWS_PROFILE is set (not in a dry run,
+		// which shouldn't run host programs)
+		awsProfile := os.Getenv("AWS_PROFILE")
+		if awsProfile != "" && !config.DryRun {
+			credentialProcess, err := aws.ParseAWSConfig(awsProfile)
+			if err != nil {
+				// Always warn, not just in verbose mode
+				fmt.Fprintf(os.Stderr, "Warning: failed to get credential_process for profile '%s': %v\n", awsProfile, err)
+			} else {
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Executing credential_process for profile '%s'\n", awsProfile)
+				}
+				creds, err := aws.GetCredentialsFromProcess(credentialProcess)
+				if err != nil {
+					// Always warn, not just in verbose mode
+					fmt.Fprintf(os.Stderr, "Warning: credential_process failed: %v\n", err)
+				} else {
+					awsCredSource = "credential_process"
+					if config.Verbose {
+						fmt.Fprintf(os.Stderr, "Successfully obtained AWS credentials from credential_process\n")
+					}
+					// Add credentials from credential_process
+					awsCredentials["AWS_ACCESS_KEY_ID"] = creds.AccessKeyID
+					awsCredentials["AWS_SECRET_ACCESS_KEY"] = creds.SecretAccessKey
+					if creds.SessionToken != "" {
+						awsCredentials["AWS_SESSION_TOKEN"] = creds.SessionToken
+					}
+					// Also include other AWS_* env vars (region, profile, etc.) but not credentials
+					for key, value := range aws.GetAWSEnvVars() {
+						if key != "AWS_ACCESS_KEY_ID" && key != "AWS_SECRET_ACCESS_KEY" && key != "AWS_SESSION_TOKEN" {
+							awsCredentials[key] = value
+						}
+					}
+				}
+			}
+		} else if config.Verbose {
+			fmt.Fprintf(os.Stderr, "No AWS_PROFILE set, skipping credential_process lookup\n")
+		}
+
+		// If credential_process didn't work, try getting from environment anyway
+		if awsCredSource == "" {
+			for key, value := range aws.GetAWSEnvVars() {
+				awsCredentials[key] = value
+			}
+			if len(awsCredentials) > 0 {
+				if config.Verbose {
+					fmt.Fprintf(os.Stderr, "Using AWS environment variables from host\n")
+				}
+			}
+		}
+	}
+
+	// Mount ~/.aws directory if it exists (read-write for SSO token refresh)
+	awsPath := filepath.Join(b.homeDir, ".aws")
+	if copyInjected(config.Credentials, "aws") {
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Copying minimized AWS config into container instead of mounting ~/.aws\n")
+		}
+	} else if fileExists(awsPath) {
+		// Use read-write mount to allow SSO token refresh and CLI caching
+		args = append(args, "-v", fmt.Sprintf("%s:%s/.aws", awsPath, b.remoteHome))
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Mounting AWS config directory (read-write for token refresh)\n")
+		}
+	} else {
+		// Always warn if ~/.aws is missing, not just in verbose
+		fmt.Fprintf(os.Stderr, "Warning: ~/.aws directory not found, AWS CLI config and SSO cache unavailable\n")
+	}
+	return args, awsCredentials
+}
+
+// envArgs passes the container's environment, each source overriding the
+// ones before it: safe terminal and locale variables from the host, HOME and
+// IS_SANDBOX, the agents' API keys, AWS credentials, the proxy, sidecar
+// connection settings, containerEnv and remoteEnv, workspace env files, and
+// finally --env flags. noProxy lists the hosts reached without the proxy.
+func (b *runArgsBuilder) envArgs(awsCredentials, sidecarEnv map[string]string, noProxy []string) ([]string, error) {
+	var args []string
+	config, devConfig, mountPath := b.config, b.devConfig, b.ws.MountPath
+
+	// Only pass safe terminal/locale variables - nothing else from host
+	safeEnvVars := []string{"TERM", "LANG", "LC_ALL", "LC_CTYPE", "LC_MESSAGES", "COLORTERM"}
+	for _, key := range safeEnvVars {
+		if value := os.Getenv(key); value != "" {
+			args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
+	// Set HOME to container user's home directory (don't use host HOME)
+	args = append(args, "-e", "HOME="+b.remoteHome)
+
+	// Add IS_SANDBOX marker so tools know they're in a sandbox
+	args = append(args, "-e", "IS_SANDBOX=1")
+
+	// Don't set PATH - use container's default PATH to avoid host pollution
+
+	// Add default environment variables (API keys for AI agents)
+	for _, envVar := range config.DefaultEnvVars {
+		if withheldGHEnv(envVar, config.GitHub) {
+			continue
+		}
+		if value := os.Getenv(envVar); value != "" {
+			args = append(args, "-e", fmt.Sprintf("%s=%s", envVar, value))
+		}
+	}
+
+	// Add AWS environment variables BEFORE user-specified env vars
+	// This allows users to override AWS credentials if needed with --env flags
+	args = append(args, awsEnvArgs(awsCredentials)...)
+
+	// Forward the host's proxy; sidecars and the project's other containers
+	// are reached directly
+	proxySettings, err := resolveProxy(config, devConfig)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, proxySettings.ForRuntime(b.dockerClient.Command(), noProxy...).RunArgs()...)
+
+	// Connection settings for sidecar services, which containerEnv can override
+	args = append(args, sortedEnvArgs(sidecarEnv)...)
+
+	// Apply environment variables from devcontainer.json with variable substitution
+	// This happens AFTER AWS credentials but BEFORE user --env flags
+	// so that user flags can override devcontainer vars
+	if devConfig.ContainerEnv != nil || devConfig.RemoteEnv != nil {
+		args = append(args, sortedEnvArgs(devConfig.GetResolvedEnvironment(b.substituteContext()))...)
+	}
+
+	// Apply workspace env files (opt-in): override devcontainer.json, overridden by --env
+	if config.LoadEnvFiles {
+		fileEnv, loaded, err := devcontainer.LoadEnvFiles(mountPath, config.LoadProjectDotEnv, b.substituteContext())
+		if err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load env file: %w", err)
+		}
+		if config.Verbose && len(loaded) > 0 {
+			fmt.Fprintf(os.Stderr, "Loaded environment from %s\n", strings.Join(loaded, ", "))
+		}
+		args = append(args, sortedEnvArgs(fileEnv)...)
+	}
+
+	// Add user-specified env vars from --env flags (these can override defaults, AWS, env files, and devcontainer)
+	for _, env := range config.Env {
+		// Support both --env KEY=value and --env KEY (pass through from host)
+		if strings.Contains(env, "=") {
+			// KEY=value format - set specific value
+			args = append(args, "-e", env)
+		} else {
+			// KEY format - pass through current value from host
+			if value := os.Getenv(env); value != "" {
+				args = append(args, "-e", fmt.Sprintf("%s=%s", env, value))
+			}
+		}
+	}
+	return args, nil
+}
+
+// awsEnvArgs passes AWS variables, the credentials first and then the others
+// (region, profile, etc.)
+func awsEnvArgs(awsCredentials map[string]string) []string {
+	var args []string
+	credentialKeys := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
+	others := make(map[string]string, len(awsCredentials))
+	for key, value := range awsCredentials {
+		others[key] = value
+	}
+	for _, key := range credentialKeys {
+		if value, exists := awsCredentials[key]; exists {
+			args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+			delete(others, key)
+		}
+	}
+	return append(args, sortedEnvArgs(others)...)
+}
+
+// sortedEnvArgs passes env in name order, so the run args don't vary
+func sortedEnvArgs(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, env[k]))
+	}
+	return args
+}
+
+// portArgs publishes devcontainer.json's forwardPorts, followed by the -p
+// flags, which take priority
+func portArgs(forwardPorts []interface{}, publishPorts []string) ([]string, error) {
+	var ports []string
+	if len(forwardPorts) > 0 {
+		devPorts, err := devcontainer.ParseForwardPorts(forwardPorts)
+		if err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to parse forwardPorts from devcontainer.json: %w", err)
+		}
+		ports = devPorts
+	}
+	ports = append(ports, publishPorts...)
+
+	args := make([]string, 0, 2*len(ports))
+	for _, port := range ports {
+		args = append(args, "-p", port)
+	}
+	return args, nil
+}
+
+// volumeArgs adds devcontainer.json's mounts, with variables substituted, and
+// the -v flags
+func (b *runArgsBuilder) volumeArgs() []string {
+	var args []string
+	for _, mount := range b.devConfig.Mounts {
+		args = append(args, "--mount", devcontainer.Substitute(b.substituteContext(), mount).(string))
+	}
+	for _, vol := range b.config.Volumes {
+		args = append(args, "-v", normalizeVolume(vol))
+	}
+	return args
+}
+
+// substitutedRunArgs returns devcontainer.json's runArgs with variables substituted
+func (b *runArgsBuilder) substitutedRunArgs() []string {
+	var runArgs []string
+	for _, runArg := range b.devConfig.RunArgs {
+		runArgs = append(runArgs, devcontainer.Substitute(b.substituteContext(), runArg).(string))
+	}
+	return runArgs
+}
+
+// securityArgs applies devcontainer.json's privileged, init, capAdd,
+// securityOpt and entrypoint, returning the entrypoint's arguments after the
+// executable. Features are applied later, so they can override these.
+func securityArgs(devConfig *devcontainer.Config) (args, entrypointArgs []string) {
+	if devConfig.Privileged != nil && *devConfig.Privileged {
+		args = append(args, "--privileged")
+	}
+
+	if devConfig.Init != nil && *devConfig.Init {
+		args = append(args, "--init")
+	}
+
+	for _, cap := range devConfig.CapAdd {
+		if cap != "" {
+			args = append(args, "--cap-add="+cap)
+		}
+	}
+
+	for _, secOpt := range devConfig.SecurityOpt {
+		if secOpt != "" {
+			args = append(args, "--security-opt="+secOpt)
+		}
+	}
+
+	if len(devConfig.Entrypoint) > 0 {
+		args = append(args, "--entrypoint="+devConfig.Entrypoint[0])
+		entrypointArgs = devConfig.Entrypoint[1:]
+	}
+	return args, entrypointArgs
+}
+
+// resolveFeatureProperties resolves devcontainer.json's features, in a stable
+// order so the run args (and a dry run's output) don't vary, for the container
+// properties they contribute. Features that don't resolve are skipped; the
+// image build reports them.
+func (b *runArgsBuilder) resolveFeatureProperties(lockfile *devcontainer.LockFile) ([]*devcontainer.ResolvedFeature, error) {
+	config, devConfig := b.config, b.devConfig
+	if len(devConfig.Features) == 0 {
+		return nil, nil
+	}
+	// Use the same lockfile loaded earlier to ensure consistent feature versions
+	mirrors, err := registryMirrors(config.Registry)
+	if err != nil {
+		return nil, err
+	}
+	resolver := devcontainer.NewFeatureResolver(filepath.Join(os.TempDir(), "packnplay-features-cache"), lockfile)
+	resolver.SetSkipOptionValidation(config.SkipFeatureValidation)
+	resolver.SetMirrors(mirrors)
+
+	references := make([]string, 0, len(devConfig.Features))
+	for reference := range devConfig.Features {
+		references = append(references, reference)
+	}
+	sort.Strings(references)
+
+	var resolvedFeatures []*devcontainer.ResolvedFeature
+	for _, reference := range references {
+		// Convert options from map[string]interface{} if needed
+		optionsMap, ok := devConfig.Features[reference].(map[string]interface{})
+		if !ok {
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: invalid options format for feature %s\n", reference)
+			}
+			continue
+		}
+
+		feature, err := resolver.ResolveFeature(featureSourcePath(b.ws.MountPath, reference), optionsMap)
+		if err != nil {
+			if config.Verbose {
+				fmt.Fprintf(os.Stderr, "Warning: failed to resolve feature %s for properties: %v\n", reference, err)
+			}
+			continue
+		}
+		resolvedFeatures = append(resolvedFeatures, feature)
+	}
+	return resolvedFeatures, nil
+}
+
+// featurePropertyArgs applies the container properties features contribute
+// (security options, capabilities, mounts, entrypoint) to args, followed by
+// the environment they set. entrypointArgs are devcontainer.json's; once
+// features apply, those of the last feature setting an entrypoint replace them.
+func (b *runArgsBuilder) featurePropertyArgs(args []string, features []*devcontainer.ResolvedFeature, dockerSocket string, entrypointArgs []string) ([]string, []string) {
+	if len(features) == 0 {
+		return args, entrypointArgs
+	}
+	applier := NewFeaturePropertiesApplier()
+	applier.SetDockerSocket(dockerSocket)
+
+	// Feature containerEnv configured as runtime env is passed with -e; a dry
+	// run doesn't inspect the image, so ${VAR} references to it stay empty
+	if custom, err := b.devConfig.PacknplayCustomizations(); err == nil {
+		var imageEnv map[string]string
+		if !b.config.DryRun {
+			imageEnv = imageEnvironment(b.dockerClient, container.GenerateImageName(b.ws.WorkDir))
+		}
+		applier.SetRuntimeEnv(custom.IsRuntimeEnv, imageEnv)
+	}
+
+	// Pass entrypoint tracking so features can warn if they override config entrypoint
+	entrypointSet := len(b.devConfig.Entrypoint) > 0
+	var entrypointSource string
+	if entrypointSet {
+		entrypointSource = "devcontainer.json"
+	}
+	var featureEnv map[string]string
+	args, featureEnv, entrypointArgs, _, _ = applier.ApplyFeatureProperties(args, features, make(map[string]string), b.substituteContext(), entrypointSet, entrypointSource)
+	return append(args, sortedEnvArgs(featureEnv)...), entrypointArgs
+}
+
+// keepAliveCommand is the container's command: the keep-alive script, run by
+// the feature-provided entrypoint's arguments (e.g. ["-c"] of ["/bin/sh", "-c"])
+// when there are any, else by /bin/sh -c
+func keepAliveCommand(entrypointArgs []string) []string {
+	if len(entrypointArgs) > 0 {
+		return append(append([]string{}, entrypointArgs...), keepAliveScript)
+	}
+	return []string{"/bin/sh", "-c", keepAliveScript}
+}
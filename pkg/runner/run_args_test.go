@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+)
+
+func TestPortArgs(t *testing.T) {
+	got, err := portArgs([]interface{}{3000.0, "8080:80"}, []string{"9000:9000"})
+	if err != nil {
+		t.Fatalf("portArgs() error = %v", err)
+	}
+	want := []string{"-p", "127.0.0.1:3000:3000", "-p", "8080:80", "-p", "9000:9000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("portArgs() = %v, want %v", got, want)
+	}
+
+	if _, err := portArgs([]interface{}{true}, nil); err == nil {
+		t.Error("portArgs() with an invalid forwardPorts entry succeeded, want error")
+	}
+}
+
+func TestAWSEnvArgs(t *testing.T) {
+	got := awsEnvArgs(map[string]string{
+		"AWS_REGION":            "eu-west-1",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_ACCESS_KEY_ID":     "key",
+		"AWS_PROFILE":           "dev",
+	})
+	want := []string{"-e", "AWS_ACCESS_KEY_ID=key", "-e", "AWS_SECRET_ACCESS_KEY=secret", "-e", "AWS_PROFILE=dev", "-e", "AWS_REGION=eu-west-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("awsEnvArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestSecurityArgs(t *testing.T) {
+	privileged := true
+	args, entrypointArgs := securityArgs(&devcontainer.Config{
+		Privileged:  &privileged,
+		CapAdd:      []string{"SYS_PTRACE", ""},
+		SecurityOpt: []string{"seccomp=unconfined"},
+		Entrypoint:  []string{"/bin/sh", "-c"},
+	})
+	want := []string{"--privileged", "--cap-add=SYS_PTRACE", "--security-opt=seccomp=unconfined", "--entrypoint=/bin/sh"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("securityArgs() args = %v, want %v", args, want)
+	}
+	if !reflect.DeepEqual(entrypointArgs, []string{"-c"}) {
+		t.Errorf("securityArgs() entrypoint args = %v, want [-c]", entrypointArgs)
+	}
+}
+
+func TestKeepAliveCommand(t *testing.T) {
+	if got := keepAliveCommand(nil); !reflect.DeepEqual(got, []string{"/bin/sh", "-c", keepAliveScript}) {
+		t.Errorf("keepAliveCommand(nil) = %v", got)
+	}
+	if got := keepAliveCommand([]string{"-lc"}); !reflect.DeepEqual(got, []string{"-lc", keepAliveScript}) {
+		t.Errorf("keepAliveCommand([-lc]) = %v", got)
+	}
+}
+
+func TestNetworkArgs(t *testing.T) {
+	var devConfig devcontainer.Config
+	if err := json.Unmarshal([]byte(`{"image": "alpine:3.20", "customizations": {"packnplay": {"services": {"db": {"image": "postgres:16"}}}}}`), &devConfig); err != nil {
+		t.Fatal(err)
+	}
+	b := &runArgsBuilder{devConfig: &devConfig, containerName: "packnplay-app", supports: docker.Capabilities{Networks: true}}
+
+	args, sidecars, _, err := b.networkArgs("packnplay-app-net", "main")
+	if err != nil {
+		t.Fatalf("networkArgs() error = %v", err)
+	}
+	// The container joins the project network after it starts, alongside its sidecars
+	want := []string{"--network", SidecarNetwork("packnplay-app"), "--hostname", "main"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("networkArgs() = %v, want %v", args, want)
+	}
+	if len(sidecars) != 1 || sidecars[0].Service != "db" {
+		t.Errorf("networkArgs() sidecars = %+v, want db", sidecars)
+	}
+
+	b.supports.Networks = false
+	if _, _, _, err := b.networkArgs("", ""); err == nil {
+		t.Error("networkArgs() without network support succeeded, want error")
+	}
+
+	b.devConfig = &devcontainer.Config{Image: "alpine:3.20"}
+	args, _, _, err = b.networkArgs("packnplay-app-net", "main")
+	if err != nil {
+		t.Fatalf("networkArgs() error = %v", err)
+	}
+	want = []string{"--hostname", "main", "--network", "packnplay-app-net", "--network-alias", "main"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("networkArgs() without services = %v, want %v", args, want)
+	}
+}
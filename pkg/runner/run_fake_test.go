@@ -0,0 +1,267 @@
+package runner
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devpolicy"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/proxy"
+)
+
+// execCall is the process Run would have replaced itself with
+type execCall struct {
+	path string
+	argv []string
+}
+
+// useFakeRuntime points Run at fake with a throwaway home directory and
+// captures the final exec instead of replacing the test process
+func useFakeRuntime(t *testing.T, fake *dockertest.FakeClient) *execCall {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, ".local", "state"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(home, "run"))
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "") // keep credentials out of the real Secret Service
+
+	origNew, origLookPath, origExec, origUser, origPolicy, origProxy := newDockerClient, lookPath, execProcess, lookupCurrentUser, devpolicy.SystemPath, detectProxy
+	t.Cleanup(func() {
+		newDockerClient, lookPath, execProcess, lookupCurrentUser, devpolicy.SystemPath, detectProxy = origNew, origLookPath, origExec, origUser, origPolicy, origProxy
+	})
+	devpolicy.SystemPath = filepath.Join(home, "etc", "policy.json") // keep the host's policy out of tests
+	detectProxy = func() proxy.Settings { return proxy.Settings{} }  // and its proxy
+
+	call := &execCall{}
+	newDockerClient = func(string, bool) (DockerClient, error) { return fake, nil }
+	lookPath = func(file string) (string, error) { return "/usr/bin/" + file, nil }
+	execProcess = func(path string, argv []string, env []string) error {
+		call.path, call.argv = path, argv
+		return nil
+	}
+	lookupCurrentUser = func() (*user.User, error) {
+		return &user.User{Username: "dev", Uid: "1000", Gid: "1000", HomeDir: home}, nil
+	}
+	return call
+}
+
+// newProject creates a project directory with the given devcontainer.json
+func newProject(t *testing.T, devcontainerJSON string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".devcontainer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".devcontainer", "devcontainer.json"), []byte(devcontainerJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// argValue returns the value following flag in args
+func argValue(args []string, flag string) string {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestRunCreatesContainer(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	project := newProject(t, `{
+		"image": "alpine:3.20",
+		"remoteUser": "root",
+		"containerEnv": {"MODE": "test"},
+		"postCreateCommand": {"deps": "make deps", "tools": "make tools"}
+	}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"make", "test"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	c := fake.Container(name)
+	if c == nil || !c.Running {
+		t.Fatalf("container %s should be created and running: %v", name, fake.Containers())
+	}
+	if c.Image != "alpine:3.20" || c.Labels["managed-by"] != "packnplay" || c.Labels["packnplay-worktree"] != "no-worktree" {
+		t.Errorf("container = %+v", c)
+	}
+	if !contains(c.RunArgs, "-e MODE=test") || argValue(c.RunArgs, "--user") != "root" {
+		t.Errorf("docker run args = %v, want containerEnv and remoteUser applied", c.RunArgs)
+	}
+	if len(fake.CallsTo("pull")) != 0 {
+		t.Error("an image that's already present should not be pulled")
+	}
+
+	// Both postCreate tasks ran in the workspace, in parallel and so in any order
+	var tasks []string
+	for _, exec := range fake.CallsTo("exec") {
+		if argValue(exec, "-w") == project && exec[len(exec)-2] == "-c" {
+			tasks = append(tasks, exec[len(exec)-1])
+		}
+	}
+	sort.Strings(tasks)
+	if strings.Join(tasks, ",") != "make deps,make tools" {
+		t.Errorf("postCreate tasks = %v", tasks)
+	}
+
+	want := []string{"docker", "exec", "--user", "root", "-w", project, c.ID, "make", "test"}
+	got := append([]string{call.argv[0]}, call.argv[1:]...)
+	if call.path != "/usr/bin/docker" || strings.Join(removeTTYFlags(got), " ") != strings.Join(want, " ") {
+		t.Errorf("exec = %s %v, want %v", call.path, call.argv, want)
+	}
+}
+
+func TestRunReconnectsToRunningContainer(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postStartCommand": "echo started"}`)
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	existing := fake.AddContainer(dockertest.Container{
+		Name:    name,
+		Image:   "alpine:3.20",
+		Running: true,
+		Labels:  map[string]string{"managed-by": "packnplay", "packnplay-project": filepath.Base(project), "packnplay-worktree": "no-worktree", "packnplay-host-path": project},
+	})
+
+	// Without --reconnect, a running container is reported rather than reused
+	err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}})
+	if err == nil || !strings.Contains(err.Error(), "container already running") || !strings.Contains(err.Error(), "--reconnect") {
+		t.Fatalf("Run() error = %v, want the already-running explanation", err)
+	}
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: true, Command: []string{"bash"}, ExecEnv: []string{"API=1"}}); err != nil {
+		t.Fatalf("Run() with Reconnect error = %v", err)
+	}
+	if len(fake.CallsTo("run")) != 0 || len(fake.Containers()) != 1 {
+		t.Error("reconnecting should not create a container")
+	}
+	if !containsCall(fake.CallsTo("exec"), "echo started") {
+		t.Errorf("postStartCommand should run on reconnect: %v", fake.CallsTo("exec"))
+	}
+	if !contains(call.argv, existing.ID, "-e API=1", "bash") {
+		t.Errorf("exec = %v, want the existing container with ExecEnv", call.argv)
+	}
+}
+
+func TestRunPostStartOncePerStart(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postStartCommand": "echo started"}`)
+
+	postStarts := func() int {
+		n := 0
+		for _, call := range fake.CallsTo("exec") {
+			if contains(call, "echo started") {
+				n++
+			}
+		}
+		return n
+	}
+	run := func(reconnect bool) {
+		t.Helper()
+		if err := Run(&RunConfig{Path: project, NoWorktree: true, Reconnect: reconnect, Command: []string{"bash"}}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	}
+
+	run(false)
+	run(true)
+	if n := postStarts(); n != 1 {
+		t.Errorf("postStartCommand ran %d times, want once until the container restarts", n)
+	}
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	fake.Container(name).StartedAt = time.Now().Add(time.Hour) // restarted by the runtime
+	run(true)
+	if n := postStarts(); n != 2 {
+		t.Errorf("postStartCommand ran %d times, want again after the restart", n)
+	}
+
+	if _, err := fake.Run("stop", name); err != nil {
+		t.Fatal(err)
+	}
+	run(false)
+	if n := postStarts(); n != 3 {
+		t.Errorf("postStartCommand ran %d times, want again after packnplay restarted the container", n)
+	}
+}
+
+func TestRunRestartsStoppedContainer(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	name := container.GenerateContainerName(project, "no-worktree")
+	stopped := fake.AddContainer(dockertest.Container{Name: name, Image: "alpine:3.20", Labels: map[string]string{"managed-by": "packnplay"}})
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !stopped.Running {
+		t.Error("the stopped container should be started again")
+	}
+	if len(fake.CallsTo("run")) != 0 {
+		t.Error("a stopped container should be restarted, not recreated")
+	}
+	if !contains(call.argv, stopped.ID, "bash") {
+		t.Errorf("exec = %v", call.argv)
+	}
+}
+
+func TestRunReportsRuntimeErrors(t *testing.T) {
+	fake := dockertest.New()
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "ghcr.io/example/missing:1"}`)
+	fake.Fail(os.ErrNotExist, "Error response from daemon: manifest unknown\n", "pull")
+
+	err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}})
+	if err == nil {
+		t.Fatal("Run() should fail when the image can't be pulled")
+	}
+	if len(fake.CallsTo("run")) != 0 {
+		t.Error("no container should be created without an image")
+	}
+}
+
+// removeTTYFlags drops the -i/-t flags exec adds depending on the test's terminal
+func removeTTYFlags(args []string) []string {
+	var kept []string
+	for _, arg := range args {
+		if arg != "-i" && arg != "-t" && arg != "-it" {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// containsCall reports whether any call contains all of strs
+func containsCall(calls [][]string, strs ...string) bool {
+	for _, call := range calls {
+		if contains(call, strs...) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,14 +17,20 @@ import (
 	"time"
 
 	"github.com/mattn/go-isatty"
-	"github.com/obra/packnplay/pkg/aws"
+	"github.com/obra/packnplay/pkg/audit"
 	"github.com/obra/packnplay/pkg/compose"
 	"github.com/obra/packnplay/pkg/config"
 	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/credstore"
 	"github.com/obra/packnplay/pkg/devcontainer"
 	"github.com/obra/packnplay/pkg/docker"
-	"github.com/obra/packnplay/pkg/git"
-	"github.com/obra/packnplay/pkg/userdetect"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/events"
+	"github.com/obra/packnplay/pkg/hooks"
+	"github.com/obra/packnplay/pkg/registry"
+	"github.com/obra/packnplay/pkg/registryauth"
+	"github.com/obra/packnplay/pkg/stats"
+	"github.com/obra/packnplay/pkg/vulnscan"
 )
 
 type RunConfig struct {
@@ -42,9 +49,62 @@ type RunConfig struct {
 	Volumes               []string                        // Volume mounts from CLI -v flags
 	HostPath              string                          // Host directory path for the container
 	LaunchCommand         string                          // Original command line used to launch
+	LaunchArgs            []string                        // Original arguments (without the program name), for `packnplay resume`
+	LaunchDir             string                          // Directory the command was launched from
 	WorkspaceMount        string                          // Custom workspace mount (Docker --mount syntax)
 	WorkspaceFolder       string                          // Container workspace folder path
 	WorkspaceMountContext *devcontainer.SubstituteContext // Context for variable substitution in workspaceMount
+	Platform              string                          // Target platform (e.g. linux/amd64), empty for native
+	SkipFeatureValidation bool                            // Don't validate feature options against their OptionSpec
+	LoadEnvFiles          bool                            // Load .devcontainer/devcontainer.env into containerEnv
+	LoadProjectDotEnv     bool                            // Also load the project root .env (requires LoadEnvFiles)
+	MountRelabel          string                          // SELinux relabel mode for bind mounts: auto, z, Z, or off
+	DisableLabels         bool                            // turn off SELinux separation for the container
+	AppArmorProfile       string                          // AppArmor profile for the container, empty for the runtime default
+	HostBridge            bool                            // Let the container open URLs/editors on the host
+	HostBridgeActions     []string                        // Allowed host bridge actions, empty for the defaults
+	Ephemeral             bool                            // Throwaway --rm container: no worktree, no recorded metadata or persistent credentials
+	DockerSocket          bool                            // Mount the host's container runtime socket (docker-outside-of-docker)
+	PersistSession        bool                            // Run the command in a tmux session that survives disconnects
+	Detach                bool                            // Bring the container up and print its details instead of exec'ing into it
+	DetachJSON            bool                            // With Detach, print container details as JSON
+	MountExcludes         []string                        // Host paths inside mounted directories to hide from the container
+	AgentState            config.AgentStateConfig         // Whether each agent's config dir is shared with other containers or isolated per container
+	ForeignBinaries       string                          // What a new container does about binaries for another platform in mounted config dirs: warn (default), shadow, rebuild, or off
+	NoRegistryLogin       bool                            // Don't refresh ECR/GCR/ACR logins before pulling
+	NoProjectNetwork      bool                            // Don't join the network shared by the project's containers
+	Events                *events.Emitter                 // Where progress events are written, nil for none
+	BuildContextWarnMB    int                             // Warn when a Dockerfile build context is larger, 0 for the default, negative to never warn
+	VulnScan              config.VulnScanConfig           // Vulnerability scan policy applied before creating a container
+	RefreshImage          bool                            // Pull/rebuild the image even if it exists locally (refresh-container)
+	NoBuildCache          bool                            // Rebuild without the layer cache, reinstalling features
+	PullTimeout           time.Duration                   // Limit on a single image pull attempt, 0 for none
+	Hooks                 hooks.Hooks                     // Host commands run around container lifecycle events, before project hooks
+	TrustHooks            bool                            // Trust the project's hooks as they are now, so they run on the host
+	ExecEnv               []string                        // Env (KEY=value) also passed when exec'ing into a reused container, e.g. from --env-config
+	DryRun                bool                            // Resolve and print the container a run would create instead of creating it
+	DryRunJSON            bool                            // With DryRun, print the RunSpec as JSON
+	CloneInVolume         string                          // Clone this ref (or CloneCurrentBranch) into a volume instead of mounting the host directory
+	Repo                  string                          // Clone this repository URL into a volume instead of using a host directory at all
+	Branch                string                          // Branch or tag of Repo to clone, empty for its default branch
+	CredentialStore       string                          // Backend keeping container-managed credentials encrypted at rest, see credstore.Open
+	BuildSecrets          config.BuildSecretsConfig       // Host env vars, files and SSH access image builds may be given
+	PolicyOverride        string                          // Reason an admin gives for running despite devcontainer policy violations
+	SSH                   bool                            // Run sshd in the container, published on a random loopback port, for editors that attach over SSH
+	Shell                 config.ShellConfig              // Prompt, history and aliases injected into the remote user's shell
+	Proxy                 config.ProxyConfig              // HTTP proxy forwarded into builds and the container, on top of the host's
+	Timeout               time.Duration                   // Stop the command once it has run this long (0 for no limit); packnplay supervises it instead of exec'ing
+	TimeoutStop           bool                            // With Timeout, also stop the container when it elapses
+	RestartPolicy         string                          // Restart policy of new containers unless devcontainer.json sets one: no (default), on-failure, or unless-stopped
+	Reattach              bool                            // Supervise the command and run it again in the container after a daemon restart cuts it off
+	ConfigDrift           string                          // What reusing a container whose configuration changed does: warn (default), prompt, recreate, or ignore
+	WorkspaceOwnership    string                          // What a new container whose user doesn't own the workspace does: auto (default), remap, or off
+	DevcontainerSearch    string                          // How far up a directory without devcontainer.json looks for one: git (default), parents, or off
+	WorktreeSettings      config.WorktreeConfig           // Base ref, upstream tracking and path template of new worktrees
+	Registry              config.RegistryConfig           // Registry mirrors images and features are pulled through, and offline mode
+	GitHub                config.GitHubConfig             // Which GitHub token gh credentials carry: the host's, or one minted for the repository
+
+	interrupts *interruptGuard // catches SIGINT/SIGTERM while the container is built and set up
 }
 
 // ContainerDetails holds detailed information about a running container
@@ -58,13 +118,31 @@ type ContainerDetails struct {
 }
 
 // FeaturePropertiesApplier applies feature metadata to container configuration
-type FeaturePropertiesApplier struct{}
+type FeaturePropertiesApplier struct {
+	runtimeEnv   func(name string) bool // feature containerEnv applied with -e instead of baked in
+	imageEnv     map[string]string      // image environment that runtime values may reference
+	dockerSocket string                 // host daemon socket for docker-outside-of-docker mounts
+}
 
 // NewFeaturePropertiesApplier creates a new properties applicator
 func NewFeaturePropertiesApplier() *FeaturePropertiesApplier {
 	return &FeaturePropertiesApplier{}
 }
 
+// SetRuntimeEnv makes the applier return feature containerEnv variables selected by
+// isRuntime, with ${VAR} references expanded against imageEnv the way a Dockerfile
+// ENV would expand them.
+func (a *FeaturePropertiesApplier) SetRuntimeEnv(isRuntime func(name string) bool, imageEnv map[string]string) {
+	a.runtimeEnv = isRuntime
+	a.imageEnv = imageEnv
+}
+
+// SetDockerSocket points docker-outside-of-docker feature mounts of the default
+// daemon socket at the host's actual socket (rootless Docker, Podman, DOCKER_HOST)
+func (a *FeaturePropertiesApplier) SetDockerSocket(socket string) {
+	a.dockerSocket = socket
+}
+
 // ApplyFeatureProperties applies feature container properties to Docker args and environment
 // ctx parameter added for variable substitution in mount strings
 // entrypointSet/entrypointSource track if entrypoint was already set (by config or previous feature)
@@ -80,6 +158,12 @@ func (a *FeaturePropertiesApplier) ApplyFeatureProperties(baseArgs []string, fea
 
 	var entrypointArgs []string
 
+	// Runtime containerEnv can reference the image env and earlier features' values
+	resolvedEnv := make(map[string]string)
+	for k, v := range a.imageEnv {
+		resolvedEnv[k] = v
+	}
+
 	for _, feature := range features {
 		if feature.Metadata == nil {
 			continue
@@ -124,15 +208,32 @@ func (a *FeaturePropertiesApplier) ApplyFeatureProperties(baseArgs []string, fea
 			entrypointSource = feature.ID
 		}
 
-		// NOTE: ContainerEnv from features is set in the Dockerfile as ENV statements
-		// and should NOT be applied as runtime -e flags to avoid ${PATH} reference issues.
-		// The Dockerfile ENV statements handle variable references correctly during build.
+		// NOTE: ContainerEnv from features is normally set in the Dockerfile as ENV
+		// statements, which handle ${PATH}-style references during build. Variables
+		// configured as runtime env are expanded here against the image env instead.
+		if a.runtimeEnv != nil {
+			names := make([]string, 0, len(metadata.ContainerEnv))
+			for name := range metadata.ContainerEnv {
+				if a.runtimeEnv(name) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				value := expandEnvReferences(metadata.ContainerEnv[name], resolvedEnv)
+				resolvedEnv[name] = value
+				enhancedEnv[name] = value
+			}
+		}
 
 		// Apply feature-contributed mounts with variable substitution
 		for _, mount := range metadata.Mounts {
 			// Apply variable substitution to mount source and target
 			source := devcontainer.Substitute(ctx, mount.Source).(string)
 			target := devcontainer.Substitute(ctx, mount.Target).(string)
+			if a.dockerSocket != "" && source == defaultDockerSocket && target == dockerHostSocketTarget {
+				source = a.dockerSocket
+			}
 
 			mountArg := "--mount=type=" + mount.Type + ",source=" + source + ",target=" + target
 			enhancedArgs = append(enhancedArgs, mountArg)
@@ -151,8 +252,29 @@ func getTTYFlags() []string {
 	return []string{"-i"} // Interactive only (no TTY)
 }
 
+// lifecycleTaskPolicy returns the parallelism and failure policy the project
+// sets for object-format lifecycle commands in customizations.packnplay
+func lifecycleTaskPolicy(devConfig *devcontainer.Config) (int, string) {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return 0, ""
+	}
+	return custom.LifecycleParallelism, custom.LifecycleFailurePolicy
+}
+
+// lifecycleShell returns the shell from customizations.packnplay that
+// string-format lifecycle commands run with, nil for the default
+func lifecycleShell(devConfig *devcontainer.Config) []string {
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return nil
+	}
+	return custom.LifecycleShellArgs()
+}
+
 // executePostStart runs postStartCommand if defined, handling metadata tracking
-func executePostStart(dockerClient *docker.Client, containerID string, remoteUser string, verbose bool, postStartCommand *devcontainer.LifecycleCommand) error {
+func executePostStart(dockerClient DockerClient, containerID, containerName, project string, devConfig *devcontainer.Config, workingDir string, env []string, emitter *events.Emitter, verbose bool) error {
+	postStartCommand := devConfig.PostStartCommand
 	if postStartCommand == nil {
 		return nil
 	}
@@ -166,7 +288,13 @@ func executePostStart(dockerClient *docker.Client, containerID string, remoteUse
 		metadata = nil
 	}
 
-	executor := NewLifecycleExecutor(dockerClient, containerID, remoteUser, verbose, metadata)
+	executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.LifecycleUser(), verbose, metadata)
+	executor.SetWorkingDir(workingDir)
+	executor.SetEnv(env)
+	executor.SetTaskPolicy(lifecycleTaskPolicy(devConfig))
+	executor.SetShell(lifecycleShell(devConfig))
+	executor.SetEvents(emitter)
+	executor.SetAudit(project, containerName)
 
 	if verbose {
 		fmt.Fprintf(os.Stderr, "Running postStartCommand...\n")
@@ -187,11 +315,33 @@ func executePostStart(dockerClient *docker.Client, containerID string, remoteUse
 	return nil
 }
 
+// Runtime and process seams, replaced in tests so Run can be exercised against
+// a fake runtime without a daemon
+var (
+	// newDockerClient creates the container runtime client Run uses
+	newDockerClient = func(runtime string, verbose bool) (DockerClient, error) {
+		return docker.NewClientWithRuntime(runtime, verbose)
+	}
+	// lookPath finds the runtime CLI that packnplay execs into containers with
+	lookPath = exec.LookPath
+	// execProcess replaces packnplay with the exec into the container
+	execProcess = syscall.Exec
+	// exitProcess ends packnplay with a supervised command's exit code
+	exitProcess = os.Exit
+	// lookupCurrentUser returns the host user whose home directory is mounted
+	lookupCurrentUser = user.Current
+)
+
+// pullTimeoutSetter is implemented by clients that can bound image pulls
+type pullTimeoutSetter interface {
+	SetPullTimeout(timeout time.Duration)
+}
+
 // execIntoContainer replaces the current process with docker exec into the container
 // If shutdownAction is set (not empty, not "none"), it runs docker exec as a child process
 // with signal handling to perform cleanup on exit.
-func execIntoContainer(dockerClient *docker.Client, containerID string, remoteUser string, workingDir string, command []string, overrideCommand bool, shutdownAction string, composeFiles []string, composeWorkDir string) error {
-	cmdPath, err := exec.LookPath(dockerClient.Command())
+func execIntoContainer(dockerClient DockerClient, containerID string, remoteUser string, workingDir string, env []string, command []string, overrideCommand bool, shutdownAction string, composeFiles []string, composeWorkDir string, timeout *execTimeout, reattach bool) error {
+	cmdPath, err := lookPath(dockerClient.Command())
 	if err != nil {
 		return fmt.Errorf("failed to find docker command: %w", err)
 	}
@@ -203,47 +353,83 @@ func execIntoContainer(dockerClient *docker.Client, containerID string, remoteUs
 	if remoteUser != "" {
 		execArgs = append(execArgs, "--user", remoteUser)
 	}
+	execArgs = append(execArgs, envArgs(env)...)
 
 	execArgs = append(execArgs, "-w", workingDir, containerID)
 
 	// Only append command if overrideCommand is true
 	// When false, the container's default CMD will run
 	if overrideCommand {
+		if timeout != nil {
+			command = timeout.wrap(command)
+		}
 		execArgs = append(execArgs, command...)
 	}
 
+	// With --reattach, supervise the command and run it again after a daemon restart
+	if reattach {
+		containerID, runErr := superviseSession(dockerClient, containerID, execArgs, func(execArgs []string, containerID string) error {
+			if timeout != nil && overrideCommand {
+				return timeout.run(dockerClient, cmdPath, execArgs, containerID)
+			}
+			return runSupervised(cmdPath, execArgs)
+		})
+		if shutdownAction != "" && shutdownAction != "none" {
+			if err := performShutdownAction(shutdownAction, dockerClient, containerID, composeFiles, composeWorkDir); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: shutdown action failed: %v\n", err)
+			}
+		}
+		return exitWithCommandStatus(runErr)
+	}
+
+	// With a timeout, supervise the command as a child process
+	if timeout != nil && overrideCommand {
+		runErr := timeout.run(dockerClient, cmdPath, execArgs, containerID)
+		if shutdownAction != "" && shutdownAction != "none" {
+			if err := performShutdownAction(shutdownAction, dockerClient, containerID, composeFiles, composeWorkDir); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: shutdown action failed: %v\n", err)
+			}
+		}
+		return exitWithCommandStatus(runErr)
+	}
+
 	// If shutdownAction is set, run as child process with signal handling
-	// Otherwise, use syscall.Exec for traditional behavior
+	// Otherwise, replace the current process for traditional behavior
 	if shutdownAction != "" && shutdownAction != "none" {
 		return execWithShutdownAction(cmdPath, execArgs, shutdownAction, dockerClient, containerID, composeFiles, composeWorkDir)
 	}
 
-	// Use syscall.Exec to replace current process
-	return syscall.Exec(cmdPath, execArgs, os.Environ())
+	// Replace the current process
+	return execProcess(cmdPath, execArgs, os.Environ())
 }
 
 // execWithShutdownAction runs docker exec as a child process and handles shutdown actions
-func execWithShutdownAction(cmdPath string, execArgs []string, shutdownAction string, dockerClient *docker.Client, containerID string, composeFiles []string, composeWorkDir string) error {
-	// Create the exec command
-	cmd := exec.Command(cmdPath, execArgs[1:]...) // Skip the program name in execArgs
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+func execWithShutdownAction(cmdPath string, execArgs []string, shutdownAction string, dockerClient DockerClient, containerID string, composeFiles []string, composeWorkDir string) error {
+	exitErr := runSupervised(cmdPath, execArgs)
 
+	// Perform shutdown action
+	if err := performShutdownAction(shutdownAction, dockerClient, containerID, composeFiles, composeWorkDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: shutdown action failed: %v\n", err)
+	}
+
+	return exitErr
+}
+
+// runSupervised runs docker exec as a child process, forwarding SIGINT and
+// SIGTERM to it, and returns its result
+func runSupervised(cmdPath string, execArgs []string) error {
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
-	// Start the docker exec process
-	if err := cmd.Start(); err != nil {
+	// Start the docker exec process, on a terminal of its own if packnplay has one
+	cmd, done, err := startSupervised(cmdPath, execArgs)
+	if err != nil {
 		return fmt.Errorf("failed to start docker exec: %w", err)
 	}
 
 	// Wait for either the command to finish or a signal
-	done := make(chan error, 1)
-	go func() {
-		done <- cmd.Wait()
-	}()
 
 	var exitErr error
 	select {
@@ -258,1312 +444,290 @@ func execWithShutdownAction(cmdPath string, execArgs []string, shutdownAction st
 	case exitErr = <-done:
 		// Command exited normally
 	}
+	return exitErr
+}
 
-	// Perform shutdown action
-	if err := performShutdownAction(shutdownAction, dockerClient, containerID, composeFiles, composeWorkDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: shutdown action failed: %v\n", err)
-	}
-
-	return exitErr
-}
-
-// performShutdownAction executes the specified shutdown action
-func performShutdownAction(action string, dockerClient *docker.Client, containerID string, composeFiles []string, composeWorkDir string) error {
-	switch action {
-	case "stopContainer":
-		fmt.Fprintf(os.Stderr, "Stopping container %s...\n", containerID)
-		stopCmd := exec.Command(dockerClient.Command(), "stop", containerID)
-		if output, err := stopCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to stop container: %w (output: %s)", err, output)
-		}
-		return nil
-
-	case "stopCompose":
-		if len(composeFiles) == 0 || composeWorkDir == "" {
-			return fmt.Errorf("stopCompose requires compose files and work directory")
-		}
-		fmt.Fprintf(os.Stderr, "Stopping Docker Compose services...\n")
-
-		args := []string{"compose"}
-		for _, f := range composeFiles {
-			args = append(args, "-f", f)
-		}
-		args = append(args, "down")
-
-		downCmd := exec.Command(dockerClient.Command(), args...)
-		downCmd.Dir = composeWorkDir
-		if output, err := downCmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("failed to stop compose services: %w (output: %s)", err, output)
-		}
-		return nil
-
-	case "none", "":
-		// No action needed
-		return nil
-
-	default:
-		return fmt.Errorf("unknown shutdownAction: %s", action)
-	}
-}
-
-func Run(config *RunConfig) error {
-	// Step 1: Determine working directory
-	workDir := config.Path
-	if workDir == "" {
-		var err error
-		workDir, err = os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get working directory: %w", err)
-		}
-	}
-
-	// Resolve symlinks to ensure consistent paths for container reconnection
-	resolvedWorkDir, err := filepath.EvalSymlinks(workDir)
-	if err != nil {
-		return fmt.Errorf("failed to resolve symlinks in working directory: %w", err)
-	}
-	workDir = resolvedWorkDir
-
-	// Make absolute
-	workDir, err = filepath.Abs(workDir)
-	if err != nil {
-		return fmt.Errorf("failed to resolve path: %w", err)
-	}
-
-	// Step 2: Handle worktree logic
-	var mountPath string
-	var worktreeName string
-	var mainRepoGitDir string // Path to main repo's .git directory for mounting
-
-	if config.NoWorktree {
-		// Use directory directly
-		mountPath = workDir
-		worktreeName = "no-worktree"
-	} else {
-		// Check if git repo
-		if !git.IsGitRepo(workDir) {
-			if config.Worktree != "" {
-				return fmt.Errorf("--worktree specified but %s is not a git repository", workDir)
-			}
-			// Not a git repo and no worktree flag: use directly
-			mountPath = workDir
-			worktreeName = "no-worktree"
-		} else {
-			// Is a git repo
-			explicitWorktree := config.Worktree != ""
-			if explicitWorktree {
-				worktreeName = config.Worktree
-			} else {
-				// Auto-detect from current branch
-				branch, err := git.GetCurrentBranch(workDir)
-				if err != nil {
-					return fmt.Errorf("failed to get current branch: %w", err)
-				}
-				worktreeName = branch
-			}
-
-			// Check if worktree exists
-			exists, err := git.WorktreeExists(worktreeName)
-			if err != nil {
-				return fmt.Errorf("failed to check worktree: %w", err)
-			}
-
-			if exists {
-				// Worktree already exists - just use it
-				actualPath, err := git.GetWorktreePath(worktreeName)
-				if err != nil {
-					return fmt.Errorf("failed to get worktree path: %w", err)
-				}
-				mountPath = actualPath
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Using existing worktree at %s\n", mountPath)
-				}
-			} else {
-				// Create worktree
-				mountPath = git.DetermineWorktreePath(workDir, worktreeName)
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Creating worktree at %s\n", mountPath)
-				}
-
-				if err := git.CreateWorktree(mountPath, worktreeName, config.Verbose); err != nil {
-					return fmt.Errorf("failed to create worktree: %w", err)
-				}
-			}
-
-			// Get main repo's .git directory for mounting
-			// Resolve the real path (follow symlinks) to ensure .git paths match
-			realWorkDir, err := filepath.EvalSymlinks(workDir)
-			if err != nil {
-				realWorkDir = workDir // Fallback if can't resolve
-			}
-			mainRepoGitDir = filepath.Join(realWorkDir, ".git")
-		}
-	}
-
-	// Step 3: Load devcontainer config
-	devConfig, err := devcontainer.LoadConfig(mountPath)
-	if err != nil {
-		return fmt.Errorf("failed to load devcontainer config: %w", err)
-	}
-	if devConfig == nil {
-		// Use configured default image (supports custom default containers)
-		defaultImage := getConfiguredDefaultImage(config)
-		devConfig = devcontainer.GetDefaultConfig(defaultImage)
-	}
-
-	// Step 3.5: Detect orchestration mode and route accordingly
-	composeFiles := devConfig.GetDockerComposeFiles()
-	isComposeMode := len(composeFiles) > 0
-	isImageMode := devConfig.Image != ""
-	isDockerfileMode := devConfig.HasDockerfile()
-
-	// Validate mutually exclusive modes
-	if isComposeMode && (isImageMode || isDockerfileMode) {
-		return fmt.Errorf("dockerComposeFile is mutually exclusive with image/build.dockerfile")
-	}
-
-	// Validate compose + features incompatibility
-	// Features require building a custom image, but compose mode uses pre-built service images
-	if isComposeMode && len(devConfig.Features) > 0 {
-		return fmt.Errorf("dockerComposeFile does not support devcontainer features - install features in your compose service image instead")
-	}
-
-	// Step 4: Initialize container client
-	dockerClient, err := docker.NewClientWithRuntime(config.Runtime, config.Verbose)
-	if err != nil {
-		return fmt.Errorf("failed to initialize container runtime: %w", err)
-	}
-
-	// Route to Docker Compose workflow if compose mode
-	if isComposeMode {
-		// Note: Compose mode does not load lockfile because features are not supported
-		// in compose mode (compose uses pre-built service images, not custom image builds)
-		return runWithCompose(devConfig, config, mountPath, workDir, worktreeName, dockerClient)
-	}
-
-	// Continue with standard image/dockerfile workflow
-	// Step 4.5: Load lockfile if it exists
-	// This ensures consistent feature versions across image build, property resolution, and lifecycle merging
-	lockfile, err := devcontainer.LoadLockFile(mountPath)
-	if err != nil {
-		return fmt.Errorf("failed to load lockfile: %w", err)
-	}
-
-	// Step 5: Ensure image available using ImageManager service
-	imageManager := NewImageManager(dockerClient, config.Verbose)
-	if err := imageManager.EnsureAvailableWithLockfile(devConfig, mountPath, lockfile); err != nil {
-		return fmt.Errorf("failed to ensure image: %w", err)
-	}
-
-	// Step 5.5: Detect RemoteUser if not specified and we built from Dockerfile or features
-	// For built images, the image name is derived from project path
-	if devConfig.RemoteUser == "" && (devConfig.HasDockerfile() || len(devConfig.Features) > 0) {
-		builtImageName := container.GenerateImageName(workDir)
-		userResult, err := userdetect.DetectContainerUser(builtImageName, &userdetect.DevcontainerConfig{
-			RemoteUser:   devConfig.RemoteUser,
-			UserEnvProbe: devConfig.UserEnvProbe,
-		})
-		if err != nil {
-			// If detection fails, fall back to root
-			devConfig.RemoteUser = "root"
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Warning: failed to detect user from built image, using root: %v\n", err)
-			}
-		} else {
-			devConfig.RemoteUser = userResult.User
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Detected user %s from built image\n", devConfig.RemoteUser)
-			}
-		}
-	}
-
-	// Step 6: Generate container name and labels
-	projectName := filepath.Base(workDir)
-	containerName := container.GenerateContainerName(workDir, worktreeName)
-
-	// Use enhanced labels if launch info is available
-	var labels map[string]string
-	if config.HostPath != "" && config.LaunchCommand != "" {
-		labels = container.GenerateLabelsWithLaunchInfo(projectName, worktreeName, config.HostPath, config.LaunchCommand)
-	} else {
-		labels = container.GenerateLabels(projectName, worktreeName)
-	}
-
-	// Step 6.5: Execute initializeCommand on HOST if present
-	// This runs BEFORE container creation, on the host machine
-	if err := executeInitializeCommand(devConfig.InitializeCommand, mountPath, config.Verbose); err != nil {
-		return err
-	}
-
-	// Step 7: Check if container already running
-	if isRunning, err := containerIsRunning(dockerClient, containerName); err != nil {
-		return fmt.Errorf("failed to check container status: %w", err)
-	} else if isRunning {
-		// Container is running - check if user wants to reconnect
-		if !config.Reconnect {
-			// Get detailed container information
-			details, err := getContainerDetails(dockerClient, containerName)
-			if err != nil {
-				// Fallback to basic error if we can't get details
-				return fmt.Errorf("container already running for this worktree (unable to get details: %v)", err)
-			}
-
-			// Build command string
-			var cmdStr strings.Builder
-			for i, arg := range config.Command {
-				if i > 0 {
-					cmdStr.WriteString(" ")
-				}
-				if strings.Contains(arg, " ") {
-					cmdStr.WriteString(fmt.Sprintf("'%s'", arg))
-				} else {
-					cmdStr.WriteString(arg)
-				}
-			}
-
-			// Determine current working directory
-			currentDir, err := os.Getwd()
-			if err != nil {
-				currentDir = ""
-			} else {
-				// Make absolute for comparison
-				currentDir, _ = filepath.Abs(currentDir)
-			}
-
-			// Determine if we need worktree flag (if current dir doesn't match container's host path)
-			needWorktreeFlag := true
-			if currentDir != "" && details.HostPath != "" {
-				// If current directory matches container's host path, we don't need --worktree
-				needWorktreeFlag = currentDir != details.HostPath
-			}
-
-			worktreeFlag := ""
-			if needWorktreeFlag && worktreeName != "no-worktree" {
-				worktreeFlag = fmt.Sprintf(" --worktree=%s", worktreeName)
-			}
-
-			// Build detailed error message
-			errorMsg := "container already running for this worktree\n\n"
-			errorMsg += "Container Details:\n"
-			errorMsg += fmt.Sprintf("  Name: %s\n", details.Names)
-			errorMsg += fmt.Sprintf("  Status: %s\n", details.Status)
-			errorMsg += fmt.Sprintf("  Project: %s\n", details.Project)
-			errorMsg += fmt.Sprintf("  Worktree: %s\n", details.Worktree)
-			if details.HostPath != "" {
-				errorMsg += fmt.Sprintf("  Host Path: %s\n", details.HostPath)
-			}
-			if details.LaunchCommand != "" {
-				errorMsg += fmt.Sprintf("  Original Command: %s\n", details.LaunchCommand)
-			}
-
-			errorMsg += "\nTo run your command in the existing container:\n"
-			errorMsg += fmt.Sprintf("  packnplay run%s --reconnect %s\n", worktreeFlag, cmdStr.String())
-			errorMsg += "\nTo stop the existing container:\n"
-			errorMsg += fmt.Sprintf("  packnplay stop %s", details.Names)
-
-			return fmt.Errorf("%s", errorMsg)
-		}
-
-		// User explicitly wants to reconnect
-		if warning := ignoredCreationFlags(config); warning != "" {
-			fmt.Fprintln(os.Stderr, warning)
-		}
-		if config.Verbose {
-			fmt.Fprintf(os.Stderr, "Reconnecting to existing container %s\n", containerName)
-		}
-
-		// Get container ID
-		containerID, err := getContainerID(dockerClient, containerName)
-		if err != nil {
-			return fmt.Errorf("failed to get container ID: %w", err)
-		}
-
-		// Run postStart command if defined (postStart runs every time container is accessed)
-		if err := executePostStart(dockerClient, containerID, devConfig.RemoteUser, config.Verbose, devConfig.PostStartCommand); err != nil {
-			return err
-		}
-
-		// Calculate working directory - respect workspaceFolder from devcontainer.json
-		// This should match the logic used in restart path and container creation
-		reconnectWorkingDir := mountPath
-		if devConfig.WorkspaceFolder != "" {
-			reconnectWorkingDir = devConfig.WorkspaceFolder
-		}
-
-		// Exec into existing container
-		return execIntoContainer(dockerClient, containerID, devConfig.RemoteUser, reconnectWorkingDir, config.Command, devConfig.ShouldOverrideCommand(), devConfig.ShutdownAction, nil, "")
-	}
-
-	// Check for stopped container with same name and try to restart it
-	// NOTE: Container restart preserves container state (files, environment variables,
-	// installed packages) but does NOT update creation-time configuration such as:
-	// - Port mappings (-p flags)
-	// - Volume mounts (-v flags)
-	// - Environment variables (-e flags)
-	// - Network settings
-	// To apply new configuration from devcontainer.json or CLI flags, you must
-	// stop and remove the container first with: packnplay stop <container-name>
-	if config.Verbose {
-		fmt.Fprintf(os.Stderr, "Checking for stopped container with same name...\n")
-	}
-
-	// Check if a container with this name exists (running or stopped)
-	existingID, err := dockerClient.Run("ps", "-aq", "--filter", fmt.Sprintf("name=^%s$", containerName))
-	existingID = strings.TrimSpace(existingID)
-
-	if err == nil && existingID != "" {
-		// Container exists - check if it's stopped
-		runningCheck, err := dockerClient.Run("ps", "-q", "--filter", fmt.Sprintf("name=^%s$", containerName))
-		runningCheck = strings.TrimSpace(runningCheck)
-
-		if err == nil && runningCheck == "" {
-			// Container exists but is not running - try to restart it
-			if warning := ignoredCreationFlags(config); warning != "" {
-				fmt.Fprintln(os.Stderr, warning)
-			}
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Found stopped container %s, attempting to restart...\n", containerName)
-			}
-
-			restartOutput, restartErr := dockerClient.Run("start", existingID)
-			if restartErr == nil {
-				// Successfully restarted - use the existing container
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Successfully restarted container %s\n", containerName)
-				}
-				containerID := existingID
-
-				// Run postStart command if defined (postStart runs every time container is accessed)
-				if err := executePostStart(dockerClient, containerID, devConfig.RemoteUser, config.Verbose, devConfig.PostStartCommand); err != nil {
-					return err
-				}
-
-				// Calculate working directory - respect workspaceFolder from devcontainer.json
-				// This should match the logic used in reconnect path (workDir) and container creation
-				restartWorkingDir := mountPath
-				if devConfig.WorkspaceFolder != "" {
-					restartWorkingDir = devConfig.WorkspaceFolder
-				}
-
-				// Exec into restarted container with user's command
-				return execIntoContainer(dockerClient, containerID, devConfig.RemoteUser, restartWorkingDir, config.Command, devConfig.ShouldOverrideCommand(), devConfig.ShutdownAction, nil, "")
-			}
-
-			// Restart failed - log and fall through to recreation
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Failed to restart container: %v\nWill remove and recreate: %s\n", restartErr, restartOutput)
-			}
-		}
-	}
-
-	// Either no container exists, or restart failed - remove any stopped container
-	// Try to remove - ignore errors if container doesn't exist
-	_, _ = dockerClient.Run("rm", containerName)
-
-	// Step 8: Get current user and detect OS
-	currentUser, err := user.Current()
-	if err != nil {
-		return fmt.Errorf("failed to get current user: %w", err)
-	}
-
-	// Check if we're on Linux (idmap only supported on Linux)
-	isLinux := os.Getenv("OSTYPE") == "linux-gnu" || fileExists("/proc/version")
-
-	// Note: Credentials are now managed by separate per-container files and watcher daemon
-	// No need for Keychain extraction during container startup
-
-	// Validate host requirements (advisory only - shows warnings but allows container to run)
-	if devConfig.HostRequirements != nil {
-		validateHostRequirements(devConfig.HostRequirements, config.Verbose)
-	}
-
-	// Build docker run command for background container
-	// Apple Container doesn't support -it with -d (detached mode)
-	// For detached containers, we don't need TTY flags since they run in background
-	isApple := currentUser.HomeDir != "" && !isLinux && dockerClient.Command() == "container"
-	var args []string
-	if isApple {
-		args = []string{"run", "-d", "--sig-proxy=false"}
-	} else {
-		// For standard Docker, detached mode with signal handling (Microsoft pattern)
-		args = []string{"run", "-d", "--sig-proxy=false"}
-	}
-
-	// Add labels
-	args = append(args, container.LabelsToArgs(labels)...)
-
-	// Add port attributes as labels (for IDE integration and metadata)
-	if len(devConfig.PortsAttributes) > 0 {
-		for port, attrs := range devConfig.PortsAttributes {
-			if attrs.Label != "" {
-				args = append(args, "--label",
-					fmt.Sprintf("devcontainer.port.%s.label=%s", port, attrs.Label))
-			}
-			if attrs.Protocol != "" {
-				args = append(args, "--label",
-					fmt.Sprintf("devcontainer.port.%s.protocol=%s", port, attrs.Protocol))
-			}
-			if attrs.OnAutoForward != "" {
-				args = append(args, "--label",
-					fmt.Sprintf("devcontainer.port.%s.onAutoForward=%s", port, attrs.OnAutoForward))
-			}
-			if attrs.RequireLocalPort != nil {
-				args = append(args, "--label",
-					fmt.Sprintf("devcontainer.port.%s.requireLocalPort=%t", port, *attrs.RequireLocalPort))
-			}
-			if attrs.ElevateIfNeeded != nil {
-				args = append(args, "--label",
-					fmt.Sprintf("devcontainer.port.%s.elevateIfNeeded=%t", port, *attrs.ElevateIfNeeded))
-			}
-		}
-	}
-
-	// Add name
-	args = append(args, "--name", containerName)
-
-	// Add mounts with or without idmap based on OS
-	homeDir := currentUser.HomeDir
-
-	// Mount .claude directory, workspace, and git directory (if worktree)
-	// Note: idmap support is kernel/Docker version dependent, so we don't use it for now
-	// Just use simple volume mounts and run as container's default user
-
-	// Check if we need container-managed credentials
-	hostCredFile := filepath.Join(homeDir, ".claude", ".credentials.json")
-	var needsCredentialOverlay bool
-	var credentialFile string
-
-	// Check if host has meaningful credentials (not just empty file)
-	hostHasCredentials := false
-	if fileExists(hostCredFile) {
-		if stat, err := os.Stat(hostCredFile); err == nil && stat.Size() >= 20 {
-			hostHasCredentials = true
-		}
-	}
-
-	if !hostHasCredentials {
-		needsCredentialOverlay = true
-		if config.Verbose {
-			if !fileExists(hostCredFile) {
-				fmt.Fprintf(os.Stderr, "Host has no .credentials.json, using container-managed credentials\n")
-			} else {
-				fmt.Fprintf(os.Stderr, "Host .credentials.json is too small (%d bytes), using container-managed credentials\n", getFileSize(hostCredFile))
-			}
-		}
-
-		var err error
-		credentialFile, err = getOrCreateContainerCredentialFile(containerName)
-		if err != nil {
-			return fmt.Errorf("failed to get credential file: %w", err)
-		}
-	} else {
-		if config.Verbose {
-			fmt.Fprintf(os.Stderr, "Using host .credentials.json (%d bytes)\n", getFileSize(hostCredFile))
-		}
-	}
-
-	// Mount .claude directory
-	args = append(args, "-v", fmt.Sprintf("%s/.claude:/home/%s/.claude", homeDir, devConfig.RemoteUser))
-
-	// Overlay mount credential file after .claude directory mount
-	if needsCredentialOverlay {
-		args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.claude/.credentials.json", credentialFile, devConfig.RemoteUser))
-	}
-
-	// Ensure parent directory exists in container by creating it on first run
-	// We'll create it after container starts but before exec
-
-	// Mount workspace - use workspaceMount if specified, otherwise default -v
-	if devConfig.WorkspaceMount != "" {
-		// Validate that workspaceFolder is also set (Microsoft spec requirement)
-		if devConfig.WorkspaceFolder == "" {
-			return fmt.Errorf("workspaceMount requires workspaceFolder to be set")
-		}
-
-		// Create substitution context for variable resolution
-		containerWorkspaceFolder := devConfig.WorkspaceFolder
-		if containerWorkspaceFolder == "" {
-			containerWorkspaceFolder = mountPath
-		}
-
-		ctx := &devcontainer.SubstituteContext{
-			LocalWorkspaceFolder:     mountPath,
-			ContainerWorkspaceFolder: containerWorkspaceFolder,
-			LocalEnv:                 getLocalEnvMap(),
-			ContainerEnv:             make(map[string]string),
-			Labels:                   labels,
-		}
-
-		// Perform variable substitution on workspaceMount
-		substituted := devcontainer.Substitute(ctx, devConfig.WorkspaceMount)
-		mountSpec, ok := substituted.(string)
-		if !ok {
-			return fmt.Errorf("workspaceMount substitution did not produce a string")
-		}
-
-		// Use Docker --mount syntax
-		args = append(args, "--mount", mountSpec)
-	} else {
-		// Default behavior: mount workspace at host path (preserving absolute paths)
-		args = append(args, "-v", fmt.Sprintf("%s:%s", mountPath, mountPath))
-	}
-
-	// Mount AI agent config directories using MountBuilder (replaces hardcoded list)
-	mountBuilder := NewMountBuilder(homeDir, devConfig.RemoteUser)
-	agentMounts := mountBuilder.BuildAgentMounts()
-	args = append(args, agentMounts...)
-
-	// If using a worktree, also mount the main repo's .git directory at its real path
-	// This allows the worktree's .git file (which contains gitdir: <path>) to resolve correctly
-	if mainRepoGitDir != "" {
-		args = append(args, "-v", fmt.Sprintf("%s:%s", mainRepoGitDir, mainRepoGitDir))
-	}
-
-	// Mount git config
-	if config.Credentials.Git {
-		gitconfigPath := filepath.Join(homeDir, ".gitconfig")
-		if fileExists(gitconfigPath) {
-			// Resolve symlinks to get the actual file path
-			resolvedPath, err := resolveMountPath(gitconfigPath)
-			if err != nil {
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Warning: failed to resolve .gitconfig symlink: %v\n", err)
-				}
-				// Fall back to original path if symlink resolution fails
-				resolvedPath = gitconfigPath
-			}
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.gitconfig:ro", resolvedPath, devConfig.RemoteUser))
-		}
-	}
-
-	// Mount SSH keys or forward SSH agent
-	if config.Credentials.SSHAgent {
-		socketPath, err := findSSHAgentSocket()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: SSH agent forwarding not available: %v\n", err)
-		} else {
-			containerSocket := "/tmp/ssh-agent.sock"
-			args = append(args, "-v", fmt.Sprintf("%s:%s", socketPath, containerSocket))
-			args = append(args, "-e", fmt.Sprintf("SSH_AUTH_SOCK=%s", containerSocket))
-		}
-	} else if config.Credentials.SSH {
-		sshPath := filepath.Join(homeDir, ".ssh")
-		if fileExists(sshPath) {
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.ssh:ro", sshPath, devConfig.RemoteUser))
-		}
-	} else {
-		warnSSHInsteadOfRules()
-	}
-
-	// Note: On macOS, gh credentials from Keychain are copied in after container starts
-	// On Linux, mount the gh config directory if it exists
-	if config.Credentials.GH && isLinux {
-		ghConfigPath := filepath.Join(homeDir, ".config", "gh")
-		if fileExists(ghConfigPath) {
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.config/gh", ghConfigPath, devConfig.RemoteUser))
-		}
-	}
-
-	// Mount OpenCode config directory if it exists (for opencode-ai CLI tool)
-	opencodeConfigPath := filepath.Join(homeDir, ".config", "opencode")
-	if fileExists(opencodeConfigPath) {
-		args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.config/opencode", opencodeConfigPath, devConfig.RemoteUser))
-	}
-
-	if config.Credentials.GPG {
-		// Mount .gnupg directory (read-only for security)
-		gnupgPath := filepath.Join(homeDir, ".gnupg")
-		if fileExists(gnupgPath) {
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.gnupg:ro", gnupgPath, devConfig.RemoteUser))
-		}
-	}
-
-	if config.Credentials.NPM {
-		// Mount .npmrc file
-		npmrcPath := filepath.Join(homeDir, ".npmrc")
-		if fileExists(npmrcPath) {
-			// Resolve symlinks to get the actual file path
-			resolvedPath, err := resolveMountPath(npmrcPath)
-			if err != nil {
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Warning: failed to resolve .npmrc symlink: %v\n", err)
-				}
-				// Fall back to original path if symlink resolution fails
-				resolvedPath = npmrcPath
-			}
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.npmrc:ro", resolvedPath, devConfig.RemoteUser))
-		}
-	}
-
-	// AWS credentials handling
-	// Track which credentials we obtained and from where to enforce priority order
-	var awsCredentials map[string]string
-	var awsCredSource string
-
-	if config.Credentials.AWS {
-		awsCredentials = make(map[string]string)
-
-		// Priority 1: Check if static credentials are already set in environment
-		if aws.HasStaticCredentials() {
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Using existing AWS credentials from environment variables\n")
-			}
-			// Get all AWS_* env vars from host, these will be added later
-			for key, value := range aws.GetAWSEnvVars() {
-				awsCredentials[key] = value
-			}
-		} else {
-			// Priority 2: Try credential_process if AWS_PROFILE is set
-			awsProfile := os.Getenv("AWS_PROFILE")
-			if awsProfile != "" {
-				credentialProcess, err := aws.ParseAWSConfig(awsProfile)
-				if err != nil {
-					// Always warn, not just in verbose mode
-					fmt.Fprintf(os.Stderr, "Warning: failed to get credential_process for profile '%s': %v\n", awsProfile, err)
-				} else {
-					if config.Verbose {
-						fmt.Fprintf(os.Stderr, "Executing credential_process for profile '%s'\n", awsProfile)
-					}
-					creds, err := aws.GetCredentialsFromProcess(credentialProcess)
-					if err != nil {
-						// Always warn, not just in verbose mode
-						fmt.Fprintf(os.Stderr, "Warning: credential_process failed: %v\n", err)
-					} else {
-						awsCredSource = "credential_process"
-						if config.Verbose {
-							fmt.Fprintf(os.Stderr, "Successfully obtained AWS credentials from credential_process\n")
-						}
-						// Add credentials from credential_process
-						awsCredentials["AWS_ACCESS_KEY_ID"] = creds.AccessKeyID
-						awsCredentials["AWS_SECRET_ACCESS_KEY"] = creds.SecretAccessKey
-						if creds.SessionToken != "" {
-							awsCredentials["AWS_SESSION_TOKEN"] = creds.SessionToken
-						}
-						// Also include other AWS_* env vars (region, profile, etc.) but not credentials
-						for key, value := range aws.GetAWSEnvVars() {
-							if key != "AWS_ACCESS_KEY_ID" && key != "AWS_SECRET_ACCESS_KEY" && key != "AWS_SESSION_TOKEN" {
-								awsCredentials[key] = value
-							}
-						}
-					}
-				}
-			} else if config.Verbose {
-				fmt.Fprintf(os.Stderr, "No AWS_PROFILE set, skipping credential_process lookup\n")
-			}
-
-			// If credential_process didn't work, try getting from environment anyway
-			if awsCredSource == "" {
-				for key, value := range aws.GetAWSEnvVars() {
-					awsCredentials[key] = value
-				}
-				if len(awsCredentials) > 0 {
-					if config.Verbose {
-						fmt.Fprintf(os.Stderr, "Using AWS environment variables from host\n")
-					}
-				}
-			}
-		}
-
-		// Mount ~/.aws directory if it exists (read-write for SSO token refresh)
-		awsPath := filepath.Join(homeDir, ".aws")
-		if fileExists(awsPath) {
-			// Use read-write mount to allow SSO token refresh and CLI caching
-			args = append(args, "-v", fmt.Sprintf("%s:/home/%s/.aws", awsPath, devConfig.RemoteUser))
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Mounting AWS config directory (read-write for token refresh)\n")
-			}
-		} else {
-			// Always warn if ~/.aws is missing, not just in verbose
-			fmt.Fprintf(os.Stderr, "Warning: ~/.aws directory not found, AWS CLI config and SSO cache unavailable\n")
-		}
-	}
-
-	// Set working directory - respect workspaceFolder from devcontainer.json
-	workingDir := mountPath
-	if devConfig.WorkspaceFolder != "" {
-		workingDir = devConfig.WorkspaceFolder
-	}
-
-	args = append(args, "-w", workingDir)
-
-	// Add environment variables
-	// Only pass safe terminal/locale variables - nothing else from host
-	safeEnvVars := []string{"TERM", "LANG", "LC_ALL", "LC_CTYPE", "LC_MESSAGES", "COLORTERM"}
-	for _, key := range safeEnvVars {
-		if value := os.Getenv(key); value != "" {
-			args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
-		}
-	}
-
-	// Set HOME to container user's home directory (don't use host HOME)
-	args = append(args, "-e", fmt.Sprintf("HOME=/home/%s", devConfig.RemoteUser))
-
-	// Add IS_SANDBOX marker so tools know they're in a sandbox
-	args = append(args, "-e", "IS_SANDBOX=1")
-
-	// Don't set PATH - use container's default PATH to avoid host pollution
-
-	// Add default environment variables (API keys for AI agents)
-	for _, envVar := range config.DefaultEnvVars {
-		if value := os.Getenv(envVar); value != "" {
-			args = append(args, "-e", fmt.Sprintf("%s=%s", envVar, value))
-		}
-	}
-
-	// Add AWS environment variables BEFORE user-specified env vars
-	// This allows users to override AWS credentials if needed with --env flags
-	if config.Credentials.AWS && len(awsCredentials) > 0 {
-		// Add in deterministic order to avoid randomness from map iteration
-		// Priority order: credentials first, then config vars
-		credentialKeys := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
-		for _, key := range credentialKeys {
-			if value, exists := awsCredentials[key]; exists {
-				args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
-			}
-		}
-		// Then add other AWS vars (region, profile, etc.) in sorted order
-		var otherKeys []string
-		for key := range awsCredentials {
-			isCredKey := false
-			for _, credKey := range credentialKeys {
-				if key == credKey {
-					isCredKey = true
-					break
-				}
-			}
-			if !isCredKey {
-				otherKeys = append(otherKeys, key)
-			}
-		}
-		// Sort for deterministic output
-		for _, key := range otherKeys {
-			args = append(args, "-e", fmt.Sprintf("%s=%s", key, awsCredentials[key]))
-		}
-	}
-
-	// Apply environment variables from devcontainer.json with variable substitution
-	// This happens AFTER AWS credentials but BEFORE user --env flags
-	// so that user flags can override devcontainer vars
-	if devConfig.ContainerEnv != nil || devConfig.RemoteEnv != nil {
-		// Create substitution context for variable resolution
-		ctx := &devcontainer.SubstituteContext{
-			LocalWorkspaceFolder:     mountPath,
-			ContainerWorkspaceFolder: workingDir,
-			LocalEnv:                 getLocalEnvMap(),
-			ContainerEnv:             make(map[string]string),
-			Labels:                   labels,
-		}
-
-		// Get resolved environment variables with substitution applied
-		devEnvVars := devConfig.GetResolvedEnvironment(ctx)
-
-		// Add each resolved env var to docker args in deterministic order
-		var envKeys []string
-		for k := range devEnvVars {
-			envKeys = append(envKeys, k)
-		}
-		sort.Strings(envKeys)
-		for _, k := range envKeys {
-			args = append(args, "-e", fmt.Sprintf("%s=%s", k, devEnvVars[k]))
-		}
-	}
-
-	// Add user-specified env vars from --env flags (these can override defaults, AWS, and devcontainer)
-	for _, env := range config.Env {
-		// Support both --env KEY=value and --env KEY (pass through from host)
-		if strings.Contains(env, "=") {
-			// KEY=value format - set specific value
-			args = append(args, "-e", env)
-		} else {
-			// KEY format - pass through current value from host
-			if value := os.Getenv(env); value != "" {
-				args = append(args, "-e", fmt.Sprintf("%s=%s", env, value))
-			}
-		}
-	}
-
-	// Parse and apply port forwarding from devcontainer.json
-	// Devcontainer ports are prepended so CLI -p flags take priority
-	var publishPorts []string
-	if len(devConfig.ForwardPorts) > 0 {
-		devPorts, err := devcontainer.ParseForwardPorts(devConfig.ForwardPorts)
-		if err != nil {
-			return fmt.Errorf("failed to parse forwardPorts from devcontainer.json: %w", err)
-		}
-		// Prepend devcontainer ports so CLI -p flags (in config.PublishPorts) override
-		publishPorts = append(devPorts, config.PublishPorts...)
-	} else {
-		publishPorts = config.PublishPorts
-	}
-
-	// Add port mappings (devcontainer ports + CLI -p flags)
-	for _, port := range publishPorts {
-		args = append(args, "-p", port)
-	}
-
-	// Add custom mounts from devcontainer.json
-	for _, mount := range devConfig.Mounts {
-		// Create substitution context for variable resolution
-		ctx := &devcontainer.SubstituteContext{
-			LocalWorkspaceFolder:     mountPath,
-			ContainerWorkspaceFolder: workingDir,
-			LocalEnv:                 getLocalEnvMap(),
-			ContainerEnv:             make(map[string]string),
-			Labels:                   labels,
-		}
-
-		// Apply variable substitution to mount string
-		substitutedMount := devcontainer.Substitute(ctx, mount).(string)
-
-		// Add as Docker mount flag
-		args = append(args, "--mount", substitutedMount)
-	}
-
-	// Add CLI volume mounts (-v flags)
-	for _, vol := range config.Volumes {
-		args = append(args, "-v", normalizeVolume(vol))
-	}
-
-	// Add user for container operations (docker run --user)
-	// Use containerUser if specified, otherwise fall back to remoteUser for backward compatibility
-	containerUser := devConfig.ContainerUser
-	if containerUser == "" {
-		containerUser = devConfig.RemoteUser
-	}
-	if containerUser != "" {
-		args = append(args, "--user", containerUser)
-	}
-
-	// Add custom Docker run arguments from devcontainer.json
-	for _, runArg := range devConfig.RunArgs {
-		// Create substitution context for variable resolution
-		ctx := &devcontainer.SubstituteContext{
-			LocalWorkspaceFolder:     mountPath,
-			ContainerWorkspaceFolder: workingDir,
-			LocalEnv:                 getLocalEnvMap(),
-			ContainerEnv:             make(map[string]string),
-			Labels:                   labels,
-		}
-
-		// Apply variable substitution to run argument
-		substitutedArg := devcontainer.Substitute(ctx, runArg).(string)
-
-		// Add to Docker run command
-		args = append(args, substitutedArg)
-	}
-
-	// Apply security properties from devcontainer.json
-	// These are applied before feature properties so features can override them if needed
-	if devConfig.Privileged != nil && *devConfig.Privileged {
-		args = append(args, "--privileged")
-	}
-
-	if devConfig.Init != nil && *devConfig.Init {
-		args = append(args, "--init")
-	}
-
-	for _, cap := range devConfig.CapAdd {
-		if cap != "" {
-			args = append(args, "--cap-add="+cap)
+// performShutdownAction executes the specified shutdown action
+func performShutdownAction(action string, dockerClient DockerClient, containerID string, composeFiles []string, composeWorkDir string) error {
+	switch action {
+	case "stopContainer":
+		if err := RunPreStop(dockerClient, containerID, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 		}
-	}
-
-	for _, secOpt := range devConfig.SecurityOpt {
-		if secOpt != "" {
-			args = append(args, "--security-opt="+secOpt)
+		// Copied credentials are copied in again if the container is restarted
+		if err := ScrubInjectedCredentials(dockerClient, containerID); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 		}
-	}
+		containerHooks, hookPayload, hookErr := LoadContainerHooks(dockerClient, containerID)
+		fmt.Fprintf(os.Stderr, "Stopping container %s...\n", containerID)
+		if output, err := dockerClient.Run("stop", containerID); err != nil {
+			return fmt.Errorf("failed to stop container: %w (output: %s)", err, output)
+		}
+		RecordAudit(audit.Event{Type: audit.TypeStop, ContainerID: containerID})
+		if hookErr == nil {
+			hookErr = containerHooks.Run(hooks.PostStop, hookPayload, false)
+		}
+		if hookErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", hookErr)
+		}
+		return nil
 
-	// Track entrypoint args from features and config (declared here so it's available later)
-	var entrypointArgs []string
-	var entrypointSet bool
-	var entrypointSource string
-
-	// Apply entrypoint from devcontainer.json if specified
-	if len(devConfig.Entrypoint) > 0 {
-		args = append(args, "--entrypoint="+devConfig.Entrypoint[0])
-		if len(devConfig.Entrypoint) > 1 {
-			entrypointArgs = devConfig.Entrypoint[1:]
+	case "stopCompose":
+		if len(composeFiles) == 0 || composeWorkDir == "" {
+			return fmt.Errorf("stopCompose requires compose files and work directory")
 		}
-		entrypointSet = true
-		entrypointSource = "devcontainer.json"
-	}
-
-	// Apply feature-contributed container properties (security options, capabilities, etc.)
-	if len(devConfig.Features) > 0 {
-		// Resolve features for properties application
-		// Use the same lockfile loaded earlier to ensure consistent feature versions
-		resolver := devcontainer.NewFeatureResolver(filepath.Join(os.TempDir(), "packnplay-features-cache"), lockfile)
-
-		var resolvedFeatures []*devcontainer.ResolvedFeature
-		for reference, options := range devConfig.Features {
-			// Convert options from map[string]interface{} if needed
-			optionsMap, ok := options.(map[string]interface{})
-			if !ok {
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Warning: invalid options format for feature %s\n", reference)
-				}
-				continue
-			}
+		fmt.Fprintf(os.Stderr, "Stopping Docker Compose services...\n")
 
-			// Use absolute path if provided, otherwise resolve relative to .devcontainer
-			// Don't modify OCI registry references (they contain registry domains)
-			fullPath := reference
-			if !filepath.IsAbs(reference) && !strings.Contains(reference, "ghcr.io/") && !strings.Contains(reference, "mcr.microsoft.com/") {
-				fullPath = filepath.Join(mountPath, ".devcontainer", reference)
-			}
+		args := []string{"compose"}
+		for _, f := range composeFiles {
+			args = append(args, "-f", f)
+		}
+		args = append(args, "down")
 
-			feature, err := resolver.ResolveFeature(fullPath, optionsMap)
-			if err != nil {
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Warning: failed to resolve feature %s for properties: %v\n", reference, err)
-				}
-				continue
-			}
-			resolvedFeatures = append(resolvedFeatures, feature)
+		downCmd := exec.Command(dockerClient.Command(), args...)
+		downCmd.Dir = composeWorkDir
+		if output, err := downCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to stop compose services: %w (output: %s)", err, output)
 		}
+		return nil
 
-		// Apply feature container properties if we successfully resolved features
-		if len(resolvedFeatures) > 0 {
-			applier := NewFeaturePropertiesApplier()
-
-			// Create substitution context for feature mount variable resolution
-			ctx := &devcontainer.SubstituteContext{
-				LocalWorkspaceFolder:     mountPath,
-				ContainerWorkspaceFolder: workingDir,
-				LocalEnv:                 getLocalEnvMap(),
-				ContainerEnv:             make(map[string]string),
-				Labels:                   labels,
-			}
+	case "none", "":
+		// No action needed
+		return nil
 
-			// Collect current environment variables that have been added to args
-			currentEnv := make(map[string]string)
+	default:
+		return fmt.Errorf("unknown shutdownAction: %s", action)
+	}
+}
 
-			// Apply feature properties with variable substitution
-			// Pass entrypoint tracking so features can warn if they override config entrypoint
-			var enhancedEnv map[string]string
-			args, enhancedEnv, entrypointArgs, _, _ = applier.ApplyFeatureProperties(args, resolvedFeatures, currentEnv, ctx, entrypointSet, entrypointSource)
+// Run brings up the workspace's container, reusing an existing one when it
+// can, and execs the configured command in it
+func Run(config *RunConfig) error {
+	err := run(config)
+	config.Events.Failed(err)
+	return err
+}
 
-			// Add feature-contributed environment variables to docker args
-			// These go after devcontainer env but can still be overridden by user --env flags
-			for k, v := range enhancedEnv {
-				args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
-			}
-		}
+func run(config *RunConfig) error {
+	path := config.HostPath
+	if path == "" {
+		path = config.Path
 	}
-
-	// Add image
-	imageName := devConfig.Image
-	if devConfig.HasDockerfile() || len(devConfig.Features) > 0 {
-		imageName = container.GenerateImageName(workDir)
+	config.Events.Emit(events.Event{Type: events.TypeRunStarted, Path: path})
+	finishResolve := config.Events.Phase(events.PhaseResolve)
+	ws, err := ResolveWorkspace(config)
+	if err != nil {
+		finishResolve(err)
+		return err
 	}
-	args = append(args, imageName)
 
-	// Add signal-aware command that keeps container alive (Microsoft pattern)
-	// This provides graceful shutdown handling for SIGTERM/SIGINT
-	// If a feature provides entrypoint args (e.g., ["/bin/sh", "-c"]), prepend them to the command
-	if len(entrypointArgs) > 0 {
-		// Feature provided an entrypoint like ["/bin/sh", "-c"]
-		// The first element is set via --entrypoint, remaining elements are command args
-		args = append(args, entrypointArgs...)
-		args = append(args, "echo 'Container started' && trap 'exit 0' 15 && while true; do sleep 1 & wait $!; done")
-	} else {
-		// No feature entrypoint, use default /bin/sh -c wrapper
-		args = append(args, "/bin/sh", "-c", "echo 'Container started' && trap 'exit 0' 15 && while true; do sleep 1 & wait $!; done")
-	}
+	// Local-only timing metrics, summarized by `packnplay stats`
+	runStart := time.Now()
+	recorder := stats.NewRecorder(stats.DefaultPath(), ws.WorkDir)
 
-	// Step 9: Start container in background
-	if config.Verbose {
-		fmt.Fprintf(os.Stderr, "Starting container %s\n", containerName)
-		fmt.Fprintf(os.Stderr, "Full command: docker %v\n", args)
+	devConfig, err := ResolveConfig(config, ws)
+	finishResolve(err)
+	if err != nil {
+		return err
 	}
 
-	containerID, err := dockerClient.Run(args...)
+	dockerClient, err := newDockerClient(config.Runtime, config.Verbose)
 	if err != nil {
-		return fmt.Errorf("failed to start container: %w\nDocker output:\n%s", err, containerID)
+		return errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to initialize container runtime: %w", err)
 	}
-	containerID = strings.TrimSpace(containerID)
 
-	// Step 10: Ensure host directory structure exists in container
-	dirCommands := generateDirectoryCreationCommands(mountPath)
-	for _, dirCmd := range dirCommands {
-		if config.Verbose {
-			fmt.Fprintf(os.Stderr, "Creating directory structure: %v\n", dirCmd)
-		}
-		_, err := dockerClient.Run(append([]string{"exec", containerID}, dirCmd...)...)
-		if err != nil {
-			_, _ = dockerClient.Run("rm", "-f", containerID)
-			return fmt.Errorf("failed to create directory structure: %w", err)
+	// Route to Docker Compose workflow if compose mode
+	if len(devConfig.GetDockerComposeFiles()) > 0 {
+		if config.DockerSocket {
+			fmt.Fprintf(os.Stderr, "Warning: --docker-socket is not supported with dockerComposeFile configurations; mount the socket in the compose file instead\n")
 		}
+		// Note: Compose mode does not load lockfile because features are not supported
+		// in compose mode (compose uses pre-built service images, not custom image builds)
+		return runWithCompose(devConfig, config, ws.MountPath, ws.WorkDir, ws.WorktreeName, dockerClient)
 	}
 
-	// Step 11: Copy config files into container
-
-	// Copy ~/.claude.json
-	claudeConfigSrc := filepath.Join(homeDir, ".claude.json")
-	if _, err := os.Stat(claudeConfigSrc); err == nil {
-		if err := copyFileToContainer(dockerClient, containerID, claudeConfigSrc, fmt.Sprintf("/home/%s/.claude.json", devConfig.RemoteUser), devConfig.RemoteUser, config.Verbose); err != nil {
-			_, _ = dockerClient.Run("rm", "-f", containerID)
-			return fmt.Errorf("failed to copy .claude.json: %w", err)
-		}
+	// Load lockfile if it exists
+	// This ensures consistent feature versions across image build, property resolution, and lifecycle merging
+	lockfile, err := devcontainer.LoadLockFile(ws.MountPath)
+	if err != nil {
+		return errdefs.Errorf(errdefs.CategoryConfig, "failed to load lockfile: %w", err)
 	}
 
-	// Copy container-managed credentials into place if needed (host has no .credentials.json)
-	hostCredFile2 := filepath.Join(homeDir, ".claude", ".credentials.json")
-	if !fileExists(hostCredFile2) {
-		if config.Verbose {
-			fmt.Fprintf(os.Stderr, "Copying container credentials into .claude directory...\n")
-		}
-		// Copy from mounted temp location to .claude directory
-		_, err = dockerClient.Run("exec", containerID, "cp", "/tmp/packnplay-credentials.json", fmt.Sprintf("/home/%s/.claude/.credentials.json", devConfig.RemoteUser))
-		if err != nil && config.Verbose {
-			fmt.Fprintf(os.Stderr, "Warning: failed to copy credentials: %v\n", err)
-		}
+	// Stop between steps on Ctrl-C, rather than leave a half-created container
+	if !config.DryRun {
+		config.interrupts = guardInterrupts()
+		defer config.interrupts.Stop()
 	}
 
-	// Copy SSH config into container when using SSH agent forwarding
-	if config.Credentials.SSHAgent {
-		sshConfig := filepath.Join(homeDir, ".ssh", "config")
-		if fileExists(sshConfig) {
-			dstDir := fmt.Sprintf("/home/%s/.ssh", devConfig.RemoteUser)
-			// Create .ssh dir with correct ownership and permissions
-			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "mkdir", "-p", dstDir)
-			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chown", fmt.Sprintf("%s:%s", devConfig.RemoteUser, devConfig.RemoteUser), dstDir)
-			_, _ = dockerClient.Run("exec", "-u", "root", containerID, "chmod", "700", dstDir)
-			if err := copyFileToContainer(dockerClient, containerID, sshConfig, dstDir+"/config", devConfig.RemoteUser, config.Verbose); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: failed to copy SSH config: %v\n", err)
-			}
-		}
+	finishImage := config.Events.Phase(events.PhaseImage)
+	imageName, err := PrepareImage(dockerClient, config, ws, devConfig, lockfile, recorder)
+	if config.interrupts.Interrupted() {
+		err = interruptedError("while preparing the image; build caches are kept")
 	}
-
-	// Step 10.5: Update remote user UID/GID to match host (Linux only)
-	// This prevents permission issues with mounted volumes
-	if devConfig.UpdateRemoteUserUID && devConfig.RemoteUser != "" && devConfig.RemoteUser != "root" {
-		if err := updateRemoteUserUID(dockerClient, containerID, devConfig.RemoteUser, config.Verbose); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to update remote user UID/GID: %v\n", err)
-			// Continue anyway - this is not a fatal error
-		}
+	finishImage(err)
+	if err != nil {
+		return err
 	}
 
-	// Step 11: Execute lifecycle commands from devcontainer.json
-	// Commands are tracked: onCreate/postCreate run once, postStart always runs
-	// Feature lifecycle commands execute before user commands per specification
-	//
-	// IMPORTANT: All lifecycle commands execute synchronously in order before the user
-	// command runs. This implicitly honors the waitFor property - the container is only
-	// considered ready after all lifecycle commands complete. The waitFor property is
-	// primarily informational for editors that might run commands in the background.
-	hasLifecycleCommands := devConfig.OnCreateCommand != nil || devConfig.UpdateContentCommand != nil || devConfig.PostCreateCommand != nil || devConfig.PostStartCommand != nil
-	hasFeatures := len(devConfig.Features) > 0
-
-	if hasLifecycleCommands || hasFeatures {
-		// Load metadata for tracking lifecycle execution
-		metadata, err := LoadMetadata(containerID)
+	if config.DryRun {
+		spec, err := BuildRunSpec(dockerClient, config, ws, devConfig, lockfile, imageName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to load metadata, commands will run: %v\n", err)
-			// Continue with nil metadata - commands will run but not be tracked
-			metadata = nil
-		}
-
-		executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.RemoteUser, config.Verbose, metadata)
-
-		// Resolve features and merge lifecycle commands if features exist
-		var mergedCommands map[string]*devcontainer.LifecycleCommand
-		if hasFeatures {
-			// Resolve features for lifecycle merging
-			// Use the same lockfile loaded earlier to ensure consistent feature versions
-			resolver := devcontainer.NewFeatureResolver(filepath.Join(os.TempDir(), "packnplay-features-cache"), lockfile)
-
-			var resolvedFeatures []*devcontainer.ResolvedFeature
-			for reference, options := range devConfig.Features {
-				// Convert options from map[string]interface{} if needed
-				optionsMap, ok := options.(map[string]interface{})
-				if !ok {
-					if config.Verbose {
-						fmt.Fprintf(os.Stderr, "Warning: skipping feature %s with invalid options type\n", reference)
-					}
-					continue
-				}
-
-				// Use absolute path if provided, otherwise resolve relative to .devcontainer
-				// Don't modify OCI registry references (they contain registry domains)
-				fullPath := reference
-				if !filepath.IsAbs(reference) && !strings.Contains(reference, "ghcr.io/") && !strings.Contains(reference, "mcr.microsoft.com/") {
-					fullPath = filepath.Join(mountPath, ".devcontainer", reference)
-				}
-
-				feature, err := resolver.ResolveFeature(fullPath, optionsMap)
-				if err != nil {
-					if config.Verbose {
-						fmt.Fprintf(os.Stderr, "Warning: failed to resolve feature %s for lifecycle: %v\n", reference, err)
-					}
-					continue
-				}
-				resolvedFeatures = append(resolvedFeatures, feature)
-			}
-
-			// Merge feature and user lifecycle commands
-			if len(resolvedFeatures) > 0 {
-				merger := devcontainer.NewLifecycleMerger()
-				userCommands := map[string]*devcontainer.LifecycleCommand{
-					"onCreateCommand":      devConfig.OnCreateCommand,
-					"updateContentCommand": devConfig.UpdateContentCommand,
-					"postCreateCommand":    devConfig.PostCreateCommand,
-					"postStartCommand":     devConfig.PostStartCommand,
-				}
-				mergedCommands = merger.MergeCommands(resolvedFeatures, userCommands)
-			}
-		}
-
-		// Use merged commands if available, otherwise use user commands directly
-		onCreateCmd := devConfig.OnCreateCommand
-		updateContentCmd := devConfig.UpdateContentCommand
-		postCreateCmd := devConfig.PostCreateCommand
-		postStartCmd := devConfig.PostStartCommand
-
-		if mergedCommands != nil {
-			if cmd, exists := mergedCommands["onCreateCommand"]; exists {
-				onCreateCmd = cmd
-			}
-			if cmd, exists := mergedCommands["updateContentCommand"]; exists {
-				updateContentCmd = cmd
-			}
-			if cmd, exists := mergedCommands["postCreateCommand"]; exists {
-				postCreateCmd = cmd
-			}
-			if cmd, exists := mergedCommands["postStartCommand"]; exists {
-				postStartCmd = cmd
-			}
-		}
-
-		// onCreateCommand - runs once on creation, re-runs if command changes
-		if onCreateCmd != nil {
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Running onCreateCommand...\n")
-			}
-			if err := executor.Execute("onCreate", onCreateCmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: onCreateCommand failed: %v\n", err)
-			}
+			return err
 		}
+		return PrintRunSpec(os.Stdout, spec, config.DryRunJSON)
+	}
 
-		// updateContentCommand - runs after workspace content is mounted (e.g., 'npm install')
-		// Runs once on creation, re-runs if command changes
-		if updateContentCmd != nil {
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Running updateContentCommand...\n")
-			}
-			if err := executor.Execute("updateContent", updateContentCmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: updateContentCommand failed: %v\n", err)
-			}
+	// Execute initializeCommand on HOST if present
+	// This runs BEFORE container creation, on the host machine
+	if config.Repo != "" {
+		// Only the repository's devcontainer configuration is on the host
+		if devConfig.InitializeCommand != nil {
+			fmt.Fprintf(os.Stderr, "Skipping initializeCommand: %s has no host checkout to run it in\n", config.Repo)
 		}
+	} else if err := executeInitializeCommand(devConfig.InitializeCommand, ws.MountPath, config.Verbose); err != nil {
+		return err
+	}
 
-		// postCreateCommand - runs once after creation, re-runs if command changes
-		if postCreateCmd != nil {
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Running postCreateCommand...\n")
-			}
-			if err := executor.Execute("postCreate", postCreateCmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: postCreateCommand failed: %v\n", err)
-			}
-		}
+	if reused, err := reuseExistingContainer(dockerClient, config, ws, devConfig, lockfile, imageName, recorder, runStart); reused {
+		return err
+	}
 
-		// postStartCommand - runs every time container starts
-		if postStartCmd != nil {
-			if config.Verbose {
-				fmt.Fprintf(os.Stderr, "Running postStartCommand...\n")
-			}
-			if err := executor.Execute("postStart", postStartCmd); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: postStartCommand failed: %v\n", err)
-			}
-		}
+	// Either no container exists, or restart failed - remove any stopped container
+	// Try to remove - ignore errors if container doesn't exist
+	_, _ = dockerClient.Run("rm", container.GenerateContainerName(ws.WorkDir, ws.WorktreeName))
+
+	// Scan the image before creating a container from it
+	scanner := vulnscan.New(vulnscan.Options{
+		Scanner:  config.VulnScan.Scanner,
+		Severity: config.VulnScan.Severity,
+		Ignore:   config.VulnScan.Ignore,
+		Runtime:  dockerClient.Command(),
+	})
+	if err := vulnerabilityGate(config.VulnScan.Mode, imageName, scanner, confirmOnTerminal, config.Verbose); err != nil {
+		return err
+	}
 
-		// Save metadata after lifecycle execution
-		if metadata != nil {
-			if err := SaveMetadata(metadata); err != nil {
-				// Warn but don't fail container startup
-				if config.Verbose {
-					fmt.Fprintf(os.Stderr, "Warning: failed to save metadata: %v\n", err)
-				}
-			}
-		}
+	spec, err := BuildRunSpec(dockerClient, config, ws, devConfig, lockfile, imageName)
+	if err != nil {
+		return err
+	}
+	if config.Ephemeral && spec.needsCredentialOverlay {
+		defer os.Remove(spec.credentialFile)
+	}
 
-		// Validate and log waitFor property
-		// Since we execute synchronously, all commands complete before proceeding.
-		// This validates the property is set correctly and provides transparency.
-		if devConfig.WaitFor != "" {
-			validCommands := map[string]bool{
-				"onCreateCommand":      true,
-				"updateContentCommand": true,
-				"postCreateCommand":    true,
-				"postStartCommand":     true,
-			}
-			if !validCommands[devConfig.WaitFor] {
-				fmt.Fprintf(os.Stderr, "Warning: waitFor value '%s' is not a valid lifecycle command\n", devConfig.WaitFor)
-			} else if config.Verbose {
-				fmt.Fprintf(os.Stderr, "waitFor: %s (completed synchronously)\n", devConfig.WaitFor)
+	finishCreate := config.Events.Phase(events.PhaseCreate)
+	containerID, err := CreateContainer(dockerClient, config, spec)
+	// An interrupt often makes the step in progress fail, possibly after the
+	// container was created, so it's removed either way
+	if config.interrupts.Interrupted() {
+		rollBackCreation(dockerClient, spec)
+		err = interruptedError("while creating %s; removed it, the image and build caches are kept", spec.ContainerName)
+	}
+	finishCreate(err)
+	if err != nil {
+		return err
+	}
+	if config.Ephemeral {
+		// Safety net for failures before the user command runs; harmless once it's gone
+		defer func() {
+			_, _ = dockerClient.Run("rm", "-f", containerID)
+			if len(spec.Services) > 0 {
+				_ = RemoveSidecars(dockerClient, spec.ContainerName)
 			}
-		}
+		}()
 	}
 
-	// Step 12: Exec into container with user's command
-	cmdPath, err := exec.LookPath(dockerClient.Command())
+	finishLifecycle := config.Events.Phase(events.PhaseLifecycle)
+	err = RunLifecycle(dockerClient, config, spec, containerID, recorder)
+	finishLifecycle(err)
 	if err != nil {
-		return fmt.Errorf("failed to find docker command: %w", err)
+		return err
 	}
 
-	execArgs := []string{filepath.Base(cmdPath), "exec"}
-	execArgs = append(execArgs, getTTYFlags()...)
+	recorder.Record(stats.PhaseStartup, time.Since(runStart), false)
+	return Attach(dockerClient, config, spec, containerID)
+}
 
-	// Add user flag to exec if remoteUser is specified
-	if devConfig.RemoteUser != "" {
-		execArgs = append(execArgs, "--user", devConfig.RemoteUser)
+// absoluteComposePaths resolves compose file paths, which are relative to the
+// directory holding the devcontainer.json
+func absoluteComposePaths(composeFiles []string, mountPath string) []string {
+	devcontainerDir := filepath.Dir(devcontainer.ConfigFilePath(mountPath))
+	absoluteComposeFiles := make([]string, len(composeFiles))
+	for i, f := range composeFiles {
+		if filepath.IsAbs(f) {
+			absoluteComposeFiles[i] = f
+		} else {
+			absoluteComposeFiles[i] = filepath.Join(devcontainerDir, f)
+		}
 	}
-
-	execArgs = append(execArgs, "-w", workingDir, containerID)
-	execArgs = append(execArgs, config.Command...)
-
-	// Use syscall.Exec to replace current process
-	return syscall.Exec(cmdPath, execArgs, os.Environ())
+	return absoluteComposeFiles
 }
 
 // runWithCompose handles Docker Compose orchestration
-func runWithCompose(devConfig *devcontainer.Config, config *RunConfig, mountPath, workDir, worktreeName string, dockerClient *docker.Client) error {
+func runWithCompose(devConfig *devcontainer.Config, config *RunConfig, mountPath, workDir, worktreeName string, dockerClient DockerClient) error {
 	// Validate compose configuration
 	if devConfig.Service == "" {
-		return fmt.Errorf("dockerComposeFile requires 'service' property")
+		return errdefs.Errorf(errdefs.CategoryConfig, "dockerComposeFile requires 'service' property")
 	}
 
 	composeFiles := devConfig.GetDockerComposeFiles()
 	if len(composeFiles) == 0 {
-		return fmt.Errorf("no compose files specified")
+		return errdefs.Errorf(errdefs.CategoryConfig, "no compose files specified")
 	}
 
-	// Convert relative compose file paths to absolute paths
-	// Compose file paths are relative to the devcontainer.json location (.devcontainer/)
-	devcontainerDir := filepath.Join(mountPath, ".devcontainer")
-	absoluteComposeFiles := make([]string, len(composeFiles))
-	for i, f := range composeFiles {
-		if filepath.IsAbs(f) {
-			absoluteComposeFiles[i] = f
-		} else {
-			absoluteComposeFiles[i] = filepath.Join(devcontainerDir, f)
-		}
-	}
+	absoluteComposeFiles := absoluteComposePaths(composeFiles, mountPath)
 
 	// Validate compose files exist
 	if err := compose.ValidateComposeFiles(mountPath, absoluteComposeFiles); err != nil {
+		return errdefs.New(errdefs.CategoryConfig, err)
+	}
+
+	// Compose containers carry no packnplay labels, so hooks run only here and
+	// stop/attach can't replay them
+	runHooks, err := containerHooks(config, devConfig, workDir)
+	if err != nil {
 		return err
 	}
+	hookPayload := hooks.Payload{
+		Container: devConfig.Service,
+		Project:   filepath.Base(workDir),
+		Worktree:  worktreeName,
+		HostPath:  mountPath,
+		Runtime:   dockerClient.Command(),
+	}
 
 	// Execute initializeCommand on HOST if present (same as standard workflow)
 	if err := executeInitializeCommand(devConfig.InitializeCommand, mountPath, config.Verbose); err != nil {
 		return err
 	}
+	if err := runHooks.Run(hooks.PreCreate, hookPayload, config.Verbose); err != nil {
+		return errdefs.Errorf(errdefs.CategoryLifecycle, "%w", err)
+	}
+
+	// forwardPorts entries such as "db:5432" are published by the compose
+	// service they name, through an override file for this up only
+	upFiles := absoluteComposeFiles
+	servicePorts, err := devcontainer.ServiceForwardPorts(devConfig.ForwardPorts)
+	if err != nil {
+		return errdefs.Errorf(errdefs.CategoryConfig, "failed to parse forwardPorts from devcontainer.json: %w", err)
+	}
+	if len(servicePorts) > 0 {
+		published := map[string][]string{}
+		for _, port := range servicePorts {
+			published[port.Service] = append(published[port.Service], port.PublishArg())
+		}
+		override, err := compose.WritePortsOverride(published)
+		if err != nil {
+			return errdefs.New(errdefs.CategoryContainer, err)
+		}
+		defer os.Remove(override)
+		upFiles = append(append([]string{}, absoluteComposeFiles...), override)
+	}
 
 	// Create compose runner
 	composeRunner := compose.NewRunner(
 		mountPath,
-		absoluteComposeFiles,
+		upFiles,
 		devConfig.Service,
 		devConfig.RunServices,
 		dockerClient,
@@ -1574,12 +738,17 @@ func runWithCompose(devConfig *devcontainer.Config, config *RunConfig, mountPath
 	fmt.Fprintf(os.Stderr, "Starting Docker Compose services...\n")
 	containerID, err := composeRunner.Up()
 	if err != nil {
-		return err
+		return errdefs.New(errdefs.CategoryContainer, err)
 	}
 
 	if config.Verbose {
 		fmt.Fprintf(os.Stderr, "Service container ID: %s\n", containerID)
 	}
+	config.Events.Emit(events.Event{Type: events.TypeContainerCreated, Container: devConfig.Service, ContainerID: containerID})
+	RecordAudit(audit.Event{Type: audit.TypeCreate, Project: workDir, Container: devConfig.Service, ContainerID: containerID, Credentials: auditCredentials(config.Credentials, "", false)})
+	// compose up keeps a running service container, so postStart only runs
+	// when this up (or the runtime) started it
+	recordContainerStart(dockerClient, containerID, config.Verbose)
 
 	// Detect RemoteUser if not specified
 	if devConfig.RemoteUser == "" {
@@ -1621,7 +790,14 @@ func runWithCompose(devConfig *devcontainer.Config, config *RunConfig, mountPath
 			metadata = nil
 		}
 
-		executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.RemoteUser, config.Verbose, metadata)
+		executor := NewLifecycleExecutor(dockerClient, containerID, devConfig.LifecycleUser(), config.Verbose, metadata)
+		executor.SetRecorder(stats.NewRecorder(stats.DefaultPath(), workDir))
+		executor.SetEvents(config.Events)
+		executor.SetAudit(workDir, devConfig.Service)
+		executor.SetWorkingDir(workingDir)
+		executor.SetEnv(refreshRemoteEnv(dockerClient, containerID, devConfig, mountPath, workingDir, false))
+		executor.SetTaskPolicy(lifecycleTaskPolicy(devConfig))
+		executor.SetShell(lifecycleShell(devConfig))
 
 		// onCreateCommand
 		if devConfig.OnCreateCommand != nil {
@@ -1671,18 +847,33 @@ func runWithCompose(devConfig *devcontainer.Config, config *RunConfig, mountPath
 		}
 	}
 
-	// Execute user command in the service container
-	return execIntoContainer(dockerClient, containerID, devConfig.RemoteUser, workingDir, config.Command, devConfig.ShouldOverrideCommand(), devConfig.ShutdownAction, absoluteComposeFiles, mountPath)
+	// Execute user command in the service container. Compose creates the container,
+	// so remoteEnv is applied on exec (resolved fresh on every run).
+	remoteEnv := refreshRemoteEnv(dockerClient, containerID, devConfig, mountPath, workingDir, false)
+	hookPayload.ContainerID = containerID
+	if err := runHooks.Run(hooks.PostCreate, hookPayload, config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if config.Detach {
+		return detachFromContainer(config, dockerClient, containerID, devConfig.RemoteUser, workingDir, remoteEnv)
+	}
+	if err := runHooks.Run(hooks.PreAttach, hookPayload, config.Verbose); err != nil {
+		return errdefs.Errorf(errdefs.CategoryLifecycle, "%w", err)
+	}
+	command := sessionCommand(config, dockerClient, containerID, workingDir)
+	config.Events.Emit(events.Event{Type: events.TypeExecStarted, Container: devConfig.Service, ContainerID: containerID, Args: command})
+	RecordAudit(audit.Event{Type: audit.TypeExec, Project: workDir, Container: devConfig.Service, Argv: command})
+	return execIntoContainer(dockerClient, containerID, devConfig.RemoteUser, workingDir, remoteEnv, command, devConfig.ShouldOverrideCommand(), devConfig.ShutdownAction, absoluteComposeFiles, mountPath, newExecTimeout(config), config.Reattach)
 }
 
-func containerIsRunning(dockerClient *docker.Client, name string) (bool, error) {
-	// Apple Container doesn't support --filter, so get all and filter client-side
-	isApple := dockerClient.Command() == "container"
+func containerIsRunning(dockerClient DockerClient, name string) (bool, error) {
+	// Without ps --filter (Apple Container), get all and filter client-side
+	listsAll := !runtimeSupports(dockerClient).PSFlags
 
 	var output string
 	var err error
 
-	if isApple {
+	if listsAll {
 		output, err = dockerClient.Run("ps", "--format", "json")
 	} else {
 		output, err = dockerClient.Run("ps", "--filter", fmt.Sprintf("name=%s", name), "--format", "{{.Names}}")
@@ -1693,7 +884,7 @@ func containerIsRunning(dockerClient *docker.Client, name string) (bool, error)
 	}
 
 	// For Apple Container, output is JSON array
-	if isApple {
+	if listsAll {
 		// Check if container exists AND is running
 		// Look for: "id":"<name>" followed by "status":"running"
 		idMatch := fmt.Sprintf(`"id":"%s"`, name)
@@ -1720,7 +911,7 @@ func containerIsRunning(dockerClient *docker.Client, name string) (bool, error)
 }
 
 // getContainerDetails gets detailed information about a container
-func getContainerDetails(dockerClient *docker.Client, name string) (*ContainerDetails, error) {
+func getContainerDetails(dockerClient DockerClient, name string) (*ContainerDetails, error) {
 	// Get container information using docker ps with JSON format
 	output, err := dockerClient.Run(
 		"ps",
@@ -1752,8 +943,11 @@ func getContainerDetails(dockerClient *docker.Client, name string) (*ContainerDe
 		return nil, fmt.Errorf("failed to parse container info: %w", err)
 	}
 
-	// Parse labels to get detailed information
-	labels := container.ParseLabels(containerInfo.Labels)
+	// Read labels with inspect, since ps cuts values containing commas
+	labels, ok := container.InspectLabels(dockerClient, containerInfo.Names)[containerInfo.Names]
+	if !ok {
+		labels = container.ParseLabels(containerInfo.Labels)
+	}
 	project := container.GetProjectFromLabels(labels)
 	worktree := container.GetWorktreeFromLabels(labels)
 	hostPath := container.GetHostPathFromLabels(labels)
@@ -1770,13 +964,13 @@ func getContainerDetails(dockerClient *docker.Client, name string) (*ContainerDe
 }
 
 // getContainerID gets the container ID by name
-func getContainerID(dockerClient *docker.Client, name string) (string, error) {
-	isApple := dockerClient.Command() == "container"
+func getContainerID(dockerClient DockerClient, name string) (string, error) {
+	listsAll := !runtimeSupports(dockerClient).PSFlags
 
 	var output string
 	var err error
 
-	if isApple {
+	if listsAll {
 		output, err = dockerClient.Run("ps", "--format", "json")
 	} else {
 		output, err = dockerClient.Run("ps", "--filter", fmt.Sprintf("name=%s", name), "--format", "{{.ID}}")
@@ -1787,7 +981,7 @@ func getContainerID(dockerClient *docker.Client, name string) (string, error) {
 	}
 
 	// For Apple Container, search for container with matching ID in JSON
-	if isApple {
+	if listsAll {
 		idPrefix := fmt.Sprintf(`"id":"%s"`, name)
 		if !strings.Contains(output, idPrefix) {
 			return "", fmt.Errorf("container not found")
@@ -1808,7 +1002,7 @@ func fileExists(path string) bool {
 // updateRemoteUserUID synchronizes the container user's UID/GID to match the host user
 // This is only effective on Linux where UID/GID mismatches cause permission issues
 // On macOS/Windows, Docker Desktop handles UID/GID mapping automatically
-func updateRemoteUserUID(dockerClient *docker.Client, containerID, username string, verbose bool) error {
+func updateRemoteUserUID(dockerClient DockerClient, containerID, username string, verbose bool) error {
 	// Only run on Linux - Docker Desktop on macOS/Windows handles UID/GID mapping
 	if runtime.GOOS != "linux" {
 		if verbose {
@@ -1817,12 +1011,14 @@ func updateRemoteUserUID(dockerClient *docker.Client, containerID, username stri
 		return nil
 	}
 
-	// Get host UID/GID
-	hostUID := os.Getuid()
-	hostGID := os.Getgid()
+	return remapUserUID(dockerClient, containerID, username, os.Getuid(), os.Getgid(), verbose)
+}
 
+// remapUserUID changes a container user's UID and primary GID, and the
+// ownership of their home directory to match
+func remapUserUID(dockerClient DockerClient, containerID, username string, uid, gid int, verbose bool) error {
 	if verbose {
-		fmt.Fprintf(os.Stderr, "Syncing container user '%s' to host UID=%d GID=%d...\n", username, hostUID, hostGID)
+		fmt.Fprintf(os.Stderr, "Syncing container user '%s' to UID=%d GID=%d...\n", username, uid, gid)
 	}
 
 	// Check if user exists in container
@@ -1833,35 +1029,35 @@ func updateRemoteUserUID(dockerClient *docker.Client, containerID, username stri
 	}
 
 	currentUID := strings.TrimSpace(currentUIDStr)
-	if currentUID == fmt.Sprintf("%d", hostUID) {
+	if currentUID == fmt.Sprintf("%d", uid) {
 		if verbose {
-			fmt.Fprintf(os.Stderr, "User '%s' already has correct UID=%d, skipping sync\n", username, hostUID)
+			fmt.Fprintf(os.Stderr, "User '%s' already has correct UID=%d, skipping sync\n", username, uid)
 		}
 		return nil
 	}
 
 	// Update user's UID
-	usermodCmd := []string{"exec", containerID, "usermod", "-u", fmt.Sprintf("%d", hostUID), username}
+	usermodCmd := []string{"exec", containerID, "usermod", "-u", fmt.Sprintf("%d", uid), username}
 	if _, err := dockerClient.Run(usermodCmd...); err != nil {
 		return fmt.Errorf("failed to update UID: %w", err)
 	}
 
 	// Update user's GID
-	groupmodCmd := []string{"exec", containerID, "groupmod", "-g", fmt.Sprintf("%d", hostGID), username}
+	groupmodCmd := []string{"exec", containerID, "groupmod", "-g", fmt.Sprintf("%d", gid), username}
 	if _, err := dockerClient.Run(groupmodCmd...); err != nil {
 		// Try creating a new group if groupmod fails (user might not have a group with the same name)
 		if verbose {
 			fmt.Fprintf(os.Stderr, "groupmod failed, user might not have a primary group with the same name\n")
 		}
 		// Update the user's primary GID directly
-		usermodGIDCmd := []string{"exec", containerID, "usermod", "-g", fmt.Sprintf("%d", hostGID), username}
+		usermodGIDCmd := []string{"exec", containerID, "usermod", "-g", fmt.Sprintf("%d", gid), username}
 		if _, err := dockerClient.Run(usermodGIDCmd...); err != nil {
 			return fmt.Errorf("failed to update GID: %w", err)
 		}
 	}
 
 	// Fix ownership of user's home directory
-	chownCmd := []string{"exec", containerID, "chown", "-R", fmt.Sprintf("%d:%d", hostUID, hostGID), fmt.Sprintf("/home/%s", username)}
+	chownCmd := []string{"exec", containerID, "chown", "-R", fmt.Sprintf("%d:%d", uid, gid), fmt.Sprintf("/home/%s", username)}
 	if _, err := dockerClient.Run(chownCmd...); err != nil {
 		// Not fatal - home directory might not exist or might be mounted
 		if verbose {
@@ -1870,7 +1066,7 @@ func updateRemoteUserUID(dockerClient *docker.Client, containerID, username stri
 	}
 
 	if verbose {
-		fmt.Fprintf(os.Stderr, "Successfully synced user '%s' to UID=%d GID=%d\n", username, hostUID, hostGID)
+		fmt.Fprintf(os.Stderr, "Successfully synced user '%s' to UID=%d GID=%d\n", username, uid, gid)
 	}
 
 	return nil
@@ -1984,6 +1180,9 @@ type ImageVersionInfo struct {
 
 // AgeString returns a human-readable age string
 func (i *ImageVersionInfo) AgeString() string {
+	if i.Created.IsZero() {
+		return "age unknown"
+	}
 	age := time.Since(i.Created)
 	if age < time.Hour {
 		return "just released"
@@ -2042,20 +1241,24 @@ func getConfiguredDefaultImage(runConfig *RunConfig) string {
 	return "ghcr.io/obra/packnplay/devcontainer:latest"
 }
 
+// registryCheckTimeout bounds each registry request made by the update check
+const registryCheckTimeout = 5 * time.Second
+
+// registryDigest returns the manifest digest a registry serves for ref; replaced in tests
+var registryDigest = func(ref string) (string, error) {
+	return registry.NewClient(registryCheckTimeout).Digest(ref)
+}
+
 // getRemoteImageInfo gets version information about an image from the registry
-func getRemoteImageInfo(dockerClient *docker.Client, imageName string) (*ImageVersionInfo, error) {
-	// Use docker manifest inspect to get remote info without pulling
-	output, err := dockerClient.Run("manifest", "inspect", imageName)
+// without pulling it
+func getRemoteImageInfo(imageName string) (*ImageVersionInfo, error) {
+	digest, err := registryDigest(imageName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to inspect remote image: %w\nOutput: %s", err, output)
+		return nil, fmt.Errorf("failed to inspect remote image: %w", err)
 	}
-
-	// For now, return minimal info (digest would be parsed from manifest)
 	return &ImageVersionInfo{
-		Digest:  "sha256:remote123", // Simplified for test
-		Created: time.Now(),
-		Size:    "unknown",
-		Tags:    []string{"latest"},
+		Digest: digest,
+		Size:   "unknown",
 	}, nil
 }
 
@@ -2089,17 +1292,22 @@ func formatVersionNotification(imageName string, localInfo, remoteInfo *ImageVer
 		remoteInfo.ShortDigest(), remoteInfo.AgeString())
 }
 
-// checkAndNotifyAboutUpdates checks for new versions and notifies user if appropriate
-func checkAndNotifyAboutUpdates(dockerClient *docker.Client, imageName string, verbose bool) error {
+// checkAndNotifyAboutUpdates checks the registry for a newer default image and
+// notifies the user once per new digest, or pulls it in the background when
+// auto_pull_updates is set. Project base images are checked too when
+// auto_pull_base_images is set. Checks run at most every check_frequency_hours
+// and only for images pulled from a registry.
+func checkAndNotifyAboutUpdates(dockerClient DockerClient, imageName string, verbose bool) error {
 	// Load configuration to check update preferences
 	cfg, err := config.LoadOrDefault()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	updates := cfg.DefaultContainer
 
-	// Check if update checking is enabled
-	if !config.ShouldCheckForUpdates(cfg.DefaultContainer, time.Time{}) {
-		return nil // Checking disabled or too recent
+	isDefault := imageName == cfg.GetDefaultImage()
+	if !isDefault && !(updates.AutoPullUpdates && updates.AutoPullBaseImages) {
+		return nil
 	}
 
 	// Load version tracking data
@@ -2108,15 +1316,26 @@ func checkAndNotifyAboutUpdates(dockerClient *docker.Client, imageName string, v
 	if err != nil {
 		return fmt.Errorf("failed to load version tracking: %w", err)
 	}
+	changed := false
+	defer func() {
+		if !changed {
+			return
+		}
+		if err := config.SaveVersionTracking(tracking, trackingPath); err != nil && verbose {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save tracking data: %v\n", err)
+		}
+	}()
 
-	// Only check for updates if it's time to do so
-	if !config.ShouldCheckForUpdates(cfg.DefaultContainer, tracking.LastCheck) {
-		return nil
-	}
+	// Report a background pull started by an earlier run
+	changed = reportAutoPull(dockerClient, tracking, imageName)
 
-	// Check remote registry for new versions (only for default image)
-	if imageName != cfg.GetDefaultImage() {
-		return nil // Only check updates for default image
+	// Only check for updates if enabled and it's time to do so
+	lastCheck := tracking.LastCheck
+	if !isDefault {
+		lastCheck = tracking.BaseImageChecks[imageName]
+	}
+	if !config.ShouldCheckForUpdates(updates, lastCheck) {
+		return nil
 	}
 
 	// Get local image info
@@ -2126,63 +1345,62 @@ func checkAndNotifyAboutUpdates(dockerClient *docker.Client, imageName string, v
 	}
 
 	// Get remote image info
-	remoteInfo, err := getRemoteImageInfo(dockerClient, imageName)
+	remoteInfo, err := getRemoteImageInfo(imageName)
 	if err != nil {
 		return fmt.Errorf("failed to get remote image info: %w", err)
 	}
+	if isDefault {
+		tracking.LastCheck = time.Now()
+	} else {
+		tracking.BaseImageChecks[imageName] = time.Now()
+	}
+	changed = true
 
-	// Check if we should notify
 	result := checkForNewVersion(imageName, localInfo, remoteInfo, NewVersionTracker())
+	if !result.shouldNotify {
+		return nil
+	}
+	if updates.AutoPullUpdates {
+		if err := autoPullUpdate(dockerClient.Command(), imageName, localInfo, remoteInfo, tracking); err != nil {
+			return fmt.Errorf("failed to auto-pull %s: %w", imageName, err)
+		}
+		return nil
+	}
 
-	if result.shouldNotify {
-		// Show notification with specific version info
-		message := formatVersionNotification(imageName, result.localInfo, result.remoteInfo)
-		fmt.Println(message)
-
-		// Mark as notified and update tracking
+	// Notify once per new digest
+	if tracking.Notifications[imageName].Digest != remoteInfo.Digest {
+		fmt.Fprintln(os.Stderr, formatVersionNotification(imageName, result.localInfo, result.remoteInfo))
 		tracking.Notifications[imageName] = config.VersionNotification{
 			Digest:     remoteInfo.Digest,
 			NotifiedAt: time.Now(),
 			ImageName:  imageName,
 		}
-		tracking.LastCheck = time.Now()
-
-		// Save tracking data
-		if err := config.SaveVersionTracking(tracking, trackingPath); err != nil && verbose {
-			fmt.Fprintf(os.Stderr, "Warning: failed to save tracking data: %v\n", err)
-		}
 	}
-
 	return nil
 }
 
-// getLocalImageInfo gets version information about a local image
-func getLocalImageInfo(dockerClient *docker.Client, imageName string) (*ImageVersionInfo, error) {
-	// Get local image digest
-	output, err := dockerClient.Run("image", "inspect", "--format", "{{.RepoDigests}}", imageName)
+// getLocalImageInfo gets version information about a local image. The digest is
+// the registry manifest digest recorded when the image was pulled, so it can be
+// compared with getRemoteImageInfo; locally built images have none.
+func getLocalImageInfo(dockerClient DockerClient, imageName string) (*ImageVersionInfo, error) {
+	output, err := dockerClient.Run("image", "inspect", "--format", "{{json .RepoDigests}}|{{.Created}}", imageName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect local image: %w", err)
 	}
 
-	// Parse creation time
-	createdOutput, err := dockerClient.Run("image", "inspect", "--format", "{{.Created}}", imageName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get image creation time: %w", err)
+	digestsJSON, createdOutput, _ := strings.Cut(strings.TrimSpace(output), "|")
+	var repoDigests []string
+	if err := json.Unmarshal([]byte(digestsJSON), &repoDigests); err != nil {
+		return nil, fmt.Errorf("failed to parse digests of %s: %w", imageName, err)
 	}
-
-	created, err := time.Parse(time.RFC3339, strings.TrimSpace(createdOutput))
-	if err != nil {
-		created = time.Now() // Fallback
+	digest := registry.MatchRepoDigest(imageName, repoDigests)
+	if digest == "" {
+		return nil, fmt.Errorf("image %s has no registry digest (not pulled from %s)", imageName, registryauth.Host(imageName))
 	}
 
-	// Extract digest from RepoDigests output (simplified)
-	digest := "sha256:local123" // Simplified for now
-	if strings.Contains(output, "sha256:") {
-		// Extract actual digest from output
-		parts := strings.Split(output, "@sha256:")
-		if len(parts) > 1 {
-			digest = "sha256:" + strings.Fields(parts[1])[0]
-		}
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(createdOutput))
+	if err != nil {
+		created = time.Time{}
 	}
 
 	return &ImageVersionInfo{
@@ -2193,67 +1411,83 @@ func getLocalImageInfo(dockerClient *docker.Client, imageName string) (*ImageVer
 	}, nil
 }
 
-// getOrCreateContainerCredentialFile manages shared credential file for all containers
-func getOrCreateContainerCredentialFile(containerName string) (string, error) {
-	// Get credentials directory
-	homeDir, err := os.UserHomeDir()
+// ContainerCredentialFile is the name of the decrypted container-managed
+// credential file in credstore.RuntimeDir, bind mounted over
+// ~/.claude/.credentials.json in containers whose host has no credentials
+const ContainerCredentialFile = "claude-credentials.json"
+
+// getOrCreateContainerCredentialFile returns the decrypted credential file
+// shared by all containers. It lives in a RAM-backed runtime directory; the
+// credential watcher encrypts changes containers make back into the store.
+func getOrCreateContainerCredentialFile(backend string) (string, error) {
+	// Containers already running share the live copy. Touching it keeps the
+	// credential watcher from removing it before this container starts.
+	path := containerCredentialFilePath()
+	if fileExists(path) {
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return path, nil
+	}
+
+	store, err := credstore.Open(backend, credstore.DefaultDir())
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return "", err
 	}
-
-	xdgDataHome := os.Getenv("XDG_DATA_HOME")
-	if xdgDataHome == "" {
-		xdgDataHome = filepath.Join(homeDir, ".local", "share")
+	creds, err := readContainerCredentials(store)
+	if errors.Is(err, credstore.ErrNotFound) {
+		// Seed from the host, or start empty and let the user log in
+		creds = []byte("{}")
+		if initial, err := getInitialContainerCredentials(); err == nil {
+			creds = []byte(initial)
+			if err := store.Set(credstore.ClaudeCredentials, creds); err != nil {
+				return "", fmt.Errorf("failed to store credentials: %w", err)
+			}
+		}
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read credentials from the %s store: %w", store.Name(), err)
 	}
 
-	// Use persistent shared credential file in XDG data directory
-	credentialsDir := filepath.Join(xdgDataHome, "packnplay", "credentials")
-	if err := os.MkdirAll(credentialsDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create credentials dir: %w", err)
-	}
-	credentialFile := filepath.Join(credentialsDir, "claude-credentials.json")
+	return credstore.WriteRuntimeFile(ContainerCredentialFile, creds)
+}
 
-	// If file doesn't exist, initialize it
-	if !fileExists(credentialFile) {
-		// Try to get initial credentials from keychain (macOS) or copy from host (Linux)
-		initialCreds, err := getInitialContainerCredentials()
-		if err != nil {
-			// Create empty file - user will need to authenticate in container
-			if err := os.WriteFile(credentialFile, []byte("{}"), 0600); err != nil {
-				return "", fmt.Errorf("failed to create credential file: %w", err)
-			}
-		} else {
-			if err := os.WriteFile(credentialFile, []byte(initialCreds), 0600); err != nil {
-				return "", fmt.Errorf("failed to write initial credentials: %w", err)
-			}
-		}
+// containerCredentialFilePath returns the decrypted credential file shared by containers
+func containerCredentialFilePath() string {
+	return filepath.Join(credstore.RuntimeDir(), ContainerCredentialFile)
+}
+
+// readContainerCredentials returns the container-managed credentials from
+// store. The plaintext file earlier versions kept is moved into the store the
+// first time it's found.
+func readContainerCredentials(store credstore.Store) ([]byte, error) {
+	creds, err := store.Get(credstore.ClaudeCredentials)
+	if !errors.Is(err, credstore.ErrNotFound) {
+		return creds, err
 	}
 
-	return credentialFile, nil
+	legacy := filepath.Join(credstore.DefaultDir(), ContainerCredentialFile)
+	creds, err = os.ReadFile(legacy)
+	if err != nil {
+		return nil, credstore.ErrNotFound
+	}
+	if err := store.Set(credstore.ClaudeCredentials, creds); err != nil {
+		return nil, fmt.Errorf("failed to move %s into the credential store: %w", legacy, err)
+	}
+	if err := os.Remove(legacy); err != nil {
+		return nil, fmt.Errorf("failed to remove plaintext credentials %s: %w", legacy, err)
+	}
+	fmt.Fprintf(os.Stderr, "Moved container credentials from %s into the %s credential store\n", legacy, store.Name())
+	return creds, nil
 }
 
 // getInitialContainerCredentials gets initial credentials for new containers
+// from the host's ~/.claude/.credentials.json
 func getInitialContainerCredentials() (string, error) {
-	// Check if we're on macOS and can get from keychain
-	if !fileExists("/proc/version") { // macOS detection
-		cmd := exec.Command("security", "find-generic-password",
-			"-s", "packnplay-containers-credentials",
-			"-a", "packnplay",
-			"-w")
-
-		output, err := cmd.Output()
+	homeDir, _ := os.UserHomeDir()
+	hostCredFile := filepath.Join(homeDir, ".claude", ".credentials.json")
+	if fileExists(hostCredFile) {
+		content, err := os.ReadFile(hostCredFile)
 		if err == nil {
-			return strings.TrimSpace(string(output)), nil
-		}
-	} else {
-		// Linux: Check if host has .credentials.json we can copy
-		homeDir, _ := os.UserHomeDir()
-		hostCredFile := filepath.Join(homeDir, ".claude", ".credentials.json")
-		if fileExists(hostCredFile) {
-			content, err := os.ReadFile(hostCredFile)
-			if err == nil {
-				return string(content), nil
-			}
+			return string(content), nil
 		}
 	}
 
@@ -2261,20 +1495,16 @@ func getInitialContainerCredentials() (string, error) {
 }
 
 // copyFileToContainer copies a file into container and fixes ownership
-func copyFileToContainer(dockerClient *docker.Client, containerID, srcPath, dstPath, user string, verbose bool) error {
+func copyFileToContainer(dockerClient DockerClient, containerID, srcPath, dstPath, user string, verbose bool) error {
 	if verbose {
 		fmt.Fprintf(os.Stderr, "Copying %s to container at %s\n", srcPath, dstPath)
 	}
 
-	// Check if this is Apple Container (no cp command)
-	isApple := dockerClient.Command() == "container"
-
-	if isApple {
-		// Apple Container: use exec with base64 to write file
+	// Runtimes without a cp command (Apple Container): use exec with base64 to write file
+	if !runtimeSupports(dockerClient).Copy {
 		return copyFileViaExec(dockerClient, containerID, srcPath, dstPath, user, verbose)
 	}
 
-	// Docker/Podman: use cp command
 	// Ensure parent directory exists in container
 	dstDir := filepath.Dir(dstPath)
 	output, err := dockerClient.Run("exec", containerID, "/bin/mkdir", "-p", dstDir)
@@ -2282,16 +1512,13 @@ func copyFileToContainer(dockerClient *docker.Client, containerID, srcPath, dstP
 		return fmt.Errorf("failed to create parent directory %s: %w\nDocker output:\n%s", dstDir, err, output)
 	}
 
-	// Copy file
-	containerDst := fmt.Sprintf("%s:%s", containerID, dstPath)
-	output, err = dockerClient.Run("cp", srcPath, containerDst)
-	if err != nil {
-		return fmt.Errorf("failed to copy file %s to %s: %w\nDocker output:\n%s", srcPath, dstPath, err, output)
+	if err := runtimeBackend(dockerClient).CopyIn(dockerClient, containerID, srcPath, dstPath); err != nil {
+		return err
 	}
 
 	// Fix ownership (docker cp creates as root)
 	// Only chown the specific file, not the entire directory (might contain read-only mounts)
-	_, err = dockerClient.Run("exec", "-u", "root", containerID, "/bin/chown", fmt.Sprintf("%s:%s", user, user), dstPath)
+	_, err = dockerClient.Run("exec", "-u", "root", containerID, "/bin/chown", userOwner(user), dstPath)
 	if err != nil && verbose {
 		fmt.Fprintf(os.Stderr, "Warning: failed to fix ownership: %v\n", err)
 	}
@@ -2300,7 +1527,7 @@ func copyFileToContainer(dockerClient *docker.Client, containerID, srcPath, dstP
 }
 
 // copyFileViaExec copies a file using a temp directory mount (for Apple Container)
-func copyFileViaExec(dockerClient *docker.Client, containerID, srcPath, dstPath, user string, verbose bool) error {
+func copyFileViaExec(dockerClient DockerClient, containerID, srcPath, dstPath, user string, verbose bool) error {
 	// Create temp directory for file transfer
 	tempDir, err := os.MkdirTemp("", "packnplay-transfer-*")
 	if err != nil {
@@ -2368,7 +1595,7 @@ func executeInitializeCommand(initCmd *devcontainer.LifecycleCommand, workDir st
 	}
 
 	if err != nil {
-		return fmt.Errorf("initializeCommand failed: %w", err)
+		return errdefs.Errorf(errdefs.CategoryLifecycle, "initializeCommand failed: %w", err)
 	}
 
 	if verbose {
@@ -351,3 +351,35 @@ func TestSecurityPropertiesMergeStrategy(t *testing.T) {
 	t.Logf("Enhanced args: %v", enhancedArgs)
 	t.Logf("Stderr output: %s", stderrOutput)
 }
+
+func TestApplyFeatureProperties_RuntimeEnv(t *testing.T) {
+	features := []*devcontainer.ResolvedFeature{
+		{
+			ID: "go",
+			Metadata: &devcontainer.FeatureMetadata{
+				ContainerEnv: map[string]string{
+					"GOROOT": "/usr/local/go",
+					"PATH":   "${GOROOT}/bin:${PATH}",
+					"GOPATH": "/go",
+				},
+			},
+		},
+		{
+			ID: "tools",
+			Metadata: &devcontainer.FeatureMetadata{
+				ContainerEnv: map[string]string{"PATH": "/opt/tools:$PATH"},
+			},
+		},
+	}
+
+	applier := NewFeaturePropertiesApplier()
+	applier.SetRuntimeEnv(func(name string) bool { return name != "GOPATH" }, map[string]string{"PATH": "/usr/bin:/bin"})
+
+	ctx := &devcontainer.SubstituteContext{LocalEnv: map[string]string{}, ContainerEnv: map[string]string{}}
+	_, env, _, _, _ := applier.ApplyFeatureProperties(nil, features, map[string]string{}, ctx, false, "")
+
+	assert.Equal(t, map[string]string{
+		"GOROOT": "/usr/local/go",
+		"PATH":   "/opt/tools:/usr/local/go/bin:/usr/bin:/bin",
+	}, env)
+}
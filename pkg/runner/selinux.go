@@ -0,0 +1,223 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+// Mount relabel modes for SELinux hosts
+const (
+	RelabelAuto    = "auto" // relabel shared (:z) when SELinux is enforcing
+	RelabelShared  = "z"    // always add :z
+	RelabelPrivate = "Z"    // always add :Z
+	RelabelOff     = "off"  // never relabel
+)
+
+// selinuxEnforcePath is overridable for tests
+var selinuxEnforcePath = "/sys/fs/selinux/enforce"
+
+// apparmorEnabledPath is overridable for tests
+var apparmorEnabledPath = "/sys/module/apparmor/parameters/enabled"
+
+// isSELinuxEnforcing reports whether the host runs SELinux in enforcing mode
+func isSELinuxEnforcing() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	data, err := os.ReadFile(selinuxEnforcePath)
+	return err == nil && strings.TrimSpace(string(data)) == "1"
+}
+
+// isAppArmorEnabled reports whether the host kernel has AppArmor enabled
+func isAppArmorEnabled() bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	data, err := os.ReadFile(apparmorEnabledPath)
+	return err == nil && strings.TrimSpace(string(data)) == "Y"
+}
+
+// effectiveRelabel resolves the configured relabel mode to "z", "Z", or "" (none)
+func effectiveRelabel(mode string) string {
+	switch mode {
+	case RelabelShared, RelabelPrivate:
+		return mode
+	case RelabelOff:
+		return ""
+	default:
+		if isSELinuxEnforcing() {
+			return RelabelShared
+		}
+		return ""
+	}
+}
+
+// packnplayDirs returns the host directories packnplay keeps its own data,
+// caches and runtime files (credential copies, bridge sockets) in
+func packnplayDirs(homeDir string) []string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		cacheHome = filepath.Join(homeDir, ".cache")
+	}
+	return []string{
+		filepath.Join(dataHome, "packnplay"),
+		filepath.Join(cacheHome, "packnplay"),
+		credstore.RuntimeDir(),
+	}
+}
+
+// applyMountRelabel appends the SELinux relabel option to the bind mounts
+// (-v and --mount type=bind) of paths under owned: the workspace and
+// packnplay's own directories. Other host paths, such as ~/.ssh, ~/.aws or
+// ~/.claude, keep their labels, since relabeling them would open them to every
+// container and change them for the host's own confined services; the container
+// may be denied access to those, so they are named in a warning. SELinux
+// separation is only turned off (label=disable) when disableLabels is set.
+func applyMountRelabel(args []string, relabel string, owned []string, disableLabels, verbose bool) []string {
+	if disableLabels {
+		return append(append([]string{}, args...), "--security-opt", "label=disable")
+	}
+	if relabel == "" {
+		return args
+	}
+
+	result := make([]string, 0, len(args))
+	var unlabeled []string
+	for i := 0; i < len(args); i++ {
+		start, arg := i, args[i]
+		var spec string
+		switch {
+		case (arg == "-v" || arg == "--mount") && i+1 < len(args):
+			i++
+			spec = args[i]
+		case strings.HasPrefix(arg, "--mount="):
+			spec = strings.TrimPrefix(arg, "--mount=")
+		default:
+			result = append(result, arg)
+			continue
+		}
+
+		volume, source, ok := spec, "", true
+		if arg == "-v" {
+			source, _, ok = strings.Cut(spec, ":")
+		} else {
+			volume, source, ok = bindMountVolumeSpec(spec)
+		}
+		switch {
+		case !strings.HasPrefix(source, "/"):
+			// Named volumes, tmpfs and other mount types carry no host label
+			result = append(result, args[start:i+1]...)
+			continue
+		case !underAny(source, owned) || !ok:
+			if verbose {
+				fmt.Fprintf(os.Stderr, "SELinux: keeping the label of %s\n", source)
+			}
+			unlabeled = append(unlabeled, source)
+			result = append(result, args[start:i+1]...)
+			continue
+		}
+		relabeled := relabelVolumeSpec(volume, relabel)
+		if verbose && relabeled != volume {
+			fmt.Fprintf(os.Stderr, "SELinux: relabeling mount %s\n", relabeled)
+		}
+		result = append(result, "-v", relabeled)
+	}
+	if len(unlabeled) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: SELinux: %s keep their host labels, so the container may be denied access to them (set security.disable_labels to run without SELinux separation)\n", strings.Join(unlabeled, ", "))
+	}
+	return result
+}
+
+// bindMountVolumeSpec converts a --mount type=bind spec to the equivalent -v
+// host:container[:ro] spec so it can be relabeled; docker's --mount has no
+// relabel option. ok is false when the mount uses options -v can't express.
+// source is empty for mounts other than binds.
+func bindMountVolumeSpec(spec string) (volume, source string, ok bool) {
+	var target string
+	readOnly, isBind := false, false
+	ok = true
+	for _, field := range strings.Split(spec, ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			isBind = value == "bind"
+		case "source", "src":
+			source = value
+		case "target", "destination", "dst":
+			target = value
+		case "readonly", "ro":
+			readOnly = value == "" || value == "true" || value == "1"
+		default:
+			ok = false
+		}
+	}
+	if !isBind {
+		return "", "", false
+	}
+	if target == "" {
+		ok = false
+	}
+	volume = source + ":" + target
+	if readOnly {
+		volume += ":ro"
+	}
+	return volume, source, ok
+}
+
+// underAny reports whether path is one of dirs or inside one of them
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir != "" && (path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// relabelVolumeSpec adds :z/:Z to a host:container[:options] bind spec.
+// Named volumes, sockets, and system directories are left untouched since
+// relabeling them is either meaningless or harmful to the host.
+func relabelVolumeSpec(spec, relabel string) string {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "/") {
+		return spec
+	}
+
+	source := parts[0]
+	switch source {
+	case "/", "/etc", "/usr", "/home", "/var", "/tmp", "/root":
+		return spec
+	}
+	if info, err := os.Stat(source); err == nil && info.Mode()&os.ModeSocket != 0 {
+		return spec
+	}
+
+	if len(parts) == 2 {
+		return spec + ":" + relabel
+	}
+
+	options := strings.Split(parts[len(parts)-1], ",")
+	for _, opt := range options {
+		if opt == "z" || opt == "Z" {
+			return spec
+		}
+	}
+	return spec + "," + relabel
+}
+
+// appArmorSecurityOpt returns the --security-opt args for a configured AppArmor profile
+func appArmorSecurityOpt(profile string) []string {
+	if profile == "" || !isAppArmorEnabled() {
+		return nil
+	}
+	return []string{"--security-opt", "apparmor=" + profile}
+}
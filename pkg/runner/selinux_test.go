@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRelabelVolumeSpec(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		spec    string
+		relabel string
+		want    string
+	}{
+		{"plain bind", dir + ":/workspace", "z", dir + ":/workspace:z"},
+		{"read-only bind", dir + ":/workspace:ro", "Z", dir + ":/workspace:ro,Z"},
+		{"already labeled", dir + ":/workspace:ro,z", "Z", dir + ":/workspace:ro,z"},
+		{"named volume", "cache:/cache", "z", "cache:/cache"},
+		{"system directory", "/etc:/host-etc:ro", "z", "/etc:/host-etc:ro"},
+		{"anonymous volume", "/data", "z", "/data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := relabelVolumeSpec(tt.spec, tt.relabel); got != tt.want {
+				t.Errorf("relabelVolumeSpec(%q, %q) = %q, want %q", tt.spec, tt.relabel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelabelVolumeSpec_SkipsSockets(t *testing.T) {
+	dir, err := os.MkdirTemp("/tmp", "pnp-sock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sockPath := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	spec := sockPath + ":/ssh-agent"
+	if got := relabelVolumeSpec(spec, "z"); got != spec {
+		t.Errorf("relabelVolumeSpec() relabeled socket: %q", got)
+	}
+}
+
+func TestApplyMountRelabel(t *testing.T) {
+	dir := t.TempDir()
+	owned := []string{dir}
+	args := []string{"run", "-v", dir + ":/workspace", "-v", "cache:/cache", "-e", "FOO=" + dir + ":/x", "--mount", "type=bind,source=" + dir + ",target=/m", "--mount=type=bind,src=" + dir + ",dst=/r,readonly", "--mount", "type=volume,source=data,target=/data"}
+
+	got := applyMountRelabel(args, "z", owned, false, false)
+	want := []string{"run", "-v", dir + ":/workspace:z", "-v", "cache:/cache", "-e", "FOO=" + dir + ":/x", "-v", dir + ":/m:z", "-v", dir + ":/r:ro,z", "--mount", "type=volume,source=data,target=/data"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyMountRelabel() = %v, want %v", got, want)
+	}
+	if args[2] != dir+":/workspace" {
+		t.Errorf("applyMountRelabel() modified its input")
+	}
+
+	if got := applyMountRelabel(args, "", owned, false, false); !reflect.DeepEqual(got, args) {
+		t.Errorf("applyMountRelabel() with no relabel = %v, want unchanged", got)
+	}
+}
+
+func TestApplyMountRelabel_LeavesHomeMountsAlone(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", "")
+	workspace := filepath.Join(home, "src", "app")
+	args := []string{"run",
+		"-v", workspace + ":" + workspace,
+		"-v", filepath.Join(home, ".ssh") + ":/home/user/.ssh:ro",
+		"-v", filepath.Join(home, ".local", "share", "packnplay", "bridge") + ":/run/packnplay",
+		"--mount", "type=bind,source=" + filepath.Join(home, ".gitconfig") + ",target=/home/user/.gitconfig",
+	}
+	owned := append([]string{workspace}, packnplayDirs(home)...)
+
+	var got []string
+	stderr := captureStderr(t, func() {
+		got = applyMountRelabel(args, "Z", owned, false, false)
+	})
+	// SELinux separation stays on; the unlabeled mounts are only warned about
+	want := []string{"run",
+		"-v", workspace + ":" + workspace + ":Z",
+		"-v", filepath.Join(home, ".ssh") + ":/home/user/.ssh:ro",
+		"-v", filepath.Join(home, ".local", "share", "packnplay", "bridge") + ":/run/packnplay:Z",
+		"--mount", "type=bind,source=" + filepath.Join(home, ".gitconfig") + ",target=/home/user/.gitconfig",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyMountRelabel() = %v, want %v", got, want)
+	}
+	if !strings.Contains(stderr, filepath.Join(home, ".ssh")+", "+filepath.Join(home, ".gitconfig")) || !strings.Contains(stderr, "security.disable_labels") {
+		t.Errorf("stderr = %q, want a warning naming the unlabeled mounts", stderr)
+	}
+
+	// Turning labels off is an explicit choice, and needs no relabeling
+	got = applyMountRelabel(args, "Z", owned, true, false)
+	want = append(append([]string{}, args...), "--security-opt", "label=disable")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyMountRelabel() with labels disabled = %v, want %v", got, want)
+	}
+}
+
+func TestEffectiveRelabel(t *testing.T) {
+	enforce := filepath.Join(t.TempDir(), "enforce")
+	orig := selinuxEnforcePath
+	selinuxEnforcePath = enforce
+	defer func() { selinuxEnforcePath = orig }()
+
+	if got := effectiveRelabel(RelabelOff); got != "" {
+		t.Errorf("effectiveRelabel(off) = %q, want empty", got)
+	}
+	if got := effectiveRelabel(RelabelPrivate); got != "Z" {
+		t.Errorf("effectiveRelabel(Z) = %q, want Z", got)
+	}
+
+	// auto without SELinux
+	if got := effectiveRelabel(RelabelAuto); got != "" {
+		t.Errorf("effectiveRelabel(auto) without SELinux = %q, want empty", got)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if err := os.WriteFile(enforce, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := effectiveRelabel(""); got != "z" {
+		t.Errorf("effectiveRelabel(auto) with SELinux enforcing = %q, want z", got)
+	}
+}
+
+func TestAppArmorSecurityOpt(t *testing.T) {
+	enabled := filepath.Join(t.TempDir(), "enabled")
+	orig := apparmorEnabledPath
+	apparmorEnabledPath = enabled
+	defer func() { apparmorEnabledPath = orig }()
+
+	if got := appArmorSecurityOpt("unconfined"); got != nil {
+		t.Errorf("appArmorSecurityOpt() without AppArmor = %v, want nil", got)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if err := os.WriteFile(enabled, []byte("Y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--security-opt", "apparmor=unconfined"}
+	if got := appArmorSecurityOpt("unconfined"); !reflect.DeepEqual(got, want) {
+		t.Errorf("appArmorSecurityOpt() = %v, want %v", got, want)
+	}
+	if got := appArmorSecurityOpt(""); got != nil {
+		t.Errorf("appArmorSecurityOpt(\"\") = %v, want nil", got)
+	}
+}
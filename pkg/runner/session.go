@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// SessionName is the tmux session packnplay runs persistent commands in
+const SessionName = "packnplay"
+
+// installTmuxScript installs tmux with whichever package manager the image has
+const installTmuxScript = `command -v tmux >/dev/null 2>&1 && exit 0
+if command -v apt-get >/dev/null 2>&1; then apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq tmux
+elif command -v apk >/dev/null 2>&1; then apk add --no-cache tmux
+elif command -v dnf >/dev/null 2>&1; then dnf install -y tmux
+elif command -v microdnf >/dev/null 2>&1; then microdnf install -y tmux
+elif command -v yum >/dev/null 2>&1; then yum install -y tmux
+else echo "no supported package manager found" >&2; exit 1
+fi`
+
+// shellQuote quotes s for safe use as a single POSIX shell word
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// tmuxSessionCommand wraps command so it runs in the shared tmux session,
+// attaching to the session instead if it is already running
+func tmuxSessionCommand(workingDir string, command []string) []string {
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+	return []string{"tmux", "new-session", "-A", "-s", SessionName, "-c", workingDir, strings.Join(quoted, " ")}
+}
+
+// ensureTmux installs tmux in the container if it is missing
+func ensureTmux(dockerClient DockerClient, containerID string, verbose bool) error {
+	if _, err := dockerClient.Run("exec", containerID, "/bin/sh", "-c", "command -v tmux"); err == nil {
+		return nil
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Installing tmux for persistent session...\n")
+	}
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", installTmuxScript); err != nil {
+		return fmt.Errorf("failed to install tmux: %w\nDocker output:\n%s", err, output)
+	}
+	return nil
+}
+
+// sessionCommand returns the command to exec, wrapped in the persistent tmux
+// session when the run asked for one. Falls back to the plain command (with a
+// warning) when there is no terminal or tmux can't be installed.
+func sessionCommand(config *RunConfig, dockerClient DockerClient, containerID, workingDir string) []string {
+	if !config.PersistSession {
+		return config.Command
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintf(os.Stderr, "Warning: --persist-session needs a terminal; running command directly\n")
+		return config.Command
+	}
+	if err := ensureTmux(dockerClient, containerID, config.Verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; running command without a persistent session\n", err)
+		return config.Command
+	}
+	return tmuxSessionCommand(workingDir, config.Command)
+}
+
+// HasPersistentSession reports whether the container has a live packnplay tmux session for user
+func HasPersistentSession(dockerClient DockerClient, containerName, user string) bool {
+	args := []string{"exec"}
+	if user != "" {
+		args = append(args, "-u", user)
+	}
+	args = append(args, containerName, "tmux", "has-session", "-t", SessionName)
+	_, err := dockerClient.Run(args...)
+	return err == nil
+}
@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"claude":             "claude",
+		"--model=opus":       "--model=opus",
+		"hello world":        "'hello world'",
+		"it's":               `'it'"'"'s'`,
+		"":                   "''",
+		"$HOME":              "'$HOME'",
+		"/workspace/my-repo": "/workspace/my-repo",
+	}
+	for input, want := range tests {
+		if got := shellQuote(input); got != want {
+			t.Errorf("shellQuote(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestTmuxSessionCommand(t *testing.T) {
+	got := tmuxSessionCommand("/workspace", []string{"claude", "--prompt", "fix the bug"})
+	want := []string{"tmux", "new-session", "-A", "-s", SessionName, "-c", "/workspace", "claude --prompt 'fix the bug'"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tmuxSessionCommand() = %v, want %v", got, want)
+	}
+}
+
+func TestSessionCommand_Disabled(t *testing.T) {
+	config := &RunConfig{Command: []string{"bash"}}
+	if got := sessionCommand(config, nil, "container", "/workspace"); !reflect.DeepEqual(got, config.Command) {
+		t.Errorf("sessionCommand() without PersistSession = %v, want %v", got, config.Command)
+	}
+}
@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/config"
+)
+
+const (
+	// ShellHistoryVolume keeps the remote user's shell history across containers
+	ShellHistoryVolume = "packnplay-shell-history"
+	// shellHistoryDir is where ShellHistoryVolume is mounted
+	shellHistoryDir = "/packnplay/history"
+	// shellRCPath is the bootstrap sourced from the remote user's .bashrc and .zshrc
+	shellRCPath = "/etc/packnplay/shellrc"
+)
+
+// defaultShellAliases are the aliases every bootstrapped shell gets
+var defaultShellAliases = map[string]string{
+	"ll": "ls -alF",
+	"la": "ls -A",
+	"l":  "ls -CF",
+}
+
+// Default prompts: project, worktree (when there is one), then the directory
+const (
+	defaultBashPrompt = `\[\e[36m\]{project}\[\e[0m\]{worktree} \w \$ `
+	defaultZshPrompt  = `%F{cyan}{project}%f{worktree} %~ %# `
+)
+
+// shellBootstrapArgs mounts the shell history volume on runtimes with named volumes
+func shellBootstrapArgs(cfg config.ShellConfig, namedVolumes bool, ephemeral bool) []string {
+	// Ephemeral containers keep nothing
+	if cfg.Disabled || cfg.NoHistory || ephemeral || !namedVolumes {
+		return nil
+	}
+	return []string{"--mount", fmt.Sprintf("type=volume,source=%s,target=%s", ShellHistoryVolume, shellHistoryDir)}
+}
+
+// shellPrompt fills in a prompt template
+func shellPrompt(template, project, worktree, worktreeFormat string) string {
+	shown := ""
+	if worktree != "" && worktree != "no-worktree" {
+		shown = fmt.Sprintf(worktreeFormat, worktree)
+	}
+	return strings.NewReplacer("{project}", project, "{worktree}", shown).Replace(template)
+}
+
+// shellBootstrapScript returns the rc file sourced by the remote user's bash and zsh
+func shellBootstrapScript(cfg config.ShellConfig, project, worktree string) string {
+	bashPrompt := shellPrompt(defaultBashPrompt, project, worktree, `@\[\e[33m\]%s\[\e[0m\]`)
+	zshPrompt := shellPrompt(defaultZshPrompt, project, worktree, "@%%F{yellow}%s%%f")
+	if cfg.Prompt != "" {
+		bashPrompt = shellPrompt(cfg.Prompt, project, worktree, "%s")
+		zshPrompt = bashPrompt
+	}
+
+	var b strings.Builder
+	b.WriteString("# packnplay shell bootstrap: prompt, history and aliases.\n")
+	b.WriteString("# Generated by packnplay; disable with \"shell\": {\"disabled\": true} in config.json.\n")
+	b.WriteString("case $- in *i*) ;; *) return 0 ;; esac\n")
+	fmt.Fprintf(&b, "export PACKNPLAY_PROJECT=%s PACKNPLAY_WORKTREE=%s\n", shellQuote(project), shellQuote(worktree))
+
+	history := !cfg.NoHistory
+	histFile := shellHistoryDir + "/" + strings.NewReplacer("/", "_", " ", "_").Replace(project)
+	b.WriteString("if [ -n \"$ZSH_VERSION\" ]; then\n")
+	fmt.Fprintf(&b, "  PROMPT=%s\n", shellQuote(zshPrompt))
+	if history {
+		fmt.Fprintf(&b, "  if [ -w %s ]; then\n", shellHistoryDir)
+		fmt.Fprintf(&b, "    HISTFILE=%s HISTSIZE=50000 SAVEHIST=50000\n", shellQuote(histFile+".zsh_history"))
+		b.WriteString("    setopt INC_APPEND_HISTORY HIST_IGNORE_DUPS\n")
+		b.WriteString("  fi\n")
+	}
+	b.WriteString("else\n")
+	fmt.Fprintf(&b, "  PS1=%s\n", shellQuote(bashPrompt))
+	if history {
+		fmt.Fprintf(&b, "  if [ -w %s ]; then\n", shellHistoryDir)
+		fmt.Fprintf(&b, "    HISTFILE=%s HISTSIZE=50000 HISTFILESIZE=50000\n", shellQuote(histFile+".bash_history"))
+		b.WriteString("    shopt -s histappend\n")
+		b.WriteString("    case \"$PROMPT_COMMAND\" in *\"history -a\"*) ;; *) PROMPT_COMMAND=\"history -a${PROMPT_COMMAND:+; $PROMPT_COMMAND}\" ;; esac\n")
+		b.WriteString("  fi\n")
+	}
+	b.WriteString("fi\n")
+
+	aliases := make(map[string]string)
+	for name, value := range defaultShellAliases {
+		aliases[name] = value
+	}
+	for name, value := range cfg.Aliases {
+		aliases[name] = value
+	}
+	names := make([]string, 0, len(aliases))
+	for name, value := range aliases {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "alias %s=%s\n", name, shellQuote(aliases[name]))
+	}
+	return b.String()
+}
+
+// installShellBootstrap writes the bootstrap into a new container and sources
+// it from the remote user's .bashrc (and .zshrc when zsh is installed)
+func installShellBootstrap(dockerClient DockerClient, containerID, remoteUser string, cfg config.ShellConfig, project, worktree string, verbose bool) error {
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Installing shell bootstrap...\n")
+	}
+	install := fmt.Sprintf("mkdir -p /etc/packnplay && printf '%%s' %s > %s && chmod 644 %[2]s", shellQuote(shellBootstrapScript(cfg, project, worktree)), shellRCPath)
+	if !cfg.NoHistory {
+		// The volume is shared by every container, whatever their users' UIDs
+		install += fmt.Sprintf("; if [ -d %[1]s ]; then chmod 1777 %[1]s; fi", shellHistoryDir)
+	}
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", install); err != nil {
+		return fmt.Errorf("failed to install shell bootstrap: %w\nDocker output:\n%s", err, output)
+	}
+
+	source := fmt.Sprintf("[ -f %[1]s ] && . %[1]s", shellRCPath)
+	link := fmt.Sprintf(`for rc in .bashrc .zshrc; do
+  [ "$rc" = .zshrc ] && ! command -v zsh >/dev/null 2>&1 && continue
+  grep -qF %[1]s "$HOME/$rc" 2>/dev/null || printf '\n%%s\n' %[2]s >> "$HOME/$rc"
+done`, shellRCPath, shellQuote(source))
+	args := []string{"exec"}
+	if remoteUser != "" {
+		args = append(args, "-u", remoteUser)
+	}
+	args = append(args, containerID, "/bin/sh", "-c", link)
+	if output, err := dockerClient.Run(args...); err != nil {
+		return fmt.Errorf("failed to add shell bootstrap to the shell rc files: %w\nDocker output:\n%s", err, output)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestShellBootstrapScript(t *testing.T) {
+	script := shellBootstrapScript(config.ShellConfig{Aliases: map[string]string{"gs": "git status", "l": ""}}, "myapp", "feature")
+
+	for _, want := range []string{
+		`PS1='\[\e[36m\]myapp\[\e[0m\]@\[\e[33m\]feature\[\e[0m\] \w \$ '`,
+		`PROMPT='%F{cyan}myapp%f@%F{yellow}feature%f %~ %# '`,
+		"HISTFILE=/packnplay/history/myapp.bash_history",
+		"alias gs='git status'",
+		"alias ll='ls -alF'",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "alias l=") {
+		t.Error("an empty alias should remove the default")
+	}
+
+	// Without a worktree or history, and with a custom prompt
+	script = shellBootstrapScript(config.ShellConfig{NoHistory: true, Prompt: "[{project}{worktree}] $ "}, "myapp", "no-worktree")
+	if !strings.Contains(script, "PS1='[myapp] $ '") || strings.Contains(script, "HISTFILE") {
+		t.Errorf("script = %s", script)
+	}
+
+	for _, shell := range []string{"bash", "zsh"} {
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		if output, err := exec.Command(shell, "-n", "-c", script).CombinedOutput(); err != nil {
+			t.Errorf("%s rejects the script: %v\n%s", shell, err, output)
+		}
+	}
+}
+
+func TestRunInstallsShellBootstrap(t *testing.T) {
+	for _, disabled := range []bool{false, true} {
+		fake := dockertest.New()
+		fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+		useFakeRuntime(t, fake)
+		project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "vscode"}`)
+
+		if err := Run(&RunConfig{Path: project, NoWorktree: true, Shell: config.ShellConfig{Disabled: disabled}, Command: []string{"bash"}}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		c := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+		if c == nil {
+			t.Fatal("container should be created")
+		}
+		mounted := contains(c.RunArgs, "source="+ShellHistoryVolume)
+		installed := containsCall(fake.CallsTo("exec", "-u", "root"), shellRCPath, "PACKNPLAY_PROJECT="+filepath.Base(project))
+		linked := containsCall(fake.CallsTo("exec", "-u", "vscode"), ".bashrc")
+		if mounted == disabled || installed == disabled || linked == disabled {
+			t.Errorf("disabled=%v: history volume mounted = %v, rc installed = %v, sourced from .bashrc = %v", disabled, mounted, installed, linked)
+		}
+	}
+}
+
+func TestInstallShellBootstrapScripts(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	// Run the rc-file linking against a scratch HOME, twice: the source line is added once
+	home := t.TempDir()
+	fake := dockertest.New()
+	fake.On(func(args []string) (string, error) {
+		cmd := exec.Command(sh, "-c", args[len(args)-1])
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	}, "exec", "-u", "vscode")
+	fake.On(func([]string) (string, error) { return "", nil }, "exec", "-u", "root")
+
+	for i := 0; i < 2; i++ {
+		if err := installShellBootstrap(fake, "c1", "vscode", config.ShellConfig{}, "myapp", "main", false); err != nil {
+			t.Fatalf("installShellBootstrap() error = %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".bashrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), shellRCPath); n != 2 { // "[ -f path ] && . path"
+		t.Errorf(".bashrc = %q, want the source line once", data)
+	}
+}
@@ -0,0 +1,335 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+const (
+	// SidecarOfLabel names the container a sidecar service belongs to
+	SidecarOfLabel = "packnplay-sidecar-of"
+	// SidecarServiceLabel is the sidecar's service name, which is also its hostname
+	SidecarServiceLabel = "packnplay-sidecar-service"
+)
+
+// Sidecar is a service container started for a dev container from
+// customizations.packnplay.services
+type Sidecar struct {
+	Service string   `json:"service"` // hostname on the container's network
+	Name    string   `json:"name"`    // container name
+	Image   string   `json:"image"`
+	RunArgs []string `json:"run_args"`
+
+	// Filled in by ListSidecars
+	Owner   string `json:"-"` // dev container the sidecar belongs to
+	Status  string `json:"-"`
+	Running bool   `json:"-"`
+}
+
+// SidecarNetwork returns the network a container shares with its sidecars
+func SidecarNetwork(containerName string) string {
+	return containerName + "-net"
+}
+
+// sidecarName returns the container name of a service
+func sidecarName(containerName, service string) string {
+	return containerName + "-" + service
+}
+
+// imageBase returns an image's repository name without registry, namespace or tag,
+// e.g. "postgres" for docker.io/library/postgres:16
+func imageBase(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, "/"); i != -1 {
+		image = image[i+1:]
+	}
+	image, _, _ = strings.Cut(image, ":")
+	return image
+}
+
+// sidecarDefaults returns environment well-known images need to start, unless
+// the service sets it
+func sidecarDefaults(image string) map[string]string {
+	switch imageBase(image) {
+	case "postgres", "postgis":
+		return map[string]string{"POSTGRES_PASSWORD": "postgres"}
+	case "mysql", "mariadb":
+		return map[string]string{"MYSQL_ROOT_PASSWORD": "mysql"}
+	}
+	return nil
+}
+
+// connectionEnv returns the variables that tell the dev container how to reach
+// a service of a well-known image, given the service's environment
+func connectionEnv(service, image string, env map[string]string) map[string]string {
+	get := func(key, fallback string) string {
+		if v := env[key]; v != "" {
+			return v
+		}
+		return fallback
+	}
+	userinfo := func(user, password string) string {
+		return url.UserPassword(user, password).String()
+	}
+
+	switch imageBase(image) {
+	case "postgres", "postgis":
+		user := get("POSTGRES_USER", "postgres")
+		password := get("POSTGRES_PASSWORD", "")
+		db := get("POSTGRES_DB", user)
+		return map[string]string{
+			"DATABASE_URL": fmt.Sprintf("postgres://%s@%s:5432/%s", userinfo(user, password), service, url.PathEscape(db)),
+			"PGHOST":       service,
+			"PGPORT":       "5432",
+			"PGUSER":       user,
+			"PGPASSWORD":   password,
+			"PGDATABASE":   db,
+		}
+	case "mysql", "mariadb":
+		user, password := "root", get("MYSQL_ROOT_PASSWORD", get("MARIADB_ROOT_PASSWORD", ""))
+		if env["MYSQL_USER"] != "" {
+			user, password = env["MYSQL_USER"], env["MYSQL_PASSWORD"]
+		}
+		db := get("MYSQL_DATABASE", "")
+		return map[string]string{
+			"DATABASE_URL": fmt.Sprintf("mysql://%s@%s:3306/%s", userinfo(user, password), service, url.PathEscape(db)),
+			"MYSQL_HOST":   service,
+			"MYSQL_PORT":   "3306",
+		}
+	case "redis", "valkey":
+		return map[string]string{"REDIS_URL": fmt.Sprintf("redis://%s:6379", service)}
+	case "mongo":
+		return map[string]string{"MONGODB_URI": fmt.Sprintf("mongodb://%s:27017", service)}
+	case "rabbitmq":
+		return map[string]string{"AMQP_URL": fmt.Sprintf("amqp://guest:guest@%s:5672", service)}
+	}
+	return nil
+}
+
+// planSidecars resolves the sidecar containers for customizations.packnplay.services
+// and the environment to give the dev container. When several services set the
+// same connection variable, the first in name order keeps it. Ports are
+// forwardPorts entries such as "db:5432", published by the sidecar they name.
+func planSidecars(containerName string, services map[string]devcontainer.SidecarService, ports []devcontainer.ServicePort) ([]Sidecar, map[string]string) {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	network := SidecarNetwork(containerName)
+	containerEnv := make(map[string]string)
+	var sidecars []Sidecar
+	for _, service := range names {
+		svc := services[service]
+		env := sidecarDefaults(svc.Image)
+		if env == nil {
+			env = make(map[string]string)
+		}
+		for k, v := range svc.Env {
+			env[k] = v
+		}
+
+		name := sidecarName(containerName, service)
+		args := []string{"run", "-d", "--name", name, "--network", network, "--network-alias", service,
+			"--label", SidecarOfLabel + "=" + containerName,
+			"--label", SidecarServiceLabel + "=" + service,
+		}
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			args = append(args, "-e", k+"="+env[k])
+		}
+		for _, port := range ports {
+			if port.Service == service {
+				args = append(args, "-p", port.PublishArg())
+			}
+		}
+		args = append(args, svc.Image)
+		args = append(args, svc.Command...)
+		sidecars = append(sidecars, Sidecar{Service: service, Name: name, Image: svc.Image, RunArgs: args})
+
+		for k, v := range connectionEnv(service, svc.Image, env) {
+			if _, taken := containerEnv[k]; !taken {
+				containerEnv[k] = v
+			}
+		}
+		for k, v := range svc.ContainerEnv {
+			containerEnv[k] = v
+		}
+	}
+	return sidecars, containerEnv
+}
+
+// checkServicePorts makes sure the services forwardPorts entries name exist
+func checkServicePorts(ports []devcontainer.ServicePort, services []string, where string) error {
+	for _, port := range ports {
+		if !slices.Contains(services, port.Service) {
+			return errdefs.Errorf(errdefs.CategoryConfig, "forwardPorts entry %s:%d names no service in %s", port.Service, port.Port, where)
+		}
+	}
+	return nil
+}
+
+// networkFromRunArgs reports whether runArgs already choose a network
+func networkFromRunArgs(runArgs []string) bool {
+	for _, arg := range runArgs {
+		name, _, _ := strings.Cut(arg, "=")
+		if name == "--network" || name == "--net" {
+			return true
+		}
+	}
+	return false
+}
+
+// startSidecars creates the container's network and starts its sidecars,
+// replacing any left over from an earlier container of the same name
+func startSidecars(dockerClient DockerClient, containerName string, sidecars []Sidecar, verbose bool) error {
+	network := SidecarNetwork(containerName)
+	if _, err := dockerClient.Run("network", "inspect", network); err != nil {
+		if output, err := dockerClient.Run("network", "create", "--label", SidecarOfLabel+"="+containerName, network); err != nil {
+			return fmt.Errorf("failed to create network %s: %w\nDocker output:\n%s", network, err, output)
+		}
+	}
+
+	for _, sidecar := range sidecars {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Starting service %s (%s)\n", sidecar.Service, sidecar.Image)
+		}
+		_, _ = dockerClient.Run("rm", "-f", sidecar.Name)
+		if output, err := dockerClient.Run(sidecar.RunArgs...); err != nil {
+			_ = RemoveSidecars(dockerClient, containerName)
+			return fmt.Errorf("failed to start service %s: %w\nDocker output:\n%s", sidecar.Service, err, output)
+		}
+	}
+	return nil
+}
+
+// resumeSidecars starts the stopped sidecars of a container being reused
+func resumeSidecars(dockerClient DockerClient, containerName string) error {
+	sidecars, err := ListSidecars(dockerClient, containerName)
+	if err != nil {
+		return err
+	}
+	for _, sidecar := range sidecars {
+		if sidecar.Running {
+			continue
+		}
+		if output, err := dockerClient.Run("start", sidecar.Name); err != nil {
+			return fmt.Errorf("failed to start service %s: %w\nDocker output:\n%s", sidecar.Service, err, output)
+		}
+	}
+	return nil
+}
+
+// ListSidecars returns the sidecars of containerName, or of every container
+// when it is empty
+func ListSidecars(dockerClient DockerClient, containerName string) ([]Sidecar, error) {
+	filter := "label=" + SidecarOfLabel
+	if containerName != "" {
+		filter += "=" + containerName
+	}
+	output, err := dockerClient.Run("ps", "-a", "--filter", filter, "--format", "{{json .}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	var sidecars []Sidecar
+	for _, line := range strings.Split(output, "\n") {
+		var info struct {
+			Names  string `json:"Names"`
+			Image  string `json:"Image"`
+			State  string `json:"State"`
+			Status string `json:"Status"`
+			Labels string `json:"Labels"`
+		}
+		if strings.TrimSpace(line) == "" || json.Unmarshal([]byte(line), &info) != nil {
+			continue
+		}
+		labels := container.ParseLabels(info.Labels)
+		sidecars = append(sidecars, Sidecar{
+			Service: labels[SidecarServiceLabel],
+			Name:    info.Names,
+			Image:   info.Image,
+			Owner:   labels[SidecarOfLabel],
+			Status:  info.Status,
+			Running: info.State == "running" || strings.HasPrefix(info.Status, "Up"),
+		})
+	}
+	sort.Slice(sidecars, func(i, j int) bool { return sidecars[i].Name < sidecars[j].Name })
+	return sidecars, nil
+}
+
+// RemoveSidecars removes a container's sidecars and their network
+func RemoveSidecars(dockerClient DockerClient, containerName string) error {
+	sidecars, err := ListSidecars(dockerClient, containerName)
+	if err != nil {
+		return err
+	}
+	network := SidecarNetwork(containerName)
+	if len(sidecars) == 0 {
+		if _, err := dockerClient.Run("network", "inspect", network); err != nil {
+			return nil // the container never had services
+		}
+	}
+
+	var failed []string
+	for _, sidecar := range sidecars {
+		if output, err := dockerClient.Run("rm", "-f", sidecar.Name); err != nil && !strings.Contains(strings.ToLower(output), "no such container") {
+			failed = append(failed, sidecar.Name)
+		}
+	}
+	if output, err := dockerClient.Run("network", "rm", network); err != nil && !strings.Contains(strings.ToLower(output), "not found") {
+		failed = append(failed, "network "+network)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove services of %s: %s", containerName, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// PruneSidecars removes sidecars (and their networks) whose dev container no
+// longer exists, returning the containers they belonged to
+func PruneSidecars(dockerClient DockerClient) ([]string, error) {
+	sidecars, err := ListSidecars(dockerClient, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(sidecars) == 0 {
+		return nil, nil
+	}
+	output, err := dockerClient.Run("ps", "-a", "--format", "{{.Names}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, name := range strings.Split(output, "\n") {
+		existing[strings.TrimSpace(name)] = true
+	}
+
+	var pruned []string
+	seen := make(map[string]bool)
+	for _, sidecar := range sidecars {
+		if existing[sidecar.Owner] || seen[sidecar.Owner] {
+			continue
+		}
+		seen[sidecar.Owner] = true
+		if err := RemoveSidecars(dockerClient, sidecar.Owner); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, sidecar.Owner)
+	}
+	return pruned, nil
+}
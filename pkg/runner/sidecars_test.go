@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+func TestPlanSidecars(t *testing.T) {
+	sidecars, env := planSidecars("packnplay-app-main", map[string]devcontainer.SidecarService{
+		"db":     {Image: "postgres:16", Env: map[string]string{"POSTGRES_DB": "app"}},
+		"cache":  {Image: "docker.io/library/redis:7", Command: []string{"redis-server", "--save", ""}},
+		"search": {Image: "example/search:1", ContainerEnv: map[string]string{"SEARCH_URL": "http://search:9200"}},
+	}, []devcontainer.ServicePort{{Service: "db", Port: 5432}, {Service: "other", Port: 80}})
+
+	if len(sidecars) != 3 || sidecars[0].Service != "cache" || sidecars[1].Name != "packnplay-app-main-db" {
+		t.Fatalf("sidecars = %+v", sidecars)
+	}
+	db := sidecars[1].RunArgs
+	if argValue(db, "--network") != "packnplay-app-main-net" || argValue(db, "--network-alias") != "db" ||
+		!contains(db, "POSTGRES_PASSWORD=postgres", "POSTGRES_DB=app", SidecarOfLabel+"=packnplay-app-main") || db[len(db)-1] != "postgres:16" {
+		t.Errorf("db run args = %v", db)
+	}
+	if argValue(db, "-p") != "127.0.0.1:5432:5432" || argValue(sidecars[0].RunArgs, "-p") != "" {
+		t.Errorf("db run args = %v, want only db publishing its forwarded port", db)
+	}
+	if cache := sidecars[0].RunArgs; !reflect.DeepEqual(cache[len(cache)-4:], []string{"docker.io/library/redis:7", "redis-server", "--save", ""}) {
+		t.Errorf("cache run args = %v, want the command after the image", cache)
+	}
+
+	want := map[string]string{
+		"DATABASE_URL": "postgres://postgres:postgres@db:5432/app",
+		"PGHOST":       "db",
+		"PGPORT":       "5432",
+		"PGUSER":       "postgres",
+		"PGPASSWORD":   "postgres",
+		"PGDATABASE":   "app",
+		"REDIS_URL":    "redis://cache:6379",
+		"SEARCH_URL":   "http://search:9200",
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("container env = %v, want %v", env, want)
+	}
+}
+
+func TestRunStartsAndRemovesSidecars(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	fake.Fail(errors.New("exit status 1"), "Error response from daemon: network not found\n", "network", "inspect")
+	project := newProject(t, `{
+		"image": "alpine:3.20",
+		"remoteUser": "root",
+		"containerEnv": {"REDIS_URL": "redis://cache:6380"},
+		"customizations": {"packnplay": {"services": {"db": {"image": "postgres:16"}, "cache": {"image": "redis:7"}}}}
+	}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	name := container.GenerateContainerName(project, "no-worktree")
+	main := fake.Container(name)
+	if main == nil {
+		t.Fatal("container should be created")
+	}
+	if argValue(main.RunArgs, "--network") != SidecarNetwork(name) || !contains(main.RunArgs, "DATABASE_URL=postgres://postgres:postgres@db:5432/postgres") {
+		t.Errorf("docker run args = %v, want the services network and connection env", main.RunArgs)
+	}
+	// containerEnv comes later on the command line, so it wins
+	if env := strings.Join(main.RunArgs, " "); strings.LastIndex(env, "REDIS_URL=redis://cache:6380") < strings.LastIndex(env, "REDIS_URL=redis://cache:6379") {
+		t.Errorf("containerEnv should override the derived REDIS_URL: %v", main.RunArgs)
+	}
+	for _, service := range []string{"db", "cache"} {
+		sidecar := fake.Container(name + "-" + service)
+		if sidecar == nil || !sidecar.Running || sidecar.Labels[SidecarOfLabel] != name || sidecar.Labels[SidecarServiceLabel] != service {
+			t.Errorf("sidecar %s = %+v", service, sidecar)
+		}
+	}
+	if !containsCall(fake.CallsTo("network", "create"), SidecarNetwork(name)) {
+		t.Errorf("the services network should be created: %v", fake.Calls())
+	}
+
+	if err := RemoveSidecars(fake, name); err != nil {
+		t.Fatalf("RemoveSidecars() error = %v", err)
+	}
+	if fake.Container(name+"-db") != nil || fake.Container(name+"-cache") != nil {
+		t.Error("sidecars should be removed")
+	}
+	if !containsCall(fake.CallsTo("network", "rm"), SidecarNetwork(name)) {
+		t.Error("the services network should be removed")
+	}
+}
+
+func TestRunRejectsSidecarsWithNetworkRunArg(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "runArgs": ["--network=host"], "customizations": {"packnplay": {"services": {"db": {"image": "postgres:16"}}}}}`)
+
+	err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}})
+	if err == nil || !strings.Contains(err.Error(), "--network") {
+		t.Fatalf("Run() error = %v, want the network conflict", err)
+	}
+	if len(fake.CallsTo("run")) != 0 {
+		t.Error("nothing should be started")
+	}
+}
+
+func TestRunRejectsForwardPortOfUnknownService(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "forwardPorts": [3000, "cache:6379"], "customizations": {"packnplay": {"services": {"db": {"image": "postgres:16"}}}}}`)
+
+	err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}})
+	if errdefs.CategoryOf(err) != errdefs.CategoryConfig || !strings.Contains(err.Error(), "cache:6379") {
+		t.Fatalf("Run() error = %v, want a config error naming the entry", err)
+	}
+}
+
+func TestPruneSidecars(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-main", Running: true})
+	fake.AddContainer(dockertest.Container{Name: "packnplay-app-main-db", Running: true, Labels: map[string]string{SidecarOfLabel: "packnplay-app-main", SidecarServiceLabel: "db"}})
+	fake.AddContainer(dockertest.Container{Name: "packnplay-gone-main-db", Labels: map[string]string{SidecarOfLabel: "packnplay-gone-main", SidecarServiceLabel: "db"}})
+
+	pruned, err := PruneSidecars(fake)
+	if err != nil || !reflect.DeepEqual(pruned, []string{"packnplay-gone-main"}) {
+		t.Fatalf("PruneSidecars() = %v, %v", pruned, err)
+	}
+	if fake.Container("packnplay-gone-main-db") != nil || fake.Container("packnplay-app-main-db") == nil {
+		t.Error("only the orphaned sidecar should be removed")
+	}
+}
@@ -0,0 +1,186 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// SSHLabel marks containers created with --ssh; its value is the user to log in as
+	SSHLabel = "packnplay-ssh"
+	// SSHContainerPort is where sshd listens in the container, as the sshd feature does
+	SSHContainerPort = "2222"
+	// sshdPidFile tracks the sshd packnplay started
+	sshdPidFile = "/run/packnplay-sshd.pid"
+	// sshFeatureInit is the start script of the official sshd feature
+	sshFeatureInit = "/usr/local/share/ssh-init.sh"
+)
+
+// installSSHDScript installs an OpenSSH server with whichever package manager the image has
+const installSSHDScript = `command -v sshd >/dev/null 2>&1 || [ -x /usr/sbin/sshd ] && exit 0
+if command -v apt-get >/dev/null 2>&1; then apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq openssh-server
+elif command -v apk >/dev/null 2>&1; then apk add --no-cache openssh-server
+elif command -v dnf >/dev/null 2>&1; then dnf install -y openssh-server
+elif command -v microdnf >/dev/null 2>&1; then microdnf install -y openssh-server
+elif command -v yum >/dev/null 2>&1; then yum install -y openssh-server
+else echo "no supported package manager found" >&2; exit 1
+fi`
+
+// startSSHDScript starts sshd on SSHContainerPort for key logins only, unless
+// it is already running. Images with the sshd feature use its start script.
+var startSSHDScript = fmt.Sprintf(`if [ -x %[1]s ]; then exec %[1]s true; fi
+[ -f %[2]s ] && kill -0 "$(cat %[2]s)" 2>/dev/null && exit 0
+mkdir -p /run/sshd && ssh-keygen -A >/dev/null
+sshd=$(command -v sshd || echo /usr/sbin/sshd)
+exec "$sshd" -p %[3]s -o PidFile=%[2]s -o PasswordAuthentication=no -o KbdInteractiveAuthentication=no -o PermitRootLogin=prohibit-password`,
+	sshFeatureInit, sshdPidFile, SSHContainerPort)
+
+// sshServerArgs publishes the container's sshd on a random loopback port
+func sshServerArgs(remoteUser string) []string {
+	return []string{
+		"-p", "127.0.0.1::" + SSHContainerPort,
+		"--label", fmt.Sprintf("%s=%s", SSHLabel, remoteUser),
+	}
+}
+
+// sshAgentKeys lists the public keys loaded in the host's ssh-agent
+var sshAgentKeys = func() string {
+	output, _ := exec.Command("ssh-add", "-L").Output()
+	return string(output)
+}
+
+// hostPublicKeys returns the user's SSH public keys: ~/.ssh/*.pub and the keys
+// in ssh-agent, without duplicates
+func hostPublicKeys(homeDir string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	add := func(content string) {
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !strings.HasPrefix(fields[0], "ssh-") && !strings.HasPrefix(fields[0], "ecdsa-") && !strings.HasPrefix(fields[0], "sk-") {
+				continue
+			}
+			if !seen[fields[1]] {
+				seen[fields[1]] = true
+				keys = append(keys, line)
+			}
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(homeDir, ".ssh", "*.pub"))
+	sort.Strings(files)
+	for _, file := range files {
+		if data, err := os.ReadFile(file); err == nil {
+			add(string(data))
+		}
+	}
+	add(sshAgentKeys())
+	return keys
+}
+
+// authorizeKeysScript appends keys missing from the user's authorized_keys
+func authorizeKeysScript(keys []string) string {
+	var b strings.Builder
+	b.WriteString(`umask 077; mkdir -p "$HOME/.ssh"; f="$HOME/.ssh/authorized_keys"; touch "$f"`)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "; grep -qxF %[1]s \"$f\" || echo %[1]s >> \"$f\"", shellQuote(key))
+	}
+	return b.String()
+}
+
+// ensureSSHServer installs and starts sshd in a new container and authorizes
+// the host user's public keys for remoteUser
+func ensureSSHServer(dockerClient DockerClient, containerID, remoteUser, homeDir string, verbose bool) error {
+	keys := hostPublicKeys(homeDir)
+	if len(keys) == 0 {
+		return fmt.Errorf("no SSH public keys found in %s or ssh-agent; create one with ssh-keygen", filepath.Join(homeDir, ".ssh"))
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Setting up SSH server...\n")
+	}
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", installSSHDScript); err != nil {
+		return fmt.Errorf("failed to install sshd: %w\nDocker output:\n%s", err, output)
+	}
+
+	args := []string{"exec"}
+	if remoteUser != "" {
+		args = append(args, "-u", remoteUser)
+	}
+	args = append(args, containerID, "/bin/sh", "-c", authorizeKeysScript(keys))
+	if output, err := dockerClient.Run(args...); err != nil {
+		return fmt.Errorf("failed to authorize SSH keys: %w\nDocker output:\n%s", err, output)
+	}
+	return startSSHServer(dockerClient, containerID)
+}
+
+// startSSHServer starts sshd if it isn't running, e.g. after a container restart
+func startSSHServer(dockerClient DockerClient, containerID string) error {
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "/bin/sh", "-c", startSSHDScript); err != nil {
+		return fmt.Errorf("failed to start sshd: %w\nDocker output:\n%s", err, output)
+	}
+	return nil
+}
+
+// resumeSSHServer restarts sshd in a container created with --ssh
+func resumeSSHServer(dockerClient DockerClient, containerName string) error {
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil
+	}
+	output, err := dockerClient.Run("inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", SSHLabel), containerName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if user := strings.TrimSpace(output); user == "" || user == "<no value>" {
+		return nil
+	}
+	return startSSHServer(dockerClient, containerName)
+}
+
+// sshEndpoint returns the host address sshd is published on
+func sshEndpoint(dockerClient DockerClient, containerID string) (string, string, error) {
+	output, err := dockerClient.Run("port", containerID, SSHContainerPort+"/tcp")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find SSH port: %w", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		idx := strings.LastIndex(strings.TrimSpace(line), ":")
+		if idx == -1 {
+			continue
+		}
+		line = strings.TrimSpace(line)
+		return strings.Trim(line[:idx], "[]"), line[idx+1:], nil
+	}
+	return "", "", fmt.Errorf("SSH port %s is not published", SSHContainerPort)
+}
+
+// SSHConfigStanza returns an ~/.ssh/config entry for a container's sshd. Host
+// keys change with every container, so they aren't recorded.
+func SSHConfigStanza(containerName, host, port, user string) string {
+	if user == "" {
+		user = "root"
+	}
+	return fmt.Sprintf(`Host %s
+  HostName %s
+  Port %s
+  User %s
+  StrictHostKeyChecking no
+  UserKnownHostsFile /dev/null
+  LogLevel ERROR
+`, containerName, host, port, user)
+}
+
+// printSSHConfig tells the user how to connect to a new container's sshd
+func printSSHConfig(dockerClient DockerClient, containerID, containerName, remoteUser string) {
+	host, port, err := sshEndpoint(dockerClient, containerID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "SSH server listening on %s:%s. Add this to ~/.ssh/config (or see: packnplay list --ssh-config):\n\n%s\n", host, port, SSHConfigStanza(containerName, host, port, remoteUser))
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunWithSSHPublishesSSHD(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	fake.On(func([]string) (string, error) { return "127.0.0.1:49153\n", nil }, "port")
+	origAgent := sshAgentKeys
+	t.Cleanup(func() { sshAgentKeys = origAgent })
+	sshAgentKeys = func() string { return "ssh-ed25519 AAAAagent agent@host\n" }
+
+	home, _ := os.UserHomeDir()
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519.pub"), []byte("ssh-ed25519 AAAAfile me@host\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "vscode"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, SSH: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	c := fake.Container(container.GenerateContainerName(project, "no-worktree"))
+	if c == nil {
+		t.Fatal("container should be created")
+	}
+	if !contains(c.RunArgs, "-p 127.0.0.1::2222") || c.Labels[SSHLabel] != "vscode" {
+		t.Errorf("docker run args = %v, labels = %v, want sshd published and labelled", c.RunArgs, c.Labels)
+	}
+	if !containsCall(fake.CallsTo("exec", "-u", "vscode"), "AAAAfile", "AAAAagent", "authorized_keys") {
+		t.Errorf("host keys should be authorized for the remote user: %v", fake.CallsTo("exec"))
+	}
+	if !containsCall(fake.CallsTo("exec", "-u", "root"), "-p 2222") {
+		t.Errorf("sshd should be started: %v", fake.CallsTo("exec"))
+	}
+}
+
+func TestHostPublicKeysDeduplicates(t *testing.T) {
+	home := t.TempDir()
+	origAgent := sshAgentKeys
+	t.Cleanup(func() { sshAgentKeys = origAgent })
+	sshAgentKeys = func() string {
+		return "ssh-ed25519 AAAAone agent\necdsa-sha2-nistp256 AAAAtwo\nThe agent has no identities.\n"
+	}
+
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519.pub"), []byte("ssh-ed25519 AAAAone me@host\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := hostPublicKeys(home)
+	if strings.Join(keys, "|") != "ssh-ed25519 AAAAone me@host|ecdsa-sha2-nistp256 AAAAtwo" {
+		t.Errorf("hostPublicKeys() = %q", keys)
+	}
+}
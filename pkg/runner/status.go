@@ -0,0 +1,179 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// lifecyclePhases are the lifecycle commands tracked in container metadata,
+// in the order they run
+var lifecyclePhases = []string{"onCreate", "updateContent", "postCreate", "postStart"}
+
+// ProjectStatus is what `packnplay status` reports about a workspace's container
+type ProjectStatus struct {
+	Workspace     Workspace     `json:"workspace"`
+	ConfigFile    string        `json:"config_file,omitempty"` // devcontainer.json in use; "" for the default image
+	ContainerName string        `json:"container_name"`
+	Exists        bool          `json:"exists"`
+	ContainerID   string        `json:"container_id,omitempty"`
+	State         string        `json:"state,omitempty"` // running, exited, paused, ...
+	Created       time.Time     `json:"created,omitempty"`
+	StartedAt     time.Time     `json:"started_at,omitempty"`
+	Image         string        `json:"image,omitempty"`
+	ImageCreated  time.Time     `json:"image_created,omitempty"`
+	Lifecycle     []PhaseStatus `json:"lifecycle,omitempty"`
+	Incomplete    bool          `json:"incomplete,omitempty"` // setup was interrupted; the next run resumes it
+	Ports         []PortBinding `json:"ports,omitempty"`
+
+	// Drift lists the settings that changed since the container was created,
+	// as a run without flags would see them; DriftChecked is false when the
+	// container recorded none (created by an older version, or compose)
+	Drift        []string `json:"drift,omitempty"`
+	DriftChecked bool     `json:"drift_checked"`
+
+	AttachCommand string `json:"attach_command,omitempty"` // set while the container runs
+}
+
+// Running reports whether the container exists and is running
+func (s *ProjectStatus) Running() bool {
+	return s.State == "running"
+}
+
+// PhaseStatus is the last run of a lifecycle command in a container
+type PhaseStatus struct {
+	Phase  string    `json:"phase"`
+	Ran    time.Time `json:"ran,omitempty"`    // last successful run
+	Failed time.Time `json:"failed,omitempty"` // last failure, when no run succeeded since
+	Error  string    `json:"error,omitempty"`
+}
+
+// Status reports on the container of the workspace config resolves to,
+// without creating a worktree, pulling, or building anything
+func Status(config *RunConfig) (*ProjectStatus, error) {
+	// Resolving the workspace must not create a worktree
+	config.DryRun = true
+	ws, err := ResolveWorkspace(config)
+	if err != nil {
+		return nil, err
+	}
+	devConfig, err := ResolveConfig(config, ws)
+	if err != nil {
+		return nil, err
+	}
+	dockerClient, err := newDockerClient(config.Runtime, config.Verbose)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to initialize container runtime: %w", err)
+	}
+	backend := runtimeBackend(dockerClient)
+	if caps := backend.Capabilities(); !caps.Inspect || !caps.PSFlags {
+		return nil, fmt.Errorf("reporting container status: %w (%s)", docker.ErrUnsupported, backend.Name())
+	}
+
+	status := &ProjectStatus{
+		Workspace:     *ws,
+		ConfigFile:    devConfig.Path(),
+		ContainerName: container.GenerateContainerName(ws.WorkDir, ws.WorktreeName),
+	}
+	output, err := dockerClient.Run("ps", "-a", "--filter", "name="+status.ContainerName, "--format", "{{.Names}}")
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryContainer, "failed to check container status: %w", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == status.ContainerName {
+			status.Exists = true
+		}
+	}
+	if !status.Exists {
+		return status, nil
+	}
+
+	output, err = dockerClient.Run("inspect", "--type", "container", "--format", "{{.Id}}|{{.State.Status}}|{{.Created}}|{{.State.StartedAt}}|{{.Config.Image}}", status.ContainerName)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryContainer, "failed to inspect container %s: %w", status.ContainerName, err)
+	}
+	fields := strings.Split(strings.TrimSpace(output), "|")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("unexpected inspect output %q", output)
+	}
+	status.ContainerID, status.State, status.Image = fields[0], fields[1], fields[4]
+	status.Created, _ = time.Parse(time.RFC3339Nano, fields[2])
+	status.StartedAt, _ = time.Parse(time.RFC3339Nano, fields[3])
+	if output, err := dockerClient.Run("image", "inspect", "--format", "{{.Created}}", status.Image); err == nil {
+		status.ImageCreated, _ = time.Parse(time.RFC3339Nano, strings.TrimSpace(output))
+	}
+
+	if metadata, err := LoadMetadata(status.ContainerID); err == nil {
+		status.Lifecycle = lifecycleStatus(metadata)
+		status.Incomplete = metadata.Incomplete
+	}
+	if status.Running() {
+		if ports, err := backend.PortMap(dockerClient, status.ContainerName); err == nil {
+			status.Ports = ports
+		}
+		status.AttachCommand = "packnplay attach --name=" + status.ContainerName
+	}
+
+	// Compose services are created by compose, without recorded settings
+	if len(devConfig.GetDockerComposeFiles()) == 0 {
+		lockfile, err := devcontainer.LoadLockFile(ws.MountPath)
+		if err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load lockfile: %w", err)
+		}
+		labels := container.InspectLabels(dockerClient, status.ContainerName)[status.ContainerName]
+		recorded := container.ReadMetadata(labels).Settings
+		if len(recorded) > 0 {
+			status.DriftChecked = true
+			status.Drift = statusDrift(recorded, devConfig, effectiveSettings(config, devConfig, lockfile, projectImageName(devConfig, ws.WorkDir)))
+		}
+	}
+	return status, nil
+}
+
+// statusDrift compares recorded settings with current ones. A remoteUser
+// detected from the built image at creation isn't compared, since detecting
+// it again would mean building the image.
+func statusDrift(recorded map[string]string, devConfig *devcontainer.Config, current map[string]string) []string {
+	if devConfig.RemoteUser == "" && (devConfig.HasDockerfile() || len(devConfig.Features) > 0) {
+		recorded = withoutSetting(recorded, "remoteUser")
+		current = withoutSetting(current, "remoteUser")
+	}
+	return configDrift(recorded, current)
+}
+
+// withoutSetting returns a copy of settings without name
+func withoutSetting(settings map[string]string, name string) map[string]string {
+	result := make(map[string]string, len(settings))
+	for k, v := range settings {
+		if k != name {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// lifecycleStatus lists the lifecycle commands recorded in metadata, in the
+// order they run
+func lifecycleStatus(metadata *ContainerMetadata) []PhaseStatus {
+	var phases []PhaseStatus
+	for _, phase := range lifecyclePhases {
+		state, ok := metadata.LifecycleRan[phase]
+		if !ok {
+			continue
+		}
+		status := PhaseStatus{Phase: phase}
+		if state.Executed {
+			status.Ran = state.Timestamp
+		}
+		if state.Failure != nil && state.Failure.Timestamp.After(status.Ran) {
+			status.Failed, status.Error = state.Failure.Timestamp, state.Failure.Error
+		}
+		phases = append(phases, status)
+	}
+	return phases
+}
@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestStatus(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "postStartCommand": "echo hi"}`)
+	name := container.GenerateContainerName(project, "no-worktree")
+
+	status, err := Status(&RunConfig{Path: project, NoWorktree: true})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Exists || status.ContainerName != name {
+		t.Fatalf("Status() = %+v, want no container yet", status)
+	}
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"bash"}}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	fake.On(func([]string) (string, error) { return "3000/tcp -> 127.0.0.1:3000\n", nil }, "port")
+
+	status, err = Status(&RunConfig{Path: project, NoWorktree: true})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !status.Running() || status.ContainerID != fake.Container(name).ID || status.Image != "alpine:3.20" || status.ImageCreated.IsZero() {
+		t.Errorf("Status() = %+v, want the running container and its image", status)
+	}
+	if len(status.Lifecycle) != 1 || status.Lifecycle[0].Phase != "postStart" || status.Lifecycle[0].Ran.IsZero() {
+		t.Errorf("lifecycle = %+v, want postStart ran", status.Lifecycle)
+	}
+	if len(status.Ports) != 1 || status.Ports[0].HostPort != "3000" {
+		t.Errorf("ports = %+v", status.Ports)
+	}
+	if !status.DriftChecked || len(status.Drift) != 0 {
+		t.Errorf("drift = %v (checked %v), want none", status.Drift, status.DriftChecked)
+	}
+	if status.AttachCommand != "packnplay attach --name="+name {
+		t.Errorf("attach command = %q", status.AttachCommand)
+	}
+
+	devcontainerJSON := `{"image": "alpine:3.20", "remoteUser": "root", "postStartCommand": "echo hi", "containerEnv": {"MODE": "new"}}`
+	if err := os.WriteFile(filepath.Join(project, ".devcontainer", "devcontainer.json"), []byte(devcontainerJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.Run("stop", name); err != nil {
+		t.Fatal(err)
+	}
+	status, err = Status(&RunConfig{Path: project, NoWorktree: true})
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Running() || status.AttachCommand != "" || len(status.Ports) != 0 {
+		t.Errorf("Status() = %+v, want a stopped container", status)
+	}
+	if !reflect.DeepEqual(status.Drift, []string{"containerEnv"}) {
+		t.Errorf("drift = %v, want containerEnv", status.Drift)
+	}
+}
+
+func TestStatusDriftSkipsDetectedRemoteUser(t *testing.T) {
+	recorded := map[string]string{"remoteUser": "aaa", "image": "bbb"}
+	current := map[string]string{"image": "bbb"}
+
+	built := &devcontainer.Config{Build: &devcontainer.BuildConfig{Dockerfile: "Dockerfile"}}
+	if drift := statusDrift(recorded, built, current); len(drift) != 0 {
+		t.Errorf("statusDrift() = %v, want the detected remoteUser skipped", drift)
+	}
+	named := &devcontainer.Config{Image: "alpine:3.20"}
+	if drift := statusDrift(recorded, named, current); !reflect.DeepEqual(drift, []string{"remoteUser"}) {
+		t.Errorf("statusDrift() = %v, want remoteUser", drift)
+	}
+}
+
+func TestLifecycleStatus(t *testing.T) {
+	ran := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	metadata := &ContainerMetadata{LifecycleRan: map[string]LifecycleState{
+		"postStart":  {Executed: true, Timestamp: ran.Add(time.Hour)},
+		"onCreate":   {Executed: true, Timestamp: ran},
+		"postCreate": {Executed: true, Timestamp: ran, Failure: &LifecycleFailure{Timestamp: ran.Add(time.Minute), Error: "exit status 1"}},
+	}}
+	got := lifecycleStatus(metadata)
+	want := []PhaseStatus{
+		{Phase: "onCreate", Ran: ran},
+		{Phase: "postCreate", Ran: ran, Failed: ran.Add(time.Minute), Error: "exit status 1"},
+		{Phase: "postStart", Ran: ran.Add(time.Hour)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lifecycleStatus() = %+v, want %+v", got, want)
+	}
+}
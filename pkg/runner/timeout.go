@@ -0,0 +1,104 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// timeoutGrace is how long a timed-out command has to exit after SIGTERM
+// before it is killed, replaced in tests
+var timeoutGrace = 10 * time.Second
+
+// execTimeout bounds how long the user's command may run
+type execTimeout struct {
+	Duration      time.Duration
+	StopContainer bool   // also stop the container when the timeout elapses
+	PIDFile       string // where the command records its pid in the container
+}
+
+// newExecTimeout returns the time box for config's command, or nil without --timeout
+func newExecTimeout(config *RunConfig) *execTimeout {
+	if config.Timeout <= 0 {
+		return nil
+	}
+	return &execTimeout{
+		Duration:      config.Timeout,
+		StopContainer: config.TimeoutStop,
+		PIDFile:       fmt.Sprintf("/tmp/packnplay-exec-%d-%d.pid", os.Getpid(), time.Now().UnixNano()),
+	}
+}
+
+// wrap makes command record its pid before it starts, so it can be signalled
+// inside the container; killing the docker exec client alone would leave it
+// running
+func (t *execTimeout) wrap(command []string) []string {
+	if len(command) == 0 {
+		return command
+	}
+	return append([]string{"/bin/sh", "-c", `echo $$ > "$0" && exec "$@"`, t.PIDFile}, command...)
+}
+
+// signalCommand sends sig to the wrapped command inside the container
+func (t *execTimeout) signalCommand(dockerClient DockerClient, containerID, sig string) {
+	script := fmt.Sprintf(`[ -f %[1]s ] && kill -%[2]s "$(cat %[1]s)"`, t.PIDFile, sig)
+	_, _ = dockerClient.Run("exec", containerID, "/bin/sh", "-c", script)
+}
+
+// run runs the exec as a child instead of replacing packnplay, forwarding
+// SIGINT and SIGTERM to it. When the timeout elapses the command gets SIGTERM,
+// then SIGKILL after timeoutGrace, and the container is stopped if asked.
+// The command's own failure is returned as an *exec.ExitError.
+func (t *execTimeout) run(dockerClient DockerClient, cmdPath string, execArgs []string, containerID string) error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	cmd, done, err := startSupervised(cmdPath, execArgs)
+	if err != nil {
+		return fmt.Errorf("failed to start docker exec: %w", err)
+	}
+
+	timer := time.NewTimer(t.Duration)
+	defer timer.Stop()
+	for {
+		select {
+		case sig := <-sigChan:
+			_ = cmd.Process.Signal(sig)
+		case err := <-done:
+			return err
+		case <-timer.C:
+			fmt.Fprintf(os.Stderr, "Command ran past the %s timeout, stopping it\n", t.Duration)
+			t.signalCommand(dockerClient, containerID, "TERM")
+			select {
+			case <-done:
+			case <-time.After(timeoutGrace):
+				t.signalCommand(dockerClient, containerID, "KILL")
+				_ = cmd.Process.Kill()
+				<-done
+			}
+			if t.StopContainer {
+				if output, err := dockerClient.Run("stop", containerID); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: failed to stop container: %v\n%s", err, output)
+				}
+			}
+			return errdefs.Errorf(errdefs.CategoryTimeout, "command timed out after %s", t.Duration)
+		}
+	}
+}
+
+// exitWithCommandStatus ends packnplay with the exit code of a command that
+// failed on its own, as exec would have; other errors are returned
+func exitWithCommandStatus(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitProcess(exitErr.ExitCode())
+	}
+	return err
+}
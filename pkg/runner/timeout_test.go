@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+func TestExecTimeoutWrapRecordsPID(t *testing.T) {
+	timeout := &execTimeout{Duration: time.Minute, PIDFile: filepath.Join(t.TempDir(), "exec.pid")}
+	wrapped := timeout.wrap([]string{"echo", "hello  world"})
+
+	output, err := exec.Command(wrapped[0], wrapped[1:]...).Output()
+	if err != nil {
+		t.Fatalf("wrapped command error = %v", err)
+	}
+	if string(output) != "hello  world\n" {
+		t.Errorf("wrapped command output = %q, want the arguments unchanged", output)
+	}
+	if pid, err := os.ReadFile(timeout.PIDFile); err != nil || strings.TrimSpace(string(pid)) == "" {
+		t.Errorf("pid file = %q, %v; want the command's pid", pid, err)
+	}
+	if got := timeout.wrap(nil); got != nil {
+		t.Errorf("wrap(nil) = %v, want nil", got)
+	}
+}
+
+func TestExecTimeoutStopsCommand(t *testing.T) {
+	origGrace := timeoutGrace
+	t.Cleanup(func() { timeoutGrace = origGrace })
+	timeoutGrace = 50 * time.Millisecond
+
+	fake := dockertest.New()
+	timeout := &execTimeout{Duration: 50 * time.Millisecond, StopContainer: true, PIDFile: "/tmp/packnplay-exec-test.pid"}
+	start := time.Now()
+	err := timeout.run(fake, "/bin/sh", []string{"sh", "-c", "exec sleep 10"}, "abc123")
+
+	if errdefs.CategoryOf(err) != errdefs.CategoryTimeout {
+		t.Fatalf("run() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("run() took %s, want the command killed after the grace period", elapsed)
+	}
+	execs := fake.CallsTo("exec", "abc123")
+	if !containsCall(execs, "kill -TERM", timeout.PIDFile) || !containsCall(execs, "kill -KILL", timeout.PIDFile) {
+		t.Errorf("exec calls = %v, want SIGTERM then SIGKILL sent to the command", execs)
+	}
+	if len(fake.CallsTo("stop", "abc123")) != 1 {
+		t.Errorf("the container should be stopped: %v", fake.Calls())
+	}
+}
+
+func TestExecTimeoutKeepsExitStatus(t *testing.T) {
+	fake := dockertest.New()
+	timeout := &execTimeout{Duration: time.Minute, PIDFile: "/tmp/packnplay-exec-test.pid"}
+
+	err := timeout.run(fake, "/bin/sh", []string{"sh", "-c", "exit 3"}, "abc123")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("run() error = %v, want the command's exit status 3", err)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("a command that finishes in time shouldn't be signalled: %v", fake.Calls())
+	}
+}
+
+func TestRunWithTimeoutSupervisesCommand(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	call := useFakeRuntime(t, fake)
+	lookPath = func(string) (string, error) { return "/bin/true", nil }
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	if err := Run(&RunConfig{Path: project, NoWorktree: true, Command: []string{"agent"}, Timeout: time.Minute}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if call.path != "" {
+		t.Errorf("with --timeout packnplay should supervise the command, not exec %s", call.path)
+	}
+}
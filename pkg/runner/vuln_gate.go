@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/vulnscan"
+)
+
+// ImageScanner scans a local image for known vulnerabilities
+type ImageScanner interface {
+	Scan(image string) (*vulnscan.Report, error)
+}
+
+// maxListedFindings bounds how many vulnerabilities the gate prints
+const maxListedFindings = 10
+
+// vulnerabilityGate scans image before a container is created from it and applies
+// the policy mode: warn prints a summary, prompt asks before continuing, and block
+// refuses to run. A scan that can't run only blocks in block mode.
+func vulnerabilityGate(mode, image string, scanner ImageScanner, confirm func(prompt string) bool, verbose bool) error {
+	switch vulnscan.Mode(mode) {
+	case "", vulnscan.ModeOff:
+		return nil
+	case vulnscan.ModeWarn, vulnscan.ModePrompt, vulnscan.ModeBlock:
+	default:
+		return errdefs.Errorf(errdefs.CategoryConfig, "invalid vuln_scan mode %q (use off, warn, prompt, or block)", mode)
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Scanning %s for vulnerabilities...\n", image)
+	}
+	report, err := scanner.Scan(image)
+	if err != nil {
+		if vulnscan.Mode(mode) == vulnscan.ModeBlock {
+			return errdefs.Errorf(errdefs.CategoryPolicy, "cannot enforce vulnerability policy: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: skipping vulnerability scan: %v\n", err)
+		return nil
+	}
+	if len(report.Findings) == 0 {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "No vulnerabilities found in %s at or above the configured severity\n", image)
+		}
+		return nil
+	}
+
+	summary := report.Summary(maxListedFindings)
+	switch vulnscan.Mode(mode) {
+	case vulnscan.ModeBlock:
+		return errdefs.Errorf(errdefs.CategoryPolicy, "image blocked by vulnerability policy: %s", summary)
+	case vulnscan.ModePrompt:
+		fmt.Fprintf(os.Stderr, "Image has known vulnerabilities: %s\n", summary)
+		if !confirm("Continue anyway? [y/N] ") {
+			return errdefs.Errorf(errdefs.CategoryPolicy, "run cancelled because of vulnerabilities in %s", image)
+		}
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: image has known vulnerabilities: %s\n", summary)
+		return nil
+	}
+}
+
+// confirmOnTerminal asks a yes/no question on the terminal; without one the answer is no
+func confirmOnTerminal(prompt string) bool {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintf(os.Stderr, "No terminal to confirm on; not continuing\n")
+		return false
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/vulnscan"
+)
+
+type fakeImageScanner struct {
+	report  *vulnscan.Report
+	err     error
+	scanned []string
+}
+
+func (f *fakeImageScanner) Scan(image string) (*vulnscan.Report, error) {
+	f.scanned = append(f.scanned, image)
+	return f.report, f.err
+}
+
+func vulnerableReport() *vulnscan.Report {
+	return &vulnscan.Report{
+		Image:    "app:latest",
+		Scanner:  "trivy",
+		Findings: []vulnscan.Finding{{ID: "CVE-2024-0001", Package: "openssl", Severity: "CRITICAL"}},
+	}
+}
+
+func TestVulnerabilityGate(t *testing.T) {
+	never := func(string) bool { t.Error("unexpected prompt"); return false }
+
+	tests := []struct {
+		name     string
+		mode     string
+		scanner  *fakeImageScanner
+		confirm  func(string) bool
+		category errdefs.Category // empty when the run should continue
+	}{
+		{"off skips scanning", "off", &fakeImageScanner{err: errors.New("should not scan")}, never, ""},
+		{"unset skips scanning", "", &fakeImageScanner{err: errors.New("should not scan")}, never, ""},
+		{"invalid mode", "strict", &fakeImageScanner{}, never, errdefs.CategoryConfig},
+		{"clean image", "block", &fakeImageScanner{report: &vulnscan.Report{}}, never, ""},
+		{"warn continues", "warn", &fakeImageScanner{report: vulnerableReport()}, never, ""},
+		{"block refuses", "block", &fakeImageScanner{report: vulnerableReport()}, never, errdefs.CategoryPolicy},
+		{"prompt accepted", "prompt", &fakeImageScanner{report: vulnerableReport()}, func(string) bool { return true }, ""},
+		{"prompt declined", "prompt", &fakeImageScanner{report: vulnerableReport()}, func(string) bool { return false }, errdefs.CategoryPolicy},
+		{"scan failure warns", "warn", &fakeImageScanner{err: vulnscan.ErrNoScanner}, never, ""},
+		{"scan failure blocks in block mode", "block", &fakeImageScanner{err: vulnscan.ErrNoScanner}, never, errdefs.CategoryPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := vulnerabilityGate(tt.mode, "app:latest", tt.scanner, tt.confirm, false)
+			if tt.category == "" {
+				if err != nil {
+					t.Errorf("vulnerabilityGate() error = %v, want nil", err)
+				}
+				return
+			}
+			if got := errdefs.CategoryOf(err); got != tt.category {
+				t.Errorf("vulnerabilityGate() error = %v (category %s), want category %s", err, got, tt.category)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/obra/packnplay/pkg/compose"
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/docker"
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// defaultWarmJobs is how many projects Warm prepares at once by default
+const defaultWarmJobs = 4
+
+// WarmResult is the outcome of preparing one project's images
+type WarmResult struct {
+	Path     string        // project path as given
+	Images   []string      // images now available locally
+	Duration time.Duration // time spent on the project
+	Err      error
+}
+
+// quietClient runs pulls and builds without progress bars, whose redraws would
+// garble each other when several projects warm at once
+type quietClient struct {
+	DockerClient
+}
+
+func (c quietClient) RunWithProgress(imageName string, args ...string) error {
+	output, err := c.Run(args...)
+	if err == nil {
+		return nil
+	}
+	if len(args) > 0 && args[0] == "pull" {
+		// Keeps failed pulls retryable
+		return &docker.PullError{Err: err, Output: output}
+	}
+	return fmt.Errorf("%w\nDocker output:\n%s", err, output)
+}
+
+// Warm pulls and builds the images of the projects at paths ahead of time,
+// jobs projects at a time, so a later run starts without waiting. config
+// supplies the runtime and image settings; done is called as each project
+// finishes. Results are returned in the order of paths.
+func Warm(config *RunConfig, paths []string, jobs int, done func(WarmResult)) ([]WarmResult, error) {
+	dockerClient, err := newDockerClient(config.Runtime, config.Verbose)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryRuntimeUnavailable, "failed to initialize container runtime: %w", err)
+	}
+	if jobs <= 0 {
+		jobs = defaultWarmJobs
+	}
+
+	results := make([]WarmResult, len(paths))
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	slots := make(chan struct{}, jobs)
+	for i, path := range paths {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			start := time.Now()
+			images, err := warmProject(quietClient{dockerClient}, *config, path)
+			result := WarmResult{Path: path, Images: images, Duration: time.Since(start), Err: err}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = result
+			if done != nil {
+				done(result)
+			}
+		}(i, path)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// warmProject makes one project's images available: its devcontainer image
+// (built with its features), its sidecar service images, or its compose
+// services' images. initializeCommand is not run.
+func warmProject(dockerClient DockerClient, config RunConfig, path string) ([]string, error) {
+	config.Path = path
+	config.NoWorktree = true
+	config.DryRun = false
+
+	ws, err := ResolveWorkspace(&config)
+	if err != nil {
+		return nil, err
+	}
+	devConfig, err := ResolveConfig(&config, ws)
+	if err != nil {
+		return nil, err
+	}
+
+	if composeFiles := devConfig.GetDockerComposeFiles(); len(composeFiles) > 0 {
+		runner := compose.NewRunner(ws.MountPath, absoluteComposePaths(composeFiles, ws.MountPath), devConfig.Service, devConfig.RunServices, dockerClient, config.Verbose)
+		if err := runner.Pull(); err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryImagePull, "%w", err)
+		}
+		return nil, nil
+	}
+
+	lockfile, err := devcontainer.LoadLockFile(ws.MountPath)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryConfig, "failed to load lockfile: %w", err)
+	}
+	imageName, err := PrepareImage(dockerClient, &config, ws, devConfig, lockfile, nil)
+	if err != nil {
+		return nil, err
+	}
+	images := []string{imageName}
+
+	custom, err := devConfig.PacknplayCustomizations()
+	if err != nil {
+		return images, errdefs.Errorf(errdefs.CategoryConfig, "%w", err)
+	}
+	services := make([]string, 0, len(custom.Services))
+	for service := range custom.Services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		image := custom.Services[service].Image
+		if !config.RefreshImage {
+			if _, err := dockerClient.Run("image", "inspect", image); err == nil {
+				images = append(images, image)
+				continue
+			}
+		}
+		if output, err := dockerClient.Run("pull", image); err != nil {
+			return images, errdefs.Errorf(errdefs.CategoryImagePull, "failed to pull image %s for service %s: %w\nDocker output:\n%s", image, service, err, output)
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestWarmPreparesProjectsAndReportsFailures(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	good := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root", "customizations": {"packnplay": {"services": {"cache": {"image": "redis:7"}}}}}`)
+	broken := newProject(t, `{"image": `)
+
+	var mu sync.Mutex
+	var reported []string
+	results, err := Warm(&RunConfig{}, []string{good, broken}, 2, func(result WarmResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, result.Path)
+	})
+	if err != nil {
+		t.Fatalf("Warm() error = %v", err)
+	}
+	if len(results) != 2 || len(reported) != 2 {
+		t.Fatalf("results = %+v, reported = %v", results, reported)
+	}
+
+	if results[0].Path != good || results[0].Err != nil || !contains(results[0].Images, "alpine:3.20", "redis:7") {
+		t.Errorf("good project result = %+v", results[0])
+	}
+	if len(fake.CallsTo("pull", "alpine:3.20")) != 0 {
+		t.Error("an image already present shouldn't be pulled without RefreshImage")
+	}
+	if len(fake.CallsTo("pull", "redis:7")) != 1 {
+		t.Errorf("the service image should be pulled: %v", fake.Calls())
+	}
+	if results[1].Path != broken || results[1].Err == nil {
+		t.Errorf("broken project result = %+v, want an error", results[1])
+	}
+	if len(fake.CallsTo("run")) != 0 {
+		t.Error("warming shouldn't start containers")
+	}
+}
+
+func TestWarmRefreshesImages(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newProject(t, `{"image": "alpine:3.20", "remoteUser": "root"}`)
+
+	results, err := Warm(&RunConfig{RefreshImage: true}, []string{project}, 0, nil)
+	if err != nil || results[0].Err != nil {
+		t.Fatalf("Warm() = %+v, %v", results, err)
+	}
+	if len(fake.CallsTo("pull")) == 0 {
+		t.Errorf("RefreshImage should pull the image again: %v", fake.Calls())
+	}
+}
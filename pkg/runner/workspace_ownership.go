@@ -0,0 +1,122 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/errdefs"
+)
+
+// Workspace ownership modes: what a new container whose user doesn't own the
+// workspace does about it
+const (
+	OwnershipAuto  = "auto"  // trust the workspace in git and hand a cloned volume to the user, warn about bind mounts (default)
+	OwnershipRemap = "remap" // also change the user's UID/GID to the workspace owner's
+	OwnershipOff   = "off"   // don't check
+)
+
+// workspaceOwnership is who owns the workspace folder and who commands run as,
+// as seen inside the container
+type workspaceOwnership struct {
+	OwnerUID, OwnerGID int
+	UserUID            int
+}
+
+// inspectWorkspaceOwnership reads the workspace folder's owner and the UID of
+// the user commands run as (the image's default user when user is empty)
+func inspectWorkspaceOwnership(dockerClient DockerClient, containerID, user, workspace string) (workspaceOwnership, error) {
+	args := []string{"exec"}
+	if user != "" {
+		args = append(args, "-u", user)
+	}
+	args = append(args, containerID, "sh", "-c", `stat -c '%u %g' "$1" && id -u`, "sh", workspace)
+	output, err := dockerClient.Run(args...)
+	if err != nil {
+		return workspaceOwnership{}, fmt.Errorf("failed to check ownership of %s: %w\n%s", workspace, err, output)
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 3 {
+		return workspaceOwnership{}, fmt.Errorf("failed to check ownership of %s: unexpected output %q", workspace, output)
+	}
+	var ids [3]int
+	for i, field := range fields {
+		if ids[i], err = strconv.Atoi(field); err != nil {
+			return workspaceOwnership{}, fmt.Errorf("failed to check ownership of %s: unexpected output %q", workspace, output)
+		}
+	}
+	return workspaceOwnership{OwnerUID: ids[0], OwnerGID: ids[1], UserUID: ids[2]}, nil
+}
+
+// checkWorkspaceOwnership compares the workspace owner's UID with the UID
+// commands run as, before lifecycle commands start. A mismatch makes git
+// refuse the repository ("dubious ownership") and writes fail with EACCES, so
+// the workspace is added to git's safe.directory and, when it is a cloned
+// volume (packnplay's own copy), handed to the user. A bind-mounted host
+// directory is left alone: in remap mode the user's UID/GID change to the
+// owner's, otherwise the fixes are suggested.
+func checkWorkspaceOwnership(dockerClient DockerClient, mode, containerID, user, workspace string, volume bool, verbose bool) error {
+	switch mode {
+	case "", OwnershipAuto, OwnershipRemap:
+	case OwnershipOff:
+		return nil
+	default:
+		return errdefs.Errorf(errdefs.CategoryConfig, "invalid workspace_ownership mode %q (use auto, remap, or off)", mode)
+	}
+
+	ownership, err := inspectWorkspaceOwnership(dockerClient, containerID, user, workspace)
+	if err != nil {
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		return nil
+	}
+	if ownership.OwnerUID == ownership.UserUID {
+		return nil
+	}
+
+	name := user
+	if name == "" {
+		name = "the container user"
+	}
+	fmt.Fprintf(os.Stderr, "Note: %s is owned by UID %d but commands run as %s (UID %d)\n", workspace, ownership.OwnerUID, name, ownership.UserUID)
+
+	if err := addGitSafeDirectory(dockerClient, containerID, workspace); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "  Added %s to git's safe.directory, so git accepts the repository\n", workspace)
+	}
+
+	switch {
+	case volume:
+		// The volume holds packnplay's clone, not the user's files: take it over
+		owner := fmt.Sprintf("%d", ownership.UserUID)
+		if user != "" {
+			owner = user
+		}
+		if output, err := dockerClient.Run("exec", "-u", "root", containerID, "chown", "-R", owner, workspace); err != nil {
+			return fmt.Errorf("failed to give %s the workspace volume: %w\n%s", name, err, output)
+		}
+		fmt.Fprintf(os.Stderr, "  Gave the workspace volume to %s\n", name)
+	case mode == OwnershipRemap && ownership.UserUID != 0 && user != "" && user != "root":
+		if err := remapUserUID(dockerClient, containerID, user, ownership.OwnerUID, ownership.OwnerGID, verbose); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  Changed %s to UID %d GID %d\n", user, ownership.OwnerUID, ownership.OwnerGID)
+	case ownership.UserUID != 0:
+		fmt.Fprintf(os.Stderr, "  Writing to the workspace may fail with permission denied. To run as its owner, set \"updateRemoteUserUID\": true in devcontainer.json or workspace_ownership to remap in config.json\n")
+	}
+	return nil
+}
+
+// addGitSafeDirectory adds dir to the container's system-wide git
+// safe.directory list, once, if git is installed
+func addGitSafeDirectory(dockerClient DockerClient, containerID, dir string) error {
+	script := `command -v git >/dev/null 2>&1 || exit 0
+git config --system --get-all safe.directory 2>/dev/null | grep -qxF "$1" || git config --system --add safe.directory "$1"`
+	if output, err := dockerClient.Run("exec", "-u", "root", containerID, "sh", "-c", script, "sh", dir); err != nil {
+		return fmt.Errorf("failed to add %s to git's safe.directory: %w\n%s", dir, err, output)
+	}
+	return nil
+}
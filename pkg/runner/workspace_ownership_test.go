@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+// ownershipFake answers the ownership probe with the workspace owned by UID
+// 1000 and the user at userUID
+func ownershipFake(userUID string) (*dockertest.FakeClient, *dockertest.Container) {
+	fake := dockertest.New()
+	c := fake.AddContainer(dockertest.Container{Name: "dev", Running: true})
+	fake.Exec = func(c *dockertest.Container, args []string) (string, error) {
+		if len(args) > 2 && strings.Contains(args[2], "stat -c") {
+			return "1000 1000\n" + userUID + "\n", nil
+		}
+		return "", nil
+	}
+	return fake, c
+}
+
+func execCommands(fake *dockertest.FakeClient) []string {
+	var commands []string
+	for _, call := range fake.CallsTo("exec") {
+		commands = append(commands, strings.Join(call, " "))
+	}
+	return commands
+}
+
+func TestCheckWorkspaceOwnershipMatching(t *testing.T) {
+	fake, c := ownershipFake("1000")
+	if err := checkWorkspaceOwnership(fake, "", c.ID, "vscode", "/workspace", false, false); err != nil {
+		t.Fatalf("checkWorkspaceOwnership() error = %v", err)
+	}
+	if got := execCommands(fake); len(got) != 1 || !strings.Contains(got[0], "-u vscode") {
+		t.Errorf("exec calls = %v, want only the probe, as the user", got)
+	}
+}
+
+func TestCheckWorkspaceOwnershipRemediation(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		volume   bool
+		want     string
+		unwanted string
+	}{
+		{name: "bind mount", mode: OwnershipAuto, want: "safe.directory", unwanted: "usermod"},
+		{name: "remap", mode: OwnershipRemap, want: "usermod -u 1000 vscode", unwanted: "chown -R vscode"},
+		{name: "volume", mode: OwnershipAuto, volume: true, want: "chown -R vscode /workspace", unwanted: "usermod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, c := ownershipFake("1001")
+			if err := checkWorkspaceOwnership(fake, tt.mode, c.ID, "vscode", "/workspace", tt.volume, false); err != nil {
+				t.Fatalf("checkWorkspaceOwnership() error = %v", err)
+			}
+			got := strings.Join(execCommands(fake), "\n")
+			if !strings.Contains(got, "safe.directory") || !strings.Contains(got, tt.want) {
+				t.Errorf("exec calls = %s, want %q and the workspace added to safe.directory", got, tt.want)
+			}
+			if strings.Contains(got, tt.unwanted) {
+				t.Errorf("exec calls = %s, want no %q", got, tt.unwanted)
+			}
+		})
+	}
+}
+
+func TestCheckWorkspaceOwnershipOff(t *testing.T) {
+	fake, c := ownershipFake("1001")
+	if err := checkWorkspaceOwnership(fake, OwnershipOff, c.ID, "vscode", "/workspace", false, false); err != nil {
+		t.Fatalf("checkWorkspaceOwnership() error = %v", err)
+	}
+	if got := execCommands(fake); len(got) != 0 {
+		t.Errorf("exec calls = %v, want none", got)
+	}
+	if err := checkWorkspaceOwnership(fake, "sometimes", c.ID, "vscode", "/workspace", false, false); err == nil {
+		t.Error("checkWorkspaceOwnership() should reject an unknown mode")
+	}
+}
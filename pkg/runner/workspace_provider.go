@@ -0,0 +1,303 @@
+package runner
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/devcontainer"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/git"
+)
+
+// Workspace providers, recorded in Workspace.Provider
+const (
+	ProviderLocalDir    = "local-dir"    // the project directory itself
+	ProviderGitWorktree = "git-worktree" // a worktree of the project's repository
+	ProviderRemoteClone = "remote-clone" // a clone in a volume inside the container
+)
+
+// WorkspaceProvider supplies the workspace a run works in: a host directory to
+// mount, or a repository to clone into the container
+type WorkspaceProvider interface {
+	Name() string
+	Resolve(config *RunConfig) (*Workspace, error)
+}
+
+// workspaceProviderFor picks the provider for a run's flags
+func workspaceProviderFor(config *RunConfig) WorkspaceProvider {
+	switch {
+	case config.Repo != "" || config.CloneInVolume != "":
+		return remoteCloneProvider{}
+	case config.Ephemeral || config.NoWorktree:
+		return localDirProvider{}
+	default:
+		return gitWorktreeProvider{}
+	}
+}
+
+// ResolveWorkspace finds the project directory and the worktree to mount,
+// creating the worktree if it doesn't exist yet (except in a dry run)
+func ResolveWorkspace(config *RunConfig) (*Workspace, error) {
+	return workspaceProviderFor(config).Resolve(config)
+}
+
+// resolveProjectDir finds the project directory packnplay was run in, symlinks
+// resolved, and the subdirectory of it packnplay was run from when its
+// devcontainer.json is further up
+func resolveProjectDir(config *RunConfig) (string, string, error) {
+	// Determine working directory
+	workDir := config.Path
+	if workDir == "" {
+		var err error
+		workDir, err = os.Getwd()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get working directory: %w", err)
+		}
+	}
+
+	// Resolve symlinks to ensure consistent paths for container reconnection
+	resolvedWorkDir, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve symlinks in working directory: %w", err)
+	}
+	workDir = resolvedWorkDir
+
+	// Make absolute
+	workDir, err = filepath.Abs(workDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	// Run from a subdirectory of a project whose devcontainer.json is further
+	// up (a monorepo package): the project is the workspace, and sessions start
+	// in the subdirectory
+	var subdir string
+	root, err := findProjectRoot(workDir, config.DevcontainerSearch)
+	if err != nil {
+		return "", "", err
+	}
+	if root != "" && root != workDir {
+		subdir, err = filepath.Rel(root, workDir)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to resolve path: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Using %s; mounting %s as the workspace\n", devcontainer.ConfigFilePath(root), root)
+		workDir = root
+	}
+	return workDir, subdir, nil
+}
+
+// localDirProvider mounts the project directory as it is
+type localDirProvider struct{}
+
+func (localDirProvider) Name() string { return ProviderLocalDir }
+
+func (p localDirProvider) Resolve(config *RunConfig) (*Workspace, error) {
+	workDir, subdir, err := resolveProjectDir(config)
+	if err != nil {
+		return nil, err
+	}
+	return p.workspace(config, workDir, subdir), nil
+}
+
+func (localDirProvider) workspace(config *RunConfig, workDir, subdir string) *Workspace {
+	worktreeName := "no-worktree"
+	if config.Ephemeral {
+		// A name that can't clash with a real worktree's container
+		worktreeName = ephemeralWorktreeName()
+	}
+	return &Workspace{
+		Provider:     ProviderLocalDir,
+		WorkDir:      workDir,
+		MountPath:    workDir,
+		WorktreeName: worktreeName,
+		Subdir:       subdir,
+	}
+}
+
+// gitWorktreeProvider mounts a worktree of the project's repository, the
+// current branch's or --worktree's, creating it if needed. A project that
+// isn't a git repository is mounted as it is.
+type gitWorktreeProvider struct{}
+
+func (gitWorktreeProvider) Name() string { return ProviderGitWorktree }
+
+func (gitWorktreeProvider) Resolve(config *RunConfig) (*Workspace, error) {
+	workDir, subdir, err := resolveProjectDir(config)
+	if err != nil {
+		return nil, err
+	}
+	if !git.IsGitRepo(workDir) {
+		if config.Worktree != "" {
+			return nil, errdefs.Errorf(errdefs.CategoryWorktree, "--worktree specified but %s is not a git repository", workDir)
+		}
+		// Not a git repo and no worktree flag: use directly
+		return localDirProvider{}.workspace(config, workDir, subdir), nil
+	}
+
+	var worktreeName string
+	if config.Worktree != "" {
+		worktreeName = config.Worktree
+	} else {
+		// Auto-detect from current branch
+		branch, err := git.GetCurrentBranch(workDir)
+		if err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryWorktree, "failed to get current branch: %w", err)
+		}
+		worktreeName = branch
+	}
+
+	// Check if worktree exists
+	exists, err := git.WorktreeExists(workDir, worktreeName)
+	if err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryWorktree, "failed to check worktree: %w", err)
+	}
+
+	var mountPath string
+	if exists {
+		// Worktree already exists - just use it
+		mountPath, err = git.GetWorktreePath(workDir, worktreeName)
+		if err != nil {
+			return nil, errdefs.Errorf(errdefs.CategoryWorktree, "failed to get worktree path: %w", err)
+		}
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Using existing worktree at %s\n", mountPath)
+		}
+	} else {
+		// Create worktree
+		opts, err := worktreeOptions(config.WorktreeSettings)
+		if err != nil {
+			return nil, err
+		}
+		mountPath, err = newWorktreePath(config.WorktreeSettings, workDir, worktreeName)
+		if err != nil {
+			return nil, err
+		}
+		if fileExists(mountPath) {
+			// e.g. feature/auth's worktree, when creating feature-auth's
+			return nil, errdefs.Errorf(errdefs.CategoryWorktree, "cannot create the worktree of %s: %s already exists (is it another branch's worktree?)", worktreeName, mountPath)
+		}
+		if config.Verbose {
+			fmt.Fprintf(os.Stderr, "Creating worktree at %s\n", mountPath)
+			if opts.From != "" && git.BranchExists(workDir, worktreeName) {
+				fmt.Fprintf(os.Stderr, "Branch %s already exists; not starting it from %s\n", worktreeName, opts.From)
+			}
+		}
+
+		if !config.DryRun {
+			if err := git.CreateWorktree(workDir, mountPath, worktreeName, opts, config.Verbose); err != nil {
+				return nil, errdefs.Errorf(errdefs.CategoryWorktree, "failed to create worktree: %w", err)
+			}
+		}
+	}
+
+	// Get main repo's .git directory for mounting
+	// Resolve the real path (follow symlinks) to ensure .git paths match
+	realWorkDir, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		realWorkDir = workDir // Fallback if can't resolve
+	}
+
+	return &Workspace{
+		Provider:       ProviderGitWorktree,
+		WorkDir:        workDir,
+		MountPath:      mountPath,
+		WorktreeName:   worktreeName,
+		MainRepoGitDir: filepath.Join(realWorkDir, ".git"),
+		Subdir:         subdir,
+	}, nil
+}
+
+// remoteCloneProvider clones a repository into a volume inside the container,
+// mounting nothing from the host: the project's origin remote with
+// --clone-in-volume, or any repository with --repo
+type remoteCloneProvider struct{}
+
+func (remoteCloneProvider) Name() string { return ProviderRemoteClone }
+
+func (p remoteCloneProvider) Resolve(config *RunConfig) (*Workspace, error) {
+	if config.Repo != "" {
+		return p.resolveRepo(config)
+	}
+
+	workDir, subdir, err := resolveProjectDir(config)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing is checked out on the host; the repository is cloned into a volume
+	volume, worktreeName, err := resolveCloneVolume(workDir, config.CloneInVolume)
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{
+		Provider:     ProviderRemoteClone,
+		WorkDir:      workDir,
+		MountPath:    workDir,
+		WorktreeName: worktreeName,
+		Subdir:       subdir,
+		Volume:       volume,
+	}, nil
+}
+
+// remoteConfigPaths are the only files of a --repo repository checked out on
+// the host, to read its devcontainer configuration
+var remoteConfigPaths = []string{"/.devcontainer/", "/.devcontainer.json"}
+
+// resolveRepo fetches the devcontainer configuration of the --repo repository
+// into a cached checkout on the host, which stands in for the project
+// directory, and clones the whole repository into a volume
+func (remoteCloneProvider) resolveRepo(config *RunConfig) (*Workspace, error) {
+	if isLocalRemote(config.Repo) {
+		return nil, errdefs.Errorf(errdefs.CategoryUsage, "--repo %s is a host path the container can't clone from; run packnplay in it instead", config.Repo)
+	}
+	workDir, err := remoteCheckoutDir(config.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if config.Verbose {
+		fmt.Fprintf(os.Stderr, "Fetching the devcontainer configuration of %s into %s\n", config.Repo, workDir)
+	}
+	if err := git.SparseFetch(workDir, config.Repo, config.Branch, remoteConfigPaths, config.Verbose); err != nil {
+		return nil, errdefs.Errorf(errdefs.CategoryWorktree, "failed to read the devcontainer configuration of %s: %w", config.Repo, err)
+	}
+
+	volume, worktreeName := newCloneVolume(workDir, config.Repo, config.Branch)
+	return &Workspace{
+		Provider:     ProviderRemoteClone,
+		WorkDir:      workDir,
+		MountPath:    workDir,
+		WorktreeName: worktreeName,
+		Volume:       volume,
+	}, nil
+}
+
+// remoteCheckoutDir is where the devcontainer configuration of the repository
+// at repoURL is checked out, named after its host and path so that two
+// repositories don't share one and the container is named after the repository
+func remoteCheckoutDir(repoURL string) (string, error) {
+	cacheDir, err := userCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	location := repoURL
+	if parsed, err := url.Parse(repoURL); err == nil && parsed.Host != "" {
+		location = parsed.Host + "/" + parsed.Path
+	} else if _, rest, ok := strings.Cut(repoURL, "@"); ok {
+		// scp-like syntax: git@github.com:org/repo.git
+		location = strings.Replace(rest, ":", "/", 1)
+	}
+	var parts []string
+	for _, part := range strings.Split(strings.TrimSuffix(strings.TrimSuffix(location, "/"), ".git"), "/") {
+		if part = strings.Trim(unsafePathChars.ReplaceAllString(part, "-"), "-."); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", errdefs.Errorf(errdefs.CategoryUsage, "--repo %s is not a repository URL", repoURL)
+	}
+	return filepath.Join(append([]string{cacheDir, "packnplay", "repos"}, parts...)...), nil
+}
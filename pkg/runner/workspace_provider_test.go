@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspaceProviderFor(t *testing.T) {
+	for _, tc := range []struct {
+		config RunConfig
+		want   string
+	}{
+		{RunConfig{}, ProviderGitWorktree},
+		{RunConfig{Worktree: "feature"}, ProviderGitWorktree},
+		{RunConfig{NoWorktree: true}, ProviderLocalDir},
+		{RunConfig{Ephemeral: true}, ProviderLocalDir},
+		{RunConfig{CloneInVolume: CloneCurrentBranch}, ProviderRemoteClone},
+		{RunConfig{Repo: "https://github.com/acme/api.git"}, ProviderRemoteClone},
+	} {
+		if got := workspaceProviderFor(&tc.config).Name(); got != tc.want {
+			t.Errorf("workspaceProviderFor(%+v) = %s, want %s", tc.config, got, tc.want)
+		}
+	}
+}
+
+func TestRemoteCheckoutDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/cache")
+	repos := filepath.Join("/cache", "packnplay", "repos")
+	for repoURL, want := range map[string]string{
+		"https://github.com/acme/api.git":          filepath.Join(repos, "github.com", "acme", "api"),
+		"https://user@github.com/acme/api":         filepath.Join(repos, "github.com", "acme", "api"),
+		"git@github.com:acme/api.git":              filepath.Join(repos, "github.com", "acme", "api"),
+		"ssh://git@git.corp:2222/team/sub/api.git": filepath.Join(repos, "git.corp-2222", "team", "sub", "api"),
+		"https://gitlab.com/acme/../api.git/":      filepath.Join(repos, "gitlab.com", "acme", "api"),
+	} {
+		got, err := remoteCheckoutDir(repoURL)
+		if err != nil || got != want {
+			t.Errorf("remoteCheckoutDir(%q) = %q, %v, want %q", repoURL, got, err, want)
+		}
+	}
+	if _, err := remoteCheckoutDir("::"); err == nil {
+		t.Error("remoteCheckoutDir() should reject a URL without a path")
+	}
+}
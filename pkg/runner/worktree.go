@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/errdefs"
+	"github.com/obra/packnplay/pkg/git"
+)
+
+// Worktree track modes: whether a new worktree's branch follows a remote branch
+const (
+	WorktreeTrackAuto = "auto" // a branch a remote already has is checked out tracking it (default)
+	WorktreeTrackOff  = "off"  // new branches always start from HEAD or worktree.from
+)
+
+// worktreeOptions returns how a worktree's branch is created when it doesn't exist yet
+func worktreeOptions(settings config.WorktreeConfig) (git.WorktreeOptions, error) {
+	switch settings.Track {
+	case "", WorktreeTrackAuto, WorktreeTrackOff:
+	default:
+		return git.WorktreeOptions{}, errdefs.Errorf(errdefs.CategoryConfig, "invalid worktree.track %q (use auto or off)", settings.Track)
+	}
+	return git.WorktreeOptions{From: settings.From, Track: settings.Track != WorktreeTrackOff}, nil
+}
+
+// newWorktreePath returns where the worktree of a branch is created: the
+// worktree.path template, or the XDG data directory
+func newWorktreePath(settings config.WorktreeConfig, projectPath, worktreeName string) (string, error) {
+	if settings.Path == "" {
+		return git.DetermineWorktreePath(projectPath, worktreeName), nil
+	}
+	path, err := git.ExpandWorktreePath(settings.Path, projectPath, worktreeName)
+	if err != nil {
+		return "", errdefs.New(errdefs.CategoryConfig, err)
+	}
+	return path, nil
+}
+
+// checkContainerWorktree fails when the container named after a worktree
+// belongs to another one: container names can't hold slashes, so branches such
+// as feature/auth and feature-auth map to the same name
+func checkContainerWorktree(dockerClient DockerClient, containerName, worktreeName string) error {
+	if !runtimeSupports(dockerClient).Inspect {
+		return nil
+	}
+	output, err := dockerClient.Run("inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", container.LabelWorktree), containerName)
+	if err != nil {
+		return nil // no such container
+	}
+	owner := strings.TrimSpace(output)
+	if owner == "" || owner == "<no value>" || owner == worktreeName {
+		return nil
+	}
+	return errdefs.Errorf(errdefs.CategoryWorktree, "container %s belongs to worktree %q, whose name maps to the same container name as %q; stop it first (packnplay stop --worktree=%s) or use another branch name", containerName, owner, worktreeName, owner)
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obra/packnplay/pkg/config"
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/docker/dockertest"
+)
+
+func TestRunCreatesWorktreeFromPathTemplate(t *testing.T) {
+	fake := dockertest.New()
+	fake.AddImage(dockertest.Image{Name: "alpine:3.20"})
+	useFakeRuntime(t, fake)
+	project := newRepoProject(t, `{"image": "alpine:3.20"}`, "https://github.com/me/app.git")
+	for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"}} {
+		if output, err := exec.Command("git", append([]string{"-C", project}, args...)...).CombinedOutput(); err != nil {
+			t.Skipf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	settings := config.WorktreeConfig{Path: "../{project}-worktrees/{branch}"}
+
+	if err := Run(&RunConfig{Path: project, Worktree: "feature/auth", Command: []string{"bash"}, WorktreeSettings: settings}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	worktree := filepath.Join(filepath.Dir(project), filepath.Base(project)+"-worktrees", "feature-auth")
+	c := fake.Container(container.GenerateContainerName(project, "feature/auth"))
+	if c == nil || !contains(c.RunArgs, "-v "+worktree+":"+worktree) {
+		t.Fatalf("container = %+v, want %s mounted", c, worktree)
+	}
+
+	// feature-auth's worktree would be the same directory
+	err := Run(&RunConfig{Path: project, Worktree: "feature-auth", Command: []string{"bash"}, WorktreeSettings: settings})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Run(feature-auth) error = %v, want the worktree path clash reported", err)
+	}
+}
+
+func TestCheckContainerWorktree(t *testing.T) {
+	fake := dockertest.New()
+	name := container.GenerateContainerName("/src/app", "feature/auth")
+	fake.AddContainer(dockertest.Container{Name: name, Labels: map[string]string{container.LabelWorktree: "feature/auth"}})
+
+	if err := checkContainerWorktree(fake, name, "feature/auth"); err != nil {
+		t.Errorf("checkContainerWorktree() for the container's own worktree = %v", err)
+	}
+	if err := checkContainerWorktree(fake, name, "feature-auth"); err == nil || !strings.Contains(err.Error(), `"feature/auth"`) {
+		t.Errorf("checkContainerWorktree() for a clashing worktree = %v, want an error naming the owner", err)
+	}
+	if err := checkContainerWorktree(fake, "packnplay-app-other", "other"); err != nil {
+		t.Errorf("checkContainerWorktree() without a container = %v", err)
+	}
+}
+
+func TestWorktreeOptions(t *testing.T) {
+	opts, err := worktreeOptions(config.WorktreeConfig{From: "origin/main"})
+	if err != nil || opts.From != "origin/main" || !opts.Track {
+		t.Errorf("worktreeOptions() = %+v, %v; want tracking by default", opts, err)
+	}
+	if opts, _ := worktreeOptions(config.WorktreeConfig{Track: WorktreeTrackOff}); opts.Track {
+		t.Error("worktreeOptions() with track off should not track")
+	}
+	if _, err := worktreeOptions(config.WorktreeConfig{Track: "always"}); err == nil {
+		t.Error("worktreeOptions() should reject an unknown track mode")
+	}
+}
@@ -0,0 +1,384 @@
+// Package selfupdate finds packnplay releases on GitHub and replaces the running
+// binary with a release archive whose checksum has been verified.
+package selfupdate
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release channels
+const (
+	ChannelStable = "stable" // published releases only
+	ChannelBeta   = "beta"   // also prereleases
+)
+
+// DefaultRepo is the GitHub repository packnplay is released from
+const DefaultRepo = "obra/packnplay"
+
+// checksumsAsset is the checksum file goreleaser publishes with each release
+const checksumsAsset = "checksums.txt"
+
+// maxDownloadSize bounds release downloads
+const maxDownloadSize = 256 << 20
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Release is a GitHub release
+type Release struct {
+	Tag        string  `json:"tag_name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
+}
+
+// Version returns the release version without a leading v
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+// asset returns the asset with the given name
+func (r *Release) asset(name string) (Asset, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Asset{}, false
+}
+
+// ValidChannel returns an error for unknown channels; empty means stable
+func ValidChannel(channel string) error {
+	switch channel {
+	case "", ChannelStable, ChannelBeta:
+		return nil
+	}
+	return fmt.Errorf("unknown release channel %q (use %s or %s)", channel, ChannelStable, ChannelBeta)
+}
+
+// Client looks up and downloads releases
+type Client struct {
+	http    *http.Client
+	baseURL string // GitHub API URL
+	repo    string
+}
+
+// NewClient creates a Client for DefaultRepo
+func NewClient(timeout time.Duration) *Client {
+	return &Client{
+		http:    &http.Client{Timeout: timeout},
+		baseURL: "https://api.github.com",
+		repo:    DefaultRepo,
+	}
+}
+
+// Latest returns the newest release on channel
+func (c *Client) Latest(channel string) (*Release, error) {
+	if err := ValidChannel(channel); err != nil {
+		return nil, err
+	}
+
+	data, err := c.get(fmt.Sprintf("%s/repos/%s/releases?per_page=30", c.baseURL, c.repo), "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	var releases []Release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("failed to parse releases: %w", err)
+	}
+
+	var latest *Release
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || (r.Prerelease && channel != ChannelBeta) {
+			continue
+		}
+		if latest == nil || CompareVersions(r.Tag, latest.Tag) > 0 {
+			latest = r
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no releases found on the %s channel", channelName(channel))
+	}
+	return latest, nil
+}
+
+// Download fetches the release archive for goos/goarch, verifies it against the
+// release's checksums.txt, and returns the packnplay binary inside it
+func (c *Client) Download(release *Release, goos, goarch string) ([]byte, error) {
+	name := ArchiveName(release.Version(), goos, goarch)
+	archive, ok := release.asset(name)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no archive for %s/%s (expected %s)", release.Tag, goos, goarch, name)
+	}
+	checksums, ok := release.asset(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s; refusing to install an unverified binary", release.Tag, checksumsAsset)
+	}
+
+	sums, err := c.get(checksums.URL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", checksumsAsset, err)
+	}
+	want, err := lookupChecksum(sums, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.get(archive.URL, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, got, want)
+	}
+
+	return extractBinary(data, "packnplay")
+}
+
+// get fetches url, failing on non-2xx responses
+func (c *Client) get(url, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, maxDownloadSize)
+	}
+	return data, nil
+}
+
+// ArchiveName returns the release archive name goreleaser uses for goos/goarch,
+// e.g. packnplay_1.2.0_Linux_x86_64.tar.gz
+func ArchiveName(version, goos, goarch string) string {
+	osName := goos
+	if osName != "" {
+		osName = strings.ToUpper(osName[:1]) + osName[1:]
+	}
+	arch := goarch
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "386":
+		arch = "i386"
+	}
+	return fmt.Sprintf("packnplay_%s_%s_%s.tar.gz", version, osName, arch)
+}
+
+// lookupChecksum finds name's sha256 in a checksums.txt ("<hex>  <name>" lines)
+func lookupChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// extractBinary returns the regular file named binary from a .tar.gz archive
+func extractBinary(archive []byte, binary string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive has no %s binary", binary)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == binary {
+			return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		}
+	}
+}
+
+// Install atomically replaces the executable at exePath (following symlinks)
+// with binary, keeping its file mode
+func Install(exePath string, binary []byte) error {
+	target, err := filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", exePath, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", target, err)
+	}
+
+	// Write next to the target so the rename stays on one filesystem
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".packnplay-update-*")
+	if err != nil {
+		if os.IsPermission(err) {
+			return fmt.Errorf("no permission to replace %s (try again with sudo, or reinstall where you can write): %w", target, err)
+		}
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	if _, err := tmp.Write(binary); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	if err := os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to make update executable: %w", err)
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	return nil
+}
+
+// IsNewer reports whether candidate is a newer version than current. Development
+// builds ("dev") and other unparsable versions are never considered outdated.
+func IsNewer(current, candidate string) bool {
+	if _, ok := parseVersion(current); !ok {
+		return false
+	}
+	return CompareVersions(candidate, current) > 0
+}
+
+// CompareVersions compares semantic versions (with or without a leading v),
+// returning -1, 0 or 1. A prerelease sorts before its release; unparsable
+// versions sort before parsable ones.
+func CompareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+
+	for i := 0; i < 3; i++ {
+		if va.core[i] != vb.core[i] {
+			return compareInts(va.core[i], vb.core[i])
+		}
+	}
+	switch {
+	case va.pre == "" && vb.pre == "":
+		return 0
+	case va.pre == "":
+		return 1
+	case vb.pre == "":
+		return -1
+	}
+	return comparePrerelease(va.pre, vb.pre)
+}
+
+type version struct {
+	core [3]int
+	pre  string
+}
+
+// parseVersion parses MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]
+func parseVersion(s string) (version, bool) {
+	s = strings.TrimPrefix(s, "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, pre, _ := strings.Cut(s, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return version{}, false
+	}
+	var v version
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v.core[i] = n
+	}
+	v.pre = pre
+	return v, true
+}
+
+// comparePrerelease compares dot-separated prerelease identifiers per semver
+func comparePrerelease(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return compareInts(na, nb)
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			if c := strings.Compare(pa[i], pb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(pa), len(pb))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// channelName returns the display name of channel, which defaults to stable
+func channelName(channel string) string {
+	if channel == "" {
+		return ChannelStable
+	}
+	return channel
+}
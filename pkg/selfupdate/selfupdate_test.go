@@ -0,0 +1,199 @@
+package selfupdate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.0", "1.2.0", 0},
+		{"v1.10.0", "v1.9.3", 1},
+		{"v1.2.0-beta.1", "v1.2.0", -1},
+		{"v1.2.0-beta.2", "v1.2.0-beta.10", -1},
+		{"v1.2.0-beta.1", "v1.2.0-alpha.5", 1},
+		{"v2.0.0", "dev", 1},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if IsNewer("dev", "v9.9.9") {
+		t.Error("development builds should never be reported as outdated")
+	}
+	if !IsNewer("1.2.0", "v1.3.0-beta.1") || IsNewer("v1.3.0", "v1.3.0") {
+		t.Error("IsNewer() compared versions incorrectly")
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	if got := ArchiveName("1.2.0", "linux", "amd64"); got != "packnplay_1.2.0_Linux_x86_64.tar.gz" {
+		t.Errorf("ArchiveName() = %s", got)
+	}
+	if got := ArchiveName("1.2.0", "darwin", "arm64"); got != "packnplay_1.2.0_Darwin_arm64.tar.gz" {
+		t.Errorf("ArchiveName() = %s", got)
+	}
+}
+
+// newTestReleases serves a releases listing with a stable and a beta release
+// whose archives contain a packnplay binary; corrupt breaks the archive checksum
+func newTestReleases(t *testing.T, corrupt bool) *Client {
+	t.Helper()
+	archive := tarGz(t, "packnplay", []byte("#!/bin/sh\necho new\n"))
+	name := ArchiveName("1.3.0", "linux", "amd64")
+	sum := sha256.Sum256(archive)
+	checksums := fmt.Sprintf("%s  %s\n%s  packnplay_1.3.0_Darwin_arm64.tar.gz\n", hex.EncodeToString(sum[:]), name, strings.Repeat("0", 64))
+	if corrupt {
+		archive = append(archive, 0)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/obra/packnplay/releases":
+			fmt.Fprintf(w, `[
+				{"tag_name": "v1.4.0-beta.1", "prerelease": true, "assets": []},
+				{"tag_name": "v1.5.0", "draft": true, "assets": []},
+				{"tag_name": "v1.3.0", "assets": [
+					{"name": %q, "browser_download_url": "%s/download/archive"},
+					{"name": "checksums.txt", "browser_download_url": "%s/download/checksums"}
+				]},
+				{"tag_name": "v1.2.0", "assets": []}
+			]`, name, server.URL, server.URL)
+		case "/download/archive":
+			w.Write(archive)
+		case "/download/checksums":
+			w.Write([]byte(checksums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &Client{http: server.Client(), baseURL: server.URL, repo: DefaultRepo}
+}
+
+func TestLatest(t *testing.T) {
+	c := newTestReleases(t, false)
+
+	stable, err := c.Latest(ChannelStable)
+	if err != nil {
+		t.Fatalf("Latest(stable) error = %v", err)
+	}
+	if stable.Tag != "v1.3.0" {
+		t.Errorf("Latest(stable) = %s, want v1.3.0 (no drafts or prereleases)", stable.Tag)
+	}
+
+	beta, err := c.Latest(ChannelBeta)
+	if err != nil {
+		t.Fatalf("Latest(beta) error = %v", err)
+	}
+	if beta.Tag != "v1.4.0-beta.1" {
+		t.Errorf("Latest(beta) = %s, want v1.4.0-beta.1", beta.Tag)
+	}
+
+	if _, err := c.Latest("nightly"); err == nil {
+		t.Error("Latest() should reject unknown channels")
+	}
+}
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	c := newTestReleases(t, false)
+	release, err := c.Latest(ChannelStable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary, err := c.Download(release, "linux", "amd64")
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if string(binary) != "#!/bin/sh\necho new\n" {
+		t.Errorf("Download() = %q", binary)
+	}
+
+	if _, err := c.Download(release, "windows", "amd64"); err == nil {
+		t.Error("Download() should fail without an archive for the platform")
+	}
+
+	corrupt := newTestReleases(t, true)
+	release, err = corrupt.Latest(ChannelStable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := corrupt.Download(release, "linux", "amd64"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Download() error = %v, want checksum mismatch", err)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "packnplay")
+	if err := os.WriteFile(exe, []byte("old"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(exe, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(link, []byte("new")); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil || string(data) != "new" {
+		t.Errorf("binary = %q, %v; want the symlink target replaced", data, err)
+	}
+	info, err := os.Stat(exe)
+	if err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("mode = %v, want 0750 kept", info.Mode())
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Error("symlink should be left in place")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("directory has %d entries, want no leftover temp files", len(entries))
+	}
+}
+
+func tarGz(t *testing.T, name string, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"README.md", []byte("readme")}, {name, content}} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0755, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,507 @@
+// Package snapshot checkpoints packnplay containers with docker commit and
+// restores them into new containers.
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/container"
+	"github.com/obra/packnplay/pkg/credstore"
+)
+
+// Labels added to snapshot images (and inherited by restored containers)
+const (
+	LabelName   = "packnplay-snapshot"
+	LabelSource = "packnplay-snapshot-source"
+)
+
+const (
+	manifestFile  = "snapshot.json"
+	metadataFile  = "metadata.json"
+	workspaceFile = "workspace.tar"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+
+// Runner runs container runtime commands (satisfied by *docker.Client)
+type Runner interface {
+	Run(args ...string) (string, error)
+}
+
+// Snapshot describes a committed container checkpoint
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	Created   time.Time `json:"created"`
+	HostPath  string    `json:"host_path,omitempty"`
+	Binds     []string  `json:"binds,omitempty"`
+	Workspace []string  `json:"workspace,omitempty"` // dirty workspace files archived with the snapshot
+}
+
+// CreateOptions controls what is captured besides the container filesystem
+type CreateOptions struct {
+	Workspace bool     // archive modified and untracked files from the host workspace
+	Metadata  []byte   // lifecycle metadata to keep alongside the image
+	Exclude   []string // container files kept out of the image, such as credentials copied in
+}
+
+// RestoreOptions controls how a snapshot is brought back
+type RestoreOptions struct {
+	ContainerName string // name for the new container
+	Workspace     bool   // extract archived workspace files back into the host path
+}
+
+// Store keeps snapshot manifests on disk and images in the container runtime
+type Store struct {
+	dir    string
+	client Runner
+}
+
+// NewStore creates a store rooted at dir
+func NewStore(dir string, client Runner) *Store {
+	return &Store{dir: dir, client: client}
+}
+
+// DefaultDir returns $XDG_DATA_HOME/packnplay/snapshots
+func DefaultDir() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "packnplay", "snapshots")
+}
+
+// DefaultName returns a timestamp-based snapshot name
+func DefaultName(now time.Time) string {
+	return now.Format("20060102-150405")
+}
+
+// ValidateName checks that name can be used as an image tag
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q: use letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// ImageRef returns the image reference a snapshot is committed to
+func ImageRef(containerName, name string) string {
+	return fmt.Sprintf("packnplay-snapshot/%s:%s", strings.ToLower(containerName), name)
+}
+
+// containerInfo is the subset of docker inspect output a snapshot needs
+type containerInfo struct {
+	ID     string `json:"Id"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	HostConfig struct {
+		Binds []string `json:"Binds"`
+	} `json:"HostConfig"`
+}
+
+func (s *Store) snapshotDir(containerName, name string) string {
+	return filepath.Join(s.dir, containerName, name)
+}
+
+// Create commits the container's filesystem to a local image and records the snapshot
+func (s *Store) Create(containerName, name string, opts CreateOptions) (*Snapshot, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	dir := s.snapshotDir(containerName, name)
+	if _, err := os.Stat(filepath.Join(dir, manifestFile)); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists for %s", name, containerName)
+	}
+
+	output, err := s.client.Run("inspect", "--type", "container", "--format", "{{json .}}", containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w\nDocker output:\n%s", containerName, err, output)
+	}
+	var info containerInfo
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse container details: %w", err)
+	}
+
+	snap := &Snapshot{
+		Name:      name,
+		Container: containerName,
+		Image:     ImageRef(containerName, name),
+		Created:   time.Now(),
+		HostPath:  container.GetHostPathFromLabels(info.Config.Labels),
+		Binds:     info.HostConfig.Binds,
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	if opts.Workspace {
+		if snap.HostPath == "" {
+			return nil, fmt.Errorf("container %s has no host path label; can't archive its workspace", containerName)
+		}
+		files, err := DirtyFiles(snap.HostPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeArchive(filepath.Join(dir, workspaceFile), snap.HostPath, files); err != nil {
+			return nil, err
+		}
+		snap.Workspace = files
+	}
+
+	if len(opts.Metadata) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, metadataFile), opts.Metadata, 0644); err != nil {
+			return nil, fmt.Errorf("failed to save lifecycle metadata: %w", err)
+		}
+	}
+
+	putBack, err := s.setAside(containerName, opts.Exclude)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	output, err = s.client.Run("commit",
+		"--change", fmt.Sprintf("LABEL %s=%s", LabelName, name),
+		"--change", fmt.Sprintf("LABEL %s=%s", LabelSource, containerName),
+		containerName, snap.Image)
+	if putBackErr := putBack(); putBackErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", putBackErr)
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to commit container %s: %w\nDocker output:\n%s", containerName, err, output)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFile), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+
+	return snap, nil
+}
+
+// setAside moves paths out of the container for a commit, into a directory
+// only the user can read in the RAM-backed runtime directory, and returns the
+// function putting them back with their owner and mode. Paths that don't exist
+// are skipped; one that can't be moved fails the snapshot rather than end up
+// in the image.
+func (s *Store) setAside(containerName string, paths []string) (putBack func() error, err error) {
+	type asideFile struct{ path, local, owner, mode string }
+	var aside []asideFile
+	var stash string
+	putBack = func() error {
+		var failed []string
+		for _, f := range aside {
+			if _, err := s.client.Run("cp", f.local, containerName+":"+f.path); err != nil {
+				failed = append(failed, f.path)
+				continue
+			}
+			_, _ = s.client.Run("exec", "-u", "root", containerName, "chown", f.owner, "--", f.path)
+			_, _ = s.client.Run("exec", "-u", "root", containerName, "chmod", f.mode, "--", f.path)
+		}
+		if stash != "" {
+			_ = os.RemoveAll(stash)
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to put %s back into %s; restart the container to have them injected again", strings.Join(failed, ", "), containerName)
+		}
+		return nil
+	}
+	if len(paths) == 0 {
+		return putBack, nil
+	}
+	defer func() {
+		if err != nil {
+			_ = putBack()
+		}
+	}()
+
+	runtimeDir, err := credstore.EnsureRuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	if stash, err = os.MkdirTemp(runtimeDir, "snapshot-*"); err != nil {
+		return nil, fmt.Errorf("failed to create a directory to set credentials aside in: %w", err)
+	}
+	for i, path := range paths {
+		stat, err := s.client.Run("exec", "-u", "root", containerName, "stat", "-c", "%u:%g %a", "--", path)
+		owner, mode, ok := strings.Cut(strings.TrimSpace(stat), " ")
+		if err != nil || !ok {
+			if _, err := s.client.Run("exec", "-u", "root", containerName, "test", "-e", path); err != nil {
+				continue // already gone
+			}
+			return nil, fmt.Errorf("failed to inspect %s in %s; not committing it into the snapshot", path, containerName)
+		}
+		local := filepath.Join(stash, fmt.Sprint(i))
+		if output, err := s.client.Run("cp", containerName+":"+path, local); err != nil {
+			return nil, fmt.Errorf("failed to set %s aside: %w\nDocker output:\n%s", path, err, output)
+		}
+		aside = append(aside, asideFile{path: path, local: local, owner: owner, mode: mode})
+		if output, err := s.client.Run("exec", "-u", "root", containerName, "rm", "-f", "--", path); err != nil {
+			return nil, fmt.Errorf("failed to keep %s out of the snapshot: %w\nDocker output:\n%s", path, err, output)
+		}
+	}
+	return putBack, nil
+}
+
+// List returns snapshots sorted oldest first, optionally limited to one container
+func (s *Store) List(containerName string) ([]Snapshot, error) {
+	pattern := filepath.Join(s.dir, "*", "*", manifestFile)
+	if containerName != "" {
+		pattern = filepath.Join(s.dir, containerName, "*", manifestFile)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, file := range files {
+		snap, err := readManifest(file)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, *snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// Get returns a snapshot by container and name
+func (s *Store) Get(containerName, name string) (*Snapshot, error) {
+	snap, err := readManifest(filepath.Join(s.snapshotDir(containerName, name), manifestFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %s not found for %s", name, containerName)
+	}
+	return snap, err
+}
+
+// Find looks a snapshot up by name across all containers, failing if the name is ambiguous
+func (s *Store) Find(name string) (*Snapshot, error) {
+	all, err := s.List("")
+	if err != nil {
+		return nil, err
+	}
+	var matches []Snapshot
+	for _, snap := range all {
+		if snap.Name == name {
+			matches = append(matches, snap)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("snapshot %s not found", name)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("snapshot name %s exists for several containers; pass --container", name)
+	}
+}
+
+// Metadata returns the lifecycle metadata saved with a snapshot, if any
+func (s *Store) Metadata(snap *Snapshot) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.snapshotDir(snap.Container, snap.Name), metadataFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Restore starts a new container from a snapshot image and returns its ID
+func (s *Store) Restore(snap *Snapshot, opts RestoreOptions) (string, error) {
+	args := []string{"run", "-d", "--name", opts.ContainerName}
+	for _, bind := range snap.Binds {
+		args = append(args, "-v", bind)
+	}
+	args = append(args, snap.Image)
+
+	output, err := s.client.Run(args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to start container from snapshot %s: %w\nDocker output:\n%s", snap.Name, err, output)
+	}
+	containerID := strings.TrimSpace(output)
+
+	if opts.Workspace && len(snap.Workspace) > 0 {
+		archive := filepath.Join(s.snapshotDir(snap.Container, snap.Name), workspaceFile)
+		if err := extractArchive(archive, snap.HostPath); err != nil {
+			return containerID, err
+		}
+	}
+
+	return containerID, nil
+}
+
+// Delete removes a snapshot's image and manifest
+func (s *Store) Delete(snap *Snapshot) error {
+	if output, err := s.client.Run("rmi", snap.Image); err != nil && !strings.Contains(output, "No such image") {
+		return fmt.Errorf("failed to remove image %s: %w\nDocker output:\n%s", snap.Image, err, output)
+	}
+	return os.RemoveAll(s.snapshotDir(snap.Container, snap.Name))
+}
+
+func readManifest(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// DirtyFiles lists modified, added and untracked files in a git work tree
+func DirtyFiles(workTree string) ([]string, error) {
+	output, err := exec.Command("git", "-C", workTree, "status", "--porcelain", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace changes: %w", err)
+	}
+	return parsePorcelain(output), nil
+}
+
+// parsePorcelain extracts existing paths from `git status --porcelain -z` output
+func parsePorcelain(output []byte) []string {
+	var files []string
+	entries := bytes.Split(output, []byte{0})
+	for i := 0; i < len(entries); i++ {
+		entry := string(entries[i])
+		if len(entry) < 4 {
+			continue
+		}
+		status, path := entry[:2], entry[3:]
+		// Renames and copies are followed by the original path
+		if status[0] == 'R' || status[0] == 'C' {
+			i++
+		}
+		if status[0] == 'D' || status[1] == 'D' {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// writeArchive tars files (relative to root) into path
+func writeArchive(path, root string, files []string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create workspace archive: %w", err)
+	}
+	defer func() { _ = out.Close() }()
+
+	tw := tar.NewWriter(out)
+	for _, name := range files {
+		full := filepath.Join(root, name)
+		info, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(full); err != nil {
+				continue
+			}
+		} else if !info.Mode().IsRegular() {
+			continue
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+		if info.Mode().IsRegular() {
+			if err := copyFile(tw, full); err != nil {
+				return fmt.Errorf("failed to archive %s: %w", name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write workspace archive: %w", err)
+	}
+	return nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// extractArchive restores a workspace archive into root, refusing paths that escape it
+func extractArchive(path, root string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open workspace archive: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read workspace archive: %w", err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("workspace archive entry %q escapes the workspace", header.Name)
+		}
+		target := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+		_ = os.Remove(target)
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+			}
+			_, err = io.Copy(f, tr)
+			_ = f.Close()
+			if err != nil {
+				return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+			}
+		}
+	}
+}
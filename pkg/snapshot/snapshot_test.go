@@ -0,0 +1,160 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type fakeRunner struct {
+	calls   [][]string
+	inspect string
+}
+
+func (f *fakeRunner) Run(args ...string) (string, error) {
+	f.calls = append(f.calls, args)
+	switch args[0] {
+	case "inspect":
+		return f.inspect, nil
+	case "run":
+		return "newcontainerid\n", nil
+	case "exec":
+		if slices.Contains(args, "stat") {
+			return "1000:1000 600\n", nil
+		}
+	}
+	return "", nil
+}
+
+func TestStore_CreateListRestore(t *testing.T) {
+	dir := t.TempDir()
+	client := &fakeRunner{inspect: `{"Id":"abc123","Config":{"Labels":{"packnplay-host-path":"/src/app"}},"HostConfig":{"Binds":["/src/app:/src/app"]}}`}
+	store := NewStore(dir, client)
+
+	snap, err := store.Create("packnplay-app-main", "before-agent", CreateOptions{Metadata: []byte(`{"containerId":"abc123"}`)})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if snap.Image != "packnplay-snapshot/packnplay-app-main:before-agent" {
+		t.Errorf("Image = %q", snap.Image)
+	}
+	if snap.HostPath != "/src/app" || len(snap.Binds) != 1 {
+		t.Errorf("snapshot did not capture container details: %+v", snap)
+	}
+
+	commit := client.calls[len(client.calls)-1]
+	if commit[0] != "commit" || commit[len(commit)-1] != snap.Image || !strings.Contains(strings.Join(commit, " "), "LABEL packnplay-snapshot=before-agent") {
+		t.Errorf("commit args = %v", commit)
+	}
+
+	if _, err := store.Create("packnplay-app-main", "before-agent", CreateOptions{}); err == nil {
+		t.Error("Create() with an existing name should fail")
+	}
+	if _, err := store.Create("packnplay-app-main", "bad name", CreateOptions{}); err == nil {
+		t.Error("Create() with an invalid name should fail")
+	}
+
+	snapshots, err := store.List("")
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("List() = %v, %v", snapshots, err)
+	}
+	found, err := store.Find("before-agent")
+	if err != nil || found.Container != "packnplay-app-main" {
+		t.Fatalf("Find() = %+v, %v", found, err)
+	}
+	if data, _ := store.Metadata(found); string(data) != `{"containerId":"abc123"}` {
+		t.Errorf("Metadata() = %s", data)
+	}
+
+	id, err := store.Restore(found, RestoreOptions{ContainerName: "packnplay-app-main-before-agent"})
+	if err != nil || id != "newcontainerid" {
+		t.Fatalf("Restore() = %q, %v", id, err)
+	}
+	want := []string{"run", "-d", "--name", "packnplay-app-main-before-agent", "-v", "/src/app:/src/app", snap.Image}
+	if got := client.calls[len(client.calls)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("restore args = %v, want %v", got, want)
+	}
+}
+
+func TestStore_CreateKeepsCredentialsOut(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	client := &fakeRunner{inspect: `{"Id":"abc123","Config":{"Labels":{}},"HostConfig":{}}`}
+	store := NewStore(t.TempDir(), client)
+
+	hosts := "/home/dev/.config/gh/hosts.yml"
+	if _, err := store.Create("packnplay-app-main", "clean", CreateOptions{Exclude: []string{hosts}}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The file is copied out and removed before the commit, and put back after it
+	var steps []string
+	for _, call := range client.calls {
+		joined := strings.Join(call, " ")
+		switch {
+		case call[0] == "commit":
+			steps = append(steps, "commit")
+		case strings.Contains(joined, "rm -f -- "+hosts):
+			steps = append(steps, "remove")
+		case call[0] == "cp" && call[1] == "packnplay-app-main:"+hosts:
+			steps = append(steps, "copy out")
+		case call[0] == "cp" && call[2] == "packnplay-app-main:"+hosts:
+			steps = append(steps, "copy back")
+		}
+	}
+	if want := []string{"copy out", "remove", "commit", "copy back"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
+
+func TestParsePorcelain(t *testing.T) {
+	output := []byte(" M src/main.go\x00?? notes/todo.md\x00 D removed.go\x00R  new.go\x00old.go\x00A  added.go\x00")
+	want := []string{"src/main.go", "notes/todo.md", "new.go", "added.go"}
+	if got := parsePorcelain(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePorcelain() = %v, want %v", got, want)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "src", "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "workspace.tar")
+	if err := writeArchive(archive, src, []string{"src/main.go", "missing.go"}); err != nil {
+		t.Fatalf("writeArchive() error = %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := extractArchive(archive, dst); err != nil {
+		t.Fatalf("extractArchive() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "src", "main.go"))
+	if err != nil || string(data) != "package main\n" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+}
+
+func TestExtractArchive_RejectsEscapingPaths(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.tar")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	_ = tw.WriteHeader(&tar.Header{Name: "../escape.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	_ = f.Close()
+
+	if err := extractArchive(archive, t.TempDir()); err == nil {
+		t.Error("extractArchive() should reject paths outside the workspace")
+	}
+}
@@ -0,0 +1,259 @@
+// Package stats records local-only timing metrics for packnplay runs.
+// Nothing recorded here ever leaves the machine.
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/obra/packnplay/pkg/logrotate"
+)
+
+// Phases recorded by packnplay
+const (
+	PhaseImagePull    = "image_pull"
+	PhaseImageBuild   = "image_build"
+	PhaseFeatureBuild = "feature_build"
+	PhaseStartup      = "startup"
+	PhaseReconnect    = "reconnect"
+	lifecyclePrefix   = "lifecycle:"
+)
+
+// LifecyclePhase returns the phase name for a lifecycle command type (e.g. "postCreate")
+func LifecyclePhase(commandType string) string {
+	return lifecyclePrefix + commandType
+}
+
+// Event is a single timing measurement
+type Event struct {
+	Time       time.Time `json:"time"`
+	Project    string    `json:"project"`
+	Phase      string    `json:"phase"`
+	DurationMS int64     `json:"duration_ms"`
+	CacheHit   bool      `json:"cache_hit,omitempty"`
+}
+
+// Rotation defaults: the stats file is rotated once it would exceed
+// DefaultMaxSize, keeping DefaultKeep older file (stats.jsonl.1)
+const (
+	DefaultMaxSize = 5 << 20
+	DefaultKeep    = 1
+)
+
+// DefaultPath returns the stats file location in the XDG state directory
+func DefaultPath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, _ := os.UserHomeDir()
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, "packnplay", "stats.jsonl")
+}
+
+// Recorder appends events for one project. A nil Recorder records nothing.
+type Recorder struct {
+	path    string
+	project string
+	maxSize int64
+	keep    int
+	now     func() time.Time
+}
+
+// NewRecorder creates a Recorder writing to path for the given project directory,
+// with the default rotation
+func NewRecorder(path, project string) *Recorder {
+	return &Recorder{path: path, project: project, maxSize: DefaultMaxSize, keep: DefaultKeep, now: time.Now}
+}
+
+// Record appends an event. Failures are ignored: stats must never break a run.
+func (r *Recorder) Record(phase string, duration time.Duration, cacheHit bool) {
+	if r == nil {
+		return
+	}
+
+	data, err := json.Marshal(Event{
+		Time:       r.now().UTC(),
+		Project:    r.project,
+		Phase:      phase,
+		DurationMS: duration.Milliseconds(),
+		CacheHit:   cacheHit,
+	})
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return
+	}
+	data = append(data, '\n')
+	if err := logrotate.BeforeAppend(r.path, int64(len(data)), r.maxSize, r.keep); err != nil {
+		return
+	}
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	_, _ = f.Write(data)
+}
+
+// Load reads all events from path and its rotated files, oldest first. Missing
+// files yield no events; malformed lines (e.g. from an interrupted write) are
+// skipped.
+func Load(path string) ([]Event, error) {
+	var events []Event
+	for _, file := range logrotate.Files(path) {
+		loaded, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, loaded...)
+	}
+	return events, nil
+}
+
+func loadFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stats file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stats file: %w", err)
+	}
+	return events, nil
+}
+
+// PhaseSummary aggregates events of one phase
+type PhaseSummary struct {
+	Phase     string        `json:"phase"`
+	Count     int           `json:"count"`
+	CacheHits int           `json:"cache_hits"`
+	Average   time.Duration `json:"average_ns"` // average of non-cached runs
+	Median    time.Duration `json:"median_ns"`  // median of non-cached runs
+	Max       time.Duration `json:"max_ns"`
+	Last      time.Time     `json:"last"`
+}
+
+// HitRate returns the fraction of events that were cache hits
+func (s PhaseSummary) HitRate() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.CacheHits) / float64(s.Count)
+}
+
+// ProjectSummary aggregates all phases for one project
+type ProjectSummary struct {
+	Project string         `json:"project"`
+	Runs    int            `json:"runs"` // startup + reconnect events
+	Phases  []PhaseSummary `json:"phases"`
+}
+
+// Summarize groups events by project and phase, optionally restricted to events after since
+func Summarize(events []Event, since time.Time) []ProjectSummary {
+	type key struct{ project, phase string }
+	grouped := make(map[key][]Event)
+	projects := make(map[string]bool)
+
+	for _, event := range events {
+		if event.Time.Before(since) {
+			continue
+		}
+		grouped[key{event.Project, event.Phase}] = append(grouped[key{event.Project, event.Phase}], event)
+		projects[event.Project] = true
+	}
+
+	var summaries []ProjectSummary
+	for project := range projects {
+		summary := ProjectSummary{Project: project}
+		for k, group := range grouped {
+			if k.project != project {
+				continue
+			}
+			phase := summarizePhase(k.phase, group)
+			if k.phase == PhaseStartup || k.phase == PhaseReconnect {
+				summary.Runs += phase.Count
+			}
+			summary.Phases = append(summary.Phases, phase)
+		}
+		sort.Slice(summary.Phases, func(i, j int) bool {
+			return phaseOrder(summary.Phases[i].Phase) < phaseOrder(summary.Phases[j].Phase) ||
+				(phaseOrder(summary.Phases[i].Phase) == phaseOrder(summary.Phases[j].Phase) && summary.Phases[i].Phase < summary.Phases[j].Phase)
+		})
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Project < summaries[j].Project })
+	return summaries
+}
+
+// summarizePhase computes aggregates for events of a single phase
+func summarizePhase(phase string, events []Event) PhaseSummary {
+	summary := PhaseSummary{Phase: phase, Count: len(events)}
+
+	var durations []time.Duration
+	for _, event := range events {
+		d := time.Duration(event.DurationMS) * time.Millisecond
+		if event.CacheHit {
+			summary.CacheHits++
+		} else {
+			durations = append(durations, d)
+		}
+		if d > summary.Max {
+			summary.Max = d
+		}
+		if event.Time.After(summary.Last) {
+			summary.Last = event.Time
+		}
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		var total time.Duration
+		for _, d := range durations {
+			total += d
+		}
+		summary.Average = total / time.Duration(len(durations))
+		summary.Median = durations[len(durations)/2]
+	}
+	return summary
+}
+
+// phaseOrder sorts phases in the order they happen during a run
+func phaseOrder(phase string) int {
+	switch {
+	case phase == PhaseImagePull:
+		return 0
+	case phase == PhaseImageBuild:
+		return 1
+	case phase == PhaseFeatureBuild:
+		return 2
+	case strings.HasPrefix(phase, lifecyclePrefix):
+		return 3
+	case phase == PhaseStartup:
+		return 4
+	case phase == PhaseReconnect:
+		return 5
+	}
+	return 6
+}
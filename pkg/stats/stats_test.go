@@ -0,0 +1,134 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecorder_RecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "stats.jsonl")
+
+	recorder := NewRecorder(path, "/src/app")
+	recorder.Record(PhaseImagePull, 0, true)
+	recorder.Record(PhaseFeatureBuild, 42*time.Second, false)
+
+	// A nil recorder is a no-op
+	var nilRecorder *Recorder
+	nilRecorder.Record(PhaseStartup, time.Second, false)
+
+	// Corrupt line from an interrupted write is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"2024-`)
+	_ = f.Close()
+
+	events, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Load() = %d events, want 2", len(events))
+	}
+	if events[1].Phase != PhaseFeatureBuild || events[1].DurationMS != 42000 || events[1].Project != "/src/app" {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+	if !events[0].CacheHit {
+		t.Errorf("expected first event to be a cache hit")
+	}
+}
+
+func TestRecorder_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.jsonl")
+	recorder := &Recorder{path: path, project: "/src/app", maxSize: 200, keep: 1, now: time.Now}
+	for i := 0; i < 10; i++ {
+		recorder.Record(PhaseStartup, time.Duration(i)*time.Second, false)
+	}
+
+	for _, file := range []string{path, path + ".1"} {
+		info, err := os.Stat(file)
+		if err != nil || info.Size() > 200 {
+			t.Errorf("%s = %v, %v; want it rotated at 200 bytes", filepath.Base(file), info, err)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); err == nil {
+		t.Error("only one rotated file should be kept")
+	}
+
+	// Load reads the rotated file too, oldest first
+	events, err := Load(path)
+	if err != nil || len(events) < 2 {
+		t.Fatalf("Load() = %d events, %v", len(events), err)
+	}
+	if last := events[len(events)-1]; last.DurationMS != 9000 {
+		t.Errorf("last event = %+v, want the newest", last)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].DurationMS < events[i-1].DurationMS {
+			t.Errorf("events out of order: %+v", events)
+			break
+		}
+	}
+}
+
+func TestLoad_MissingFile(t *testing.T) {
+	events, err := Load(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || events != nil {
+		t.Errorf("Load() of missing file = %v, %v", events, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	event := func(project, phase string, seconds int, hit bool, age time.Duration) Event {
+		return Event{Time: now.Add(-age), Project: project, Phase: phase, DurationMS: int64(seconds * 1000), CacheHit: hit}
+	}
+
+	events := []Event{
+		event("/b", PhaseStartup, 5, false, time.Hour),
+		event("/a", PhaseStartup, 30, false, time.Hour),
+		event("/a", PhaseStartup, 2, false, time.Hour),
+		event("/a", PhaseReconnect, 1, false, time.Hour),
+		event("/a", PhaseImagePull, 0, true, time.Hour),
+		event("/a", PhaseImagePull, 0, true, time.Hour),
+		event("/a", PhaseImagePull, 20, false, time.Hour),
+		event("/a", LifecyclePhase("postCreate"), 10, false, time.Hour),
+		event("/a", PhaseImagePull, 99, false, 30*24*time.Hour), // outside window
+	}
+
+	summaries := Summarize(events, now.Add(-7*24*time.Hour))
+	if len(summaries) != 2 || summaries[0].Project != "/a" {
+		t.Fatalf("Summarize() = %+v", summaries)
+	}
+
+	a := summaries[0]
+	if a.Runs != 3 {
+		t.Errorf("Runs = %d, want 3", a.Runs)
+	}
+
+	var order []string
+	for _, p := range a.Phases {
+		order = append(order, p.Phase)
+	}
+	want := []string{PhaseImagePull, "lifecycle:postCreate", PhaseStartup, PhaseReconnect}
+	if len(order) != len(want) {
+		t.Fatalf("phases = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("phases = %v, want %v", order, want)
+		}
+	}
+
+	pull := a.Phases[0]
+	if pull.Count != 3 || pull.CacheHits != 2 || pull.Average != 20*time.Second {
+		t.Errorf("image_pull summary = %+v", pull)
+	}
+	startup := a.Phases[2]
+	if startup.Average != 16*time.Second || startup.Max != 30*time.Second {
+		t.Errorf("startup summary = %+v", startup)
+	}
+}
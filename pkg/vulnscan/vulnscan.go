@@ -0,0 +1,269 @@
+// Package vulnscan scans container images for known vulnerabilities with trivy or
+// grype and summarizes the findings for the pre-run policy gate.
+package vulnscan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Mode controls what happens when an image has findings at or above the threshold
+type Mode string
+
+const (
+	ModeOff    Mode = "off"    // don't scan
+	ModeWarn   Mode = "warn"   // print a summary and continue
+	ModePrompt Mode = "prompt" // print a summary and ask before continuing
+	ModeBlock  Mode = "block"  // print a summary and refuse to run
+)
+
+// severities in increasing order of badness
+var severities = []string{"UNKNOWN", "NEGLIGIBLE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// SeverityRank orders severities; unknown values rank lowest
+func SeverityRank(severity string) int {
+	for i, s := range severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return 0
+}
+
+// ErrNoScanner is returned when neither trivy nor grype is installed
+var ErrNoScanner = errors.New("no vulnerability scanner found (install trivy or grype)")
+
+// Options configures a scan
+type Options struct {
+	Scanner  string   // trivy, grype, or "" to use whichever is installed
+	Severity string   // minimum severity reported, default CRITICAL
+	Ignore   []string // vulnerability IDs to leave out
+	Runtime  string   // container runtime the image lives in (docker, podman)
+}
+
+// Finding is one vulnerable package in an image
+type Finding struct {
+	ID        string
+	Package   string
+	Installed string
+	Fixed     string
+	Severity  string
+	Title     string
+}
+
+// Report holds the findings at or above the configured severity
+type Report struct {
+	Image    string
+	Scanner  string
+	Findings []Finding
+}
+
+// Summary describes the findings, listing at most max of them
+func (r *Report) Summary(max int) string {
+	counts := make(map[string]int)
+	for _, f := range r.Findings {
+		counts[strings.ToUpper(f.Severity)]++
+	}
+	var parts []string
+	for i := len(severities) - 1; i >= 0; i-- {
+		if n := counts[severities[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, strings.ToLower(severities[i])))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s (scanned with %s)", r.Image, strings.Join(parts, ", "), r.Scanner)
+	for i, f := range r.Findings {
+		if i == max {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(r.Findings)-max)
+			break
+		}
+		fixed := "no fix available"
+		if f.Fixed != "" {
+			fixed = "fixed in " + f.Fixed
+		}
+		fmt.Fprintf(&b, "\n  %s %s %s %s (%s)", strings.ToLower(f.Severity), f.ID, f.Package, f.Installed, fixed)
+	}
+	return b.String()
+}
+
+// Scanner runs an external vulnerability scanner
+type Scanner struct {
+	opts     Options
+	run      func(name string, args ...string) ([]byte, error)
+	lookPath func(file string) (string, error)
+}
+
+// New creates a Scanner that shells out to trivy or grype
+func New(opts Options) *Scanner {
+	return &Scanner{
+		opts: opts,
+		run: func(name string, args ...string) ([]byte, error) {
+			var stderr strings.Builder
+			cmd := exec.Command(name, args...)
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return out, nil
+		},
+		lookPath: exec.LookPath,
+	}
+}
+
+// scanner picks the configured scanner, or the first one installed
+func (s *Scanner) scanner() (string, error) {
+	if s.opts.Scanner != "" && s.opts.Scanner != "auto" {
+		if _, err := s.lookPath(s.opts.Scanner); err != nil {
+			return "", fmt.Errorf("vulnerability scanner %s is not installed", s.opts.Scanner)
+		}
+		return s.opts.Scanner, nil
+	}
+	for _, name := range []string{"trivy", "grype"} {
+		if _, err := s.lookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", ErrNoScanner
+}
+
+// Scan scans a local image and returns findings at or above the configured severity
+func (s *Scanner) Scan(image string) (*Report, error) {
+	name, err := s.scanner()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	var parse func([]byte) ([]Finding, error)
+	switch name {
+	case "trivy":
+		args = []string{"image", "--quiet", "--format", "json"}
+		if s.opts.Runtime == "podman" {
+			args = append(args, "--image-src", "podman")
+		}
+		args = append(args, image)
+		parse = parseTrivy
+	case "grype":
+		source := "docker:" + image
+		if s.opts.Runtime == "podman" {
+			source = "podman:" + image
+		}
+		args = []string{source, "-o", "json", "-q"}
+		parse = parseGrype
+	default:
+		return nil, fmt.Errorf("unsupported vulnerability scanner %q (use trivy or grype)", name)
+	}
+
+	output, err := s.run(name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s scan of %s failed: %w", name, image, err)
+	}
+	findings, err := parse(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s output: %w", name, err)
+	}
+
+	return &Report{Image: image, Scanner: name, Findings: s.filter(findings)}, nil
+}
+
+// filter drops findings below the threshold or on the ignore list, worst first
+func (s *Scanner) filter(findings []Finding) []Finding {
+	threshold := s.opts.Severity
+	if threshold == "" {
+		threshold = "CRITICAL"
+	}
+	minRank := SeverityRank(threshold)
+	ignored := make(map[string]bool)
+	for _, id := range s.opts.Ignore {
+		ignored[strings.ToUpper(id)] = true
+	}
+
+	seen := make(map[string]bool)
+	var kept []Finding
+	for _, f := range findings {
+		key := f.ID + " " + f.Package
+		if SeverityRank(f.Severity) < minRank || ignored[strings.ToUpper(f.ID)] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, f)
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return SeverityRank(kept[i].Severity) > SeverityRank(kept[j].Severity)
+	})
+	return kept
+}
+
+// parseTrivy reads `trivy image --format json` output
+func parseTrivy(data []byte) ([]Finding, error) {
+	var out struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, result := range out.Results {
+		for _, v := range result.Vulnerabilities {
+			findings = append(findings, Finding{
+				ID:        v.VulnerabilityID,
+				Package:   v.PkgName,
+				Installed: v.InstalledVersion,
+				Fixed:     v.FixedVersion,
+				Severity:  strings.ToUpper(v.Severity),
+				Title:     v.Title,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// parseGrype reads `grype -o json` output
+func parseGrype(data []byte) ([]Finding, error) {
+	var out struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	var findings []Finding
+	for _, m := range out.Matches {
+		findings = append(findings, Finding{
+			ID:        m.Vulnerability.ID,
+			Package:   m.Artifact.Name,
+			Installed: m.Artifact.Version,
+			Fixed:     strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Severity:  strings.ToUpper(m.Vulnerability.Severity),
+			Title:     m.Vulnerability.Description,
+		})
+	}
+	return findings, nil
+}
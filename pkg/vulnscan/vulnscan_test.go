@@ -0,0 +1,135 @@
+package vulnscan
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const trivyOutput = `{
+  "Results": [
+    {
+      "Target": "ubuntu:22.04 (ubuntu 22.04)",
+      "Vulnerabilities": [
+        {"VulnerabilityID": "CVE-2024-0001", "PkgName": "openssl", "InstalledVersion": "3.0.2", "FixedVersion": "3.0.3", "Severity": "CRITICAL", "Title": "bad"},
+        {"VulnerabilityID": "CVE-2024-0002", "PkgName": "zlib", "InstalledVersion": "1.2.11", "Severity": "HIGH"},
+        {"VulnerabilityID": "CVE-2024-0003", "PkgName": "tar", "InstalledVersion": "1.34", "Severity": "LOW"}
+      ]
+    },
+    {"Target": "app/package-lock.json"}
+  ]
+}`
+
+const grypeOutput = `{
+  "matches": [
+    {
+      "vulnerability": {"id": "GHSA-xxxx", "severity": "Critical", "fix": {"versions": ["4.17.21"]}},
+      "artifact": {"name": "lodash", "version": "4.17.15"}
+    },
+    {
+      "vulnerability": {"id": "CVE-2023-9999", "severity": "Medium", "fix": {"versions": []}},
+      "artifact": {"name": "curl", "version": "7.81.0"}
+    }
+  ]
+}`
+
+func fakeScanner(opts Options, installed []string, output string) (*Scanner, *[]string) {
+	var argv []string
+	s := New(opts)
+	s.lookPath = func(file string) (string, error) {
+		for _, name := range installed {
+			if name == file {
+				return "/usr/bin/" + file, nil
+			}
+		}
+		return "", errors.New("not found")
+	}
+	s.run = func(name string, args ...string) ([]byte, error) {
+		argv = append([]string{name}, args...)
+		return []byte(output), nil
+	}
+	return s, &argv
+}
+
+func TestScanTrivy(t *testing.T) {
+	s, argv := fakeScanner(Options{Severity: "high"}, []string{"trivy", "grype"}, trivyOutput)
+
+	report, err := s.Scan("ubuntu:22.04")
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if report.Scanner != "trivy" {
+		t.Errorf("Scanner = %s, want trivy (preferred when both are installed)", report.Scanner)
+	}
+	if got := strings.Join(*argv, " "); got != "trivy image --quiet --format json ubuntu:22.04" {
+		t.Errorf("command = %q", got)
+	}
+	if len(report.Findings) != 2 || report.Findings[0].ID != "CVE-2024-0001" || report.Findings[1].ID != "CVE-2024-0002" {
+		t.Errorf("Findings = %+v, want critical and high only", report.Findings)
+	}
+}
+
+func TestScanGrypePodman(t *testing.T) {
+	s, argv := fakeScanner(Options{Severity: "medium", Runtime: "podman"}, []string{"grype"}, grypeOutput)
+
+	report, err := s.Scan("localhost/app:latest")
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := strings.Join(*argv, " "); got != "grype podman:localhost/app:latest -o json -q" {
+		t.Errorf("command = %q", got)
+	}
+	if len(report.Findings) != 2 {
+		t.Fatalf("Findings = %+v, want 2", report.Findings)
+	}
+	if f := report.Findings[0]; f.ID != "GHSA-xxxx" || f.Severity != "CRITICAL" || f.Fixed != "4.17.21" || f.Package != "lodash" {
+		t.Errorf("Findings[0] = %+v", f)
+	}
+}
+
+func TestScanDefaultsAndIgnore(t *testing.T) {
+	s, _ := fakeScanner(Options{}, []string{"trivy"}, trivyOutput)
+	report, err := s.Scan("ubuntu:22.04")
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].Severity != "CRITICAL" {
+		t.Errorf("Findings = %+v, default threshold should be critical", report.Findings)
+	}
+
+	s, _ = fakeScanner(Options{Ignore: []string{"cve-2024-0001"}}, []string{"trivy"}, trivyOutput)
+	if report, _ := s.Scan("ubuntu:22.04"); len(report.Findings) != 0 {
+		t.Errorf("Findings = %+v, ignored IDs should be dropped", report.Findings)
+	}
+}
+
+func TestScanNoScanner(t *testing.T) {
+	s, _ := fakeScanner(Options{}, nil, "")
+	if _, err := s.Scan("ubuntu"); !errors.Is(err, ErrNoScanner) {
+		t.Errorf("Scan() error = %v, want ErrNoScanner", err)
+	}
+
+	s, _ = fakeScanner(Options{Scanner: "grype"}, []string{"trivy"}, "")
+	if _, err := s.Scan("ubuntu"); err == nil || !strings.Contains(err.Error(), "grype is not installed") {
+		t.Errorf("Scan() error = %v, want configured scanner missing", err)
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	report := &Report{
+		Image:   "ubuntu:22.04",
+		Scanner: "trivy",
+		Findings: []Finding{
+			{ID: "CVE-1", Package: "openssl", Installed: "3.0.2", Fixed: "3.0.3", Severity: "CRITICAL"},
+			{ID: "CVE-2", Package: "zlib", Installed: "1.2.11", Severity: "CRITICAL"},
+			{ID: "CVE-3", Package: "tar", Installed: "1.34", Severity: "HIGH"},
+		},
+	}
+
+	summary := report.Summary(2)
+	for _, want := range []string{"2 critical, 1 high", "CVE-1 openssl 3.0.2 (fixed in 3.0.3)", "CVE-2 zlib 1.2.11 (no fix available)", "and 1 more"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("Summary() missing %q:\n%s", want, summary)
+		}
+	}
+}